@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// resolveFunc resolves the name to the resource records of the type, and
+// returns the result with its DNSSEC status (empty when it's not validated).
+type resolveFunc func(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+) (*resolver.Result, string, error)
+
+// runBatch reads one query ("name [type]") per line, resolves at most
+// concurrency queries at a time, and streams every result as soon as it's
+// resolved: the answer resource records, or a comment with the error. With
+// jsonOutput, every result is printed as a JSON object on a single line.
+// Empty lines and lines starting with "#" or ";" are skipped.
+//
+// It returns exitOK when all queries were resolved, and exitFailure otherwise;
+// an error is only returned when the queries can't be read.
+func runBatch(
+	ctx context.Context,
+	r io.Reader,
+	w io.Writer,
+	resolve resolveFunc,
+	concurrency int,
+	jsonOutput bool,
+) (int, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed bool
+	)
+	sem := make(chan struct{}, concurrency)
+
+	// emit writes the output of a single query, so outputs of concurrent
+	// queries don't interleave.
+	emit := func(out string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			failed = true
+		}
+		fmt.Fprint(w, out)
+	}
+
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		name, qt, err := parseQuery(strings.Fields(line))
+		if err != nil {
+			emit(fmt.Sprintf(";; line %d: %v\n", lineNum, err), err)
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result, status, err := resolve(ctx, name, qt)
+			if jsonOutput {
+				emit(batchJSON(name, qt, result, status, err), err)
+				return
+			}
+			emit(batchText(name, qt, result, status, err), err)
+		}()
+	}
+	wg.Wait()
+
+	if err := s.Err(); err != nil {
+		return exitFailure, err
+	}
+	if failed {
+		return exitFailure, nil
+	}
+
+	return exitOK, nil
+}
+
+// batchText returns the text output of a batch query.
+func batchText(
+	name string,
+	qt dns.QType,
+	result *resolver.Result,
+	status string,
+	err error,
+) string {
+	if err != nil {
+		return fmt.Sprintf(";; %s %s: %v\n", name, qt, err)
+	}
+
+	b := new(strings.Builder)
+	for _, rr := range result.CNAMEs {
+		fmt.Fprintln(b, rr.String())
+	}
+	for _, rr := range result.Answer {
+		fmt.Fprintln(b, rr.String())
+	}
+	if status != "" {
+		fmt.Fprintf(b, ";; %s %s: dnssec %s\n", name, qt, status)
+	}
+
+	return b.String()
+}
+
+// batchJSON returns the JSON output of a batch query, on a single line.
+func batchJSON(
+	name string,
+	qt dns.QType,
+	result *resolver.Result,
+	status string,
+	err error,
+) string {
+	var j jsonMsg
+	if err != nil {
+		j = jsonMsg{
+			QNAME:     name,
+			QTYPE:     uint16(qt),
+			QTYPEname: qt.String(),
+			Error:     err.Error(),
+		}
+	} else {
+		j = newJSONMsg(result.Response, resultServer(result), result.RTT)
+		j.DNSSEC = status
+	}
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Sprintf(";; %s %s: failed to encode json: %v\n", name, qt, err)
+	}
+
+	return string(b) + "\n"
+}
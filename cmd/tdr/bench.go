@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// benchTransports maps the name of a transport to the transport.
+var benchTransports = map[string]resolver.Transport{
+	"udp": resolver.PooledUDP,
+	"tcp": resolver.TCP,
+}
+
+// benchStats holds the outcome of all queries of a benchmark.
+type benchStats struct {
+	mu sync.Mutex
+
+	// sent is the number of queries sent.
+	sent int
+
+	// timeouts is the number of queries that weren't answered in time.
+	timeouts int
+
+	// failures is the number of queries that failed for any other reason.
+	failures int
+
+	// firstErr is the first error of a failed query, to hint at the cause.
+	firstErr error
+
+	// rcodes counts the responses per response code.
+	rcodes map[dns.RCode]int
+
+	// latencies holds the round-trip time of every response.
+	latencies []time.Duration
+}
+
+// add records the outcome of a single query.
+func (s *benchStats) add(resp *dns.Msg, rtt time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent++
+	if err != nil && s.firstErr == nil {
+		s.firstErr = err
+	}
+	switch {
+	case errors.Is(err, resolver.ErrTimeout):
+		s.timeouts++
+	case err != nil:
+		s.failures++
+	default:
+		s.rcodes[resp.RCode]++
+		s.latencies = append(s.latencies, rtt)
+	}
+}
+
+// runBench runs "tdr bench [flags] server", which sends the queries of a name
+// list to the server at a fixed rate, and reports the latency percentiles,
+// timeouts, and error rates.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	names := fs.String(
+		"f", "-", `file with one query ("name [type]") per line; "-" reads stdin`,
+	)
+	transport := fs.String("transport", "udp", "transport to send the queries over (udp or tcp)")
+	qps := fs.Int("qps", 100, "number of queries to send per second")
+	duration := fs.Duration("duration", time.Second*10, "time to send queries for")
+	timeout := fs.Duration("timeout", time.Second*2, "time to wait for a response")
+	recursive := fs.Bool("rd", true, "set the recursion desired flag")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench [flags] server\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	t, ok := benchTransports[*transport]
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single server")
+	case !ok:
+		err = fmt.Errorf("unsupported transport %q", *transport)
+	case *qps < 1:
+		err = fmt.Errorf("-qps must be at least 1")
+	case *duration <= 0:
+		err = fmt.Errorf("-duration must be positive")
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	server := fs.Arg(0)
+
+	r := os.Stdin
+	if *names != "-" {
+		f, err := os.Open(*names)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open name list: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		r = f
+	}
+	reqs, err := readRequests(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read name list: %v\n", err)
+		return exitFailure
+	}
+	if len(reqs) == 0 {
+		fmt.Fprintln(os.Stderr, "empty name list")
+		return exitUsage
+	}
+
+	client := resolver.NewClient(resolver.WithTimeout(*timeout), resolver.WithTransport(t))
+	stats := bench(context.Background(), client, server, reqs, *qps, *duration, *recursive)
+
+	return reportBench(os.Stdout, server, *transport, *duration, stats)
+}
+
+// readRequests reads one query ("name [type]") per line. Empty lines and lines
+// starting with "#" or ";" are skipped.
+func readRequests(r io.Reader) ([]request, error) {
+	reqs := []request{}
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		name, qt, err := parseQuery(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		reqs = append(reqs, request{name: name, qt: qt})
+	}
+
+	return reqs, s.Err()
+}
+
+// bench sends qps queries per second to the server for the duration, cycling
+// through the requests, and waits for the outstanding queries to finish.
+// Queries are sent on schedule regardless of how long responses take, so a
+// slow server doesn't lower the offered load.
+func bench(
+	ctx context.Context,
+	client *resolver.Client,
+	server string,
+	reqs []request,
+	qps int,
+	duration time.Duration,
+	recursive bool,
+) *benchStats {
+	stats := &benchStats{rcodes: map[dns.RCode]int{}}
+	total := int(duration.Seconds() * float64(qps))
+
+	var wg sync.WaitGroup
+	t := time.NewTicker(time.Second / time.Duration(qps))
+	defer t.Stop()
+	for i := 0; i < total; i++ {
+		r := reqs[i%len(reqs)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			msg, err := newQuery(r.name, r.qt, recursive)
+			if err != nil {
+				stats.add(nil, 0, err)
+				return
+			}
+			start := time.Now()
+			resp, err := client.ExchangeContext(ctx, msg, server)
+			stats.add(resp, time.Since(start), err)
+		}()
+		<-t.C
+	}
+	wg.Wait()
+
+	return stats
+}
+
+// percentile returns the p-th percentile (0-100) of the sorted latencies,
+// using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// reportBench prints the outcome of the benchmark. It returns exitOK when
+// every query was answered.
+func reportBench(
+	out io.Writer,
+	server string,
+	transport string,
+	duration time.Duration,
+	stats *benchStats,
+) int {
+	sort.Slice(stats.latencies, func(i, j int) bool {
+		return stats.latencies[i] < stats.latencies[j]
+	})
+	answered := len(stats.latencies)
+	rate := func(n int) string {
+		if stats.sent == 0 {
+			return "0.00%"
+		}
+		return fmt.Sprintf("%.2f%%", float64(n)/float64(stats.sent)*100)
+	}
+
+	fmt.Fprintf(out, ";; %s over %s for %s\n\n", server, transport, duration)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Queries sent:\t%d\t(%.1f qps)\n", stats.sent, float64(stats.sent)/duration.Seconds())
+	fmt.Fprintf(w, "Responses:\t%d\t%s\n", answered, rate(answered))
+	fmt.Fprintf(w, "Timeouts:\t%d\t%s\n", stats.timeouts, rate(stats.timeouts))
+	fmt.Fprintf(w, "Errors:\t%d\t%s\n", stats.failures, rate(stats.failures))
+	w.Flush()
+	if stats.firstErr != nil {
+		fmt.Fprintf(out, "\n;; first error: %v\n", stats.firstErr)
+	}
+
+	if answered > 0 {
+		fmt.Fprintln(out, "\nResponse codes:")
+		rcodes := []dns.RCode{}
+		for rc := range stats.rcodes {
+			rcodes = append(rcodes, rc)
+		}
+		sort.Slice(rcodes, func(i, j int) bool { return rcodes[i] < rcodes[j] })
+		w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, rc := range rcodes {
+			name := rcodeMnemonics[rc]
+			if name == "" {
+				name = rc.String()
+			}
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", name, stats.rcodes[rc], rate(stats.rcodes[rc]))
+		}
+		w.Flush()
+
+		fmt.Fprintln(out, "\nLatency:")
+		w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "  min\t%s\n", stats.latencies[0])
+		for _, p := range []float64{50, 90, 95, 99, 99.9} {
+			fmt.Fprintf(w, "  p%g\t%s\n", p, percentile(stats.latencies, p))
+		}
+		fmt.Fprintf(w, "  max\t%s\n", stats.latencies[answered-1])
+		w.Flush()
+	}
+
+	if answered != stats.sent {
+		return exitFailure
+	}
+
+	return exitOK
+}
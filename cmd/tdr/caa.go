@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// caaPolicy is the issuance policy of the relevant CAA resource record set of
+// a domain.
+type caaPolicy struct {
+	// issuers holds the certification authorities that may issue certificates;
+	// nil means any certification authority may.
+	issuers []string
+
+	// wildcardIssuers holds the certification authorities that may issue
+	// wildcard certificates; nil means any certification authority may.
+	wildcardIssuers []string
+
+	// reports holds the URLs of the incident reports (iodef).
+	reports []string
+
+	// critical holds the unknown critical tags, which forbid issuance.
+	critical []string
+}
+
+// runCAA runs "tdr caa [flags] domain", which finds the relevant CAA resource
+// record set of the domain the way certification authorities do, and reports
+// which ones are permitted to issue certificates for the domain.
+func runCAA(args []string) int {
+	fs := flag.NewFlagSet("caa", flag.ExitOnError)
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s caa [flags] domain\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	if fs.NArg() != 1 {
+		err = fmt.Errorf("expected a single domain")
+	} else {
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	domain := strings.ToLower(fs.Arg(0))
+	domain = dns.Fqdn(domain)
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	result, err := findCAA(ctx, client, domain)
+	if err != nil {
+		log.Printf("failed to find the CAA records of %s: %v", domain, err)
+		return exitCode(err)
+	}
+
+	reportCAA(os.Stdout, domain, result)
+	return exitOK
+}
+
+// findCAA finds the relevant CAA resource record set of the domain, i.e. the
+// one of the domain, or else of its closest ancestor (excluding the root) that
+// has one. It returns nil when none of them have CAA resource records.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8659#section-3
+func findCAA(
+	ctx context.Context,
+	client *resolver.Client,
+	domain string,
+) (*resolver.Result, error) {
+	for name := domain; name != "."; name = dns.ParentDomainName(name) {
+		result, err := client.ResolveContext(ctx, name, dns.TypeCAA)
+		if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rr := range result.Answer {
+			if rr.Type == dns.TypeCAA {
+				return result, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// newCAAPolicy gets the issuance policy of the CAA resource records. Issuers
+// are the domain names of the "issue" and "issuewild" properties; a property
+// without a domain name permits no issuer. When there are no "issuewild"
+// properties, the "issue" properties apply to wildcard certificates as well;
+// without either, issuance isn't restricted.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8659#section-4.2
+func newCAAPolicy(rrs []dns.RR) caaPolicy {
+	p := caaPolicy{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypeCAA {
+			continue
+		}
+		rd, err := rr.Decode()
+		if err != nil {
+			continue
+		}
+		caa := rd.(*dns.CAA)
+
+		issuer := strings.TrimSpace(strings.SplitN(caa.Value, ";", 2)[0])
+		switch strings.ToLower(caa.Tag) {
+		case "issue":
+			if p.issuers == nil {
+				p.issuers = []string{}
+			}
+			if issuer != "" {
+				p.issuers = append(p.issuers, issuer)
+			}
+		case "issuewild":
+			if p.wildcardIssuers == nil {
+				p.wildcardIssuers = []string{}
+			}
+			if issuer != "" {
+				p.wildcardIssuers = append(p.wildcardIssuers, issuer)
+			}
+		case "iodef":
+			p.reports = append(p.reports, caa.Value)
+		default:
+			if caa.Critical() {
+				p.critical = append(p.critical, caa.Tag)
+			}
+		}
+	}
+	if p.wildcardIssuers == nil {
+		p.wildcardIssuers = p.issuers
+	}
+
+	return p
+}
+
+// reportCAA prints the relevant CAA resource record set of the domain, and the
+// certification authorities it permits.
+func reportCAA(out io.Writer, domain string, result *resolver.Result) {
+	if result == nil {
+		fmt.Fprintf(out, ";; %s and its ancestors have no CAA records\n\n", domain)
+		fmt.Fprintln(out, "Any certificate authority may issue certificates")
+		return
+	}
+
+	fmt.Fprintf(out, ";; CAA records of %s found at %s\n", domain, result.Name)
+	for _, rr := range result.CNAMEs {
+		fmt.Fprintln(out, rr.String())
+	}
+	for _, rr := range result.Answer {
+		fmt.Fprintln(out, rr.String())
+	}
+	fmt.Fprintln(out)
+
+	p := newCAAPolicy(result.Answer)
+	issuers := func(names []string) string {
+		switch {
+		case len(p.critical) > 0:
+			return fmt.Sprintf("none (unknown critical property %s)", strings.Join(p.critical, ", "))
+		case names == nil:
+			return "any"
+		case len(names) == 0:
+			return "none"
+		default:
+			return strings.Join(names, ", ")
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Certificates:\t%s\n", issuers(p.issuers))
+	fmt.Fprintf(w, "Wildcard certificates:\t%s\n", issuers(p.wildcardIssuers))
+	if len(p.reports) > 0 {
+		fmt.Fprintf(w, "Incident reports:\t%s\n", strings.Join(p.reports, ", "))
+	}
+	w.Flush()
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Magic numbers of capture files.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcap
+// See: https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcapng
+const (
+	pcapMagicMicro  = 0xa1b2c3d4
+	pcapMagicNano   = 0xa1b23c4d
+	pcapngBlockSHB  = 0x0a0d0d0a
+	pcapngByteOrder = 0x1a2b3c4d
+)
+
+// Block types of pcapng files.
+const (
+	pcapngBlockIDB = 0x00000001
+	pcapngBlockSPB = 0x00000003
+	pcapngBlockEPB = 0x00000006
+)
+
+// Link types of captured packets.
+//
+// See: https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// maxPacketSize is the max size of a captured packet that's read; larger
+// sizes indicate a corrupt file.
+const maxPacketSize = 1 << 18
+
+// packet is a packet read from a capture file.
+type packet struct {
+	ts       time.Time
+	linkType uint32
+	data     []byte
+}
+
+// captureReader reads the packets of a capture file. It returns io.EOF when
+// there are no more packets.
+type captureReader interface {
+	next() (packet, error)
+}
+
+// newCaptureReader creates a reader for the pcap or pcapng capture file.
+func newCaptureReader(r io.Reader) (captureReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read magic number: %w", err)
+	}
+
+	if binary.BigEndian.Uint32(magic) == pcapngBlockSHB {
+		return &pcapngReader{r: br}, nil
+	}
+
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	p := &pcapReader{r: br}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(hdr) {
+		case pcapMagicMicro:
+			p.order, p.units = order, uint64(time.Second/time.Microsecond)
+		case pcapMagicNano:
+			p.order, p.units = order, uint64(time.Second/time.Nanosecond)
+		default:
+			continue
+		}
+		p.linkType = p.order.Uint32(hdr[20:]) & 0xffff
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("not a pcap or pcapng file")
+}
+
+// pcapReader reads the packets of a pcap file.
+type pcapReader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	linkType uint32
+
+	// units is the number of timestamp units per second.
+	units uint64
+}
+
+// next reads the next packet record.
+func (p *pcapReader) next() (packet, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, hdr); err != nil {
+		return packet{}, err
+	}
+	size := p.order.Uint32(hdr[8:])
+	if size > maxPacketSize {
+		return packet{}, fmt.Errorf("packet size %d exceeds %d bytes", size, maxPacketSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return packet{}, unexpectedEOF(err)
+	}
+
+	secs, frac := uint64(p.order.Uint32(hdr)), uint64(p.order.Uint32(hdr[4:]))
+	return packet{
+		ts:       timestamp(secs*p.units+frac, p.units),
+		linkType: p.linkType,
+		data:     data,
+	}, nil
+}
+
+// pcapngInterface is an interface that packets of a pcapng file are captured
+// on.
+type pcapngInterface struct {
+	linkType uint32
+
+	// units is the number of timestamp units per second.
+	units uint64
+}
+
+// pcapngReader reads the packets of a pcapng file.
+type pcapngReader struct {
+	r *bufio.Reader
+
+	// order is the byte order of the current section.
+	order binary.ByteOrder
+
+	// ifaces holds the interfaces of the current section.
+	ifaces []pcapngInterface
+}
+
+// next reads blocks until it reads a packet block.
+func (p *pcapngReader) next() (packet, error) {
+	for {
+		hdr := make([]byte, 8)
+		if _, err := io.ReadFull(p.r, hdr); err != nil {
+			return packet{}, err
+		}
+
+		// The byte order of a section is only known after reading the byte order
+		// magic of its header block.
+		if binary.BigEndian.Uint32(hdr) == pcapngBlockSHB {
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(p.r, bom); err != nil {
+				return packet{}, unexpectedEOF(err)
+			}
+			p.order = binary.ByteOrder(binary.LittleEndian)
+			if binary.BigEndian.Uint32(bom) == pcapngByteOrder {
+				p.order = binary.BigEndian
+			}
+			p.ifaces = nil
+
+			size := p.order.Uint32(hdr[4:])
+			if size < 16 || size > maxPacketSize {
+				return packet{}, fmt.Errorf("invalid section header block size %d", size)
+			}
+			if _, err := p.r.Discard(int(size) - 12); err != nil {
+				return packet{}, unexpectedEOF(err)
+			}
+			continue
+		}
+		if p.order == nil {
+			return packet{}, fmt.Errorf("block precedes the section header block")
+		}
+
+		size := p.order.Uint32(hdr[4:])
+		if size < 12 || size > maxPacketSize {
+			return packet{}, fmt.Errorf("invalid block size %d", size)
+		}
+		body := make([]byte, size-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return packet{}, unexpectedEOF(err)
+		}
+		body = body[:len(body)-4]
+
+		switch p.order.Uint32(hdr) {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return packet{}, fmt.Errorf("invalid interface description block")
+			}
+			p.ifaces = append(p.ifaces, pcapngInterface{
+				linkType: uint32(p.order.Uint16(body)),
+				units:    p.tsUnits(body[8:]),
+			})
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return packet{}, fmt.Errorf("invalid enhanced packet block")
+			}
+			id := p.order.Uint32(body)
+			if int(id) >= len(p.ifaces) {
+				return packet{}, fmt.Errorf("packet of unknown interface %d", id)
+			}
+			iface := p.ifaces[id]
+			ts := uint64(p.order.Uint32(body[4:]))<<32 | uint64(p.order.Uint32(body[8:]))
+			caplen := p.order.Uint32(body[12:])
+			if int(caplen) > len(body)-20 {
+				return packet{}, fmt.Errorf("invalid enhanced packet block length %d", caplen)
+			}
+			return packet{
+				ts:       timestamp(ts, iface.units),
+				linkType: iface.linkType,
+				data:     body[20 : 20+caplen],
+			}, nil
+		case pcapngBlockSPB:
+			// Simple packet blocks have no timestamp, and are captured on the first
+			// interface.
+			if len(body) < 4 || len(p.ifaces) == 0 {
+				return packet{}, fmt.Errorf("invalid simple packet block")
+			}
+			return packet{linkType: p.ifaces[0].linkType, data: body[4:]}, nil
+		}
+	}
+}
+
+// tsUnits returns the number of timestamp units per second of the options of
+// an interface description block (if_tsresol); the default is microseconds.
+func (p *pcapngReader) tsUnits(opts []byte) uint64 {
+	const optEnd, optTSResol = 0, 9
+
+	for len(opts) >= 4 {
+		code, size := p.order.Uint16(opts), int(p.order.Uint16(opts[2:]))
+		if code == optEnd || 4+size > len(opts) {
+			break
+		}
+		if code == optTSResol && size == 1 {
+			// The most significant bit specifies if the resolution is a negative
+			// power of 2 or 10.
+			res, units := opts[4], uint64(1)
+			base := uint64(10)
+			if res&0x80 != 0 {
+				base = 2
+			}
+			for i := 0; i < int(res&0x7f) && units < 1<<60; i++ {
+				units *= base
+			}
+			return units
+		}
+		// Option values are padded to 32 bits; the padding of the last option may
+		// be missing in a corrupt file.
+		next := 4 + (size+3)&^3
+		if next > len(opts) {
+			break
+		}
+		opts = opts[next:]
+	}
+
+	return uint64(time.Second / time.Microsecond)
+}
+
+// timestamp converts a timestamp in units per second since the epoch.
+func timestamp(ts uint64, units uint64) time.Time {
+	if units == 0 {
+		return time.Time{}
+	}
+	frac := ts % units * uint64(time.Second) / units
+
+	return time.Unix(int64(ts/units), int64(frac)).UTC()
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, for a file that ends
+// in the middle of a record.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// segment is the transport layer payload of a packet.
+type segment struct {
+	ts time.Time
+
+	// proto is "udp" or "tcp".
+	proto string
+
+	src, dst net.IP
+	sport    uint16
+	dport    uint16
+
+	// TCP only.
+	seq uint32
+	syn bool
+
+	payload []byte
+}
+
+// srcAddr returns the source address "ip:port" of the segment.
+func (s *segment) srcAddr() string {
+	return net.JoinHostPort(s.src.String(), strconv.Itoa(int(s.sport)))
+}
+
+// dstAddr returns the destination address "ip:port" of the segment.
+func (s *segment) dstAddr() string {
+	return net.JoinHostPort(s.dst.String(), strconv.Itoa(int(s.dport)))
+}
+
+// decodePacket decodes the link, network and transport layers of the packet,
+// and returns its UDP or TCP segment. It reports false for other packets, and
+// for IP fragments (which aren't reassembled).
+func decodePacket(p packet) (segment, bool) {
+	data := p.data
+	ethertype := -1
+	switch p.linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return segment{}, false
+		}
+		ethertype, data = int(binary.BigEndian.Uint16(data[12:])), data[14:]
+		// Skip VLAN tags (802.1Q and 802.1ad).
+		for (ethertype == 0x8100 || ethertype == 0x88a8) && len(data) >= 4 {
+			ethertype, data = int(binary.BigEndian.Uint16(data[2:])), data[4:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		// The address family is in host byte order; the IP version is read from
+		// the IP header instead.
+		if len(data) < 4 {
+			return segment{}, false
+		}
+		data = data[4:]
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return segment{}, false
+		}
+		ethertype, data = int(binary.BigEndian.Uint16(data[14:])), data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		ethertype, data = int(binary.BigEndian.Uint16(data)), data[20:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return segment{}, false
+	}
+	if ethertype != -1 && ethertype != 0x0800 && ethertype != 0x86dd {
+		return segment{}, false
+	}
+	if len(data) == 0 {
+		return segment{}, false
+	}
+
+	s := segment{ts: p.ts}
+	var proto byte
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if ihl < 20 || total < ihl || total > len(data) {
+			return segment{}, false
+		}
+		// Skip fragments: the more fragments flag, or a fragment offset.
+		if binary.BigEndian.Uint16(data[6:])&0x3fff != 0 {
+			return segment{}, false
+		}
+		proto = data[9]
+		s.src, s.dst = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:total]
+	case 6:
+		if len(data) < 40 {
+			return segment{}, false
+		}
+		total := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		if total > len(data) {
+			return segment{}, false
+		}
+		proto = data[6]
+		s.src, s.dst = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40:total]
+		// Skip the hop-by-hop, routing and destination options extension
+		// headers; fragments aren't reassembled.
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(data) < 8 || len(data) < (int(data[1])+1)*8 {
+				return segment{}, false
+			}
+			proto, data = data[0], data[(int(data[1])+1)*8:]
+		}
+	default:
+		return segment{}, false
+	}
+
+	switch proto {
+	case 17:
+		if len(data) < 8 {
+			return segment{}, false
+		}
+		s.proto = "udp"
+		s.payload = data[8:]
+	case 6:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return segment{}, false
+		}
+		s.proto = "tcp"
+		s.seq = binary.BigEndian.Uint32(data[4:])
+		s.syn = data[13]&0x02 != 0
+		s.payload = data[offset:]
+	default:
+		return segment{}, false
+	}
+	s.sport = binary.BigEndian.Uint16(data)
+	s.dport = binary.BigEndian.Uint16(data[2:])
+
+	return s, true
+}
+
+// tcpStream reassembles the DNS messages sent in one direction of a TCP
+// connection, which are prefixed with their length. Segments are expected in
+// order; retransmitted bytes are skipped, and the buffered bytes are dropped
+// when bytes are missing.
+type tcpStream struct {
+	// next is the sequence number of the next expected byte.
+	next    uint32
+	started bool
+	buf     []byte
+}
+
+// add adds the segment to the stream, and returns the messages it completes.
+func (t *tcpStream) add(s segment) [][]byte {
+	if s.syn {
+		t.next, t.started, t.buf = s.seq+1, true, nil
+		return nil
+	}
+	if len(s.payload) == 0 {
+		return nil
+	}
+
+	payload := s.payload
+	if t.started && s.seq != t.next {
+		diff := int32(t.next - s.seq)
+		switch {
+		case diff > 0 && int(diff) >= len(payload):
+			return nil
+		case diff > 0:
+			payload = payload[diff:]
+		default:
+			t.buf = nil
+		}
+	}
+	t.started = true
+	t.next = s.seq + uint32(len(s.payload))
+	t.buf = append(t.buf, payload...)
+
+	msgs := [][]byte{}
+	for len(t.buf) >= 2 {
+		size := int(binary.BigEndian.Uint16(t.buf))
+		if len(t.buf) < 2+size {
+			break
+		}
+		msgs = append(msgs, t.buf[2:2+size])
+		t.buf = t.buf[2+size:]
+	}
+
+	return msgs
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// pcapFile builds a little-endian pcap file of raw IP packets.
+func pcapFile(magic uint32, records ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, magic)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, linkTypeRaw)
+	for _, r := range records {
+		b = append(b, r...)
+	}
+
+	return b
+}
+
+// pcapRecord builds a pcap packet record; size is the captured length.
+func pcapRecord(secs, frac, size uint32, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, secs)
+	b = binary.LittleEndian.AppendUint32(b, frac)
+	b = binary.LittleEndian.AppendUint32(b, size)
+	b = binary.LittleEndian.AppendUint32(b, size)
+
+	return append(b, data...)
+}
+
+// pcapngBlock builds a little-endian pcapng block with the body.
+func pcapngBlock(typ uint32, body []byte) []byte {
+	size := uint32(12 + len(body))
+	b := binary.LittleEndian.AppendUint32(nil, typ)
+	b = binary.LittleEndian.AppendUint32(b, size)
+	b = append(b, body...)
+
+	return binary.LittleEndian.AppendUint32(b, size)
+}
+
+// pcapngSHB builds a little-endian section header block.
+func pcapngSHB() []byte {
+	body := binary.LittleEndian.AppendUint32(nil, pcapngByteOrder)
+	body = binary.LittleEndian.AppendUint16(body, 1)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = append(body, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	return pcapngBlock(pcapngBlockSHB, body)
+}
+
+// pcapngIDB builds an interface description block of raw IP packets with the
+// options.
+func pcapngIDB(opts ...byte) []byte {
+	body := binary.LittleEndian.AppendUint16(nil, linkTypeRaw)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 65535)
+
+	return pcapngBlock(pcapngBlockIDB, append(body, opts...))
+}
+
+// pcapngEPB builds an enhanced packet block; size is the captured length.
+func pcapngEPB(iface uint32, ts uint64, size uint32, data []byte) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, iface)
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts))
+	body = binary.LittleEndian.AppendUint32(body, size)
+	body = binary.LittleEndian.AppendUint32(body, size)
+	body = append(body, data...)
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	return pcapngBlock(pcapngBlockEPB, body)
+}
+
+func concat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+func TestCaptureReader(t *testing.T) {
+	data := []byte{0x45, 0, 0, 20}
+	size := uint32(len(data))
+	ts := time.Unix(1700000000, 123456000).UTC()
+	micros := uint64(ts.UnixMicro())
+	nanos := uint64(ts.UnixNano())
+
+	// if_tsresol of 10^-9, followed by opt_endofopt.
+	nanoOpts := []byte{9, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0}
+
+	valid := concat(pcapngSHB(), pcapngIDB(), pcapngEPB(0, micros, size, data))
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    packet
+		wantErr bool
+	}{
+		{
+			name: "pcap",
+			file: pcapFile(pcapMagicMicro, pcapRecord(1700000000, 123456, size, data)),
+			want: packet{ts: ts, linkType: linkTypeRaw, data: data},
+		},
+		{
+			name: "pcap with nanoseconds",
+			file: pcapFile(pcapMagicNano, pcapRecord(1700000000, 123456000, size, data)),
+			want: packet{ts: ts, linkType: linkTypeRaw, data: data},
+		},
+		{
+			name:    "pcap truncated file header",
+			file:    pcapFile(pcapMagicMicro)[:20],
+			wantErr: true,
+		},
+		{
+			name:    "pcap truncated packet record",
+			file:    pcapFile(pcapMagicMicro, pcapRecord(1700000000, 0, size, data[:2])),
+			wantErr: true,
+		},
+		{
+			name:    "pcap packet exceeds max size",
+			file:    pcapFile(pcapMagicMicro, pcapRecord(1700000000, 0, maxPacketSize+1, data)),
+			wantErr: true,
+		},
+		{
+			name:    "not a capture file",
+			file:    bytes.Repeat([]byte{'x'}, 24),
+			wantErr: true,
+		},
+		{
+			name: "pcapng",
+			file: valid,
+			want: packet{ts: ts, linkType: linkTypeRaw, data: data},
+		},
+		{
+			name: "pcapng with timestamp resolution",
+			file: concat(pcapngSHB(), pcapngIDB(nanoOpts...), pcapngEPB(0, nanos, size, data)),
+			want: packet{ts: ts, linkType: linkTypeRaw, data: data},
+		},
+		{
+			name: "pcapng option without padding",
+			file: concat(pcapngSHB(), pcapngIDB(2, 0, 1, 0, 'x'), pcapngEPB(0, micros, size, data)),
+			want: packet{ts: ts, linkType: linkTypeRaw, data: data},
+		},
+		{
+			name:    "pcapng truncated section header block",
+			file:    pcapngSHB()[:10],
+			wantErr: true,
+		},
+		{
+			name:    "pcapng truncated block",
+			file:    valid[:len(valid)-4],
+			wantErr: true,
+		},
+		{
+			name:    "pcapng block size too small",
+			file:    concat(pcapngSHB(), []byte{1, 0, 0, 0, 8, 0, 0, 0}),
+			wantErr: true,
+		},
+		{
+			name:    "pcapng block size exceeds max size",
+			file:    concat(pcapngSHB(), []byte{1, 0, 0, 0, 0, 0, 0, 0x10}),
+			wantErr: true,
+		},
+		{
+			name:    "pcapng interface description block too short",
+			file:    concat(pcapngSHB(), pcapngBlock(pcapngBlockIDB, []byte{1, 0, 0, 0})),
+			wantErr: true,
+		},
+		{
+			name:    "pcapng packet of unknown interface",
+			file:    concat(pcapngSHB(), pcapngIDB(), pcapngEPB(1, micros, size, data)),
+			wantErr: true,
+		},
+		{
+			name:    "pcapng captured length exceeds block",
+			file:    concat(pcapngSHB(), pcapngIDB(), pcapngEPB(0, micros, 64, data)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := newCaptureReader(bytes.NewReader(tt.file))
+			var got packet
+			if err == nil {
+				got, err = cr.next()
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.ts.Equal(tt.want.ts) {
+				t.Errorf("got timestamp %s - want %s", got.ts, tt.want.ts)
+			}
+			if got.linkType != tt.want.linkType {
+				t.Errorf("got link type %d - want %d", got.linkType, tt.want.linkType)
+			}
+			if !bytes.Equal(got.data, tt.want.data) {
+				t.Errorf("got data %x - want %x", got.data, tt.want.data)
+			}
+		})
+	}
+}
+
+// ethernet builds an Ethernet frame with the ethertype.
+func ethernet(ethertype uint16, payload []byte) []byte {
+	b := make([]byte, 12)
+	b = binary.BigEndian.AppendUint16(b, ethertype)
+
+	return append(b, payload...)
+}
+
+// ipv4 builds an IPv4 packet from 192.0.2.1 to 192.0.2.2.
+func ipv4(proto byte, flags uint16, payload []byte) []byte {
+	b := []byte{0x45, 0}
+	b = binary.BigEndian.AppendUint16(b, uint16(20+len(payload)))
+	b = append(b, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, flags)
+	b = append(b, 64, proto, 0, 0)
+	b = append(b, 192, 0, 2, 1, 192, 0, 2, 2)
+
+	return append(b, payload...)
+}
+
+// ipv6 builds an IPv6 packet from 2001:db8::1 to 2001:db8::2.
+func ipv6(next byte, payload []byte) []byte {
+	b := []byte{0x60, 0, 0, 0}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	b = append(b, next, 64)
+	b = append(b, net.ParseIP("2001:db8::1")...)
+	b = append(b, net.ParseIP("2001:db8::2")...)
+
+	return append(b, payload...)
+}
+
+// extension builds an IPv6 extension header of 8 bytes.
+func extension(next byte, payload []byte) []byte {
+	b := []byte{next, 0, 1, 4, 0, 0, 0, 0}
+
+	return append(b, payload...)
+}
+
+// udp builds a UDP datagram from port 5300 to 53.
+func udp(payload []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 5300)
+	b = binary.BigEndian.AppendUint16(b, 53)
+	b = binary.BigEndian.AppendUint16(b, uint16(8+len(payload)))
+	b = append(b, 0, 0)
+
+	return append(b, payload...)
+}
+
+// tcp builds a TCP segment from port 5300 to 53 with the data offset (in 32
+// bit words).
+func tcp(seq uint32, offset byte, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 5300)
+	b = binary.BigEndian.AppendUint16(b, 53)
+	b = binary.BigEndian.AppendUint32(b, seq)
+	b = append(b, 0, 0, 0, 0, offset<<4, 0x18, 0xff, 0xff, 0, 0, 0, 0)
+
+	return append(b, payload...)
+}
+
+func TestDecodePacket(t *testing.T) {
+	payload := []byte("dns")
+
+	type want struct {
+		proto    string
+		src, dst string
+		seq      uint32
+		payload  string
+	}
+	udp4 := &want{proto: "udp", src: "192.0.2.1:5300", dst: "192.0.2.2:53", payload: "dns"}
+	udp6 := &want{proto: "udp", src: "[2001:db8::1]:5300", dst: "[2001:db8::2]:53", payload: "dns"}
+
+	tests := []struct {
+		name string
+		p    packet
+		want *want
+	}{
+		{
+			name: "UDP over IPv4 over Ethernet",
+			p:    packet{linkType: linkTypeEthernet, data: ethernet(0x0800, ipv4(17, 0, udp(payload)))},
+			want: udp4,
+		},
+		{
+			name: "VLAN tag",
+			p: packet{linkType: linkTypeEthernet, data: ethernet(
+				0x8100, append([]byte{0, 1, 0x08, 0x00}, ipv4(17, 0, udp(payload))...),
+			)},
+			want: udp4,
+		},
+		{
+			name: "TCP over IPv4",
+			p:    packet{linkType: linkTypeRaw, data: ipv4(6, 0, tcp(1000, 5, payload))},
+			want: &want{proto: "tcp", src: "192.0.2.1:5300", dst: "192.0.2.2:53", seq: 1000, payload: "dns"},
+		},
+		{
+			name: "UDP over IPv6",
+			p:    packet{linkType: linkTypeRaw, data: ipv6(17, udp(payload))},
+			want: udp6,
+		},
+		{
+			name: "IPv6 extension headers",
+			p:    packet{linkType: linkTypeIPv6, data: ipv6(0, extension(60, extension(17, udp(payload))))},
+			want: udp6,
+		},
+		{
+			name: "truncated IPv6 extension header",
+			p:    packet{linkType: linkTypeRaw, data: ipv6(0, []byte{17, 1, 0, 0, 0, 0, 0, 0})},
+		},
+		{
+			name: "IPv6 fragment",
+			p:    packet{linkType: linkTypeRaw, data: ipv6(44, extension(17, udp(payload)))},
+		},
+		{
+			name: "IPv4 fragment",
+			p:    packet{linkType: linkTypeRaw, data: ipv4(17, 0x2000, udp(payload))},
+		},
+		{
+			name: "IPv4 total length exceeds packet",
+			p:    packet{linkType: linkTypeRaw, data: ipv4(17, 0, udp(payload))[:30]},
+		},
+		{
+			name: "truncated Ethernet header",
+			p:    packet{linkType: linkTypeEthernet, data: make([]byte, 10)},
+		},
+		{
+			name: "not IP",
+			p:    packet{linkType: linkTypeEthernet, data: ethernet(0x0806, make([]byte, 28))},
+		},
+		{
+			name: "truncated UDP header",
+			p:    packet{linkType: linkTypeRaw, data: ipv4(17, 0, []byte{0, 53})},
+		},
+		{
+			name: "TCP data offset exceeds segment",
+			p:    packet{linkType: linkTypeRaw, data: ipv4(6, 0, tcp(1000, 15, payload))},
+		},
+		{
+			name: "unknown link type",
+			p:    packet{linkType: 147, data: ipv4(17, 0, udp(payload))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := decodePacket(tt.p)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("expected no segment - got %s %s > %s", s.proto, s.srcAddr(), s.dstAddr())
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("expected a segment")
+			}
+
+			got := want{
+				proto:   s.proto,
+				src:     s.srcAddr(),
+				dst:     s.dstAddr(),
+				seq:     s.seq,
+				payload: string(s.payload),
+			}
+			if got != *tt.want {
+				t.Errorf("got %+v - want %+v", got, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// delegation is the delegation of a zone, as served by a parent name server.
+type delegation struct {
+	// parent is the parent zone.
+	parent string
+
+	// server is the name of the parent name server that served the
+	// delegation.
+	server string
+
+	// nss holds the sorted names of the delegated name servers.
+	nss []string
+
+	// glue holds the glue addresses per name server.
+	glue map[string][]net.IP
+}
+
+// nameServer is a name server of a zone, listed by the parent or the child.
+type nameServer struct {
+	// name is the name of the name server.
+	name string
+
+	// addrs holds the resolved addresses of the name server.
+	addrs []net.IP
+
+	// err is set when the addresses couldn't be resolved.
+	err error
+
+	// servers holds the check of every address.
+	servers []serverCheck
+}
+
+// serverCheck is what a single address of a name server returned for the
+// zone.
+type serverCheck struct {
+	// addr is the IP address of the name server.
+	addr net.IP
+
+	// rcode is the response code of the SOA query.
+	rcode dns.RCode
+
+	// authoritative is set when the response has the AA flag set.
+	authoritative bool
+
+	// serial is the SOA serial of the zone; it's only valid when hasSerial is
+	// set.
+	serial    uint32
+	hasSerial bool
+
+	// nss holds the sorted names of the name servers the child serves.
+	nss []string
+
+	// err is set when the name server didn't respond.
+	err error
+}
+
+// runCheckNS runs "tdr check-ns [flags] zone", which fetches the NS resource
+// record sets of the zone from the parent and the child, checks every listed
+// name server, and prints a pass/fail report; it flags mismatching NS records,
+// lame delegations, missing glue, and name servers that refuse the zone.
+func runCheckNS(args []string) int {
+	fs := flag.NewFlagSet("check-ns", flag.ExitOnError)
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check-ns [flags] zone\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single zone")
+	case strings.Trim(fs.Arg(0), ".") == "":
+		err = fmt.Errorf("the root zone has no parent")
+	default:
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	zone := strings.ToLower(fs.Arg(0))
+	zone = dns.Fqdn(zone)
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	parent, parentNSs, err := findZone(ctx, client, dns.ParentDomainName(zone))
+	if err != nil {
+		log.Printf("failed to find the parent zone of %s: %v", zone, err)
+		return exitCode(err)
+	}
+	d, err := fetchDelegation(ctx, client, zone, parent, parentNSs)
+	if err != nil {
+		log.Printf("failed to fetch the delegation of %s from %s: %v", zone, parent, err)
+		return exitCode(err)
+	}
+
+	// The name servers listed by the parent are checked first, since the child
+	// NS resource record set is served by them; the name servers only listed
+	// by the child are checked after.
+	nss := checkNameServers(ctx, client, zone, d.nss)
+	childNSs := childNameServers(nss)
+	listed := map[string]bool{}
+	for _, name := range d.nss {
+		listed[name] = true
+	}
+	childOnly := []string{}
+	for _, name := range childNSs {
+		if !listed[name] {
+			childOnly = append(childOnly, name)
+		}
+	}
+	nss = append(nss, checkNameServers(ctx, client, zone, childOnly)...)
+
+	return reportCheckNS(os.Stdout, zone, d, childNSs, nss)
+}
+
+// checkNameServers checks the name servers of the zone in parallel.
+func checkNameServers(
+	ctx context.Context,
+	client *resolver.Client,
+	zone string,
+	names []string,
+) []*nameServer {
+	nss := []*nameServer{}
+	var wg sync.WaitGroup
+	for _, name := range names {
+		ns := &nameServer{name: name}
+		nss = append(nss, ns)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkNameServer(ctx, client, ns, zone)
+		}()
+	}
+	wg.Wait()
+
+	return nss
+}
+
+// childNameServers returns the NS resource record set the child zone serves,
+// i.e. the one of the first name server that answers authoritatively.
+func childNameServers(nss []*nameServer) []string {
+	for _, ns := range nss {
+		for _, s := range ns.servers {
+			if s.err == nil && s.authoritative && len(s.nss) > 0 {
+				return s.nss
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchDelegation queries the name servers of the parent zone (in order,
+// until one responds) for the delegation of the zone.
+func fetchDelegation(
+	ctx context.Context,
+	client *resolver.Client,
+	zone string,
+	parent string,
+	parentNSs []string,
+) (*delegation, error) {
+	err := fmt.Errorf("no parent name servers")
+	for _, ns := range parentNSs {
+		var ips []net.IP
+		ips, err = client.ResolveHostContext(ctx, ns)
+		if err != nil {
+			continue
+		}
+
+		for _, ip := range ips {
+			var resp *dns.Msg
+			addr := net.JoinHostPort(ip.String(), "53")
+			resp, err = exchange(ctx, client, addr, zone, dns.TypeNS, false)
+			if err != nil {
+				continue
+			}
+			if resp.RCode != dns.RCodeNoError {
+				err = fmt.Errorf("%s responded %s", ns, rcodeMnemonics[resp.RCode])
+				continue
+			}
+
+			d := newDelegation(resp, zone)
+			if len(d.nss) == 0 {
+				err = fmt.Errorf("%s returned no NS records", ns)
+				continue
+			}
+			d.parent, d.server = parent, ns
+			return d, nil
+		}
+	}
+
+	return nil, err
+}
+
+// newDelegation gets the delegation of the zone from the response of a parent
+// name server; the NS resource records are in the authority section of a
+// referral, or in the answer section when the parent is authoritative for the
+// child as well.
+func newDelegation(m *dns.Msg, zone string) *delegation {
+	d := &delegation{nss: []string{}, glue: map[string][]net.IP{}}
+	inSet := map[string]bool{}
+	for _, rrs := range [][]dns.RR{m.Answer, m.Authority} {
+		for _, rr := range rrs {
+			if rr.Type != dns.TypeNS || !strings.EqualFold(rr.Name, zone) {
+				continue
+			}
+			ns := strings.ToLower(rr.RDataUnpacked)
+			if !inSet[ns] {
+				inSet[ns] = true
+				d.nss = append(d.nss, ns)
+			}
+		}
+	}
+	sort.Strings(d.nss)
+
+	for _, rr := range m.Additional {
+		name := strings.ToLower(rr.Name)
+		if !inSet[name] || (rr.Type != dns.TypeA && rr.Type != dns.TypeAAAA) {
+			continue
+		}
+		if ip := net.ParseIP(rr.RDataUnpacked); ip != nil {
+			d.glue[name] = append(d.glue[name], ip)
+		}
+	}
+
+	return d
+}
+
+// checkNameServer resolves the addresses of the name server, and checks every
+// address.
+func checkNameServer(
+	ctx context.Context,
+	client *resolver.Client,
+	ns *nameServer,
+	zone string,
+) {
+	ns.addrs, ns.err = client.ResolveHostContext(ctx, ns.name)
+	if ns.err != nil {
+		return
+	}
+
+	ns.servers = make([]serverCheck, len(ns.addrs))
+	var wg sync.WaitGroup
+	for i, ip := range ns.addrs {
+		wg.Add(1)
+		go func(s *serverCheck, ip net.IP) {
+			defer wg.Done()
+			s.addr = ip
+			checkServer(ctx, client, s, zone)
+		}(&ns.servers[i], ip)
+	}
+	wg.Wait()
+}
+
+// checkServer queries the name server for the SOA and NS resource records of
+// the zone.
+func checkServer(
+	ctx context.Context,
+	client *resolver.Client,
+	s *serverCheck,
+	zone string,
+) {
+	addr := net.JoinHostPort(s.addr.String(), "53")
+
+	soa, err := exchange(ctx, client, addr, zone, dns.TypeSOA, false)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.rcode = soa.RCode
+	s.authoritative = soa.AA == 1
+	s.serial, s.hasSerial = soaSerial(soa)
+
+	resp, err := exchange(ctx, client, addr, zone, dns.TypeNS, false)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.nss = []string{}
+	for _, rr := range resp.Answer {
+		if rr.Type == dns.TypeNS && strings.EqualFold(rr.Name, zone) {
+			s.nss = append(s.nss, strings.ToLower(rr.RDataUnpacked))
+		}
+	}
+	sort.Strings(s.nss)
+}
+
+// status describes how the name server responded for the zone. A name server
+// that's listed for the zone but doesn't answer authoritatively for it is a
+// lame delegation.
+func (s serverCheck) status() string {
+	switch {
+	case s.err != nil:
+		return "error: " + s.err.Error()
+	case s.rcode == dns.RCodeRefused:
+		return "refused"
+	case s.rcode != dns.RCodeNoError:
+		return rcodeMnemonics[s.rcode]
+	case !s.authoritative:
+		return "lame"
+	default:
+		return "ok"
+	}
+}
+
+// containsString checks if the slice contains the string.
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// equalIPs checks if the addresses are the same, ignoring their order.
+func equalIPs(a []net.IP, b []net.IP) bool {
+	as, bs := []string{}, []string{}
+	for _, ip := range a {
+		as = append(as, ip.String())
+	}
+	for _, ip := range b {
+		bs = append(bs, ip.String())
+	}
+	sort.Strings(as)
+	sort.Strings(bs)
+
+	return equalStrings(as, bs)
+}
+
+// reportCheckNS prints the delegation, the check of every name server
+// address, and a pass/fail line per check. It returns exitOK when all checks
+// pass.
+func reportCheckNS(
+	out io.Writer,
+	zone string,
+	d *delegation,
+	childNSs []string,
+	nss []*nameServer,
+) int {
+	fmt.Fprintf(out, ";; %s delegated by %s (served by %s)\n", zone, d.parent, d.server)
+	fmt.Fprintf(out, ";; parent NS: %s\n", strings.Join(d.nss, ", "))
+	fmt.Fprintf(out, ";; child NS:  %s\n\n", strings.Join(childNSs, ", "))
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tADDRESS\tRCODE\tAA\tSERIAL\tSTATUS")
+	for _, ns := range nss {
+		if ns.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\terror: %v\n", ns.name, ns.err)
+			continue
+		}
+		for _, s := range ns.servers {
+			if s.err != nil {
+				fmt.Fprintf(w, "%s\t%s\t-\t-\t-\terror: %v\n", ns.name, s.addr, s.err)
+				continue
+			}
+			serial := "-"
+			if s.hasSerial {
+				serial = strconv.FormatUint(uint64(s.serial), 10)
+			}
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%t\t%s\t%s\n",
+				ns.name, s.addr, rcodeMnemonics[s.rcode], s.authoritative, serial, s.status(),
+			)
+		}
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	code := exitOK
+	check := func(name string, failures []string) {
+		if len(failures) == 0 {
+			fmt.Fprintf(out, "PASS  %s\n", name)
+			return
+		}
+		code = exitFailure
+		fmt.Fprintf(out, "FAIL  %s\n", name)
+		for _, f := range failures {
+			fmt.Fprintf(out, "        %s\n", f)
+		}
+	}
+
+	// The NS resource record sets of the parent and the child should be the
+	// same; resolvers may use either.
+	nsMismatch := []string{}
+	for _, ns := range difference(d.nss, childNSs) {
+		nsMismatch = append(nsMismatch, ns+" is only listed by the parent")
+	}
+	for _, ns := range difference(childNSs, d.nss) {
+		nsMismatch = append(nsMismatch, ns+" is only listed by the child")
+	}
+
+	unresolved, unreachable := []string{}, []string{}
+	lame, refused := []string{}, []string{}
+	missingGlue, wrongGlue := []string{}, []string{}
+	serials := map[uint32][]string{}
+	for _, ns := range nss {
+		// Name servers within the zone can't be resolved without glue at the
+		// parent.
+		glue, hasGlue := d.glue[ns.name]
+		if !hasGlue && dns.IsSubDomain(zone, ns.name) && containsString(d.nss, ns.name) {
+			missingGlue = append(missingGlue, ns.name+" is within the zone, but has no glue")
+		}
+
+		if ns.err != nil || len(ns.addrs) == 0 {
+			unresolved = append(unresolved, ns.name+" has no A/AAAA records")
+			continue
+		}
+		if hasGlue && !equalIPs(glue, ns.addrs) {
+			wrongGlue = append(wrongGlue, fmt.Sprintf(
+				"%s glue %v doesn't match its addresses %v", ns.name, glue, ns.addrs,
+			))
+		}
+		for _, s := range ns.servers {
+			server := ns.name + " " + s.addr.String()
+			switch {
+			case s.err != nil:
+				unreachable = append(unreachable, server+": "+s.err.Error())
+			case s.rcode == dns.RCodeRefused:
+				refused = append(refused, server)
+			case s.rcode != dns.RCodeNoError || !s.authoritative:
+				lame = append(lame, server+" ("+s.status()+")")
+			case s.hasSerial:
+				serials[s.serial] = append(serials[s.serial], server)
+			}
+		}
+	}
+	mismatch := []string{}
+	if len(serials) > 1 {
+		for serial, servers := range serials {
+			mismatch = append(mismatch, fmt.Sprintf("%d: %s", serial, strings.Join(servers, ", ")))
+		}
+		sort.Strings(mismatch)
+	}
+
+	check("parent and child NS records match", nsMismatch)
+	check("name servers have A/AAAA records", unresolved)
+	check("name servers are reachable", unreachable)
+	check("name servers don't refuse queries for the zone", refused)
+	check("name servers answer authoritatively (no lame delegations)", lame)
+	check("SOA serials match", mismatch)
+	check("name servers within the zone have glue", missingGlue)
+	check("glue matches the name server addresses", wrongGlue)
+
+	return code
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/zone"
+)
+
+// clientFlags are the flags that configure the resolver client; they're shared
+// by the query command and the subcommands.
+type clientFlags struct {
+	rootHints  *string
+	prime      *bool
+	stub       *bool
+	serveStale *time.Duration
+	ipv4Only   *bool
+	ipv6Only   *bool
+	tsig       *string
+	tsigFile   *string
+	sig0       *string
+	llmnr      *bool
+}
+
+// addClientFlags defines the client flags in the flag set.
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		rootHints: fs.String(
+			"root-hints", "",
+			"root hints file (named.root) with the addresses of the root name servers",
+		),
+		prime: fs.Bool(
+			"prime", false,
+			"refresh the root name server addresses with a priming query",
+		),
+		stub: fs.Bool(
+			"stub", false,
+			"send recursive queries to the resolvers from "+resolver.DefaultResolvConfPath,
+		),
+		serveStale: fs.Duration(
+			"serve-stale", 0,
+			"max time to serve expired cached answers when name servers fail",
+		),
+		ipv4Only: fs.Bool("4", false, "only dial name servers over IPv4"),
+		ipv6Only: fs.Bool("6", false, "only dial name servers over IPv6"),
+		tsig: fs.String(
+			"tsig", "",
+			"TSIG key ([algorithm:]name:base64-secret) that signs messages sent to a single name server\n"+
+				"(e.g. updates and zone transfers); the algorithm defaults to hmac-sha256",
+		),
+		tsigFile: fs.String(
+			"tsig-file", "",
+			"file with the TSIG key, in the -tsig format or as a BIND key statement",
+		),
+		sig0: fs.String(
+			"sig0", "",
+			"SIG(0) key pair (Kname.+alg+tag, as generated with dnssec-keygen -T KEY) that signs\n"+
+				"messages sent to a single name server; reads the .key and .private files",
+		),
+		llmnr: fs.Bool(
+			"llmnr", false,
+			"resolve single-label names on the local link with LLMNR when DNS can't resolve them",
+		),
+	}
+}
+
+// validate checks that the flags don't conflict.
+func (f *clientFlags) validate() error {
+	if *f.ipv4Only && *f.ipv6Only {
+		return fmt.Errorf("-4 and -6 are mutually exclusive")
+	}
+	if *f.tsig != "" && *f.tsigFile != "" {
+		return fmt.Errorf("-tsig and -tsig-file are mutually exclusive")
+	}
+	if (*f.tsig != "" || *f.tsigFile != "") && *f.sig0 != "" {
+		return fmt.Errorf("-sig0 and -tsig (or -tsig-file) are mutually exclusive")
+	}
+	if *f.tsig != "" {
+		if _, err := dns.ParseTSIGKey(*f.tsig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindKeyRe matches a BIND key statement, e.g.:
+//
+//	key "name" { algorithm hmac-sha256; secret "base64"; };
+var bindKeyRe = regexp.MustCompile(
+	`key\s+"?([^"\s{]+)"?\s*\{\s*algorithm\s+"?([^";\s]+)"?\s*;\s*secret\s+"([^"]+)"\s*;\s*\}`,
+)
+
+// loadTSIGKey loads the TSIG key from the file; it holds a key in the -tsig
+// format, or a BIND key statement (e.g. generated with tsig-keygen).
+func loadTSIGKey(path string) (*dns.TSIGKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if m := bindKeyRe.FindStringSubmatch(string(b)); m != nil {
+		return dns.ParseTSIGKey(m[2] + ":" + m[1] + ":" + m[3])
+	}
+
+	return dns.ParseTSIGKey(strings.TrimSpace(string(b)))
+}
+
+// loadKeyPair loads the key pair from the public key file (with the KEY or
+// DNSKEY resource record) and the private key file that share the path
+// (without the .key or .private extension), as generated with dnssec-keygen,
+// and returns it with its owner name.
+func loadKeyPair(path string) (crypto.Signer, *dns.DNSKEY, string, error) {
+	path = strings.TrimSuffix(strings.TrimSuffix(path, ".key"), ".private")
+	b, err := os.ReadFile(path + ".key")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	rrs, err := zone.Parse(strings.NewReader("$TTL 0\n"+string(b)), ".")
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid public key file: %w", err)
+	}
+	if len(rrs) != 1 || (rrs[0].Type != dns.TypeKEY && rrs[0].Type != dns.TypeDNSKEY) {
+		return nil, nil, "", fmt.Errorf("public key file must hold a single KEY or DNSKEY record")
+	}
+	rd, err := rrs[0].Decode()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	key := rd.(*dns.DNSKEY)
+
+	b, err = os.ReadFile(path + ".private")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	priv, alg, err := dns.ParsePrivateKey(string(b))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid private key file: %w", err)
+	}
+	if alg != key.Algorithm {
+		return nil, nil, "", fmt.Errorf("algorithms of the public and private key differ")
+	}
+
+	return priv, key, rrs[0].Name, nil
+}
+
+// newClient creates a client configured with the flags (followed by the extra
+// options), and primes it when requested.
+func (f *clientFlags) newClient(
+	ctx context.Context,
+	extra ...resolver.Option,
+) (*resolver.Client, error) {
+	opts := []resolver.Option{}
+	if *f.rootHints != "" {
+		ips, err := loadRootHints(*f.rootHints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load root hints: %w", err)
+		}
+		opts = append(opts, resolver.WithRootServers(ips...))
+	}
+	if *f.stub {
+		conf, err := resolver.LoadResolvConf(resolver.DefaultResolvConfPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load resolver configuration: %w", err)
+		}
+		opts = append(
+			opts,
+			resolver.WithStub(conf.Nameservers...),
+			resolver.WithSearch(conf.Search, conf.NDots),
+			resolver.WithTimeout(conf.Timeout),
+			resolver.WithRetries(conf.Attempts-1),
+		)
+	}
+	if *f.serveStale > 0 {
+		opts = append(opts, resolver.WithServeStale(*f.serveStale))
+	}
+	switch {
+	case *f.ipv4Only:
+		opts = append(opts, resolver.WithIPPreference(resolver.IPv4Only))
+	case *f.ipv6Only:
+		opts = append(opts, resolver.WithIPPreference(resolver.IPv6Only))
+	}
+	switch {
+	case *f.tsig != "":
+		key, err := dns.ParseTSIGKey(*f.tsig)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, resolver.WithTSIG(key))
+	case *f.tsigFile != "":
+		key, err := loadTSIGKey(*f.tsigFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TSIG key: %w", err)
+		}
+		opts = append(opts, resolver.WithTSIG(key))
+	case *f.sig0 != "":
+		priv, key, signer, err := loadKeyPair(*f.sig0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SIG(0) key: %w", err)
+		}
+		opts = append(opts, resolver.WithSIG0(priv, key, signer))
+	}
+	if *f.llmnr {
+		opts = append(opts, resolver.WithLLMNR(true))
+	}
+	client := resolver.NewClient(append(opts, extra...)...)
+
+	if *f.prime {
+		if err := client.Prime(ctx); err != nil {
+			return nil, fmt.Errorf("failed to prime root name servers: %w", err)
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// comparison is what a single resolver answered.
+type comparison struct {
+	// server is the address of the resolver.
+	server string
+
+	// rcode is the response code.
+	rcode dns.RCode
+
+	// rrset holds the sorted record data of the answer.
+	rrset []string
+
+	// ttl is the lowest TTL of the answer.
+	ttl uint32
+
+	// rtt is the round-trip time of the query.
+	rtt time.Duration
+
+	// err is set when the resolver didn't respond.
+	err error
+}
+
+// runCompare runs "tdr compare [flags] name [type]", which queries every
+// resolver and prints how their answers differ, to spot censorship, stale
+// caches, or split-horizon inconsistencies.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	servers := fs.String(
+		"servers", strings.Join(publicResolvers, ","),
+		`comma separated addresses ("ip" or "ip:port") of the resolvers to compare`,
+	)
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] name [type]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name, qt, err := parseQuery(fs.Args())
+	if err == nil && *servers == "" {
+		err = fmt.Errorf("missing servers")
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	client := resolver.NewClient(resolver.WithTimeout(*timeout))
+
+	addrs := strings.Split(*servers, ",")
+	results := make([]comparison, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(c *comparison, addr string) {
+			defer wg.Done()
+
+			c.server = strings.TrimSpace(addr)
+			start := time.Now()
+			resp, err := exchange(ctx, client, c.server, name, qt, true)
+			c.rtt = time.Since(start)
+			if err != nil {
+				c.err = err
+				return
+			}
+
+			c.rcode = resp.RCode
+			c.rrset = []string{}
+			for i, rr := range resp.Answer {
+				if i == 0 || rr.TTL < c.ttl {
+					c.ttl = rr.TTL
+				}
+				c.rrset = append(c.rrset, rr.Type.String()+" "+rr.RDataUnpacked)
+			}
+			sort.Strings(c.rrset)
+		}(&results[i], addr)
+	}
+	wg.Wait()
+
+	return reportComparison(os.Stdout, name, qt, results)
+}
+
+// answerKey identifies an answer by its response code and record set.
+func (c comparison) answerKey() string {
+	return c.rcode.String() + "|" + strings.Join(c.rrset, "|")
+}
+
+// reportComparison prints the answer of every resolver, and how it differs
+// from the most common answer. It returns exitOK when all resolvers agree.
+func reportComparison(
+	out io.Writer,
+	name string,
+	qt dns.QType,
+	results []comparison,
+) int {
+	// The most common answer is the reference the others are compared to.
+	counts := map[string]int{}
+	var ref *comparison
+	for i, c := range results {
+		if c.err != nil {
+			continue
+		}
+		counts[c.answerKey()]++
+		if ref == nil || counts[c.answerKey()] > counts[ref.answerKey()] {
+			ref = &results[i]
+		}
+	}
+
+	fmt.Fprintf(out, ";; %s %s\n", name, qt)
+	if ref != nil {
+		fmt.Fprintf(
+			out, ";; most common answer (%d of %d): %s %s\n\n",
+			counts[ref.answerKey()], len(results),
+			rcodeMnemonics[ref.rcode], strings.Join(ref.rrset, ", "),
+		)
+	}
+
+	code := exitOK
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tRCODE\tTTL\tRTT\tDIFF")
+	for _, c := range results {
+		if c.err != nil {
+			code = exitFailure
+			fmt.Fprintf(w, "%s\t-\t-\t-\terror: %v\n", c.server, c.err)
+			continue
+		}
+
+		diff := []string{}
+		if c.rcode != ref.rcode {
+			diff = append(diff, "rcode "+rcodeMnemonics[c.rcode])
+		}
+		for _, rd := range difference(c.rrset, ref.rrset) {
+			diff = append(diff, "+"+rd)
+		}
+		for _, rd := range difference(ref.rrset, c.rrset) {
+			diff = append(diff, "-"+rd)
+		}
+		if len(diff) == 0 {
+			diff = append(diff, "same")
+		} else {
+			code = exitFailure
+		}
+
+		ttl := "-"
+		if len(c.rrset) > 0 {
+			ttl = strconv.FormatUint(uint64(c.ttl), 10)
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\n",
+			c.server, rcodeMnemonics[c.rcode], ttl,
+			c.rtt.Round(time.Millisecond), strings.Join(diff, ", "),
+		)
+	}
+	w.Flush()
+
+	return code
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/server"
+)
+
+// debugHandler returns the handler of the debug endpoints of the server: the
+// expvar variables at /debug/vars (the command line, memory statistics, and
+// the variables published by publishDebugVars), and the pprof profiles at
+// /debug/pprof/.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// publishDebugVars publishes the runtime statistics of the server (its uptime
+// and number of goroutines) as expvar variables, and the statistics of the
+// recursive resolver client, the response cache, the blocklist, the response
+// policy zones and the response rate limiter when they're not nil.
+func publishDebugVars(
+	client *resolver.Client,
+	cache *server.ResponseCache,
+	blocklist *server.Blocklist,
+	rpz *server.RPZ,
+	rrl *server.RRL,
+) {
+	start := time.Now()
+	expvar.Publish("uptime", expvar.Func(func() interface{} {
+		return time.Since(start).Seconds()
+	}))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	if client != nil {
+		expvar.Publish("resolver", expvar.Func(func() interface{} {
+			return client.Stats()
+		}))
+	}
+	if cache != nil {
+		expvar.Publish("cache", expvar.Func(func() interface{} {
+			return cache.Stats()
+		}))
+	}
+	if blocklist != nil {
+		expvar.Publish("blocklist", expvar.Func(func() interface{} {
+			return blocklist.Stats()
+		}))
+	}
+	if rpz != nil {
+		expvar.Publish("rpz", expvar.Func(func() interface{} {
+			return rpz.Stats()
+		}))
+	}
+	if rrl != nil {
+		expvar.Publish("rrl", expvar.Func(func() interface{} {
+			return rrl.Stats()
+		}))
+	}
+}
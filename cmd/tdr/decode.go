@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// runDecode runs "tdr decode [flags] [file]", which reads a message in wire
+// format, encoded as hex or base64, from the file (or stdin), and prints it in
+// dig format.
+func runDecode(args []string) int {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	dump := fs.Bool("dump", false, "also print the message as an annotated hex dump")
+	fs.Usage = func() {
+		fmt.Fprintf(
+			fs.Output(),
+			"Usage: %s decode [flags] [file]\n\n"+
+				"Reads a hex or base64 encoded message from the file, or stdin when it's\n"+
+				"omitted or \"-\".\n\nFlags:\n",
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fmt.Fprintln(fs.Output(), "expected at most one file")
+		fs.Usage()
+		return exitUsage
+	}
+
+	in := os.Stdin
+	if file := fs.Arg(0); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("failed to open file: %v", err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+	input, err := io.ReadAll(in)
+	if err != nil {
+		log.Printf("failed to read message: %v", err)
+		return exitFailure
+	}
+
+	b, err := decodeWire(string(input))
+	if err != nil {
+		log.Printf("failed to decode message: %v", err)
+		return exitFailure
+	}
+	if *dump {
+		dumpMsg(os.Stdout, b)
+		fmt.Println()
+	}
+
+	msg := new(dns.Msg)
+	n, err := msg.Unpack(b)
+	if err != nil {
+		log.Printf("failed to unpack message at offset %d: %v", n, err)
+		return exitFailure
+	}
+	if n < len(b) {
+		log.Printf("ignored %d trailing bytes", len(b)-n)
+	}
+
+	printDig(os.Stdout, digOutput{cmd: "decode", msg: msg})
+	return exitOK
+}
+
+// decodeWire decodes the hex or base64 (standard or URL, with or without
+// padding) encoded message bytes. Whitespace is ignored, and so are "0x"
+// prefixes and ":" separators of hex bytes.
+func decodeWire(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nil, fmt.Errorf("empty input")
+	}
+
+	h := strings.NewReplacer("0x", "", "0X", "", ":", "").Replace(s)
+	if b, err := hex.DecodeString(h); err == nil {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("input is neither hex nor base64")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// rcodeMnemonics maps a response code to the mnemonic dig prints.
+var rcodeMnemonics = map[dns.RCode]string{
+	dns.RCodeNoError:        "NOERROR",
+	dns.RCodeFormatError:    "FORMERR",
+	dns.RCodeServerFailure:  "SERVFAIL",
+	dns.RCodeNameError:      "NXDOMAIN",
+	dns.RCodeNotImplemented: "NOTIMP",
+	dns.RCodeRefused:        "REFUSED",
+	dns.RCodeYXDomain:       "YXDOMAIN",
+	dns.RCodeYXRRset:        "YXRRSET",
+	dns.RCodeNXRRset:        "NXRRSET",
+	dns.RCodeNotAuth:        "NOTAUTH",
+	dns.RCodeNotZone:        "NOTZONE",
+}
+
+// digOutput holds what's printed about a response in dig format.
+type digOutput struct {
+	// cmd is the command line that's echoed in the banner.
+	cmd string
+
+	// msg is the response.
+	msg *dns.Msg
+
+	// server is the address of the name server that sent the response, or
+	// "cache"; it's empty when the message wasn't received (e.g. it's decoded),
+	// and the query time, server and timestamp aren't printed.
+	server string
+
+	// rtt is the round-trip time of the query.
+	rtt time.Duration
+
+	// dnssec is the DNSSEC validation status; it's empty when the response
+	// wasn't validated.
+	dnssec string
+}
+
+// printDig prints the response the way dig does: a header and flag summary,
+// the OPT pseudosection, the question, answer, authority and additional
+// sections, and a footer with the query time, server, timestamp and message
+// size. Domain names are never compressed when a message is packed, so the
+// size may be larger than the size of the received message.
+func printDig(w io.Writer, o digOutput) {
+	m := o.msg
+
+	fmt.Fprintf(w, "; <<>> tdr <<>> %s\n", o.cmd)
+	fmt.Fprintln(w, ";; Got answer:")
+
+	status, ok := rcodeMnemonics[m.RCode]
+	if !ok {
+		status = fmt.Sprintf("RCODE%d", m.RCode)
+	}
+	fmt.Fprintf(
+		w, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n",
+		m.OpCode, status, m.ID,
+	)
+
+	flags := headerFlags(m.Header)
+
+	additional := []dns.RR{}
+	var opt *dns.RR
+	for i, rr := range m.Additional {
+		if rr.Type == dns.TypeOPT {
+			opt = &m.Additional[i]
+			continue
+		}
+		additional = append(additional, rr)
+	}
+
+	fmt.Fprintf(
+		w, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.Join(flags, " "), len(m.Questions()), len(m.Answer),
+		len(m.Authority), len(m.Additional),
+	)
+
+	if opt != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, ";; OPT PSEUDOSECTION:")
+		fmt.Fprintln(w, opt.String())
+	}
+
+	if questions := m.Questions(); len(questions) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, ";; QUESTION SECTION:")
+		for _, q := range questions {
+			fmt.Fprintf(w, ";%s\t\t%s\t%s\n", q.QName, q.QClass, q.QType)
+		}
+	}
+
+	sections := []struct {
+		name string
+		rrs  []dns.RR
+	}{
+		{"ANSWER", m.Answer},
+		{"AUTHORITY", m.Authority},
+		{"ADDITIONAL", additional},
+	}
+	for _, section := range sections {
+		if len(section.rrs) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, ";; %s SECTION:\n", section.name)
+		for _, rr := range section.rrs {
+			fmt.Fprintln(w, rr.String())
+		}
+	}
+
+	fmt.Fprintln(w)
+	if o.server != "" {
+		fmt.Fprintf(w, ";; Query time: %d msec\n", o.rtt.Milliseconds())
+		fmt.Fprintf(w, ";; SERVER: %s\n", o.server)
+		fmt.Fprintf(w, ";; WHEN: %s\n", time.Now().Format(time.UnixDate))
+	}
+	if b, err := m.Pack(); err == nil {
+		fmt.Fprintf(w, ";; MSG SIZE  rcvd: %d\n", len(b))
+	}
+	if o.dnssec != "" {
+		fmt.Fprintf(w, ";; DNSSEC: %s\n", o.dnssec)
+	}
+	fmt.Fprintln(w)
+}
+
+// headerFlags returns the names of the flags that are set in the header.
+func headerFlags(h dns.Header) []string {
+	flags := []string{}
+	for _, f := range []struct {
+		name string
+		set  byte
+	}{
+		{"qr", h.QR}, {"aa", h.AA}, {"tc", h.TC}, {"rd", h.RD}, {"ra", h.RA},
+	} {
+		if f.set == 1 {
+			flags = append(flags, f.name)
+		}
+	}
+
+	return flags
+}
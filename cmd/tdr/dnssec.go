@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// chainChecker fetches and verifies the links of a DNSSEC chain of trust, and
+// prints every link it verifies.
+type chainChecker struct {
+	ctx    context.Context
+	client *resolver.Client
+
+	// out is where the links are printed.
+	out io.Writer
+
+	// now is the time the signatures must be valid at.
+	now time.Time
+}
+
+// chainError describes where a chain of trust breaks.
+type chainError struct {
+	// name and typ identify the resource record set that couldn't be
+	// validated.
+	name string
+	typ  dns.Type
+
+	// reason describes why it couldn't be validated.
+	reason string
+}
+
+func (e *chainError) Error() string {
+	return fmt.Sprintf("chain breaks at %s %s: %s", e.name, e.typ, e.reason)
+}
+
+// runDNSSEC runs "tdr dnssec [flags] name [type]", which fetches the DS,
+// DNSKEY and RRSIG resource records of every zone from the root to the name,
+// validates every link of the chain of trust, and prints where it breaks when
+// it's bogus.
+func runDNSSEC(args []string) int {
+	fs := flag.NewFlagSet("dnssec", flag.ExitOnError)
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s dnssec [flags] name [type]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name, qt, err := parseQuery(fs.Args())
+	if err == nil {
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	name = strings.ToLower(name)
+	name = dns.Fqdn(name)
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	c := &chainChecker{ctx: ctx, client: client, out: os.Stdout, now: time.Now()}
+	status, err := c.check(name, qt)
+	fmt.Fprintln(c.out)
+
+	var chainErr *chainError
+	switch {
+	case errors.As(err, &chainErr):
+		fmt.Fprintf(c.out, "%s: %v\n", resolver.StatusBogus, err)
+		return exitFailure
+	case err != nil:
+		log.Printf("failed to check the chain of trust of %s: %v", name, err)
+		return exitCode(err)
+	case status == resolver.StatusInsecure:
+		fmt.Fprintf(c.out, "%s: there's proof that %s isn't signed\n", status, name)
+	default:
+		fmt.Fprintf(c.out, "%s: the chain of trust is complete\n", status)
+	}
+
+	return exitOK
+}
+
+// check verifies the chain of trust from the root trust anchors to the
+// resource record set of the name and type. It returns a chainError when the
+// chain breaks.
+func (c *chainChecker) check(name string, qt dns.QType) (resolver.Status, error) {
+	zone := "."
+	anchors := resolver.RootTrustAnchors()
+	fmt.Fprintln(c.out, ";; .")
+	for _, d := range anchors {
+		fmt.Fprintf(c.out, "  trust anchor DS %d %s %s\n", d.KeyTag, d.Algorithm, d.DigestType)
+	}
+	keys, err := c.checkKeys(zone, anchors)
+	if err != nil {
+		return resolver.StatusBogus, err
+	}
+
+	// Every zone cut between the root and the name is a link of the chain,
+	// which is validated with the keys of the zone above it.
+	names := dns.AncestorDomainNames(name)
+	for i := len(names) - 1; i >= 0; i-- {
+		cut, err := c.isZoneCut(names[i])
+		if err != nil {
+			return resolver.StatusBogus, err
+		}
+		if !cut {
+			continue
+		}
+
+		fmt.Fprintf(c.out, ";; %s\n", names[i])
+		ds, status, err := c.checkDS(names[i], zone, keys)
+		if err != nil || status == resolver.StatusInsecure {
+			return status, err
+		}
+		if keys, err = c.checkKeys(names[i], ds); err != nil {
+			return resolver.StatusBogus, err
+		}
+		zone = names[i]
+	}
+
+	fmt.Fprintf(c.out, ";; %s %s\n", name, qt)
+	return c.checkAnswer(name, qt, zone, keys)
+}
+
+// isZoneCut checks if the name is the apex of a zone, i.e. it has NS resource
+// records.
+func (c *chainChecker) isZoneCut(name string) (bool, error) {
+	result, err := c.client.ResolveContext(c.ctx, name, dns.TypeNS)
+	if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, rr := range result.Answer {
+		if rr.Type == dns.TypeNS && strings.EqualFold(rr.Name, name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// fetch resolves the name to the resource records of the type with DNSSEC,
+// and splits them from their signatures.
+func (c *chainChecker) fetch(
+	name string,
+	t dns.Type,
+) ([]dns.RR, []dns.RRSIG, resolver.Status, error) {
+	result, status, err := c.client.ResolveDNSSECContext(c.ctx, name, t)
+	if err != nil {
+		return nil, nil, status, err
+	}
+
+	rrs, sigs := []dns.RR{}, []dns.RRSIG{}
+	for _, rr := range result.Answer {
+		switch {
+		case rr.Type == t && strings.EqualFold(rr.Name, name):
+			rrs = append(rrs, rr)
+		case rr.Type == dns.TypeRRSIG && strings.EqualFold(rr.Name, name):
+			sig := dns.RRSIG{}
+			if err := sig.Unpack(rr.RData); err == nil && sig.TypeCovered == t {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+
+	return rrs, sigs, status, nil
+}
+
+// checkDS fetches the DS resource records of the zone from its parent, and
+// verifies them with the keys of the parent. When the parent proves there are
+// none, the zone is an insecure delegation, which ends the chain.
+func (c *chainChecker) checkDS(
+	zone string,
+	parent string,
+	keys []dns.DNSKEY,
+) ([]dns.DS, resolver.Status, error) {
+	rrs, sigs, status, err := c.fetch(zone, dns.TypeDS)
+	if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) {
+		if status != resolver.StatusInsecure && status != resolver.StatusSecure {
+			return nil, status, &chainError{zone, dns.TypeDS, "no proof that the DS records don't exist"}
+		}
+		fmt.Fprintf(c.out, "  no DS records at %s: insecure delegation\n", parent)
+		return nil, resolver.StatusInsecure, nil
+	}
+	if err != nil {
+		return nil, status, err
+	}
+
+	ds := []dns.DS{}
+	for _, rr := range rrs {
+		d := dns.DS{}
+		if err := d.Unpack(rr.RData); err != nil {
+			continue
+		}
+		fmt.Fprintf(c.out, "  DS %d %s %s\n", d.KeyTag, d.Algorithm, d.DigestType)
+		ds = append(ds, d)
+	}
+
+	if err := c.checkSigs(zone, dns.TypeDS, rrs, sigs, parent, keys); err != nil {
+		return nil, resolver.StatusBogus, err
+	}
+
+	return ds, resolver.StatusSecure, nil
+}
+
+// checkKeys fetches the DNSKEY resource records of the zone, and verifies them
+// with the DS records; the DNSKEY resource record set must be signed by a key
+// that matches a DS record. It returns the keys of the zone.
+func (c *chainChecker) checkKeys(zone string, ds []dns.DS) ([]dns.DNSKEY, error) {
+	rrs, sigs, _, err := c.fetch(zone, dns.TypeDNSKEY)
+	if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) ||
+		(err == nil && len(rrs) == 0) {
+		return nil, &chainError{zone, dns.TypeDNSKEY, "no DNSKEY records"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys, entry := []dns.DNSKEY{}, []dns.DNSKEY{}
+	for _, rr := range rrs {
+		k := dns.DNSKEY{}
+		if err := k.Unpack(rr.RData); err != nil {
+			continue
+		}
+
+		role := "ZSK"
+		if k.Flags&dns.DNSKEYFlagSEP != 0 {
+			role = "KSK"
+		}
+		notes := []string{}
+		if k.Flags&dns.DNSKEYFlagRevoke != 0 {
+			notes = append(notes, "revoked")
+		}
+		if matchesAnyDS(&k, zone, ds) {
+			notes = append(notes, "matches DS")
+			entry = append(entry, k)
+		}
+		note := ""
+		if len(notes) > 0 {
+			note = " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintf(c.out, "  DNSKEY %d %s %s%s\n", k.KeyTag(), role, k.Algorithm, note)
+
+		// Revoked keys must not be used for validation.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc5011#section-2.1
+		if k.Flags&dns.DNSKEYFlagRevoke == 0 {
+			keys = append(keys, k)
+		}
+	}
+	if len(entry) == 0 {
+		return nil, &chainError{zone, dns.TypeDNSKEY, "no DNSKEY matches a DS record"}
+	}
+
+	if err := c.checkSigs(zone, dns.TypeDNSKEY, rrs, sigs, zone, entry); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// checkAnswer fetches the resource records of the name and type, and verifies
+// them with the keys of the zone.
+func (c *chainChecker) checkAnswer(
+	name string,
+	qt dns.QType,
+	zone string,
+	keys []dns.DNSKEY,
+) (resolver.Status, error) {
+	rrs, sigs, status, err := c.fetch(name, qt)
+	if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) {
+		if status == resolver.StatusBogus {
+			return status, &chainError{name, qt, "no proof of nonexistence"}
+		}
+		fmt.Fprintf(c.out, "  %v (denial of existence is %s)\n", err, status)
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+
+	for _, rr := range rrs {
+		fmt.Fprintf(c.out, "  %s\n", rr.String())
+	}
+	if err := c.checkSigs(name, qt, rrs, sigs, zone, keys); err != nil {
+		return resolver.StatusBogus, err
+	}
+
+	return resolver.StatusSecure, nil
+}
+
+// checkSigs prints the signatures over the resource record set, and verifies
+// them with the keys of the signer. One valid signature is enough.
+func (c *chainChecker) checkSigs(
+	name string,
+	t dns.Type,
+	rrs []dns.RR,
+	sigs []dns.RRSIG,
+	signer string,
+	keys []dns.DNSKEY,
+) error {
+	if len(sigs) == 0 {
+		return &chainError{name, t, "no signatures"}
+	}
+
+	valid := false
+	for _, sig := range sigs {
+		result := "ok"
+		switch key := findKey(keys, sig.KeyTag, sig.Algorithm); {
+		case !strings.EqualFold(sig.SignerName, signer):
+			result = "signed by " + sig.SignerName + " instead of " + signer
+		case !sig.ValidAt(c.now):
+			result = "not valid now"
+		case key == nil:
+			result = "no matching key"
+		default:
+			if err := sig.Verify(key, rrs); err != nil {
+				result = err.Error()
+			}
+		}
+		if result == "ok" {
+			valid = true
+		}
+
+		fmt.Fprintf(
+			c.out, "  RRSIG %s by %s key %d %s, valid %s - %s: %s\n",
+			t, sig.SignerName, sig.KeyTag, sig.Algorithm,
+			sigTime(sig.Inception), sigTime(sig.Expiration), result,
+		)
+	}
+	if !valid {
+		return &chainError{name, t, "no valid signature"}
+	}
+
+	return nil
+}
+
+// findKey returns the key with the key tag and algorithm, or nil when there's
+// none.
+func findKey(keys []dns.DNSKEY, tag uint16, alg dns.Algorithm) *dns.DNSKEY {
+	for i := range keys {
+		if keys[i].KeyTag() == tag && keys[i].Algorithm == alg {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+// matchesAnyDS checks if the key matches one of the DS records.
+func matchesAnyDS(key *dns.DNSKEY, owner string, ds []dns.DS) bool {
+	for i := range ds {
+		if ds[i].KeyTag != key.KeyTag() || ds[i].Algorithm != key.Algorithm {
+			continue
+		}
+		d, err := key.ToDS(owner, ds[i].DigestType)
+		if err == nil && d.Equal(&ds[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sigTime formats a signature inception or expiration time.
+func sigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/danillouz/tdr/dnstap"
+)
+
+// openDnstap opens a dnstap writer that writes to the file, or connects to
+// the unix socket when the destination is prefixed with "unix:".
+func openDnstap(ctx context.Context, dest string) (*dnstap.Writer, error) {
+	var w *dnstap.Writer
+	if sock := strings.TrimPrefix(dest, "unix:"); sock != dest {
+		var err error
+		if w, err = dnstap.Dial(ctx, "unix", sock); err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Create(dest)
+		if err != nil {
+			return nil, err
+		}
+		if w, err = dnstap.NewWriter(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	w.Identity = "tdr"
+
+	return w, nil
+}
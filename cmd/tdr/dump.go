@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// dumpLineSize is the number of bytes per line of a hex dump.
+const dumpLineSize = 16
+
+// dumpMsg prints the message bytes as a hex dump, annotated with the header,
+// questions and resource records they encode. Bytes that can't be decoded are
+// dumped as-is, annotated with the error.
+func dumpMsg(w io.Writer, b []byte) {
+	off := 0
+	segment := func(n int, note string) {
+		if off+n > len(b) {
+			n = len(b) - off
+		}
+		dumpBytes(w, off, b[off:off+n], strings.ReplaceAll(note, "\t", " "))
+		off += n
+	}
+	undecodable := func(err error) {
+		segment(len(b)-off, fmt.Sprintf("undecodable: %v", err))
+	}
+
+	h := dns.Header{}
+	n, err := h.Unpack(b, off)
+	if err != nil {
+		undecodable(err)
+		return
+	}
+	rcode, ok := rcodeMnemonics[h.RCode]
+	if !ok {
+		rcode = h.RCode.String()
+	}
+	segment(n, fmt.Sprintf(
+		"header: id %d, opcode %s, rcode %s, flags [%s], qd %d, an %d, ns %d, ar %d",
+		h.ID, h.OpCode, rcode, strings.Join(headerFlags(h), " "),
+		h.QDCount, h.ANCount, h.NSCount, h.ARCount,
+	))
+
+	for i := 0; i < int(h.QDCount); i++ {
+		q := dns.Question{}
+		n, err := q.Unpack(b, off)
+		if err != nil {
+			undecodable(err)
+			return
+		}
+		segment(n, "question: "+q.String())
+	}
+
+	sections := []struct {
+		name  string
+		count uint16
+	}{
+		{"answer", h.ANCount},
+		{"authority", h.NSCount},
+		{"additional", h.ARCount},
+	}
+	for _, section := range sections {
+		for i := 0; i < int(section.count); i++ {
+			rr := dns.RR{}
+			n, err := rr.Unpack(b, off)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			// The OPT pseudo resource record has a line per option.
+			segment(n, section.name+": "+strings.ReplaceAll(rr.String(), "\n", " "))
+		}
+	}
+
+	if off < len(b) {
+		segment(len(b)-off, "trailing bytes")
+	}
+}
+
+// dumpBytes prints the bytes as hex, prefixed with the offset of every line.
+// The note annotates the first line.
+func dumpBytes(w io.Writer, off int, b []byte, note string) {
+	for i := 0; i < len(b); i += dumpLineSize {
+		end := i + dumpLineSize
+		if end > len(b) {
+			end = len(b)
+		}
+		hex := make([]string, 0, dumpLineSize)
+		for _, c := range b[i:end] {
+			hex = append(hex, fmt.Sprintf("%02x", c))
+		}
+
+		line := fmt.Sprintf("%04x  %-*s  %s", off+i, dumpLineSize*3-1, strings.Join(hex, " "), note)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+		note = ""
+	}
+}
+
+// dumpDialer dials connections that dump every query that's written to them,
+// and every response that's read from them.
+type dumpDialer struct {
+	dialer net.Dialer
+
+	// out is where the dumps are printed.
+	out io.Writer
+
+	// mu serializes the dumps of concurrent exchanges.
+	mu sync.Mutex
+}
+
+// DialContext dials the address, and wraps the connection so it dumps the
+// messages.
+func (d *dumpDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dumpConn{
+		Conn:    conn,
+		dialer:  d,
+		network: network,
+		addr:    addr,
+		stream:  strings.HasPrefix(network, "tcp"),
+	}, nil
+}
+
+// dump prints the message bytes with a banner that describes the message.
+func (d *dumpDialer) dump(banner string, b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintf(d.out, ";; %s (%d bytes)\n", banner, len(b))
+	dumpMsg(d.out, b)
+	fmt.Fprintln(d.out)
+}
+
+// dumpConn is a connection that dumps the messages that are written to it and
+// read from it.
+type dumpConn struct {
+	net.Conn
+
+	dialer  *dumpDialer
+	network string
+	addr    string
+
+	// stream is set when messages are prefixed with their length (TCP), and
+	// may be split over multiple reads or writes.
+	stream bool
+
+	// wbuf and rbuf hold the bytes of the partially written and read messages
+	// of a stream.
+	wbuf, rbuf []byte
+}
+
+// Write writes the bytes, and dumps the queries they hold.
+func (c *dumpConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(&c.wbuf, b[:n], fmt.Sprintf("query to %s over %s", c.addr, c.network))
+	return n, err
+}
+
+// Read reads the bytes, and dumps the responses they hold.
+func (c *dumpConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(&c.rbuf, b[:n], fmt.Sprintf("response from %s over %s", c.addr, c.network))
+	return n, err
+}
+
+// record dumps the message bytes. The bytes of a stream are buffered until
+// they hold a complete message.
+func (c *dumpConn) record(buf *[]byte, b []byte, banner string) {
+	if len(b) == 0 {
+		return
+	}
+	if !c.stream {
+		c.dialer.dump(banner, b)
+		return
+	}
+
+	*buf = append(*buf, b...)
+	for len(*buf) >= 2 {
+		size := int(binary.BigEndian.Uint16(*buf))
+		if len(*buf) < 2+size {
+			return
+		}
+		c.dialer.dump(banner, (*buf)[2:2+size])
+		*buf = (*buf)[2+size:]
+	}
+}
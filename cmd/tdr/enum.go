@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// wildcardProbes is the number of random names that are resolved to detect
+// wildcard resource records.
+const wildcardProbes = 3
+
+// candidate is a subdomain that's resolved while enumerating.
+type candidate struct {
+	// name is the fully qualified name of the subdomain.
+	name string
+
+	// exists is set when the name exists, even without records of the types.
+	exists bool
+
+	// rrs holds the resource records of the name (including CNAME chains).
+	rrs []dns.RR
+
+	// rrsets holds the sorted record data of the answers per type, used to
+	// compare them with wildcard answers.
+	rrsets map[dns.QType]string
+
+	// err is set when the name couldn't be resolved.
+	err error
+}
+
+// runEnum runs "tdr enum [flags] domain", which resolves every label of a
+// wordlist as a subdomain of the domain, and prints the subdomains that exist
+// with their resource records. Answers that match the answers to random
+// (nonexistent) names are synthesized from a wildcard, and are suppressed.
+func runEnum(args []string) int {
+	fs := flag.NewFlagSet("enum", flag.ExitOnError)
+	wordlist := fs.String("w", "", `file with one label per line; "-" reads stdin`)
+	types := fs.String("types", "A,AAAA", "comma separated resource record types to resolve")
+	concurrency := fs.Int("c", 10, "max number of concurrent queries")
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s enum [flags] -w wordlist domain\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	qts := []dns.QType{}
+	var err error
+	for _, s := range strings.Split(*types, ",") {
+		qt, ok := parseType(strings.TrimSpace(s))
+		if !ok {
+			err = fmt.Errorf("invalid type %q", s)
+			break
+		}
+		qts = append(qts, qt)
+	}
+	switch {
+	case err != nil:
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single domain")
+	case *wordlist == "":
+		err = fmt.Errorf("missing -w wordlist")
+	case *concurrency < 1:
+		err = fmt.Errorf("-c must be at least 1")
+	default:
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	domain := strings.ToLower(fs.Arg(0))
+	domain = dns.Fqdn(domain)
+
+	r := os.Stdin
+	if *wordlist != "-" {
+		f, err := os.Open(*wordlist)
+		if err != nil {
+			log.Printf("failed to open wordlist: %v", err)
+			return exitFailure
+		}
+		defer f.Close()
+		r = f
+	}
+	labels, err := readLabels(r)
+	if err != nil {
+		log.Printf("failed to read wordlist: %v", err)
+		return exitFailure
+	}
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	wildcards, err := detectWildcards(ctx, client, domain, qts)
+	if err != nil {
+		log.Printf("failed to detect wildcards: %v", err)
+		return exitCode(err)
+	}
+	for _, qt := range qts {
+		for rrset := range wildcards[qt] {
+			fmt.Printf(";; wildcard %s *.%s %s (suppressed)\n", qt, domain, rrset)
+		}
+	}
+
+	cands := make([]candidate, len(labels))
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, label := range labels {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(c *candidate, name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			*c = resolveCandidate(ctx, client, name, qts)
+		}(&cands[i], label+"."+domain)
+	}
+	wg.Wait()
+
+	return reportEnum(os.Stdout, domain, cands, wildcards)
+}
+
+// readLabels reads one label per line. Empty lines and lines starting with "#"
+// are skipped, and duplicate labels are removed.
+func readLabels(r io.Reader) ([]string, error) {
+	labels := []string{}
+	seen := map[string]bool{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		label := strings.ToLower(strings.TrimSpace(s.Text()))
+		if label == "" || strings.HasPrefix(label, "#") || seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, strings.TrimSuffix(label, "."))
+	}
+
+	return labels, s.Err()
+}
+
+// resolveCandidate resolves the name to the resource records of every type.
+func resolveCandidate(
+	ctx context.Context,
+	client *resolver.Client,
+	name string,
+	qts []dns.QType,
+) candidate {
+	c := candidate{name: name, rrsets: map[dns.QType]string{}}
+	for _, qt := range qts {
+		result, err := client.ResolveContext(ctx, name, qt)
+		switch {
+		case errors.Is(err, resolver.ErrNXDomain):
+			// A name that doesn't exist has no records of any type.
+			return c
+		case errors.Is(err, resolver.ErrNoData):
+			c.exists = true
+			continue
+		case err != nil:
+			c.err = err
+			return c
+		}
+
+		c.exists = true
+		c.rrs = append(c.rrs, result.CNAMEs...)
+		c.rrs = append(c.rrs, result.Answer...)
+		c.rrsets[qt] = rrsetKey(result.Answer)
+	}
+
+	return c
+}
+
+// rrsetKey returns the sorted record data of the resource records, which
+// identifies them regardless of their owner name, order and TTL.
+func rrsetKey(rrs []dns.RR) string {
+	rds := []string{}
+	for _, rr := range rrs {
+		rds = append(rds, rr.RDataUnpacked)
+	}
+	sort.Strings(rds)
+
+	return strings.Join(rds, ", ")
+}
+
+// detectWildcards resolves random names below the domain, which only have
+// answers when they're synthesized from a wildcard. It returns the record data
+// of the wildcard answers per type.
+func detectWildcards(
+	ctx context.Context,
+	client *resolver.Client,
+	domain string,
+	qts []dns.QType,
+) (map[dns.QType]map[string]bool, error) {
+	wildcards := map[dns.QType]map[string]bool{}
+	for _, qt := range qts {
+		wildcards[qt] = map[string]bool{}
+	}
+
+	// A wildcard may be served by multiple (load balanced) addresses, so every
+	// probe may answer differently.
+	for i := 0; i < wildcardProbes; i++ {
+		label, err := randomLabel()
+		if err != nil {
+			return nil, err
+		}
+		c := resolveCandidate(ctx, client, label+"."+domain, qts)
+		if c.err != nil {
+			return nil, c.err
+		}
+		for qt, rrset := range c.rrsets {
+			wildcards[qt][rrset] = true
+		}
+	}
+
+	return wildcards, nil
+}
+
+// isWildcard checks if every answer of the candidate matches a wildcard
+// answer.
+func (c *candidate) isWildcard(wildcards map[dns.QType]map[string]bool) bool {
+	if len(c.rrsets) == 0 {
+		return false
+	}
+	for qt, rrset := range c.rrsets {
+		if !wildcards[qt][rrset] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reportEnum prints the candidates that exist and aren't synthesized from a
+// wildcard, with their resource records, and the candidates that failed to
+// resolve. It returns exitFailure when any candidate failed.
+func reportEnum(
+	out io.Writer,
+	domain string,
+	cands []candidate,
+	wildcards map[dns.QType]map[string]bool,
+) int {
+	code := exitOK
+	found := 0
+	for _, c := range cands {
+		switch {
+		case c.err != nil:
+			code = exitFailure
+			fmt.Fprintf(out, ";; %s: %v\n", c.name, c.err)
+		case !c.exists || c.isWildcard(wildcards):
+		case len(c.rrs) == 0:
+			found++
+			fmt.Fprintf(out, ";; %s exists without records of the types\n", c.name)
+		default:
+			found++
+			for _, rr := range c.rrs {
+				fmt.Fprintln(out, rr.String())
+			}
+		}
+	}
+	fmt.Fprintf(out, "\n;; found %d of %d names in %s\n", found, len(cands), domain)
+
+	return code
+}
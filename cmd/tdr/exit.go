@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// Exit codes, so scripts can branch on the outcome of a resolution without
+// parsing the output.
+const (
+	// exitOK means the name was resolved.
+	exitOK = 0
+
+	// exitFailure means the resolution failed for any other reason.
+	exitFailure = 1
+
+	// exitUsage means the command line is invalid.
+	exitUsage = 2
+
+	// exitNXDomain means the name doesn't exist.
+	exitNXDomain = 3
+
+	// exitServFail means the name servers failed to resolve the name.
+	exitServFail = 4
+
+	// exitTimeout means no name server responded in time.
+	exitTimeout = 5
+
+	// exitExpected means the expected value appeared while watching.
+	exitExpected = 6
+)
+
+// exitCode returns the exit code of the error.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, resolver.ErrNXDomain):
+		return exitNXDomain
+	case errors.Is(err, resolver.ErrServFail):
+		return exitServFail
+	case errors.Is(err, resolver.ErrTimeout):
+		return exitTimeout
+	default:
+		return exitFailure
+	}
+}
+
+// rcodeExitCode returns the exit code of the response code.
+func rcodeExitCode(rc dns.RCode) int {
+	switch rc {
+	case dns.RCodeNoError:
+		return exitOK
+	case dns.RCodeNameError:
+		return exitNXDomain
+	case dns.RCodeServerFailure:
+		return exitServFail
+	default:
+		return exitFailure
+	}
+}
+
+// fail logs the message and the error with the default logger, and exits
+// with the exit code of the error.
+func fail(err error, msg string) {
+	slog.Error(msg, "err", err)
+	os.Exit(exitCode(err))
+}
+
+// usageError prints the error and the usage, and exits with exitUsage.
+func usageError(err error) {
+	fmt.Fprintln(flag.CommandLine.Output(), err)
+	flag.Usage()
+	os.Exit(exitUsage)
+}
+
+// usage prints the usage, including the exit codes.
+func usage() {
+	w := flag.CommandLine.Output()
+	names := []string{}
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Usage: %s [flags] [@server] name... [class] [type...]\n", os.Args[0])
+	fmt.Fprintf(w, "       %s <subcommand> [flags] [args...]\n\n", os.Args[0])
+	fmt.Fprintf(w, "Subcommands:\n  %s\n\nFlags:\n", strings.Join(names, "\n  "))
+	flag.PrintDefaults()
+	fmt.Fprintf(
+		w,
+		"\nExit codes:\n"+
+			"  %d  success\n"+
+			"  %d  failure\n"+
+			"  %d  usage error\n"+
+			"  %d  name does not exist (NXDOMAIN)\n"+
+			"  %d  server failure (SERVFAIL)\n"+
+			"  %d  timeout\n"+
+			"  %d  expected value appeared (-watch with -expect)\n",
+		exitOK, exitFailure, exitUsage, exitNXDomain, exitServFail, exitTimeout,
+		exitExpected,
+	)
+}
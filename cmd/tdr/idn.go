@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// nameTypes are the types of the resource records with domain names in their
+// record data.
+var nameTypes = map[dns.Type]bool{
+	dns.TypeNS:    true,
+	dns.TypeCNAME: true,
+	dns.TypeSOA:   true,
+	dns.TypePTR:   true,
+	dns.TypeMX:    true,
+	dns.TypeSRV:   true,
+}
+
+// unicodeMsg returns a copy of the message with the A-labels of its names
+// converted to U-labels (e.g. "xn--bcher-kva.example." becomes
+// "bücher.example."), to display it.
+func unicodeMsg(msg *dns.Msg) *dns.Msg {
+	m := *msg
+	m.Question.QName = dns.ToUnicode(m.Question.QName)
+
+	convert := func(rrs []dns.RR) []dns.RR {
+		out := make([]dns.RR, len(rrs))
+		for i, rr := range rrs {
+			rr.Name = dns.ToUnicode(rr.Name)
+			if nameTypes[rr.Type] {
+				// Domain names are the fully qualified fields of the record
+				// data.
+				fields := strings.Fields(rr.RDataUnpacked)
+				for j, f := range fields {
+					if dns.IsFqdn(f) {
+						fields[j] = dns.ToUnicode(f)
+					}
+				}
+				rr.RDataUnpacked = strings.Join(fields, " ")
+			}
+			out[i] = rr
+		}
+		return out
+	}
+	m.Answer = convert(m.Answer)
+	m.Authority = convert(m.Authority)
+	m.Additional = convert(m.Additional)
+
+	return &m
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// jsonMsg is the JSON representation of a DNS message, following the DNS in
+// JSON schema. The members after the sections aren't part of the schema; they
+// describe the exchange.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8427
+type jsonMsg struct {
+	ID         uint16 `json:"ID"`
+	QR         byte   `json:"QR"`
+	Opcode     byte   `json:"Opcode"`
+	AA         byte   `json:"AA"`
+	TC         byte   `json:"TC"`
+	RD         byte   `json:"RD"`
+	RA         byte   `json:"RA"`
+	RCODE      byte   `json:"RCODE"`
+	QDCOUNT    int    `json:"QDCOUNT"`
+	ANCOUNT    int    `json:"ANCOUNT"`
+	NSCOUNT    int    `json:"NSCOUNT"`
+	ARCOUNT    int    `json:"ARCOUNT"`
+	QNAME      string `json:"QNAME,omitempty"`
+	QTYPE      uint16 `json:"QTYPE,omitempty"`
+	QTYPEname  string `json:"QTYPEname,omitempty"`
+	QCLASS     uint16 `json:"QCLASS,omitempty"`
+	QCLASSname string `json:"QCLASSname,omitempty"`
+
+	AnswerRRs     []jsonRR `json:"answerRRs"`
+	AuthorityRRs  []jsonRR `json:"authorityRRs"`
+	AdditionalRRs []jsonRR `json:"additionalRRs"`
+
+	DateString  string  `json:"dateString"`
+	DateSeconds float64 `json:"dateSeconds"`
+	Server      string  `json:"server"`
+	RTT         string  `json:"rtt"`
+	DNSSEC      string  `json:"dnssec,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// jsonRR is the JSON representation of a resource record. The RDATA is
+// included in hex, and (when the type is known) in presentation format as
+// "rdata" followed by the type name, e.g. "rdataMX".
+type jsonRR map[string]interface{}
+
+// newJSONMsg creates the JSON representation of the message, which was
+// received from the server after the round-trip time.
+func newJSONMsg(m *dns.Msg, server string, rtt time.Duration) jsonMsg {
+	now := time.Now()
+	j := jsonMsg{
+		ID:            m.ID,
+		QR:            m.QR,
+		Opcode:        byte(m.OpCode),
+		AA:            m.AA,
+		TC:            m.TC,
+		RD:            m.RD,
+		RA:            m.RA,
+		RCODE:         byte(m.RCode),
+		QDCOUNT:       len(m.Questions()),
+		ANCOUNT:       len(m.Answer),
+		NSCOUNT:       len(m.Authority),
+		ARCOUNT:       len(m.Additional),
+		AnswerRRs:     newJSONRRs(m.Answer),
+		AuthorityRRs:  newJSONRRs(m.Authority),
+		AdditionalRRs: newJSONRRs(m.Additional),
+		DateString:    now.UTC().Format(time.RFC3339Nano),
+		DateSeconds:   float64(now.UnixNano()) / float64(time.Second),
+		Server:        server,
+		RTT:           rtt.String(),
+	}
+	if q := m.Question; q != (dns.Question{}) {
+		j.QNAME = q.QName
+		j.QTYPE = uint16(q.QType)
+		j.QTYPEname = q.QType.String()
+		j.QCLASS = uint16(q.QClass)
+		j.QCLASSname = q.QClass.String()
+	}
+
+	return j
+}
+
+// newJSONRRs creates the JSON representation of the resource records.
+func newJSONRRs(rrs []dns.RR) []jsonRR {
+	jrrs := []jsonRR{}
+	for _, rr := range rrs {
+		jrr := jsonRR{
+			"NAME":     rr.Name,
+			"TYPE":     uint16(rr.Type),
+			"CLASS":    uint16(rr.Class),
+			"TTL":      rr.TTL,
+			"RDLENGTH": len(rr.RData),
+			"RDATAHEX": hex.EncodeToString(rr.RData),
+		}
+		if name := rr.Type.String(); name != "" {
+			jrr["TYPEname"] = name
+			if rr.Type != dns.TypeOPT {
+				jrr["rdata"+name] = rr.RDataUnpacked
+			}
+		}
+		if name := rr.Class.String(); name != "" {
+			jrr["CLASSname"] = name
+		}
+		jrrs = append(jrrs, jrr)
+	}
+
+	return jrrs
+}
+
+// printJSON prints the JSON representation of the message.
+func printJSON(w io.Writer, j jsonMsg) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(j)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+// keyCommands maps a key subcommand name to the function that runs it.
+var keyCommands = map[string]func(args []string) int{
+	"ds":  runKeyDS,
+	"gen": runKeyGen,
+}
+
+// runKey runs "tdr key <command> [flags] [args...]", which runs a command on
+// DNSSEC keys.
+func runKey(args []string) int {
+	if len(args) > 0 {
+		if run, ok := keyCommands[args[0]]; ok {
+			return run(args[1:])
+		}
+	}
+
+	names := make([]string, 0, len(keyCommands))
+	for name := range keyCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s key <command> [flags] [args...]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+
+	return exitUsage
+}
+
+// algorithmAliases maps short names of security algorithms to them.
+var algorithmAliases = map[string]dns.Algorithm{
+	"ECDSAP256": dns.AlgorithmECDSAP256SHA256,
+	"ECDSAP384": dns.AlgorithmECDSAP384SHA384,
+}
+
+// parseAlgorithm parses the mnemonic (e.g. "ECDSAP256SHA256", or the short
+// "ECDSAP256") or number of the security algorithm, and returns 0 when it's
+// unknown.
+func parseAlgorithm(s string) dns.Algorithm {
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		if _, ok := dns.AlgorithmToString[dns.Algorithm(n)]; ok {
+			return dns.Algorithm(n)
+		}
+		return 0
+	}
+	if alg, ok := algorithmAliases[strings.ToUpper(s)]; ok {
+		return alg
+	}
+	for alg, mnemonic := range dns.AlgorithmToString {
+		if strings.EqualFold(mnemonic, s) {
+			return alg
+		}
+	}
+
+	return 0
+}
+
+// parseDigestType parses the name (e.g. "SHA-256" or "SHA256") or number of
+// the DS digest algorithm, and returns 0 when it's unknown.
+func parseDigestType(s string) dns.DigestType {
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		if _, ok := dns.DigestTypeToString[dns.DigestType(n)]; ok {
+			return dns.DigestType(n)
+		}
+		return 0
+	}
+	for dt, name := range dns.DigestTypeToString {
+		if strings.EqualFold(name, s) || strings.EqualFold(strings.ReplaceAll(name, "-", ""), s) {
+			return dt
+		}
+	}
+
+	return 0
+}
+
+// runKeyGen runs "tdr key gen [flags] name", which generates a DNSSEC key
+// pair for the zone name, and writes it to files in the formats of
+// dnssec-keygen.
+func runKeyGen(args []string) int {
+	fs := flag.NewFlagSet("key gen", flag.ExitOnError)
+	algorithm := fs.String(
+		"algorithm", "ECDSAP256SHA256", "algorithm of the key: RSASHA256, ECDSAP256SHA256 or ED25519",
+	)
+	bits := fs.Int("bits", dns.DefaultRSAKeySize, "size of RSA keys in bits")
+	ksk := fs.Bool("ksk", false, "generate a key signing key (with the SEP flag)")
+	dir := fs.String("dir", ".", "directory the key files are written to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s key gen [flags] name\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	alg := parseAlgorithm(*algorithm)
+	isRSA := alg == dns.AlgorithmRSASHA256 || alg == dns.AlgorithmRSASHA512
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a zone name")
+	case alg == 0:
+		err = fmt.Errorf("unsupported -algorithm %q", *algorithm)
+	case isRSA && (*bits < 1024 || *bits > 4096):
+		err = fmt.Errorf("-bits must be between 1024 and 4096")
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	name, err := dns.ToASCII(dns.Fqdn(fs.Arg(0)))
+	if err != nil {
+		log.Printf("invalid zone name: %v", err)
+		return exitFailure
+	}
+	flags := dns.DNSKEYFlagZone
+	if *ksk {
+		flags |= dns.DNSKEYFlagSEP
+	}
+
+	var priv crypto.Signer
+	var key *dns.DNSKEY
+	if isRSA && *bits != dns.DefaultRSAKeySize {
+		var rsaKey *rsa.PrivateKey
+		rsaKey, err = rsa.GenerateKey(rand.Reader, *bits)
+		if err == nil {
+			priv = rsaKey
+			key, err = dns.NewDNSKEY(rsaKey.Public(), alg, flags)
+		}
+	} else {
+		priv, key, err = dns.GenerateKey(alg, flags)
+	}
+	if err != nil {
+		log.Printf("failed to generate key: %v", err)
+		return exitFailure
+	}
+
+	path, err := writeKeyPair(*dir, name, priv, key)
+	if err != nil {
+		log.Printf("failed to write key: %v", err)
+		return exitFailure
+	}
+	fmt.Println(path)
+
+	return exitOK
+}
+
+// runKeyDS runs "tdr key ds [flags] file...", which derives the DS records
+// (for the parent zone) of the DNSKEY resource records in the files, e.g.
+// public key files generated with "tdr key gen", or zone files.
+func runKeyDS(args []string) int {
+	fs := flag.NewFlagSet("key ds", flag.ExitOnError)
+	digests := []dns.DigestType{}
+	fs.Func(
+		"digest",
+		"digest algorithm of the DS records: SHA-1, SHA-256 or SHA-384 (default SHA-256); repeat\n"+
+			"the flag to derive DS records with more digest algorithms",
+		func(s string) error {
+			dt := parseDigestType(s)
+			if dt == 0 {
+				return fmt.Errorf("unsupported digest algorithm %q", s)
+			}
+			digests = append(digests, dt)
+			return nil
+		},
+	)
+	all := fs.Bool("all", false, "derive DS records of keys without the SEP flag as well")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s key ds [flags] file...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(fs.Output(), "expected a file with DNSKEY records")
+		fs.Usage()
+		return exitUsage
+	}
+	if len(digests) == 0 {
+		digests = append(digests, dns.DigestTypeSHA256)
+	}
+
+	code := exitOK
+	for _, path := range fs.Args() {
+		rrs, err := loadDNSKEYs(path)
+		if err != nil {
+			log.Printf("failed to load %s: %v", path, err)
+			code = exitFailure
+			continue
+		}
+		for _, rr := range rrs {
+			rd, err := rr.Decode()
+			if err != nil {
+				log.Printf("invalid DNSKEY record of %s in %s: %v", rr.Name, path, err)
+				code = exitFailure
+				continue
+			}
+			key := rd.(*dns.DNSKEY)
+			if key.Flags&dns.DNSKEYFlagZone == 0 {
+				continue
+			}
+			if key.Flags&dns.DNSKEYFlagSEP == 0 && !*all {
+				log.Printf("skipping key %d of %s: it has no SEP flag (see -all)", key.KeyTag(), rr.Name)
+				continue
+			}
+
+			for _, dt := range digests {
+				ds, err := key.ToDS(rr.Name, dt)
+				if err != nil {
+					log.Printf("failed to derive DS record of key %d: %v", key.KeyTag(), err)
+					code = exitFailure
+					continue
+				}
+				rdata, err := ds.Pack()
+				if err != nil {
+					log.Printf("failed to derive DS record of key %d: %v", key.KeyTag(), err)
+					code = exitFailure
+					continue
+				}
+				dsrr, err := dns.NewRR(rr.Name, dns.TypeDS, dns.ClassIN, rr.TTL, rdata)
+				if err != nil {
+					log.Printf("failed to derive DS record of key %d: %v", key.KeyTag(), err)
+					code = exitFailure
+					continue
+				}
+				fmt.Println(dsrr.String())
+			}
+		}
+	}
+
+	return code
+}
+
+// loadDNSKEYs loads the DNSKEY resource records from the file, which holds
+// resource records in the zone file format (without the TTL when none is
+// given, like in public key files).
+func loadDNSKEYs(path string) ([]dns.RR, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rrs, err := zone.Parse(strings.NewReader("$TTL 0\n"+string(b)), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []dns.RR{}
+	for _, rr := range rrs {
+		if rr.Type == dns.TypeDNSKEY {
+			keys = append(keys, rr)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records")
+	}
+
+	return keys, nil
+}
+
+// keyFileName returns the base name of the files of the key of the owner
+// name, like dnssec-keygen names them (e.g. "Kexample.org.+013+12345").
+func keyFileName(owner string, key *dns.DNSKEY) string {
+	return fmt.Sprintf("K%s+%03d+%05d", dns.CanonicalName(dns.Fqdn(owner)), key.Algorithm, key.KeyTag())
+}
+
+// writeKeyPair writes the key pair of the owner name to a public key file
+// (with the DNSKEY resource record) and a private key file in the directory,
+// in the formats of dnssec-keygen, and returns their path without the .key or
+// .private extension (see loadKeyPair).
+func writeKeyPair(dir string, owner string, priv crypto.Signer, key *dns.DNSKEY) (string, error) {
+	private, err := dns.MarshalPrivateKey(priv, key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	rdata, err := key.Pack()
+	if err != nil {
+		return "", err
+	}
+	rr, err := dns.NewRR(owner, dns.TypeDNSKEY, dns.ClassIN, 0, rdata)
+	if err != nil {
+		return "", err
+	}
+
+	kind := "zone-signing"
+	if key.Flags&dns.DNSKEYFlagSEP != 0 {
+		kind = "key-signing"
+	}
+	public := fmt.Sprintf(
+		"; This is a %s key, keyid %d, for %s\n%s IN DNSKEY %s\n",
+		kind, key.KeyTag(), rr.Name, rr.Name, rr.RDataUnpacked,
+	)
+
+	path := filepath.Join(dir, keyFileName(owner, key))
+	if err := os.WriteFile(path+".key", []byte(public), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path+".private", []byte(private), 0o600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// newLogger creates the logger of the query command, which logs to w at the
+// warning level: at the debug level when verbose (every query sent to a name
+// server, its response and every referral), and only errors when quiet.
+func newLogger(w io.Writer, verbose bool, quiet bool) *slog.Logger {
+	level := slog.LevelWarn
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelError
+	}
+
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// fatal logs the message and key-value pairs as an error with the default
+// logger, and exits with exitFailure.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(exitFailure)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/resolver"
+)
+
+// spfMaxLookups is the max number of DNS lookups an SPF evaluation may cause.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7208#section-4.6.4
+const spfMaxLookups = 10
+
+// Severities of a mail finding.
+const (
+	severityWarn  = "WARN"
+	severityError = "ERROR"
+)
+
+// mailFinding is a misconfiguration found by a mail check.
+type mailFinding struct {
+	severity string
+	msg      string
+}
+
+// mailChecker checks the mail related resource records of a domain, and
+// collects the misconfigurations it finds.
+type mailChecker struct {
+	ctx    context.Context
+	client *resolver.Client
+
+	// out is where the records are printed.
+	out io.Writer
+
+	// findings holds the misconfigurations in the order they're found.
+	findings []mailFinding
+}
+
+// runMailCheck runs "tdr mailcheck [flags] domain", which fetches the MX,
+// SPF, DMARC and (optionally) DKIM records of the domain, and reports
+// misconfigurations that affect email deliverability.
+func runMailCheck(args []string) int {
+	fs := flag.NewFlagSet("mailcheck", flag.ExitOnError)
+	selectors := fs.String("dkim", "", "comma separated DKIM selectors to check")
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s mailcheck [flags] domain\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	if fs.NArg() != 1 {
+		err = fmt.Errorf("expected a single domain")
+	} else {
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	domain := strings.TrimSuffix(strings.ToLower(fs.Arg(0)), ".")
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	c := &mailChecker{ctx: ctx, client: client, out: os.Stdout}
+	c.checkMX(domain)
+	c.checkSPF(domain)
+	c.checkDMARC(domain)
+	if *selectors != "" {
+		for _, sel := range strings.Split(*selectors, ",") {
+			c.checkDKIM(domain, strings.TrimSpace(sel))
+		}
+	}
+
+	return c.report()
+}
+
+// add adds a finding.
+func (c *mailChecker) add(severity string, format string, args ...interface{}) {
+	c.findings = append(c.findings, mailFinding{severity, fmt.Sprintf(format, args...)})
+}
+
+// lookupTXT looks up the TXT records of the name that start with the prefix
+// (case insensitive), e.g. "v=spf1". A name without TXT records has none.
+func (c *mailChecker) lookupTXT(name string, prefix string) ([]string, error) {
+	txts, err := c.client.LookupTXT(c.ctx, name)
+	if errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+	for _, txt := range txts {
+		fields := strings.Fields(txt)
+		if len(fields) > 0 && strings.EqualFold(strings.TrimSuffix(fields[0], ";"), prefix) {
+			records = append(records, txt)
+		}
+	}
+
+	return records, nil
+}
+
+// checkMX checks that the mail exchanges of the domain resolve.
+func (c *mailChecker) checkMX(domain string) {
+	fmt.Fprintf(c.out, ";; MX %s\n", domain)
+
+	mxs, err := c.client.LookupMX(c.ctx, domain)
+	switch {
+	case errors.Is(err, resolver.ErrNoData):
+		c.add(severityWarn, "no MX records; mail is delivered to the address of %s", domain)
+		return
+	case err != nil:
+		c.add(severityError, "failed to look up MX records: %v", err)
+		return
+	}
+
+	// A single MX record with the root as host is a null MX, which means the
+	// domain doesn't accept mail.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7505
+	if len(mxs) == 1 && mxs[0].Host == "." {
+		fmt.Fprintf(c.out, "  %d . (null MX: the domain doesn't accept mail)\n", mxs[0].Pref)
+		return
+	}
+
+	for _, mx := range mxs {
+		ips, err := c.client.ResolveHostContext(c.ctx, mx.Host)
+		if err != nil {
+			fmt.Fprintf(c.out, "  %d %s\n", mx.Pref, mx.Host)
+			c.add(severityError, "MX host %s doesn't resolve: %v", mx.Host, err)
+			continue
+		}
+		fmt.Fprintf(c.out, "  %d %s %v\n", mx.Pref, mx.Host, ips)
+
+		// See: https://datatracker.ietf.org/doc/html/rfc2181#section-10.3
+		if cname, err := c.client.LookupCNAME(c.ctx, mx.Host); err == nil &&
+			!strings.EqualFold(cname, mx.Host) {
+			c.add(severityWarn, "MX host %s is an alias (CNAME) of %s", mx.Host, cname)
+		}
+	}
+}
+
+// checkSPF checks the SPF record of the domain, and counts the DNS lookups
+// its evaluation causes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7208
+func (c *mailChecker) checkSPF(domain string) {
+	fmt.Fprintf(c.out, ";; SPF %s\n", domain)
+
+	records, err := c.lookupTXT(domain, "v=spf1")
+	switch {
+	case err != nil:
+		c.add(severityError, "failed to look up the SPF record: %v", err)
+		return
+	case len(records) == 0:
+		c.add(severityError, "no SPF record at %s", domain)
+		return
+	case len(records) > 1:
+		c.add(severityError, "%d SPF records at %s; there must be only one", len(records), domain)
+	}
+	for _, r := range records {
+		fmt.Fprintf(c.out, "  %s\n", r)
+	}
+
+	record := records[0]
+	lookups := c.spfLookups(record, map[string]bool{domain: true})
+	fmt.Fprintf(c.out, "  (%d DNS lookups)\n", lookups)
+	if lookups > spfMaxLookups {
+		c.add(
+			severityError, "SPF record causes %d DNS lookups, exceeding the limit of %d",
+			lookups, spfMaxLookups,
+		)
+	}
+
+	all := ""
+	for _, term := range strings.Fields(record)[1:] {
+		if strings.EqualFold(strings.TrimLeft(term, "+-~?"), "all") {
+			all = term
+		}
+		if strings.EqualFold(strings.TrimLeft(term, "+-~?"), "ptr") ||
+			strings.HasPrefix(strings.ToLower(strings.TrimLeft(term, "+-~?")), "ptr:") {
+			c.add(severityWarn, "SPF record uses the ptr mechanism, which should not be used")
+		}
+	}
+	switch all {
+	case "all", "+all":
+		c.add(severityError, "SPF record ends with %q, which allows any sender", all)
+	case "?all":
+		c.add(severityWarn, "SPF record ends with %q, which doesn't protect the domain", all)
+	case "":
+		if !strings.Contains(strings.ToLower(record), "redirect=") {
+			c.add(severityWarn, "SPF record has no \"all\" mechanism")
+		}
+	}
+}
+
+// spfLookups counts the DNS lookups the evaluation of the SPF record causes,
+// including the records of the domains it includes or redirects to. Domains
+// that are already visited aren't counted again, which guards against loops.
+func (c *mailChecker) spfLookups(record string, visited map[string]bool) int {
+	lookups := 0
+	for _, term := range strings.Fields(record)[1:] {
+		term = strings.ToLower(strings.TrimLeft(term, "+-~?"))
+		name, target := term, ""
+		if i := strings.IndexAny(term, ":=/"); i >= 0 {
+			name = term[:i]
+			if term[i] != '/' {
+				target = term[i+1:]
+			}
+		}
+
+		switch name {
+		case "a", "mx", "ptr", "exists":
+			lookups++
+		case "include", "redirect":
+			lookups++
+			// Targets with macros can only be expanded when evaluating a
+			// message.
+			if target == "" || strings.Contains(target, "%") || visited[target] {
+				continue
+			}
+			visited[target] = true
+
+			records, err := c.lookupTXT(target, "v=spf1")
+			if err != nil {
+				c.add(severityError, "failed to look up the SPF record of %s: %v", target, err)
+				continue
+			}
+			if len(records) != 1 {
+				c.add(
+					severityError, "%s %s has %d SPF records; it must have one",
+					name, target, len(records),
+				)
+				continue
+			}
+			lookups += c.spfLookups(records[0], visited)
+		}
+	}
+
+	return lookups
+}
+
+// parseTags parses a tag list, i.e. "tag=value" pairs separated by semicolons.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6376#section-3.2
+func parseTags(record string) map[string]string {
+	tags := map[string]string{}
+	for _, spec := range strings.Split(record, ";") {
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			continue
+		}
+		tag := strings.ToLower(strings.TrimSpace(spec[:i]))
+		tags[tag] = strings.TrimSpace(spec[i+1:])
+	}
+
+	return tags
+}
+
+// checkDMARC checks the DMARC policy of the domain.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7489#section-6.3
+func (c *mailChecker) checkDMARC(domain string) {
+	name := "_dmarc." + domain
+	fmt.Fprintf(c.out, ";; DMARC %s\n", name)
+
+	records, err := c.lookupTXT(name, "v=DMARC1")
+	switch {
+	case err != nil:
+		c.add(severityError, "failed to look up the DMARC record: %v", err)
+		return
+	case len(records) == 0:
+		c.add(severityError, "no DMARC record at %s", name)
+		return
+	case len(records) > 1:
+		c.add(severityError, "%d DMARC records at %s; there must be only one", len(records), name)
+	}
+	for _, r := range records {
+		fmt.Fprintf(c.out, "  %s\n", r)
+	}
+
+	tags := parseTags(records[0])
+	switch p := strings.ToLower(tags["p"]); p {
+	case "quarantine", "reject":
+	case "none":
+		c.add(severityWarn, "DMARC policy is \"none\", which only monitors")
+	case "":
+		c.add(severityError, "DMARC record has no policy (p)")
+	default:
+		c.add(severityError, "DMARC record has an invalid policy %q", p)
+	}
+	if pct, ok := tags["pct"]; ok {
+		if n, err := strconv.Atoi(pct); err != nil || n < 0 || n > 100 {
+			c.add(severityError, "DMARC record has an invalid percentage %q", pct)
+		} else if n < 100 {
+			c.add(severityWarn, "DMARC policy only applies to %d%% of messages", n)
+		}
+	}
+	if tags["rua"] == "" {
+		c.add(severityWarn, "DMARC record has no aggregate report address (rua)")
+	}
+}
+
+// checkDKIM checks the DKIM public key of the selector.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6376#section-3.6.1
+func (c *mailChecker) checkDKIM(domain string, selector string) {
+	name := selector + "._domainkey." + domain
+	fmt.Fprintf(c.out, ";; DKIM %s\n", name)
+
+	txts, err := c.client.LookupTXT(c.ctx, name)
+	switch {
+	case errors.Is(err, resolver.ErrNoData) || errors.Is(err, resolver.ErrNXDomain):
+		c.add(severityError, "no DKIM record for selector %s", selector)
+		return
+	case err != nil:
+		c.add(severityError, "failed to look up the DKIM record of selector %s: %v", selector, err)
+		return
+	}
+
+	// The version tag is optional, so every TXT record is a candidate.
+	for _, txt := range txts {
+		fmt.Fprintf(c.out, "  %s\n", txt)
+
+		tags := parseTags(txt)
+		if v, ok := tags["v"]; ok && v != "DKIM1" {
+			c.add(severityError, "DKIM record of selector %s has an invalid version %q", selector, v)
+		}
+		if k, ok := tags["k"]; ok && k != "rsa" && k != "ed25519" {
+			c.add(severityWarn, "DKIM record of selector %s has an unknown key type %q", selector, k)
+		}
+		p, ok := tags["p"]
+		switch {
+		case !ok:
+			c.add(severityError, "DKIM record of selector %s has no public key (p)", selector)
+		case p == "":
+			c.add(severityWarn, "DKIM key of selector %s is revoked", selector)
+		}
+	}
+}
+
+// report prints the findings. It returns exitOK when there are no errors.
+func (c *mailChecker) report() int {
+	fmt.Fprintln(c.out)
+	if len(c.findings) == 0 {
+		fmt.Fprintln(c.out, "No problems found")
+		return exitOK
+	}
+
+	code := exitOK
+	for _, f := range c.findings {
+		if f.severity == severityError {
+			code = exitFailure
+		}
+		fmt.Fprintf(c.out, "%-5s  %s\n", f.severity, f.msg)
+	}
+
+	return code
+}
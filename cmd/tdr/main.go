@@ -1,27 +1,603 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/danillouz/tdr/internal/dns"
-	"github.com/danillouz/tdr/internal/resolver"
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/dnstap"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/trustanchor"
 )
 
+// subcommands maps a subcommand name to the function that runs it with the
+// remaining arguments, and returns the exit code.
+var subcommands = map[string]func(args []string) int{
+	"bench":         runBench,
+	"caa":           runCAA,
+	"check-ns":      runCheckNS,
+	"compare":       runCompare,
+	"decode":        runDecode,
+	"dnssec":        runDNSSEC,
+	"enum":          runEnum,
+	"key":           runKey,
+	"mailcheck":     runMailCheck,
+	"mdns":          runMDNS,
+	"open-resolver": runOpenResolver,
+	"pcap":          runPCAP,
+	"propagate":     runPropagate,
+	"serve":         runServe,
+	"update":        runUpdate,
+	"walk":          runWalk,
+	"zone":          runZone,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	dnssec := flag.Bool("dnssec", false, "validate the answer with DNSSEC")
+	anchorFile := flag.String(
+		"trust-anchor-file", "",
+		"file that persists the root trust anchor state (RFC 5011)",
+	)
+	rootAnchors := flag.String(
+		"root-anchors", "",
+		"IANA root anchors XML file used to initialize the trust anchor state",
+	)
+	cf := addClientFlags(flag.CommandLine)
+	port := flag.Int("port", 53, "port of the @server name server")
+	subnetFlag := flag.String(
+		"subnet", "",
+		"client subnet (address[/prefix]) to send with the EDNS Client Subnet option; the prefix\n"+
+			"defaults to /24 for IPv4 and /56 for IPv6, and 0.0.0.0/0 opts out of ECS",
+	)
+	jsonOutput := flag.Bool("json", false, "print the response as JSON (RFC 8427)")
+	unicode := flag.Bool(
+		"unicode", false,
+		"print internationalized names with Unicode characters (U-labels) instead of A-labels",
+	)
+	trace := flag.Bool("trace", false, "print every step of the resolution")
+	dump := flag.Bool(
+		"dump", false,
+		"print every raw query and response as an annotated hex dump to stderr",
+	)
+	dnstapDest := flag.String(
+		"dnstap", "",
+		`write every query and response in dnstap format to the file, or to the unix socket with a "unix:" prefix`,
+	)
+	batchFile := flag.String(
+		"f", "",
+		`file with one query ("name [type]") per line to resolve in batch; "-" reads stdin`,
+	)
+	concurrency := flag.Int("c", 10, "max number of concurrent batch queries")
+	watchInterval := flag.Duration(
+		"watch", 0, "re-issue the queries every interval, and report changes",
+	)
+	expect := flag.String(
+		"expect", "",
+		"record data (e.g. an IP address) that stops -watch when it appears",
+	)
+	verbose := flag.Bool(
+		"v", false, "log every query sent to a name server, its response and every referral",
+	)
+	quiet := flag.Bool("q", false, "only log errors")
+	flag.Usage = usage
 	flag.Parse()
 
-	name := flag.Arg(0)
-	qt := dns.TypeA
+	var server string
+	qc := dns.ClassIN
+	var reqs []request
+	if *batchFile == "" {
+		var err error
+		server, qc, reqs, err = parseArgs(flag.Args())
+		if err != nil {
+			usageError(err)
+		}
+		if qc != dns.ClassIN && server == "" {
+			usageError(fmt.Errorf("class %s requires @server", qc))
+		}
+	} else if flag.NArg() > 0 {
+		usageError(fmt.Errorf("-f can't be combined with a query argument"))
+	}
+	if *concurrency < 1 {
+		usageError(fmt.Errorf("-c must be at least 1"))
+	}
+	if *watchInterval > 0 && *batchFile != "" {
+		usageError(fmt.Errorf("-watch can't be combined with -f"))
+	}
+	if *expect != "" && *watchInterval == 0 {
+		usageError(fmt.Errorf("-expect requires -watch"))
+	}
+	if *verbose && *quiet {
+		usageError(fmt.Errorf("-v and -q are mutually exclusive"))
+	}
+	if err := cf.validate(); err != nil {
+		usageError(err)
+	}
+	var subnet *net.IPNet
+	if *subnetFlag != "" {
+		var err error
+		if subnet, err = parseSubnet(*subnetFlag); err != nil {
+			usageError(fmt.Errorf("invalid -subnet: %v", err))
+		}
+	}
+
+	logger := newLogger(os.Stderr, *verbose, *quiet)
+	slog.SetDefault(logger)
+
+	ctx := context.Background()
+	if *trace {
+		ctx = resolver.WithTrace(ctx, newTrace(os.Stdout))
+	}
+
+	opts := []resolver.Option{resolver.WithLogger(logger)}
+	if *watchInterval > 0 {
+		// Every query must reach a name server, to notice changes before cached
+		// answers expire.
+		opts = append(opts, resolver.WithCache(nil))
+	}
+	if subnet != nil {
+		opts = append(opts, resolver.WithClientSubnet(subnet))
+	}
+	transport := resolver.UDP
+	if *dump {
+		transport = resolver.NewTransport(&dumpDialer{out: os.Stderr})
+	}
+	// exit closes the dnstap writer (if any), so the stream is stopped, and
+	// exits with the code.
+	exit := os.Exit
+	if *dnstapDest != "" {
+		w, err := openDnstap(ctx, *dnstapDest)
+		if err != nil {
+			fatal("failed to open dnstap output", "err", err)
+		}
+		exit = func(code int) {
+			if err := w.Close(); err != nil {
+				slog.Error("failed to write dnstap output", "err", err)
+			}
+			os.Exit(code)
+		}
+
+		typ := dnstap.ResolverQuery
+		switch {
+		case server != "":
+			typ = dnstap.ToolQuery
+		case *cf.stub:
+			typ = dnstap.StubQuery
+		}
+		transport = dnstap.NewTransport(transport, w, typ, dnstap.UDP)
+	}
+	if *dump || *dnstapDest != "" {
+		opts = append(opts, resolver.WithTransport(transport))
+	}
+	client, err := cf.newClient(ctx, opts...)
+	if err != nil {
+		fail(err, "failed to create client")
+	}
+
+	if *dnssec && *anchorFile != "" {
+		if err := refreshTrustAnchors(client, *anchorFile, *rootAnchors); err != nil {
+			fatal("failed to refresh trust anchors", "err", err)
+		}
+	}
+
+	// resolve resolves the name, and validates the answer when DNSSEC is
+	// enabled; the DNSSEC status is empty otherwise.
+	resolve := func(
+		ctx context.Context,
+		name string,
+		qt dns.QType,
+	) (*resolver.Result, string, error) {
+		if !*dnssec {
+			result, err := client.ResolveContext(ctx, name, qt)
+			return result, "", err
+		}
+
+		result, status, err := client.ResolveDNSSECContext(ctx, name, qt)
+		if err != nil {
+			return nil, "", err
+		}
+		return result, status.String(), nil
+	}
+
+	if *batchFile != "" {
+		in := os.Stdin
+		if *batchFile != "-" {
+			f, err := os.Open(*batchFile)
+			if err != nil {
+				fatal("failed to open batch file", "err", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		code, err := runBatch(ctx, in, os.Stdout, resolve, *concurrency, *jsonOutput)
+		if err != nil {
+			fatal("failed to read batch file", "err", err)
+		}
+		exit(code)
+	}
+
+	// render renders the response in the output format.
+	render := func(
+		cmd string,
+		msg *dns.Msg,
+		server string,
+		rtt time.Duration,
+		dnssec string,
+	) string {
+		if *unicode {
+			msg = unicodeMsg(msg)
+		}
+		b := new(strings.Builder)
+		if *jsonOutput {
+			j := newJSONMsg(msg, server, rtt)
+			j.DNSSEC = dnssec
+			if err := printJSON(b, j); err != nil {
+				fatal("failed to print json", "err", err)
+			}
+			return b.String()
+		}
+
+		printDig(b, digOutput{
+			cmd:    cmd,
+			msg:    msg,
+			server: server,
+			rtt:    rtt,
+			dnssec: dnssec,
+		})
+		return b.String()
+	}
+
+	// run runs a single request. A query directed at a name server is sent
+	// as-is, bypassing iterative resolution.
+	run := func(r request) outcome {
+		if server != "" {
+			cmd := fmt.Sprintf("@%s %s %s", server, r.name, r.qt)
+			if qc != dns.ClassIN {
+				cmd = fmt.Sprintf("@%s %s %s %s", server, r.name, qc, r.qt)
+			}
+			resp, addr, rtt, err := query(client, server, *port, subnet, qc, r.name, r.qt)
+			if err != nil {
+				return failure(
+					err, "failed to query record(s)",
+					"name", r.name, "qtype", r.qt.String(), "server", server,
+				)
+			}
+			return outcome{
+				out:  render(cmd, resp, addr, rtt, ""),
+				code: rcodeExitCode(resp.RCode),
+			}
+		}
+
+		cmd := fmt.Sprintf("%s %s", r.name, r.qt)
+		result, status, err := resolve(ctx, r.name, r.qt)
+		if err != nil {
+			return failure(
+				err, "failed to resolve record(s)",
+				"name", r.name, "qtype", r.qt.String(),
+			)
+		}
+		return outcome{
+			out: render(cmd, result.Response, resultServer(result), result.RTT, status),
+		}
+	}
+
+	if *watchInterval > 0 {
+		wr := &watcher{
+			w:      os.Stdout,
+			color:  isTerminal(os.Stdout),
+			expect: *expect,
+			fetch: func(r request) ([]dns.RR, error) {
+				if server != "" {
+					resp, _, _, err := query(client, server, *port, subnet, qc, r.name, r.qt)
+					if err != nil {
+						return nil, err
+					}
+					return resp.Answer, nil
+				}
+
+				result, _, err := resolve(ctx, r.name, r.qt)
+				if err != nil {
+					return nil, err
+				}
+				return result.Answer, nil
+			},
+		}
+		exit(wr.watch(reqs, *watchInterval))
+	}
+
+	exit(runAll(reqs, run))
+}
+
+// request is a query for the resource records of a type for a name.
+type request struct {
+	name string
+	qt   dns.QType
+}
+
+// outcome is the outcome of a request.
+type outcome struct {
+	// out is the rendered response.
+	out string
+
+	// errMsg describes the error when the request failed, and errArgs are
+	// the key-value pairs it's logged with.
+	errMsg  string
+	errArgs []interface{}
+
+	// code is the exit code of the request.
+	code int
+}
+
+// failure returns the outcome of a request that failed with the error; it's
+// logged with the message, the key-value pairs and the error.
+func failure(err error, msg string, args ...interface{}) outcome {
+	return outcome{errMsg: msg, errArgs: append(args, "err", err), code: exitCode(err)}
+}
+
+// runAll runs the requests concurrently, and prints their outcomes grouped per
+// request in order. It returns the exit code of the first request that
+// failed, or exitOK when none did.
+func runAll(reqs []request, run func(r request) outcome) int {
+	outcomes := make([]outcome, len(reqs))
+	var wg sync.WaitGroup
+	for i, r := range reqs {
+		wg.Add(1)
+		go func(i int, r request) {
+			defer wg.Done()
+			outcomes[i] = run(r)
+		}(i, r)
+	}
+	wg.Wait()
+
+	code := exitOK
+	for _, o := range outcomes {
+		if o.errMsg != "" {
+			slog.Error(o.errMsg, o.errArgs...)
+		}
+		fmt.Print(o.out)
+		if code == exitOK {
+			code = o.code
+		}
+	}
+
+	return code
+}
+
+// parseArgs parses the positional arguments "[@server] name... [class]
+// [type...]". Every argument that's a resource record type is a type, one that's
+// a class (other than ANY, which is a type) is the class, and any other argument
+// is a name; every name is queried for every type, which defaults to A, in the
+// class, which defaults to IN.
+func parseArgs(args []string) (string, dns.QClass, []request, error) {
+	server := ""
+	qc := dns.ClassIN
+	names, qts := []string{}, []dns.QType{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") {
+			server = strings.TrimPrefix(arg, "@")
+			continue
+		}
+		if qt, ok := parseType(arg); ok {
+			qts = append(qts, qt)
+			continue
+		}
+		if c, ok := parseClass(arg); ok {
+			qc = c
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			return "", 0, nil, fmt.Errorf("flag %s must precede the arguments", arg)
+		}
+		names = append(names, arg)
+	}
+
+	if len(names) == 0 {
+		return "", 0, nil, fmt.Errorf("missing name")
+	}
+	if len(qts) == 0 {
+		qts = append(qts, dns.TypeA)
+	}
+
+	reqs := []request{}
+	for _, name := range names {
+		for _, qt := range qts {
+			reqs = append(reqs, request{name: name, qt: qt})
+		}
+	}
+
+	return server, qc, reqs, nil
+}
+
+// parseQuery parses a query "name [type]". The type defaults to A.
+func parseQuery(args []string) (string, dns.QType, error) {
+	switch len(args) {
+	case 0:
+		return "", 0, fmt.Errorf("missing name")
+	case 1:
+		return args[0], dns.TypeA, nil
+	case 2:
+		qt, ok := parseType(args[1])
+		if !ok {
+			return "", 0, fmt.Errorf("unknown type %q", args[1])
+		}
+		return args[0], qt, nil
+	default:
+		return "", 0, fmt.Errorf("too many arguments: %v", args)
+	}
+}
+
+// parseType parses a resource record type (e.g. "MX") case-insensitively.
+func parseType(s string) (dns.QType, bool) {
+	for t, ts := range dns.TypeToString {
+		if strings.EqualFold(ts, s) {
+			return t, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseClass parses a query class (e.g. "CH") case-insensitively.
+func parseClass(s string) (dns.QClass, bool) {
+	for _, c := range []dns.QClass{dns.ClassIN, dns.ClassCH, dns.ClassHS} {
+		if strings.EqualFold(c.String(), s) {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseSubnet parses a client subnet (e.g. "192.0.2.0/24"), or an IP address
+// that's masked with the default prefix length of its IP version (e.g.
+// "2001:db8::1" becomes "2001:db8::/56").
+func parseSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, subnet, err := net.ParseCIDR(s)
+		return subnet, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	mask := net.CIDRMask(dns.DefaultClientSubnetPrefixIPv6, 8*net.IPv6len)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(dns.DefaultClientSubnetPrefixIPv4, 8*net.IPv4len)
+	}
+
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// query sends a query for the name in the class to the name server (an IP
+// address or a host name) and port, with the client subnet (if any), and
+// returns the response, the address it was sent to, and the round-trip time.
+func query(
+	client *resolver.Client,
+	server string,
+	port int,
+	subnet *net.IPNet,
+	qc dns.QClass,
+	name string,
+	qt dns.QType,
+) (*dns.Msg, string, time.Duration, error) {
+	ctx := context.Background()
 
-	answer, err := resolver.Resolve(name, qt)
+	ip := net.ParseIP(server)
+	if ip == nil {
+		ips, err := client.ResolveHostContext(ctx, server)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("failed to resolve server: %w", err)
+		}
+		ip = ips[0]
+	}
+
+	msg, err := newQuery(name, qt, true)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	msg.Question.QClass = qc
+	if subnet != nil {
+		if err := msg.SetClientSubnet(dns.NewClientSubnet(subnet)); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	start := time.Now()
+	resp, err := client.ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return resp, addr, time.Since(start), nil
+}
+
+// newQuery creates a query for the name and type, which advertises a larger
+// UDP payload size with EDNS(0). When recursive is set, recursion is desired.
+func newQuery(name string, qt dns.QType, recursive bool) (*dns.Msg, error) {
+	name = dns.Fqdn(name)
+
+	msg := new(dns.Msg)
+	if err := msg.SetQuery(name, qt); err != nil {
+		return nil, err
+	}
+	if !recursive {
+		msg.RD = 0
+	}
+	msg.SetEDNS0(dns.DefaultEDNSUDPSize, false)
+
+	return msg, nil
+}
+
+// resultServer returns the IP address of the name server that sent the final
+// response of the result, or "cache" when it was served from the cache.
+func resultServer(r *resolver.Result) string {
+	if r.Server == nil {
+		return "cache"
+	}
+
+	return r.Server.String()
+}
+
+// loadRootHints reads the IP addresses of the root name servers from a root
+// hints file.
+func loadRootHints(path string) ([]net.IP, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Fatalf(
-			"failed to resolve %s record(s) for name %s: %v",
-			qt, name, err,
-		)
+		return nil, err
+	}
+	defer f.Close()
+
+	return resolver.ParseRootHints(f)
+}
+
+// refreshTrustAnchors loads the trust anchor state file (initializing it from
+// the root anchors XML file, or the built-in root trust anchors when it doesn't
+// exist), tracks root key rollovers, and persists the updated state.
+func refreshTrustAnchors(
+	client *resolver.Client,
+	path string,
+	rootAnchorsPath string,
+) error {
+	store, err := trustanchor.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		ds := resolver.RootTrustAnchors()
+		if rootAnchorsPath != "" {
+			f, err := os.Open(rootAnchorsPath)
+			if err != nil {
+				return fmt.Errorf("failed to open root anchors: %v", err)
+			}
+			defer f.Close()
+
+			ds, err = trustanchor.ParseRootAnchors(f, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+		store = trustanchor.New(path, ds)
+	} else if err != nil {
+		return err
+	}
+
+	if err := client.RefreshTrustAnchors(context.Background(), store); err != nil {
+		return err
 	}
 
-	fmt.Println("answer:", answer)
+	return store.Save()
 }
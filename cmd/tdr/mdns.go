@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/resolver"
+)
+
+// mdnsCommands maps an mdns subcommand name to the function that runs it.
+var mdnsCommands = map[string]func(args []string) int{
+	"browse": runMDNSBrowse,
+}
+
+// runMDNS runs "tdr mdns <command> [flags] [args...]", which runs a multicast
+// DNS command on the local link.
+func runMDNS(args []string) int {
+	if len(args) > 0 {
+		if run, ok := mdnsCommands[args[0]]; ok {
+			return run(args[1:])
+		}
+	}
+
+	names := make([]string, 0, len(mdnsCommands))
+	for name := range mdnsCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s mdns <command> [flags] [args...]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+
+	return exitUsage
+}
+
+// runMDNSBrowse runs "tdr mdns browse [flags] [service]", which discovers the
+// instances of the service type (e.g. _http._tcp) on the local link with
+// DNS-based service discovery, or the advertised service types when no
+// service is given.
+func runMDNSBrowse(args []string) int {
+	fs := flag.NewFlagSet("mdns browse", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 2*time.Second, "time to collect the responses of a query")
+	ipv4Only := fs.Bool("4", false, "only query over IPv4")
+	ipv6Only := fs.Bool("6", false, "only query over IPv6")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s mdns browse [flags] [service]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch {
+	case fs.NArg() > 1:
+		err = fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+	case *timeout <= 0:
+		err = fmt.Errorf("-timeout must be positive")
+	case *ipv4Only && *ipv6Only:
+		err = fmt.Errorf("-4 and -6 are mutually exclusive")
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts := []resolver.Option{resolver.WithTimeout(*timeout)}
+	switch {
+	case *ipv4Only:
+		opts = append(opts, resolver.WithIPPreference(resolver.IPv4Only))
+	case *ipv6Only:
+		opts = append(opts, resolver.WithIPPreference(resolver.IPv6Only))
+	}
+	client := resolver.NewClient(opts...)
+
+	if fs.NArg() == 0 {
+		types, err := client.BrowseServiceTypes(context.Background())
+		if err != nil {
+			log.Printf("failed to browse service types: %v", err)
+			return exitFailure
+		}
+		for _, t := range types {
+			fmt.Println(t)
+		}
+		return exitOK
+	}
+
+	instances, err := client.Browse(context.Background(), fs.Arg(0))
+	if err != nil {
+		log.Printf("failed to browse %s: %v", fs.Arg(0), err)
+		return exitFailure
+	}
+	printInstances(os.Stdout, instances)
+
+	return exitOK
+}
+
+// printInstances prints the service instances as a table.
+func printInstances(out io.Writer, instances []*resolver.ServiceInstance) {
+	if len(instances) == 0 {
+		fmt.Fprintln(out, "No instances found")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tHOST\tPORT\tADDRESSES\tTXT")
+	for _, inst := range instances {
+		addrs := make([]string, len(inst.Addrs))
+		for i, ip := range inst.Addrs {
+			addrs[i] = ip.String()
+		}
+		host, port := "-", "-"
+		if inst.Host != "" {
+			host, port = inst.Host, fmt.Sprint(inst.Port)
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\n",
+			inst.Name, host, port, strings.Join(addrs, ","), strings.Join(inst.Text, " "),
+		)
+	}
+	w.Flush()
+}
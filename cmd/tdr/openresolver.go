@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// probe is the outcome of sending a recursive query to a single host.
+type probe struct {
+	// addr is the address of the host.
+	addr string
+
+	// responded is set when the host responded.
+	responded bool
+
+	// rcode is the response code.
+	rcode dns.RCode
+
+	// ra is set when the host claims recursion is available.
+	ra bool
+
+	// answers is the number of resource records in the answer section.
+	answers int
+
+	// amplification is the size of the response divided by the size of the
+	// query.
+	amplification float64
+
+	// err is set when the host responded with an invalid message.
+	err error
+}
+
+// open checks if the host answered the recursive query, i.e. it resolves
+// names for anyone.
+func (p probe) open() bool {
+	return p.responded && p.ra && p.rcode == dns.RCodeNoError && p.answers > 0
+}
+
+// runOpenResolver runs "tdr open-resolver [flags] target...", which sends a
+// recursive query to every address of the targets (an IP address, a CIDR
+// prefix, or a range "first-last"), and reports the hosts that answer it. Open
+// resolvers can be abused to amplify denial of service attacks. It returns
+// exitFailure when any open resolver is found.
+func runOpenResolver(args []string) int {
+	fs := flag.NewFlagSet("open-resolver", flag.ExitOnError)
+	name := fs.String("name", "example.com.", "name to query, which the hosts shouldn't be authoritative for")
+	qtype := fs.String("type", "A", "resource record type to query")
+	port := fs.Int("port", 53, "port to send the queries to")
+	concurrency := fs.Int("c", 100, "max number of concurrent queries")
+	maxAddrs := fs.Int("max", 65536, "max number of addresses to scan")
+	all := fs.Bool("all", false, "also report the hosts that don't respond")
+	timeout := fs.Duration("timeout", time.Second*2, "time to wait for a response")
+	fs.Usage = func() {
+		fmt.Fprintf(
+			fs.Output(),
+			"Usage: %s open-resolver [flags] ip|cidr|first-last...\n\nFlags:\n",
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	qt, ok := parseType(*qtype)
+	var ips []net.IP
+	var err error
+	switch {
+	case !ok:
+		err = fmt.Errorf("invalid type %q", *qtype)
+	case fs.NArg() == 0:
+		err = fmt.Errorf("expected at least one target")
+	case *concurrency < 1:
+		err = fmt.Errorf("-c must be at least 1")
+	case *port < 1 || *port > 65535:
+		err = fmt.Errorf("invalid port %d", *port)
+	default:
+		ips, err = parseTargets(fs.Args(), *maxAddrs)
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	client := resolver.NewClient(resolver.WithTimeout(*timeout))
+
+	probes := make([]probe, len(ips))
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(p *probe, addr string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			*p = probeHost(ctx, client, addr, *name, qt)
+		}(&probes[i], net.JoinHostPort(ip.String(), strconv.Itoa(*port)))
+	}
+	wg.Wait()
+
+	return reportOpenResolvers(os.Stdout, probes, *all)
+}
+
+// parseTargets returns the addresses of the targets, which are IP addresses,
+// CIDR prefixes, or ranges "first-last". It fails when there are more than max
+// addresses, so a typo (e.g. "10.0.0.0/8") doesn't start a huge scan.
+func parseTargets(targets []string, max int) ([]net.IP, error) {
+	ips := []net.IP{}
+	add := func(first, last net.IP) error {
+		if len(first) != len(last) || compareIPs(first, last) > 0 {
+			return fmt.Errorf("invalid range %s-%s", first, last)
+		}
+		for ip := first; ; ip = nextIP(ip) {
+			if len(ips) == max {
+				return fmt.Errorf("more than %d addresses; raise -max to scan them", max)
+			}
+			ips = append(ips, ip)
+			if ip.Equal(last) {
+				return nil
+			}
+		}
+	}
+
+	for _, target := range targets {
+		var err error
+		switch {
+		case strings.Contains(target, "/"):
+			_, ipnet, perr := net.ParseCIDR(target)
+			if perr != nil {
+				return nil, fmt.Errorf("invalid prefix %q", target)
+			}
+			err = add(ipnet.IP, lastIP(ipnet))
+		case strings.Contains(target, "-"):
+			parts := strings.SplitN(target, "-", 2)
+			first, last := parseIP(parts[0]), parseIP(parts[1])
+			if first == nil || last == nil {
+				return nil, fmt.Errorf("invalid range %q", target)
+			}
+			err = add(first, last)
+		default:
+			ip := parseIP(target)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", target)
+			}
+			err = add(ip, ip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ips, nil
+}
+
+// parseIP parses an IP address, and returns IPv4 addresses in their 4-byte
+// representation, so they can be compared with the addresses of a prefix.
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip
+}
+
+// lastIP returns the last address of the prefix.
+func lastIP(ipnet *net.IPNet) net.IP {
+	ip := make(net.IP, len(ipnet.IP))
+	for i := range ip {
+		ip[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+	}
+
+	return ip
+}
+
+// nextIP returns the address that follows the IP address.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+// compareIPs compares two IP addresses of the same length byte by byte.
+func compareIPs(a, b net.IP) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// probeHost sends a recursive query to the host.
+func probeHost(
+	ctx context.Context,
+	client *resolver.Client,
+	addr string,
+	name string,
+	qt dns.QType,
+) probe {
+	p := probe{addr: addr}
+	msg, err := newQuery(name, qt, true)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		p.err = err
+		return p
+	}
+
+	resp, err := client.ExchangeContext(ctx, msg, addr)
+	if errors.Is(err, resolver.ErrTimeout) {
+		return p
+	}
+	p.responded = true
+	if err != nil {
+		p.err = err
+		return p
+	}
+
+	p.rcode = resp.RCode
+	p.ra = resp.RA == 1
+	p.answers = len(resp.Answer)
+	if b, err := resp.Pack(); err == nil {
+		p.amplification = float64(len(b)) / float64(len(query))
+	}
+
+	return p
+}
+
+// reportOpenResolvers prints the hosts that responded (or every host with
+// all), and whether they answered the recursive query. It returns exitFailure
+// when any host is an open resolver.
+func reportOpenResolvers(out io.Writer, probes []probe, all bool) int {
+	open, responded := 0, 0
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tRCODE\tRA\tANSWERS\tAMPLIFICATION")
+	for _, p := range probes {
+		switch {
+		case !p.responded:
+			if all {
+				fmt.Fprintf(w, "%s\tno response\t-\t-\t-\t-\n", p.addr)
+			}
+			continue
+		case p.err != nil:
+			responded++
+			fmt.Fprintf(w, "%s\terror: %v\t-\t-\t-\t-\n", p.addr, p.err)
+			continue
+		}
+
+		responded++
+		status := "closed"
+		if p.open() {
+			open++
+			status = "OPEN"
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%t\t%d\t%.1fx\n",
+			p.addr, status, rcodeMnemonics[p.rcode], p.ra, p.answers, p.amplification,
+		)
+	}
+	w.Flush()
+
+	fmt.Fprintf(
+		out, "\n;; %d open resolvers, %d of %d hosts responded\n",
+		open, responded, len(probes),
+	)
+	if open > 0 {
+		return exitFailure
+	}
+
+	return exitOK
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// capturedExchange is a query and its response, captured in a pcap file.
+type capturedExchange struct {
+	// proto is "udp" or "tcp".
+	proto string
+
+	// client and server are the addresses ("ip:port") of the client and the
+	// name server.
+	client, server string
+
+	// query and resp are the messages; either is nil when it wasn't captured.
+	query, resp *dns.Msg
+
+	// queryTS and respTS are the capture timestamps of the messages.
+	queryTS, respTS time.Time
+}
+
+// runPCAP runs "tdr pcap [flags] file", which extracts the DNS messages of a
+// pcap or pcapng capture file, and prints every query with its response and
+// the time it took.
+func runPCAP(args []string) int {
+	fs := flag.NewFlagSet("pcap", flag.ExitOnError)
+	port := fs.Int("port", 53, "UDP and TCP port of the DNS traffic")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s pcap [flags] file\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single file")
+	case *port < 1 || *port > 65535:
+		err = fmt.Errorf("invalid port %d", *port)
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	in := os.Stdin
+	if file := fs.Arg(0); file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("failed to open capture file: %v", err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+	cr, err := newCaptureReader(in)
+	if err != nil {
+		log.Printf("failed to read capture file: %v", err)
+		return exitFailure
+	}
+
+	exchanges, stats, err := readExchanges(cr, uint16(*port))
+	if err != nil {
+		// The exchanges read until then are still reported, e.g. of a capture
+		// file that's still being written.
+		log.Printf("failed to read capture file: %v", err)
+	}
+	reportPCAP(os.Stdout, exchanges, stats)
+
+	if err != nil {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// pcapStats counts the packets of a capture file.
+type pcapStats struct {
+	packets     int
+	messages    int
+	undecodable int
+}
+
+// readExchanges reads the DNS messages sent to or from the port, and pairs
+// every response with its query by the client and server addresses, the
+// message ID, and the question. It returns the exchanges in the order of their
+// first message.
+func readExchanges(cr captureReader, port uint16) ([]*capturedExchange, pcapStats, error) {
+	stats := pcapStats{}
+	exchanges := []*capturedExchange{}
+	pending := map[string][]*capturedExchange{}
+	streams := map[string]*tcpStream{}
+
+	add := func(s segment, b []byte) {
+		msg := new(dns.Msg)
+		if _, err := msg.Unpack(b); err != nil {
+			stats.undecodable++
+			return
+		}
+		stats.messages++
+
+		client, server := s.srcAddr(), s.dstAddr()
+		if msg.QR == 1 {
+			client, server = server, client
+		}
+		key := strings.Join([]string{
+			s.proto, client, server, strconv.Itoa(int(msg.ID)),
+			strings.ToLower(msg.Question.QName), msg.Question.QType.String(),
+		}, "|")
+
+		if msg.QR == 0 {
+			ex := &capturedExchange{
+				proto:   s.proto,
+				client:  client,
+				server:  server,
+				query:   msg,
+				queryTS: s.ts,
+			}
+			exchanges = append(exchanges, ex)
+			pending[key] = append(pending[key], ex)
+			return
+		}
+
+		if exs := pending[key]; len(exs) > 0 {
+			exs[0].resp, exs[0].respTS = msg, s.ts
+			pending[key] = exs[1:]
+			return
+		}
+		exchanges = append(exchanges, &capturedExchange{
+			proto:  s.proto,
+			client: client,
+			server: server,
+			resp:   msg,
+			respTS: s.ts,
+		})
+	}
+
+	for {
+		p, err := cr.next()
+		if errors.Is(err, io.EOF) {
+			return exchanges, stats, nil
+		}
+		if err != nil {
+			return exchanges, stats, err
+		}
+		stats.packets++
+
+		s, ok := decodePacket(p)
+		if !ok || (s.sport != port && s.dport != port) {
+			continue
+		}
+		if s.proto == "udp" {
+			add(s, s.payload)
+			continue
+		}
+
+		flow := s.srcAddr() + ">" + s.dstAddr()
+		stream, ok := streams[flow]
+		if !ok {
+			stream = &tcpStream{}
+			streams[flow] = stream
+		}
+		for _, b := range stream.add(s) {
+			add(s, b)
+		}
+	}
+}
+
+// reportPCAP prints every exchange, with the question, the response code and
+// answers of the response, and the time between the query and the response.
+func reportPCAP(out io.Writer, exchanges []*capturedExchange, stats pcapStats) {
+	unanswered := 0
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPROTO\tCLIENT\tSERVER\tID\tQUESTION\tRCODE\tRTT\tANSWER")
+	for _, ex := range exchanges {
+		msg, ts := ex.query, ex.queryTS
+		if msg == nil {
+			msg, ts = ex.resp, ex.respTS
+		}
+
+		rcode, rtt, answer := "-", "no response", "-"
+		if ex.resp != nil {
+			var ok bool
+			if rcode, ok = rcodeMnemonics[ex.resp.RCode]; !ok {
+				rcode = ex.resp.RCode.String()
+			}
+			rtt = "no query"
+			if ex.query != nil {
+				rtt = ex.respTS.Sub(ex.queryTS).Round(time.Microsecond).String()
+			}
+			rds := []string{}
+			for _, rr := range ex.resp.Answer {
+				rds = append(rds, rr.Type.String()+" "+rr.RDataUnpacked)
+			}
+			answer = strings.Join(rds, ", ")
+		} else {
+			unanswered++
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%d\t%s %s\t%s\t%s\t%s\n",
+			ts.Format("2006-01-02 15:04:05.000000"), ex.proto, ex.client, ex.server,
+			msg.ID, msg.Question.QName, msg.Question.QType, rcode, rtt, answer,
+		)
+	}
+	w.Flush()
+
+	fmt.Fprintf(
+		out, "\n;; %d packets, %d DNS messages (%d undecodable), %d exchanges, %d unanswered\n",
+		stats.packets, stats.messages+stats.undecodable, stats.undecodable,
+		len(exchanges), unanswered,
+	)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// publicResolvers are well known public recursive resolvers.
+var publicResolvers = []string{
+	"1.1.1.1",        // Cloudflare
+	"8.8.8.8",        // Google
+	"9.9.9.9",        // Quad9
+	"208.67.222.222", // OpenDNS
+}
+
+// propagation is what a single name server returned for the record set.
+type propagation struct {
+	// server is the name of the name server (or the address of a resolver).
+	server string
+
+	// addr is the IP address of the name server.
+	addr net.IP
+
+	// authoritative is set for the authoritative name servers of the zone.
+	authoritative bool
+
+	// serial is the SOA serial of the zone; it's only valid when hasSerial is
+	// set.
+	serial    uint32
+	hasSerial bool
+
+	// rrset holds the sorted record data of the record set.
+	rrset []string
+
+	// err is set when the name server didn't respond.
+	err error
+}
+
+// runPropagate runs "tdr propagate [flags] name [type]", which queries all
+// authoritative name servers of the zone of the name (and optionally public
+// resolvers) in parallel, and reports which ones serve the latest serial and
+// record set.
+func runPropagate(args []string) int {
+	fs := flag.NewFlagSet("propagate", flag.ExitOnError)
+	resolvers := fs.String(
+		"resolvers", "", "comma separated IP addresses of recursive resolvers to check",
+	)
+	public := fs.Bool("public", false, "check well known public resolvers as well")
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s propagate [flags] name [type]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name, qt, err := parseQuery(fs.Args())
+	if err == nil {
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	name = dns.Fqdn(name)
+
+	recursive := []string{}
+	if *resolvers != "" {
+		recursive = append(recursive, strings.Split(*resolvers, ",")...)
+	}
+	if *public {
+		recursive = append(recursive, publicResolvers...)
+	}
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	zone, nss, err := findZone(ctx, client, name)
+	if err != nil {
+		log.Printf("failed to find the zone of %s: %v", name, err)
+		return exitCode(err)
+	}
+
+	// Every address of every authoritative name server is checked, since the
+	// addresses may be served by different hosts (e.g. behind anycast).
+	targets := []propagation{}
+	for _, ns := range nss {
+		ips, err := client.ResolveHostContext(ctx, ns)
+		if err != nil {
+			targets = append(targets, propagation{server: ns, authoritative: true, err: err})
+			continue
+		}
+		for _, ip := range ips {
+			targets = append(targets, propagation{server: ns, addr: ip, authoritative: true})
+		}
+	}
+	for _, r := range recursive {
+		ip := net.ParseIP(strings.TrimSpace(r))
+		if ip == nil {
+			log.Printf("invalid resolver address %q", r)
+			return exitUsage
+		}
+		targets = append(targets, propagation{server: ip.String(), addr: ip})
+	}
+
+	var wg sync.WaitGroup
+	for i := range targets {
+		if targets[i].err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(p *propagation) {
+			defer wg.Done()
+			checkPropagation(ctx, client, p, zone, name, qt)
+		}(&targets[i])
+	}
+	wg.Wait()
+
+	return reportPropagation(os.Stdout, zone, name, qt, targets)
+}
+
+// findZone finds the zone of the name, i.e. the closest enclosing name that
+// has NS resource records, and returns it with the names of its authoritative
+// name servers.
+func findZone(
+	ctx context.Context,
+	client *resolver.Client,
+	name string,
+) (string, []string, error) {
+	for zone := name; ; {
+		nss, err := client.LookupNS(ctx, zone)
+		if err == nil && len(nss) > 0 {
+			names := []string{}
+			for _, ns := range nss {
+				names = append(names, ns.Host)
+			}
+			sort.Strings(names)
+			return zone, names, nil
+		}
+		if err != nil && !errors.Is(err, resolver.ErrNoData) &&
+			!errors.Is(err, resolver.ErrNXDomain) {
+			return "", nil, err
+		}
+		if zone == "." {
+			return "", nil, fmt.Errorf("no name servers found")
+		}
+
+		zone = dns.ParentDomainName(zone)
+	}
+}
+
+// checkPropagation queries the name server of the propagation for the SOA
+// serial of the zone, and for the record set.
+func checkPropagation(
+	ctx context.Context,
+	client *resolver.Client,
+	p *propagation,
+	zone string,
+	name string,
+	qt dns.QType,
+) {
+	addr := net.JoinHostPort(p.addr.String(), "53")
+
+	soa, err := exchange(ctx, client, addr, zone, dns.TypeSOA, !p.authoritative)
+	if err != nil {
+		p.err = err
+		return
+	}
+	p.serial, p.hasSerial = soaSerial(soa)
+
+	resp, err := exchange(ctx, client, addr, name, qt, !p.authoritative)
+	if err != nil {
+		p.err = err
+		return
+	}
+	if resp.RCode != dns.RCodeNoError && resp.RCode != dns.RCodeNameError {
+		p.err = fmt.Errorf("%s", rcodeMnemonics[resp.RCode])
+		return
+	}
+	p.rrset = []string{}
+	for _, rr := range resp.Answer {
+		if rr.Type == qt {
+			p.rrset = append(p.rrset, rr.RDataUnpacked)
+		}
+	}
+	sort.Strings(p.rrset)
+}
+
+// exchange sends a query for the name and type to the name server address.
+func exchange(
+	ctx context.Context,
+	client *resolver.Client,
+	addr string,
+	name string,
+	qt dns.QType,
+	recursive bool,
+) (*dns.Msg, error) {
+	msg, err := newQuery(name, qt, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.ExchangeContext(ctx, msg, addr)
+}
+
+// soaSerial returns the serial of the SOA resource record in the answer of the
+// message, and reports if there is one.
+func soaSerial(m *dns.Msg) (uint32, bool) {
+	for _, rr := range m.Answer {
+		if rr.Type != dns.TypeSOA {
+			continue
+		}
+		fields := strings.Fields(rr.RDataUnpacked)
+		if len(fields) < 3 {
+			continue
+		}
+		if serial, err := strconv.ParseUint(fields[2], 10, 32); err == nil {
+			return uint32(serial), true
+		}
+	}
+
+	return 0, false
+}
+
+// serialLess compares SOA serials using serial number arithmetic, so serials
+// that wrapped around are still ordered correctly.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1982#section-3.2
+func serialLess(a uint32, b uint32) bool {
+	return a != b && b-a < 1<<31
+}
+
+// reportPropagation prints which name servers serve the latest serial and
+// record set, where the latest is served by the authoritative name server
+// with the highest serial. It returns exitOK when all name servers are
+// current.
+func reportPropagation(
+	out io.Writer,
+	zone string,
+	name string,
+	qt dns.QType,
+	targets []propagation,
+) int {
+	var latest *propagation
+	for i, p := range targets {
+		if !p.authoritative || p.err != nil || !p.hasSerial {
+			continue
+		}
+		if latest == nil || serialLess(latest.serial, p.serial) {
+			latest = &targets[i]
+		}
+	}
+
+	fmt.Fprintf(out, ";; %s %s in zone %s\n", name, qt, zone)
+	if latest != nil {
+		fmt.Fprintf(out, ";; latest serial %d served by %s\n\n", latest.serial, latest.server)
+	}
+
+	code := exitOK
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tADDRESS\tSERIAL\tSTATUS\tRECORDS")
+	for _, p := range targets {
+		addr := "-"
+		if p.addr != nil {
+			addr = p.addr.String()
+		}
+		serial := "-"
+		if p.hasSerial {
+			serial = strconv.FormatUint(uint64(p.serial), 10)
+		}
+
+		status := "current"
+		switch {
+		case p.err != nil:
+			status = "error: " + p.err.Error()
+		case latest == nil:
+			status = "unknown"
+		case p.authoritative && p.hasSerial && serialLess(p.serial, latest.serial):
+			status = "outdated"
+		case !equalStrings(p.rrset, latest.rrset):
+			status = "outdated"
+		}
+		if status != "current" {
+			code = exitFailure
+		}
+
+		records := strings.Join(p.rrset, ", ")
+		if p.err == nil && len(p.rrset) == 0 {
+			records = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.server, addr, serial, status, records)
+	}
+	w.Flush()
+
+	return code
+}
@@ -0,0 +1,1117 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/metrics"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/server"
+	"github.com/danillouz/tdr/zone"
+)
+
+// runServe runs "tdr serve [flags]", which answers queries over UDP and TCP
+// (and over TLS and HTTPS, with -tls and -https) until it's interrupted: authoritatively for the names in the zone files and
+// in the zones transferred from primaries (with -secondary), by resolving them
+// like a recursive resolver (with -recursive), or by relaying them to upstream
+// resolvers (with -forward). Clients in the networks of a view (-view) are
+// served the zones and upstreams of the view instead. The clients whose
+// queries are answered, resolved or forwarded, and that may transfer zones are
+// restricted with the -allow and -deny flags, and the rate of responses over UDP
+// is limited with -rrl. The zone files are reloaded on SIGHUP, and the
+// secondaries (-notify) are notified of the zones that changed. Prometheus
+// metrics are exported over HTTP with -metrics, queries for the names on the
+// blocklists of -blocklist are blocked, the policies of the response policy
+// zones of -rpz are applied, names with records in the files of -local are
+// answered from them (the -rpz and -local files are reloaded on SIGHUP as
+// well), queries are logged with
+// -query-log, and the server can be diagnosed with the debug endpoints of
+// -debug.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	zoneFiles := []string{}
+	fs.Func("zone", "zone file to serve; repeat the flag to serve more zones", func(s string) error {
+		zoneFiles = append(zoneFiles, s)
+		return nil
+	})
+	secondaries := []secondaryZone{}
+	fs.Func(
+		"secondary",
+		"zone to transfer from its primaries and serve: origin=ip[:port][,ip[:port]...];\n"+
+			"repeat the flag to serve more zones",
+		func(s string) error {
+			z, err := parseSecondary(s)
+			if err != nil {
+				return err
+			}
+			secondaries = append(secondaries, z)
+			return nil
+		},
+	)
+	notify := []string{}
+	fs.Func(
+		"notify",
+		"secondary to notify when the zone files are loaded or changed: ip[:port];\n"+
+			"repeat the flag to notify more secondaries",
+		func(s string) error {
+			addr, err := parseServerAddr(s)
+			if err != nil {
+				return err
+			}
+			notify = append(notify, addr)
+			return nil
+		},
+	)
+	// The rules of the access control lists apply in the order of the flags.
+	queryACL, recursionACL, transferACL := server.NewACL(), server.NewACL(), server.NewACL()
+	transfers := []*net.IPNet{}
+	fs.Func(
+		"allow-query",
+		"network of clients whose queries are answered: [listener:]cidr, where listener is udp, tcp, tls or https;\n"+
+			"when set, other clients are refused; repeat the flag to allow more networks",
+		aclFlag(queryACL, true, nil),
+	)
+	fs.Func(
+		"deny-query",
+		"network of clients whose queries are refused: [listener:]cidr; repeat the flag to deny more networks",
+		aclFlag(queryACL, false, nil),
+	)
+	fs.Func(
+		"allow-recursion",
+		"network of clients whose queries are resolved or forwarded: [listener:]cidr (with -recursive, -forward\n"+
+			"or -view-forward); when set, other clients are refused; repeat the flag to allow more networks",
+		aclFlag(recursionACL, true, nil),
+	)
+	fs.Func(
+		"deny-recursion",
+		"network of clients whose queries aren't resolved or forwarded: [listener:]cidr; repeat the flag to deny more networks",
+		aclFlag(recursionACL, false, nil),
+	)
+	fs.Func(
+		"allow-transfer",
+		"network of clients that may transfer the served zones: [listener:]cidr; repeat the flag to allow more networks",
+		aclFlag(transferACL, true, &transfers),
+	)
+	fs.Func(
+		"deny-transfer",
+		"network of clients that may not transfer the served zones: [listener:]cidr; repeat the flag to deny more networks",
+		aclFlag(transferACL, false, nil),
+	)
+	addr := fs.String("addr", ":53", "address to listen on over UDP and TCP")
+	httpsAddr := fs.String(
+		"https", "",
+		"address to listen on for DNS over HTTPS queries at "+server.DefaultHTTPPath+" (e.g. :443); requires -tls-cert and -tls-key",
+	)
+	tlsAddr := fs.String(
+		"tls", "",
+		"address to listen on for DNS over TLS queries (e.g. :853); requires -tls-cert and -tls-key",
+	)
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file (PEM) of the server (with -tls or -https)")
+	tlsKey := fs.String("tls-key", "", "TLS private key file (PEM) of the server (with -tls or -https)")
+	maxConns := fs.Int("max-conns", 0, "max number of open TCP and TLS connections; 0 means no limit")
+	maxUDPQueries := fs.Int(
+		"max-udp-queries", server.DefaultMaxUDPQueries,
+		"max number of UDP queries that are handled concurrently; more are dropped",
+	)
+	idleTimeout := fs.Duration(
+		"idle-timeout", server.DefaultIdleTimeout,
+		"time an idle TCP, TLS or HTTPS connection is kept open",
+	)
+	recursive := fs.Bool("recursive", false, "resolve queries iteratively instead of serving zones")
+	upstreams := []server.Upstream{}
+	fs.Func(
+		"forward",
+		"upstream resolver to relay queries to: ip[:port] (UDP), tls://host[:port] or an https:// URL;\n"+
+			"repeat the flag to forward to more upstreams",
+		func(s string) error {
+			u, err := parseUpstream(s)
+			if err != nil {
+				return err
+			}
+			upstreams = append(upstreams, u)
+			return nil
+		},
+	)
+	views := []viewConfig{}
+	fs.Func(
+		"view",
+		"view of the clients in the networks: name=cidr[,cidr...]; views are matched in order,\n"+
+			"and clients that match none are served by -zone, -secondary, -recursive or -forward (if any);\n"+
+			"repeat the flag to add more views",
+		func(s string) error {
+			v, err := parseView(s)
+			if err != nil {
+				return err
+			}
+			views = append(views, v)
+			return nil
+		},
+	)
+	viewZones := map[string][]string{}
+	fs.Func(
+		"view-zone",
+		"zone file to serve in a view: name=file; repeat the flag to serve more zones",
+		func(s string) error {
+			name, file, err := parseViewArg(s)
+			if err != nil {
+				return err
+			}
+			viewZones[name] = append(viewZones[name], file)
+			return nil
+		},
+	)
+	viewUpstreams := map[string][]server.Upstream{}
+	fs.Func(
+		"view-forward",
+		"upstream resolver to relay the queries of a view to (see -forward): name=upstream;\n"+
+			"queries for names outside the zones of the view are relayed; repeat the flag to forward to more upstreams",
+		func(s string) error {
+			name, addr, err := parseViewArg(s)
+			if err != nil {
+				return err
+			}
+			u, err := parseUpstream(addr)
+			if err != nil {
+				return err
+			}
+			viewUpstreams[name] = append(viewUpstreams[name], u)
+			return nil
+		},
+	)
+	policy := fs.String("policy", "round-robin", "order in which upstreams are tried: round-robin or fastest (with -forward)")
+	healthCheck := fs.Duration(
+		"health-check", time.Second*10,
+		"interval at which upstreams are checked; 0 disables health checks (with -forward)",
+	)
+	cacheSize := fs.Int(
+		"cache-size", resolver.DefaultCacheSize,
+		"max number of cached responses shared by all queries (with -recursive or -forward)",
+	)
+	prefetch := fs.Int(
+		"prefetch", 0,
+		"refresh cached responses served within the last percent of their TTL (with -recursive or -forward)",
+	)
+	timeout := fs.Duration(
+		"timeout", time.Second*5,
+		"time to wait for a name server response (with -recursive, -forward or -secondary)",
+	)
+	blocklists := []string{}
+	fs.Func(
+		"blocklist",
+		"file or http(s):// URL of a list of names to block, in hosts format or with a name per line;\n"+
+			"repeat the flag to load more lists",
+		func(s string) error {
+			blocklists = append(blocklists, s)
+			return nil
+		},
+	)
+	blockMode := fs.String(
+		"block-mode", server.BlockNXDomain.String(),
+		"how queries for blocked names are answered: nxdomain, or null (0.0.0.0 and ::)",
+	)
+	blocklistRefresh := fs.Duration(
+		"blocklist-refresh", time.Hour*24,
+		"interval at which the blocklists are reloaded; 0 disables reloading",
+	)
+	rpzFiles := []string{}
+	fs.Func(
+		"rpz",
+		"response policy zone file to apply to queries; repeat the flag to apply more zones,\n"+
+			"in order of precedence",
+		func(s string) error {
+			rpzFiles = append(rpzFiles, s)
+			return nil
+		},
+	)
+	localFiles := []string{}
+	fs.Func(
+		"local",
+		"file of resource records (in zone file format) that are answered instead of resolved or served;\n"+
+			"repeat the flag to load more files",
+		func(s string) error {
+			localFiles = append(localFiles, s)
+			return nil
+		},
+	)
+	rrlResponses := fs.Float64(
+		"rrl", 0,
+		"max number of identical responses per second to a client network over UDP; 0 disables response rate limiting",
+	)
+	rrlNXDomains := fs.Float64("rrl-nxdomains", 0, "max number of NXDOMAIN responses per second of a zone (with -rrl); 0 means -rrl")
+	rrlErrors := fs.Float64("rrl-errors", 0, "max number of error responses per second (with -rrl); 0 means -rrl")
+	rrlSlip := fs.Int(
+		"rrl-slip", server.DefaultRRLSlip,
+		"number of limited responses per truncated response that's sent instead (with -rrl); 0 drops all of them",
+	)
+	queryLog := fs.String("query-log", "", `file to log every query to; "-" logs to stdout`)
+	queryLogFormat := fs.String("query-log-format", "text", "format of the query log: text or json")
+	queryLogSample := fs.Float64(
+		"query-log-sample", 1,
+		"fraction of the queries that are logged, between 0 and 1",
+	)
+	queryLogMaxSize := fs.Int64(
+		"query-log-max-size", 100,
+		"size in MB at which the query log file is rotated; 0 disables rotation",
+	)
+	queryLogBackups := fs.Int("query-log-backups", 5, "number of rotated query log files that are kept")
+	metricsAddr := fs.String(
+		"metrics", "",
+		"address to listen on for Prometheus metrics requests at "+metricsPath+" (e.g. :9153)",
+	)
+	debugAddr := fs.String(
+		"debug", "",
+		"address to listen on for debug requests: runtime, resolver and cache statistics at /debug/vars,\n"+
+			"and pprof profiles at /debug/pprof/ (e.g. localhost:6060)",
+	)
+	chaosVersion := fs.String("chaos-version", "", "text of version.bind CH TXT queries; they're refused when it's empty")
+	chaosHostname := fs.String("chaos-hostname", "", "text of hostname.bind CH TXT queries; they're refused when it's empty")
+	chaosID := fs.String("chaos-id", "", "text of id.server CH TXT queries; they're refused when it's empty")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			fs.Output(),
+			"Usage: %s serve [flags] [-zone file ...] [-secondary origin=primary ...]\n"+
+				"       %s serve [flags] -recursive\n"+
+				"       %s serve [flags] -forward upstream [-forward upstream ...]\n"+
+				"       %s serve [flags] -view name=cidr -view-zone name=file|-view-forward name=upstream ...\n\n"+
+				"The origin of a zone is the owner of its SOA record; names in the file\n"+
+				"must be fully qualified, or relative to a $ORIGIN. Send SIGHUP to reload\n"+
+				"the zone files.\n\nFlags:\n",
+			os.Args[0], os.Args[0], os.Args[0], os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	modes := 0
+	for _, set := range []bool{len(zoneFiles) > 0 || len(secondaries) > 0, *recursive, len(upstreams) > 0} {
+		if set {
+			modes++
+		}
+	}
+	policies := map[string]server.Policy{
+		server.PolicyRoundRobin.String(): server.PolicyRoundRobin,
+		server.PolicyFastest.String():    server.PolicyFastest,
+	}
+	p, ok := policies[*policy]
+	formats := map[string]server.QueryLogFormat{
+		server.QueryLogText.String(): server.QueryLogText,
+		server.QueryLogJSON.String(): server.QueryLogJSON,
+	}
+	qlf, qlfOK := formats[*queryLogFormat]
+	blockModes := map[string]server.BlockMode{
+		server.BlockNXDomain.String(): server.BlockNXDomain,
+		server.BlockNullIP.String():   server.BlockNullIP,
+	}
+	bm, bmOK := blockModes[*blockMode]
+	viewNames := map[string]bool{}
+	for _, v := range views {
+		viewNames[v.name] = true
+	}
+	var viewErr error
+	for name := range viewZones {
+		if !viewNames[name] {
+			viewErr = fmt.Errorf("-view-zone refers to undefined view %q", name)
+		}
+	}
+	for name := range viewUpstreams {
+		if !viewNames[name] {
+			viewErr = fmt.Errorf("-view-forward refers to undefined view %q", name)
+		}
+	}
+	for _, v := range views {
+		if len(viewZones[v.name]) == 0 && len(viewUpstreams[v.name]) == 0 {
+			viewErr = fmt.Errorf("view %q has no -view-zone or -view-forward", v.name)
+		}
+	}
+
+	var err error
+	switch {
+	case fs.NArg() > 0:
+		err = fmt.Errorf("unexpected arguments: %v", fs.Args())
+	case modes > 1:
+		err = fmt.Errorf("-zone or -secondary, -recursive and -forward are mutually exclusive")
+	case modes == 0 && len(views) == 0:
+		err = fmt.Errorf("expected at least one zone file, -secondary, -recursive, -forward or -view")
+	case len(viewNames) < len(views):
+		err = fmt.Errorf("views must have unique names")
+	case viewErr != nil:
+		err = viewErr
+	case !ok:
+		err = fmt.Errorf("unsupported policy %q", *policy)
+	case *healthCheck < 0:
+		err = fmt.Errorf("-health-check must not be negative")
+	case *timeout <= 0:
+		err = fmt.Errorf("-timeout must be positive")
+	case *cacheSize < 0:
+		err = fmt.Errorf("-cache-size must not be negative")
+	case *prefetch < 0 || *prefetch > 100:
+		err = fmt.Errorf("-prefetch must be a percentage between 0 and 100")
+	case (*httpsAddr != "" || *tlsAddr != "") && (*tlsCert == "" || *tlsKey == ""):
+		err = fmt.Errorf("-tls and -https require -tls-cert and -tls-key")
+	case *maxConns < 0:
+		err = fmt.Errorf("-max-conns must not be negative")
+	case *maxUDPQueries <= 0:
+		err = fmt.Errorf("-max-udp-queries must be positive")
+	case *idleTimeout <= 0:
+		err = fmt.Errorf("-idle-timeout must be positive")
+	case !bmOK:
+		err = fmt.Errorf("unsupported block mode %q", *blockMode)
+	case *blocklistRefresh < 0:
+		err = fmt.Errorf("-blocklist-refresh must not be negative")
+	case *rrlResponses < 0 || *rrlNXDomains < 0 || *rrlErrors < 0:
+		err = fmt.Errorf("-rrl, -rrl-nxdomains and -rrl-errors must not be negative")
+	case *rrlSlip < 0:
+		err = fmt.Errorf("-rrl-slip must not be negative")
+	case !qlfOK:
+		err = fmt.Errorf("unsupported query log format %q", *queryLogFormat)
+	case *queryLogSample < 0 || *queryLogSample > 1:
+		err = fmt.Errorf("-query-log-sample must be between 0 and 1")
+	case *queryLogMaxSize < 0:
+		err = fmt.Errorf("-query-log-max-size must not be negative")
+	case *queryLogBackups < 0:
+		err = fmt.Errorf("-query-log-backups must not be negative")
+	default:
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The metrics record the queries sent to the upstreams (or the name
+	// servers queried by the recursive resolver) as well.
+	var registry *metrics.Registry
+	var sm *metrics.ServerMetrics
+	if *metricsAddr != "" {
+		registry = metrics.NewRegistry()
+		sm = metrics.NewServerMetrics(registry)
+	}
+
+	// The responses of the forwarder and the recursive resolver are cached in
+	// a cache that's shared by all listeners; the recursive resolver caches
+	// the answers and delegations it learns as well, and refreshes its
+	// answers when the cached responses are refreshed.
+	var handler server.Handler
+	var cache *server.ResponseCache
+	var recursiveClient *resolver.Client
+	switch {
+	case len(upstreams) > 0:
+		if sm != nil {
+			for i, u := range upstreams {
+				upstreams[i].Transport = sm.Transport(u.Transport, u.Addr)
+			}
+		}
+		f := server.NewForwarder(p, *timeout, upstreams...)
+		if *healthCheck > 0 {
+			go f.HealthCheck(ctx, *healthCheck)
+		}
+		cache = server.NewResponseCache(*cacheSize)
+		cache.Prefetch = *prefetch
+		handler = server.Chain(f, recursionACL.Middleware(), cache.Middleware())
+		log.Printf("forwarding queries on %s to %d upstreams (%s)", *addr, len(upstreams), p)
+	case *recursive:
+		opts := []resolver.Option{
+			resolver.WithTimeout(*timeout),
+			resolver.WithCache(resolver.NewCache(*cacheSize)),
+			resolver.WithPrefetch(*prefetch),
+		}
+		if sm != nil {
+			opts = append(opts, resolver.WithTransport(sm.Transport(resolver.UDP, "recursive")))
+		}
+		client, err := cf.newClient(ctx, opts...)
+		if err != nil {
+			log.Print(err)
+			return exitFailure
+		}
+		recursiveClient = client
+		cache = server.NewResponseCache(*cacheSize)
+		cache.Prefetch = *prefetch
+		handler = server.Chain(server.NewRecursive(client), recursionACL.Middleware(), cache.Middleware())
+		log.Printf("resolving queries on %s", *addr)
+	case len(zoneFiles) > 0 || len(secondaries) > 0:
+		zones, err := loadZones(zoneFiles)
+		if err != nil {
+			log.Printf("failed to load zone: %v", err)
+			return exitFailure
+		}
+		authority := server.NewAuthority()
+		authority.AllowTransfer(transfers...)
+		var client *resolver.Client
+		if len(secondaries) > 0 || len(notify) > 0 {
+			client, err = cf.newClient(ctx, resolver.WithTimeout(*timeout))
+			if err != nil {
+				log.Print(err)
+				return exitFailure
+			}
+		}
+		notifyZones(ctx, client, authority.Reload(zones...), notify)
+		if len(zoneFiles) > 0 {
+			go reloadZones(ctx, authority, zoneFiles, client, notify)
+		}
+		if len(secondaries) == 0 {
+			handler = authority
+			log.Printf("serving %d zones on %s", len(zones), *addr)
+			break
+		}
+
+		// Zones added by a reload are served by the authority as well.
+		mux := server.NewServeMux()
+		mux.Handle(".", authority)
+		origins := map[string]bool{}
+		for _, z := range zones {
+			mux.Handle(z.Origin, authority)
+			origins[strings.ToLower(z.Origin)] = true
+		}
+		for _, sz := range secondaries {
+			sec := server.NewSecondary(client, sz.origin, sz.primaries...)
+			if origins[sec.Origin()] {
+				log.Printf("zone %s is served more than once", sec.Origin())
+				return exitFailure
+			}
+			origins[sec.Origin()] = true
+			sec.Log = log.Default()
+			sec.AllowTransfer(transfers...)
+			mux.Handle(sec.Origin(), sec)
+			go sec.Run(ctx)
+		}
+		handler = mux
+		log.Printf("serving %d zones and %d secondary zones on %s", len(zones), len(secondaries), *addr)
+	}
+
+	// The clients that match no view are served by the handler of the other
+	// flags, if any.
+	if len(views) > 0 {
+		vs := server.NewViews()
+		for _, v := range views {
+			vh, err := newViewHandler(ctx, v.name, viewZones[v.name], viewUpstreams[v.name], viewOptions{
+				transfers:   transfers,
+				recursion:   recursionACL,
+				policy:      p,
+				timeout:     *timeout,
+				healthCheck: *healthCheck,
+				cacheSize:   *cacheSize,
+				prefetch:    *prefetch,
+				metrics:     sm,
+			})
+			if err != nil {
+				log.Print(err)
+				return exitFailure
+			}
+			vs.Handle(v.name, vh, v.nets...)
+			log.Printf("serving view %s on %s to %d networks", v.name, *addr, len(v.nets))
+		}
+		if handler != nil {
+			_, all4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, all6, _ := net.ParseCIDR("::/0")
+			vs.Handle("default", handler, all4, all6)
+		}
+		handler = vs
+	}
+
+	if *chaosVersion != "" || *chaosHostname != "" || *chaosID != "" {
+		handler = server.Chain(handler, server.Chaos(map[string]string{
+			server.VersionBind:  *chaosVersion,
+			server.HostnameBind: *chaosHostname,
+			server.IDServer:     *chaosID,
+		}))
+	}
+
+	// Queries for blocked names are answered before they reach the cache, so
+	// the cache never holds blocked responses.
+	var blocklist *server.Blocklist
+	if len(blocklists) > 0 {
+		blocklist = server.NewBlocklist(blocklists...)
+		blocklist.Mode = bm
+		blocklist.Log = log.Default()
+		if err := blocklist.Load(ctx); err != nil {
+			log.Print(err)
+			return exitFailure
+		}
+		log.Printf("blocking %d names from %d blocklists", blocklist.Stats().Names, len(blocklists))
+		if *blocklistRefresh > 0 {
+			go blocklist.Run(ctx, *blocklistRefresh)
+		}
+		handler = server.Chain(handler, blocklist.Middleware())
+	}
+
+	// The response policy zones precede the blocklists, so their PASSTHRU
+	// rules can exempt blocked names.
+	var rpz *server.RPZ
+	if len(rpzFiles) > 0 {
+		zones, err := loadZones(rpzFiles)
+		if err == nil {
+			rpz, err = server.NewRPZ(zones...)
+		}
+		if err != nil {
+			log.Printf("failed to load response policy zone: %v", err)
+			return exitFailure
+		}
+		log.Printf("applying %d rules from %d response policy zones", rpz.Stats().Rules, len(zones))
+		go onHangup(ctx, func() {
+			zones, err := loadZones(rpzFiles)
+			if err == nil {
+				err = rpz.Reload(zones...)
+			}
+			if err != nil {
+				log.Printf("failed to reload response policy zones: %v", err)
+				return
+			}
+			log.Printf("reloaded %d response policy zones (%d rules)", len(zones), rpz.Stats().Rules)
+		})
+		handler = server.Chain(handler, rpz.Middleware())
+	}
+
+	// The local records take precedence over any policy.
+	if len(localFiles) > 0 {
+		rrs, err := loadLocalRecords(localFiles)
+		if err != nil {
+			log.Printf("failed to load local records: %v", err)
+			return exitFailure
+		}
+		local := server.NewLocalRecords(rrs...)
+		log.Printf("answering %d names from local records", local.Stats().Names)
+		go onHangup(ctx, func() {
+			rrs, err := loadLocalRecords(localFiles)
+			if err != nil {
+				log.Printf("failed to reload local records: %v", err)
+				return
+			}
+			local.Set(rrs...)
+			log.Printf("reloaded local records of %d names", local.Stats().Names)
+		})
+		handler = server.Chain(handler, local.Middleware())
+	}
+	handler = server.Chain(handler, queryACL.Middleware(), transferACL.Middleware(dns.TypeAXFR, dns.TypeIXFR))
+
+	// The rate limit applies to all responses, including refused ones.
+	var rrl *server.RRL
+	if *rrlResponses > 0 {
+		nxdomainRate, errorRate := *rrlNXDomains, *rrlErrors
+		if nxdomainRate == 0 {
+			nxdomainRate = *rrlResponses
+		}
+		if errorRate == 0 {
+			errorRate = *rrlResponses
+		}
+		rrl = server.NewRRL(*rrlResponses, nxdomainRate, errorRate)
+		rrl.Slip = *rrlSlip
+		handler = server.Chain(handler, rrl.Middleware())
+	}
+
+	// The queries received over TLS and HTTPS are served by the same server,
+	// so they're passed to the same handler. When one of the listeners fails,
+	// the others are stopped as well.
+	s := &server.Server{
+		Addr:          *addr,
+		Handler:       handler,
+		IdleTimeout:   *idleTimeout,
+		MaxConns:      *maxConns,
+		MaxUDPQueries: *maxUDPQueries,
+	}
+	if sm != nil {
+		s.Handler = server.Chain(s.Handler, sm.Middleware())
+		s.Malformed = sm.Malformed
+		if cache != nil {
+			sm.Cache(cache)
+		}
+		if blocklist != nil {
+			sm.Blocklist(blocklist)
+		}
+		if rpz != nil {
+			sm.RPZ(rpz)
+		}
+		if rrl != nil {
+			sm.RRL(rrl)
+		}
+	}
+
+	// The query log wraps the cache, so it records whether queries were
+	// answered from it.
+	if *queryLog != "" {
+		var w io.Writer = os.Stdout
+		if *queryLog != "-" {
+			f, err := server.OpenRotatingFile(*queryLog, *queryLogMaxSize<<20, *queryLogBackups)
+			if err != nil {
+				log.Printf("failed to open query log: %v", err)
+				return exitFailure
+			}
+			defer f.Close()
+			w = f
+		}
+		ql := server.NewQueryLog(w, qlf)
+		ql.SampleRate = *queryLogSample
+		s.Handler = server.Chain(s.Handler, ql.Middleware())
+	}
+	errs := make(chan error, 5)
+	go func() {
+		errs <- s.ListenAndServe(ctx)
+	}()
+	listeners := 1
+	if *metricsAddr != "" {
+		listeners++
+		mux := http.NewServeMux()
+		mux.Handle(metricsPath, registry)
+		go func() {
+			errs <- serveHTTP(ctx, *metricsAddr, mux)
+		}()
+		log.Printf("serving metrics on %s%s", *metricsAddr, metricsPath)
+	}
+	if *debugAddr != "" {
+		listeners++
+		publishDebugVars(recursiveClient, cache, blocklist, rpz, rrl)
+		go func() {
+			errs <- serveHTTP(ctx, *debugAddr, debugHandler())
+		}()
+		log.Printf("serving debug endpoints on %s/debug/", *debugAddr)
+	}
+	if *tlsAddr != "" || *httpsAddr != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Printf("failed to load TLS certificate: %v", err)
+			stop()
+			<-errs
+			return exitFailure
+		}
+		config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		if *tlsAddr != "" {
+			listeners++
+			go func() {
+				errs <- serveTLS(ctx, s, *tlsAddr, config)
+			}()
+			log.Printf("serving DNS over TLS on %s", *tlsAddr)
+		}
+		if *httpsAddr != "" {
+			listeners++
+			go func() {
+				errs <- serveHTTPS(ctx, s, *httpsAddr, config)
+			}()
+			log.Printf("serving DNS over HTTPS on %s%s", *httpsAddr, server.DefaultHTTPPath)
+		}
+	}
+
+	code := exitOK
+	for i := 0; i < listeners; i++ {
+		if err := <-errs; err != nil {
+			log.Printf("failed to serve: %v", err)
+			code = exitFailure
+			stop()
+		}
+	}
+	if cache != nil {
+		st := cache.Stats()
+		log.Printf(
+			"cache: %d hits, %d misses, %d evictions, %d prefetches, %d entries",
+			st.Hits, st.Misses, st.Evictions, st.Prefetches, st.Entries,
+		)
+	}
+	if blocklist != nil {
+		st := blocklist.Stats()
+		log.Printf("blocklist: %d queries blocked, %d names", st.Blocked, st.Names)
+	}
+	if rpz != nil {
+		st := rpz.Stats()
+		log.Printf("rpz: %d queries rewritten, %d rules", st.Hits, st.Rules)
+	}
+	if rrl != nil {
+		st := rrl.Stats()
+		log.Printf("rrl: %d responses dropped, %d truncated", st.Dropped, st.Slipped)
+	}
+
+	return code
+}
+
+// serveTLS serves the DNS queries sent over TLS on the address with the
+// server, until the context is done; the TLS connections count towards the
+// connection limit of the server, like its TCP connections.
+func serveTLS(ctx context.Context, s *server.Server, addr string, config *tls.Config) error {
+	// The negotiated application protocol of DNS over TLS is "dot".
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7858#section-3.2
+	config = config.Clone()
+	config.NextProtos = []string{"dot"}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, nil, tls.NewListener(l, config))
+}
+
+// serveHTTPS serves the DNS queries sent over HTTPS to server.DefaultHTTPPath
+// on the address with the server, until the context is done.
+func serveHTTPS(ctx context.Context, s *server.Server, addr string, config *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.Handle(server.DefaultHTTPPath, s)
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		TLSConfig:         config.Clone(),
+		ReadHeaderTimeout: s.IdleTimeout,
+		IdleTimeout:       s.IdleTimeout,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hs.Close()
+		case <-done:
+		}
+	}()
+
+	if err := hs.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// metricsPath is the path at which the metrics are served.
+const metricsPath = "/metrics"
+
+// serveHTTP serves the HTTP requests on the address with the handler (e.g.
+// of the metrics or debug endpoints), until the context is done.
+func serveHTTP(ctx context.Context, addr string, h http.Handler) error {
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hs.Close()
+		case <-done:
+		}
+	}()
+
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// viewOptions are the options of the handlers of views, which are shared with
+// the handler of the clients that match no view.
+type viewOptions struct {
+	transfers   []*net.IPNet
+	recursion   *server.ACL
+	policy      server.Policy
+	timeout     time.Duration
+	healthCheck time.Duration
+	cacheSize   int
+	prefetch    int
+	metrics     *metrics.ServerMetrics
+}
+
+// newViewHandler returns the handler of a view: an authority of its zone files
+// (reloaded on SIGHUP), a forwarder to its upstreams with a cache of its own,
+// or both, in which case queries for names outside the zones are forwarded.
+func newViewHandler(
+	ctx context.Context,
+	name string,
+	files []string,
+	upstreams []server.Upstream,
+	opts viewOptions,
+) (server.Handler, error) {
+	var forwarder server.Handler
+	if len(upstreams) > 0 {
+		if opts.metrics != nil {
+			for i, u := range upstreams {
+				upstreams[i].Transport = opts.metrics.Transport(u.Transport, u.Addr)
+			}
+		}
+		f := server.NewForwarder(opts.policy, opts.timeout, upstreams...)
+		if opts.healthCheck > 0 {
+			go f.HealthCheck(ctx, opts.healthCheck)
+		}
+		cache := server.NewResponseCache(opts.cacheSize)
+		cache.Prefetch = opts.prefetch
+		forwarder = server.Chain(f, opts.recursion.Middleware(), cache.Middleware())
+		if len(files) == 0 {
+			return forwarder, nil
+		}
+	}
+
+	zones, err := loadZones(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load zone of view %s: %v", name, err)
+	}
+	authority := server.NewAuthority(zones...)
+	authority.AllowTransfer(opts.transfers...)
+	go reloadZones(ctx, authority, files, nil, nil)
+	if forwarder == nil {
+		return authority, nil
+	}
+
+	// Queries for names in zones that are added by a reload are forwarded,
+	// until the server is restarted.
+	mux := server.NewServeMux()
+	mux.Handle(".", forwarder)
+	for _, z := range zones {
+		mux.Handle(z.Origin, authority)
+	}
+
+	return mux, nil
+}
+
+// loadZones loads the zone files; every zone must be loaded from a single
+// file.
+func loadZones(files []string) ([]*zone.Zone, error) {
+	zones := []*zone.Zone{}
+	origins := map[string]string{}
+	for _, file := range files {
+		z, err := zone.Load(file, "")
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := origins[z.Origin]; ok {
+			return nil, fmt.Errorf("zone %s is loaded from both %s and %s", z.Origin, prev, file)
+		}
+		origins[z.Origin] = file
+		zones = append(zones, z)
+		log.Printf("loaded zone %s with %d records from %s", z.Origin, len(z.Records()), file)
+	}
+
+	return zones, nil
+}
+
+// reloadZones reloads the zone files whenever the process receives SIGHUP,
+// until the context is canceled, and notifies the secondaries of the zones that
+// changed. When a zone file fails to load, the loaded zones are kept.
+func reloadZones(
+	ctx context.Context,
+	authority *server.Authority,
+	files []string,
+	client *resolver.Client,
+	secondaries []string,
+) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		zones, err := loadZones(files)
+		if err != nil {
+			log.Printf("failed to reload zones: %v", err)
+			continue
+		}
+		changed := authority.Reload(zones...)
+		log.Printf("reloaded %d zones; %d changed", len(zones), len(changed))
+		notifyZones(ctx, client, changed, secondaries)
+	}
+}
+
+// onHangup calls f whenever the process receives SIGHUP, until the context is
+// canceled.
+func onHangup(ctx context.Context, f func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		f()
+	}
+}
+
+// loadLocalRecords parses the files of local resource records; names must be
+// fully qualified, or relative to a $ORIGIN.
+func loadLocalRecords(files []string) ([]dns.RR, error) {
+	rrs := []dns.RR{}
+	for _, file := range files {
+		f, err := zone.ParseFile(file, "")
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, f...)
+	}
+
+	return rrs, nil
+}
+
+// notifyZones notifies the secondaries that the zones changed, in the
+// background.
+func notifyZones(ctx context.Context, client *resolver.Client, zones []*zone.Zone, secondaries []string) {
+	for _, z := range zones {
+		soa := z.SOA()
+		for _, addr := range secondaries {
+			go func(origin, addr string) {
+				if err := client.Notify(ctx, origin, addr, &soa); err != nil {
+					log.Printf("failed to notify %s of zone %s: %v", addr, origin, err)
+					return
+				}
+				log.Printf("notified %s of zone %s", addr, origin)
+			}(z.Origin, addr)
+		}
+	}
+}
+
+// aclFlag returns the function of a flag that adds a rule to the ACL, which
+// allows or denies the network of "[listener:]cidr"; the networks of the rules
+// are appended to nets as well, when it's not nil.
+func aclFlag(acl *server.ACL, allow bool, nets *[]*net.IPNet) func(string) error {
+	return func(s string) error {
+		listener, cidr := "", s
+		if i := strings.Index(s, ":"); i > 0 {
+			switch s[:i] {
+			case "udp", "tcp", "tls", "https":
+				listener, cidr = s[:i], s[i+1:]
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+
+		if allow {
+			acl.Allow(listener, n)
+		} else {
+			acl.Deny(listener, n)
+		}
+		if nets != nil {
+			*nets = append(*nets, n)
+		}
+		return nil
+	}
+}
+
+// viewConfig is a view, and the networks of its clients.
+type viewConfig struct {
+	name string
+	nets []*net.IPNet
+}
+
+// parseView parses a view: "name=cidr[,cidr...]".
+func parseView(s string) (viewConfig, error) {
+	name, nets, err := parseViewArg(s)
+	if err != nil {
+		return viewConfig{}, fmt.Errorf("invalid view %q; expected name=cidr[,cidr...]", s)
+	}
+
+	v := viewConfig{name: name}
+	for _, c := range strings.Split(nets, ",") {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return viewConfig{}, err
+		}
+		v.nets = append(v.nets, n)
+	}
+
+	return v, nil
+}
+
+// parseViewArg parses the argument of a view flag: "name=value".
+func parseViewArg(s string) (string, string, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return "", "", fmt.Errorf("invalid view argument %q; expected name=value", s)
+	}
+
+	return s[:i], s[i+1:], nil
+}
+
+// secondaryZone is a zone served as a secondary, and the addresses of its
+// primaries.
+type secondaryZone struct {
+	origin    string
+	primaries []string
+}
+
+// parseSecondary parses a secondary zone: "origin=primary[,primary...]", where
+// a primary is an IP address with an optional port (53).
+func parseSecondary(s string) (secondaryZone, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return secondaryZone{}, fmt.Errorf("invalid secondary zone %q; expected origin=primary[,primary...]", s)
+	}
+
+	z := secondaryZone{origin: s[:i]}
+	for _, p := range strings.Split(s[i+1:], ",") {
+		addr, err := parseServerAddr(p)
+		if err != nil {
+			return secondaryZone{}, err
+		}
+		z.primaries = append(z.primaries, addr)
+	}
+
+	return z, nil
+}
+
+// parseServerAddr parses the address of a name server: an IP address with an
+// optional port (53).
+func parseServerAddr(s string) (string, error) {
+	addr := s
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid name server address %q", s)
+	}
+
+	return addr, nil
+}
+
+// parseUpstream parses the address of an upstream resolver: an IP address with
+// an optional port (UDP, port 53), "tls://host[:port]" (DNS over TLS, port
+// 853), or the URL of a DNS over HTTPS endpoint.
+func parseUpstream(s string) (server.Upstream, error) {
+	switch {
+	case strings.HasPrefix(s, "https://"):
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return server.Upstream{}, fmt.Errorf("invalid upstream URL %q", s)
+		}
+		return server.Upstream{Addr: s, Transport: resolver.HTTPS}, nil
+	case strings.HasPrefix(s, "tls://"):
+		addr := strings.TrimPrefix(s, "tls://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "853")
+		}
+		return server.Upstream{Addr: addr, Transport: resolver.TLS}, nil
+	}
+
+	addr, err := parseServerAddr(s)
+	if err != nil {
+		return server.Upstream{}, fmt.Errorf("invalid upstream address %q", s)
+	}
+
+	return server.Upstream{Addr: addr, Transport: resolver.UDP}, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// newTrace creates a trace that prints every step of a resolution the way
+// "dig +trace" does: every query, the records of every response, and every
+// referral that's followed with the glue that's used.
+func newTrace(w io.Writer) *resolver.Trace {
+	return &resolver.Trace{
+		Query: func(server net.IP, name string, qt dns.QType) {
+			fmt.Fprintf(w, ";; Querying %s for %s %s\n", server, name, qt)
+		},
+		Response: func(server net.IP, resp *dns.Msg, rtt time.Duration, err error) {
+			if err != nil {
+				fmt.Fprintf(w, ";; No response from %s: %v\n\n", server, err)
+				return
+			}
+
+			for _, section := range [][]dns.RR{resp.Answer, resp.Authority, resp.Additional} {
+				for _, rr := range section {
+					if rr.Type != dns.TypeOPT {
+						fmt.Fprintln(w, rr.String())
+					}
+				}
+			}
+
+			size := 0
+			if b, err := resp.Pack(); err == nil {
+				size = len(b)
+			}
+			fmt.Fprintf(
+				w, ";; Received %d bytes from %s in %d ms (%s)\n\n",
+				size, server, rtt.Milliseconds(), rcodeMnemonics[resp.RCode],
+			)
+		},
+		Referral: func(from string, to string, nameServers []string, glue []dns.RR) {
+			fmt.Fprintf(
+				w, ";; Referral from %s to %s: %s\n",
+				from, to, strings.Join(nameServers, " "),
+			)
+
+			addrs := []string{}
+			for _, rr := range glue {
+				addrs = append(addrs, rr.Name+" "+rr.RDataUnpacked)
+			}
+			if len(addrs) == 0 {
+				fmt.Fprintf(w, ";; No glue; resolving the name server address\n\n")
+				return
+			}
+			fmt.Fprintf(w, ";; Glue: %s\n\n", strings.Join(addrs, ", "))
+		},
+	}
+}
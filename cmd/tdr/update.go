@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/zone"
+)
+
+// runUpdate runs "tdr update [flags] zone", which sends a dynamic update that
+// adds and deletes resource records of the zone to its primary name server.
+// The name server only applies the update when all prerequisites (-require
+// and -prohibit) are met.
+func runUpdate(args []string) int {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	server := fs.String(
+		"server", "",
+		`address ("ip" or "ip:port") of the name server to update; defaults to the primary name server of the zone`,
+	)
+	adds, deletes, requires, prohibits := []string{}, []string{}, []string{}, []string{}
+	fs.Func(
+		"add",
+		`record to add: "name [ttl] type rdata"; repeat the flag to add more records`,
+		appendFlag(&adds),
+	)
+	fs.Func(
+		"delete",
+		`records to delete: "name" (all records), "name type" (record set) or "name type rdata" (record);`+"\n"+
+			"repeat the flag to delete more records",
+		appendFlag(&deletes),
+	)
+	fs.Func(
+		"require",
+		`prerequisite that must exist: "name", "name type" or "name type rdata" (the record set must hold`+"\n"+
+			"exactly the required records); repeat the flag to require more",
+		appendFlag(&requires),
+	)
+	fs.Func(
+		"prohibit",
+		`prerequisite that must not exist: "name" or "name type"; repeat the flag to prohibit more`,
+		appendFlag(&prohibits),
+	)
+	ttl := fs.Uint("ttl", 3600, "TTL of added records without a TTL")
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			fs.Output(),
+			"Usage: %s update [flags] zone\n\n"+
+				"Names are relative to the zone unless they're fully qualified; \"@\" is the\n"+
+				"apex of the zone.\n\nFlags:\n",
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single zone")
+	case len(adds) == 0 && len(deletes) == 0:
+		err = fmt.Errorf("expected at least one -add or -delete")
+	case *ttl > 1<<31-1:
+		err = fmt.Errorf("-ttl must be at most %d", 1<<31-1)
+	default:
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	origin := strings.ToLower(fs.Arg(0))
+	origin = dns.Fqdn(origin)
+
+	update, err := buildUpdate(origin, uint32(*ttl), adds, deletes, requires, prohibits)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	addr := *server
+	if addr == "" {
+		if addr, err = primaryAddr(ctx, client, origin); err != nil {
+			log.Printf("failed to find the primary name server of %s: %v", origin, err)
+			return exitCode(err)
+		}
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+
+	if err := client.Update(ctx, update, addr); err != nil {
+		log.Printf("failed to update %s on %s: %v", origin, addr, err)
+		return exitCode(err)
+	}
+	fmt.Printf(
+		"Updated %s on %s: %d prerequisites, %d updates\n",
+		origin, addr, len(update.Answer), len(update.Authority),
+	)
+
+	return exitOK
+}
+
+// appendFlag returns a flag function that appends every value to the slice.
+func appendFlag(values *[]string) func(string) error {
+	return func(s string) error {
+		*values = append(*values, s)
+		return nil
+	}
+}
+
+// buildUpdate builds the dynamic update of the zone from the flag values.
+func buildUpdate(origin string, ttl uint32, adds, deletes, requires, prohibits []string) (*dns.Msg, error) {
+	update := new(dns.Msg)
+	if err := update.SetUpdate(origin); err != nil {
+		return nil, err
+	}
+
+	for _, s := range requires {
+		name, t, rrs, err := parseUpdateSpec(origin, s)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid -require %q: %v", s, err)
+		case rrs != nil:
+			update.Used(rrs...)
+		case t != 0:
+			update.RRsetUsed(name, t)
+		default:
+			update.NameUsed(name)
+		}
+	}
+	for _, s := range prohibits {
+		name, t, rrs, err := parseUpdateSpec(origin, s)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid -prohibit %q: %v", s, err)
+		case rrs != nil:
+			return nil, fmt.Errorf("invalid -prohibit %q: a record can't be prohibited, only a name or record set", s)
+		case t != 0:
+			update.RRsetNotUsed(name, t)
+		default:
+			update.NameNotUsed(name)
+		}
+	}
+	for _, s := range deletes {
+		name, t, rrs, err := parseUpdateSpec(origin, s)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid -delete %q: %v", s, err)
+		case rrs != nil:
+			update.Remove(rrs...)
+		case t != 0:
+			update.RemoveRRset(name, t)
+		default:
+			update.RemoveName(name)
+		}
+	}
+	for _, s := range adds {
+		rrs, err := parseUpdateRecords(origin, ttl, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -add %q: %v", s, err)
+		}
+		update.Insert(rrs...)
+	}
+
+	return update, nil
+}
+
+// parseUpdateSpec parses "name", "name type" or "name type rdata". It returns
+// the records for the last form only.
+func parseUpdateSpec(origin string, s string) (string, dns.Type, []dns.RR, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 0:
+		return "", 0, nil, fmt.Errorf("expected a name")
+	case 1:
+		return absoluteName(origin, fields[0]), 0, nil, nil
+	case 2:
+		t, ok := parseType(fields[1])
+		if !ok {
+			return "", 0, nil, fmt.Errorf("unknown type %q", fields[1])
+		}
+		return absoluteName(origin, fields[0]), t, nil, nil
+	}
+
+	rrs, err := parseUpdateRecords(origin, 0, s)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	return rrs[0].Name, rrs[0].Type, rrs, nil
+}
+
+// parseUpdateRecords parses the resource records in zone file format; names
+// are relative to the origin, and the TTL defaults to ttl.
+func parseUpdateRecords(origin string, ttl uint32, s string) ([]dns.RR, error) {
+	rrs, err := zone.Parse(strings.NewReader(fmt.Sprintf("$TTL %d\n%s\n", ttl, s)), origin)
+	if err != nil {
+		return nil, err
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("expected a record")
+	}
+
+	return rrs, nil
+}
+
+// absoluteName returns the fully qualified domain name of a name that's
+// relative to the origin (unless it ends with a dot); "@" is the origin.
+func absoluteName(origin string, name string) string {
+	switch {
+	case name == "@":
+		return origin
+	case dns.IsFqdn(name):
+		return name
+	case origin == ".":
+		return name + "."
+	default:
+		return name + "." + origin
+	}
+}
+
+// primaryAddr returns the address of the primary name server of the zone: the
+// name server in the MNAME field of its SOA resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-4
+func primaryAddr(ctx context.Context, client *resolver.Client, origin string) (string, error) {
+	resp, err := client.Query(ctx, origin, dns.TypeSOA, false)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range resp.Answer {
+		if rr.Type != dns.TypeSOA {
+			continue
+		}
+		rd, err := rr.Decode()
+		if err != nil {
+			return "", err
+		}
+		ips, err := client.ResolveHostContext(ctx, rd.(*dns.SOA).MName)
+		if err != nil {
+			return "", err
+		}
+		if len(ips) == 0 {
+			return "", fmt.Errorf("primary name server %s has no addresses", rd.(*dns.SOA).MName)
+		}
+		return net.JoinHostPort(ips[0].String(), "53"), nil
+	}
+
+	return "", fmt.Errorf("no SOA record")
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// walker enumerates the names of a DNSSEC signed zone by querying one of its
+// authoritative name servers.
+type walker struct {
+	ctx    context.Context
+	client *resolver.Client
+
+	// addr is the address of the authoritative name server.
+	addr string
+
+	// zone is the zone that's walked.
+	zone string
+
+	// out is where the names are printed.
+	out io.Writer
+}
+
+// runWalk runs "tdr walk [flags] zone", which enumerates the names of a
+// DNSSEC signed zone by following the next owner names of its NSEC records.
+// With -nsec3, it collects the NSEC3 hash chain instead, and cracks the hashed
+// owner names with a wordlist.
+func runWalk(args []string) int {
+	fs := flag.NewFlagSet("walk", flag.ExitOnError)
+	server := fs.String(
+		"server", "",
+		`address ("ip" or "ip:port") of the name server to query; defaults to an authoritative name server of the zone`,
+	)
+	nsec3 := fs.Bool("nsec3", false, "collect the NSEC3 hash chain, and crack it with -wordlist")
+	wordlist := fs.String("wordlist", "", "file with one label per line to crack NSEC3 hashes with")
+	maxQueries := fs.Int("queries", 1000, "max number of queries to collect the NSEC3 hash chain with")
+	timeout := fs.Duration("timeout", time.Second*5, "time to wait for a response")
+	cf := addClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s walk [flags] zone\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a single zone")
+	case *wordlist != "" && !*nsec3:
+		err = fmt.Errorf("-wordlist requires -nsec3")
+	case *maxQueries < 1:
+		err = fmt.Errorf("-queries must be at least 1")
+	default:
+		err = cf.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+	zone := strings.ToLower(fs.Arg(0))
+	zone = dns.Fqdn(zone)
+
+	ctx := context.Background()
+	client, err := cf.newClient(ctx, resolver.WithTimeout(*timeout))
+	if err != nil {
+		log.Print(err)
+		return exitCode(err)
+	}
+
+	addr := *server
+	if addr == "" {
+		if addr, err = authoritativeAddr(ctx, client, zone); err != nil {
+			log.Printf("failed to find an authoritative name server of %s: %v", zone, err)
+			return exitCode(err)
+		}
+	}
+
+	w := &walker{ctx: ctx, client: client, addr: addr, zone: zone, out: os.Stdout}
+	if *nsec3 {
+		err = w.walkNSEC3(*wordlist, *maxQueries)
+	} else {
+		err = w.walkNSEC()
+	}
+	if err != nil {
+		log.Printf("failed to walk %s: %v", zone, err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+// authoritativeAddr returns the address of the first authoritative name
+// server of the zone that can be resolved.
+func authoritativeAddr(
+	ctx context.Context,
+	client *resolver.Client,
+	zone string,
+) (string, error) {
+	nss, err := client.LookupNS(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ns := range nss {
+		ips, err := client.ResolveHostContext(ctx, ns.Host)
+		if err == nil && len(ips) > 0 {
+			return net.JoinHostPort(ips[0].String(), "53"), nil
+		}
+	}
+
+	return "", fmt.Errorf("no name server addresses")
+}
+
+// query sends a non-recursive query, which requests DNSSEC resource records,
+// to the name server.
+func (w *walker) query(name string, qt dns.QType) (*dns.Msg, error) {
+	msg, err := newQuery(name, qt, false)
+	if err != nil {
+		return nil, err
+	}
+	msg.SetEDNS0(dns.DefaultEDNSUDPSize, true)
+
+	return w.client.ExchangeContext(w.ctx, msg, w.addr)
+}
+
+// walkNSEC follows the NSEC chain from the apex of the zone until it wraps
+// around, and prints every name with the types it has.
+func (w *walker) walkNSEC() error {
+	names := 0
+	seen := map[string]bool{w.zone: true}
+	for name := w.zone; ; {
+		resp, err := w.query(name, dns.TypeNSEC)
+		if err != nil {
+			return err
+		}
+
+		nsec, ok := findNSEC(resp, name)
+		if !ok {
+			if hasType(resp.Authority, dns.TypeNSEC3) {
+				return fmt.Errorf("the zone uses NSEC3; walk it with -nsec3")
+			}
+			return fmt.Errorf("no NSEC record for %s", name)
+		}
+		fmt.Fprintf(w.out, "%s\t%s\n", name, typeNames(nsec.TypeBitMap))
+		names++
+
+		next := strings.ToLower(nsec.NextDomain)
+		if seen[next] || !dns.IsSubDomain(w.zone, next) {
+			break
+		}
+		seen[next] = true
+		name = next
+	}
+
+	fmt.Fprintf(w.out, "\n;; %d names in %s\n", names, w.zone)
+	return nil
+}
+
+// findNSEC returns the NSEC record of the name from the answer section, or
+// from the authority section of a NODATA response.
+func findNSEC(m *dns.Msg, name string) (*dns.NSEC, bool) {
+	for _, rrs := range [][]dns.RR{m.Answer, m.Authority} {
+		for _, rr := range rrs {
+			if rr.Type != dns.TypeNSEC || !strings.EqualFold(rr.Name, name) {
+				continue
+			}
+			nsec := new(dns.NSEC)
+			if err := nsec.Unpack(rr.RData); err == nil {
+				return nsec, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// hasType checks if any of the resource records has the type.
+func hasType(rrs []dns.RR, t dns.Type) bool {
+	for _, rr := range rrs {
+		if rr.Type == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeNames returns the names of the types, separated by spaces.
+func typeNames(types []dns.Type) string {
+	names := []string{}
+	for _, t := range types {
+		names = append(names, t.String())
+	}
+
+	return strings.Join(names, " ")
+}
+
+// walkNSEC3 collects the NSEC3 hash chain by querying random names, which the
+// name server denies with the NSEC3 records that cover their hashes. It stops
+// when the chain is complete, or after maxQueries queries. The hashes are then
+// cracked with the labels of the wordlist (when set).
+func (w *walker) walkNSEC3(wordlist string, maxQueries int) error {
+	chain := map[string]*dns.NSEC3{}
+	queries := 0
+	for ; queries < maxQueries && !chainComplete(chain); queries++ {
+		label, err := randomLabel()
+		if err != nil {
+			return err
+		}
+		resp, err := w.query(label+"."+w.zone, dns.TypeA)
+		if err != nil {
+			return err
+		}
+
+		for _, rr := range resp.Authority {
+			if rr.Type != dns.TypeNSEC3 {
+				continue
+			}
+			hash, zone := splitOwner(rr.Name)
+			if !strings.EqualFold(zone, w.zone) {
+				continue
+			}
+			nsec3 := new(dns.NSEC3)
+			if err := nsec3.Unpack(rr.RData); err == nil {
+				chain[hash] = nsec3
+			}
+		}
+		if queries == 0 && len(chain) == 0 {
+			return fmt.Errorf("no NSEC3 records in the denial of existence")
+		}
+	}
+
+	status := "complete"
+	if !chainComplete(chain) {
+		status = "incomplete"
+	}
+	fmt.Fprintf(
+		w.out, ";; collected %d NSEC3 hashes in %d queries (chain %s)\n",
+		len(chain), queries, status,
+	)
+	var params *dns.NSEC3
+	for _, nsec3 := range chain {
+		params = nsec3
+		break
+	}
+	fmt.Fprintf(
+		w.out, ";; hash algorithm %d, %d iterations, salt %q\n\n",
+		params.HashAlgorithm, params.Iterations, hex.EncodeToString(params.Salt),
+	)
+
+	// The apex is always in the chain, and is cracked without a wordlist.
+	cracked := map[string]string{}
+	crack := func(name string) {
+		hash := dns.HashName(name, params.HashAlgorithm, params.Iterations, params.Salt)
+		if _, ok := chain[hash]; ok {
+			cracked[hash] = name
+		}
+	}
+	crack(w.zone)
+	if wordlist != "" {
+		f, err := os.Open(wordlist)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if label := strings.TrimSpace(s.Text()); label != "" {
+				crack(strings.ToLower(label) + "." + w.zone)
+			}
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+
+	hashes := []string{}
+	for hash := range chain {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		name := cracked[hash]
+		if name == "" {
+			name = "?"
+		}
+		fmt.Fprintf(w.out, "%s\t%s\t%s\n", hash, name, typeNames(chain[hash].TypeBitMap))
+	}
+	fmt.Fprintf(w.out, "\n;; cracked %d of %d hashes\n", len(cracked), len(chain))
+
+	return nil
+}
+
+// randomLabel returns a random label, which is unlikely to exist in any zone.
+func randomLabel() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// splitOwner splits an owner name into its (lower case) first label and the
+// rest of the name.
+func splitOwner(owner string) (string, string) {
+	owner = strings.ToLower(owner)
+	i := strings.Index(owner, ".")
+	if i < 0 || i == len(owner)-1 {
+		return strings.TrimSuffix(owner, "."), "."
+	}
+
+	return owner[:i], owner[i+1:]
+}
+
+// chainComplete checks if the NSEC3 hash chain is complete, i.e. the next
+// hashed owner name of every record is the owner of another record.
+func chainComplete(chain map[string]*dns.NSEC3) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	for _, nsec3 := range chain {
+		if _, ok := chain[nsec3.NextHashedOwner()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// ANSI escape codes used to highlight changes on a terminal.
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+)
+
+// watcher re-issues requests periodically, and reports when their resource
+// record sets change.
+type watcher struct {
+	// w is where the changes are printed.
+	w io.Writer
+
+	// color is set to highlight changes with ANSI colors.
+	color bool
+
+	// fetch returns the answer resource records of the request.
+	fetch func(r request) ([]dns.RR, error)
+
+	// expect is the (presentation format) resource record data that stops
+	// watching when it appears in an answer; empty watches forever.
+	expect string
+
+	// rrsets holds the last resource record set of every request.
+	rrsets map[request][]string
+}
+
+// watch fetches the requests every interval, and prints their resource record
+// sets when they're first fetched and every time they change. It returns
+// exitExpected as soon as the expected value appears.
+func (wr *watcher) watch(reqs []request, interval time.Duration) int {
+	wr.rrsets = map[request][]string{}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, r := range reqs {
+			if wr.check(r) {
+				return exitExpected
+			}
+		}
+		<-t.C
+	}
+}
+
+// check fetches the request, and prints its resource record set when it
+// changed. It reports if the expected value appeared.
+func (wr *watcher) check(r request) bool {
+	rrs, err := wr.fetch(r)
+	if err != nil {
+		slog.Error("failed to resolve record(s)", "name", r.name, "qtype", r.qt.String(), "err", err)
+		return false
+	}
+
+	// Only the record data is compared; TTLs decrease between queries, and the
+	// order of the records isn't significant.
+	rrset := []string{}
+	found := false
+	for _, rr := range rrs {
+		if rr.Type != r.qt {
+			continue
+		}
+		rrset = append(rrset, rr.RDataUnpacked)
+		if wr.expect != "" && strings.EqualFold(rr.RDataUnpacked, wr.expect) {
+			found = true
+		}
+	}
+	sort.Strings(rrset)
+
+	prev, seen := wr.rrsets[r]
+	wr.rrsets[r] = rrset
+	now := time.Now().Format(time.RFC3339)
+	switch {
+	case !seen:
+		fmt.Fprintf(wr.w, ";; %s %s %s\n", now, r.name, r.qt)
+		for _, rd := range rrset {
+			fmt.Fprintf(wr.w, "  %s\n", rd)
+		}
+	case !equalStrings(prev, rrset):
+		fmt.Fprintf(wr.w, ";; %s %s %s changed\n", now, r.name, r.qt)
+		for _, rd := range difference(prev, rrset) {
+			fmt.Fprintln(wr.w, wr.highlight("- "+rd, colorRed))
+		}
+		for _, rd := range difference(rrset, prev) {
+			fmt.Fprintln(wr.w, wr.highlight("+ "+rd, colorGreen))
+		}
+	}
+
+	if found {
+		fmt.Fprintf(wr.w, ";; %s %s %s has %s\n", now, r.name, r.qt, wr.expect)
+	}
+	return found
+}
+
+// highlight colors the line when colors are enabled.
+func (wr *watcher) highlight(line string, color string) string {
+	if !wr.color {
+		return line
+	}
+
+	return color + line + colorReset
+}
+
+// isTerminal checks if the file is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// equalStrings checks if the sorted slices are equal.
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// difference returns the strings of a that aren't in b.
+func difference(a []string, b []string) []string {
+	inB := map[string]bool{}
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	diff := []string{}
+	for _, s := range a {
+		if !inB[s] {
+			diff = append(diff, s)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+// zoneCommands maps a zone subcommand name to the function that runs it.
+var zoneCommands = map[string]func(args []string) int{
+	"check": runZoneCheck,
+	"sign":  runZoneSign,
+}
+
+// runZone runs "tdr zone <command> [flags] [args...]", which runs a command
+// on zone files.
+func runZone(args []string) int {
+	if len(args) > 0 {
+		if run, ok := zoneCommands[args[0]]; ok {
+			return run(args[1:])
+		}
+	}
+
+	names := make([]string, 0, len(zoneCommands))
+	for name := range zoneCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s zone <command> [flags] [args...]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+
+	return exitUsage
+}
+
+// runZoneCheck runs "tdr zone check [flags] file", which parses the zone file
+// and reports its semantic problems.
+func runZoneCheck(args []string) int {
+	fs := flag.NewFlagSet("zone check", flag.ExitOnError)
+	origin := fs.String(
+		"origin", "", "origin of the zone; defaults to the owner of the SOA record",
+	)
+	strict := fs.Bool("strict", false, "fail on warnings as well as errors")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s zone check [flags] file\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(fs.Output(), "expected a zone file")
+		fs.Usage()
+		return exitUsage
+	}
+
+	rrs, err := zone.ParseFile(fs.Arg(0), *origin)
+	if err != nil {
+		log.Printf("failed to parse zone: %v", err)
+		return exitFailure
+	}
+
+	return reportZoneCheck(os.Stdout, fs.Arg(0), len(rrs), zone.Check(*origin, rrs), *strict)
+}
+
+// reportZoneCheck prints the problems of the zone file. It returns exitOK
+// when there are no errors (or, when strict is set, no problems at all).
+func reportZoneCheck(out io.Writer, file string, records int, problems []zone.Problem, strict bool) int {
+	fmt.Fprintf(out, ";; %s: %d records\n\n", file, records)
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return exitOK
+	}
+
+	code := exitOK
+	errs, warns := 0, 0
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tNAME\tTYPE\tPROBLEM")
+	for _, p := range problems {
+		if p.Severity == zone.SeverityError {
+			errs++
+		} else {
+			warns++
+		}
+		if p.Severity == zone.SeverityError || strict {
+			code = exitFailure
+		}
+		t := "-"
+		if p.Type != 0 {
+			t = p.Type.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Severity, p.Name, t, p.Msg)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d errors, %d warnings\n", errs, warns)
+
+	return code
+}
+
+// runZoneSign runs "tdr zone sign [flags] file", which signs the zone file
+// with DNSSEC, and writes the signed zone and the DS records of its key
+// signing keys (for the parent zone). Without keys, a key signing key and a
+// zone signing key are generated.
+func runZoneSign(args []string) int {
+	fs := flag.NewFlagSet("zone sign", flag.ExitOnError)
+	origin := fs.String(
+		"origin", "", "origin of the zone; defaults to the owner of the SOA record",
+	)
+	keyFiles := []string{}
+	fs.Func(
+		"key",
+		"key pair (Kname.+alg+tag, as generated with dnssec-keygen) that signs the zone; reads the\n"+
+			".key and .private files; repeat the flag to sign with more keys",
+		func(s string) error {
+			keyFiles = append(keyFiles, s)
+			return nil
+		},
+	)
+	algorithm := fs.String("algorithm", "ECDSAP256SHA256", "algorithm of the generated keys")
+	keyDir := fs.String(
+		"key-dir", ".", "directory the generated keys and the DS records (dsset-origin) are written to",
+	)
+	out := fs.String("o", "", "file the signed zone is written to; defaults to stdout")
+	validity := fs.Duration("validity", 30*24*time.Hour, "time the signatures are valid")
+	nsec3 := fs.Bool("nsec3", false, "prove non-existence with an NSEC3 chain instead of NSEC")
+	salt := fs.String("salt", "", "hex encoded NSEC3 salt")
+	iterations := fs.Uint("iterations", 0, "number of additional NSEC3 hash iterations")
+	optOut := fs.Bool("opt-out", false, "leave insecure delegations out of the NSEC3 chain")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s zone sign [flags] file\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	alg := parseAlgorithm(*algorithm)
+	saltb, saltErr := hex.DecodeString(*salt)
+
+	var err error
+	switch {
+	case fs.NArg() != 1:
+		err = fmt.Errorf("expected a zone file")
+	case alg == 0:
+		err = fmt.Errorf("unsupported -algorithm %q", *algorithm)
+	case *validity <= 0:
+		err = fmt.Errorf("-validity must be positive")
+	case saltErr != nil || len(saltb) > 255:
+		err = fmt.Errorf("-salt must be at most 255 hex encoded bytes")
+	case *iterations > 65535:
+		err = fmt.Errorf("-iterations must be at most 65535")
+	case !*nsec3 && (*salt != "" || *iterations > 0 || *optOut):
+		err = fmt.Errorf("-salt, -iterations and -opt-out require -nsec3")
+	}
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	z, err := zone.Load(fs.Arg(0), *origin)
+	if err != nil {
+		log.Printf("failed to load zone: %v", err)
+		return exitFailure
+	}
+
+	keys := []zone.SigningKey{}
+	for _, path := range keyFiles {
+		priv, key, owner, err := loadKeyPair(path)
+		if err != nil {
+			log.Printf("failed to load key %s: %v", path, err)
+			return exitFailure
+		}
+		if !strings.EqualFold(owner, z.Origin) {
+			log.Printf("key %s is owned by %s, not by %s", path, owner, z.Origin)
+			return exitFailure
+		}
+		keys = append(keys, zone.SigningKey{Key: key, Priv: priv})
+	}
+	if len(keys) == 0 {
+		for _, flags := range []uint16{dns.DNSKEYFlagZone | dns.DNSKEYFlagSEP, dns.DNSKEYFlagZone} {
+			priv, key, err := dns.GenerateKey(alg, flags)
+			if err != nil {
+				log.Printf("failed to generate key: %v", err)
+				return exitFailure
+			}
+			path, err := writeKeyPair(*keyDir, z.Origin, priv, key)
+			if err != nil {
+				log.Printf("failed to write key: %v", err)
+				return exitFailure
+			}
+			log.Printf("generated key %s", path)
+			keys = append(keys, zone.SigningKey{Key: key, Priv: priv})
+		}
+	}
+
+	// Signatures are valid from an hour ago, for validators with clocks that
+	// are behind.
+	now := time.Now()
+	opts := zone.SignOptions{Inception: now.Add(-time.Hour), Expiration: now.Add(*validity)}
+	if *nsec3 {
+		opts.NSEC3 = &dns.NSEC3PARAM{
+			HashAlgorithm: dns.NSEC3HashSHA1,
+			Iterations:    uint16(*iterations),
+			Salt:          saltb,
+		}
+		if *optOut {
+			opts.NSEC3.Flags = dns.NSEC3FlagOptOut
+		}
+	}
+	rrs, err := z.Sign(keys, opts)
+	if err != nil {
+		log.Printf("failed to sign zone: %v", err)
+		return exitFailure
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Printf("failed to create signed zone file: %v", err)
+			return exitFailure
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeRecords(w, rrs); err != nil {
+		log.Printf("failed to write signed zone: %v", err)
+		return exitFailure
+	}
+
+	dsset, err := dsRecords(z.Origin, keys)
+	if err != nil {
+		log.Printf("failed to create DS records: %v", err)
+		return exitFailure
+	}
+	path := filepath.Join(*keyDir, "dsset-"+z.Origin)
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("failed to create DS records file: %v", err)
+		return exitFailure
+	}
+	defer f.Close()
+	if err := writeRecords(f, dsset); err != nil {
+		log.Printf("failed to write DS records: %v", err)
+		return exitFailure
+	}
+	log.Printf("wrote DS records for the parent zone to %s", path)
+
+	return exitOK
+}
+
+// writeRecords writes the resource records in the zone file format, one per
+// line.
+func writeRecords(w io.Writer, rrs []dns.RR) error {
+	bw := bufio.NewWriter(w)
+	for _, rr := range rrs {
+		fmt.Fprintln(bw, rr.String())
+	}
+
+	return bw.Flush()
+}
+
+// dsRecords returns the DS records (with SHA-256 digests) of the key signing
+// keys of the zone; when none of the keys is a key signing key, all keys sign
+// the DNSKEY resource record set, so they all get one.
+func dsRecords(origin string, keys []zone.SigningKey) ([]dns.RR, error) {
+	ksks := []*dns.DNSKEY{}
+	for _, k := range keys {
+		if k.Key.Flags&dns.DNSKEYFlagSEP != 0 {
+			ksks = append(ksks, k.Key)
+		}
+	}
+	if len(ksks) == 0 {
+		for _, k := range keys {
+			ksks = append(ksks, k.Key)
+		}
+	}
+
+	rrs := []dns.RR{}
+	for _, key := range ksks {
+		ds, err := key.ToDS(origin, dns.DigestTypeSHA256)
+		if err != nil {
+			return nil, err
+		}
+		rdata, err := ds.Pack()
+		if err != nil {
+			return nil, err
+		}
+		rr, err := dns.NewRR(origin, dns.TypeDS, dns.ClassIN, 0, rdata)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rr)
+	}
+
+	return rrs, nil
+}
@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CAAFlagCritical marks a CAA property as critical; a certification authority
+// must not issue a certificate when it doesn't understand a critical property.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8659#section-4.1
+const CAAFlagCritical uint8 = 1 << 7
+
+// CAA authorizes certification authorities to issue certificates for a domain.
+// Its RDATA has the following format:
+//
+// +0-1-2-3-4-5-6-7-|0-1-2-3-4-5-6-7-|
+// | Flags          | Tag Length = n |
+// +----------------|----------------+...+---------------+
+// | Tag char 0     | Tag char 1     |...| Tag char n-1  |
+// +----------------|----------------+...+---------------+
+// +----------------|----------------+.....+----------------+
+// | Value byte 0   | Value byte 1   |.....| Value byte m-1 |
+// +----------------|----------------+.....+----------------+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8659#section-4.1
+type CAA struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// Pack packs the CAA RDATA fields into binary format.
+func (c *CAA) Pack() ([]byte, error) {
+	if len(c.Tag) == 0 || len(c.Tag) > 255 {
+		return nil, fmt.Errorf("invalid tag length %d", len(c.Tag))
+	}
+
+	b := []byte{c.Flags, byte(len(c.Tag))}
+	b = append(b, c.Tag...)
+	return append(b, c.Value...), nil
+}
+
+// Unpack unpacks the CAA RDATA bytes.
+func (c *CAA) Unpack(rdata []byte) error {
+	if len(rdata) < 2 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+	size := int(rdata[1])
+	if size == 0 || 2+size > len(rdata) {
+		return fmt.Errorf("invalid tag length %d", size)
+	}
+
+	c.Flags = rdata[0]
+	c.Tag = string(rdata[2 : 2+size])
+	c.Value = string(rdata[2+size:])
+	return nil
+}
+
+// String returns the presentation format of the CAA RDATA.
+func (c *CAA) String() string {
+	return fmt.Sprintf("%d %s %s", c.Flags, c.Tag, strconv.Quote(c.Value))
+}
+
+// Critical reports whether the property is critical.
+func (c *CAA) Critical() bool {
+	return c.Flags&CAAFlagCritical != 0
+}
@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"bytes"
+	"sort"
+)
+
+// PackCanonicalName packs a domain name in canonical wire format: uncompressed,
+// fully qualified, and with all uppercase US-ASCII letters replaced by the
+// corresponding lowercase letters.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.2
+func PackCanonicalName(name string) ([]byte, error) {
+	return packDomainName(CanonicalName(Fqdn(name)))
+}
+
+// PackCanonical packs the resource record in canonical wire format: its owner
+// name, and the domain names embedded in its RDATA, are in canonical form (see
+// canonicalRData). Its TTL is packed as-is; a signer sets it to the original
+// TTL of the RRSIG.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.2
+func (r *RR) PackCanonical() ([]byte, error) {
+	crr := *r
+	crr.Name = CanonicalName(Fqdn(r.Name))
+	crr.RData = canonicalRData(*r)
+
+	return crr.Pack()
+}
+
+// SortCanonical sorts the resource records in canonical order: by owner name
+// in canonical ordering (see CompareDomainName), then by type and class, and
+// then by their RDATA in canonical form, as left-justified unsigned byte
+// strings. Within a resource record set this is the order in which records are
+// signed, and across a zone it's a deterministic order to diff zones in.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.3
+func SortCanonical(rrs []RR) {
+	rdatas := make([][]byte, len(rrs))
+	for i, rr := range rrs {
+		rdatas[i] = canonicalRData(rr)
+	}
+
+	sort.Sort(canonicalOrder{rrs: rrs, rdatas: rdatas})
+}
+
+// canonicalOrder sorts resource records, and their RDATA in canonical form,
+// in canonical order.
+type canonicalOrder struct {
+	rrs    []RR
+	rdatas [][]byte
+}
+
+func (o canonicalOrder) Len() int {
+	return len(o.rrs)
+}
+
+func (o canonicalOrder) Swap(i, j int) {
+	o.rrs[i], o.rrs[j] = o.rrs[j], o.rrs[i]
+	o.rdatas[i], o.rdatas[j] = o.rdatas[j], o.rdatas[i]
+}
+
+func (o canonicalOrder) Less(i, j int) bool {
+	a, b := o.rrs[i], o.rrs[j]
+	if c := CompareDomainName(a.Name, b.Name); c != 0 {
+		return c < 0
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	if a.Class != b.Class {
+		return a.Class < b.Class
+	}
+
+	return bytes.Compare(o.rdatas[i], o.rdatas[j]) < 0
+}
+
+// canonicalRData returns the canonical form of the resource record RDATA; all
+// uppercase US-ASCII letters in the embedded domain names of the RDATA types
+// listed in RFC 4034 (as updated by RFC 6840) are replaced by the
+// corresponding lowercase letters.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.2
+func canonicalRData(r RR) []byte {
+	rdata := append([]byte{}, r.RData...)
+
+	// The number of domain names at the start of the RDATA, and the offset at
+	// which they start.
+	names, off := 0, 0
+	switch r.Type {
+	case TypeNS, TypeMD, TypeMF, TypeCNAME, TypeMB, TypeMG, TypeMR, TypePTR:
+		names = 1
+	case TypeSOA, TypeMINFO:
+		names = 2
+	case TypeMX:
+		names, off = 1, 2
+	case TypeSRV:
+		names, off = 1, 6
+	case TypeRRSIG, TypeSIG:
+		names, off = 1, 18
+	}
+
+	for i := 0; i < names; i++ {
+		for off < len(rdata) && rdata[off] != 0 {
+			size := int(rdata[off])
+			end := off + 1 + size
+			if end > len(rdata) {
+				return rdata
+			}
+			lowerASCII(rdata[off+1 : end])
+			off = end
+		}
+		off++
+	}
+
+	return rdata
+}
+
+// lowerASCII replaces all uppercase US-ASCII letters in b by the corresponding
+// lowercase letters.
+func lowerASCII(b []byte) {
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackCanonicalName(t *testing.T) {
+	b, err := PackCanonicalName("WWW.Example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}
+	if !bytes.Equal(b, want) {
+		t.Errorf("packed canonical name error: got %v - want %v", b, want)
+	}
+}
+
+func TestPackCanonical(t *testing.T) {
+	mx, err := PackName("Mail.Example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewRR("Example.", TypeMX, ClassIN, 300, append([]byte{0, 10}, mx...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rr.PackCanonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := NewRR("example.", TypeMX, ClassIN, 300, append([]byte{0, 10}, bytes.ToLower(mx)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantb, err := want.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, wantb) {
+		t.Errorf("packed canonical mx error: got %v - want %v", b, wantb)
+	}
+
+	// The RDATA of a TXT resource record isn't changed.
+	txt, err := NewRR("example.", TypeTXT, ClassIN, 300, []byte{2, 'H', 'i'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := txt.PackCanonical(); err != nil || !bytes.HasSuffix(b, []byte{2, 'H', 'i'}) {
+		t.Errorf("packed canonical txt error: got %v, %v - want unchanged rdata", b, err)
+	}
+}
+
+func TestSortCanonical(t *testing.T) {
+	newRR := func(name string, typ Type, rdata ...byte) RR {
+		rr, err := NewRR(name, typ, ClassIN, 300, rdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+	want := []RR{
+		newRR("example.", TypeA, 192, 0, 2, 1),
+		newRR("example.", TypeA, 192, 0, 2, 2),
+		newRR("example.", TypeTXT, 1, 'a'),
+		newRR("example.", TypeTXT, 2, 'a', 'a'),
+		newRR("a.example.", TypeA, 192, 0, 2, 3),
+		newRR("Z.a.example.", TypeA, 192, 0, 2, 4),
+		newRR("z.example.", TypeA, 192, 0, 2, 5),
+	}
+	rrs := []RR{want[6], want[3], want[5], want[1], want[4], want[2], want[0]}
+
+	SortCanonical(rrs)
+	for i := range want {
+		if rrs[i].Name != want[i].Name || !bytes.Equal(rrs[i].RData, want[i].RData) {
+			t.Errorf("sorted record %d error: got %s - want %s", i, rrs[i].String(), want[i].String())
+		}
+	}
+}
@@ -0,0 +1,1136 @@
+package dns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Algorithm represents a DNSSEC security algorithm.
+//
+// See: https://www.iana.org/assignments/dns-sec-alg-numbers
+type Algorithm uint8
+
+// String returns the string representation of a security algorithm.
+func (a Algorithm) String() string {
+	if s, ok := AlgorithmToString[a]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("%d", a)
+}
+
+const (
+	// AlgorithmRSASHA1 is RSA/SHA-1.
+	AlgorithmRSASHA1 Algorithm = 5
+
+	// AlgorithmRSASHA1NSEC3SHA1 is RSA/SHA-1 for NSEC3 zones.
+	AlgorithmRSASHA1NSEC3SHA1 Algorithm = 7
+
+	// AlgorithmRSASHA256 is RSA/SHA-256.
+	AlgorithmRSASHA256 Algorithm = 8
+
+	// AlgorithmRSASHA512 is RSA/SHA-512.
+	AlgorithmRSASHA512 Algorithm = 10
+
+	// AlgorithmECDSAP256SHA256 is ECDSA with curve P-256 and SHA-256.
+	AlgorithmECDSAP256SHA256 Algorithm = 13
+
+	// AlgorithmECDSAP384SHA384 is ECDSA with curve P-384 and SHA-384.
+	AlgorithmECDSAP384SHA384 Algorithm = 14
+
+	// AlgorithmED25519 is Ed25519.
+	AlgorithmED25519 Algorithm = 15
+)
+
+// AlgorithmToString maps a security algorithm to a string.
+var AlgorithmToString = map[Algorithm]string{
+	AlgorithmRSASHA1:          "RSASHA1",
+	AlgorithmRSASHA1NSEC3SHA1: "RSASHA1-NSEC3-SHA1",
+	AlgorithmRSASHA256:        "RSASHA256",
+	AlgorithmRSASHA512:        "RSASHA512",
+	AlgorithmECDSAP256SHA256:  "ECDSAP256SHA256",
+	AlgorithmECDSAP384SHA384:  "ECDSAP384SHA384",
+	AlgorithmED25519:          "ED25519",
+}
+
+// DigestType represents a DS record digest algorithm.
+//
+// See: https://www.iana.org/assignments/ds-rr-types
+type DigestType uint8
+
+// String returns the string representation of a digest algorithm.
+func (d DigestType) String() string {
+	if s, ok := DigestTypeToString[d]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("%d", d)
+}
+
+const (
+	// DigestTypeSHA1 is SHA-1.
+	DigestTypeSHA1 DigestType = 1
+
+	// DigestTypeSHA256 is SHA-256.
+	DigestTypeSHA256 DigestType = 2
+
+	// DigestTypeSHA384 is SHA-384.
+	DigestTypeSHA384 DigestType = 4
+)
+
+// DigestTypeToString maps a digest algorithm to a string.
+var DigestTypeToString = map[DigestType]string{
+	DigestTypeSHA1:   "SHA-1",
+	DigestTypeSHA256: "SHA-256",
+	DigestTypeSHA384: "SHA-384",
+}
+
+// RecordData is implemented by the typed RDATA of a resource record.
+type RecordData interface {
+	// Pack packs the RDATA fields into binary format.
+	Pack() ([]byte, error)
+
+	// Unpack unpacks the (uncompressed) RDATA bytes.
+	Unpack(rdata []byte) error
+
+	// String returns the presentation format of the RDATA.
+	String() string
+}
+
+// Decode unpacks RData into its typed representation. It returns an error when
+// the resource record type has no typed representation.
+func (r *RR) Decode() (RecordData, error) {
+	var rd RecordData
+	switch r.Type {
+	case TypeDS:
+		rd = new(DS)
+	case TypeRRSIG, TypeSIG:
+		rd = new(RRSIG)
+	case TypeNSEC:
+		rd = new(NSEC)
+	case TypeDNSKEY, TypeKEY:
+		rd = new(DNSKEY)
+	case TypeNSEC3:
+		rd = new(NSEC3)
+	case TypeNSEC3PARAM:
+		rd = new(NSEC3PARAM)
+	case TypeZONEMD:
+		rd = new(ZONEMD)
+	case TypeCAA:
+		rd = new(CAA)
+	case TypeSOA:
+		rd = new(SOA)
+	case TypeTSIG:
+		rd = new(TSIG)
+	default:
+		return nil, fmt.Errorf("no typed rdata for type %s", r.Type)
+	}
+
+	if err := rd.Unpack(r.RData); err != nil {
+		return nil, fmt.Errorf("failed to unpack %s rdata: %v", r.Type, err)
+	}
+
+	return rd, nil
+}
+
+// DNSKEY flags.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-2.1.1
+const (
+	// DNSKEYFlagZone marks a key as a DNS zone key.
+	DNSKEYFlagZone uint16 = 1 << 8
+
+	// DNSKEYFlagRevoke marks a key as revoked.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5011#section-7
+	DNSKEYFlagRevoke uint16 = 1 << 7
+
+	// DNSKEYFlagSEP marks a key as a Secure Entry Point (i.e. a KSK).
+	DNSKEYFlagSEP uint16 = 1 << 0
+)
+
+// DNSKEY holds a public key used to verify RRSIG records. Its RDATA has the
+// following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     FLAGS                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |       PROTOCOL        |       ALGORITHM       |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                   PUBLIC KEY                  /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-2.1
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm Algorithm
+	PublicKey []byte
+}
+
+// Pack packs the DNSKEY RDATA fields into binary format.
+func (k *DNSKEY) Pack() ([]byte, error) {
+	b := make([]byte, 4, 4+len(k.PublicKey))
+	binary.BigEndian.PutUint16(b, k.Flags)
+	b[2] = k.Protocol
+	b[3] = byte(k.Algorithm)
+	return append(b, k.PublicKey...), nil
+}
+
+// Unpack unpacks the DNSKEY RDATA bytes.
+func (k *DNSKEY) Unpack(rdata []byte) error {
+	if len(rdata) < 4 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	k.Flags = binary.BigEndian.Uint16(rdata)
+	k.Protocol = rdata[2]
+	k.Algorithm = Algorithm(rdata[3])
+	k.PublicKey = append([]byte{}, rdata[4:]...)
+	return nil
+}
+
+// String returns the presentation format of the DNSKEY RDATA.
+func (k *DNSKEY) String() string {
+	return fmt.Sprintf(
+		"%d %d %d %s",
+		k.Flags, k.Protocol, k.Algorithm,
+		base64.StdEncoding.EncodeToString(k.PublicKey),
+	)
+}
+
+// KeyTag calculates the key tag of the key, which is used to efficiently
+// select the key(s) that may have created a signature.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#appendix-B
+func (k *DNSKEY) KeyTag() uint16 {
+	rdata, _ := k.Pack()
+
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xffff
+
+	return uint16(ac & 0xffff)
+}
+
+// ToDS calculates the DS record of the key, where owner is the owner name of
+// the DNSKEY record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-5.1.4
+func (k *DNSKEY) ToDS(owner string, dt DigestType) (*DS, error) {
+	ownerb, err := packDomainName(CanonicalName(owner))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack owner name: %v", err)
+	}
+	rdata, err := k.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dnskey: %v", err)
+	}
+	data := append(ownerb, rdata...)
+
+	var digest []byte
+	switch dt {
+	case DigestTypeSHA1:
+		sum := sha1.Sum(data)
+		digest = sum[:]
+	case DigestTypeSHA256:
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	case DigestTypeSHA384:
+		sum := sha512.Sum384(data)
+		digest = sum[:]
+	default:
+		return nil, fmt.Errorf("unsupported digest type %d", dt)
+	}
+
+	ds := &DS{
+		KeyTag:     k.KeyTag(),
+		Algorithm:  k.Algorithm,
+		DigestType: dt,
+		Digest:     digest,
+	}
+	return ds, nil
+}
+
+// publicKey returns the crypto public key of the DNSKEY.
+func (k *DNSKEY) publicKey() (crypto.PublicKey, error) {
+	switch k.Algorithm {
+	// The public key consists of the exponent length (1 or 3 bytes), the
+	// exponent, and the modulus.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3110#section-2
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256,
+		AlgorithmRSASHA512:
+		b := k.PublicKey
+		if len(b) < 3 {
+			return nil, fmt.Errorf("rsa public key too short")
+		}
+		elen := int(b[0])
+		b = b[1:]
+		if elen == 0 {
+			elen = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		}
+		if elen > 4 || len(b) <= elen {
+			return nil, fmt.Errorf("invalid rsa public key exponent")
+		}
+		e := 0
+		for _, eb := range b[:elen] {
+			e = e<<8 | int(eb)
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(b[elen:]),
+			E: e,
+		}
+		return pub, nil
+
+	// The public key consists of the X and Y coordinates of the curve point.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc6605#section-4
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		curve := elliptic.P256()
+		if k.Algorithm == AlgorithmECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		size := curve.Params().BitSize / 8
+		if len(k.PublicKey) != size*2 {
+			return nil, fmt.Errorf("invalid ecdsa public key length")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(k.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(k.PublicKey[size:]),
+		}
+		return pub, nil
+
+	// See: https://datatracker.ietf.org/doc/html/rfc8080#section-3
+	case AlgorithmED25519:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key length")
+		}
+		return ed25519.PublicKey(k.PublicKey), nil
+	}
+
+	return nil, fmt.Errorf("unsupported algorithm %s", k.Algorithm)
+}
+
+// DS refers to a DNSKEY record, and is used in the DNSKEY authentication
+// process. Its RDATA has the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    KEY TAG                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |       ALGORITHM       |      DIGEST TYPE      |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                     DIGEST                    /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-5.1
+type DS struct {
+	KeyTag     uint16
+	Algorithm  Algorithm
+	DigestType DigestType
+	Digest     []byte
+}
+
+// Pack packs the DS RDATA fields into binary format.
+func (d *DS) Pack() ([]byte, error) {
+	b := make([]byte, 4, 4+len(d.Digest))
+	binary.BigEndian.PutUint16(b, d.KeyTag)
+	b[2] = byte(d.Algorithm)
+	b[3] = byte(d.DigestType)
+	return append(b, d.Digest...), nil
+}
+
+// Unpack unpacks the DS RDATA bytes.
+func (d *DS) Unpack(rdata []byte) error {
+	if len(rdata) < 4 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	d.KeyTag = binary.BigEndian.Uint16(rdata)
+	d.Algorithm = Algorithm(rdata[2])
+	d.DigestType = DigestType(rdata[3])
+	d.Digest = append([]byte{}, rdata[4:]...)
+	return nil
+}
+
+// String returns the presentation format of the DS RDATA.
+func (d *DS) String() string {
+	return fmt.Sprintf(
+		"%d %d %d %s",
+		d.KeyTag, d.Algorithm, d.DigestType,
+		strings.ToUpper(hex.EncodeToString(d.Digest)),
+	)
+}
+
+// Equal reports whether both DS records refer to the same key with the same
+// digest.
+func (d *DS) Equal(o *DS) bool {
+	return d.KeyTag == o.KeyTag &&
+		d.Algorithm == o.Algorithm &&
+		d.DigestType == o.DigestType &&
+		bytes.Equal(d.Digest, o.Digest)
+}
+
+// RRSIG holds the signature of a resource record set. Its RDATA has the
+// following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                  TYPE COVERED                 |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |       ALGORITHM       |        LABELS         |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                  ORIGINAL TTL                 |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |             SIGNATURE EXPIRATION              |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |              SIGNATURE INCEPTION              |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    KEY TAG                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                  SIGNER'S NAME                /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                   SIGNATURE                   /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.1
+type RRSIG struct {
+	TypeCovered Type
+	Algorithm   Algorithm
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+// Pack packs the RRSIG RDATA fields into binary format.
+func (s *RRSIG) Pack() ([]byte, error) {
+	b, err := s.packWithoutSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, s.Signature...), nil
+}
+
+// packWithoutSignature packs all RRSIG RDATA fields, except the signature, into
+// binary format. The signer's name is packed in canonical form.
+func (s *RRSIG) packWithoutSignature() ([]byte, error) {
+	b := make([]byte, 18)
+	binary.BigEndian.PutUint16(b, uint16(s.TypeCovered))
+	b[2] = byte(s.Algorithm)
+	b[3] = s.Labels
+	binary.BigEndian.PutUint32(b[4:], s.OrigTTL)
+	binary.BigEndian.PutUint32(b[8:], s.Expiration)
+	binary.BigEndian.PutUint32(b[12:], s.Inception)
+	binary.BigEndian.PutUint16(b[16:], s.KeyTag)
+
+	nameb, err := packDomainName(CanonicalName(s.SignerName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack signer's name: %v", err)
+	}
+
+	return append(b, nameb...), nil
+}
+
+// Unpack unpacks the RRSIG RDATA bytes.
+func (s *RRSIG) Unpack(rdata []byte) error {
+	if len(rdata) < 19 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	s.TypeCovered = Type(binary.BigEndian.Uint16(rdata))
+	s.Algorithm = Algorithm(rdata[2])
+	s.Labels = rdata[3]
+	s.OrigTTL = binary.BigEndian.Uint32(rdata[4:])
+	s.Expiration = binary.BigEndian.Uint32(rdata[8:])
+	s.Inception = binary.BigEndian.Uint32(rdata[12:])
+	s.KeyTag = binary.BigEndian.Uint16(rdata[16:])
+
+	name, offn, _, err := unpackDomainName(rdata, 18)
+	if err != nil {
+		return fmt.Errorf("failed to unpack signer's name: %v", err)
+	}
+	s.SignerName = name
+	s.Signature = append([]byte{}, rdata[offn:]...)
+	return nil
+}
+
+// String returns the presentation format of the RRSIG RDATA.
+func (s *RRSIG) String() string {
+	return fmt.Sprintf(
+		"%s %d %d %d %s %s %d %s %s",
+		s.TypeCovered, s.Algorithm, s.Labels, s.OrigTTL,
+		formatSigTime(s.Expiration), formatSigTime(s.Inception),
+		s.KeyTag, s.SignerName,
+		base64.StdEncoding.EncodeToString(s.Signature),
+	)
+}
+
+// formatSigTime formats a signature expiration or inception time as
+// YYYYMMDDHHmmSS.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.2
+func formatSigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+// ValidAt reports whether t is within the signature validity period. The
+// inception and expiration times are compared using serial number arithmetic.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.1.5
+func (s *RRSIG) ValidAt(t time.Time) bool {
+	now := uint32(t.Unix())
+	return int32(now-s.Inception) >= 0 && int32(s.Expiration-now) >= 0
+}
+
+// Verify verifies the signature over the resource record set with the key.
+// The resource record set must consist of all resource records with the same
+// owner name, class and type covered by the signature.
+//
+// A revoked key is not rejected, because it's used to prove its own
+// revocation. Validators must not use revoked keys for anything else.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.3
+func (s *RRSIG) Verify(key *DNSKEY, rrset []RR) error {
+	if len(rrset) == 0 {
+		return fmt.Errorf("empty rrset")
+	}
+	if key.Flags&DNSKEYFlagZone == 0 {
+		return fmt.Errorf("dnskey is not a zone key")
+	}
+	if key.Protocol != 3 {
+		return fmt.Errorf("invalid dnskey protocol %d", key.Protocol)
+	}
+	if key.Algorithm != s.Algorithm || key.KeyTag() != s.KeyTag {
+		return fmt.Errorf("dnskey does not match signature")
+	}
+	for _, rr := range rrset {
+		if rr.Type != s.TypeCovered {
+			return fmt.Errorf("rrset type %s not covered by signature", rr.Type)
+		}
+		if !IsSubDomain(s.SignerName, rr.Name) {
+			return fmt.Errorf(
+				"signer %s not authoritative for %s", s.SignerName, rr.Name,
+			)
+		}
+	}
+
+	data, err := s.signedData(rrset)
+	if err != nil {
+		return fmt.Errorf("failed to create signed data: %v", err)
+	}
+
+	return verifyData(key, s.Algorithm, data, s.Signature)
+}
+
+// Sign signs the resource record set with the private key, and sets the
+// signature. All other RRSIG fields must be set before signing.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.1.8.1
+func (s *RRSIG) Sign(priv crypto.Signer, rrset []RR) error {
+	if len(rrset) == 0 {
+		return fmt.Errorf("empty rrset")
+	}
+
+	data, err := s.signedData(rrset)
+	if err != nil {
+		return fmt.Errorf("failed to create signed data: %v", err)
+	}
+
+	sig, err := signData(priv, s.Algorithm, data)
+	if err != nil {
+		return err
+	}
+	s.Signature = sig
+
+	return nil
+}
+
+// signData signs the data with the private key, using the algorithm.
+func signData(priv crypto.Signer, alg Algorithm, data []byte) ([]byte, error) {
+	switch alg {
+	case AlgorithmED25519:
+		return priv.Sign(rand.Reader, data, crypto.Hash(0))
+
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		k, ok := priv.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key is not an ecdsa key")
+		}
+		var digest []byte
+		if alg == AlgorithmECDSAP384SHA384 {
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		} else {
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			return nil, err
+		}
+
+		// The signature consists of R and S, each padded to the curve size.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc6605#section-4
+		size := k.Curve.Params().BitSize / 8
+		return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...), nil
+
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256,
+		AlgorithmRSASHA512:
+		h := crypto.SHA256
+		switch alg {
+		case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1:
+			h = crypto.SHA1
+		case AlgorithmRSASHA512:
+			h = crypto.SHA512
+		}
+		hh := h.New()
+		hh.Write(data)
+		return priv.Sign(rand.Reader, hh.Sum(nil), h)
+	}
+
+	return nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// verifyData verifies the signature over the data with the key, using the
+// algorithm.
+func verifyData(key *DNSKEY, alg Algorithm, data, sig []byte) error {
+	pub, err := key.publicKey()
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %v", err)
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		h := crypto.SHA256
+		switch alg {
+		case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1:
+			h = crypto.SHA1
+		case AlgorithmRSASHA512:
+			h = crypto.SHA512
+		}
+		hh := h.New()
+		hh.Write(data)
+		return rsa.VerifyPKCS1v15(pub, h, hh.Sum(nil), sig)
+
+	case *ecdsa.PublicKey:
+		var digest []byte
+		if alg == AlgorithmECDSAP384SHA384 {
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		} else {
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		}
+		size := pub.Curve.Params().BitSize / 8
+		if len(sig) != size*2 {
+			return fmt.Errorf("invalid ecdsa signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("ecdsa signature verification failed")
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return fmt.Errorf("ed25519 signature verification failed")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// signedData creates the data covered by the signature; the RRSIG RDATA
+// (without the signature) followed by the resource record set in canonical
+// form and canonical order.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.1.8.1
+func (s *RRSIG) signedData(rrset []RR) ([]byte, error) {
+	data, err := s.packWithoutSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	records := [][]byte{}
+	for _, rr := range rrset {
+		owner := CanonicalName(rr.Name)
+
+		// When the owner name has more labels than the signature, the resource
+		// record was synthesized from a wildcard.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.2
+		labels := strings.Split(strings.TrimSuffix(owner, "."), ".")
+		if owner != "." && len(labels) > int(s.Labels) {
+			owner = "*." + strings.Join(labels[len(labels)-int(s.Labels):], ".") + "."
+			if s.Labels == 0 {
+				owner = "*."
+			}
+		}
+
+		crr := rr
+		crr.Name = owner
+		crr.TTL = s.OrigTTL
+		b, err := crr.PackCanonical()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, b)
+	}
+
+	// Sort the resource records by their canonical RDATA. Because all records
+	// share the same owner name, type, class and TTL, sorting the packed records
+	// is equivalent.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.3
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i], records[j]) < 0
+	})
+
+	for i, b := range records {
+		// Duplicate resource records are only included once.
+		if i > 0 && bytes.Equal(b, records[i-1]) {
+			continue
+		}
+		data = append(data, b...)
+	}
+
+	return data, nil
+}
+
+// NSEC lists the next owner name (in canonical ordering) of the zone, and the
+// set of record types present at the owner name. Its RDATA has the following
+// format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /               NEXT DOMAIN NAME                /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                 TYPE BIT MAPS                 /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-4.1
+type NSEC struct {
+	NextDomain string
+	TypeBitMap []Type
+}
+
+// Pack packs the NSEC RDATA fields into binary format.
+func (n *NSEC) Pack() ([]byte, error) {
+	b, err := packDomainName(n.NextDomain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack next domain name: %v", err)
+	}
+
+	return append(b, packTypeBitMap(n.TypeBitMap)...), nil
+}
+
+// Unpack unpacks the NSEC RDATA bytes.
+func (n *NSEC) Unpack(rdata []byte) error {
+	if len(rdata) < 1 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	name, offn, _, err := unpackDomainName(rdata, 0)
+	if err != nil {
+		return fmt.Errorf("failed to unpack next domain name: %v", err)
+	}
+	n.NextDomain = name
+
+	types, err := unpackTypeBitMap(rdata[offn:])
+	if err != nil {
+		return fmt.Errorf("failed to unpack type bit map: %v", err)
+	}
+	n.TypeBitMap = types
+	return nil
+}
+
+// String returns the presentation format of the NSEC RDATA.
+func (n *NSEC) String() string {
+	return strings.TrimSpace(n.NextDomain + " " + formatTypes(n.TypeBitMap))
+}
+
+// HasType reports whether the type bit map contains the type.
+func (n *NSEC) HasType(t Type) bool {
+	return hasType(n.TypeBitMap, t)
+}
+
+// Covers reports whether the name falls between the owner name and the next
+// domain name (in canonical ordering), which proves the name doesn't exist.
+func (n *NSEC) Covers(owner, name string) bool {
+	return covers(owner, n.NextDomain, name)
+}
+
+// NSEC3 hash algorithms.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-11
+const (
+	// NSEC3HashSHA1 is SHA-1.
+	NSEC3HashSHA1 uint8 = 1
+)
+
+// NSEC3FlagOptOut marks that the NSEC3 record may cover unsigned delegations.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-3.1.2.1
+const NSEC3FlagOptOut uint8 = 1
+
+// NSEC3 provides authenticated denial of existence using hashed owner names.
+// Its RDATA has the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |     HASH ALGORITHM    |         FLAGS         |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                   ITERATIONS                  |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |      SALT LENGTH      |         SALT          /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |      HASH LENGTH      |  NEXT HASHED OWNER    /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                 TYPE BIT MAPS                 /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-3.2
+type NSEC3 struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+	NextHashed    []byte
+	TypeBitMap    []Type
+}
+
+// Pack packs the NSEC3 RDATA fields into binary format.
+func (n *NSEC3) Pack() ([]byte, error) {
+	b := make([]byte, 4)
+	b[0] = n.HashAlgorithm
+	b[1] = n.Flags
+	binary.BigEndian.PutUint16(b[2:], n.Iterations)
+	b = append(b, byte(len(n.Salt)))
+	b = append(b, n.Salt...)
+	b = append(b, byte(len(n.NextHashed)))
+	b = append(b, n.NextHashed...)
+	return append(b, packTypeBitMap(n.TypeBitMap)...), nil
+}
+
+// Unpack unpacks the NSEC3 RDATA bytes.
+func (n *NSEC3) Unpack(rdata []byte) error {
+	if len(rdata) < 5 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	n.HashAlgorithm = rdata[0]
+	n.Flags = rdata[1]
+	n.Iterations = binary.BigEndian.Uint16(rdata[2:])
+	off := 4
+
+	saltLen := int(rdata[off])
+	off++
+	if off+saltLen >= len(rdata) {
+		return fmt.Errorf("invalid salt length %d", saltLen)
+	}
+	n.Salt = append([]byte{}, rdata[off:off+saltLen]...)
+	off += saltLen
+
+	hashLen := int(rdata[off])
+	off++
+	if off+hashLen > len(rdata) {
+		return fmt.Errorf("invalid hash length %d", hashLen)
+	}
+	n.NextHashed = append([]byte{}, rdata[off:off+hashLen]...)
+	off += hashLen
+
+	types, err := unpackTypeBitMap(rdata[off:])
+	if err != nil {
+		return fmt.Errorf("failed to unpack type bit map: %v", err)
+	}
+	n.TypeBitMap = types
+	return nil
+}
+
+// String returns the presentation format of the NSEC3 RDATA.
+func (n *NSEC3) String() string {
+	return strings.TrimSpace(fmt.Sprintf(
+		"%d %d %d %s %s %s",
+		n.HashAlgorithm, n.Flags, n.Iterations, formatSalt(n.Salt),
+		base32HexEncoding.EncodeToString(n.NextHashed),
+		formatTypes(n.TypeBitMap),
+	))
+}
+
+// HasType reports whether the type bit map contains the type.
+func (n *NSEC3) HasType(t Type) bool {
+	return hasType(n.TypeBitMap, t)
+}
+
+// NextHashedOwner returns the next hashed owner name as a (lower case) label,
+// the way it appears in the owner name of the next NSEC3 record.
+func (n *NSEC3) NextHashedOwner() string {
+	return strings.ToLower(base32HexEncoding.EncodeToString(n.NextHashed))
+}
+
+// Match reports whether the owner name of the NSEC3 record (i.e. the hashed
+// owner name followed by the zone name) matches the hash of the name.
+func (n *NSEC3) Match(owner, name string) bool {
+	hash, zone := splitNSEC3Owner(owner)
+	if !IsSubDomain(zone, name) {
+		return false
+	}
+
+	return hash == HashName(name, n.HashAlgorithm, n.Iterations, n.Salt)
+}
+
+// Covers reports whether the hash of the name falls between the hashed owner
+// name and the next hashed owner name, which proves the name doesn't exist.
+func (n *NSEC3) Covers(owner, name string) bool {
+	hash, zone := splitNSEC3Owner(owner)
+	if !IsSubDomain(zone, name) {
+		return false
+	}
+
+	next := n.NextHashedOwner()
+	h := HashName(name, n.HashAlgorithm, n.Iterations, n.Salt)
+
+	// The last NSEC3 record in the zone wraps around to the first.
+	if hash >= next {
+		return h > hash || h < next
+	}
+	return h > hash && h < next
+}
+
+// NSEC3PARAM holds the NSEC3 parameters used by authoritative name servers to
+// calculate hashed owner names. Its RDATA has the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |     HASH ALGORITHM    |         FLAGS         |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                   ITERATIONS                  |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |      SALT LENGTH      |         SALT          /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-4.2
+type NSEC3PARAM struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+}
+
+// Pack packs the NSEC3PARAM RDATA fields into binary format.
+func (n *NSEC3PARAM) Pack() ([]byte, error) {
+	b := make([]byte, 4)
+	b[0] = n.HashAlgorithm
+	b[1] = n.Flags
+	binary.BigEndian.PutUint16(b[2:], n.Iterations)
+	b = append(b, byte(len(n.Salt)))
+	return append(b, n.Salt...), nil
+}
+
+// Unpack unpacks the NSEC3PARAM RDATA bytes.
+func (n *NSEC3PARAM) Unpack(rdata []byte) error {
+	if len(rdata) < 5 {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	n.HashAlgorithm = rdata[0]
+	n.Flags = rdata[1]
+	n.Iterations = binary.BigEndian.Uint16(rdata[2:])
+	saltLen := int(rdata[4])
+	if 5+saltLen > len(rdata) {
+		return fmt.Errorf("invalid salt length %d", saltLen)
+	}
+	n.Salt = append([]byte{}, rdata[5:5+saltLen]...)
+	return nil
+}
+
+// String returns the presentation format of the NSEC3PARAM RDATA.
+func (n *NSEC3PARAM) String() string {
+	return fmt.Sprintf(
+		"%d %d %d %s",
+		n.HashAlgorithm, n.Flags, n.Iterations, formatSalt(n.Salt),
+	)
+}
+
+// base32HexEncoding is the "Base 32 Encoding with Extended Hex Alphabet"
+// without padding, used for NSEC3 hashed owner names.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-3.3
+var base32HexEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// HashName calculates the NSEC3 hashed owner name label of a name (lower case
+// base32hex).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-5
+func HashName(name string, alg uint8, iterations uint16, salt []byte) string {
+	if alg != NSEC3HashSHA1 {
+		return ""
+	}
+
+	nameb, err := packDomainName(CanonicalName(name))
+	if err != nil {
+		return ""
+	}
+
+	h := sha1.Sum(append(nameb, salt...))
+	for i := 0; i < int(iterations); i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+
+	return strings.ToLower(base32HexEncoding.EncodeToString(h[:]))
+}
+
+// splitNSEC3Owner splits the owner name of an NSEC3 record into the (lower
+// case) hashed owner name label and the zone name.
+func splitNSEC3Owner(owner string) (string, string) {
+	i := strings.Index(owner, ".")
+	if i < 0 {
+		return strings.ToLower(owner), "."
+	}
+
+	return strings.ToLower(owner[:i]), owner[i+1:]
+}
+
+// formatSalt formats an NSEC3 salt as hex, or "-" when empty.
+func formatSalt(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+
+	return strings.ToUpper(hex.EncodeToString(salt))
+}
+
+// formatTypes formats a list of types separated by spaces.
+func formatTypes(types []Type) string {
+	s := make([]string, 0, len(types))
+	for _, t := range types {
+		s = append(s, t.String())
+	}
+
+	return strings.Join(s, " ")
+}
+
+// hasType reports whether the list of types contains the type.
+func hasType(types []Type, t Type) bool {
+	for _, tt := range types {
+		if tt == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers reports whether the name sorts (in canonical ordering) after owner
+// and before next, where the last record in the zone wraps around to the
+// first.
+func covers(owner, next, name string) bool {
+	if CompareDomainName(owner, next) >= 0 {
+		return CompareDomainName(name, owner) > 0 ||
+			CompareDomainName(name, next) < 0
+	}
+
+	return CompareDomainName(name, owner) > 0 &&
+		CompareDomainName(name, next) < 0
+}
+
+// packTypeBitMap packs a list of types into the windowed type bit map format;
+// each window consists of the window number, the bitmap length, and the bitmap
+// of the types in the window.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-4.1.2
+func packTypeBitMap(types []Type) []byte {
+	sorted := append([]Type{}, types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	b := []byte{}
+	window := -1
+	var bitmap []byte
+	flush := func() {
+		if window >= 0 {
+			b = append(b, byte(window), byte(len(bitmap)))
+			b = append(b, bitmap...)
+		}
+	}
+	for _, t := range sorted {
+		w := int(t >> 8)
+		if w != window {
+			flush()
+			window = w
+			bitmap = []byte{}
+		}
+		i := int(t&0xff) / 8
+		for len(bitmap) <= i {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[i] |= 0x80 >> (t & 0xff % 8)
+	}
+	flush()
+
+	return b
+}
+
+// unpackTypeBitMap unpacks the windowed type bit map format into a list of
+// types.
+func unpackTypeBitMap(b []byte) ([]Type, error) {
+	types := []Type{}
+	for off := 0; off < len(b); {
+		if off+2 > len(b) {
+			return nil, fmt.Errorf("truncated window header")
+		}
+		window := int(b[off])
+		size := int(b[off+1])
+		off += 2
+		if size == 0 || size > 32 || off+size > len(b) {
+			return nil, fmt.Errorf("invalid bitmap length %d", size)
+		}
+		for i, octet := range b[off : off+size] {
+			for bit := 0; bit < 8; bit++ {
+				if octet&(0x80>>bit) != 0 {
+					types = append(types, Type(window<<8|i*8+bit))
+				}
+			}
+		}
+		off += size
+	}
+
+	return types, nil
+}
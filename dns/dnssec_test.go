@@ -0,0 +1,153 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rootKSK2017 is the root zone Key Signing Key with key tag 20326.
+const rootKSK2017 = "AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3+/4RgWOq" +
+	"7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kvArMtNROxVQuCaSnI" +
+	"DdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3rCj/EWgvIWgb" +
+	"9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7LjVc1uTId" +
+	"sIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB5qih" +
+	"ylGa8subX2Nn6UwNR1AkUTV74bU="
+
+func TestDNSKEYToDS(t *testing.T) {
+	pub, err := base64.StdEncoding.DecodeString(rootKSK2017)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := DNSKEY{
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: AlgorithmRSASHA256,
+		PublicKey: pub,
+	}
+
+	if tag := key.KeyTag(); tag != 20326 {
+		t.Errorf("dnskey key tag error: got %v - want %v", tag, 20326)
+	}
+
+	ds, err := key.ToDS(".", DigestTypeSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+	if got := strings.ToUpper(hex.EncodeToString(ds.Digest)); got != want {
+		t.Errorf("ds digest error: got %v - want %v", got, want)
+	}
+}
+
+func TestRRSIGVerify(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPub := append(ecPriv.X.FillBytes(make([]byte, 32)), ecPriv.Y.FillBytes(make([]byte, 32))...)
+
+	tests := []struct {
+		alg  Algorithm
+		pub  []byte
+		priv crypto.Signer
+	}{
+		{alg: AlgorithmED25519, pub: edPub, priv: edPriv},
+		{alg: AlgorithmECDSAP256SHA256, pub: ecPub, priv: ecPriv},
+	}
+
+	for _, tt := range tests {
+		key := DNSKEY{
+			Flags:     DNSKEYFlagZone,
+			Protocol:  3,
+			Algorithm: tt.alg,
+			PublicKey: tt.pub,
+		}
+		rrset := []RR{
+			{Name: "WWW.Example.com.", Type: TypeA, Class: ClassIN, TTL: 60, RData: net.IPv4(192, 0, 2, 2).To4()},
+			{Name: "www.example.com.", Type: TypeA, Class: ClassIN, TTL: 60, RData: net.IPv4(192, 0, 2, 1).To4()},
+		}
+		now := time.Now()
+		sig := RRSIG{
+			TypeCovered: TypeA,
+			Algorithm:   tt.alg,
+			Labels:      3,
+			OrigTTL:     300,
+			Expiration:  uint32(now.Add(time.Hour).Unix()),
+			Inception:   uint32(now.Add(-time.Hour).Unix()),
+			KeyTag:      key.KeyTag(),
+			SignerName:  "example.com.",
+		}
+		if err := sig.Sign(tt.priv, rrset); err != nil {
+			t.Fatal(err)
+		}
+
+		if !sig.ValidAt(now) {
+			t.Errorf("%s signature validity error: got %v - want %v", tt.alg, false, true)
+		}
+
+		// The order of the resource record set must not matter.
+		rrset[0], rrset[1] = rrset[1], rrset[0]
+		if err := sig.Verify(&key, rrset); err != nil {
+			t.Errorf("%s signature verification error: %v", tt.alg, err)
+		}
+
+		rrset[0].RData = net.IPv4(192, 0, 2, 3).To4()
+		if err := sig.Verify(&key, rrset); err == nil {
+			t.Errorf("%s tampered signature verification error: got nil - want error", tt.alg)
+		}
+	}
+}
+
+func TestNSECPackUnpack(t *testing.T) {
+	nsec := NSEC{
+		NextDomain: "host.example.com.",
+		TypeBitMap: []Type{TypeA, TypeMX, TypeRRSIG, TypeNSEC, Type(1234)},
+	}
+
+	b, err := nsec.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := new(NSEC)
+	if err := n.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if n.String() != nsec.String() {
+		t.Errorf("unpacked nsec error: got %v - want %v", n.String(), nsec.String())
+	}
+	if !n.HasType(TypeMX) || n.HasType(TypeNS) {
+		t.Errorf("unpacked nsec type bit map error: got %v", n.TypeBitMap)
+	}
+	if !n.Covers("alfa.example.com.", "bravo.example.com.") {
+		t.Errorf("nsec covers error: got %v - want %v", false, true)
+	}
+}
+
+func TestHashName(t *testing.T) {
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#appendix-A
+	salt := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+	tests := map[string]string{
+		"example.":   "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom",
+		"a.example.": "35mthgpgcu1qg68fab165klnsnk3dpvl",
+	}
+
+	for name, want := range tests {
+		if got := HashName(name, NSEC3HashSHA1, 12, salt); got != want {
+			t.Errorf("hashed name %s error: got %v - want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package dns implements the DNS message format; it packs and unpacks
+// messages, questions and resource records to and from their binary (wire)
+// format, and provides the DNSSEC primitives to verify resource record set
+// signatures.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035
+package dns
@@ -0,0 +1,151 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	// DefaultClientSubnetPrefixIPv4 is the prefix length of the IPv4 address of
+	// a client that's sent in the ECS option by default.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7871#section-11.1
+	DefaultClientSubnetPrefixIPv4 = 24
+
+	// DefaultClientSubnetPrefixIPv6 is the prefix length of the IPv6 address of
+	// a client that's sent in the ECS option by default.
+	DefaultClientSubnetPrefixIPv6 = 56
+)
+
+// ClientSubnet is the EDNS Client Subnet (ECS) option, which conveys the
+// subnet of the client a recursive resolver queries for, so authoritative name
+// servers can tailor their answers (e.g. by geolocation). The scope prefix
+// length of a response tells which part of the subnet the answer covers. Its
+// OPTION-DATA has the following format:
+//
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                            FAMILY                             |
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |     SOURCE PREFIX-LENGTH      |     SCOPE PREFIX-LENGTH       |
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                           ADDRESS...                          /
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//
+// The address is truncated to the bytes that the source prefix length covers.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7871#section-6
+type ClientSubnet struct {
+	// SourcePrefix is the number of leading bits of the address that are used.
+	SourcePrefix uint8
+
+	// ScopePrefix is the number of leading bits of the address the answer
+	// covers; it must be 0 in queries.
+	ScopePrefix uint8
+
+	// Address is the IPv4 or IPv6 address of the subnet.
+	Address net.IP
+}
+
+// NewClientSubnet creates the ECS option of the subnet (for a query).
+func NewClientSubnet(subnet *net.IPNet) *ClientSubnet {
+	ones, _ := subnet.Mask.Size()
+
+	return &ClientSubnet{
+		SourcePrefix: uint8(ones),
+		Address:      subnet.IP.Mask(subnet.Mask),
+	}
+}
+
+// family returns the address family (1 for IPv4, 2 for IPv6) and the address
+// length of the subnet.
+//
+// See: https://www.iana.org/assignments/address-family-numbers
+func (s *ClientSubnet) family() (uint16, int) {
+	if s.Address.To4() != nil {
+		return 1, net.IPv4len
+	}
+
+	return 2, net.IPv6len
+}
+
+// Pack packs the ECS option fields into binary format.
+func (s *ClientSubnet) Pack() ([]byte, error) {
+	if s.Address.To16() == nil {
+		return nil, fmt.Errorf("invalid address %v", s.Address)
+	}
+	family, size := s.family()
+	if int(s.SourcePrefix) > size*8 || int(s.ScopePrefix) > size*8 {
+		return nil, fmt.Errorf("invalid prefix length for address %s", s.Address)
+	}
+	addr := s.Address.To16()
+	if family == 1 {
+		addr = s.Address.To4()
+	}
+	addr = addr.Mask(net.CIDRMask(int(s.SourcePrefix), size*8))
+
+	b := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint16(b, family)
+	b[2], b[3] = s.SourcePrefix, s.ScopePrefix
+	return append(b, addr[:(s.SourcePrefix+7)/8]...), nil
+}
+
+// Unpack unpacks the ECS option bytes.
+func (s *ClientSubnet) Unpack(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("option data too short: %d bytes", len(data))
+	}
+
+	var size int
+	switch family := binary.BigEndian.Uint16(data); family {
+	case 1:
+		size = net.IPv4len
+	case 2:
+		size = net.IPv6len
+	default:
+		return fmt.Errorf("unsupported address family %d", family)
+	}
+	source, scope := data[2], data[3]
+	if int(source) > size*8 || int(scope) > size*8 {
+		return fmt.Errorf("invalid prefix length")
+	}
+	if len(data)-4 != (int(source)+7)/8 {
+		return fmt.Errorf("invalid address length %d", len(data)-4)
+	}
+
+	s.SourcePrefix, s.ScopePrefix = source, scope
+	s.Address = make(net.IP, size)
+	copy(s.Address, data[4:])
+	return nil
+}
+
+// String returns the "dig like" presentation format of the ECS option
+// (address/source/scope).
+func (s *ClientSubnet) String() string {
+	return fmt.Sprintf("%s/%d/%d", s.Address, s.SourcePrefix, s.ScopePrefix)
+}
+
+// SetClientSubnet sets the ECS option of the message (see SetEDNS0Option).
+func (m *Msg) SetClientSubnet(s *ClientSubnet) error {
+	data, err := s.Pack()
+	if err != nil {
+		return err
+	}
+
+	return m.SetEDNS0Option(EDNSOption{Code: EDNSOptionClientSubnet, Data: data})
+}
+
+// ClientSubnet returns the ECS option of the message, or nil when it doesn't
+// have one.
+func (m *Msg) ClientSubnet() (*ClientSubnet, error) {
+	o, err := m.EDNS0Option(EDNSOptionClientSubnet)
+	if err != nil || o == nil {
+		return nil, err
+	}
+	s := new(ClientSubnet)
+	if err := s.Unpack(o.Data); err != nil {
+		return nil, fmt.Errorf("invalid ECS option: %v", err)
+	}
+
+	return s, nil
+}
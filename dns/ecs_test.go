@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestClientSubnetPackUnpack(t *testing.T) {
+	tests := []struct {
+		subnet string
+		want   []byte
+	}{
+		{"192.0.2.77/24", []byte{0, 1, 24, 0, 192, 0, 2}},
+		{"192.0.2.77/21", []byte{0, 1, 21, 0, 192, 0, 0}},
+		{"2001:db8:1234:5678::1/56", []byte{0, 2, 56, 0, 0x20, 0x01, 0x0d, 0xb8, 0x12, 0x34, 0x56}},
+		{"0.0.0.0/0", []byte{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		_, subnet, err := net.ParseCIDR(tt.subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewClientSubnet(subnet).Pack()
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", tt.subnet, err)
+		}
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("%s: got %v - want %v", tt.subnet, b, tt.want)
+		}
+
+		cs := new(ClientSubnet)
+		if err := cs.Unpack(b); err != nil {
+			t.Fatalf("%s: failed to unpack: %v", tt.subnet, err)
+		}
+		if !subnet.IP.Equal(cs.Address) || cs.SourcePrefix != NewClientSubnet(subnet).SourcePrefix {
+			t.Errorf("%s: got %s", tt.subnet, cs)
+		}
+	}
+
+	invalid := [][]byte{
+		{0, 1, 24},
+		{0, 3, 0, 0},
+		{0, 1, 33, 0, 192, 0, 2, 0, 0},
+		{0, 1, 24, 0, 192, 0},
+		{0, 1, 24, 0, 192, 0, 2, 1},
+	}
+	for _, b := range invalid {
+		if err := new(ClientSubnet).Unpack(b); err == nil {
+			t.Errorf("%v: got no error", b)
+		}
+	}
+}
+
+func TestMsgClientSubnet(t *testing.T) {
+	m := new(Msg)
+	if err := m.SetQuery("example.com.", TypeA); err != nil {
+		t.Fatal(err)
+	}
+	_, subnet, _ := net.ParseCIDR("198.51.100.0/24")
+	if err := m.SetClientSubnet(NewClientSubnet(subnet)); err != nil {
+		t.Fatalf("failed to set client subnet: %v", err)
+	}
+
+	// Setting EDNS(0) again keeps the option.
+	m.SetEDNS0(4096, true)
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = new(Msg)
+	if _, err := m.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if opt := m.OPT(); opt == nil || opt.UDPSize() != 4096 || !opt.DO() {
+		t.Fatalf("opt error: got %v", opt)
+	}
+
+	cs, err := m.ClientSubnet()
+	if err != nil || cs == nil {
+		t.Fatalf("failed to get client subnet: %v", err)
+	}
+	if got, want := cs.String(), "198.51.100.0/24/0"; got != want {
+		t.Errorf("got %s - want %s", got, want)
+	}
+	want := "; EDNS: version: 0, flags: do; udp: 4096\n; CLIENT-SUBNET: 198.51.100.0/24/0"
+	if got := m.OPT().String(); got != want {
+		t.Errorf("opt string error: got %q - want %q", got, want)
+	}
+}
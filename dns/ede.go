@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// EDECode represents the INFO-CODE of an Extended DNS Error.
+//
+// See: https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#extended-dns-error-codes
+type EDECode uint16
+
+// String returns the string representation of an Extended DNS Error code.
+func (c EDECode) String() string {
+	if s, ok := EDECodeToString[c]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("%d", c)
+}
+
+// Extended DNS Error codes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8914#section-4
+const (
+	// EDEOther means the error doesn't match another code; the extra text
+	// explains it.
+	EDEOther EDECode = 0
+
+	// EDEUnsupportedDNSKEYAlgorithm means the DNSKEY algorithm isn't supported,
+	// so the answer couldn't be validated.
+	EDEUnsupportedDNSKEYAlgorithm EDECode = 1
+
+	// EDEUnsupportedDSDigestType means the DS digest type isn't supported, so
+	// the answer couldn't be validated.
+	EDEUnsupportedDSDigestType EDECode = 2
+
+	// EDEStaleAnswer means the answer is stale (served from an expired cache
+	// entry).
+	EDEStaleAnswer EDECode = 3
+
+	// EDEForgedAnswer means the answer was forged by policy (e.g. a redirect).
+	EDEForgedAnswer EDECode = 4
+
+	// EDEDNSSECIndeterminate means the DNSSEC validation ended in the
+	// indeterminate state.
+	EDEDNSSECIndeterminate EDECode = 5
+
+	// EDEDNSSECBogus means the DNSSEC validation ended in the bogus state.
+	EDEDNSSECBogus EDECode = 6
+
+	// EDESignatureExpired means the signatures of the answer have expired.
+	EDESignatureExpired EDECode = 7
+
+	// EDESignatureNotYetValid means the signatures of the answer aren't valid
+	// yet.
+	EDESignatureNotYetValid EDECode = 8
+
+	// EDEDNSKEYMissing means no DNSKEY matches the DS records of the zone.
+	EDEDNSKEYMissing EDECode = 9
+
+	// EDERRSIGsMissing means the signatures of the answer are missing.
+	EDERRSIGsMissing EDECode = 10
+
+	// EDENoZoneKeyBitSet means no DNSKEY of the zone has the zone key bit set.
+	EDENoZoneKeyBitSet EDECode = 11
+
+	// EDENSECMissing means the NSEC or NSEC3 records that prove the denial are
+	// missing.
+	EDENSECMissing EDECode = 12
+
+	// EDECachedError means the error was served from the cache.
+	EDECachedError EDECode = 13
+
+	// EDENotReady means the name server isn't ready to answer (e.g. it's
+	// starting).
+	EDENotReady EDECode = 14
+
+	// EDEBlocked means the name is blocked by the operator of the name server.
+	EDEBlocked EDECode = 15
+
+	// EDECensored means the name is blocked on request of an external party.
+	EDECensored EDECode = 16
+
+	// EDEFiltered means the name is blocked on request of the client.
+	EDEFiltered EDECode = 17
+
+	// EDEProhibited means the client isn't allowed to query the name server.
+	EDEProhibited EDECode = 18
+
+	// EDEStaleNXDomainAnswer means the NXDOMAIN answer is stale.
+	EDEStaleNXDomainAnswer EDECode = 19
+
+	// EDENotAuthoritative means the name server isn't authoritative, and
+	// recursion isn't desired.
+	EDENotAuthoritative EDECode = 20
+
+	// EDENotSupported means the query (e.g. its type or opcode) isn't
+	// supported.
+	EDENotSupported EDECode = 21
+
+	// EDENoReachableAuthority means none of the authoritative name servers
+	// could be reached.
+	EDENoReachableAuthority EDECode = 22
+
+	// EDENetworkError means an authoritative name server couldn't be reached
+	// due to a network error.
+	EDENetworkError EDECode = 23
+
+	// EDEInvalidData means the data of the authoritative name server is
+	// invalid.
+	EDEInvalidData EDECode = 24
+)
+
+// EDECodeToString maps an Extended DNS Error code to its purpose.
+var EDECodeToString = map[EDECode]string{
+	EDEOther:                      "Other",
+	EDEUnsupportedDNSKEYAlgorithm: "Unsupported DNSKEY Algorithm",
+	EDEUnsupportedDSDigestType:    "Unsupported DS Digest Type",
+	EDEStaleAnswer:                "Stale Answer",
+	EDEForgedAnswer:               "Forged Answer",
+	EDEDNSSECIndeterminate:        "DNSSEC Indeterminate",
+	EDEDNSSECBogus:                "DNSSEC Bogus",
+	EDESignatureExpired:           "Signature Expired",
+	EDESignatureNotYetValid:       "Signature Not Yet Valid",
+	EDEDNSKEYMissing:              "DNSKEY Missing",
+	EDERRSIGsMissing:              "RRSIGs Missing",
+	EDENoZoneKeyBitSet:            "No Zone Key Bit Set",
+	EDENSECMissing:                "NSEC Missing",
+	EDECachedError:                "Cached Error",
+	EDENotReady:                   "Not Ready",
+	EDEBlocked:                    "Blocked",
+	EDECensored:                   "Censored",
+	EDEFiltered:                   "Filtered",
+	EDEProhibited:                 "Prohibited",
+	EDEStaleNXDomainAnswer:        "Stale NXDOMAIN Answer",
+	EDENotAuthoritative:           "Not Authoritative",
+	EDENotSupported:               "Not Supported",
+	EDENoReachableAuthority:       "No Reachable Authority",
+	EDENetworkError:               "Network Error",
+	EDEInvalidData:                "Invalid Data",
+}
+
+// EDE is the Extended DNS Error option, which explains why a name server
+// failed, or how it answered (e.g. with a stale answer). A response can hold
+// multiple EDE options. Its OPTION-DATA has the following format:
+//
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                           INFO-CODE                           |
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// /                          EXTRA-TEXT ...                       /
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8914#section-2
+type EDE struct {
+	// InfoCode is the code of the error.
+	InfoCode EDECode
+
+	// ExtraText is an optional UTF-8 explanation of the error, meant for
+	// humans.
+	ExtraText string
+}
+
+// Pack packs the EDE option fields into binary format.
+func (e *EDE) Pack() ([]byte, error) {
+	b := make([]byte, 2, 2+len(e.ExtraText))
+	binary.BigEndian.PutUint16(b, uint16(e.InfoCode))
+	return append(b, e.ExtraText...), nil
+}
+
+// Unpack unpacks the EDE option bytes. The extra text may be terminated by a
+// NUL byte, which is dropped.
+func (e *EDE) Unpack(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("option data too short: %d bytes", len(data))
+	}
+	text := data[2:]
+	if n := len(text); n > 0 && text[n-1] == 0 {
+		text = text[:n-1]
+	}
+	if !utf8.Valid(text) {
+		return fmt.Errorf("extra text isn't valid UTF-8")
+	}
+
+	e.InfoCode = EDECode(binary.BigEndian.Uint16(data))
+	e.ExtraText = string(text)
+	return nil
+}
+
+// String returns the "dig like" presentation format of the EDE option (e.g.
+// "15 (Blocked): (ads.example)").
+func (e *EDE) String() string {
+	s := fmt.Sprintf("%d", e.InfoCode)
+	if purpose, ok := EDECodeToString[e.InfoCode]; ok {
+		s += " (" + purpose + ")"
+	}
+	if e.ExtraText != "" {
+		s += ": (" + e.ExtraText + ")"
+	}
+
+	return s
+}
+
+// AddEDE adds the EDE option to the message; unlike other options, the
+// message can hold multiple EDE options. An OPT pseudo resource record with
+// the default UDP payload size is added when the message doesn't use EDNS(0)
+// yet.
+func (m *Msg) AddEDE(e *EDE) error {
+	data, err := e.Pack()
+	if err != nil {
+		return err
+	}
+	if m.OPT() == nil {
+		m.SetEDNS0(DefaultEDNSUDPSize, false)
+	}
+	opt := m.OPT()
+	if len(opt.RData)+4+len(data) > 0xffff {
+		return fmt.Errorf("options too long")
+	}
+	opt.RData = append(opt.RData, byte(EDNSOptionEDE>>8), byte(EDNSOptionEDE), byte(len(data)>>8), byte(len(data)))
+	opt.RData = append(opt.RData, data...)
+	opt.RDLength = uint16(len(opt.RData))
+
+	return nil
+}
+
+// EDEs returns the EDE options of the message, in order.
+func (m *Msg) EDEs() ([]EDE, error) {
+	opt := m.OPT()
+	if opt == nil {
+		return nil, nil
+	}
+	opts, err := opt.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	edes := []EDE{}
+	for _, o := range opts {
+		if o.Code != EDNSOptionEDE {
+			continue
+		}
+		e := EDE{}
+		if err := e.Unpack(o.Data); err != nil {
+			return nil, fmt.Errorf("invalid EDE option: %v", err)
+		}
+		edes = append(edes, e)
+	}
+
+	return edes, nil
+}
@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMsgEDEs(t *testing.T) {
+	m := new(Msg)
+	if err := m.SetQuery("ads.example.com.", TypeA); err != nil {
+		t.Fatal(err)
+	}
+	m.RCode = RCodeNameError
+	want := []EDE{
+		{InfoCode: EDEBlocked, ExtraText: "listed in ads.txt"},
+		{InfoCode: EDEStaleNXDomainAnswer},
+	}
+	for i := range want {
+		if err := m.AddEDE(&want[i]); err != nil {
+			t.Fatalf("failed to add EDE: %v", err)
+		}
+	}
+
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = new(Msg)
+	if _, err := m.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.EDEs()
+	if err != nil {
+		t.Fatalf("failed to get EDEs: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v - want %v", got, want)
+	}
+
+	s := "; EDNS: version: 0, flags:; udp: 1232\n" +
+		"; EDE: 15 (Blocked): (listed in ads.txt)\n" +
+		"; EDE: 19 (Stale NXDOMAIN Answer)"
+	if got := m.OPT().String(); got != s {
+		t.Errorf("opt string error: got %q - want %q", got, s)
+	}
+}
+
+func TestEDEUnpack(t *testing.T) {
+	e := new(EDE)
+	if err := e.Unpack([]byte{0, 6, 'b', 'o', 'g', 'u', 's', 0}); err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	if e.InfoCode != EDEDNSSECBogus || e.ExtraText != "bogus" {
+		t.Errorf("got %v", e)
+	}
+	if got, want := (&EDE{InfoCode: 99}).String(), "99"; got != want {
+		t.Errorf("got %q - want %q", got, want)
+	}
+
+	for _, b := range [][]byte{{0}, {0, 6, 0xff, 0xfe}} {
+		if err := new(EDE).Unpack(b); err == nil {
+			t.Errorf("%v: got no error", b)
+		}
+	}
+}
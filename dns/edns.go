@@ -0,0 +1,276 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultEDNSUDPSize is the default EDNS(0) UDP payload size. It's small
+// enough to avoid IP fragmentation on most networks.
+//
+// See: https://www.dnsflagday.net/2020
+const DefaultEDNSUDPSize = 1232
+
+// ednsFlagDO is the DNSSEC OK bit in the EDNS(0) flags.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3225#section-3
+const ednsFlagDO = 1 << 15
+
+// SetEDNS0 adds an OPT pseudo resource record to the additional section, which
+// advertises the UDP payload size the requester is able to receive. When do is
+// set, the DNSSEC OK bit is set to request DNSSEC resource records. The options
+// of an OPT pseudo resource record that was already added are kept.
+//
+// The OPT resource record has the same format as other resource records, but
+// some fields have a different meaning:
+//
+// - NAME must be the root domain name.
+// - CLASS holds the requester's UDP payload size.
+// - TTL holds the extended RCODE, the version, and the flags.
+// - RDATA holds the EDNS(0) options.
+//
+// The TTL field has the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |     EXTENDED-RCODE    |        VERSION        |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |DO|                    Z                       |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6891#section-6.1
+func (m *Msg) SetEDNS0(udpSize uint16, do bool) {
+	opt := RR{
+		Name:  ".",
+		Type:  TypeOPT,
+		Class: Class(udpSize),
+	}
+	if do {
+		opt.TTL |= ednsFlagDO
+	}
+
+	for i, ar := range m.Additional {
+		if ar.Type == TypeOPT {
+			opt.RData, opt.RDLength = ar.RData, ar.RDLength
+			m.Additional[i] = opt
+			return
+		}
+	}
+	m.Additional = append(m.Additional, opt)
+	m.ARCount = uint16(len(m.Additional))
+}
+
+// SetEDNS0Option sets the option in the OPT pseudo resource record, replacing
+// an option with the same code; an OPT pseudo resource record with the default
+// UDP payload size is added when the message doesn't use EDNS(0) yet.
+func (m *Msg) SetEDNS0Option(o EDNSOption) error {
+	opt := m.OPT()
+	if opt == nil {
+		m.SetEDNS0(DefaultEDNSUDPSize, false)
+		opt = m.OPT()
+	}
+	opts, err := opt.Options()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range opts {
+		if opts[i].Code == o.Code {
+			opts[i], replaced = o, true
+		}
+	}
+	if !replaced {
+		opts = append(opts, o)
+	}
+	rdata := []byte{}
+	for _, o := range opts {
+		if len(o.Data) > 0xffff {
+			return fmt.Errorf("option %s too long: %d bytes", o.Code, len(o.Data))
+		}
+		rdata = append(rdata, byte(o.Code>>8), byte(o.Code), byte(len(o.Data)>>8), byte(len(o.Data)))
+		rdata = append(rdata, o.Data...)
+	}
+	opt.RData, opt.RDLength = rdata, uint16(len(rdata))
+
+	return nil
+}
+
+// EDNS0Option returns the option with the code from the OPT pseudo resource
+// record, or nil when the message doesn't have it.
+func (m *Msg) EDNS0Option(code EDNSOptionCode) (*EDNSOption, error) {
+	opt := m.OPT()
+	if opt == nil {
+		return nil, nil
+	}
+	opts, err := opt.Options()
+	if err != nil {
+		return nil, err
+	}
+	for i := range opts {
+		if opts[i].Code == code {
+			return &opts[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// OPT returns the OPT pseudo resource record from the additional section, or
+// nil when the message doesn't use EDNS(0).
+func (m *Msg) OPT() *RR {
+	for i, ar := range m.Additional {
+		if ar.Type == TypeOPT {
+			return &m.Additional[i]
+		}
+	}
+
+	return nil
+}
+
+// UDPSize returns the UDP payload size of an OPT pseudo resource record.
+func (r *RR) UDPSize() uint16 {
+	return uint16(r.Class)
+}
+
+// DO reports whether the DNSSEC OK bit of an OPT pseudo resource record is
+// set.
+func (r *RR) DO() bool {
+	return r.TTL&ednsFlagDO != 0
+}
+
+// EDNSOptionCode represents the code of an EDNS(0) option.
+//
+// See: https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#dns-parameters-11
+type EDNSOptionCode uint16
+
+// String returns the string representation of an EDNS(0) option code.
+func (c EDNSOptionCode) String() string {
+	if s, ok := EDNSOptionCodeToString[c]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("OPT=%d", c)
+}
+
+const (
+	// EDNSOptionClientSubnet is the EDNS Client Subnet option.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7871
+	EDNSOptionClientSubnet EDNSOptionCode = 8
+
+	// EDNSOptionTCPKeepalive is the edns-tcp-keepalive option.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7828
+	EDNSOptionTCPKeepalive EDNSOptionCode = 11
+
+	// EDNSOptionPadding is the Padding option.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7830
+	EDNSOptionPadding EDNSOptionCode = 12
+
+	// EDNSOptionEDE is the Extended DNS Error option.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8914
+	EDNSOptionEDE EDNSOptionCode = 15
+)
+
+// EDNSOptionCodeToString maps an EDNS(0) option code to a string.
+var EDNSOptionCodeToString = map[EDNSOptionCode]string{
+	EDNSOptionClientSubnet: "CLIENT-SUBNET",
+	EDNSOptionTCPKeepalive: "TCP-KEEPALIVE",
+	EDNSOptionPadding:      "PADDING",
+	EDNSOptionEDE:          "EDE",
+}
+
+// EDNSOption is an option in the RDATA of an OPT pseudo resource record. The
+// RDATA holds any number of options, which have the following format:
+//
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                          OPTION-CODE                          |
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                         OPTION-LENGTH                         |
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+// |                                                               |
+// /                          OPTION-DATA                          /
+// /                                                               /
+// +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6891#section-6.1.2
+type EDNSOption struct {
+	Code EDNSOptionCode
+	Data []byte
+}
+
+// String returns a "dig like" string representation of the option.
+func (o *EDNSOption) String() string {
+	switch o.Code {
+	case EDNSOptionClientSubnet:
+		cs := new(ClientSubnet)
+		if err := cs.Unpack(o.Data); err == nil {
+			return fmt.Sprintf("%s: %s", o.Code, cs)
+		}
+	case EDNSOptionTCPKeepalive:
+		switch len(o.Data) {
+		case 0:
+			return o.Code.String()
+		case 2:
+			timeout := time.Duration(binary.BigEndian.Uint16(o.Data)) * keepaliveUnit
+			return fmt.Sprintf("%s: %.1f secs", o.Code, timeout.Seconds())
+		}
+	case EDNSOptionPadding:
+		return fmt.Sprintf("%s: (%d bytes)", o.Code, len(o.Data))
+	case EDNSOptionEDE:
+		e := new(EDE)
+		if err := e.Unpack(o.Data); err == nil {
+			return fmt.Sprintf("%s: %s", o.Code, e)
+		}
+	}
+
+	return fmt.Sprintf("%s: %x", o.Code, o.Data)
+}
+
+// Options returns the options of an OPT pseudo resource record.
+func (r *RR) Options() ([]EDNSOption, error) {
+	opts := []EDNSOption{}
+	for b := r.RData; len(b) > 0; {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("option too short: %d bytes", len(b))
+		}
+		code := EDNSOptionCode(binary.BigEndian.Uint16(b))
+		size := int(binary.BigEndian.Uint16(b[2:]))
+		if 4+size > len(b) {
+			return nil, fmt.Errorf("invalid option %s length %d", code, size)
+		}
+		opts = append(opts, EDNSOption{Code: code, Data: b[4 : 4+size]})
+		b = b[4+size:]
+	}
+
+	return opts, nil
+}
+
+// optString returns a "dig like" string representation of the OPT pseudo
+// resource record.
+func optString(r *RR) string {
+	flags := ""
+	if r.DO() {
+		flags = " do"
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(
+		b, "; EDNS: version: %d, flags:%s; udp: %d",
+		byte(r.TTL>>16), flags, r.UDPSize(),
+	)
+	opts, err := r.Options()
+	if err != nil {
+		fmt.Fprintf(b, "\n; OPTIONS: %v", err)
+	}
+	for _, o := range opts {
+		fmt.Fprintf(b, "\n; %s", o.String())
+	}
+
+	return b.String()
+}
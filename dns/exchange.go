@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultExchangeTimeout is the time Exchange waits for a response.
+const DefaultExchangeTimeout = time.Second * 5
+
+// Exchange sends the message to the name server address ("host:port") over
+// UDP, and returns the response. When the response is truncated, the message
+// is sent again over TCP.
+func Exchange(m *Msg, addr string) (*Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultExchangeTimeout)
+	defer cancel()
+
+	return ExchangeContext(ctx, m, addr)
+}
+
+// ExchangeContext is like Exchange, but the context can be used to cancel the
+// exchange, or to enforce a deadline.
+func ExchangeContext(ctx context.Context, m *Msg, addr string) (*Msg, error) {
+	b, err := m.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack message: %v", err)
+	}
+
+	resp, err := exchange(ctx, "udp", m, b, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// See: https://datatracker.ietf.org/doc/html/rfc7766#section-5
+	if resp.TC == 1 {
+		return exchange(ctx, "tcp", m, b, addr)
+	}
+
+	return resp, nil
+}
+
+// exchange sends the packed message to the address over the network ("udp" or
+// "tcp"), and reads responses until one has the ID of the message.
+func exchange(
+	ctx context.Context,
+	network string,
+	m *Msg,
+	b []byte,
+	addr string,
+) (*Msg, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set deadline: %v", err)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	// Over TCP, a message is prefixed with its 2 byte length.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2
+	if network == "tcp" {
+		b = append([]byte{byte(len(b) >> 8), byte(len(b))}, b...)
+	}
+	if _, err := conn.Write(b); err != nil {
+		return nil, fmt.Errorf("failed to write message: %v", err)
+	}
+
+	for {
+		var respb []byte
+		if network == "tcp" {
+			lenb := make([]byte, 2)
+			if _, err := io.ReadFull(conn, lenb); err != nil {
+				return nil, fmt.Errorf("failed to read response length: %v", err)
+			}
+			respb = make([]byte, binary.BigEndian.Uint16(lenb))
+			if _, err := io.ReadFull(conn, respb); err != nil {
+				return nil, fmt.Errorf("failed to read response: %v", err)
+			}
+		} else {
+			buff := make([]byte, 65535)
+			n, err := conn.Read(buff)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read response: %v", err)
+			}
+			respb = buff[:n]
+		}
+
+		resp := new(Msg)
+		if _, err := resp.Unpack(respb); err != nil {
+			if network == "tcp" {
+				return nil, fmt.Errorf("failed to unpack response: %v", err)
+			}
+			continue
+		}
+
+		// A response with another ID may be a late response to an earlier
+		// message, or a spoofing attempt.
+		if resp.QR != 1 || resp.ID != m.ID {
+			continue
+		}
+		return resp, nil
+	}
+}
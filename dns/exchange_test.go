@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExchangeTruncated(t *testing.T) {
+	udp, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer udp.Close()
+
+	addr := udp.LocalAddr().String()
+	tcp, err := net.Listen("tcp4", addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer tcp.Close()
+
+	response := func(b []byte, tc uint8) []byte {
+		query := new(Msg)
+		if _, err := query.Unpack(b); err != nil {
+			return nil
+		}
+		resp := *query
+		resp.QR = 1
+		resp.TC = tc
+		if tc == 0 {
+			resp.Answer = []RR{{
+				Name:  query.Question.QName,
+				Type:  TypeA,
+				Class: ClassIN,
+				TTL:   300,
+				RData: []byte{192, 0, 2, 1},
+			}}
+		}
+		respb, err := resp.Pack()
+		if err != nil {
+			return nil
+		}
+		return respb
+	}
+
+	// The UDP response is truncated, so the message must be sent again over
+	// TCP.
+	go func() {
+		buff := make([]byte, 512)
+		n, from, err := udp.ReadFromUDP(buff)
+		if err != nil {
+			return
+		}
+		udp.WriteToUDP(response(buff[:n], 1), from)
+	}()
+	go func() {
+		conn, err := tcp.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lenb := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lenb); err != nil {
+			return
+		}
+		b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		respb := response(b, 0)
+		conn.Write(append([]byte{byte(len(respb) >> 8), byte(len(respb))}, respb...))
+	}()
+
+	m := new(Msg)
+	if err := m.SetQuery("danillouz.dev.", TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := ExchangeContext(ctx, m, addr)
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if resp.TC != 0 || len(resp.Answer) != 1 {
+		t.Errorf("got truncated %d with %d answers, want the tcp response", resp.TC, len(resp.Answer))
+	}
+}
@@ -3,6 +3,7 @@ package dns
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 )
 
 // OpCode represents a DNS operation code.
@@ -22,6 +23,19 @@ const (
 
 	// OpCodeStatus is a server status request.
 	OpCodeStatus
+
+	_
+
+	// OpCodeNotify notifies secondary name servers that a zone changed.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1996
+	OpCodeNotify
+
+	// OpCodeUpdate adds or deletes resource records of a zone (i.e. a dynamic
+	// update).
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2136
+	OpCodeUpdate
 )
 
 // OpCodeToString maps an operation code to a string.
@@ -29,6 +43,8 @@ var OpCodeToString = map[OpCode]string{
 	OpCodeQuery:  "QUERY",
 	OpCodeIQuery: "IQUERY",
 	OpCodeStatus: "STATUS",
+	OpCodeNotify: "NOTIFY",
+	OpCodeUpdate: "UPDATE",
 }
 
 // RCode represents a DNS response code.
@@ -61,6 +77,45 @@ const (
 	// RCodeRefused means the name server refuses to perform the specified
 	// operation.
 	RCodeRefused
+
+	// RCodeYXDomain means a domain name exists that a dynamic update requires to
+	// not exist.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.2
+	RCodeYXDomain
+
+	// RCodeYXRRset means a resource record set exists that a dynamic update
+	// requires to not exist.
+	RCodeYXRRset
+
+	// RCodeNXRRset means a resource record set doesn't exist that a dynamic
+	// update requires to exist.
+	RCodeNXRRset
+
+	// RCodeNotAuth means the name server isn't authoritative for the zone of a
+	// dynamic update.
+	RCodeNotAuth
+
+	// RCodeNotZone means a name of a dynamic update isn't in its zone.
+	RCodeNotZone
+)
+
+// TSIG errors, which are only used in the error field of a TSIG resource
+// record (see TSIG).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-5.2
+const (
+	// RCodeBadSig means the TSIG signature (MAC) is invalid.
+	RCodeBadSig RCode = 16
+
+	// RCodeBadKey means the TSIG key or algorithm is unknown.
+	RCodeBadKey RCode = 17
+
+	// RCodeBadTime means the TSIG signing time is outside the fudge window.
+	RCodeBadTime RCode = 18
+
+	// RCodeBadTrunc means the TSIG MAC is truncated too much.
+	RCodeBadTrunc RCode = 22
 )
 
 // OpCodeToString maps a response code to a string.
@@ -71,6 +126,15 @@ var RCodeToString = map[RCode]string{
 	RCodeNameError:      "Name Error",
 	RCodeNotImplemented: "Not Implemented",
 	RCodeRefused:        "Refused",
+	RCodeYXDomain:       "Name Exists",
+	RCodeYXRRset:        "RRset Exists",
+	RCodeNXRRset:        "RRset Does Not Exist",
+	RCodeNotAuth:        "Not Authoritative",
+	RCodeNotZone:        "Not Zone",
+	RCodeBadSig:         "Bad Signature",
+	RCodeBadKey:         "Bad Key",
+	RCodeBadTime:        "Bad Time",
+	RCodeBadTrunc:       "Bad Truncation",
 }
 
 // Header represents the DNS message header. It consists of 12 bytes with the
@@ -198,6 +262,13 @@ func (h *Header) Pack() ([]byte, error) {
 func (h *Header) Unpack(msg []byte, off int) (int, error) {
 	bytesRead := 0
 
+	// The header always consists of 12 bytes.
+	if off < 0 || off+12 > len(msg) {
+		return bytesRead, fmt.Errorf(
+			"header at offset %d exceeds message length (%d bytes)", off, len(msg),
+		)
+	}
+
 	// The first 2 bytes contain the first section; ID.
 	//
 	// Left-shift the first byte to the "left most" position, and OR it with the
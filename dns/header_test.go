@@ -85,3 +85,13 @@ func TestHeaderPackUnpack(t *testing.T) {
 		)
 	}
 }
+
+func TestHeaderUnpackShort(t *testing.T) {
+	h := new(Header)
+	if _, err := h.Unpack(make([]byte, 11), 0); err == nil {
+		t.Errorf("unpack short header error: got nil - want error")
+	}
+	if _, err := h.Unpack(make([]byte, 12), 1); err == nil {
+		t.Errorf("unpack short header at offset error: got nil - want error")
+	}
+}
@@ -0,0 +1,374 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// generateMsgID generates a random 16 bit DNS message ID.
+func generateMsgID() (id uint16, err error) {
+	err = binary.Read(rand.Reader, binary.BigEndian, &id)
+	return
+}
+
+const (
+	// maxDomainNameWireLen is the max length of a domain name in wire format.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-2.3.4
+	maxDomainNameWireLen = 255
+
+	// maxLabelLen is the max length of a label.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-2.3.4
+	maxLabelLen = 63
+
+	// maxCompressionPointers is the max number of pointers that are followed
+	// when unpacking a single domain name. Because every label takes up at least
+	// 2 bytes, a valid domain name never needs more pointers.
+	maxCompressionPointers = maxDomainNameWireLen / 2
+)
+
+// queryByteMask creates a mask where the "right most" n bits in a byte are
+// "turned on".
+//
+//   7   6   5   4   3   2   1   0
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 0 | 0 | 0 | 0 | 0 |	(1 << 0 ) - 1 = 0
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 0 | 0 | 0 | 0 | 1 |	(1 << 1 ) - 1 = 1
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 0 | 0 | 0 | 1 | 1 |	(1 << 2 ) - 1 = 3
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 0 | 0 | 1 | 1 | 1 |	(1 << 3 ) - 1 = 7
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 0 | 1 | 1 | 1 | 1 |	(1 << 4 ) - 1 = 15
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 0 | 1 | 1 | 1 | 1 | 1 |	(1 << 5 ) - 1 = 31
+// +---+---+---+---+---+---+---+---+
+// | 0 | 0 | 1 | 1 | 1 | 1 | 1 | 1 |	(1 << 6 ) - 1 = 63
+// +---+---+---+---+---+---+---+---+
+// | 0 | 1 | 1 | 1 | 1 | 1 | 1 | 1 |	(1 << 7 ) - 1 = 127
+// +---+---+---+---+---+---+---+---+
+// | 1 | 1 | 1 | 1 | 1 | 1 | 1 | 1 |	(1 << 8 ) - 1 = 255
+// +---+---+---+---+---+---+---+---+
+func queryByteMask(n int) byte {
+	return (1 << n) - 1
+}
+
+// unpackDomainName unpacks a domain name 1 label at a time, and follows any
+// pointer(s) when the domain name is compressed. It returns the unpacked
+// domain name, the next offset, and the amount of bytes read; or an error when
+// the domain name is malformed.
+//
+// When compressed, the label(s) of the domain name are replaced with a
+// pointer to a prior occurance. The pointer consists of 2 bytes and has the
+// following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// | 1  1|                OFFSET                   |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// The first 2 bits are always set to 1. And OFFSET specifies the offset from
+// the _start_ of the message (i.e. `Msg.Header.ID`) where the label can be
+// found; each label (after following the pointer) always start with a length
+// byte (i.e. label size), followed by the "actual" label byte(s).
+//
+// This means that a domain name in a message can be either:
+// - A sequence of labels ending in a zero byte.
+// - A pointer (that points to a sequence of labels ending in a zero byte).
+// - A sequence of labels ending with a pointer (that points to a sequence of
+//   labels ending in a zero byte).
+//
+// For example, the domain names `dan.co` and `hey.dan.co` can be
+// compressed like:
+//
+//     15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// ..
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 20 |    3 (length byte)    |           d           |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 22 |           a           |           n           |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 24 |    2 (length byte)    |           c           |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 26 |           o           |     0 (zero byte)     |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// ..
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 40 |    3 (length byte)    |           h           |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 42 |           e           |           y           |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// 44 | 1  1|        20 (offset pointer)              |
+//    +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// ..
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.1.4
+func unpackDomainName(msg []byte, off int) (string, int, int, error) {
+	nameb := []byte{}
+
+	// The number of pointers followed.
+	ptrn := 0
+
+	// The current offset of a label.
+	offl := off
+
+	// The offset directly after the domain name. When the domain name is
+	// compressed, this is the offset directly after the _first_ pointer.
+	offn := 0
+
+	// The length of the domain name in wire format, which includes the length
+	// bytes and the zero byte.
+	wireLen := 0
+
+	for {
+		if offl >= len(msg) {
+			return "", off, 0, fmt.Errorf(
+				"domain name offset %d out of bounds (%d bytes)", offl, len(msg),
+			)
+		}
+
+		// The current byte. Can be either:
+		// - A pointer; in this case the second byte (i.e. `cb` + 1) points to the
+		//   length byte.
+		// - Not a pointer; in this case the current byte _is_ the length byte.
+		cb := msg[offl]
+
+		// Because a pointer starts with its 2 most significant bits set to 1,
+		// right-shifting them to the "right most" position results in
+		// 2^1 + 2^0 = 3.
+		switch cb >> 6 {
+		case 3:
+			if offl+1 >= len(msg) {
+				return "", off, 0, fmt.Errorf("truncated pointer at offset %d", offl)
+			}
+
+			// To get the offset pointer value, "query" the 6 "right most" bits of the
+			// first pointer byte, left-shift them to the "left most" position, and
+			// "merge" it with the second pointer byte; a pointer always consists of
+			// 2 bytes.
+			p := int(uint16(cb&queryByteMask(6))<<8 | uint16(msg[offl+1]))
+
+			// A pointer must point to a _prior_ occurrence, which guarantees that
+			// following pointers terminates (i.e. a pointer can't point to itself,
+			// or create a loop).
+			if p >= offl {
+				return "", off, 0, fmt.Errorf(
+					"pointer at offset %d points forward to offset %d", offl, p,
+				)
+			}
+
+			ptrn++
+			if ptrn > maxCompressionPointers {
+				return "", off, 0, fmt.Errorf("too many compression pointers")
+			}
+
+			if ptrn == 1 {
+				offn = offl + 2
+			}
+			offl = p
+			continue
+
+		// The 10 and 01 combinations are reserved for future use.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc6891#section-5
+		case 1, 2:
+			return "", off, 0, fmt.Errorf(
+				"invalid label type 0x%02x at offset %d", cb, offl,
+			)
+		}
+
+		size := int(cb)
+		wireLen += 1 + size
+		if wireLen > maxDomainNameWireLen {
+			return "", off, 0, fmt.Errorf(
+				"domain name exceeds %d bytes", maxDomainNameWireLen,
+			)
+		}
+
+		// The next byte always starts after the length byte.
+		offl += 1
+
+		if size == 0 {
+			break
+		}
+
+		end := offl + size
+		if end > len(msg) {
+			return "", off, 0, fmt.Errorf(
+				"label at offset %d exceeds message length (%d bytes)",
+				offl, len(msg),
+			)
+		}
+		nameb = appendEscaped(nameb, msg[offl:end], false)
+		nameb = append(nameb, '.')
+		offl = end
+	}
+
+	// The root domain name consists of only the zero byte.
+	if len(nameb) == 0 {
+		nameb = append(nameb, '.')
+	}
+
+	name := string(nameb)
+	if ptrn == 0 {
+		offn = offl
+	}
+	bytesRead := offn - off
+
+	return name, offn, bytesRead, nil
+}
+
+// packDomainName packs a domain name as a sequence of labels, where each label
+// is encoded into a length byte followed by the label byte(s). The domain name
+// terminates with the zero length byte (null label of root). An
+// internationalized name is packed as A-labels (see ToASCII).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.1
+func packDomainName(name string) ([]byte, error) {
+	name, err := ToASCII(name)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseLabels(name)
+	if err != nil {
+		return nil, err
+	}
+
+	buff := new(bytes.Buffer)
+	for _, label := range labels {
+		// A label longer than 63 bytes can't be encoded; its length byte would be
+		// read as a pointer.
+		if len(label) > maxLabelLen {
+			return nil, fmt.Errorf("label %q exceeds %d bytes", label, maxLabelLen)
+		}
+
+		// Each label must be encoded into:
+		//  - A length byte; contains the length of the label (in bytes)
+		//  - The label byte(s) itself
+		if err := binary.Write(buff, binary.BigEndian, byte(len(label))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buff, binary.BigEndian, label); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := binary.Write(buff, binary.BigEndian, byte(0)); err != nil {
+		return nil, err
+	}
+	if buff.Len() > maxDomainNameWireLen {
+		return nil, fmt.Errorf("domain name %q exceeds %d bytes", name, maxDomainNameWireLen)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// parseLabels parses the labels of a domain name in presentation format
+// (without the null label of root). A byte that isn't a printable character
+// (e.g. a space), or that would otherwise end the label (a dot), must be
+// escaped as "\DDD" (its decimal value, e.g. "\032") or "\X" (the byte
+// itself, e.g. "\.").
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5.1
+func parseLabels(name string) ([][]byte, error) {
+	// The root domain name holds no labels.
+	if name == "" || name == "." {
+		return nil, nil
+	}
+
+	labels := [][]byte{}
+	label := []byte{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.':
+			// Only the null label of root is empty, so a name can't have empty
+			// labels before its end.
+			if len(label) == 0 {
+				return nil, fmt.Errorf("domain name %q has an empty label", name)
+			}
+			labels = append(labels, label)
+			label = []byte{}
+			continue
+		case c == '\\':
+			b, n, err := parseEscape(name[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("domain name %q has %v", name, err)
+			}
+			label = append(label, b)
+			i += n
+			continue
+		case c <= ' ' || c >= 0x7f:
+			return nil, fmt.Errorf("domain name %q has unescaped byte 0x%02x", name, c)
+		}
+		label = append(label, c)
+	}
+	if len(label) > 0 {
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
+
+// parseEscape parses the escape sequence at the start of the string (that
+// follows a backslash), and returns the byte it escapes and the length of the
+// sequence.
+func parseEscape(s string) (byte, int, error) {
+	if len(s) == 0 {
+		return 0, 0, fmt.Errorf("a trailing backslash")
+	}
+	if s[0] < '0' || s[0] > '9' {
+		return s[0], 1, nil
+	}
+
+	if len(s) < 3 {
+		return 0, 0, fmt.Errorf("an invalid escape \\%s", s)
+	}
+	v := 0
+	for _, d := range []byte(s[:3]) {
+		if d < '0' || d > '9' {
+			return 0, 0, fmt.Errorf("an invalid escape \\%s", s[:3])
+		}
+		v = v*10 + int(d-'0')
+	}
+	if v > 255 {
+		return 0, 0, fmt.Errorf("an invalid escape \\%s", s[:3])
+	}
+
+	return byte(v), 3, nil
+}
+
+// PackName packs a domain name in wire format (uncompressed), e.g. to build the
+// RDATA of a resource record. A relative name is packed as a fully qualified
+// one.
+func PackName(name string) ([]byte, error) {
+	return packDomainName(Fqdn(name))
+}
+
+// appendEscaped appends the label, or the character string when quoted is
+// set, in presentation format: a byte that isn't a printable character is
+// escaped as "\DDD", and a character that's special is escaped as "\X". In a
+// label, a space isn't printable, and the dot, quote, parentheses and
+// semicolon are special; in a (quoted) character string, only the quote is.
+// The backslash is always special.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5.1
+func appendEscaped(b, s []byte, quoted bool) []byte {
+	for _, c := range s {
+		switch {
+		case c < ' ' || c >= 0x7f || (c == ' ' && !quoted):
+			b = append(b, fmt.Sprintf("\\%03d", c)...)
+		case c == '\\' || c == '"',
+			!quoted && (c == '.' || c == '(' || c == ')' || c == ';'):
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnpackDomainName(t *testing.T) {
+	// "dan.co." at offset 0, followed by "hey" and a pointer to offset 0.
+	msg := []byte{3, 'd', 'a', 'n', 2, 'c', 'o', 0, 3, 'h', 'e', 'y', 0xc0, 0}
+
+	name, offn, n, err := unpackDomainName(msg, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "hey.dan.co." {
+		t.Errorf("unpacked domain name error: got %v - want %v", name, "hey.dan.co.")
+	}
+	if offn != len(msg) {
+		t.Errorf("unpacked domain name offset error: got %v - want %v", offn, len(msg))
+	}
+	if n != 6 {
+		t.Errorf("unpacked domain name bytes length error: got %v - want %v", n, 6)
+	}
+}
+
+func TestUnpackDomainNameMalformed(t *testing.T) {
+	long := []byte{}
+	for i := 0; i < 5; i++ {
+		long = append(long, 63)
+		long = append(long, make([]byte, 63)...)
+	}
+	long = append(long, 0)
+
+	tests := map[string][]byte{
+		"pointer to itself":       {0xc0, 0},
+		"forward pointer":         {0xc0, 2, 0},
+		"pointer loop":            {3, 'd', 'a', 'n', 0xc0, 0},
+		"truncated pointer":       {0xc0},
+		"truncated label":         {5, 'd', 'a', 'n'},
+		"missing zero byte":       {3, 'd', 'a', 'n'},
+		"reserved label type":     {0x40, 0},
+		"name exceeds 255 bytes":  long,
+		"offset out of bounds":    {},
+		"pointer out of bounds":   {1, 'a', 0xc0, 0xff},
+		"forward pointer at head": {0xc0, 3, 0, 0},
+	}
+
+	for desc, msg := range tests {
+		if _, _, _, err := unpackDomainName(msg, 0); err == nil {
+			t.Errorf("unpack %s error: got nil - want error", desc)
+		}
+	}
+}
+
+func TestPackName(t *testing.T) {
+	b, err := PackName("danillouz.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{9, 'd', 'a', 'n', 'i', 'l', 'l', 'o', 'u', 'z', 3, 'd', 'e', 'v', 0}
+	if string(b) != string(want) {
+		t.Errorf("packed name error: got %v - want %v", b, want)
+	}
+
+	// A label can't exceed 63 bytes.
+	label := strings.Repeat("a", 64)
+	if _, err := PackName(label + ".dev."); err == nil {
+		t.Errorf("pack long label error: got nil - want error")
+	}
+}
+
+func TestPackNameEscaped(t *testing.T) {
+	tests := map[string][]byte{
+		`a\032b.dev.`: {3, 'a', ' ', 'b', 3, 'd', 'e', 'v', 0},
+		`a\.b.dev.`:   {3, 'a', '.', 'b', 3, 'd', 'e', 'v', 0},
+		`\\\000.dev.`: {2, '\\', 0, 3, 'd', 'e', 'v', 0},
+		".":           {0},
+	}
+	for name, want := range tests {
+		b, err := PackName(name)
+		if err != nil {
+			t.Errorf("pack %s error: %v", name, err)
+			continue
+		}
+		if string(b) != string(want) {
+			t.Errorf("packed name %s error: got %v - want %v", name, b, want)
+		}
+	}
+}
+
+func TestPackNameInvalid(t *testing.T) {
+	long := strings.Repeat(strings.Repeat("a", 63)+".", 4)
+	tests := map[string]string{
+		"name exceeds 255 bytes":  long,
+		"escaped label too long":  strings.Repeat(`\097`, 64) + ".dev.",
+		"empty label":             "a..dev.",
+		"leading dot":             ".dev.",
+		"unescaped space":         "a b.dev.",
+		"unescaped control byte":  "a\tb.dev.",
+		"trailing backslash":      `dev\`,
+		"short decimal escape":    `a\03`,
+		"decimal escape over 255": `a\256.dev.`,
+	}
+	for desc, name := range tests {
+		if _, err := packDomainName(name); err == nil {
+			t.Errorf("pack %s error: got nil - want error", desc)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Internationalized domain names (IDNs) hold labels with Unicode characters
+// (U-labels), which are encoded in the DNS as ASCII labels with the "xn--"
+// prefix (A-labels), with Punycode.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5890
+// See: https://datatracker.ietf.org/doc/html/rfc3492
+
+// acePrefix is the prefix of an A-label.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5890#section-2.3.2.5
+const acePrefix = "xn--"
+
+// Parameters of the Punycode encoding.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3492#section-5
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// labelSeparators are the characters that separate the labels of an IDN, in
+// addition to the full stop.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3490#section-3.1
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// isASCII checks if the string only holds ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ToASCII converts the U-labels of the domain name to A-labels (e.g.
+// "bücher.example." becomes "xn--bcher-kva.example."); ASCII labels are kept
+// as-is. U-labels are lower cased, and may only hold letters, digits, marks
+// and hyphens (and must not start or end with a hyphen). They're expected to
+// be in Unicode Normalization Form C, since they aren't normalized.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5891#section-4
+func ToASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("name %q isn't valid UTF-8", name)
+	}
+
+	labels := strings.Split(labelSeparators.Replace(name), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+
+		label = strings.ToLower(label)
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+		for _, r := range label {
+			if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+				return "", fmt.Errorf("label %q holds the disallowed character %U", label, r)
+			}
+		}
+		alabel := acePrefix + punyEncode([]rune(label))
+		if len(alabel) > maxLabelLen {
+			return "", fmt.Errorf("label %q exceeds %d bytes as A-label", label, maxLabelLen)
+		}
+		labels[i] = alabel
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode converts the A-labels of the domain name to U-labels (e.g.
+// "xn--bcher-kva.example." becomes "bücher.example."), to display it. Labels
+// that aren't valid A-labels are kept as-is.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5891#section-5
+func ToUnicode(name string) string {
+	if !strings.Contains(strings.ToLower(name), acePrefix) {
+		return name
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) <= len(acePrefix) || !strings.EqualFold(label[:len(acePrefix)], acePrefix) {
+			continue
+		}
+		runes, err := punyDecode(strings.ToLower(label[len(acePrefix):]))
+		if err != nil {
+			continue
+		}
+
+		// The U-label must encode to the A-label again.
+		ulabel := string(runes)
+		if alabel, err := ToASCII(ulabel); err != nil || !strings.EqualFold(alabel, label) {
+			continue
+		}
+		labels[i] = ulabel
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// punyAdapt adapts the bias after a code point is encoded or decoded.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3492#section-6.1
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// punyThreshold returns the threshold of the digit at position k.
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	default:
+		return k - bias
+	}
+}
+
+// punyDigit returns the basic code point of the digit.
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+
+	return byte('0' + d - 26)
+}
+
+// punyEncode encodes the code points with Punycode.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3492#section-6.3
+func punyEncode(input []rune) string {
+	out := []byte{}
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	b := len(out)
+	if b > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h := b; h < len(input); {
+		m := rune(unicode.MaxRune + 1)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+
+		for _, r := range input {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+
+	return string(out)
+}
+
+// punyDecode decodes the Punycode encoded string.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3492#section-6.2
+func punyDecode(s string) ([]rune, error) {
+	out := []rune{}
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for _, r := range s[:b] {
+			if r >= utf8.RuneSelf {
+				return nil, fmt.Errorf("invalid punycode %q", s)
+			}
+			out = append(out, r)
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(s) {
+				return nil, fmt.Errorf("invalid punycode %q", s)
+			}
+			c := s[pos]
+			pos++
+
+			var d int
+			switch {
+			case c >= 'a' && c <= 'z':
+				d = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				d = int(c - 'A')
+			case c >= '0' && c <= '9':
+				d = int(c-'0') + 26
+			default:
+				return nil, fmt.Errorf("invalid punycode %q", s)
+			}
+			// A code point beyond the Unicode range is invalid, which
+			// prevents overflows as well.
+			if d > (unicode.MaxRune-i)/w {
+				return nil, fmt.Errorf("invalid punycode %q", s)
+			}
+			i += d * w
+
+			t := punyThreshold(k, bias)
+			if d < t {
+				break
+			}
+			w *= punyBase - t
+		}
+
+		bias = punyAdapt(i-oldi, len(out)+1, oldi == 0)
+		n += rune(i / (len(out) + 1))
+		i %= len(out) + 1
+		if n > unicode.MaxRune || n < punyInitialN {
+			return nil, fmt.Errorf("invalid punycode %q", s)
+		}
+		out = append(out[:i], append([]rune{n}, out[i:]...)...)
+		i++
+	}
+
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package dns
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.org.", "example.org."},
+		{"bücher.example.", "xn--bcher-kva.example."},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"español.example.", "xn--espaol-zwa.example."},
+		{"日本語。jp", "xn--wgv71a119e.jp"},
+		{"☃.net.", ""},
+		{"-bücher.example.", ""},
+		{"bü cher.example.", ""},
+	}
+	for _, tt := range tests {
+		got, err := ToASCII(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got %s", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to convert: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s - want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.org.", "example.org."},
+		{"xn--bcher-kva.example.", "bücher.example."},
+		{"XN--MNCHEN-3YA.de", "münchen.de"},
+		{"www.xn--wgv71a119e.jp.", "www.日本語.jp."},
+
+		// Invalid A-labels are kept.
+		{"xn--.example.", "xn--.example."},
+		{"xn--bcher-kv!.example.", "xn--bcher-kv!.example."},
+		{"xn--abc-.example.", "xn--abc-.example."},
+	}
+	for _, tt := range tests {
+		if got := ToUnicode(tt.name); got != tt.want {
+			t.Errorf("%s: got %s - want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPunycodeRoundTrip(t *testing.T) {
+	for _, s := range []string{"bücher", "ドメイン名例", "παράδειγμα", "mañana-ñ", "a-b-c", "ü"} {
+		got, err := punyDecode(punyEncode([]rune(s)))
+		if err != nil || string(got) != s {
+			t.Errorf("%s: got %s (%v)", s, string(got), err)
+		}
+	}
+}
+
+func TestSetQueryIDN(t *testing.T) {
+	m := new(Msg)
+	if err := m.SetQuery("bücher.example.", TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+	if m.Question.QName != "xn--bcher-kva.example." {
+		t.Errorf("got qname %s - want xn--bcher-kva.example.", m.Question.QName)
+	}
+
+	if err := new(Msg).SetQuery("☃.net.", TypeA); err == nil {
+		t.Error("expected error for a disallowed character")
+	}
+}
@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// keepaliveUnit is the unit of the TIMEOUT field of the edns-tcp-keepalive
+// option.
+const keepaliveUnit = 100 * time.Millisecond
+
+// MaxTCPKeepalive is the max timeout of the edns-tcp-keepalive option.
+const MaxTCPKeepalive = 0xffff * keepaliveUnit
+
+// SetTCPKeepalive sets the edns-tcp-keepalive option, which negotiates how long
+// an idle TCP (or TLS) connection is kept open. A client sets it in a query
+// to signal it wants to keep the connection open; the timeout is omitted, so
+// the QR bit must not be set. A server sets it in the response, with the time
+// it keeps idle connections open (at most MaxTCPKeepalive); a timeout of 0
+// asks the client to close the connection. It must not be used over UDP.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7828#section-3.1
+func (m *Msg) SetTCPKeepalive(timeout time.Duration) error {
+	o := EDNSOption{Code: EDNSOptionTCPKeepalive}
+	if m.QR == 1 {
+		if timeout < 0 || timeout > MaxTCPKeepalive {
+			return fmt.Errorf("invalid keepalive timeout %s", timeout)
+		}
+		o.Data = make([]byte, 2)
+		binary.BigEndian.PutUint16(o.Data, uint16(timeout/keepaliveUnit))
+	}
+
+	return m.SetEDNS0Option(o)
+}
+
+// TCPKeepalive returns the timeout of the edns-tcp-keepalive option, and
+// whether the message has the option. The timeout of a query is always 0.
+func (m *Msg) TCPKeepalive() (time.Duration, bool, error) {
+	o, err := m.EDNS0Option(EDNSOptionTCPKeepalive)
+	if err != nil || o == nil {
+		return 0, false, err
+	}
+
+	switch {
+	case m.QR == 0 && len(o.Data) != 0:
+		return 0, true, fmt.Errorf("keepalive option of a query has a timeout")
+	case m.QR == 1 && len(o.Data) != 2:
+		return 0, true, fmt.Errorf("invalid keepalive option length %d", len(o.Data))
+	case m.QR == 0:
+		return 0, true, nil
+	}
+
+	return time.Duration(binary.BigEndian.Uint16(o.Data)) * keepaliveUnit, true, nil
+}
@@ -0,0 +1,46 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMsgTCPKeepalive(t *testing.T) {
+	m := new(Msg)
+	if err := m.SetQuery("example.com.", TypeA); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := m.TCPKeepalive(); ok || err != nil {
+		t.Errorf("got keepalive %t (%v) without the option", ok, err)
+	}
+
+	// A query has no timeout.
+	if err := m.SetTCPKeepalive(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := m.EDNS0Option(EDNSOptionTCPKeepalive); o == nil || len(o.Data) != 0 {
+		t.Fatalf("got query option %v, want no timeout", o)
+	}
+	if timeout, ok, err := m.TCPKeepalive(); !ok || err != nil || timeout != 0 {
+		t.Errorf("got query keepalive %s %t %v", timeout, ok, err)
+	}
+
+	m.QR = 1
+	if err := m.SetTCPKeepalive(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if timeout, ok, err := m.TCPKeepalive(); !ok || err != nil || timeout != 30*time.Second {
+		t.Errorf("got response keepalive %s %t %v", timeout, ok, err)
+	}
+	if got, want := m.OPT().String(), "; EDNS: version: 0, flags:; udp: 1232\n; TCP-KEEPALIVE: 30.0 secs"; got != want {
+		t.Errorf("got %q - want %q", got, want)
+	}
+
+	if err := m.SetTCPKeepalive(2 * time.Hour); err == nil {
+		t.Error("got no error for a timeout that doesn't fit")
+	}
+	m.QR = 0
+	if _, _, err := m.TCPKeepalive(); err == nil {
+		t.Error("got no error for a query with a timeout")
+	}
+}
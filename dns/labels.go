@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SplitDomainName splits the domain name in presentation format into its
+// labels, at the dots that aren't escaped (e.g. "a\.b.example." has the labels
+// "a\.b" and "example"); the labels keep their escape sequences. The root
+// domain name has no labels.
+func SplitDomainName(name string) []string {
+	labels := []string{}
+	start := 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '\\':
+			// The escaped character can't end the label.
+			i++
+		case '.':
+			if i > start {
+				labels = append(labels, name[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(name) {
+		labels = append(labels, name[start:])
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// CountLabels returns the number of labels of the domain name; the root domain
+// name has none.
+func CountLabels(name string) int {
+	return len(SplitDomainName(name))
+}
+
+// IsFqdn checks if the domain name in presentation format is fully qualified:
+// it ends with a dot that isn't escaped (e.g. "a\\." is, but "a\." isn't).
+func IsFqdn(name string) bool {
+	if !strings.HasSuffix(name, ".") {
+		return false
+	}
+	backslashes := 0
+	for i := len(name) - 2; i >= 0 && name[i] == '\\'; i-- {
+		backslashes++
+	}
+
+	return backslashes%2 == 0
+}
+
+// Fqdn returns the domain name as a Fully Qualified Domain Name (FQDN).
+func Fqdn(name string) string {
+	if IsFqdn(name) {
+		return name
+	}
+
+	return name + "."
+}
+
+// CanonicalName returns the canonical form of a domain name; all uppercase
+// US-ASCII letters are replaced by the corresponding lowercase letters.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.2
+func CanonicalName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, name)
+}
+
+// canonicalLabels returns the labels of the domain name in canonical form, as
+// the bytes they hold (i.e. with their escape sequences decoded).
+func canonicalLabels(name string) [][]byte {
+	labels, err := parseLabels(Fqdn(name))
+	if err != nil {
+		// A name that can't be packed is compared as it's written.
+		labels = [][]byte{}
+		for _, label := range SplitDomainName(name) {
+			labels = append(labels, []byte(label))
+		}
+	}
+	for _, label := range labels {
+		lowerASCII(label)
+	}
+
+	return labels
+}
+
+// CompareDomainName compares 2 domain names in canonical ordering; names are
+// sorted by their labels, where the right most label is the most significant,
+// and labels are compared case-insensitively as byte strings. The result is 0
+// if a == b, -1 if a < b, and +1 if a > b.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-6.1
+func CompareDomainName(a, b string) int {
+	la := canonicalLabels(a)
+	lb := canonicalLabels(b)
+
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := bytes.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	}
+
+	return 0
+}
+
+// EqualDomainName reports whether the domain names are equal; the comparison
+// is case-insensitive, and a name that isn't fully qualified equals the fully
+// qualified one.
+func EqualDomainName(a, b string) bool {
+	return CompareDomainName(a, b) == 0
+}
+
+// IsSubDomain reports whether child is equal to, or a subdomain of parent. The
+// comparison is case-insensitive.
+func IsSubDomain(parent, child string) bool {
+	lp := canonicalLabels(parent)
+	lc := canonicalLabels(child)
+	if len(lc) < len(lp) {
+		return false
+	}
+
+	for i := 1; i <= len(lp); i++ {
+		if !bytes.Equal(lp[len(lp)-i], lc[len(lc)-i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParentDomainName returns the fully qualified domain name without its first
+// label (e.g. "example.org." for "www.example.org."); the parent of a single
+// label domain name, or of the root, is the root.
+func ParentDomainName(name string) string {
+	labels := SplitDomainName(name)
+	if len(labels) <= 1 {
+		return "."
+	}
+
+	return strings.Join(labels[1:], ".") + "."
+}
+
+// AncestorDomainNames returns the fully qualified domain name and all its
+// ancestors, from the name up to its top-level domain (e.g. "www.example.org.",
+// "example.org." and "org."); the root isn't included.
+func AncestorDomainNames(name string) []string {
+	labels := SplitDomainName(name)
+	names := make([]string, len(labels))
+	for i := range labels {
+		names[i] = strings.Join(labels[i:], ".") + "."
+	}
+
+	return names
+}
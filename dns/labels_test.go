@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitDomainName(t *testing.T) {
+	tests := map[string][]string{
+		".":                nil,
+		"":                 nil,
+		"example.org.":     {"example", "org"},
+		"www.example.org":  {"www", "example", "org"},
+		`a\.b.example.`:    {`a\.b`, "example"},
+		`a\\.example.`:     {`a\\`, "example"},
+		`a\046b\032c.org.`: {`a\046b\032c`, "org"},
+	}
+	for name, want := range tests {
+		if got := SplitDomainName(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("split %q error: got %q - want %q", name, got, want)
+		}
+		if got := CountLabels(name); got != len(want) {
+			t.Errorf("count labels %q error: got %d - want %d", name, got, len(want))
+		}
+	}
+}
+
+func TestFqdn(t *testing.T) {
+	tests := map[string]string{
+		"":             ".",
+		".":            ".",
+		"example.org":  "example.org.",
+		"example.org.": "example.org.",
+		`a\.`:          `a\..`,
+		`a\\.`:         `a\\.`,
+	}
+	for name, want := range tests {
+		if got := Fqdn(name); got != want {
+			t.Errorf("fqdn %q error: got %q - want %q", name, got, want)
+		}
+	}
+}
+
+func TestIsSubDomain(t *testing.T) {
+	tests := []struct {
+		parent string
+		child  string
+		want   bool
+	}{
+		{".", "example.org.", true},
+		{"example.org.", "example.org", true},
+		{"Example.ORG.", "www.example.org.", true},
+		{"example.org.", "wwwexample.org.", false},
+		{"www.example.org.", "example.org.", false},
+		{"example.org.", `www\.example.org.`, false},
+		{`b.example.org.`, `a\.b.example.org.`, false},
+		{"example.org.", `\119ww.example.org.`, true},
+	}
+	for _, tt := range tests {
+		if got := IsSubDomain(tt.parent, tt.child); got != tt.want {
+			t.Errorf("is %s a subdomain of %s error: got %v - want %v", tt.child, tt.parent, got, tt.want)
+		}
+	}
+}
+
+func TestParentDomainName(t *testing.T) {
+	tests := map[string]string{
+		".":                 ".",
+		"org.":              ".",
+		"www.Example.org.":  "Example.org.",
+		`a\.b.example.org.`: "example.org.",
+		`a.b.example.org`:   "b.example.org.",
+	}
+	for name, want := range tests {
+		if got := ParentDomainName(name); got != want {
+			t.Errorf("%s: got %s - want %s", name, got, want)
+		}
+	}
+}
+
+func TestAncestorDomainNames(t *testing.T) {
+	tests := map[string][]string{
+		".":                 {},
+		"org.":              {"org."},
+		"www.example.org.":  {"www.example.org.", "example.org.", "org."},
+		`a\.b.example.org.`: {`a\.b.example.org.`, "example.org.", "org."},
+		"a.b.example":       {"a.b.example.", "b.example.", "example."},
+	}
+	for name, want := range tests {
+		if got := AncestorDomainNames(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q - want %q", name, got, want)
+		}
+	}
+}
+
+func TestCompareDomainName(t *testing.T) {
+	// The canonical ordering example of RFC 4034, section 6.1.
+	names := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		`\001.z.example.`,
+		"*.z.example.",
+		`\200.z.example.`,
+	}
+	for i := range names {
+		for j := range names {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := CompareDomainName(names[i], names[j]); got != want {
+				t.Errorf("compare %s with %s error: got %d - want %d", names[i], names[j], got, want)
+			}
+		}
+	}
+
+	if !EqualDomainName("WWW.example.org", `www.\101xample.org.`) {
+		t.Errorf("equal domain names error: got false - want true")
+	}
+}
@@ -14,9 +14,17 @@ type Msg struct {
 	// Header contains message information, and is always present.
 	Header
 
-	// Question describes the query to the name server.
+	// Question describes the query to the name server. When the message holds
+	// more than one question it's the first one, and when it holds none (QDCount
+	// is 0) it's empty.
 	Question Question
 
+	// ExtraQuestions holds the questions after the first one. In practice
+	// messages hold a single question, but the format allows more.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc9619
+	ExtraQuestions []Question
+
 	// Answer can be part of the response that contains resource records that
 	// answer the question.
 	Answer []RR
@@ -28,11 +36,20 @@ type Msg struct {
 	// Additional can be part of the response that contains resource records with
 	// additional information (also called "glue records").
 	Additional []RR
+
+	// signed holds the unpacked message up to its TSIG or SIG(0) resource
+	// record, which is needed to verify the signature (see VerifyTSIG and
+	// VerifySIG0).
+	signed []byte
 }
 
 // SetQuery sets the required header- and question fields to send a DNS message
-// query.
+// query. An internationalized name is converted to A-labels (see ToASCII).
 func (m *Msg) SetQuery(name string, qt QType) error {
+	name, err := ToASCII(name)
+	if err != nil {
+		return err
+	}
 	id, err := generateMsgID()
 	if err != nil {
 		return fmt.Errorf("failed to generate message ID: %v", err)
@@ -52,10 +69,28 @@ func (m *Msg) SetQuery(name string, qt QType) error {
 	return nil
 }
 
+// Questions returns all questions of the message; it's empty when the message
+// holds no question.
+func (m *Msg) Questions() []Question {
+	if m.Question == (Question{}) && len(m.ExtraQuestions) == 0 {
+		return nil
+	}
+
+	return append([]Question{m.Question}, m.ExtraQuestions...)
+}
+
 // Pack packs the DNS message fields into binary format.
 func (m *Msg) Pack() ([]byte, error) {
 	buff := new(bytes.Buffer)
 
+	// The header counts always reflect the questions and resource records that
+	// are packed.
+	questions := m.Questions()
+	m.QDCount = uint16(len(questions))
+	m.ANCount = uint16(len(m.Answer))
+	m.NSCount = uint16(len(m.Authority))
+	m.ARCount = uint16(len(m.Additional))
+
 	hBytes, err := m.Header.Pack()
 	if err != nil {
 		return nil, fmt.Errorf("failed to pack header: %v", err)
@@ -64,12 +99,27 @@ func (m *Msg) Pack() ([]byte, error) {
 		return nil, err
 	}
 
-	qBytes, err := m.Question.Pack()
-	if err != nil {
-		return nil, fmt.Errorf("failed to pack question: %v", err)
+	for i, q := range questions {
+		qBytes, err := q.Pack()
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack question (%v): %v", i, err)
+		}
+		if err := binary.Write(buff, binary.BigEndian, qBytes); err != nil {
+			return nil, err
+		}
 	}
-	if err := binary.Write(buff, binary.BigEndian, qBytes); err != nil {
-		return nil, err
+
+	sections := [][]RR{m.Answer, m.Authority, m.Additional}
+	for _, section := range sections {
+		for i, rr := range section {
+			rrBytes, err := rr.Pack()
+			if err != nil {
+				return nil, fmt.Errorf("failed to pack resource record (%v): %v", i, err)
+			}
+			if err := binary.Write(buff, binary.BigEndian, rrBytes); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return buff.Bytes(), nil
@@ -86,11 +136,19 @@ func (m *Msg) Unpack(msg []byte) (int, error) {
 	}
 	off += n
 
-	n, err = m.Question.Unpack(msg, off)
-	if err != nil {
-		return off, fmt.Errorf("failed to unpack question: %v", err)
+	for i := 0; i < int(m.Header.QDCount); i++ {
+		q := Question{}
+		n, err := q.Unpack(msg, off)
+		if err != nil {
+			return off, fmt.Errorf("failed to unpack question (%v): %v", i, err)
+		}
+		if i == 0 {
+			m.Question = q
+		} else {
+			m.ExtraQuestions = append(m.ExtraQuestions, q)
+		}
+		off += n
 	}
-	off += n
 
 	for i := 0; i < int(m.Header.ANCount); i++ {
 		an := RR{}
@@ -118,6 +176,9 @@ func (m *Msg) Unpack(msg []byte) (int, error) {
 		if err != nil {
 			return off, fmt.Errorf("failed to unpack additional (%v): %v", i, err)
 		}
+		if (ar.Type == TypeTSIG || ar.Type == TypeSIG) && i == int(m.Header.ARCount)-1 {
+			m.signed = append([]byte{}, msg[:off]...)
+		}
 		m.Additional = append(m.Additional, ar)
 		off += n
 	}
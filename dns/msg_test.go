@@ -0,0 +1,183 @@
+package dns
+
+import "testing"
+
+func TestMsgPackUnpack(t *testing.T) {
+	msg := Msg{
+		Header: Header{
+			ID:      123,
+			QR:      0,
+			OpCode:  OpCodeQuery,
+			RD:      1,
+			QDCount: 1,
+		},
+		Question: Question{
+			QName:  "danillouz.dev.",
+			QType:  TypeA,
+			QClass: ClassIN,
+		},
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(Msg)
+	lenb, err := m.Unpack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lenb != len(b) {
+		t.Errorf("unpacked bytes length error: got %v - want %v", lenb, len(b))
+	}
+
+	if m.Header.ID != msg.ID {
+		t.Errorf(
+			"unpacked message header ID error: got %v - want %v", m.Header.ID, msg.ID,
+		)
+	}
+
+	if m.Question.QName != msg.Question.QName {
+		t.Errorf(
+			"unpacked message question QName error: got %v - want %v",
+			m.Question.QName, msg.Question.QName,
+		)
+	}
+	if m.Question.QType != msg.Question.QType {
+		t.Errorf(
+			"unpacked message question QType error: got %v - want %v",
+			m.Question.QType, msg.Question.QType,
+		)
+	}
+	if m.Question.QClass != msg.Question.QClass {
+		t.Errorf(
+			"unpacked message question QClass error: got %v - want %v",
+			m.Question.QClass, msg.Question.QClass,
+		)
+	}
+}
+
+func TestMsgUnpackMalformed(t *testing.T) {
+	msg := Msg{
+		Header: Header{
+			ID:      123,
+			QR:      1,
+			OpCode:  OpCodeQuery,
+			QDCount: 1,
+		},
+		Question: Question{
+			QName:  "danillouz.dev.",
+			QType:  TypeA,
+			QClass: ClassIN,
+		},
+		Answer: []RR{
+			{
+				Name:  "danillouz.dev.",
+				Type:  TypeA,
+				Class: ClassIN,
+				TTL:   300,
+				RData: []byte{192, 0, 2, 1},
+			},
+		},
+		Authority: []RR{
+			{
+				Name:  "danillouz.dev.",
+				Type:  TypeSOA,
+				Class: ClassIN,
+				TTL:   300,
+				RData: append(
+					[]byte{2, 'n', 's', 0, 4, 'h', 'o', 's', 't', 0},
+					make([]byte, 20)...,
+				),
+			},
+		},
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(Msg)
+	if _, err := m.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every truncation of a valid message must result in an error (and never
+	// in a panic).
+	for i := 0; i < len(b); i++ {
+		m := new(Msg)
+		if _, err := m.Unpack(b[:i]); err == nil {
+			t.Errorf("unpack truncated message (%v bytes) error: got nil - want error", i)
+		}
+	}
+
+	// An A record with an invalid RDLENGTH.
+	bad := append([]byte{}, b...)
+	anOff := 12 + len("danillouz.dev.") + 1 + 4
+	rdlOff := anOff + len("danillouz.dev.") + 1 + 8
+	bad[rdlOff+1] = 3
+	if _, err := new(Msg).Unpack(bad); err == nil {
+		t.Errorf("unpack invalid A rdata length error: got nil - want error")
+	}
+
+	// A header that claims more resource records than the message holds.
+	bad = append([]byte{}, b...)
+	bad[7] = 2
+	if _, err := new(Msg).Unpack(bad); err == nil {
+		t.Errorf("unpack invalid answer count error: got nil - want error")
+	}
+}
+
+func TestMsgQuestionCount(t *testing.T) {
+	answer := RR{
+		Name:  "danillouz.dev.",
+		Type:  TypeA,
+		Class: ClassIN,
+		TTL:   300,
+		RData: []byte{192, 0, 2, 1},
+	}
+
+	// A message without a question must not misalign the answer section.
+	msg := Msg{Header: Header{ID: 123, QR: 1}, Answer: []RR{answer}}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(Msg)
+	if _, err := m.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if m.QDCount != 0 || len(m.Questions()) != 0 {
+		t.Errorf("unpacked question count error: got %v - want 0", m.QDCount)
+	}
+	if len(m.Answer) != 1 || m.Answer[0].RDataUnpacked != "192.0.2.1" {
+		t.Errorf("unpacked answer error: got %v - want 192.0.2.1", m.Answer)
+	}
+
+	// A message with 2 questions.
+	msg.Question = Question{QName: "danillouz.dev.", QType: TypeA, QClass: ClassIN}
+	msg.ExtraQuestions = []Question{
+		{QName: "danillouz.dev.", QType: TypeAAAA, QClass: ClassIN},
+	}
+	b, err = msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = new(Msg)
+	lenb, err := m.Unpack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lenb != len(b) {
+		t.Errorf("unpacked bytes length error: got %v - want %v", lenb, len(b))
+	}
+	if m.QDCount != 2 || len(m.ExtraQuestions) != 1 ||
+		m.ExtraQuestions[0].QType != TypeAAAA {
+		t.Errorf("unpacked questions error: got %v - want A and AAAA", m.Questions())
+	}
+	if len(m.Answer) != 1 {
+		t.Errorf("unpacked answer count error: got %v - want 1", len(m.Answer))
+	}
+}
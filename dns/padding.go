@@ -0,0 +1,46 @@
+package dns
+
+import "fmt"
+
+const (
+	// PaddingQueryBlockSize is the block size that queries sent over encrypted
+	// transports are padded to.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8467#section-4.1
+	PaddingQueryBlockSize = 128
+
+	// PaddingResponseBlockSize is the block size that responses sent over
+	// encrypted transports are padded to.
+	PaddingResponseBlockSize = 468
+)
+
+// Pad sets the Padding option of the message, so its packed size is a multiple
+// of the block size. The padding hides the size of the message (and so the
+// name it's about) from observers of an encrypted transport; it must be set
+// after every other option, and before the message is signed (which adds to
+// the size). An OPT pseudo resource record with the default UDP payload size
+// is added when the message doesn't use EDNS(0) yet.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7830
+// See: https://datatracker.ietf.org/doc/html/rfc8467
+func (m *Msg) Pad(blockSize int) error {
+	if blockSize <= 0 {
+		return fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	// The size is measured with an empty Padding option; its padding is added
+	// after it's packed.
+	if err := m.SetEDNS0Option(EDNSOption{Code: EDNSOptionPadding}); err != nil {
+		return err
+	}
+	b, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	n := (blockSize - len(b)%blockSize) % blockSize
+	if len(b)+n > 65535 {
+		n = 65535 - len(b)
+	}
+
+	return m.SetEDNS0Option(EDNSOption{Code: EDNSOptionPadding, Data: make([]byte, n)})
+}
@@ -0,0 +1,38 @@
+package dns
+
+import "testing"
+
+func TestMsgPad(t *testing.T) {
+	for _, name := range []string{"a.", "example.com.", "a-much-longer-name-that-fills-the-block.example.com."} {
+		m := new(Msg)
+		if err := m.SetQuery(name, TypeA); err != nil {
+			t.Fatal(err)
+		}
+		m.SetEDNS0(DefaultEDNSUDPSize, true)
+
+		// Padding twice replaces the padding.
+		for i := 0; i < 2; i++ {
+			if err := m.Pad(PaddingQueryBlockSize); err != nil {
+				t.Fatalf("%s: failed to pad: %v", name, err)
+			}
+		}
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != PaddingQueryBlockSize {
+			t.Errorf("%s: got %d bytes - want %d", name, len(b), PaddingQueryBlockSize)
+		}
+
+		o, err := m.EDNS0Option(EDNSOptionPadding)
+		if err != nil || o == nil {
+			t.Fatalf("%s: failed to get padding: %v", name, err)
+		}
+		for _, c := range o.Data {
+			if c != 0 {
+				t.Errorf("%s: padding isn't zeroed", name)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ParsePrivateKey parses a private key in the private key format of BIND (as
+// generated with dnssec-keygen), and returns it with its algorithm, e.g.:
+//
+//	Private-key-format: v1.3
+//	Algorithm: 15 (ED25519)
+//	PrivateKey: ODIyNjAzODQ2MjgwODAxMjI2NDUxOTAyMDQxNDIyNjI=
+func ParsePrivateKey(s string) (crypto.Signer, Algorithm, error) {
+	fields := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		fields[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+	}
+	if !strings.HasPrefix(fields["private-key-format"], "v1.") {
+		return nil, 0, fmt.Errorf("unsupported private key format %q", fields["private-key-format"])
+	}
+	algf := strings.Fields(fields["algorithm"])
+	if len(algf) == 0 {
+		return nil, 0, fmt.Errorf("missing algorithm")
+	}
+	n, err := strconv.ParseUint(algf[0], 10, 8)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid algorithm %q", algf[0])
+	}
+	alg := Algorithm(n)
+
+	// value decodes the base64 encoded value of the field.
+	value := func(name string) ([]byte, error) {
+		b, err := base64.StdEncoding.DecodeString(fields[strings.ToLower(name)])
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid or missing %s", name)
+		}
+		return b, nil
+	}
+
+	switch alg {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256,
+		AlgorithmRSASHA512:
+		ints := map[string]*big.Int{}
+		for _, name := range []string{"Modulus", "PublicExponent", "PrivateExponent", "Prime1", "Prime2"} {
+			b, err := value(name)
+			if err != nil {
+				return nil, 0, err
+			}
+			ints[name] = new(big.Int).SetBytes(b)
+		}
+		if !ints["PublicExponent"].IsInt64() || ints["PublicExponent"].Int64() > 1<<31-1 {
+			return nil, 0, fmt.Errorf("invalid PublicExponent")
+		}
+		priv := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{
+				N: ints["Modulus"],
+				E: int(ints["PublicExponent"].Int64()),
+			},
+			D:      ints["PrivateExponent"],
+			Primes: []*big.Int{ints["Prime1"], ints["Prime2"]},
+		}
+		if err := priv.Validate(); err != nil {
+			return nil, 0, fmt.Errorf("invalid rsa private key: %v", err)
+		}
+		priv.Precompute()
+		return priv, alg, nil
+
+	// See: https://datatracker.ietf.org/doc/html/rfc6605#section-6
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		b, err := value("PrivateKey")
+		if err != nil {
+			return nil, 0, err
+		}
+		curve := elliptic.P256()
+		if alg == AlgorithmECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		if len(b) != curve.Params().BitSize/8 {
+			return nil, 0, fmt.Errorf("invalid ecdsa private key length")
+		}
+		priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(b)}
+		priv.PublicKey.Curve = curve
+		priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(b)
+		return priv, alg, nil
+
+	// The private key is the seed of the key pair.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8080#section-6
+	case AlgorithmED25519:
+		b, err := value("PrivateKey")
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(b) != ed25519.SeedSize {
+			return nil, 0, fmt.Errorf("invalid ed25519 private key length")
+		}
+		return ed25519.NewKeyFromSeed(b), alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// DefaultRSAKeySize is the size (in bits) of generated RSA keys.
+const DefaultRSAKeySize = 2048
+
+// GenerateKey generates a key pair for the algorithm, and returns its private
+// key with its DNSKEY (with the flags, e.g. DNSKEYFlagZone|DNSKEYFlagSEP for a
+// key signing key). RSA keys are DefaultRSAKeySize bits.
+func GenerateKey(alg Algorithm, flags uint16) (crypto.Signer, *DNSKEY, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256,
+		AlgorithmRSASHA512:
+		priv, err = rsa.GenerateKey(rand.Reader, DefaultRSAKeySize)
+	case AlgorithmECDSAP256SHA256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmECDSAP384SHA384:
+		priv, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgorithmED25519:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := NewDNSKEY(priv.Public(), alg, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return priv, key, nil
+}
+
+// NewDNSKEY creates the DNSKEY of the public key for the algorithm, with the
+// flags.
+func NewDNSKEY(pub crypto.PublicKey, alg Algorithm, flags uint16) (*DNSKEY, error) {
+	key := &DNSKEY{Flags: flags, Protocol: 3, Algorithm: alg}
+	switch k := pub.(type) {
+	// The public key consists of the exponent length (1 or 3 bytes), the
+	// exponent, and the modulus.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3110#section-2
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(k.E)).Bytes()
+		if len(e) < 256 {
+			key.PublicKey = append([]byte{byte(len(e))}, e...)
+		} else {
+			key.PublicKey = append([]byte{0, byte(len(e) >> 8), byte(len(e))}, e...)
+		}
+		key.PublicKey = append(key.PublicKey, k.N.Bytes()...)
+
+	// The public key consists of the X and Y coordinates of the curve point.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc6605#section-4
+	case *ecdsa.PublicKey:
+		size := k.Curve.Params().BitSize / 8
+		key.PublicKey = append(k.X.FillBytes(make([]byte, size)), k.Y.FillBytes(make([]byte, size))...)
+
+	case ed25519.PublicKey:
+		key.PublicKey = append([]byte{}, k...)
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	// The key must decode to the algorithm (e.g. an ECDSA key must be on the
+	// curve of the algorithm).
+	if _, err := key.publicKey(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// MarshalPrivateKey marshals the private key of the algorithm in the private
+// key format of BIND (see ParsePrivateKey).
+func MarshalPrivateKey(priv crypto.Signer, alg Algorithm) (string, error) {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "Private-key-format: v1.3\nAlgorithm: %d (%s)\n", alg, alg)
+	b64 := base64.StdEncoding.EncodeToString
+
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return "", fmt.Errorf("rsa private key must have 2 primes")
+		}
+		k.Precompute()
+		fields := []struct {
+			name string
+			v    *big.Int
+		}{
+			{"Modulus", k.N},
+			{"PublicExponent", big.NewInt(int64(k.E))},
+			{"PrivateExponent", k.D},
+			{"Prime1", k.Primes[0]},
+			{"Prime2", k.Primes[1]},
+			{"Exponent1", k.Precomputed.Dp},
+			{"Exponent2", k.Precomputed.Dq},
+			{"Coefficient", k.Precomputed.Qinv},
+		}
+		for _, f := range fields {
+			fmt.Fprintf(b, "%s: %s\n", f.name, b64(f.v.Bytes()))
+		}
+	case *ecdsa.PrivateKey:
+		fmt.Fprintf(b, "PrivateKey: %s\n", b64(k.D.FillBytes(make([]byte, k.Curve.Params().BitSize/8))))
+	case ed25519.PrivateKey:
+		fmt.Fprintf(b, "PrivateKey: %s\n", b64(k.Seed()))
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", priv)
+	}
+
+	// The key must parse as a key of the algorithm.
+	if _, parsed, err := ParsePrivateKey(b.String()); err != nil || parsed != alg {
+		return "", fmt.Errorf("private key isn't a %s key", alg)
+	}
+
+	return b.String(), nil
+}
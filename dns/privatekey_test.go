@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	// The example keys of RFC 8080 and RFC 6605.
+	tests := []struct {
+		s   string
+		alg Algorithm
+		pub string
+	}{
+		{
+			s:   "Private-key-format: v1.2\nAlgorithm: 15 (ED25519)\nPrivateKey: ODIyNjAzODQ2MjgwODAxMjI2NDUxOTAyMDQxNDIyNjI=\n",
+			alg: AlgorithmED25519,
+			pub: "l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=",
+		},
+		{
+			s:   "Private-key-format: v1.2\nAlgorithm: 13 (ECDSAP256SHA256)\nPrivateKey: GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=\n",
+			alg: AlgorithmECDSAP256SHA256,
+			pub: "GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==",
+		},
+	}
+	for _, tt := range tests {
+		priv, alg, err := ParsePrivateKey(tt.s)
+		if err != nil {
+			t.Errorf("%s: %v", tt.alg, err)
+			continue
+		}
+		if alg != tt.alg {
+			t.Errorf("algorithm error: got %v - want %v", alg, tt.alg)
+		}
+		var pub []byte
+		switch k := priv.Public().(type) {
+		case ed25519.PublicKey:
+			pub = k
+		case *ecdsa.PublicKey:
+			pub = append(k.X.FillBytes(make([]byte, 32)), k.Y.FillBytes(make([]byte, 32))...)
+		}
+		if got := base64.StdEncoding.EncodeToString(pub); got != tt.pub {
+			t.Errorf("%s public key error: got %v - want %v", tt.alg, got, tt.pub)
+		}
+	}
+
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(i *big.Int) string { return base64.StdEncoding.EncodeToString(i.Bytes()) }
+	s := fmt.Sprintf(
+		"Private-key-format: v1.3\nAlgorithm: 8 (RSASHA256)\nModulus: %s\nPublicExponent: %s\n"+
+			"PrivateExponent: %s\nPrime1: %s\nPrime2: %s\n",
+		b64(rsaPriv.N), b64(big.NewInt(int64(rsaPriv.E))), b64(rsaPriv.D),
+		b64(rsaPriv.Primes[0]), b64(rsaPriv.Primes[1]),
+	)
+	priv, alg, err := ParsePrivateKey(s)
+	if err != nil {
+		t.Fatalf("RSASHA256: %v", err)
+	}
+	if alg != AlgorithmRSASHA256 || !priv.(*rsa.PrivateKey).Equal(rsaPriv) {
+		t.Errorf("RSASHA256 private key error: got %v %v", alg, priv)
+	}
+
+	for _, s := range []string{
+		"",
+		"Private-key-format: v1.3\nAlgorithm: 15 (ED25519)\n",
+		"Private-key-format: v1.3\nAlgorithm: 15 (ED25519)\nPrivateKey: c2hvcnQ=\n",
+		"Private-key-format: v1.3\nAlgorithm: 3 (DSA)\nPrivateKey: c2hvcnQ=\n",
+	} {
+		if _, _, err := ParsePrivateKey(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	for _, alg := range []Algorithm{AlgorithmRSASHA256, AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384, AlgorithmED25519} {
+		priv, key, err := GenerateKey(alg, DNSKEYFlagZone|DNSKEYFlagSEP)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if key.Algorithm != alg || key.Protocol != 3 || key.Flags != 257 {
+			t.Errorf("%s dnskey error: got %s", alg, key.String())
+		}
+
+		// The marshaled private key parses to the same key pair.
+		s, err := MarshalPrivateKey(priv, alg)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		parsed, palg, err := ParsePrivateKey(s)
+		if err != nil || palg != alg {
+			t.Fatalf("%s: failed to parse marshaled key: %v", alg, err)
+		}
+		pkey, err := NewDNSKEY(parsed.Public(), alg, key.Flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkey.KeyTag() != key.KeyTag() {
+			t.Errorf("%s parsed key tag error: got %d - want %d", alg, pkey.KeyTag(), key.KeyTag())
+		}
+	}
+
+	if _, err := MarshalPrivateKey(ed25519.NewKeyFromSeed(make([]byte, 32)), AlgorithmRSASHA256); err == nil {
+		t.Errorf("marshal key of another algorithm error: got nil - want error")
+	}
+}
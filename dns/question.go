@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"strings"
 )
 
 // QType fields appear in the question section of a DNS query. QType values are
@@ -57,27 +56,11 @@ func (q *Question) Pack() ([]byte, error) {
 	//
 	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.1.4
 
-	// To pack QName, process the domain name as a sequence of labels.
-	labels := strings.Split(q.QName, ".")
-	for _, label := range labels {
-		// Root label "." is split as an empty string.
-		if label == "" {
-			break
-		}
-
-		// Each label must be encoded into:
-		//  - A length byte; contains the length of the label (in bytes)
-		//  - The label byte(s) itself
-		if err := binary.Write(buff, binary.BigEndian, byte(len(label))); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buff, binary.BigEndian, []byte(label)); err != nil {
-			return nil, err
-		}
+	nameb, err := packDomainName(q.QName)
+	if err != nil {
+		return nil, err
 	}
-
-	// A domain name terminates with the zero length byte (null label of root).
-	if err := binary.Write(buff, binary.BigEndian, byte(0)); err != nil {
+	if err := binary.Write(buff, binary.BigEndian, nameb); err != nil {
 		return nil, err
 	}
 
@@ -97,11 +80,21 @@ func (q *Question) Pack() ([]byte, error) {
 func (q *Question) Unpack(msg []byte, off int) (int, error) {
 	bytesRead := 0
 
-	name, offn, n := unpackDomainName(msg, off)
+	name, offn, n, err := unpackDomainName(msg, off)
+	if err != nil {
+		return bytesRead, fmt.Errorf("failed to unpack name: %v", err)
+	}
 	q.QName = name
 	off = offn
 	bytesRead += n
 
+	if off+4 > len(msg) {
+		return bytesRead, fmt.Errorf(
+			"question fields at offset %d exceed message length (%d bytes)",
+			off, len(msg),
+		)
+	}
+
 	// The QType and QClass are 2 sections of 2 bytes each.
 	// To unpack each (remaining) section, left-shift the first byte to the "left
 	// most" position, and OR it with the second byte to "merge" it back into a
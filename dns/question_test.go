@@ -40,3 +40,23 @@ func TestQuestionPackUnpack(t *testing.T) {
 		)
 	}
 }
+
+func TestQuestionUnpackTruncated(t *testing.T) {
+	msg := Question{
+		QName:  "danillouz.dev.",
+		QType:  TypeA,
+		QClass: ClassIN,
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(b); i++ {
+		q := new(Question)
+		if _, err := q.Unpack(b[:i], 0); err == nil {
+			t.Errorf("unpack truncated question (%v bytes) error: got nil - want error", i)
+		}
+	}
+}
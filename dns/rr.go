@@ -0,0 +1,723 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Type represents a resource record type.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.2.2
+type Type uint16
+
+// String returns the string representation of a resource record type.
+func (t Type) String() string {
+	if s, ok := TypeToString[t]; ok {
+		return s
+	}
+
+	// Unknown types are represented by their number.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3597#section-5
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+const (
+	TypeUnknown Type = iota
+
+	// TypeA is a host address (i.e. IP address).
+	TypeA
+
+	// TypeNS is an authoritative name server.
+	TypeNS
+
+	// TypeMD is a mail destination (Obsolete: use MX).
+	TypeMD
+
+	// TypeMF is a mail forwarder (Obsolete: use MX).
+	TypeMF
+
+	// TypeCNAME is the canonical name for an alias.
+	TypeCNAME
+
+	// TypeSOA marks the start of a zone of authority.
+	TypeSOA
+
+	// TypeMB is a mailbox domain name (experimental).
+	TypeMB
+
+	// TypeMG is a mail group member (experimental).
+	TypeMG
+
+	// TypeMR is a mail rename domain name (experimental).
+	TypeMR
+
+	// TypeNULL is a null resource record (experimental).
+	TypeNULL
+
+	// TypeWKS is a well known service description.
+	TypeWKS
+
+	// TypePTR is a domain name pointer.
+	TypePTR
+
+	// TypeHINFO is host information.
+	TypeHINFO
+
+	// TypeMINFO is mailbox or mail list information.
+	TypeMINFO
+
+	// TypeMX is mail exchange.
+	TypeMX
+
+	// TypeTXT is text strings.
+	TypeTXT
+)
+
+const (
+	// TypeSIG is a signature; only used for SIG(0) transaction signatures.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2931#section-3
+	TypeSIG Type = 24
+
+	// TypeKEY is a public key; only used for the keys of SIG(0) transaction
+	// signatures.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3445#section-3
+	TypeKEY Type = 25
+
+	// TypeAAAA is an IPv6 host address.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3596#section-2.1
+	TypeAAAA Type = 28
+
+	// TypeSRV is the location of a service.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2782
+	TypeSRV Type = 33
+
+	// TypeOPT is the EDNS(0) pseudo resource record.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc6891#section-6.1
+	TypeOPT Type = 41
+
+	// TypeDS is a delegation signer.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034#section-5
+	TypeDS Type = 43
+
+	// TypeRRSIG is a resource record set signature.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3
+	TypeRRSIG Type = 46
+
+	// TypeNSEC is a next secure record.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034#section-4
+	TypeNSEC Type = 47
+
+	// TypeDNSKEY is a DNS public key.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034#section-2
+	TypeDNSKEY Type = 48
+
+	// TypeNSEC3 is a hashed next secure record.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-3
+	TypeNSEC3 Type = 50
+
+	// TypeNSEC3PARAM holds the NSEC3 parameters of a zone.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-4
+	TypeNSEC3PARAM Type = 51
+
+	// TypeZONEMD is a message digest of a zone.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8976
+	TypeZONEMD Type = 63
+
+	// TypeTSIG is a transaction signature.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8945#section-4.2
+	TypeTSIG Type = 250
+
+	// TypeIXFR is a query type that requests an incremental zone transfer.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1995
+	TypeIXFR Type = 251
+
+	// TypeAXFR is a query type that requests a transfer of an entire zone.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5936
+	TypeAXFR Type = 252
+
+	// TypeANY is a query type that requests all resource records of a name; in
+	// a dynamic update, it stands for all resource record sets of a name.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.2.3
+	TypeANY Type = 255
+
+	// TypeCAA is a certification authority authorization.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8659
+	TypeCAA Type = 257
+)
+
+// TypeToString maps a resource record type to a string.
+var TypeToString = map[Type]string{
+	TypeA:     "A",
+	TypeNS:    "NS",
+	TypeMD:    "MD",
+	TypeMF:    "MF",
+	TypeCNAME: "CNAME",
+	TypeSOA:   "SOA",
+	TypeMB:    "MB",
+	TypeMG:    "MG",
+	TypeMR:    "MR",
+	TypeNULL:  "NULL",
+	TypeWKS:   "WKS",
+	TypePTR:   "PTR",
+	TypeHINFO: "HINFO",
+	TypeMINFO: "MINFO",
+	TypeMX:    "MX",
+	TypeTXT:   "TXT",
+
+	TypeSIG:        "SIG",
+	TypeKEY:        "KEY",
+	TypeAAAA:       "AAAA",
+	TypeSRV:        "SRV",
+	TypeOPT:        "OPT",
+	TypeDS:         "DS",
+	TypeRRSIG:      "RRSIG",
+	TypeNSEC:       "NSEC",
+	TypeDNSKEY:     "DNSKEY",
+	TypeNSEC3:      "NSEC3",
+	TypeNSEC3PARAM: "NSEC3PARAM",
+	TypeZONEMD:     "ZONEMD",
+	TypeTSIG:       "TSIG",
+	TypeIXFR:       "IXFR",
+	TypeAXFR:       "AXFR",
+	TypeANY:        "ANY",
+	TypeCAA:        "CAA",
+}
+
+// Class represents a resource record class.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.2.4
+type Class uint16
+
+// String returns the string representation of a resource record class.
+func (c Class) String() string {
+	return ClassToString[c]
+}
+
+const (
+	ClassUnknown Class = iota
+
+	// ClassIN stands for the internet.
+	ClassIN
+
+	// ClassCH stands for the CHAOS network; it's used to query the identity and
+	// version of a name server (e.g. "version.bind. CH TXT").
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4892#section-2
+	ClassCH Class = 3
+
+	// ClassHS stands for Hesiod.
+	ClassHS Class = 4
+
+	// ClassNONE is used in dynamic updates to require that a resource record
+	// set doesn't exist, or to delete a resource record.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4
+	ClassNONE Class = 254
+
+	// ClassANY is used in dynamic updates to require that a resource record
+	// set exists, or to delete resource record sets, and matches any class in
+	// a question.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4
+	ClassANY Class = 255
+)
+
+// ClassToString maps a resource record type to a string.
+var ClassToString = map[Class]string{
+	ClassIN:   "IN",
+	ClassCH:   "CH",
+	ClassHS:   "HS",
+	ClassNONE: "NONE",
+	ClassANY:  "ANY",
+}
+
+// RR represents a resource record. The message answer, authority, and
+// additional sections all share the same format: a variable number of resource
+// records, where the number of records is specified in the corresponding count
+// field in the message header. Each resource record has the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                                               |
+// /                                               /
+// /                      NAME                     /
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                      TYPE                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     CLASS                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                      TTL                      |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                   RDLENGTH                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--|
+// /                     RDATA                     /
+// /                                               /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.1.3
+type RR struct {
+	// Name is the domain name to which this resource record belongs.
+	Name string
+
+	// Type specifies the meaning of the data in the RDATA field.
+	Type Type
+
+	// Class specifies the class of the data in the RDATA field.
+	Class Class
+
+	// TTL specifies the time (in seconds) that the resource record may be cached.
+	TTL uint32
+
+	// RDLength specifies the length (in bytes) of the RDATA field.
+	RDLength uint16
+
+	// RData describes the resource itself, where the format of this information
+	// varies depending on the TYPE and CLASS of the resource record.
+	//
+	// Domain names in RData are always stored uncompressed, so RData can be
+	// packed (or signed) without the message it was unpacked from.
+	RData []byte
+
+	// RDataUnpacked is a custom field that holds the unpacked RData.
+	// Depending on the Type, RData may or may not hold a domain name. And when
+	// RData holds a domain name, it can be compressed.
+	RDataUnpacked string
+}
+
+// Unpack unpacks the DNS message resource record bytes (big-endian; network
+// order). It returns either the unpacked byte count or an error.
+func (r *RR) Unpack(msg []byte, off int) (int, error) {
+	bytesRead := 0
+
+	name, offn, n, err := unpackDomainName(msg, off)
+	if err != nil {
+		return bytesRead, fmt.Errorf("failed to unpack name: %v", err)
+	}
+	r.Name = name
+	off = offn
+	bytesRead += n
+
+	// TYPE + CLASS + TTL + RDLENGTH = 10 bytes.
+	if off+10 > len(msg) {
+		return bytesRead, fmt.Errorf(
+			"resource record fields at offset %d exceed message length (%d bytes)",
+			off, len(msg),
+		)
+	}
+
+	// The remaining bytes contain the remaining sections; left-shift the first
+	// byte to the "left most" position, and OR it with the remaining byte(s) to
+	// "merge" it back into a single section.
+	//
+	// Type and Class are 2 bytes each.
+	r.Type = Type(uint16(msg[off])<<8 | uint16(msg[off+1]))
+	r.Class = Class(uint16(msg[off+2])<<8 | uint16(msg[off+3]))
+	bytesRead += 4
+
+	// TTL consists of 4 bytes.
+	r.TTL = uint32(msg[off+4])<<24 |
+		uint32(msg[off+5])<<16 |
+		uint32(msg[off+6])<<8 |
+		uint32(msg[off+7])
+	bytesRead += 4
+
+	// RDLength consists of 2 bytes.
+	r.RDLength = uint16(msg[off+8])<<8 | uint16(msg[off+9])
+	bytesRead += 2
+
+	// RData consists of the remaining RDLength bytes.
+	// TYPE + CLASS + TTL + RDLENGTH = 10 bytes.
+	start := off + 10
+	size := int(r.RDLength)
+	end := start + size
+	if end > len(msg) {
+		return bytesRead, fmt.Errorf(
+			"rdata length %d at offset %d exceeds message length (%d bytes)",
+			size, start, len(msg),
+		)
+	}
+	r.RData = msg[start:end]
+	bytesRead += size
+
+	// The prerequisites and updates of a dynamic update with class NONE or ANY
+	// may have empty RDATA.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4
+	if size == 0 && (r.Class == ClassNONE || r.Class == ClassANY) {
+		r.RDataUnpacked = ""
+		return bytesRead, nil
+	}
+
+	// The minimum RDATA length of every type with fixed size fields.
+	minSize := map[Type]int{
+		TypeA:     net.IPv4len,
+		TypeAAAA:  net.IPv6len,
+		TypeCNAME: 1,
+		TypeNS:    1,
+		TypePTR:   1,
+		TypeMX:    3,
+		TypeSRV:   7,
+		TypeSOA:   22,
+		TypeCAA:   2,
+	}
+	if minLen, ok := minSize[r.Type]; ok && size < minLen {
+		return bytesRead, fmt.Errorf(
+			"%s rdata too short: %d bytes", r.Type, size,
+		)
+	}
+
+	// Depending on the RR Type, RData has to be unpacked differently.
+	switch r.Type {
+	// RDATA will contain a 32 bit IP address; needs no additional processing.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc1035#section-3.4.1
+	case TypeA:
+		if size != net.IPv4len {
+			return bytesRead, fmt.Errorf("invalid A rdata length %d", size)
+		}
+		ip := append(net.IP{}, r.RData...)
+		r.RDataUnpacked = ip.String()
+
+	// RDATA will contain a 128 bit IP address; needs no additional processing.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3596#section-2.2
+	case TypeAAAA:
+		if size != net.IPv6len {
+			return bytesRead, fmt.Errorf("invalid AAAA rdata length %d", size)
+		}
+		ip := append(net.IP{}, r.RData...)
+		r.RDataUnpacked = ip.String()
+
+	// RDATA will contain a domain name which specifies the canonical or primary
+	// name for the owner. The owner name is an alias.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.1
+	case TypeCNAME:
+		name, offn, _, err := unpackDomainName(msg, start)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack rdata name: %v", err)
+		}
+		if offn > end {
+			return bytesRead, fmt.Errorf("rdata name exceeds rdata length")
+		}
+		r.RDataUnpacked = name
+		if err := r.setRDataNames(name); err != nil {
+			return bytesRead, err
+		}
+
+	// RDATA will contain a domain name (NSDNAME) which specifies a host which
+	// should be authoritative for the specified class and domain.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.11
+	case TypeNS:
+		name, offn, _, err := unpackDomainName(msg, start)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack rdata name: %v", err)
+		}
+		if offn > end {
+			return bytesRead, fmt.Errorf("rdata name exceeds rdata length")
+		}
+		r.RDataUnpacked = name
+		if err := r.setRDataNames(name); err != nil {
+			return bytesRead, err
+		}
+
+	// RDATA will contain a domain name (PTRDNAME) which points to some location
+	// in the domain name space.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.12
+	case TypePTR:
+		name, offn, _, err := unpackDomainName(msg, start)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack rdata name: %v", err)
+		}
+		if offn > end {
+			return bytesRead, fmt.Errorf("rdata name exceeds rdata length")
+		}
+		r.RDataUnpacked = name
+		if err := r.setRDataNames(name); err != nil {
+			return bytesRead, err
+		}
+
+	// RDATA will contain a 16 bit preference, followed by a domain name
+	// (EXCHANGE) of a host willing to act as a mail exchange for the owner.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.9
+	case TypeMX:
+		pref := r.RData[:2]
+		name, offn, _, err := unpackDomainName(msg, start+2)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack rdata name: %v", err)
+		}
+		if offn > end {
+			return bytesRead, fmt.Errorf("rdata name exceeds rdata length")
+		}
+		r.RDataUnpacked = fmt.Sprintf(
+			"%d %s", uint16(pref[0])<<8|uint16(pref[1]), name,
+		)
+		if err := r.setRDataNames(name); err != nil {
+			return bytesRead, err
+		}
+		r.RData = append(append([]byte{}, pref...), r.RData...)
+		r.RDLength = uint16(len(r.RData))
+
+	// RDATA will contain a 16 bit priority, weight and port, followed by the
+	// domain name (TARGET) of the host providing the service.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2782
+	case TypeSRV:
+		ints := r.RData[:6]
+		name, offn, _, err := unpackDomainName(msg, start+6)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack rdata name: %v", err)
+		}
+		if offn > end {
+			return bytesRead, fmt.Errorf("rdata name exceeds rdata length")
+		}
+		r.RDataUnpacked = fmt.Sprintf(
+			"%d %d %d %s",
+			binary.BigEndian.Uint16(ints[0:]),
+			binary.BigEndian.Uint16(ints[2:]),
+			binary.BigEndian.Uint16(ints[4:]),
+			name,
+		)
+		if err := r.setRDataNames(name); err != nil {
+			return bytesRead, err
+		}
+		r.RData = append(append([]byte{}, ints...), r.RData...)
+		r.RDLength = uint16(len(r.RData))
+
+	// RDATA will contain 2 domain names (MNAME and RNAME), followed by 5 unsigned
+	// 32 bit fields (SERIAL, REFRESH, RETRY, EXPIRE and MINIMUM).
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.13
+	case TypeSOA:
+		mname, offn, _, err := unpackDomainName(msg, start)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack soa mname: %v", err)
+		}
+		rname, offn, _, err := unpackDomainName(msg, offn)
+		if err != nil {
+			return bytesRead, fmt.Errorf("failed to unpack soa rname: %v", err)
+		}
+		if offn+20 != end {
+			return bytesRead, fmt.Errorf("invalid soa rdata length %d", size)
+		}
+		ints := msg[offn:end]
+		r.RDataUnpacked = fmt.Sprintf(
+			"%s %s %d %d %d %d %d",
+			mname, rname,
+			binary.BigEndian.Uint32(ints[0:]),
+			binary.BigEndian.Uint32(ints[4:]),
+			binary.BigEndian.Uint32(ints[8:]),
+			binary.BigEndian.Uint32(ints[12:]),
+			binary.BigEndian.Uint32(ints[16:]),
+		)
+		if err := r.setRDataNames(mname, rname); err != nil {
+			return bytesRead, err
+		}
+		r.RData = append(r.RData, ints...)
+		r.RDLength = uint16(len(r.RData))
+
+	// RDATA will contain one or more character strings, where each string is
+	// prefixed with a length byte.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.14
+	case TypeTXT:
+		txt, err := unpackCharStrings(r.RData)
+		if err != nil {
+			return bytesRead, fmt.Errorf("txt %v", err)
+		}
+		r.RDataUnpacked = strings.Join(txt, " ")
+
+	// RDATA will contain 2 character strings: the CPU and the OS of the host.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.2
+	case TypeHINFO:
+		hinfo, err := unpackCharStrings(r.RData)
+		if err != nil {
+			return bytesRead, fmt.Errorf("hinfo %v", err)
+		}
+		if len(hinfo) != 2 {
+			return bytesRead, fmt.Errorf("invalid hinfo string count %d", len(hinfo))
+		}
+		r.RDataUnpacked = strings.Join(hinfo, " ")
+
+	// RDATA of DNSSEC resource records never contains compressed domain names,
+	// so it can be unpacked without the message.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4034
+	case TypeDS, TypeRRSIG, TypeNSEC, TypeDNSKEY, TypeNSEC3, TypeNSEC3PARAM,
+		TypeSIG, TypeKEY:
+		rd, err := r.Decode()
+		if err != nil {
+			return bytesRead, err
+		}
+		r.RDataUnpacked = rd.String()
+
+	// RDATA will contain the serial of the zone, the scheme and hash algorithm
+	// of the digest, followed by the digest.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8976#section-2
+	case TypeZONEMD:
+		rd, err := r.Decode()
+		if err != nil {
+			return bytesRead, err
+		}
+		r.RDataUnpacked = rd.String()
+
+	// RDATA will contain a flags byte, followed by a property tag and value.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8659#section-4.1
+	case TypeCAA:
+		rd, err := r.Decode()
+		if err != nil {
+			return bytesRead, err
+		}
+		r.RDataUnpacked = rd.String()
+
+	// RDATA will contain the algorithm name, which is never compressed,
+	// followed by the signing time, MAC and error of a transaction signature.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8945#section-4.2
+	case TypeTSIG:
+		rd, err := r.Decode()
+		if err != nil {
+			return bytesRead, err
+		}
+		r.RDataUnpacked = rd.String()
+
+	// The RDATA of types without a presentation format is represented in the
+	// generic format: its length and hex encoded bytes.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc3597#section-5
+	case TypeOPT:
+	default:
+		r.RDataUnpacked = strings.TrimSpace(fmt.Sprintf(
+			"\\# %d %s", size, strings.ToUpper(hex.EncodeToString(r.RData)),
+		))
+	}
+
+	return bytesRead, nil
+}
+
+// unpackCharStrings unpacks the length-prefixed character strings of the
+// RDATA, and returns them quoted in presentation format (see appendEscaped).
+func unpackCharStrings(rdata []byte) ([]string, error) {
+	strs := []string{}
+	for i := 0; i < len(rdata); {
+		size := int(rdata[i])
+		if i+1+size > len(rdata) {
+			return nil, fmt.Errorf("string exceeds rdata length")
+		}
+		str := appendEscaped([]byte{'"'}, rdata[i+1:i+1+size], true)
+		strs = append(strs, string(append(str, '"')))
+		i += 1 + size
+	}
+
+	return strs, nil
+}
+
+// NewRR creates a resource record from its RDATA in wire format, in which
+// domain names must be uncompressed (see PackName). The RDATA is validated
+// like the RDATA of a received resource record, and RDataUnpacked is set.
+func NewRR(name string, t Type, class Class, ttl uint32, rdata []byte) (RR, error) {
+	rr := RR{Name: Fqdn(name), Type: t, Class: class, TTL: ttl, RData: rdata}
+	b, err := rr.Pack()
+	if err != nil {
+		return RR{}, err
+	}
+
+	r := RR{}
+	if _, err := r.Unpack(b, 0); err != nil {
+		return RR{}, err
+	}
+
+	return r, nil
+}
+
+// setRDataNames replaces RData with the uncompressed domain name(s).
+func (r *RR) setRDataNames(names ...string) error {
+	rdata := []byte{}
+	for _, name := range names {
+		nameb, err := packDomainName(name)
+		if err != nil {
+			return fmt.Errorf("failed to pack rdata domain name %s: %v", name, err)
+		}
+		rdata = append(rdata, nameb...)
+	}
+
+	r.RData = rdata
+	r.RDLength = uint16(len(rdata))
+	return nil
+}
+
+// Pack packs the resource record fields into binary format. Domain names are
+// never compressed.
+func (r *RR) Pack() ([]byte, error) {
+	buff := new(bytes.Buffer)
+
+	nameb, err := packDomainName(r.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack name: %v", err)
+	}
+	if err := binary.Write(buff, binary.BigEndian, nameb); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(buff, binary.BigEndian, r.Type); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buff, binary.BigEndian, r.Class); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buff, binary.BigEndian, r.TTL); err != nil {
+		return nil, err
+	}
+
+	// RDLength always reflects the RData that is packed.
+	if err := binary.Write(buff, binary.BigEndian, uint16(len(r.RData))); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buff, binary.BigEndian, r.RData); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// String returns a "dig like" string representation of the resource.
+func (r *RR) String() string {
+	if r.Type == TypeOPT {
+		return optString(r)
+	}
+
+	return fmt.Sprintf(
+		"%s\t%d\t%s\t%s\t%s",
+		r.Name, r.TTL, r.Class, r.Type, r.RDataUnpacked,
+	)
+}
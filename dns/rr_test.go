@@ -0,0 +1,157 @@
+package dns
+
+import "testing"
+
+func TestSRVPackUnpack(t *testing.T) {
+	rr := RR{
+		Name:  "_sip._tcp.danillouz.dev.",
+		Type:  TypeSRV,
+		Class: ClassIN,
+		TTL:   300,
+		RData: append(
+			[]byte{0, 10, 0, 60, 0x13, 0xc4},
+			[]byte{3, 's', 'i', 'p', 9, 'd', 'a', 'n', 'i', 'l', 'l', 'o', 'u', 'z', 3, 'd', 'e', 'v', 0}...,
+		),
+	}
+
+	b, err := rr.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := new(RR)
+	if _, err := r.Unpack(b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "10 60 5060 sip.danillouz.dev."
+	if r.RDataUnpacked != want {
+		t.Errorf("unpacked srv rdata error: got %q - want %q", r.RDataUnpacked, want)
+	}
+	if string(r.RData) != string(rr.RData) {
+		t.Errorf("unpacked srv rdata bytes error: got %v - want %v", r.RData, rr.RData)
+	}
+
+	// The rdata is too short to hold the priority, weight, port and target.
+	rr.RData = rr.RData[:6]
+	b, err = rr.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(RR).Unpack(b, 0); err == nil {
+		t.Errorf("unpack short srv rdata error: got nil - want error")
+	}
+}
+
+func TestCAAPackUnpack(t *testing.T) {
+	caa := CAA{Flags: CAAFlagCritical, Tag: "issue", Value: "letsencrypt.org; validationmethods=dns-01"}
+	rdata, err := caa.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := RR{Name: "danillouz.dev.", Type: TypeCAA, Class: ClassIN, TTL: 300, RData: rdata}
+
+	b, err := rr.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := new(RR)
+	if _, err := r.Unpack(b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `128 issue "letsencrypt.org; validationmethods=dns-01"`
+	if r.RDataUnpacked != want {
+		t.Errorf("unpacked caa rdata error: got %q - want %q", r.RDataUnpacked, want)
+	}
+
+	rd, err := r.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rd.(*CAA); *got != caa || !got.Critical() {
+		t.Errorf("decoded caa error: got %+v - want %+v", *got, caa)
+	}
+
+	// The tag length exceeds the rdata.
+	rr.RData = []byte{0, 9, 'i', 's', 's', 'u', 'e'}
+	b, err = rr.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(RR).Unpack(b, 0); err == nil {
+		t.Errorf("unpack invalid caa rdata error: got nil - want error")
+	}
+}
+
+func TestNewRR(t *testing.T) {
+	target, err := PackName("mail.danillouz.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewRR("danillouz.dev", TypeMX, ClassIN, 300, append([]byte{0, 10}, target...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "danillouz.dev.\t300\tIN\tMX\t10 mail.danillouz.dev."
+	if got := rr.String(); got != want {
+		t.Errorf("mx rr error: got %q - want %q", got, want)
+	}
+
+	// The rdata is too short to hold the preference and exchange.
+	if _, err := NewRR("danillouz.dev.", TypeMX, ClassIN, 300, []byte{0, 10}); err == nil {
+		t.Errorf("new rr with short mx rdata error: got nil - want error")
+	}
+}
+
+func TestUnpackHINFOAndGeneric(t *testing.T) {
+	tests := []struct {
+		t     Type
+		rdata []byte
+		want  string
+	}{
+		{TypeHINFO, []byte{3, 'a', 'r', 'm', 5, 'l', 'i', 'n', 'u', 'x'}, `"arm" "linux"`},
+		{Type(65280), []byte{0x0a, 0, 0, 1}, `\# 4 0A000001`},
+		{Type(65280), []byte{}, `\# 0`},
+	}
+	for _, tc := range tests {
+		rr, err := NewRR("danillouz.dev.", tc.t, ClassIN, 300, tc.rdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rr.RDataUnpacked != tc.want {
+			t.Errorf("unpacked %s rdata error: got %q - want %q", tc.t, rr.RDataUnpacked, tc.want)
+		}
+	}
+
+	// HINFO must have exactly 2 strings.
+	if _, err := NewRR("danillouz.dev.", TypeHINFO, ClassIN, 300, []byte{1, 'x'}); err == nil {
+		t.Errorf("unpack hinfo with 1 string error: got nil - want error")
+	}
+}
+
+func TestUnpackEscaped(t *testing.T) {
+	tests := []struct {
+		name  string
+		t     Type
+		rdata []byte
+		want  string
+	}{
+		{`a\032b.dev.`, TypeCNAME, []byte{3, 'a', '.', 'b', 3, 'd', 'e', 'v', 0}, `a\.b.dev.`},
+		{`\(\;\).dev.`, TypeTXT, []byte{6, 'a', ' ', '"', '\\', 0, 0xff}, `"a \"\\\000\255"`},
+	}
+	for _, tc := range tests {
+		rr, err := NewRR(tc.name, tc.t, ClassIN, 300, tc.rdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rr.Name != tc.name {
+			t.Errorf("unpacked name error: got %q - want %q", rr.Name, tc.name)
+		}
+		if rr.RDataUnpacked != tc.want {
+			t.Errorf("unpacked %s rdata error: got %q - want %q", tc.t, rr.RDataUnpacked, tc.want)
+		}
+	}
+}
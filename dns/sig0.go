@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSIG0Fudge is the number of seconds a SIG(0) signature is valid before
+// and after the time it was signed.
+const DefaultSIG0Fudge = 300
+
+// SignSIG0 signs the message with the private key of the key (a KEY or DNSKEY
+// resource record owned by the signer) at the time, and adds the SIG(0)
+// resource record to the additional section; the message must not be changed
+// after it's signed. A response is signed with the request it answers (as it
+// was received, including its signature); a request is signed without one
+// (nil).
+//
+// Unlike TSIG, a SIG(0) signature is created with a public key pair, so the
+// verifier only needs to know the public key.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2931#section-3
+func (m *Msg) SignSIG0(priv crypto.Signer, key *DNSKEY, signer string, request []byte, now time.Time) error {
+	b, err := m.Pack()
+	if err != nil {
+		return err
+	}
+
+	sig := &RRSIG{
+		Algorithm:  key.Algorithm,
+		Expiration: uint32(now.Unix()) + DefaultSIG0Fudge,
+		Inception:  uint32(now.Unix()) - DefaultSIG0Fudge,
+		KeyTag:     key.KeyTag(),
+		SignerName: CanonicalName(Fqdn(signer)),
+	}
+	data, err := sig.packWithoutSignature()
+	if err != nil {
+		return err
+	}
+	data = append(append(data, request...), b...)
+	if sig.Signature, err = signData(priv, sig.Algorithm, data); err != nil {
+		return fmt.Errorf("failed to sign message: %v", err)
+	}
+	rdata, err := sig.Pack()
+	if err != nil {
+		return err
+	}
+	m.Additional = append(m.Additional, RR{
+		Name:     ".",
+		Type:     TypeSIG,
+		Class:    ClassANY,
+		RDLength: uint16(len(rdata)),
+		RData:    rdata,
+	})
+
+	return nil
+}
+
+// VerifySIG0 verifies the SIG(0) resource record of an unpacked message with
+// the key of the signer at the time. A response is verified with the request
+// it answers (as it was sent, including its signature).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2931#section-3.2
+func (m *Msg) VerifySIG0(key *DNSKEY, signer string, request []byte, now time.Time) error {
+	if len(m.Additional) == 0 || m.Additional[len(m.Additional)-1].Type != TypeSIG {
+		return fmt.Errorf("message isn't signed with SIG(0)")
+	}
+	if m.signed == nil {
+		return fmt.Errorf("message wasn't unpacked")
+	}
+	rr := m.Additional[len(m.Additional)-1]
+	sig := new(RRSIG)
+	if err := sig.Unpack(rr.RData); err != nil {
+		return fmt.Errorf("invalid SIG record: %v", err)
+	}
+	if rr.Name != "." || sig.TypeCovered != 0 {
+		return fmt.Errorf("SIG record isn't a SIG(0) transaction signature")
+	}
+	if !strings.EqualFold(Fqdn(sig.SignerName), Fqdn(signer)) {
+		return fmt.Errorf("SIG(0) signer %s is unknown", sig.SignerName)
+	}
+	if key.Protocol != 3 {
+		return fmt.Errorf("invalid key protocol %d", key.Protocol)
+	}
+	if key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+		return fmt.Errorf("key does not match signature")
+	}
+	if !sig.ValidAt(now) {
+		return fmt.Errorf(
+			"SIG(0) signature isn't valid at %s (valid from %s to %s)",
+			now.UTC().Format(time.RFC3339),
+			formatSigTime(sig.Inception), formatSigTime(sig.Expiration),
+		)
+	}
+
+	// The message is signed without its SIG(0) resource record.
+	b := append([]byte{}, m.signed...)
+	binary.BigEndian.PutUint16(b[10:], binary.BigEndian.Uint16(b[10:])-1)
+	data, err := sig.packWithoutSignature()
+	if err != nil {
+		return err
+	}
+	data = append(append(data, request...), b...)
+
+	return verifyData(key, sig.Algorithm, data, sig.Signature)
+}
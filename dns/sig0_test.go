@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+// sig0Msg signs the message with SIG(0), packs it, and returns it unpacked
+// with its packed form.
+func sig0Msg(t *testing.T, m *Msg, priv crypto.Signer, key *DNSKEY, request []byte, now time.Time) (*Msg, []byte) {
+	t.Helper()
+
+	if err := m.SignSIG0(priv, key, "key.example.org.", request, now); err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Msg)
+	if _, err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return got, b
+}
+
+func TestSIG0(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPub := append(ecPriv.X.FillBytes(make([]byte, 32)), ecPriv.Y.FillBytes(make([]byte, 32))...)
+
+	tests := []struct {
+		alg  Algorithm
+		pub  []byte
+		priv crypto.Signer
+	}{
+		{alg: AlgorithmED25519, pub: edPub, priv: edPriv},
+		{alg: AlgorithmECDSAP256SHA256, pub: ecPub, priv: ecPriv},
+	}
+
+	now := time.Now()
+	for _, tt := range tests {
+		// A KEY record of a host, which isn't a zone key.
+		key := &DNSKEY{Flags: 512, Protocol: 3, Algorithm: tt.alg, PublicKey: tt.pub}
+
+		req := new(Msg)
+		if err := req.SetUpdate("example.org."); err != nil {
+			t.Fatal(err)
+		}
+		req.Insert(RR{Name: "www.example.org.", Type: TypeA, Class: ClassIN, TTL: 300, RData: []byte{192, 0, 2, 1}})
+		got, reqb := sig0Msg(t, req, tt.priv, key, nil, now)
+		sig := got.Additional[len(got.Additional)-1]
+		if sig.Type != TypeSIG || sig.Name != "." || sig.Class != ClassANY || sig.TTL != 0 {
+			t.Errorf("%s SIG(0) record error: got %+v", tt.alg, sig)
+		}
+		if err := got.VerifySIG0(key, "key.example.org.", nil, now); err != nil {
+			t.Errorf("%s request verification error: %v", tt.alg, err)
+		}
+		if err := got.VerifySIG0(key, "other.example.org.", nil, now); err == nil {
+			t.Errorf("%s unknown signer error: got nil - want error", tt.alg)
+		}
+		if err := got.VerifySIG0(key, "key.example.org.", nil, now.Add(time.Hour)); err == nil {
+			t.Errorf("%s expired signature error: got nil - want error", tt.alg)
+		}
+
+		// A response is signed with the request it answers.
+		resp := &Msg{Header: got.Header, Question: got.Question}
+		resp.QR = 1
+		gotResp, _ := sig0Msg(t, resp, tt.priv, key, reqb, now)
+		if err := gotResp.VerifySIG0(key, "key.example.org.", reqb, now); err != nil {
+			t.Errorf("%s response verification error: %v", tt.alg, err)
+		}
+		if err := gotResp.VerifySIG0(key, "key.example.org.", nil, now); err == nil {
+			t.Errorf("%s response without request error: got nil - want error", tt.alg)
+		}
+
+		// Tampering with the message invalidates the signature.
+		reqb[len(reqb)-len(sig.RData)-12] ^= 0xff
+		tampered := new(Msg)
+		if _, err := tampered.Unpack(reqb); err != nil {
+			t.Fatal(err)
+		}
+		if err := tampered.VerifySIG0(key, "key.example.org.", nil, now); err == nil {
+			t.Errorf("%s tampered request error: got nil - want error", tt.alg)
+		}
+	}
+
+	unsigned := new(Msg)
+	if err := unsigned.VerifySIG0(&DNSKEY{}, "key.example.org.", nil, now); err == nil {
+		t.Error("unsigned message error: got nil - want error")
+	}
+}
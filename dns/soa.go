@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SOA marks the start of a zone of authority. Its RDATA has the following
+// format:
+//
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                     MNAME                     /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                     RNAME                     /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    SERIAL                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    REFRESH                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     RETRY                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    EXPIRE                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                    MINIMUM                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.13
+type SOA struct {
+	// MName is the primary name server of the zone, and RName the mailbox of
+	// the person responsible for it.
+	MName string
+	RName string
+
+	// Serial is the version number of the zone.
+	Serial uint32
+
+	// Refresh is the number of seconds after which secondary name servers check
+	// if the zone changed, Retry is the number of seconds after which a failed
+	// refresh is retried, and Expire is the number of seconds after which a
+	// zone that couldn't be refreshed is no longer authoritative.
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+
+	// Minimum is the max TTL of negative answers.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2308#section-4
+	Minimum uint32
+}
+
+// Pack packs the SOA RDATA fields into binary format.
+func (s *SOA) Pack() ([]byte, error) {
+	b, err := PackName(s.MName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mname: %v", err)
+	}
+	rname, err := PackName(s.RName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rname: %v", err)
+	}
+	b = append(b, rname...)
+
+	for _, v := range []uint32{s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum} {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+
+	return b, nil
+}
+
+// Unpack unpacks the SOA RDATA bytes.
+func (s *SOA) Unpack(rdata []byte) error {
+	mname, off, _, err := unpackDomainName(rdata, 0)
+	if err != nil {
+		return fmt.Errorf("invalid mname: %v", err)
+	}
+	rname, off, _, err := unpackDomainName(rdata, off)
+	if err != nil {
+		return fmt.Errorf("invalid rname: %v", err)
+	}
+	if len(rdata)-off != 20 {
+		return fmt.Errorf("invalid rdata length %d", len(rdata))
+	}
+
+	ints := rdata[off:]
+	s.MName = mname
+	s.RName = rname
+	s.Serial = binary.BigEndian.Uint32(ints[0:])
+	s.Refresh = binary.BigEndian.Uint32(ints[4:])
+	s.Retry = binary.BigEndian.Uint32(ints[8:])
+	s.Expire = binary.BigEndian.Uint32(ints[12:])
+	s.Minimum = binary.BigEndian.Uint32(ints[16:])
+	return nil
+}
+
+// String returns the presentation format of the SOA RDATA.
+func (s *SOA) String() string {
+	return fmt.Sprintf(
+		"%s %s %d %d %d %d %d",
+		s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum,
+	)
+}
+
+// CompareSerial compares two zone serial numbers with serial number
+// arithmetic, which wraps around: it returns -1 when a precedes b, 1 when a
+// follows b, and 0 when they're equal or their order is undefined.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1982#section-3.2
+func CompareSerial(a, b uint32) int {
+	switch d := int32(b - a); {
+	case a == b || d == -1<<31:
+		return 0
+	case d > 0:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,56 @@
+package dns
+
+import "testing"
+
+func TestSOAPackUnpack(t *testing.T) {
+	soa := SOA{
+		MName:   "ns1.example.org.",
+		RName:   "hostmaster.example.org.",
+		Serial:  2024010101,
+		Refresh: 7200,
+		Retry:   3600,
+		Expire:  1209600,
+		Minimum: 300,
+	}
+
+	b, err := soa.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewRR("example.org.", TypeSOA, ClassIN, 3600, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.RDataUnpacked != soa.String() {
+		t.Errorf("rdata error: got %s - want %s", rr.RDataUnpacked, soa.String())
+	}
+
+	rd, err := rr.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := rd.(*SOA); !ok || *s != soa {
+		t.Errorf("decoded soa error: got %v - want %v", rd, soa)
+	}
+}
+
+func TestCompareSerial(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want int
+	}{
+		{1, 1, 0},
+		{1, 2, -1},
+		{2, 1, 1},
+		// Serial numbers wrap around.
+		{4294967295, 0, -1},
+		{0, 4294967295, 1},
+		{0, 1 << 31, 0},
+	}
+
+	for _, tc := range tests {
+		if got := CompareSerial(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareSerial(%d, %d): got %d - want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// TSIG algorithms (HMAC hash functions).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-6
+const (
+	HmacMD5    = "hmac-md5.sig-alg.reg.int."
+	HmacSHA1   = "hmac-sha1."
+	HmacSHA224 = "hmac-sha224."
+	HmacSHA256 = "hmac-sha256."
+	HmacSHA384 = "hmac-sha384."
+	HmacSHA512 = "hmac-sha512."
+)
+
+// DefaultTSIGFudge is the number of seconds the signing time of a message may
+// differ from the current time.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-10
+const DefaultTSIGFudge = 300
+
+// tsigHashes maps a TSIG algorithm to its hash function.
+var tsigHashes = map[string]func() hash.Hash{
+	HmacMD5:    md5.New,
+	HmacSHA1:   sha1.New,
+	HmacSHA224: sha256.New224,
+	HmacSHA256: sha256.New,
+	HmacSHA384: sha512.New384,
+	HmacSHA512: sha512.New,
+}
+
+// TSIGKey is a shared secret that's used to sign messages with TSIG.
+type TSIGKey struct {
+	// Name identifies the key; both parties must use the same name.
+	Name string
+
+	// Algorithm is the TSIG algorithm (e.g. HmacSHA256).
+	Algorithm string
+
+	Secret []byte
+}
+
+// ParseTSIGKey parses a TSIG key in the format "[algorithm:]name:secret",
+// where the secret is base64 encoded and the algorithm is the name of a TSIG
+// algorithm, with or without the trailing dot (e.g. "hmac-sha256"; the
+// default).
+func ParseTSIGKey(s string) (*TSIGKey, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid TSIG key %q; expected [algorithm:]name:secret", s)
+	}
+	alg := HmacSHA256
+	if len(parts) == 3 {
+		alg, parts = strings.ToLower(Fqdn(parts[0])), parts[1:]
+		if alg == "hmac-md5." {
+			alg = HmacMD5
+		}
+		if _, ok := tsigHashes[alg]; !ok {
+			return nil, fmt.Errorf("unsupported TSIG algorithm %q", alg)
+		}
+	}
+	if parts[0] == "" {
+		return nil, fmt.Errorf("invalid TSIG key %q: missing name", s)
+	}
+	secret, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("invalid TSIG key %q: secret must be base64 encoded", s)
+	}
+
+	return &TSIGKey{Name: Fqdn(parts[0]), Algorithm: alg, Secret: secret}, nil
+}
+
+// mac computes the MAC of the signed data with the key.
+func (k *TSIGKey) mac(data ...[]byte) ([]byte, error) {
+	h, ok := tsigHashes[CanonicalName(Fqdn(k.Algorithm))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", k.Algorithm)
+	}
+
+	mac := hmac.New(h, k.Secret)
+	for _, b := range data {
+		mac.Write(b)
+	}
+
+	return mac.Sum(nil), nil
+}
+
+// TSIG is a transaction signature; the last resource record of a signed
+// message. Its RDATA has the following format:
+//
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                 ALGORITHM NAME                /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                                               |
+// |          TIME SIGNED                          |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     FUDGE                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                   MAC SIZE                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                      MAC                      /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                  ORIGINAL ID                  |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     ERROR                     |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                  OTHER LEN                    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                  OTHER DATA                   /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-4.2
+type TSIG struct {
+	Algorithm string
+
+	// TimeSigned is the signing time in seconds since the Unix epoch (48 bits),
+	// and Fudge the number of seconds it may differ from the time of the
+	// receiver.
+	TimeSigned uint64
+	Fudge      uint16
+
+	MAC []byte
+
+	// OrigID is the ID of the message when it was signed.
+	OrigID uint16
+
+	// Error is the TSIG error (e.g. RCodeBadSig), and OtherData holds the time
+	// of the server for a BADTIME error.
+	Error     RCode
+	OtherData []byte
+}
+
+// Pack packs the TSIG RDATA fields into binary format.
+func (t *TSIG) Pack() ([]byte, error) {
+	b, err := PackName(t.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid algorithm: %v", err)
+	}
+	ts := t.TimeSigned
+	b = append(b, byte(ts>>40), byte(ts>>32), byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+	b = append(b, byte(t.Fudge>>8), byte(t.Fudge))
+	b = append(b, byte(len(t.MAC)>>8), byte(len(t.MAC)))
+	b = append(b, t.MAC...)
+	b = append(b, byte(t.OrigID>>8), byte(t.OrigID), 0, byte(t.Error))
+	b = append(b, byte(len(t.OtherData)>>8), byte(len(t.OtherData)))
+
+	return append(b, t.OtherData...), nil
+}
+
+// Unpack unpacks the TSIG RDATA bytes.
+func (t *TSIG) Unpack(rdata []byte) error {
+	alg, off, _, err := unpackDomainName(rdata, 0)
+	if err != nil {
+		return fmt.Errorf("invalid algorithm: %v", err)
+	}
+
+	// TIME SIGNED + FUDGE + MAC SIZE = 10 bytes.
+	if len(rdata) < off+10 {
+		return fmt.Errorf("invalid rdata length %d", len(rdata))
+	}
+	b := rdata[off:]
+	t.Algorithm = alg
+	t.TimeSigned = uint64(binary.BigEndian.Uint16(b))<<32 | uint64(binary.BigEndian.Uint32(b[2:]))
+	t.Fudge = binary.BigEndian.Uint16(b[6:])
+	size := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[10:]
+
+	// MAC + ORIGINAL ID + ERROR + OTHER LEN = MAC SIZE + 6 bytes.
+	if len(b) < size+6 {
+		return fmt.Errorf("invalid rdata length %d", len(rdata))
+	}
+	t.MAC = append([]byte{}, b[:size]...)
+	b = b[size:]
+	t.OrigID = binary.BigEndian.Uint16(b)
+	rc := binary.BigEndian.Uint16(b[2:])
+	if rc > 0xff {
+		return fmt.Errorf("invalid error %d", rc)
+	}
+	t.Error = RCode(rc)
+	other := int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) != other+6 {
+		return fmt.Errorf("invalid rdata length %d", len(rdata))
+	}
+	t.OtherData = append([]byte{}, b[6:]...)
+
+	return nil
+}
+
+// String returns the presentation format of the TSIG RDATA.
+func (t *TSIG) String() string {
+	return fmt.Sprintf(
+		"%s %d %d %d %s %d %d %d %s",
+		t.Algorithm, t.TimeSigned, t.Fudge, len(t.MAC), base64.StdEncoding.EncodeToString(t.MAC),
+		t.OrigID, t.Error, len(t.OtherData), base64.StdEncoding.EncodeToString(t.OtherData),
+	)
+}
+
+// variables returns the TSIG variables that are signed along with the message
+// of the key. With timersOnly, only the time signed and fudge are signed (for
+// the messages of a zone transfer after the first one).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-4.3.3
+func (t *TSIG) variables(name string, timersOnly bool) ([]byte, error) {
+	b := []byte{}
+	if !timersOnly {
+		nameb, err := PackName(CanonicalName(Fqdn(name)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key name: %v", err)
+		}
+		algb, err := PackName(CanonicalName(Fqdn(t.Algorithm)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid algorithm: %v", err)
+		}
+
+		// The class is ANY, and the TTL is 0.
+		b = append(b, nameb...)
+		b = append(b, byte(ClassANY>>8), byte(ClassANY), 0, 0, 0, 0)
+		b = append(b, algb...)
+	}
+
+	ts := t.TimeSigned
+	b = append(b, byte(ts>>40), byte(ts>>32), byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+	b = append(b, byte(t.Fudge>>8), byte(t.Fudge))
+	if timersOnly {
+		return b, nil
+	}
+	b = append(b, 0, byte(t.Error))
+	b = append(b, byte(len(t.OtherData)>>8), byte(len(t.OtherData)))
+
+	return append(b, t.OtherData...), nil
+}
+
+// macPrefix returns the MAC of a request (or of the previous message of a zone
+// transfer) as it's prepended to the signed data; it's empty for a request.
+func macPrefix(mac []byte) []byte {
+	if mac == nil {
+		return nil
+	}
+
+	return append([]byte{byte(len(mac) >> 8), byte(len(mac))}, mac...)
+}
+
+// SignTSIG signs the message with the key at the time, and adds the TSIG
+// resource record to the additional section; the message must not be changed
+// after it's signed. A response is signed with the MAC of the request; a
+// request is signed without one (nil). The messages of a zone transfer after
+// the first one are signed with the MAC of the previous message, and
+// timersOnly set. It returns the MAC, which is needed to verify the response
+// (or to sign the next message).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-5.1
+func (m *Msg) SignTSIG(key *TSIGKey, requestMAC []byte, timersOnly bool, now time.Time) ([]byte, error) {
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TSIG{
+		Algorithm:  CanonicalName(Fqdn(key.Algorithm)),
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      DefaultTSIGFudge,
+		OrigID:     m.ID,
+	}
+	vars, err := t.variables(key.Name, timersOnly)
+	if err != nil {
+		return nil, err
+	}
+	if t.MAC, err = key.mac(macPrefix(requestMAC), b, vars); err != nil {
+		return nil, err
+	}
+	rdata, err := t.Pack()
+	if err != nil {
+		return nil, err
+	}
+	m.Additional = append(m.Additional, RR{
+		Name:     CanonicalName(Fqdn(key.Name)),
+		Type:     TypeTSIG,
+		Class:    ClassANY,
+		RDLength: uint16(len(rdata)),
+		RData:    rdata,
+	})
+
+	return t.MAC, nil
+}
+
+// VerifyTSIG verifies the TSIG resource record of an unpacked message with the
+// key at the time. A response is verified with the MAC of the request, and the
+// messages of a zone transfer after the first one are verified with the MAC
+// of the previous message, and timersOnly set. It returns the MAC of the
+// message.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945#section-5.2
+func (m *Msg) VerifyTSIG(key *TSIGKey, requestMAC []byte, timersOnly bool, now time.Time) ([]byte, error) {
+	if len(m.Additional) == 0 || m.Additional[len(m.Additional)-1].Type != TypeTSIG {
+		return nil, fmt.Errorf("message isn't signed with TSIG")
+	}
+	if m.signed == nil {
+		return nil, fmt.Errorf("message wasn't unpacked")
+	}
+	rr := m.Additional[len(m.Additional)-1]
+	t := new(TSIG)
+	if err := t.Unpack(rr.RData); err != nil {
+		return nil, fmt.Errorf("invalid TSIG record: %v", err)
+	}
+	if !strings.EqualFold(Fqdn(rr.Name), Fqdn(key.Name)) {
+		return nil, fmt.Errorf("TSIG key %s is unknown", rr.Name)
+	}
+	if !strings.EqualFold(Fqdn(t.Algorithm), Fqdn(key.Algorithm)) {
+		return nil, fmt.Errorf("TSIG algorithm %s doesn't match the key", t.Algorithm)
+	}
+
+	// A response with a TSIG error isn't signed (except for BADTIME).
+	if t.Error != RCodeNoError {
+		return nil, fmt.Errorf("TSIG error: %s", t.Error)
+	}
+
+	// The message is signed without its TSIG resource record, and with its
+	// original ID.
+	b := append([]byte{}, m.signed...)
+	binary.BigEndian.PutUint16(b, t.OrigID)
+	binary.BigEndian.PutUint16(b[10:], binary.BigEndian.Uint16(b[10:])-1)
+	vars, err := t.variables(rr.Name, timersOnly)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := key.mac(macPrefix(requestMAC), b, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// A truncated MAC must hold at least half of the MAC, and at least 10
+	// bytes.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc8945#section-5.2.2.1
+	if n := len(t.MAC); n < len(mac) && n >= 10 && n >= len(mac)/2 {
+		mac = mac[:n]
+	}
+	if !hmac.Equal(mac, t.MAC) {
+		return nil, fmt.Errorf("TSIG error: %s", RCodeBadSig)
+	}
+
+	signed := time.Unix(int64(t.TimeSigned), 0)
+	if d := now.Sub(signed); d > time.Duration(t.Fudge)*time.Second || -d > time.Duration(t.Fudge)*time.Second {
+		return nil, fmt.Errorf("TSIG error: %s (signed at %s)", RCodeBadTime, signed.UTC().Format(time.RFC3339))
+	}
+
+	return t.MAC, nil
+}
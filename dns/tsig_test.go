@@ -0,0 +1,156 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTSIGKey(t *testing.T) {
+	tests := []struct {
+		s    string
+		want *TSIGKey
+		err  bool
+	}{
+		{s: "key.example.:c2VjcmV0", want: &TSIGKey{Name: "key.example.", Algorithm: HmacSHA256, Secret: []byte("secret")}},
+		{s: "hmac-sha512:key:c2VjcmV0", want: &TSIGKey{Name: "key.", Algorithm: HmacSHA512, Secret: []byte("secret")}},
+		{s: "hmac-md5:key:c2VjcmV0", want: &TSIGKey{Name: "key.", Algorithm: HmacMD5, Secret: []byte("secret")}},
+		{s: "key", err: true},
+		{s: "hmac-foo:key:c2VjcmV0", err: true},
+		{s: "key:not base64", err: true},
+		{s: ":c2VjcmV0", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTSIGKey(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: got no error", tt.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.s, err)
+			continue
+		}
+		if got.Name != tt.want.Name || got.Algorithm != tt.want.Algorithm || string(got.Secret) != string(tt.want.Secret) {
+			t.Errorf("%s: got %+v - want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+// signedMsg signs the message with the key, packs it, and returns it unpacked.
+func signedMsg(t *testing.T, m *Msg, key *TSIGKey, requestMAC []byte, now time.Time) (*Msg, []byte) {
+	t.Helper()
+
+	mac, err := m.SignTSIG(key, requestMAC, false, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Msg)
+	if _, err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return got, mac
+}
+
+func TestTSIG(t *testing.T) {
+	key := &TSIGKey{Name: "Key.Example.", Algorithm: HmacSHA256, Secret: []byte("secret")}
+	now := time.Unix(1700000000, 0)
+
+	query := new(Msg)
+	if err := query.SetQuery("example.org.", TypeAXFR); err != nil {
+		t.Fatal(err)
+	}
+	signed, requestMAC := signedMsg(t, query, key, nil, now)
+	if n := len(signed.Additional); n != 1 || signed.Additional[0].Type != TypeTSIG {
+		t.Fatalf("additional error: got %v - want a TSIG record", signed.Additional)
+	}
+	if !strings.HasPrefix(signed.Additional[0].RDataUnpacked, "hmac-sha256. 1700000000 300 32 ") {
+		t.Errorf("tsig rdata error: got %s", signed.Additional[0].RDataUnpacked)
+	}
+	mac, err := signed.VerifyTSIG(key, nil, false, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if string(mac) != string(requestMAC) {
+		t.Errorf("mac error: got %x - want %x", mac, requestMAC)
+	}
+
+	// The response is signed with the MAC of the request, and the next message
+	// of a zone transfer with the MAC of the response.
+	resp := *query
+	resp.QR = 1
+	resp.Additional = nil
+	signedResp, respMAC := signedMsg(t, &resp, key, requestMAC, now)
+	if _, err := signedResp.VerifyTSIG(key, requestMAC, false, now); err != nil {
+		t.Errorf("failed to verify response: %v", err)
+	}
+	if _, err := signedResp.VerifyTSIG(key, nil, false, now); err == nil {
+		t.Error("verified a response without the request MAC")
+	}
+	next := resp
+	next.Additional = nil
+	next.Answer = []RR{{Name: "example.org.", Type: TypeA, Class: ClassIN, TTL: 300, RData: []byte{192, 0, 2, 1}}}
+	if _, err := next.SignTSIG(key, respMAC, true, now); err != nil {
+		t.Fatal(err)
+	}
+	b, err := next.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedNext := new(Msg)
+	if _, err := signedNext.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signedNext.VerifyTSIG(key, respMAC, true, now); err != nil {
+		t.Errorf("failed to verify the next message: %v", err)
+	}
+	if _, err := signedNext.VerifyTSIG(key, respMAC, false, now); err == nil {
+		t.Error("verified the next message with all TSIG variables")
+	}
+
+	tests := []struct {
+		name string
+		key  *TSIGKey
+		now  time.Time
+		edit func(b []byte)
+	}{
+		{"wrong secret", &TSIGKey{Name: key.Name, Algorithm: HmacSHA256, Secret: []byte("other")}, now, nil},
+		{"unknown key", &TSIGKey{Name: "other.", Algorithm: HmacSHA256, Secret: key.Secret}, now, nil},
+		{"other algorithm", &TSIGKey{Name: key.Name, Algorithm: HmacSHA1, Secret: key.Secret}, now, nil},
+		{"expired", key, now.Add(10 * time.Minute), nil},
+		{"changed", key, now, func(b []byte) { b[2] ^= 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := *query
+			m.Additional = nil
+			if _, err := m.SignTSIG(key, nil, false, now); err != nil {
+				t.Fatal(err)
+			}
+			b, err := m.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				tt.edit(b)
+			}
+			got := new(Msg)
+			if _, err := got.Unpack(b); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := got.VerifyTSIG(tt.key, nil, false, tt.now); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	if _, err := query.VerifyTSIG(key, nil, false, now); err == nil {
+		t.Error("verified a message that wasn't unpacked")
+	}
+}
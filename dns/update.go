@@ -0,0 +1,109 @@
+package dns
+
+import "fmt"
+
+// SetUpdate makes the message a dynamic update of the zone (of class IN). In
+// an update, the question section holds the zone, the answer section holds the
+// prerequisites, and the authority section holds the updates; the
+// prerequisites and updates are added with the methods below. The name server
+// only applies the updates when all prerequisites are met.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2
+func (m *Msg) SetUpdate(zone string) error {
+	id, err := generateMsgID()
+	if err != nil {
+		return fmt.Errorf("failed to generate message ID: %v", err)
+	}
+
+	m.ID = id
+	m.QR = 0
+	m.OpCode = OpCodeUpdate
+	m.RD = 0
+	m.QDCount = 1
+	m.Question = Question{
+		QName:  Fqdn(zone),
+		QType:  TypeSOA,
+		QClass: ClassIN,
+	}
+
+	return nil
+}
+
+// NameUsed requires the name to own at least one resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4.4
+func (m *Msg) NameUsed(name string) {
+	m.Answer = append(m.Answer, updateRR(name, TypeANY, ClassANY))
+}
+
+// NameNotUsed requires the name to own no resource records.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4.5
+func (m *Msg) NameNotUsed(name string) {
+	m.Answer = append(m.Answer, updateRR(name, TypeANY, ClassNONE))
+}
+
+// RRsetUsed requires a resource record set of the name and type to exist,
+// regardless of its resource records.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4.1
+func (m *Msg) RRsetUsed(name string, t Type) {
+	m.Answer = append(m.Answer, updateRR(name, t, ClassANY))
+}
+
+// RRsetNotUsed requires no resource record set of the name and type to exist.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4.3
+func (m *Msg) RRsetNotUsed(name string, t Type) {
+	m.Answer = append(m.Answer, updateRR(name, t, ClassNONE))
+}
+
+// Used requires the resource record sets of the resource records to exist, and
+// to hold exactly these resource records (their TTLs are ignored).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.4.2
+func (m *Msg) Used(rrs ...RR) {
+	for _, rr := range rrs {
+		rr.TTL = 0
+		m.Answer = append(m.Answer, rr)
+	}
+}
+
+// Insert adds the resource records to the zone.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.5.1
+func (m *Msg) Insert(rrs ...RR) {
+	m.Authority = append(m.Authority, rrs...)
+}
+
+// RemoveRRset deletes the resource record set of the name and type from the
+// zone.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.5.2
+func (m *Msg) RemoveRRset(name string, t Type) {
+	m.Authority = append(m.Authority, updateRR(name, t, ClassANY))
+}
+
+// RemoveName deletes all resource record sets of the name from the zone.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.5.3
+func (m *Msg) RemoveName(name string) {
+	m.Authority = append(m.Authority, updateRR(name, TypeANY, ClassANY))
+}
+
+// Remove deletes the resource records from the zone.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-2.5.4
+func (m *Msg) Remove(rrs ...RR) {
+	for _, rr := range rrs {
+		rr.Class = ClassNONE
+		rr.TTL = 0
+		m.Authority = append(m.Authority, rr)
+	}
+}
+
+// updateRR returns a resource record without RDATA, which is a prerequisite or
+// update for the resource record sets of the name.
+func updateRR(name string, t Type, class Class) RR {
+	return RR{Name: Fqdn(name), Type: t, Class: class}
+}
@@ -0,0 +1,74 @@
+package dns
+
+import "testing"
+
+func TestUpdate(t *testing.T) {
+	a, err := NewRR("www.example.org.", TypeA, ClassIN, 300, []byte{192, 0, 2, 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(Msg)
+	if err := m.SetUpdate("example.org"); err != nil {
+		t.Fatal(err)
+	}
+	m.NameUsed("example.org.")
+	m.NameNotUsed("new.example.org")
+	m.RRsetUsed("www.example.org.", TypeA)
+	m.RRsetNotUsed("www.example.org.", TypeAAAA)
+	m.Used(a)
+	m.Insert(a)
+	m.RemoveRRset("old.example.org.", TypeTXT)
+	m.RemoveName("gone.example.org.")
+	m.Remove(a)
+
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Msg)
+	if _, err := got.Unpack(b); err != nil {
+		t.Fatalf("failed to unpack update: %v", err)
+	}
+
+	if got.OpCode != OpCodeUpdate || got.RD != 0 {
+		t.Errorf("opcode error: got %s (rd %d) - want UPDATE (rd 0)", got.OpCode, got.RD)
+	}
+	if q := got.Question; q.QName != "example.org." || q.QType != TypeSOA || q.QClass != ClassIN {
+		t.Errorf("zone error: got %s - want example.org. IN SOA", q.String())
+	}
+
+	type rrWant struct {
+		name  string
+		t     Type
+		class Class
+		ttl   uint32
+		rdlen int
+	}
+	check := func(section string, rrs []RR, want []rrWant) {
+		if len(rrs) != len(want) {
+			t.Fatalf("%s error: got %d records - want %d", section, len(rrs), len(want))
+		}
+		for i, w := range want {
+			rr := rrs[i]
+			if rr.Name != w.name || rr.Type != w.t || rr.Class != w.class || rr.TTL != w.ttl || len(rr.RData) != w.rdlen {
+				t.Errorf("%s %d error: got %s %s %s %d (%d bytes) - want %s %s %s %d (%d bytes)",
+					section, i, rr.Name, rr.Class, rr.Type, rr.TTL, len(rr.RData),
+					w.name, w.class, w.t, w.ttl, w.rdlen)
+			}
+		}
+	}
+	check("prerequisite", got.Answer, []rrWant{
+		{"example.org.", TypeANY, ClassANY, 0, 0},
+		{"new.example.org.", TypeANY, ClassNONE, 0, 0},
+		{"www.example.org.", TypeA, ClassANY, 0, 0},
+		{"www.example.org.", TypeAAAA, ClassNONE, 0, 0},
+		{"www.example.org.", TypeA, ClassIN, 0, 4},
+	})
+	check("update", got.Authority, []rrWant{
+		{"www.example.org.", TypeA, ClassIN, 300, 4},
+		{"old.example.org.", TypeTXT, ClassANY, 0, 0},
+		{"gone.example.org.", TypeANY, ClassANY, 0, 0},
+		{"www.example.org.", TypeA, ClassNONE, 0, 4},
+	})
+}
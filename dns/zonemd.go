@@ -0,0 +1,227 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ZONEMD schemes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-5.2
+const (
+	// ZONEMDSchemeSimple digests all resource records of the zone, in
+	// canonical order and form, at once.
+	ZONEMDSchemeSimple uint8 = 1
+)
+
+// ZONEMD hash algorithms.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-5.3
+const (
+	// ZONEMDHashSHA384 is SHA-384.
+	ZONEMDHashSHA384 uint8 = 1
+
+	// ZONEMDHashSHA512 is SHA-512.
+	ZONEMDHashSHA512 uint8 = 2
+)
+
+// zonemdMinDigestLen is the minimum length of a ZONEMD digest.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-2.2.4
+const zonemdMinDigestLen = 12
+
+// ZONEMD holds a message digest of the zone it's the apex of. Its RDATA has
+// the following format:
+//
+//  15 14 13 12 11 10  9  8  7  6  5  4  3  2  1  0
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                     SERIAL                    |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |         SCHEME        |     HASH ALGORITHM    |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                     DIGEST                    /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-2
+type ZONEMD struct {
+	Serial        uint32
+	Scheme        uint8
+	HashAlgorithm uint8
+	Digest        []byte
+}
+
+// Pack packs the ZONEMD RDATA fields into binary format.
+func (z *ZONEMD) Pack() ([]byte, error) {
+	if len(z.Digest) < zonemdMinDigestLen {
+		return nil, fmt.Errorf("digest too short: %d bytes", len(z.Digest))
+	}
+
+	b := make([]byte, 6, 6+len(z.Digest))
+	binary.BigEndian.PutUint32(b, z.Serial)
+	b[4] = z.Scheme
+	b[5] = z.HashAlgorithm
+	return append(b, z.Digest...), nil
+}
+
+// Unpack unpacks the ZONEMD RDATA bytes.
+func (z *ZONEMD) Unpack(rdata []byte) error {
+	if len(rdata) < 6+zonemdMinDigestLen {
+		return fmt.Errorf("rdata too short: %d bytes", len(rdata))
+	}
+
+	z.Serial = binary.BigEndian.Uint32(rdata)
+	z.Scheme = rdata[4]
+	z.HashAlgorithm = rdata[5]
+	z.Digest = append([]byte{}, rdata[6:]...)
+	return nil
+}
+
+// String returns the presentation format of the ZONEMD RDATA.
+func (z *ZONEMD) String() string {
+	return fmt.Sprintf(
+		"%d %d %d %s",
+		z.Serial, z.Scheme, z.HashAlgorithm,
+		strings.ToUpper(hex.EncodeToString(z.Digest)),
+	)
+}
+
+// zonemdHash returns a new hash of the ZONEMD hash algorithm, or nil when
+// it's unsupported.
+func zonemdHash(alg uint8) hash.Hash {
+	switch alg {
+	case ZONEMDHashSHA384:
+		return sha512.New384()
+	case ZONEMDHashSHA512:
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// ZoneDigest computes the digest of the resource records of the zone with the
+// SIMPLE scheme and the hash algorithm: the hash of the resource records in
+// canonical order and form, without duplicates. The ZONEMD resource record
+// set at the apex, and the RRSIG resource records that cover it, are left out
+// (as are resource records that are out of the zone).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-3.3
+func ZoneDigest(origin string, rrs []RR, alg uint8) ([]byte, error) {
+	h := zonemdHash(alg)
+	if h == nil {
+		return nil, fmt.Errorf("unsupported ZONEMD hash algorithm %d", alg)
+	}
+
+	origin = CanonicalName(Fqdn(origin))
+	digested := make([]RR, 0, len(rrs))
+	for _, rr := range rrs {
+		name := CanonicalName(Fqdn(rr.Name))
+		if !IsSubDomain(origin, name) {
+			continue
+		}
+		if name == origin {
+			if rr.Type == TypeZONEMD {
+				continue
+			}
+			if rr.Type == TypeRRSIG && len(rr.RData) >= 2 &&
+				Type(binary.BigEndian.Uint16(rr.RData)) == TypeZONEMD {
+				continue
+			}
+		}
+		digested = append(digested, rr)
+	}
+	SortCanonical(digested)
+
+	var prev []byte
+	for _, rr := range digested {
+		b, err := rr.PackCanonical()
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack %s %s: %v", rr.Name, rr.Type, err)
+		}
+		if bytes.Equal(b, prev) {
+			continue
+		}
+		h.Write(b)
+		prev = b
+	}
+
+	return h.Sum(nil), nil
+}
+
+// VerifyZoneDigest verifies the zone with the ZONEMD resource records at its
+// apex: the digest of one of them, with a serial that matches the serial of
+// the SOA resource record, must match the digest of the zone. A zone without
+// ZONEMD resource records, or with only ZONEMD resource records of
+// unsupported schemes or hash algorithms, can't be verified, and passes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-4
+func VerifyZoneDigest(origin string, rrs []RR) error {
+	origin = CanonicalName(Fqdn(origin))
+	var soa *SOA
+	zonemds := []*ZONEMD{}
+	for _, rr := range rrs {
+		if CanonicalName(Fqdn(rr.Name)) != origin {
+			continue
+		}
+		switch rr.Type {
+		case TypeSOA:
+			rd, err := rr.Decode()
+			if err != nil {
+				return err
+			}
+			soa = rd.(*SOA)
+		case TypeZONEMD:
+			rd, err := rr.Decode()
+			if err != nil {
+				return err
+			}
+			zonemds = append(zonemds, rd.(*ZONEMD))
+		}
+	}
+	if len(zonemds) == 0 {
+		return nil
+	}
+	if soa == nil {
+		return fmt.Errorf("missing SOA record at %s", origin)
+	}
+
+	// A zone must not have more than one ZONEMD resource record with the same
+	// scheme and hash algorithm.
+	seen := map[[2]uint8]bool{}
+	for _, z := range zonemds {
+		k := [2]uint8{z.Scheme, z.HashAlgorithm}
+		if seen[k] {
+			return fmt.Errorf(
+				"multiple ZONEMD records with scheme %d and hash algorithm %d",
+				z.Scheme, z.HashAlgorithm,
+			)
+		}
+		seen[k] = true
+	}
+
+	var err error
+	for _, z := range zonemds {
+		if z.Scheme != ZONEMDSchemeSimple || zonemdHash(z.HashAlgorithm) == nil {
+			continue
+		}
+		if z.Serial != soa.Serial {
+			err = fmt.Errorf("ZONEMD serial %d doesn't match SOA serial %d", z.Serial, soa.Serial)
+			continue
+		}
+		digest, derr := ZoneDigest(origin, rrs, z.HashAlgorithm)
+		if derr != nil {
+			return derr
+		}
+		if bytes.Equal(digest, z.Digest) {
+			return nil
+		}
+		err = fmt.Errorf("ZONEMD digest (hash algorithm %d) doesn't match the zone", z.HashAlgorithm)
+	}
+
+	return err
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// zonemdTestZone returns the resource records of the simple example zone of
+// RFC 8976, with its ZONEMD resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#appendix-A.1
+func zonemdTestZone(t *testing.T) []RR {
+	t.Helper()
+
+	newRR := func(name string, typ Type, ttl uint32, rdata []byte) RR {
+		rr, err := NewRR(name, typ, ClassIN, ttl, rdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+	packName := func(name string) []byte {
+		b, err := PackName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	soa, err := (&SOA{
+		MName: "ns1.example.", RName: "admin.example.", Serial: 2018031900,
+		Refresh: 1800, Retry: 900, Expire: 604800, Minimum: 86400,
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := hex.DecodeString(
+		"c68090d90a7aed716bc459f9340e3d7c1370d4d24b7e2fc3" +
+			"a1ddc0b9a87153b9a9713b3c9ae5cc27777f98b8e730044c",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zonemd, err := (&ZONEMD{
+		Serial: 2018031900, Scheme: ZONEMDSchemeSimple, HashAlgorithm: ZONEMDHashSHA384, Digest: digest,
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []RR{
+		newRR("example.", TypeSOA, 86400, soa),
+		newRR("example.", TypeNS, 86400, packName("ns1.example.")),
+		newRR("example.", TypeNS, 86400, packName("ns2.example.")),
+		newRR("example.", TypeZONEMD, 86400, zonemd),
+		newRR("ns1.example.", TypeA, 3600, net.ParseIP("203.0.113.63").To4()),
+		newRR("ns2.example.", TypeAAAA, 3600, net.ParseIP("2001:db8::63")),
+	}
+}
+
+func TestZONEMD(t *testing.T) {
+	z := &ZONEMD{
+		Serial:        1,
+		Scheme:        ZONEMDSchemeSimple,
+		HashAlgorithm: ZONEMDHashSHA512,
+		Digest:        bytes.Repeat([]byte{0xab}, 12),
+	}
+	b, err := z.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got ZONEMD
+	if err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 1 2 ABABABABABABABABABABABAB"; got.String() != want {
+		t.Errorf("zonemd error: got %q - want %q", got.String(), want)
+	}
+
+	if err := got.Unpack(b[:len(b)-1]); err == nil {
+		t.Errorf("unpack of a too short digest error: got nil - want error")
+	}
+}
+
+func TestZoneDigest(t *testing.T) {
+	rrs := zonemdTestZone(t)
+	if err := VerifyZoneDigest("example.", rrs); err != nil {
+		t.Fatalf("verify error: %v", err)
+	}
+
+	// The order and duplicates of the resource records don't matter.
+	shuffled := append([]RR{rrs[5], rrs[4], rrs[2]}, rrs...)
+	if err := VerifyZoneDigest("example.", shuffled); err != nil {
+		t.Errorf("verify of shuffled zone error: %v", err)
+	}
+
+	changed := append([]RR{}, rrs...)
+	changed[4].RData = net.ParseIP("203.0.113.64").To4()
+	if err := VerifyZoneDigest("example.", changed); err == nil {
+		t.Errorf("verify of changed zone error: got nil - want error")
+	}
+
+	// A zone without ZONEMD resource records can't be verified.
+	if err := VerifyZoneDigest("example.", append(rrs[:3:3], rrs[4:]...)); err != nil {
+		t.Errorf("verify of zone without zonemd error: got %v - want nil", err)
+	}
+
+	if _, err := ZoneDigest("example.", rrs, 3); err == nil {
+		t.Errorf("digest with unsupported hash algorithm error: got nil - want error")
+	}
+}
+
+func TestVerifyZoneDigestSerial(t *testing.T) {
+	rrs := zonemdTestZone(t)
+	rd, err := rrs[3].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := rd.(*ZONEMD)
+	z.Serial++
+	if rrs[3].RData, err = z.Pack(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyZoneDigest("example.", rrs); err == nil {
+		t.Errorf("verify with mismatched serial error: got nil - want error")
+	}
+}
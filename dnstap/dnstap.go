@@ -0,0 +1,240 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// MessageType is the type of a logged message, which specifies who sent the
+// message to whom.
+//
+// See: https://github.com/dnstap/dnstap.pb/blob/master/dnstap.proto
+type MessageType uint8
+
+const (
+	// AuthQuery is a query received by an authoritative name server.
+	AuthQuery MessageType = 1
+
+	// AuthResponse is a response sent by an authoritative name server.
+	AuthResponse MessageType = 2
+
+	// ResolverQuery is a query sent by a resolver to a name server, while
+	// resolving iteratively.
+	ResolverQuery MessageType = 3
+
+	// ResolverResponse is a response received by a resolver from a name server.
+	ResolverResponse MessageType = 4
+
+	// ClientQuery is a query received by a resolver from a client.
+	ClientQuery MessageType = 5
+
+	// ClientResponse is a response sent by a resolver to a client.
+	ClientResponse MessageType = 6
+
+	// ForwarderQuery is a query sent by a forwarder to an upstream resolver.
+	ForwarderQuery MessageType = 7
+
+	// ForwarderResponse is a response received by a forwarder from an upstream
+	// resolver.
+	ForwarderResponse MessageType = 8
+
+	// StubQuery is a query sent by a stub resolver to a resolver.
+	StubQuery MessageType = 9
+
+	// StubResponse is a response received by a stub resolver from a resolver.
+	StubResponse MessageType = 10
+
+	// ToolQuery is a query sent by a tool (e.g. dig) to a name server.
+	ToolQuery MessageType = 11
+
+	// ToolResponse is a response received by a tool from a name server.
+	ToolResponse MessageType = 12
+)
+
+// Response returns the response type of a query type.
+func (t MessageType) Response() MessageType {
+	if t%2 == 1 {
+		return t + 1
+	}
+
+	return t
+}
+
+// SocketProtocol is the transport protocol a message was sent over.
+type SocketProtocol uint8
+
+const (
+	// UDP is DNS over UDP.
+	UDP SocketProtocol = 1
+
+	// TCP is DNS over TCP.
+	TCP SocketProtocol = 2
+
+	// DoT is DNS over TLS.
+	DoT SocketProtocol = 3
+
+	// DoH is DNS over HTTPS.
+	DoH SocketProtocol = 4
+)
+
+// Socket families.
+const (
+	socketFamilyINET  = 1
+	socketFamilyINET6 = 2
+)
+
+// Message is a logged query or response. The fields of the side that wasn't
+// observed are left empty, e.g. the response of a query message.
+type Message struct {
+	Type     MessageType
+	Protocol SocketProtocol
+
+	// QueryAddress and QueryPort are the address of the side that sent the
+	// query; ResponseAddress and ResponsePort of the side that responded.
+	QueryAddress    net.IP
+	QueryPort       uint16
+	ResponseAddress net.IP
+	ResponsePort    uint16
+
+	// QueryTime is when the query was sent or received, and ResponseTime when
+	// the response was.
+	QueryTime    time.Time
+	ResponseTime time.Time
+
+	// QueryMessage and ResponseMessage are the messages in wire format.
+	QueryMessage    []byte
+	ResponseMessage []byte
+}
+
+// Protobuf field numbers of the Dnstap message.
+const (
+	fieldIdentity = 1
+	fieldVersion  = 2
+	fieldMessage  = 14
+	fieldType     = 15
+
+	// dnstapTypeMessage is the type of a Dnstap message that holds a Message.
+	dnstapTypeMessage = 1
+)
+
+// Protobuf field numbers of the Message message.
+const (
+	fieldMessageType      = 1
+	fieldSocketFamily     = 2
+	fieldSocketProtocol   = 3
+	fieldQueryAddress     = 4
+	fieldResponseAddress  = 5
+	fieldQueryPort        = 6
+	fieldResponsePort     = 7
+	fieldQueryTimeSec     = 8
+	fieldQueryTimeNsec    = 9
+	fieldQueryMessage     = 10
+	fieldResponseTimeSec  = 12
+	fieldResponseTimeNsec = 13
+	fieldResponseMessage  = 14
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// marshal encodes the message as a Dnstap protobuf message, which identifies
+// the server (or tool) that logged it.
+//
+// See: https://protobuf.dev/programming-guides/encoding
+func (m *Message) marshal(identity, version string) []byte {
+	msg := []byte{}
+	msg = appendVarintField(msg, fieldMessageType, uint64(m.Type))
+	addr := m.QueryAddress
+	if addr == nil {
+		addr = m.ResponseAddress
+	}
+	if addr != nil {
+		family := socketFamilyINET6
+		if addr.To4() != nil {
+			family = socketFamilyINET
+		}
+		msg = appendVarintField(msg, fieldSocketFamily, uint64(family))
+	}
+	if m.Protocol != 0 {
+		msg = appendVarintField(msg, fieldSocketProtocol, uint64(m.Protocol))
+	}
+	if m.QueryAddress != nil {
+		msg = appendBytesField(msg, fieldQueryAddress, packIP(m.QueryAddress))
+		msg = appendVarintField(msg, fieldQueryPort, uint64(m.QueryPort))
+	}
+	if m.ResponseAddress != nil {
+		msg = appendBytesField(msg, fieldResponseAddress, packIP(m.ResponseAddress))
+		msg = appendVarintField(msg, fieldResponsePort, uint64(m.ResponsePort))
+	}
+	if !m.QueryTime.IsZero() {
+		msg = appendVarintField(msg, fieldQueryTimeSec, uint64(m.QueryTime.Unix()))
+		msg = appendFixed32Field(msg, fieldQueryTimeNsec, uint32(m.QueryTime.Nanosecond()))
+	}
+	if m.QueryMessage != nil {
+		msg = appendBytesField(msg, fieldQueryMessage, m.QueryMessage)
+	}
+	if !m.ResponseTime.IsZero() {
+		msg = appendVarintField(msg, fieldResponseTimeSec, uint64(m.ResponseTime.Unix()))
+		msg = appendFixed32Field(msg, fieldResponseTimeNsec, uint32(m.ResponseTime.Nanosecond()))
+	}
+	if m.ResponseMessage != nil {
+		msg = appendBytesField(msg, fieldResponseMessage, m.ResponseMessage)
+	}
+
+	b := []byte{}
+	if identity != "" {
+		b = appendBytesField(b, fieldIdentity, []byte(identity))
+	}
+	if version != "" {
+		b = appendBytesField(b, fieldVersion, []byte(version))
+	}
+	b = appendBytesField(b, fieldMessage, msg)
+	b = appendVarintField(b, fieldType, dnstapTypeMessage)
+
+	return b
+}
+
+// packIP returns the 4-byte representation of IPv4 addresses, and the 16-byte
+// representation of IPv6 addresses.
+func packIP(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip.To16()
+}
+
+// appendVarint appends an unsigned varint.
+func appendVarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+
+	return append(b, buf[:n]...)
+}
+
+// appendVarintField appends a varint field.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireVarint)
+	return appendVarint(b, v)
+}
+
+// appendBytesField appends a length-delimited field.
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendFixed32Field appends a fixed32 field.
+func appendFixed32Field(b []byte, field int, v uint32) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireFixed32)
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+
+	return append(b, buf...)
+}
@@ -0,0 +1,117 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// field is a decoded protobuf field.
+type field struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+// decodeFields decodes the protobuf fields of a message.
+func decodeFields(t *testing.T, b []byte) map[int]field {
+	t.Helper()
+
+	fields := map[int]field{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid field key")
+		}
+		b = b[n:]
+
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		case wireFixed32:
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[f.num] = f
+	}
+
+	return fields
+}
+
+func TestMessageMarshal(t *testing.T) {
+	m := &Message{
+		Type:            ResolverResponse,
+		Protocol:        UDP,
+		ResponseAddress: net.ParseIP("192.0.2.53"),
+		ResponsePort:    53,
+		QueryTime:       time.Unix(1700000000, 123),
+		ResponseTime:    time.Unix(1700000001, 456),
+		QueryMessage:    []byte{1, 2, 3},
+		ResponseMessage: []byte{4, 5, 6, 7},
+	}
+
+	dt := decodeFields(t, m.marshal("tdr", ""))
+	if got := string(dt[fieldIdentity].bytes); got != "tdr" {
+		t.Errorf("identity error: got %q - want %q", got, "tdr")
+	}
+	if _, ok := dt[fieldVersion]; ok {
+		t.Errorf("version error: got a version - want none")
+	}
+	if got := dt[fieldType].value; got != dnstapTypeMessage {
+		t.Errorf("dnstap type error: got %d - want %d", got, dnstapTypeMessage)
+	}
+
+	msg := decodeFields(t, dt[fieldMessage].bytes)
+	for _, tc := range []struct {
+		name  string
+		field int
+		want  uint64
+	}{
+		{"type", fieldMessageType, uint64(ResolverResponse)},
+		{"socket family", fieldSocketFamily, socketFamilyINET},
+		{"socket protocol", fieldSocketProtocol, uint64(UDP)},
+		{"response port", fieldResponsePort, 53},
+		{"query time sec", fieldQueryTimeSec, 1700000000},
+		{"query time nsec", fieldQueryTimeNsec, 123},
+		{"response time sec", fieldResponseTimeSec, 1700000001},
+		{"response time nsec", fieldResponseTimeNsec, 456},
+	} {
+		if got := msg[tc.field].value; got != tc.want {
+			t.Errorf("%s error: got %d - want %d", tc.name, got, tc.want)
+		}
+	}
+	if got := msg[fieldResponseAddress].bytes; !bytes.Equal(got, []byte{192, 0, 2, 53}) {
+		t.Errorf("response address error: got %v - want 192.0.2.53", got)
+	}
+	if _, ok := msg[fieldQueryAddress]; ok {
+		t.Errorf("query address error: got an address - want none")
+	}
+	if got := msg[fieldQueryMessage].bytes; !bytes.Equal(got, m.QueryMessage) {
+		t.Errorf("query message error: got %v - want %v", got, m.QueryMessage)
+	}
+	if got := msg[fieldResponseMessage].bytes; !bytes.Equal(got, m.ResponseMessage) {
+		t.Errorf("response message error: got %v - want %v", got, m.ResponseMessage)
+	}
+}
+
+func TestMessageTypeResponse(t *testing.T) {
+	tests := map[MessageType]MessageType{
+		AuthQuery:        AuthResponse,
+		ResolverQuery:    ResolverResponse,
+		ToolQuery:        ToolResponse,
+		ResolverResponse: ResolverResponse,
+	}
+	for typ, want := range tests {
+		if got := typ.Response(); got != want {
+			t.Errorf("response type of %d error: got %d - want %d", typ, got, want)
+		}
+	}
+}
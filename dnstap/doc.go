@@ -0,0 +1,7 @@
+// Package dnstap logs DNS queries and responses in the dnstap format: Dnstap
+// protobuf messages, written as Frame Streams data frames to a file or a unix
+// socket.
+//
+// See: https://dnstap.info
+// See: https://github.com/farsightsec/fstrm
+package dnstap
@@ -0,0 +1,227 @@
+package dnstap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ContentType is the Frame Streams content type of dnstap data frames.
+const ContentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types.
+//
+// See: https://github.com/farsightsec/fstrm/blob/master/fstrm/control.h
+const (
+	controlAccept = 0x01
+	controlStart  = 0x02
+	controlStop   = 0x03
+	controlReady  = 0x04
+	controlFinish = 0x05
+
+	// controlFieldContentType is the content type field of a control frame.
+	controlFieldContentType = 0x01
+
+	// maxControlSize is the max size of a control frame that's read.
+	maxControlSize = 512
+)
+
+// handshakeTimeout is the max time to wait for a control frame of the reader
+// of a bidirectional stream.
+const handshakeTimeout = time.Second * 5
+
+// Writer writes messages as dnstap data frames of a Frame Streams stream. It's
+// safe for concurrent use.
+type Writer struct {
+	// Identity and Version identify the server (or tool) that logs the
+	// messages; they're optional, and must be set before the first write.
+	Identity string
+	Version  string
+
+	mu sync.Mutex
+	w  io.Writer
+
+	// conn is the connection to the reader of a bidirectional stream; it's
+	// nil for a unidirectional stream (e.g. a file).
+	conn net.Conn
+
+	// err is the first error that occurred while writing, after which nothing
+	// is written anymore.
+	err error
+}
+
+// NewWriter starts a unidirectional stream (e.g. to a file), and returns a
+// writer that writes messages to it. When w is an io.Closer, it's closed when
+// the writer is closed.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := w.Write(controlFrame(controlStart, ContentType)); err != nil {
+		return nil, fmt.Errorf("failed to write start frame: %w", err)
+	}
+
+	return &Writer{w: w}, nil
+}
+
+// Dial connects to the reader at the address (e.g. a "unix" socket), starts a
+// bidirectional stream by agreeing on the content type with the reader, and
+// returns a writer that writes messages to it.
+func Dial(ctx context.Context, network, addr string) (*Writer, error) {
+	conn, err := new(net.Dialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := handshake(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Writer{w: conn, conn: conn}, nil
+}
+
+// handshake sends a ready frame, waits for the accept frame of the reader,
+// and sends the start frame.
+func handshake(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write(controlFrame(controlReady, ContentType)); err != nil {
+		return fmt.Errorf("failed to write ready frame: %w", err)
+	}
+
+	typ, contentTypes, err := readControlFrame(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read accept frame: %w", err)
+	}
+	if typ != controlAccept {
+		return fmt.Errorf("expected accept frame, got control frame type %d", typ)
+	}
+	accepted := false
+	for _, ct := range contentTypes {
+		accepted = accepted || ct == ContentType
+	}
+	if len(contentTypes) > 0 && !accepted {
+		return fmt.Errorf("reader doesn't accept content type %s", ContentType)
+	}
+
+	if _, err := conn.Write(controlFrame(controlStart, ContentType)); err != nil {
+		return fmt.Errorf("failed to write start frame: %w", err)
+	}
+
+	return nil
+}
+
+// Write writes the message as a data frame. It returns the first error that
+// occurred while writing (if any).
+func (w *Writer) Write(m *Message) error {
+	payload := m.marshal(w.Identity, w.Version)
+	frame := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.w.Write(frame); err != nil {
+		w.err = fmt.Errorf("failed to write data frame: %w", err)
+	}
+
+	return w.err
+}
+
+// Close stops the stream, and closes the underlying writer (when it's an
+// io.Closer). For a bidirectional stream, it waits for the reader to finish.
+// It returns the first error that occurred while writing (if any).
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.err
+	if err == nil {
+		if _, werr := w.w.Write(controlFrame(controlStop, "")); werr != nil {
+			err = fmt.Errorf("failed to write stop frame: %w", werr)
+		}
+	}
+	if err == nil && w.conn != nil {
+		w.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if typ, _, rerr := readControlFrame(w.conn); rerr != nil {
+			err = fmt.Errorf("failed to read finish frame: %w", rerr)
+		} else if typ != controlFinish {
+			err = fmt.Errorf("expected finish frame, got control frame type %d", typ)
+		}
+	}
+	if c, ok := w.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if w.err == nil {
+		w.err = fmt.Errorf("writer is closed")
+	}
+
+	return err
+}
+
+// controlFrame returns a control frame of the type, with a content type field
+// (when set).
+func controlFrame(typ uint32, contentType string) []byte {
+	body := make([]byte, 4)
+	binary.BigEndian.PutUint32(body, typ)
+	if contentType != "" {
+		field := make([]byte, 8)
+		binary.BigEndian.PutUint32(field, controlFieldContentType)
+		binary.BigEndian.PutUint32(field[4:], uint32(len(contentType)))
+		body = append(append(body, field...), contentType...)
+	}
+
+	// A control frame is escaped with a zero length, which is followed by the
+	// length of the control frame.
+	frame := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(body)))
+
+	return append(frame, body...)
+}
+
+// readControlFrame reads a control frame, and returns its type and content
+// types.
+func readControlFrame(r io.Reader) (uint32, []string, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, nil, err
+	}
+	if escape := binary.BigEndian.Uint32(hdr); escape != 0 {
+		return 0, nil, fmt.Errorf("expected control frame, got data frame")
+	}
+	size := binary.BigEndian.Uint32(hdr[4:])
+	if size < 4 || size > maxControlSize {
+		return 0, nil, fmt.Errorf("invalid control frame size %d", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	typ := binary.BigEndian.Uint32(body)
+	contentTypes := []string{}
+	for fields := body[4:]; len(fields) > 0; {
+		if len(fields) < 8 {
+			return 0, nil, fmt.Errorf("invalid control frame field")
+		}
+		field, n := binary.BigEndian.Uint32(fields), binary.BigEndian.Uint32(fields[4:])
+		if uint32(len(fields)-8) < n {
+			return 0, nil, fmt.Errorf("invalid control frame field length %d", n)
+		}
+		if field == controlFieldContentType {
+			contentTypes = append(contentTypes, string(fields[8:8+n]))
+		}
+		fields = fields[8+n:]
+	}
+
+	return typ, contentTypes, nil
+}
@@ -0,0 +1,132 @@
+package dnstap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// nopCloser counts how often it's closed.
+type nopCloser struct {
+	bytes.Buffer
+	closed int
+}
+
+func (c *nopCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestWriterUnidirectional(t *testing.T) {
+	buf := new(nopCloser)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Message{Type: ToolQuery}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.closed != 1 {
+		t.Errorf("closed error: got %d - want 1", buf.closed)
+	}
+	if err := w.Write(&Message{Type: ToolQuery}); err == nil {
+		t.Errorf("write after close error: got nil - want error")
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	typ, contentTypes, err := readControlFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != controlStart || len(contentTypes) != 1 || contentTypes[0] != ContentType {
+		t.Errorf("start frame error: got %d %v - want %d [%s]", typ, contentTypes, controlStart, ContentType)
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	want := (&Message{Type: ToolQuery}).marshal("", "")
+	if !bytes.Equal(payload, want) {
+		t.Errorf("data frame error: got %v - want %v", payload, want)
+	}
+
+	if typ, _, err := readControlFrame(r); err != nil || typ != controlStop {
+		t.Errorf("stop frame error: got %d (%v) - want %d", typ, err, controlStop)
+	}
+	if r.Len() != 0 {
+		t.Errorf("trailing bytes error: got %d - want 0", r.Len())
+	}
+}
+
+func TestDialBidirectional(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "dnstap.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	frames := make(chan int, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if typ, _, err := readControlFrame(conn); err != nil || typ != controlReady {
+			return
+		}
+		conn.Write(controlFrame(controlAccept, ContentType))
+		if typ, _, err := readControlFrame(conn); err != nil || typ != controlStart {
+			return
+		}
+
+		// Count the data frames until the stop frame.
+		n := 0
+		for {
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(io.Discard, conn, int64(size)); err != nil {
+				return
+			}
+			n++
+		}
+		conn.Write(controlFrame(controlFinish, ""))
+		frames <- n
+	}()
+
+	w, err := Dial(context.Background(), "unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Message{Type: ResolverQuery}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := <-frames; n != 3 {
+		t.Errorf("data frames error: got %d - want 3", n)
+	}
+}
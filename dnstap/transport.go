@@ -0,0 +1,78 @@
+package dnstap
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// transport logs the queries and responses of the transport it wraps.
+type transport struct {
+	next     resolver.Transport
+	w        *Writer
+	typ      MessageType
+	protocol SocketProtocol
+}
+
+// NewTransport wraps the transport, so every query it sends and every
+// response it receives is logged by the writer as a message of the query type
+// (e.g. ResolverQuery) and its response type, sent over the protocol. Errors
+// that occur while logging don't fail the exchange; Writer.Close returns them.
+//
+// The messages are logged as they're packed by the dns package, which never
+// compresses domain names; a logged response can be larger than the response
+// that was received.
+func NewTransport(
+	t resolver.Transport,
+	w *Writer,
+	typ MessageType,
+	protocol SocketProtocol,
+) resolver.Transport {
+	return &transport{next: t, w: w, typ: typ, protocol: protocol}
+}
+
+// Exchange logs the query, exchanges it with the wrapped transport, and logs
+// the response.
+func (t *transport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	queryb, err := query.Pack()
+	if err != nil {
+		return t.next.Exchange(ctx, query, addr)
+	}
+
+	m := &Message{
+		Type:         t.typ,
+		Protocol:     t.protocol,
+		QueryTime:    time.Now(),
+		QueryMessage: queryb,
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		m.ResponseAddress = net.ParseIP(host)
+		if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+			m.ResponsePort = uint16(p)
+		}
+	}
+	t.w.Write(m)
+
+	resp, err := t.next.Exchange(ctx, query, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if respb, err := resp.Pack(); err == nil {
+		r := *m
+		r.Type = t.typ.Response()
+		r.ResponseTime = time.Now()
+		r.ResponseMessage = respb
+		t.w.Write(&r)
+	}
+
+	return resp, nil
+}
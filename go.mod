@@ -1,3 +1,3 @@
 module github.com/danillouz/tdr
 
-go 1.17
+go 1.21
@@ -0,0 +1,8 @@
+// Package metrics collects counters, gauges and histograms, and exports them
+// in the Prometheus text exposition format over HTTP. ServerMetrics collects
+// the metrics of a DNS server: its queries by type and response code, their
+// durations, the queries in flight, malformed messages, the round-trip times
+// of upstream resolvers (or name servers), and its response cache.
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
@@ -0,0 +1,448 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the buckets of a
+// histogram of DNS query durations and round-trip times.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// nameRe matches valid metric and label names.
+//
+// See: https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+var nameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// contentType is the content type of the text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metric is a metric that's registered with a Registry.
+type metric interface {
+	// name returns the name of the metric.
+	name() string
+
+	// write writes the help text, type and samples of the metric.
+	write(w io.Writer)
+}
+
+// Registry holds metrics, and exports them. A Registry is safe for concurrent
+// use.
+type Registry struct {
+	// mu guards metrics.
+	mu sync.Mutex
+
+	// metrics holds the registered metrics, in the order they're exported.
+	metrics []metric
+}
+
+// NewRegistry creates a Registry without metrics.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register registers the metric; it panics when the name is invalid or
+// registered already, which is a programming error.
+func (r *Registry) register(m metric, labels []string) {
+	if !nameRe.MatchString(m.name()) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", m.name()))
+	}
+	for _, l := range labels {
+		if !nameRe.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q of %s", l, m.name()))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, o := range r.metrics {
+		if o.name() == m.name() {
+			panic(fmt.Sprintf("metrics: %s is registered already", m.name()))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes the metrics in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+
+	return cw.n, bw.Flush()
+}
+
+// ServeHTTP writes the metrics in the text exposition format; it makes the
+// Registry an http.Handler that Prometheus can scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.WriteTo(w)
+}
+
+// countingWriter counts the bytes that are written, and keeps the first
+// error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+// Write writes the bytes, unless an error occurred before.
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+
+	return n, err
+}
+
+// desc describes a metric: its name, help text and label names.
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+// name returns the name of the metric.
+func (d *desc) name() string {
+	return d.metricName
+}
+
+// writeHeader writes the help text and type of the metric.
+func (d *desc) writeHeader(w io.Writer, typ string) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, typ)
+}
+
+// key returns the key of the series with the label values; it panics when
+// the number of values doesn't match the number of labels, which is a
+// programming error.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf(
+			"metrics: %s has %d labels, got %d values", d.metricName, len(d.labels), len(values),
+		))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats the labels with the values (and extra label pairs) as
+// `{name="value",...}`, or returns an empty string when there are none.
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	pairs := []string{}
+	for i, l := range d.labels {
+		pairs = append(pairs, l+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabelValue(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in the
+// label value.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats the sample value.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series is the value of a metric with label values.
+type series struct {
+	values []string
+	value  float64
+}
+
+// vec holds the series of a counter or gauge, by label values.
+type vec struct {
+	desc
+
+	// mu guards series.
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// add adds the delta to the value of the series with the label values.
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		v.series[key] = s
+	}
+	s.value += delta
+}
+
+// set sets the value of the series with the label values.
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		v.series[key] = s
+	}
+	s.value = value
+}
+
+// writeSeries writes the series, ordered by their label values.
+func (v *vec) writeSeries(w io.Writer) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		s := v.series[k]
+		lines = append(lines, v.metricName+v.labelPairs(s.values)+" "+formatFloat(s.value)+"\n")
+	}
+	v.mu.Unlock()
+
+	for _, line := range lines {
+		io.WriteString(w, line)
+	}
+}
+
+// Counter is a cumulative metric whose value only goes up (e.g. the number of
+// queries), with a series per combination of label values.
+type Counter struct {
+	vec
+}
+
+// NewCounter creates and registers a counter with the label names.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{vec{desc: desc{name, help, labels}, series: map[string]*series{}}}
+	r.register(c, labels)
+
+	return c
+}
+
+// Inc increments the counter of the label values by one.
+func (c *Counter) Inc(values ...string) {
+	c.add(1, values)
+}
+
+// Add adds the delta, which must not be negative, to the counter of the label
+// values.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.metricName))
+	}
+	c.add(delta, values)
+}
+
+// write writes the help text, type and samples of the counter.
+func (c *Counter) write(w io.Writer) {
+	c.writeHeader(w, "counter")
+	c.writeSeries(w)
+}
+
+// Gauge is a metric whose value can go up and down (e.g. the number of
+// queries in flight), with a series per combination of label values.
+type Gauge struct {
+	vec
+}
+
+// NewGauge creates and registers a gauge with the label names.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{vec{desc: desc{name, help, labels}, series: map[string]*series{}}}
+	r.register(g, labels)
+
+	return g
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(value float64, values ...string) {
+	g.set(value, values)
+}
+
+// Add adds the delta to the gauge of the label values.
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.add(delta, values)
+}
+
+// Inc increments the gauge of the label values by one.
+func (g *Gauge) Inc(values ...string) {
+	g.add(1, values)
+}
+
+// Dec decrements the gauge of the label values by one.
+func (g *Gauge) Dec(values ...string) {
+	g.add(-1, values)
+}
+
+// write writes the help text, type and samples of the gauge.
+func (g *Gauge) write(w io.Writer) {
+	g.writeHeader(w, "gauge")
+	g.writeSeries(w)
+}
+
+// funcMetric is a counter or gauge without labels, whose value is returned by
+// a function when it's exported (e.g. to export statistics that are tracked
+// elsewhere).
+type funcMetric struct {
+	desc
+
+	typ string
+	f   func() float64
+}
+
+// NewCounterFunc creates and registers a counter whose value is returned by
+// the function; the value must only go up.
+func (r *Registry) NewCounterFunc(name string, help string, f func() float64) {
+	r.register(&funcMetric{desc: desc{metricName: name, help: help}, typ: "counter", f: f}, nil)
+}
+
+// NewGaugeFunc creates and registers a gauge whose value is returned by the
+// function.
+func (r *Registry) NewGaugeFunc(name string, help string, f func() float64) {
+	r.register(&funcMetric{desc: desc{metricName: name, help: help}, typ: "gauge", f: f}, nil)
+}
+
+// write writes the help text, type and sample of the metric.
+func (m *funcMetric) write(w io.Writer) {
+	m.writeHeader(w, m.typ)
+	fmt.Fprintf(w, "%s %s\n", m.metricName, formatFloat(m.f()))
+}
+
+// histogramSeries is the distribution of the observations of a histogram with
+// label values.
+type histogramSeries struct {
+	values []string
+
+	// counts holds the number of observations per bucket (not cumulative).
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations (e.g. query durations) in buckets, with a
+// series per combination of label values.
+type Histogram struct {
+	desc
+
+	// buckets holds the upper bounds of the buckets, in increasing order.
+	buckets []float64
+
+	// mu guards series.
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// NewHistogram creates and registers a histogram with the upper bounds of the
+// buckets (DefaultBuckets when there are none) and the label names.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	r.register(h, labels)
+
+	return h
+}
+
+// Observe adds the observation to the histogram of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			values: append([]string{}, values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// write writes the help text, type and samples of the histogram: the
+// cumulative count of every bucket (including the +Inf bucket), and the sum
+// and count of the observations.
+func (h *Histogram) write(w io.Writer) {
+	h.writeHeader(w, "histogram")
+
+	h.mu.Lock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		s := h.series[k]
+		cumulative := uint64(0)
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			labels := h.labelPairs(s.values, "le", formatFloat(le))
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", h.metricName, labels, cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", h.metricName, h.labelPairs(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", h.metricName, h.labelPairs(s.values), formatFloat(s.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", h.metricName, h.labelPairs(s.values), s.count)
+	}
+	h.mu.Unlock()
+
+	io.WriteString(w, b.String())
+}
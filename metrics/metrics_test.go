@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("queries_total", "Number of queries.", "qtype")
+	c.Inc("A")
+	c.Add(2, "AAAA")
+	c.Inc("A")
+	g := r.NewGauge("in_flight", "Queries in flight.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	r.NewGaugeFunc("ratio", "A \"ratio\".", func() float64 { return 0.5 })
+	h := r.NewHistogram("duration_seconds", "Durations.", []float64{0.1, 1}, "network")
+	h.Observe(0.05, "udp")
+	h.Observe(0.1, "udp")
+	h.Observe(2, "udp")
+	c.Inc(`a"b`)
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP queries_total Number of queries.
+# TYPE queries_total counter
+queries_total{qtype="A"} 2
+queries_total{qtype="AAAA"} 2
+queries_total{qtype="a\"b"} 1
+# HELP in_flight Queries in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP ratio A "ratio".
+# TYPE ratio gauge
+ratio 0.5
+# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{network="udp",le="0.1"} 2
+duration_seconds_bucket{network="udp",le="1"} 2
+duration_seconds_bucket{network="udp",le="+Inf"} 3
+duration_seconds_sum{network="udp"} 2.15
+duration_seconds_count{network="udp"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("metrics error: got\n%s\nwant\n%s", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type error: got %q", ct)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("http body doesn't match the metrics")
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(r *Registry)
+	}{
+		{"invalid name", func(r *Registry) { r.NewCounter("in-valid", "") }},
+		{"duplicate name", func(r *Registry) { r.NewCounter("a", ""); r.NewGauge("a", "") }},
+		{"reserved label", func(r *Registry) { r.NewHistogram("h", "", nil, "le") }},
+		{"label values", func(r *Registry) { r.NewCounter("c", "", "qtype").Inc() }},
+		{"negative counter", func(r *Registry) { r.NewCounter("c", "").Add(-1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic")
+				}
+			}()
+			tt.f(NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/server"
+)
+
+// ServerMetrics collects the metrics of a DNS server, and of the upstream
+// resolvers (or name servers) it sends queries to.
+type ServerMetrics struct {
+	queries   *Counter
+	duration  *Histogram
+	inFlight  *Gauge
+	malformed *Counter
+
+	upstreamRTT    *Histogram
+	upstreamErrors *Counter
+
+	r *Registry
+}
+
+// NewServerMetrics creates the metrics of a DNS server, and registers them.
+func NewServerMetrics(r *Registry) *ServerMetrics {
+	m := &ServerMetrics{
+		queries: r.NewCounter(
+			"tdr_queries_total", "Number of answered queries by network, query type and response code.",
+			"network", "qtype", "rcode",
+		),
+		duration: r.NewHistogram(
+			"tdr_query_duration_seconds", "Time it took to answer queries, by network.",
+			nil, "network",
+		),
+		inFlight: r.NewGauge("tdr_queries_in_flight", "Number of queries that are being answered."),
+		malformed: r.NewCounter(
+			"tdr_malformed_messages_total", "Number of received messages that couldn't be unpacked, by network.",
+			"network",
+		),
+		upstreamRTT: r.NewHistogram(
+			"tdr_upstream_rtt_seconds", "Round-trip time of queries sent to upstreams, by upstream.",
+			nil, "upstream",
+		),
+		upstreamErrors: r.NewCounter(
+			"tdr_upstream_errors_total", "Number of queries sent to upstreams that failed, by upstream.",
+			"upstream",
+		),
+		r: r,
+	}
+	m.inFlight.Set(0)
+
+	return m
+}
+
+// Middleware counts the queries that are passed to the handler, by the type
+// of their question and the response code of their response (or "none" when
+// the handler doesn't respond), and observes the time it took to answer them.
+func (m *ServerMetrics) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return server.HandlerFunc(func(ctx context.Context, w server.ResponseWriter, query *dns.Msg) {
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			start := time.Now()
+			rw := &rcodeWriter{ResponseWriter: w}
+			next.ServeDNS(ctx, rw, query)
+
+			rcode := "none"
+			if rw.written {
+				rcode = rw.rcode.String()
+			}
+			m.queries.Inc(w.Network(), query.Question.QType.String(), rcode)
+			m.duration.Observe(time.Since(start).Seconds(), w.Network())
+		})
+	}
+}
+
+// rcodeWriter is a response writer that records the response code of the
+// (last) response that was written with WriteMsg.
+type rcodeWriter struct {
+	server.ResponseWriter
+
+	written bool
+	rcode   dns.RCode
+}
+
+// WriteMsg records the response code of the response, and writes it.
+func (w *rcodeWriter) WriteMsg(resp *dns.Msg) error {
+	w.written = true
+	w.rcode = resp.RCode
+
+	return w.ResponseWriter.WriteMsg(resp)
+}
+
+// Malformed counts a message that was received over the network, and
+// couldn't be unpacked; it's used as server.Server.Malformed.
+func (m *ServerMetrics) Malformed(network string) {
+	m.malformed.Inc(network)
+}
+
+// Transport wraps the transport, so the round-trip time of every query it
+// sends, and every failed query, is recorded under the upstream label (e.g.
+// the address of an upstream resolver). A recursive resolver queries many name
+// servers, so it should use a single label for all of them.
+func (m *ServerMetrics) Transport(t resolver.Transport, upstream string) resolver.Transport {
+	return &transport{next: t, m: m, upstream: upstream}
+}
+
+// transport records the round-trip times and failures of the transport it
+// wraps.
+type transport struct {
+	next     resolver.Transport
+	m        *ServerMetrics
+	upstream string
+}
+
+// Exchange exchanges the query with the wrapped transport, and records the
+// outcome.
+func (t *transport) Exchange(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error) {
+	start := time.Now()
+	resp, err := t.next.Exchange(ctx, query, addr)
+	if err != nil {
+		t.m.upstreamErrors.Inc(t.upstream)
+		return nil, err
+	}
+	t.m.upstreamRTT.Observe(time.Since(start).Seconds(), t.upstream)
+
+	return resp, nil
+}
+
+// Cache registers the metrics of the response cache: the number of hits,
+// misses, evictions and prefetches, the ratio of hits to lookups, and the
+// number of cached responses.
+func (m *ServerMetrics) Cache(c *server.ResponseCache) {
+	m.r.NewCounterFunc(
+		"tdr_cache_hits_total", "Number of queries answered from the cache.",
+		func() float64 {
+			return float64(c.Stats().Hits)
+		},
+	)
+	m.r.NewCounterFunc(
+		"tdr_cache_misses_total", "Number of queries not answered from the cache.",
+		func() float64 {
+			return float64(c.Stats().Misses)
+		},
+	)
+	m.r.NewCounterFunc(
+		"tdr_cache_evictions_total", "Number of responses evicted from the cache to make room.",
+		func() float64 {
+			return float64(c.Stats().Evictions)
+		},
+	)
+	m.r.NewCounterFunc(
+		"tdr_cache_prefetches_total", "Number of cached responses refreshed before they expired.",
+		func() float64 {
+			return float64(c.Stats().Prefetches)
+		},
+	)
+	m.r.NewGaugeFunc(
+		"tdr_cache_hit_ratio", "Ratio of cache lookups that were hits.",
+		func() float64 {
+			st := c.Stats()
+			if st.Hits+st.Misses == 0 {
+				return 0
+			}
+			return float64(st.Hits) / float64(st.Hits+st.Misses)
+		},
+	)
+	m.r.NewGaugeFunc(
+		"tdr_cache_entries", "Number of cached responses.",
+		func() float64 {
+			return float64(c.Stats().Entries)
+		},
+	)
+}
+
+// Blocklist registers the metrics of the blocklist: the number of blocked
+// queries, and the number of blocked names.
+func (m *ServerMetrics) Blocklist(b *server.Blocklist) {
+	m.r.NewCounterFunc(
+		"tdr_blocklist_blocked_total", "Number of queries for blocked names.",
+		func() float64 {
+			return float64(b.Stats().Blocked)
+		},
+	)
+	m.r.NewGaugeFunc(
+		"tdr_blocklist_names", "Number of names on the blocklists.",
+		func() float64 {
+			return float64(b.Stats().Names)
+		},
+	)
+}
+
+// RPZ registers the metrics of the response policy zones: the number of
+// queries a rule was applied to, and the number of rules.
+func (m *ServerMetrics) RPZ(r *server.RPZ) {
+	m.r.NewCounterFunc(
+		"tdr_rpz_hits_total", "Number of queries a response policy rule was applied to.",
+		func() float64 {
+			return float64(r.Stats().Hits)
+		},
+	)
+	m.r.NewGaugeFunc(
+		"tdr_rpz_rules", "Number of rules of the response policy zones.",
+		func() float64 {
+			return float64(r.Stats().Rules)
+		},
+	)
+}
+
+// RRL registers the metrics of the response rate limiter: the number of
+// limited responses that were dropped, and that were sent truncated.
+func (m *ServerMetrics) RRL(r *server.RRL) {
+	m.r.NewCounterFunc(
+		"tdr_rrl_dropped_total", "Number of responses over the rate limit that were dropped.",
+		func() float64 {
+			return float64(r.Stats().Dropped)
+		},
+	)
+	m.r.NewCounterFunc(
+		"tdr_rrl_slipped_total", "Number of responses over the rate limit that were sent truncated.",
+		func() float64 {
+			return float64(r.Stats().Slipped)
+		},
+	)
+}
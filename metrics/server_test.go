@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/server"
+)
+
+// transportFunc is a function that's used as a resolver.Transport.
+type transportFunc func(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error)
+
+func (f transportFunc) Exchange(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error) {
+	return f(ctx, query, addr)
+}
+
+func TestServerMetrics(t *testing.T) {
+	r := NewRegistry()
+	m := NewServerMetrics(r)
+	h := server.Chain(server.HandlerFunc(func(ctx context.Context, w server.ResponseWriter, query *dns.Msg) {
+		if query.Question.QType == dns.TypeAAAA {
+			return
+		}
+		w.WriteMsg(server.Reply(query, dns.RCodeNameError))
+	}), m.Middleware())
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- (&server.Server{Handler: h, Malformed: m.Malformed}).Serve(ctx, pc, nil)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// A query is answered with NXDOMAIN, and a query with a cut off question
+	// is malformed.
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.org.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	b, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range [][]byte{b, b[:len(b)-3]} {
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Read(make([]byte, 512)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	for _, want := range []string{
+		`tdr_queries_total{network="udp",qtype="A",rcode="Name Error"} 1`,
+		`tdr_query_duration_seconds_count{network="udp"} 1`,
+		`tdr_queries_in_flight 0`,
+		`tdr_malformed_messages_total{network="udp"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestServerMetricsTransport(t *testing.T) {
+	r := NewRegistry()
+	m := NewServerMetrics(r)
+	fail := false
+	tr := m.Transport(transportFunc(func(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error) {
+		if fail {
+			return nil, errors.New("timeout")
+		}
+		return query, nil
+	}), "192.0.2.53:53")
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.org.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	var _ resolver.Transport = tr
+	tr.Exchange(context.Background(), query, "192.0.2.53:53")
+	fail = true
+	tr.Exchange(context.Background(), query, "192.0.2.53:53")
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	for _, want := range []string{
+		`tdr_upstream_rtt_seconds_count{upstream="192.0.2.53:53"} 1`,
+		`tdr_upstream_errors_total{upstream="192.0.2.53:53"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestServerMetricsCache(t *testing.T) {
+	r := NewRegistry()
+	m := NewServerMetrics(r)
+	c := server.NewResponseCache(10)
+	m.Cache(c)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	for _, want := range []string{"tdr_cache_hits_total 0", "tdr_cache_hit_ratio 0", "tdr_cache_entries 0"} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestServerMetricsBlocklist(t *testing.T) {
+	r := NewRegistry()
+	m := NewServerMetrics(r)
+	b := server.NewBlocklist()
+	b.Set("ads.example.org", "tracker.example.org")
+	m.Blocklist(b)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	for _, want := range []string{"tdr_blocklist_blocked_total 0", "tdr_blocklist_names 2"} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, buf.String())
+		}
+	}
+}
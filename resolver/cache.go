@@ -0,0 +1,256 @@
+package resolver
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// DefaultCacheSize is the max number of entries of the cache that's used by a
+// Client by default.
+const DefaultCacheSize = 10000
+
+// StaleTTL is the TTL of stale resource records that are served from the cache.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8767#section-4
+const StaleTTL = 30
+
+// Cache is an in-memory cache of resource record sets, keyed by name, type and
+// class, and of the delegations (i.e. name server addresses of zones) learned
+// during iterative resolution. Entries are stored until their TTL expires, and
+// the least recently used entry is evicted when the cache is full. A Cache is safe for concurrent
+// use, and can be shared by multiple clients.
+type Cache struct {
+	// mu guards all fields below.
+	mu sync.Mutex
+
+	// maxEntries is the max number of entries; zero means no limit.
+	maxEntries int
+
+	// ll orders the entries from most- to least recently used.
+	ll *list.List
+
+	// entries maps a key to its element in ll.
+	entries map[cacheKey]*list.Element
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// cacheKey identifies a resource record set.
+type cacheKey struct {
+	name  string
+	typ   dns.Type
+	class dns.Class
+
+	// delegation is set for the name servers of a zone learned from a referral,
+	// which are kept apart from authoritative answers.
+	delegation bool
+}
+
+// cacheEntry is a cached resource record set.
+type cacheEntry struct {
+	key cacheKey
+
+	// rrs are the cached resource records.
+	rrs []dns.RR
+
+	// stored is the time the entry was stored.
+	stored time.Time
+
+	// expires is the time the entry expires.
+	expires time.Time
+}
+
+// NewCache creates a Cache that holds at most maxEntries entries; zero means
+// there's no limit.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		entries:    map[cacheKey]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// newCacheKey creates a case-insensitive cache key.
+func newCacheKey(name string, t dns.Type, class dns.Class) cacheKey {
+	return cacheKey{name: strings.ToLower(name), typ: t, class: class}
+}
+
+// Get gets the cached resource records for the name, type and class. The TTL
+// of every returned resource record is decremented by the time it has been
+// cached.
+//
+// Expired entries are not returned, but are kept (until they're evicted) so
+// they can be served stale.
+func (c *Cache) Get(name string, t dns.Type, class dns.Class) ([]dns.RR, bool) {
+	rrs, _, _, ok := c.get(newCacheKey(name, t, class))
+	return rrs, ok
+}
+
+// get gets the cached resource records for the key, the time until they
+// expire, and the time they were cached for.
+func (c *Cache) get(key cacheKey) ([]dns.RR, time.Duration, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, 0, 0, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	now := c.now()
+	if !now.Before(e.expires) {
+		return nil, 0, 0, false
+	}
+	c.ll.MoveToFront(el)
+
+	elapsed := uint32(now.Sub(e.stored) / time.Second)
+	rrs := make([]dns.RR, len(e.rrs))
+	for i, rr := range e.rrs {
+		if rr.TTL > elapsed {
+			rr.TTL -= elapsed
+		} else {
+			rr.TTL = 0
+		}
+		rrs[i] = rr
+	}
+
+	return rrs, e.expires.Sub(now), e.expires.Sub(e.stored), true
+}
+
+// GetStale gets the cached resource records for the name, type and class,
+// including when they expired at most maxStale ago. The TTL of every returned
+// resource record of an expired entry is set to StaleTTL.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8767
+func (c *Cache) GetStale(
+	name string,
+	t dns.Type,
+	class dns.Class,
+	maxStale time.Duration,
+) ([]dns.RR, bool) {
+	if rrs, ok := c.Get(name, t, class); ok {
+		return rrs, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[newCacheKey(name, t, class)]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if c.now().After(e.expires.Add(maxStale)) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+
+	rrs := make([]dns.RR, len(e.rrs))
+	for i, rr := range e.rrs {
+		rr.TTL = StaleTTL
+		rrs[i] = rr
+	}
+
+	return rrs, true
+}
+
+// Set caches the resource records for the name, type and class until the
+// lowest TTL of the resource records expires. Resource records with a TTL of
+// zero are not cached.
+func (c *Cache) Set(name string, t dns.Type, class dns.Class, rrs []dns.RR) {
+	c.set(newCacheKey(name, t, class), rrs)
+}
+
+// set caches the resource records for the key.
+func (c *Cache) set(key cacheKey, rrs []dns.RR) {
+	if len(rrs) == 0 {
+		return
+	}
+
+	ttl := rrs[0].TTL
+	for _, rr := range rrs[1:] {
+		if rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+	if ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	e := &cacheEntry{
+		key:     key,
+		rrs:     append([]dns.RR{}, rrs...),
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(e)
+
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.remove(c.ll.Back())
+	}
+}
+
+// SetDelegation caches the name servers of a zone, learned from a referral.
+// The resource records are the NS resource records of the zone, and the
+// address resource records (i.e. glue) of the name servers; the delegation is
+// cached until the lowest TTL expires.
+func (c *Cache) SetDelegation(zone string, rrs []dns.RR) {
+	key := newCacheKey(zone, dns.TypeNS, dns.ClassIN)
+	key.delegation = true
+	c.set(key, rrs)
+}
+
+// Delegation gets the cached name server addresses of the closest zone that
+// encloses the name.
+func (c *Cache) Delegation(name string) (string, []net.IP, bool) {
+	for _, zone := range dns.AncestorDomainNames(name) {
+		key := newCacheKey(zone, dns.TypeNS, dns.ClassIN)
+		key.delegation = true
+
+		rrs, _, _, ok := c.get(key)
+		if !ok {
+			continue
+		}
+
+		if ips := getAddresses(rrs); len(ips) > 0 {
+			return zone, ips, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// Len returns the number of cached entries (including expired entries that
+// were not evicted yet).
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// remove removes the element from the cache.
+func (c *Cache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
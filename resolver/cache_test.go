@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func testRR(name string, ttl uint32) dns.RR {
+	return dns.RR{
+		Name:          name,
+		Type:          dns.TypeA,
+		Class:         dns.ClassIN,
+		TTL:           ttl,
+		RDLength:      4,
+		RData:         []byte{192, 0, 2, 1},
+		RDataUnpacked: "192.0.2.1",
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewCache(0)
+	c.now = func() time.Time { return now }
+
+	c.Set("Example.com.", dns.TypeA, dns.ClassIN, []dns.RR{
+		testRR("example.com.", 300),
+		testRR("example.com.", 60),
+	})
+
+	now = now.Add(10 * time.Second)
+	rrs, ok := c.Get("example.COM.", dns.TypeA, dns.ClassIN)
+	if !ok {
+		t.Fatalf("expected cache hit")
+	}
+	if rrs[0].TTL != 290 || rrs[1].TTL != 50 {
+		t.Errorf("got TTLs %d and %d, want 290 and 50", rrs[0].TTL, rrs[1].TTL)
+	}
+
+	if _, ok := c.Get("example.com.", dns.TypeAAAA, dns.ClassIN); ok {
+		t.Errorf("expected cache miss for another type")
+	}
+
+	// The entry expires with the lowest TTL.
+	now = now.Add(50 * time.Second)
+	if _, ok := c.Get("example.com.", dns.TypeA, dns.ClassIN); ok {
+		t.Errorf("expected expired entry")
+	}
+
+	c.Set("example.org.", dns.TypeA, dns.ClassIN, []dns.RR{testRR("example.org.", 0)})
+	if c.Len() != 1 {
+		t.Errorf("expected zero TTL not to be cached")
+	}
+}
+
+func TestCacheGetStale(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewCache(0)
+	c.now = func() time.Time { return now }
+
+	c.Set("example.com.", dns.TypeA, dns.ClassIN, []dns.RR{testRR("example.com.", 60)})
+
+	now = now.Add(30 * time.Second)
+	rrs, ok := c.GetStale("example.com.", dns.TypeA, dns.ClassIN, time.Hour)
+	if !ok || rrs[0].TTL != 30 {
+		t.Fatalf("expected fresh entry with TTL 30, got %v (%t)", rrs, ok)
+	}
+
+	now = now.Add(time.Hour)
+	rrs, ok = c.GetStale("example.com.", dns.TypeA, dns.ClassIN, time.Hour)
+	if !ok {
+		t.Fatalf("expected stale entry")
+	}
+	if rrs[0].TTL != StaleTTL {
+		t.Errorf("got TTL %d, want %d", rrs[0].TTL, StaleTTL)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.GetStale("example.com.", dns.TypeA, dns.ClassIN, time.Hour); ok {
+		t.Errorf("expected entry to be too stale")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected too stale entry to be removed")
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := NewCache(2)
+
+	c.Set("a.", dns.TypeA, dns.ClassIN, []dns.RR{testRR("a.", 300)})
+	c.Set("b.", dns.TypeA, dns.ClassIN, []dns.RR{testRR("b.", 300)})
+
+	// Using "a." makes "b." the least recently used entry.
+	if _, ok := c.Get("a.", dns.TypeA, dns.ClassIN); !ok {
+		t.Fatalf("expected cache hit")
+	}
+	c.Set("c.", dns.TypeA, dns.ClassIN, []dns.RR{testRR("c.", 300)})
+
+	if c.Len() != 2 {
+		t.Errorf("got %d entries, want 2", c.Len())
+	}
+	if _, ok := c.Get("b.", dns.TypeA, dns.ClassIN); ok {
+		t.Errorf("expected least recently used entry to be evicted")
+	}
+	for _, name := range []string{"a.", "c."} {
+		if _, ok := c.Get(name, dns.TypeA, dns.ClassIN); !ok {
+			t.Errorf("expected cache hit for %s", name)
+		}
+	}
+}
+
+func TestCacheDelegation(t *testing.T) {
+	c := NewCache(0)
+
+	ns := testRR("example.com.", 300)
+	ns.Type = dns.TypeNS
+	ns.RDataUnpacked = "ns.example.com."
+	c.SetDelegation("example.com.", []dns.RR{ns, testRR("ns.example.com.", 300)})
+
+	zone, ips, ok := c.Delegation("b.example.com.")
+	if !ok {
+		t.Fatalf("expected cached delegation")
+	}
+	if zone != "example.com." {
+		t.Errorf("got zone %s, want example.com.", zone)
+	}
+	if len(ips) != 1 || ips[0].String() != "192.0.2.1" {
+		t.Errorf("got name servers %v, want [192.0.2.1]", ips)
+	}
+
+	if _, _, ok := c.Delegation("example.org."); ok {
+		t.Errorf("expected no delegation for another zone")
+	}
+
+	// Delegations are kept apart from answers.
+	if _, ok := c.Get("example.com.", dns.TypeNS, dns.ClassIN); ok {
+		t.Errorf("expected delegation not to be an answer")
+	}
+}
@@ -0,0 +1,453 @@
+package resolver
+
+import (
+	"crypto"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Client is an iterative DNS resolver, or a stub resolver that forwards
+// queries to recursive resolvers (see WithStub). A Client is safe for concurrent use, and
+// multiple differently configured clients can be used in one process.
+type Client struct {
+	// timeout is the time to wait for a single response.
+	timeout time.Duration
+
+	// retries is the number of times a query is retried after it failed.
+	retries int
+
+	// backoff is the time to wait before the first retry; it's doubled after
+	// every retry.
+	backoff time.Duration
+
+	// switchServers is set to retry a failed query using another name server
+	// (when there is one).
+	switchServers bool
+
+	// budget is the max time a single resolution may take.
+	budget time.Duration
+
+	// rootServersMu guards rootServers.
+	rootServersMu sync.RWMutex
+
+	// rootServers are the IP addresses of the root name servers.
+	rootServers []net.IP
+
+	// stubServers are the IP addresses of the recursive resolvers queries are
+	// sent to in stub mode; when empty, names are resolved iteratively.
+	stubServers []net.IP
+
+	// search are the domains used to expand relative names; when empty, all
+	// names are absolute.
+	search []string
+
+	// ndots is the min number of dots a relative name must have to be tried
+	// as-is before it's expanded with the search domains.
+	ndots int
+
+	// stats tracks the round-trip times and failures of name servers.
+	stats *serverStats
+
+	// transport sends queries to name servers.
+	transport Transport
+
+	// tracer starts the spans of resolutions; nil disables tracing.
+	tracer Tracer
+
+	// logger logs the steps of resolutions; nil disables logging.
+	logger *slog.Logger
+
+	// counters count the events that are reported by Stats.
+	counters clientCounters
+
+	// ipPreference determines which IP versions are used to dial name servers.
+	ipPreference IPPreference
+
+	// maxDepth is the max number of referrals and recursive lookups (for name
+	// servers without glue) that are followed during a single resolution.
+	maxDepth int
+
+	// cache caches answers; nil disables caching.
+	cache *Cache
+
+	// flights coalesces concurrent resolutions of the same name and type.
+	flights flightGroup
+
+	// prefetch is the percentage of the TTL of a cached answer that must remain
+	// for it to be served without refreshing it in the background; zero
+	// disables prefetching.
+	prefetch int
+
+	// refreshingMu guards refreshing.
+	refreshingMu sync.Mutex
+
+	// refreshing tracks the cached answers that are being refreshed.
+	refreshing map[cacheKey]bool
+
+	// maxStale is the max time an expired cached answer is served when all name
+	// servers fail; zero disables serving stale answers.
+	maxStale time.Duration
+
+	// anchorsMu guards anchors.
+	anchorsMu sync.RWMutex
+
+	// anchors are the DS records of the root zone used when validating with
+	// DNSSEC.
+	anchors []dns.DS
+
+	// tsig is the key that signs the messages sent to a single name server; nil
+	// disables signing.
+	tsig *dns.TSIGKey
+
+	// mdnsGroups are the multicast groups that queries for link-local names
+	// are sent to.
+	mdnsGroups []*net.UDPAddr
+
+	// llmnr is set to resolve single-label names with LLMNR when they can't be
+	// resolved with DNS.
+	llmnr bool
+
+	// llmnrGroups are the multicast groups that LLMNR queries are sent to.
+	llmnrGroups []*net.UDPAddr
+
+	// clientSubnet is the ECS option that's added to queries; nil disables it.
+	clientSubnet *dns.ClientSubnet
+
+	// padding determines which queries are padded.
+	padding PaddingPolicy
+
+	// sig0 is the key pair that signs the messages sent to a single name
+	// server when there's no TSIG key; nil disables signing.
+	sig0 *sig0Key
+}
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithTimeout sets the time to wait for a single response. The default is 5
+// seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRetries sets the number of times a query is retried after it failed. The
+// default is 2.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// WithBackoff sets the time to wait before retrying a failed query; it's
+// doubled after every retry. The default is 250 milliseconds.
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = d
+	}
+}
+
+// WithServerSwitching sets if a failed query is retried using another name
+// server of the zone (when there is one). The default is true.
+func WithServerSwitching(enabled bool) Option {
+	return func(c *Client) {
+		c.switchServers = enabled
+	}
+}
+
+// WithBudget sets the max time a single resolution may take, including all
+// referrals, retries and (DNSSEC) validation lookups. A budget of 0 means no
+// limit. The default is 30 seconds.
+func WithBudget(d time.Duration) Option {
+	return func(c *Client) {
+		c.budget = d
+	}
+}
+
+// WithRootServers sets the IP addresses of the root name servers where
+// resolution starts.
+func WithRootServers(ips ...net.IP) Option {
+	return func(c *Client) {
+		c.rootServers = append([]net.IP{}, ips...)
+	}
+}
+
+// WithStub enables stub mode, in which recursive queries are sent to the
+// recursive resolvers (e.g. from the system configuration, see
+// LoadResolvConf), instead of resolving names iteratively from the root.
+func WithStub(servers ...net.IP) Option {
+	return func(c *Client) {
+		c.stubServers = append([]net.IP{}, servers...)
+	}
+}
+
+// WithSearch enables expanding relative names with the search domains, the
+// way the libc resolver does (see ResolvConf.NameList). By default names are
+// absolute.
+func WithSearch(search []string, ndots int) Option {
+	return func(c *Client) {
+		c.search = append([]string{}, search...)
+		c.ndots = ndots
+	}
+}
+
+// WithTransport sets the transport used to send queries to name servers (see
+// NewTransport to dial connections with a custom Dialer). The default is UDP,
+// with a fallback to TCP for truncated responses.
+func WithTransport(t Transport) Option {
+	return func(c *Client) {
+		c.transport = t
+	}
+}
+
+// WithIPPreference sets which IP versions are used to dial name servers. The
+// default is PreferIPv4.
+func WithIPPreference(p IPPreference) Option {
+	return func(c *Client) {
+		c.ipPreference = p
+	}
+}
+
+// WithMaxDepth sets the max number of referrals and recursive lookups (for
+// name servers without glue) that are followed during a single resolution.
+// The default is 30.
+func WithMaxDepth(n int) Option {
+	return func(c *Client) {
+		c.maxDepth = n
+	}
+}
+
+// WithCache sets the cache that's consulted before any name server is queried.
+// The default is a cache with DefaultCacheSize entries; nil disables caching.
+func WithCache(cache *Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// WithPrefetch enables refreshing a cached answer in the background when it's
+// served within the last percent of its TTL, so frequently used answers don't
+// expire. It's disabled by default.
+func WithPrefetch(percent int) Option {
+	return func(c *Client) {
+		c.prefetch = percent
+	}
+}
+
+// WithServeStale enables serving expired cached answers (for at most maxStale
+// after they expired) when no name server responds, instead of failing. It's
+// disabled by default.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8767
+func WithServeStale(maxStale time.Duration) Option {
+	return func(c *Client) {
+		c.maxStale = maxStale
+	}
+}
+
+// WithTrustAnchors sets the DS records of the root zone used as trust anchors
+// when validating with DNSSEC. The default is RootTrustAnchors.
+func WithTrustAnchors(ds []dns.DS) Option {
+	return func(c *Client) {
+		c.anchors = append([]dns.DS{}, ds...)
+	}
+}
+
+// WithTSIG signs the messages that are sent to a single name server (with
+// Exchange, Update, Notify and Transfer) with the TSIG key, and requires the
+// responses to be signed with it. Queries that are resolved (e.g. with Resolve
+// or Query) aren't signed.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8945
+func WithTSIG(key *dns.TSIGKey) Option {
+	return func(c *Client) {
+		c.tsig = key
+	}
+}
+
+// WithSIG0 signs the messages that are sent to a single name server (with
+// Exchange, Update, Notify and Transfer) with SIG(0), using the private key of
+// the key (a KEY resource record owned by the signer). The responses aren't
+// verified, and a TSIG key (see WithTSIG) takes precedence.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2931
+func WithSIG0(priv crypto.Signer, key *dns.DNSKEY, signer string) Option {
+	return func(c *Client) {
+		c.sig0 = &sig0Key{priv: priv, key: key, signer: signer}
+	}
+}
+
+// WithLLMNR enables resolving single-label names (e.g. "printer") on the local
+// link with Link-Local Multicast Name Resolution, when they can't be resolved
+// with DNS (e.g. on networks without a DNS server). It's disabled by default.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4795
+func WithLLMNR(enabled bool) Option {
+	return func(c *Client) {
+		c.llmnr = enabled
+	}
+}
+
+// WithClientSubnet adds the subnet to the queries that are sent to name servers
+// with the EDNS Client Subnet option, so name servers that tailor their
+// answers to the location of the client (e.g. CDNs) answer for that subnet.
+// The scope of the answer is returned in the ECS option of the response (see
+// dns.Msg.ClientSubnet). The answers are cached like any other answer, so a
+// client should use a single subnet. It's disabled by default.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7871
+func WithClientSubnet(subnet *net.IPNet) Option {
+	return func(c *Client) {
+		c.clientSubnet = dns.NewClientSubnet(subnet)
+	}
+}
+
+// WithPadding sets which queries are padded with the EDNS(0) Padding option
+// (to a multiple of 128 bytes). The default is PadEncrypted.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7830
+func WithPadding(p PaddingPolicy) Option {
+	return func(c *Client) {
+		c.padding = p
+	}
+}
+
+// NewClient creates a Client configured with the options.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		timeout:       time.Second * 5,
+		retries:       2,
+		backoff:       time.Millisecond * 250,
+		switchServers: true,
+		budget:        time.Second * 30,
+		rootServers:   defaultRootServers(),
+		transport:     UDP,
+		stats:         newServerStats(),
+		ipPreference:  PreferIPv4,
+		mdnsGroups:    defaultMDNSGroups,
+		llmnrGroups:   defaultLLMNRGroups,
+		maxDepth:      30,
+		cache:         NewCache(DefaultCacheSize),
+		refreshing:    map[cacheKey]bool{},
+		anchors:       RootTrustAnchors(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// IPPreference determines which IP versions are used to dial name servers.
+type IPPreference uint8
+
+// String returns the string representation of an IP preference.
+func (p IPPreference) String() string {
+	return IPPreferenceToString[p]
+}
+
+const (
+	// PreferIPv4 dials name servers over IPv4 first, and falls back to IPv6.
+	PreferIPv4 IPPreference = iota
+
+	// PreferIPv6 dials name servers over IPv6 first, and falls back to IPv4.
+	PreferIPv6
+
+	// IPv4Only only dials name servers over IPv4.
+	IPv4Only
+
+	// IPv6Only only dials name servers over IPv6.
+	IPv6Only
+)
+
+// IPPreferenceToString maps an IP preference to a string.
+var IPPreferenceToString = map[IPPreference]string{
+	PreferIPv4: "prefer-ipv4",
+	PreferIPv6: "prefer-ipv6",
+	IPv4Only:   "ipv4-only",
+	IPv6Only:   "ipv6-only",
+}
+
+// orderServers orders the name server IP addresses by the IP preference;
+// addresses of the preferred IP version come first (keeping their relative
+// order), and addresses of an excluded IP version are removed.
+func (c *Client) orderServers(ips []net.IP) []net.IP {
+	v4, v6 := []net.IP{}, []net.IP{}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch c.ipPreference {
+	case PreferIPv6:
+		return append(v6, v4...)
+	case IPv4Only:
+		return v4
+	case IPv6Only:
+		return v6
+	default:
+		return append(v4, v6...)
+	}
+}
+
+// addressTypes returns the address query types used to resolve the IP
+// address of a name server, in order of preference.
+func (c *Client) addressTypes() []dns.QType {
+	switch c.ipPreference {
+	case PreferIPv6:
+		return []dns.QType{dns.TypeAAAA, dns.TypeA}
+	case IPv4Only:
+		return []dns.QType{dns.TypeA}
+	case IPv6Only:
+		return []dns.QType{dns.TypeAAAA}
+	default:
+		return []dns.QType{dns.TypeA, dns.TypeAAAA}
+	}
+}
+
+// rootServer is a root name server.
+type rootServer struct {
+	name string
+	ipv4 net.IP
+	ipv6 net.IP
+}
+
+// rootServers are the 13 root name servers.
+//
+// See: https://www.iana.org/domains/root/servers
+var rootServers = []rootServer{
+	{"a.root-servers.net.", net.ParseIP("198.41.0.4"), net.ParseIP("2001:503:ba3e::2:30")},
+	{"b.root-servers.net.", net.ParseIP("170.247.170.2"), net.ParseIP("2801:1b8:10::b")},
+	{"c.root-servers.net.", net.ParseIP("192.33.4.12"), net.ParseIP("2001:500:2::c")},
+	{"d.root-servers.net.", net.ParseIP("199.7.91.13"), net.ParseIP("2001:500:2d::d")},
+	{"e.root-servers.net.", net.ParseIP("192.203.230.10"), net.ParseIP("2001:500:a8::e")},
+	{"f.root-servers.net.", net.ParseIP("192.5.5.241"), net.ParseIP("2001:500:2f::f")},
+	{"g.root-servers.net.", net.ParseIP("192.112.36.4"), net.ParseIP("2001:500:12::d0d")},
+	{"h.root-servers.net.", net.ParseIP("198.97.190.53"), net.ParseIP("2001:500:1::53")},
+	{"i.root-servers.net.", net.ParseIP("192.36.148.17"), net.ParseIP("2001:7fe::53")},
+	{"j.root-servers.net.", net.ParseIP("192.58.128.30"), net.ParseIP("2001:503:c27::2:30")},
+	{"k.root-servers.net.", net.ParseIP("193.0.14.129"), net.ParseIP("2001:7fd::1")},
+	{"l.root-servers.net.", net.ParseIP("199.7.83.42"), net.ParseIP("2001:500:9f::42")},
+	{"m.root-servers.net.", net.ParseIP("202.12.27.33"), net.ParseIP("2001:dc3::35")},
+}
+
+// defaultRootServers returns the IP addresses of the built-in root name
+// servers, which are used unless root hints are configured (see
+// ParseRootHints) or the client is primed (see Client.Prime).
+func defaultRootServers() []net.IP {
+	ips := []net.IP{}
+	for _, rs := range rootServers {
+		ips = append(ips, rs.ipv4, rs.ipv6)
+	}
+
+	return ips
+}
@@ -0,0 +1,41 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestOrderServers(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:503:ba3e::2:30"),
+		net.ParseIP("198.41.0.4"),
+		net.ParseIP("2801:1b8:10::b"),
+		net.ParseIP("170.247.170.2"),
+	}
+
+	tests := map[IPPreference][]string{
+		PreferIPv4: {
+			"198.41.0.4", "170.247.170.2", "2001:503:ba3e::2:30", "2801:1b8:10::b",
+		},
+		PreferIPv6: {
+			"2001:503:ba3e::2:30", "2801:1b8:10::b", "198.41.0.4", "170.247.170.2",
+		},
+		IPv4Only: {"198.41.0.4", "170.247.170.2"},
+		IPv6Only: {"2001:503:ba3e::2:30", "2801:1b8:10::b"},
+	}
+
+	for p, want := range tests {
+		t.Run(p.String(), func(t *testing.T) {
+			c := NewClient(WithIPPreference(p))
+
+			got := []string{}
+			for _, ip := range c.orderServers(ips) {
+				got = append(got, ip.String())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
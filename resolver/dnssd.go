@@ -0,0 +1,199 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// serviceTypesName is the name that enumerates the service types that are
+// advertised on the local link.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6763#section-9
+const serviceTypesName = "_services._dns-sd._udp.local."
+
+// ServiceInstance is an instance of a service that's discovered with DNS-based
+// service discovery.
+type ServiceInstance struct {
+	// Name is the name of the instance (e.g. "Printer._ipp._tcp.local.").
+	Name string
+
+	// Host and Port are the target and port of the SRV resource record of the
+	// instance.
+	Host string
+	Port uint16
+
+	// Text holds the key/value pairs of the TXT resource record of the
+	// instance.
+	Text []string
+
+	// Addrs are the addresses of the host.
+	Addrs []net.IP
+}
+
+// BrowseServiceTypes discovers the types of the services (e.g. "_http._tcp")
+// that are advertised on the local link with multicast DNS. Responses are
+// collected for the timeout of the client, or until the context is done.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6763#section-9
+func (c *Client) BrowseServiceTypes(ctx context.Context) ([]string, error) {
+	rrs, err := c.browse(ctx, serviceTypesName)
+	if err != nil {
+		return nil, err
+	}
+
+	types := []string{}
+	seen := map[string]bool{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypePTR || !strings.EqualFold(rr.Name, serviceTypesName) {
+			continue
+		}
+		t := strings.TrimSuffix(strings.ToLower(rr.RDataUnpacked), ".local.")
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+// Browse discovers the instances of the service type (e.g. "_http._tcp") on
+// the local link with multicast DNS, and resolves their SRV and TXT resource
+// records and addresses. Responses are collected for the timeout of the
+// client, or until the context is done. An instance that can't be resolved is
+// returned without its host and port.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6763#section-4
+func (c *Client) Browse(ctx context.Context, service string) ([]*ServiceInstance, error) {
+	name := dns.Fqdn(service)
+	if !isLocalName(name) {
+		name += "local."
+	}
+	rrs, err := c.browse(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*ServiceInstance{}
+	seen := map[string]bool{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypePTR || !strings.EqualFold(rr.Name, name) {
+			continue
+		}
+		if key := strings.ToLower(rr.RDataUnpacked); !seen[key] {
+			seen[key] = true
+			instances = append(instances, &ServiceInstance{Name: rr.RDataUnpacked})
+		}
+	}
+	for _, inst := range instances {
+		c.resolveInstance(ctx, inst, rrs)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Name < instances[j].Name
+	})
+
+	return instances, nil
+}
+
+// browse sends a PTR query for the name to the multicast DNS groups, and
+// returns all resource records of the responses (responders add the SRV, TXT
+// and address resource records of the instances to the additional section).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6763#section-12
+func (c *Client) browse(ctx context.Context, name string) ([]dns.RR, error) {
+	query := new(dns.Msg)
+	if err := query.SetQuery(name, dns.TypePTR); err != nil {
+		return nil, fmt.Errorf("failed to set dns query: %v", err)
+	}
+	query.RD = 0
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	rrs := []dns.RR{}
+	err := c.multicast(ctx, query, c.mdnsGroups, true, func(m *dns.Msg, from net.IP) bool {
+		rrs = append(rrs, m.Answer...)
+		rrs = append(rrs, m.Additional...)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rrs, nil
+}
+
+// resolveInstance sets the host, port, text and addresses of the instance from
+// the resource records, and resolves the ones that are missing with multicast
+// DNS.
+func (c *Client) resolveInstance(ctx context.Context, inst *ServiceInstance, rrs []dns.RR) {
+	// find returns the resource records of the name and type; when they're
+	// missing, they're resolved when resolve is set.
+	find := func(name string, t dns.Type, resolve bool) []dns.RR {
+		found := []dns.RR{}
+		for _, rr := range rrs {
+			if rr.Type == t && strings.EqualFold(rr.Name, name) {
+				found = append(found, rr)
+			}
+		}
+		if len(found) > 0 || !resolve {
+			return found
+		}
+		resp, err := c.resolveMDNS(ctx, name, t)
+		if err != nil {
+			return nil
+		}
+		for _, rr := range resp.Answer {
+			if rr.Type == t && strings.EqualFold(rr.Name, name) {
+				found = append(found, rr)
+			}
+		}
+		return found
+	}
+
+	srvs := find(inst.Name, dns.TypeSRV, true)
+	if len(srvs) == 0 {
+		return
+	}
+	var prio, weight uint16
+	if _, err := fmt.Sscanf(
+		srvs[0].RDataUnpacked, "%d %d %d %s",
+		&prio, &weight, &inst.Port, &inst.Host,
+	); err != nil {
+		return
+	}
+	for _, rr := range find(inst.Name, dns.TypeTXT, true) {
+		// Every character string of the TXT resource record is a key/value
+		// pair.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc6763#section-6.3
+		for i := 0; i < len(rr.RData); i += 1 + int(rr.RData[i]) {
+			end := i + 1 + int(rr.RData[i])
+			if end > len(rr.RData) {
+				break
+			}
+			if end > i+1 {
+				inst.Text = append(inst.Text, string(rr.RData[i+1:end]))
+			}
+		}
+	}
+
+	// A host may only have addresses of one IP version, so the addresses are
+	// only resolved when the responses held none.
+	types := []dns.Type{dns.TypeA, dns.TypeAAAA}
+	for _, t := range types {
+		inst.Addrs = append(inst.Addrs, getAddresses(find(inst.Host, t, false))...)
+	}
+	for _, t := range types {
+		if len(inst.Addrs) > 0 {
+			break
+		}
+		inst.Addrs = getAddresses(find(inst.Host, t, true))
+	}
+}
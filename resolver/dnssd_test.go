@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// mustRR creates a resource record of the multicast DNS class from the RDATA,
+// where a string is packed as a domain name.
+func mustRR(t *testing.T, name string, rt dns.Type, rdata ...interface{}) dns.RR {
+	t.Helper()
+
+	b := []byte{}
+	for _, v := range rdata {
+		switch v := v.(type) {
+		case string:
+			nameb, err := dns.PackName(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b = append(b, nameb...)
+		case uint16:
+			b = append(b, byte(v>>8), byte(v))
+		case []byte:
+			b = append(b, v...)
+		}
+	}
+	rr, err := dns.NewRR(name, rt, dns.ClassIN, 120, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+func TestBrowse(t *testing.T) {
+	office := "Office._ipp._tcp.local."
+	lab := "Lab._ipp._tcp.local."
+	rrs := []dns.RR{
+		mustRR(t, serviceTypesName, dns.TypePTR, "_ipp._tcp.local."),
+		mustRR(t, serviceTypesName, dns.TypePTR, "_http._tcp.local."),
+		mustRR(t, "_ipp._tcp.local.", dns.TypePTR, office),
+		mustRR(t, "_ipp._tcp.local.", dns.TypePTR, lab),
+
+		// The records of the lab instance aren't added to the responses of the
+		// PTR queries, so they're resolved.
+		mustRR(t, lab, dns.TypeSRV, uint16(0), uint16(0), uint16(631), "lab.local."),
+		mustRR(t, lab, dns.TypeTXT, []byte("\x09txtvers=1\x00")),
+		mustRR(t, "lab.local.", dns.TypeA, []byte{192, 0, 2, 2}),
+	}
+	additional := []dns.RR{
+		mustRR(t, office, dns.TypeSRV, uint16(0), uint16(0), uint16(631), "office.local."),
+		mustRR(t, office, dns.TypeTXT, []byte("\x09txtvers=1\x06rp=ipp")),
+		mustRR(t, "office.local.", dns.TypeA, []byte{192, 0, 2, 1}),
+	}
+	c := newMDNSClient(mdnsResponder(t, rrs, additional))
+
+	types, err := c.BrowseServiceTypes(context.Background())
+	if err != nil {
+		t.Fatalf("failed to browse service types: %v", err)
+	}
+	if want := []string{"_http._tcp", "_ipp._tcp"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("service types error: got %v - want %v", types, want)
+	}
+
+	instances, err := c.Browse(context.Background(), "_ipp._tcp")
+	if err != nil {
+		t.Fatalf("failed to browse: %v", err)
+	}
+	want := []*ServiceInstance{
+		{Name: lab, Host: "lab.local.", Port: 631, Text: []string{"txtvers=1"}, Addrs: []net.IP{net.IPv4(192, 0, 2, 2)}},
+		{Name: office, Host: "office.local.", Port: 631, Text: []string{"txtvers=1", "rp=ipp"}, Addrs: []net.IP{net.IPv4(192, 0, 2, 1)}},
+	}
+	if len(instances) != len(want) {
+		t.Fatalf("instances error: got %d - want %d", len(instances), len(want))
+	}
+	for i, inst := range instances {
+		w := want[i]
+		if inst.Name != w.Name || inst.Host != w.Host || inst.Port != w.Port ||
+			!reflect.DeepEqual(inst.Text, w.Text) || len(inst.Addrs) != 1 || !inst.Addrs[0].Equal(w.Addrs[0]) {
+			t.Errorf("instance error: got %+v - want %+v", inst, w)
+		}
+	}
+}
@@ -0,0 +1,838 @@
+package resolver
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/trustanchor"
+)
+
+// Status represents the DNSSEC validation status of a response.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-4.3
+type Status uint8
+
+// String returns the string representation of a validation status.
+func (s Status) String() string {
+	return StatusToString[s]
+}
+
+const (
+	// StatusInsecure means there's proof that no chain of trust exists for the
+	// response (i.e. the zone is not signed).
+	StatusInsecure Status = iota
+
+	// StatusSecure means a chain of trust could be built from a trust anchor to
+	// every resource record set in the response.
+	StatusSecure
+
+	// StatusBogus means a chain of trust should exist, but could not be built;
+	// signatures are missing, expired or invalid.
+	StatusBogus
+)
+
+// StatusToString maps a validation status to a string.
+var StatusToString = map[Status]string{
+	StatusInsecure: "Insecure",
+	StatusSecure:   "Secure",
+	StatusBogus:    "Bogus",
+}
+
+// rootTrustAnchors are the DS records of the root zone Key Signing Keys
+// (KSK-2017 and KSK-2024).
+//
+// See: https://data.iana.org/root-anchors/root-anchors.xml
+var rootTrustAnchors = []dns.DS{
+	{
+		KeyTag:     20326,
+		Algorithm:  dns.AlgorithmRSASHA256,
+		DigestType: dns.DigestTypeSHA256,
+		Digest: mustDecodeHex(
+			"E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		),
+	},
+	{
+		KeyTag:     38696,
+		Algorithm:  dns.AlgorithmRSASHA256,
+		DigestType: dns.DigestTypeSHA256,
+		Digest: mustDecodeHex(
+			"683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+		),
+	},
+}
+
+// RootTrustAnchors returns the built-in DS records of the root zone Key
+// Signing Keys.
+func RootTrustAnchors() []dns.DS {
+	return append([]dns.DS{}, rootTrustAnchors...)
+}
+
+// getTrustAnchors returns the DS records of the root zone that are used as
+// trust anchors when validating with DNSSEC.
+func (c *Client) getTrustAnchors() []dns.DS {
+	c.anchorsMu.RLock()
+	defer c.anchorsMu.RUnlock()
+
+	return c.anchors
+}
+
+// setTrustAnchors sets the DS records of the root zone that are used as trust
+// anchors when validating with DNSSEC.
+func (c *Client) setTrustAnchors(ds []dns.DS) {
+	c.anchorsMu.Lock()
+	defer c.anchorsMu.Unlock()
+
+	c.anchors = append([]dns.DS{}, ds...)
+}
+
+// RefreshTrustAnchors fetches the DNSKEY resource record set of the root zone,
+// updates the state of the trust anchor keys (tracking Key Signing Key
+// rollovers), and uses the trusted keys as trust anchors.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5011
+func (c *Client) RefreshTrustAnchors(
+	ctx context.Context,
+	s *trustanchor.Store,
+) error {
+	msg, err := c.resolve(ctx, ".", dns.TypeDNSKEY, true, 0)
+	if err != nil {
+		return fmt.Errorf("failed to resolve root dnskey: %w", err)
+	}
+
+	if err := s.Update(msg.Answer, time.Now()); err != nil {
+		return fmt.Errorf("failed to update trust anchors: %v", err)
+	}
+
+	ds := s.DS()
+	if len(ds) == 0 {
+		return fmt.Errorf("no trusted root keys")
+	}
+	c.setTrustAnchors(ds)
+
+	return nil
+}
+
+// mustDecodeHex decodes a hex string, and panics when it's invalid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// ResolveDNSSEC resolves a domain name to the resource records of the type,
+// and validates the response by building a chain of trust from the root trust
+// anchors to the answer.
+//
+// The validation status is returned alongside the result; callers must decide
+// what to do with a Bogus result.
+func (c *Client) ResolveDNSSEC(
+	name string,
+	qt dns.QType,
+) (*Result, Status, error) {
+	return c.ResolveDNSSECContext(context.Background(), name, qt)
+}
+
+// ResolveDNSSECContext is like ResolveDNSSEC, but the context can be used to
+// cancel the resolution (including the validation), or to enforce a deadline.
+func (c *Client) ResolveDNSSECContext(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+) (*Result, Status, error) {
+	ctx, cancel := c.withBudget(ctx)
+	defer cancel()
+
+	name, msg, err := c.resolveSearch(ctx, name, qt, true)
+	if err != nil {
+		return nil, StatusBogus, timeoutError(err)
+	}
+
+	v := newValidator(ctx, c, c.getTrustAnchors())
+	status := v.validate(msg.Msg, name, qt)
+
+	if len(msg.Answer) > 0 {
+		return newResult(name, qt, msg), status, nil
+	}
+
+	return nil, status, rcodeError(name, qt, msg.Msg)
+}
+
+// zoneState holds the validated state of a (potential) zone.
+type zoneState struct {
+	status Status
+
+	// cut is set when the name is the apex of a zone (i.e. a zone cut).
+	cut bool
+
+	// keys holds the validated DNSKEY records of a secure zone.
+	keys []dns.DNSKEY
+}
+
+// validator validates responses using the DNSSEC chain of trust. It caches the
+// state of every zone it visits.
+type validator struct {
+	ctx     context.Context
+	client  *Client
+	anchors []dns.DS
+	zones   map[string]*zoneState
+}
+
+// newValidator creates a validator for the trust anchors of the root zone,
+// which uses the client to fetch DNSSEC resource records.
+func newValidator(
+	ctx context.Context,
+	c *Client,
+	anchors []dns.DS,
+) *validator {
+	return &validator{
+		ctx:     ctx,
+		client:  c,
+		anchors: anchors,
+		zones:   map[string]*zoneState{},
+	}
+}
+
+// rrset holds a resource record set and the signatures that cover it.
+type rrset struct {
+	name string
+	typ  dns.Type
+	rrs  []dns.RR
+	sigs []dns.RRSIG
+}
+
+// groupRRsets groups resource records into resource record sets (by owner name
+// and type), and attaches the RRSIG records to the sets they cover.
+func groupRRsets(rrs []dns.RR) []*rrset {
+	sets := []*rrset{}
+	find := func(name string, t dns.Type) *rrset {
+		for _, s := range sets {
+			if strings.EqualFold(s.name, name) && s.typ == t {
+				return s
+			}
+		}
+		s := &rrset{name: name, typ: t}
+		sets = append(sets, s)
+		return s
+	}
+
+	for _, rr := range rrs {
+		switch rr.Type {
+		case dns.TypeOPT:
+			continue
+		case dns.TypeRRSIG:
+			sig := dns.RRSIG{}
+			if err := sig.Unpack(rr.RData); err != nil {
+				continue
+			}
+			s := find(rr.Name, sig.TypeCovered)
+			s.sigs = append(s.sigs, sig)
+		default:
+			s := find(rr.Name, rr.Type)
+			s.rrs = append(s.rrs, rr)
+		}
+	}
+
+	// Signatures without the resource records they cover can't be validated.
+	valid := []*rrset{}
+	for _, s := range sets {
+		if len(s.rrs) > 0 {
+			valid = append(valid, s)
+		}
+	}
+
+	return valid
+}
+
+// validate validates the response to a query for the name and type.
+func (v *validator) validate(msg *dns.Msg, name string, qt dns.QType) Status {
+	if len(msg.Answer) > 0 {
+		status := StatusSecure
+		for _, s := range groupRRsets(msg.Answer) {
+			st := v.verifyRRset(s)
+			if ce, ok := wildcardEncloser(s); ok && st == StatusSecure {
+				// When the answer was synthesized from a wildcard, there must be proof
+				// that the name itself doesn't exist.
+				//
+				// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.4
+				st = v.verifyExpansion(msg, s.name, ce)
+			}
+			status = combine(status, st)
+		}
+		return status
+	}
+
+	return v.verifyDenial(msg, name, qt, msg.RCode == dns.RCodeNameError)
+}
+
+// wildcardEncloser returns the closest encloser of a signed resource record
+// set that was synthesized from a wildcard; the signature covers fewer labels
+// than the owner name has, and the labels it covers (without the asterisk
+// label of the wildcard) are the closest encloser.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.2
+func wildcardEncloser(s *rrset) (string, bool) {
+	names := dns.AncestorDomainNames(s.name)
+	for _, sig := range s.sigs {
+		switch n := int(sig.Labels); {
+		case n == 0:
+			return ".", true
+		case n < len(names):
+			return names[len(names)-n], true
+		}
+	}
+
+	return "", false
+}
+
+// combine combines 2 validation statuses; Bogus takes precedence over
+// Insecure, which takes precedence over Secure.
+func combine(a, b Status) Status {
+	if a == StatusBogus || b == StatusBogus {
+		return StatusBogus
+	}
+	if a == StatusInsecure || b == StatusInsecure {
+		return StatusInsecure
+	}
+
+	return StatusSecure
+}
+
+// verifyRRset verifies the signatures of a resource record set with the
+// validated keys of the signer's zone.
+func (v *validator) verifyRRset(s *rrset) Status {
+	if len(s.sigs) == 0 {
+		return v.verifyUnsigned(s.name)
+	}
+
+	now := time.Now()
+	for _, sig := range s.sigs {
+		if !sig.ValidAt(now) {
+			continue
+		}
+
+		zone := v.zone(sig.SignerName)
+		if zone.status == StatusInsecure {
+			return StatusInsecure
+		}
+		if zone.status != StatusSecure {
+			continue
+		}
+
+		for i := range zone.keys {
+			if err := sig.Verify(&zone.keys[i], s.rrs); err == nil {
+				return StatusSecure
+			}
+		}
+	}
+
+	return StatusBogus
+}
+
+// verifyUnsigned checks if unsigned data for the name is expected; this is
+// only the case when there's proof of an insecure delegation between the root
+// and the name.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.2
+func (v *validator) verifyUnsigned(name string) Status {
+	names := dns.AncestorDomainNames(name)
+	for i := len(names) - 1; i >= 0; i-- {
+		zone := v.zone(names[i])
+		if zone.status != StatusSecure {
+			return zone.status
+		}
+	}
+
+	return StatusBogus
+}
+
+// zone returns the (cached) validated state of a potential zone. The DS
+// records of the zone are validated with the keys of the parent zone, and the
+// DNSKEY records of the zone are validated with the DS records.
+func (v *validator) zone(name string) *zoneState {
+	name = strings.ToLower(name)
+	if zone, ok := v.zones[name]; ok {
+		return zone
+	}
+
+	// Guard against loops while the zone is being validated.
+	v.zones[name] = &zoneState{status: StatusBogus}
+
+	var zone *zoneState
+	if name == "." {
+		zone = v.zoneKeys(name, v.anchors)
+	} else {
+		zone = v.delegation(name)
+	}
+
+	v.zones[name] = zone
+	return zone
+}
+
+// delegation validates the DS records for the name at the parent zone. When
+// there are DS records, the keys of the zone are validated with them.
+func (v *validator) delegation(name string) *zoneState {
+	msg, err := v.client.resolve(v.ctx, name, dns.TypeDS, true, 0)
+	if err != nil {
+		return &zoneState{status: StatusBogus}
+	}
+
+	for _, s := range groupRRsets(msg.Answer) {
+		if s.typ != dns.TypeDS || !strings.EqualFold(s.name, name) {
+			continue
+		}
+
+		status := v.verifyRRset(s)
+		if status != StatusSecure {
+			return &zoneState{status: status, cut: true}
+		}
+
+		ds := []dns.DS{}
+		for _, rr := range s.rrs {
+			d := dns.DS{}
+			if err := d.Unpack(rr.RData); err == nil {
+				ds = append(ds, d)
+			}
+		}
+		return v.zoneKeys(name, ds)
+	}
+
+	// There are no DS records, so the parent zone must prove that either the
+	// name is an insecure delegation, or not a zone cut at all.
+	status := StatusSecure
+	for _, s := range groupRRsets(msg.Authority) {
+		status = combine(status, v.verifyRRset(s))
+	}
+	if status != StatusSecure {
+		return &zoneState{status: status}
+	}
+
+	nsec3s := map[string]dns.NSEC3{}
+	for _, rr := range msg.Authority {
+		switch rr.Type {
+		case dns.TypeNSEC:
+			nsec := dns.NSEC{}
+			if err := nsec.Unpack(rr.RData); err != nil {
+				continue
+			}
+			if strings.EqualFold(rr.Name, name) {
+				if nsec.HasType(dns.TypeDS) {
+					return &zoneState{status: StatusBogus}
+				}
+				cut := nsec.HasType(dns.TypeNS) && !nsec.HasType(dns.TypeSOA)
+				if cut {
+					return &zoneState{status: StatusInsecure, cut: true}
+				}
+				return &zoneState{status: StatusSecure}
+			}
+			if nsec.Covers(rr.Name, name) {
+				return &zoneState{status: StatusSecure}
+			}
+
+		case dns.TypeNSEC3:
+			nsec3 := dns.NSEC3{}
+			if err := nsec3.Unpack(rr.RData); err != nil {
+				continue
+			}
+			if nsec3.Match(rr.Name, name) {
+				if nsec3.HasType(dns.TypeDS) {
+					return &zoneState{status: StatusBogus}
+				}
+				cut := nsec3.HasType(dns.TypeNS) && !nsec3.HasType(dns.TypeSOA)
+				if cut {
+					return &zoneState{status: StatusInsecure, cut: true}
+				}
+				return &zoneState{status: StatusSecure}
+			}
+			nsec3s[rr.Name] = nsec3
+		}
+	}
+
+	// An opt-out NSEC3 record may hide an insecure delegation, but only when it
+	// covers the next closer name of a proven closest encloser.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.9
+	if _, nsec3, ok := nsec3ClosestEncloser(nsec3s, name); ok {
+		if nsec3.Flags&dns.NSEC3FlagOptOut != 0 {
+			return &zoneState{status: StatusInsecure, cut: true}
+		}
+		return &zoneState{status: StatusSecure}
+	}
+
+	return &zoneState{status: StatusBogus}
+}
+
+// zoneKeys fetches the DNSKEY records of the zone, and validates them with the
+// DS records; the DNSKEY resource record set must be signed by a key that
+// matches a DS record.
+func (v *validator) zoneKeys(name string, ds []dns.DS) *zoneState {
+	// When none of the DS records use a supported algorithm and digest type, the
+	// zone is treated as unsigned.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.2
+	supported := false
+	for _, d := range ds {
+		_, algOK := dns.AlgorithmToString[d.Algorithm]
+		digestOK := d.DigestType == dns.DigestTypeSHA1 ||
+			d.DigestType == dns.DigestTypeSHA256 ||
+			d.DigestType == dns.DigestTypeSHA384
+		if algOK && digestOK {
+			supported = true
+		}
+	}
+	if !supported {
+		return &zoneState{status: StatusInsecure, cut: true}
+	}
+
+	msg, err := v.client.resolve(v.ctx, name, dns.TypeDNSKEY, true, 0)
+	if err != nil {
+		return &zoneState{status: StatusBogus, cut: true}
+	}
+
+	now := time.Now()
+	for _, s := range groupRRsets(msg.Answer) {
+		if s.typ != dns.TypeDNSKEY || !strings.EqualFold(s.name, name) {
+			continue
+		}
+
+		// Revoked keys must not be used for validation.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc5011#section-2.1
+		keys := []dns.DNSKEY{}
+		for _, rr := range s.rrs {
+			k := dns.DNSKEY{}
+			if err := k.Unpack(rr.RData); err != nil {
+				continue
+			}
+			if k.Flags&dns.DNSKEYFlagRevoke == 0 {
+				keys = append(keys, k)
+			}
+		}
+
+		for _, sig := range s.sigs {
+			if !sig.ValidAt(now) {
+				continue
+			}
+			for i := range keys {
+				if !matchesDS(&keys[i], name, ds) {
+					continue
+				}
+				if err := sig.Verify(&keys[i], s.rrs); err == nil {
+					return &zoneState{status: StatusSecure, cut: true, keys: keys}
+				}
+			}
+		}
+	}
+
+	return &zoneState{status: StatusBogus, cut: true}
+}
+
+// matchesDS reports whether the key matches one of the DS records.
+func matchesDS(key *dns.DNSKEY, owner string, ds []dns.DS) bool {
+	for i := range ds {
+		if ds[i].KeyTag != key.KeyTag() || ds[i].Algorithm != key.Algorithm {
+			continue
+		}
+		d, err := key.ToDS(owner, ds[i].DigestType)
+		if err != nil {
+			continue
+		}
+		if d.Equal(&ds[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyDenial verifies the authenticated denial of existence in a negative
+// response. When nxdomain is set, the name must not exist and no wildcard may
+// have matched it; otherwise the name must exist without records of the
+// requested type.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.4
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8
+func (v *validator) verifyDenial(
+	msg *dns.Msg,
+	name string,
+	qt dns.QType,
+	nxdomain bool,
+) Status {
+	nsecs, nsec3s, status := v.denialRecords(msg, name)
+	if status != StatusSecure {
+		return status
+	}
+
+	if nxdomain {
+		return nonExistence(nsecs, nsec3s, name)
+	}
+
+	return noData(nsecs, nsec3s, name, qt)
+}
+
+// verifyExpansion verifies that the name of an answer synthesized from the
+// wildcard at the closest encloser doesn't exist. The closest encloser follows
+// from the signature of the answer, so for NSEC3 only the next closer name has
+// to be covered.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.3.4
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.8
+func (v *validator) verifyExpansion(msg *dns.Msg, name, ce string) Status {
+	nsecs, nsec3s, status := v.denialRecords(msg, name)
+	if status != StatusSecure {
+		return status
+	}
+
+	for owner, nsec := range nsecs {
+		if nsec.Covers(owner, name) {
+			return StatusSecure
+		}
+	}
+	if next, ok := nextCloser(name, ce); ok && coversAny(nsec3s, next) {
+		return StatusSecure
+	}
+
+	return StatusBogus
+}
+
+// nextCloser returns the name one label longer than the closest encloser, on
+// the way to the name.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-1.3
+func nextCloser(name, ce string) (string, bool) {
+	names := dns.AncestorDomainNames(name)
+	n := dns.CountLabels(ce)
+	if n >= len(names) || !dns.IsSubDomain(ce, name) {
+		return "", false
+	}
+
+	return names[len(names)-n-1], true
+}
+
+// denialRecords verifies the signatures of the authority section, and returns
+// the NSEC and NSEC3 records in it by owner name.
+func (v *validator) denialRecords(
+	msg *dns.Msg,
+	name string,
+) (map[string]dns.NSEC, map[string]dns.NSEC3, Status) {
+	sets := groupRRsets(msg.Authority)
+	if len(sets) == 0 {
+		return nil, nil, v.verifyUnsigned(name)
+	}
+
+	status := StatusSecure
+	for _, s := range sets {
+		status = combine(status, v.verifyRRset(s))
+	}
+	if status != StatusSecure {
+		return nil, nil, status
+	}
+
+	nsecs := map[string]dns.NSEC{}
+	nsec3s := map[string]dns.NSEC3{}
+	for _, rr := range msg.Authority {
+		switch rr.Type {
+		case dns.TypeNSEC:
+			nsec := dns.NSEC{}
+			if err := nsec.Unpack(rr.RData); err == nil {
+				nsecs[rr.Name] = nsec
+			}
+		case dns.TypeNSEC3:
+			nsec3 := dns.NSEC3{}
+			if err := nsec3.Unpack(rr.RData); err == nil {
+				nsec3s[rr.Name] = nsec3
+			}
+		}
+	}
+
+	return nsecs, nsec3s, StatusSecure
+}
+
+// nonExistence checks that the NSEC or NSEC3 records prove the name doesn't
+// exist, and that there's no wildcard at the closest encloser of the name that
+// could have matched it.
+func nonExistence(
+	nsecs map[string]dns.NSEC,
+	nsec3s map[string]dns.NSEC3,
+	name string,
+) Status {
+	for owner, nsec := range nsecs {
+		if !nsec.Covers(owner, name) {
+			continue
+		}
+
+		// The closest encloser is the longest ancestor the name shares with either
+		// end of the covering NSEC record.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.4
+		ce := closestEncloser(name, owner, nsec.NextDomain)
+		for owner, nsec := range nsecs {
+			if nsec.Covers(owner, wildcardName(ce)) {
+				return StatusSecure
+			}
+		}
+		return StatusBogus
+	}
+
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.4
+	if ce, _, ok := nsec3ClosestEncloser(nsec3s, name); ok {
+		if coversAny(nsec3s, wildcardName(ce)) {
+			return StatusSecure
+		}
+	}
+
+	return StatusBogus
+}
+
+// noData checks that the NSEC or NSEC3 records prove the name exists without
+// records of the type (or a CNAME record), or that the wildcard matching the
+// name does. For DS, an opt-out NSEC3 record may also cover an unsigned
+// delegation.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-5.4
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.5
+func noData(
+	nsecs map[string]dns.NSEC,
+	nsec3s map[string]dns.NSEC3,
+	name string,
+	qt dns.QType,
+) Status {
+	for owner, nsec := range nsecs {
+		if strings.EqualFold(owner, name) {
+			return lacksType(&nsec, qt)
+		}
+	}
+
+	// A wildcard NODATA response proves the name doesn't exist, and that the
+	// wildcard at the closest encloser has no records of the type.
+	for owner, nsec := range nsecs {
+		if !nsec.Covers(owner, name) {
+			continue
+		}
+
+		wildcard := wildcardName(closestEncloser(name, owner, nsec.NextDomain))
+		for owner, nsec := range nsecs {
+			if strings.EqualFold(owner, wildcard) {
+				return lacksType(&nsec, qt)
+			}
+		}
+		return StatusBogus
+	}
+
+	for owner, nsec3 := range nsec3s {
+		if nsec3.Match(owner, name) {
+			return lacksType(&nsec3, qt)
+		}
+	}
+
+	// Without a matching NSEC3 record, the closest encloser proof shows the name
+	// doesn't exist, which is only valid for an opt-out DS response or a wildcard
+	// NODATA response.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.6
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.7
+	ce, next, ok := nsec3ClosestEncloser(nsec3s, name)
+	if !ok {
+		return StatusBogus
+	}
+	if qt == dns.TypeDS && next.Flags&dns.NSEC3FlagOptOut != 0 {
+		return StatusSecure
+	}
+	for owner, nsec3 := range nsec3s {
+		if nsec3.Match(owner, wildcardName(ce)) {
+			return lacksType(&nsec3, qt)
+		}
+	}
+
+	return StatusBogus
+}
+
+// typeBitMap is implemented by the NSEC and NSEC3 records.
+type typeBitMap interface {
+	HasType(t dns.Type) bool
+}
+
+// lacksType checks that the type bit map of a matching NSEC or NSEC3 record
+// has neither the type, nor a CNAME record.
+func lacksType(m typeBitMap, qt dns.QType) Status {
+	if m.HasType(qt) || m.HasType(dns.TypeCNAME) {
+		return StatusBogus
+	}
+
+	return StatusSecure
+}
+
+// wildcardName returns the name of the wildcard at the closest encloser.
+func wildcardName(ce string) string {
+	return "*." + strings.TrimPrefix(ce, ".")
+}
+
+// closestEncloser returns the longest ancestor of the name that is also an
+// ancestor of (or equal to) the owner or next owner name of an NSEC record.
+func closestEncloser(name, owner, next string) string {
+	names := dns.AncestorDomainNames(name)
+	for i := 1; i < len(names); i++ {
+		if ancestor := names[i]; dns.IsSubDomain(ancestor, owner) || dns.IsSubDomain(ancestor, next) {
+			return ancestor
+		}
+	}
+
+	return "."
+}
+
+// nsec3ClosestEncloser finds the closest encloser of the name, and checks that
+// the next closer name is covered (i.e. doesn't exist). It returns the closest
+// encloser and the NSEC3 record that covers the next closer name.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-8.3
+func nsec3ClosestEncloser(
+	nsec3s map[string]dns.NSEC3,
+	name string,
+) (string, dns.NSEC3, bool) {
+	names := dns.AncestorDomainNames(name)
+	for i := 1; i < len(names); i++ {
+		if !matchesAny(nsec3s, names[i]) {
+			continue
+		}
+		if nsec3, ok := covering(nsec3s, names[i-1]); ok {
+			return names[i], nsec3, true
+		}
+		break
+	}
+
+	return "", dns.NSEC3{}, false
+}
+
+// matchesAny reports whether any NSEC3 record matches the name.
+func matchesAny(nsec3s map[string]dns.NSEC3, name string) bool {
+	for owner, nsec3 := range nsec3s {
+		if nsec3.Match(owner, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coversAny reports whether any NSEC3 record covers the name.
+func coversAny(nsec3s map[string]dns.NSEC3, name string) bool {
+	_, ok := covering(nsec3s, name)
+	return ok
+}
+
+// covering returns the NSEC3 record that covers the name.
+func covering(nsec3s map[string]dns.NSEC3, name string) (dns.NSEC3, bool) {
+	for owner, nsec3 := range nsec3s {
+		if nsec3.Covers(owner, name) {
+			return nsec3, true
+		}
+	}
+
+	return dns.NSEC3{}, false
+}
@@ -0,0 +1,471 @@
+package resolver
+
+import (
+	"context"
+	"crypto"
+	"encoding/base32"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+var base32HexNoPad = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// testZone is a signed zone with a single key.
+type testZone struct {
+	name string
+	priv crypto.Signer
+	key  *dns.DNSKEY
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	t.Helper()
+
+	priv, key, err := dns.GenerateKey(
+		dns.AlgorithmECDSAP256SHA256,
+		dns.DNSKEYFlagZone|dns.DNSKEYFlagSEP,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testZone{name: name, priv: priv, key: key}
+}
+
+// packer packs RDATA into binary format.
+type packer interface {
+	Pack() ([]byte, error)
+}
+
+func newTestRR(t *testing.T, name string, typ dns.Type, rdata packer) dns.RR {
+	t.Helper()
+
+	b, err := rdata.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := dns.NewRR(name, typ, dns.ClassIN, 300, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+// rawRData is RDATA that's already in binary format.
+type rawRData []byte
+
+func (r rawRData) Pack() ([]byte, error) { return r, nil }
+
+// rrsig signs the resource record set with the key of the zone; a signature
+// with fewer labels than the owner name covers a wildcard expansion.
+func (z *testZone) rrsig(t *testing.T, rrs []dns.RR, labels int, expiration time.Time) dns.RR {
+	t.Helper()
+
+	sig := &dns.RRSIG{
+		TypeCovered: rrs[0].Type,
+		Algorithm:   z.key.Algorithm,
+		Labels:      uint8(labels),
+		OrigTTL:     rrs[0].TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(expiration.Add(-48 * time.Hour).Unix()),
+		KeyTag:      z.key.KeyTag(),
+		SignerName:  z.name,
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestRR(t, rrs[0].Name, dns.TypeRRSIG, sig)
+}
+
+// signed returns the resource record set with a valid signature.
+func (z *testZone) signed(t *testing.T, rrs ...dns.RR) []dns.RR {
+	t.Helper()
+
+	sig := z.rrsig(t, rrs, dns.CountLabels(rrs[0].Name), time.Now().Add(time.Hour))
+	return append(rrs, sig)
+}
+
+func (z *testZone) dnskey(t *testing.T) []dns.RR {
+	return z.signed(t, newTestRR(t, z.name, dns.TypeDNSKEY, z.key))
+}
+
+func (z *testZone) ds(t *testing.T) *dns.DS {
+	t.Helper()
+
+	ds, err := z.key.ToDS(z.name, dns.DigestTypeSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds
+}
+
+// nsec3 creates an NSEC3 record of the zone; the hashed owner name and the
+// next hashed owner name are set just before and after the hash of the name,
+// so the record covers the name (and practically nothing else). When match is
+// set, the hashed owner name is the hash of the name. Without types, the type
+// bit map is that of an apex.
+func (z *testZone) nsec3(
+	t *testing.T,
+	name string,
+	match bool,
+	flags uint8,
+	types ...dns.Type,
+) dns.RR {
+	t.Helper()
+
+	decode := func(s string) []byte {
+		b, err := base32HexNoPad.DecodeString(strings.ToUpper(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	hash := decode(dns.HashName(name, dns.NSEC3HashSHA1, 0, nil))
+	owner := append([]byte{}, hash...)
+	if !match {
+		for i := len(owner) - 1; i >= 0; i-- {
+			owner[i]--
+			if owner[i] != 0xff {
+				break
+			}
+		}
+	}
+	next := append([]byte{}, hash...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	if len(types) == 0 {
+		types = []dns.Type{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG}
+	}
+	nsec3 := &dns.NSEC3{
+		HashAlgorithm: dns.NSEC3HashSHA1,
+		Flags:         flags,
+		NextHashed:    next,
+		TypeBitMap:    types,
+	}
+	label := strings.ToLower(base32HexNoPad.EncodeToString(owner))
+	return newTestRR(t, label+"."+z.name, dns.TypeNSEC3, nsec3)
+}
+
+func (z *testZone) nsec(t *testing.T, owner, next string, types ...dns.Type) dns.RR {
+	nsec := &dns.NSEC{NextDomain: next, TypeBitMap: types}
+	return newTestRR(t, owner, dns.TypeNSEC, nsec)
+}
+
+// dnssecTransport answers queries authoritatively with the responses of the
+// names and types.
+type dnssecTransport struct {
+	msgs map[string]*dns.Msg
+}
+
+func (t *dnssecTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Additional = nil
+
+	key := strings.ToLower(query.Question.QName) + " " + query.Question.QType.String()
+	if msg, ok := t.msgs[key]; ok {
+		resp.Answer = msg.Answer
+		resp.Authority = msg.Authority
+	}
+
+	return &resp, nil
+}
+
+func nxdomain(authority []dns.RR) *dns.Msg {
+	msg := &dns.Msg{Authority: authority}
+	msg.RCode = dns.RCodeNameError
+	return msg
+}
+
+func TestValidate(t *testing.T) {
+	root := newTestZone(t, ".")
+	example := newTestZone(t, "example.")
+	bad := newTestZone(t, "bad.")
+	hashed := newTestZone(t, "nsec3.")
+
+	a := func(name string) dns.RR {
+		return newTestRR(t, name, dns.TypeA, rawRData{192, 0, 2, 1})
+	}
+	dsRR := func(name string, ds *dns.DS) dns.RR {
+		return newTestRR(t, name, dns.TypeDS, ds)
+	}
+	badDS := newTestZone(t, "bad.").ds(t)
+
+	tr := &dnssecTransport{msgs: map[string]*dns.Msg{
+		". DNSKEY":        {Answer: root.dnskey(t)},
+		"example. DS":     {Answer: root.signed(t, dsRR("example.", example.ds(t)))},
+		"example. DNSKEY": {Answer: example.dnskey(t)},
+		"bad. DS":         {Answer: root.signed(t, dsRR("bad.", badDS))},
+		"bad. DNSKEY":     {Answer: bad.dnskey(t)},
+		"nsec3. DS":       {Answer: root.signed(t, dsRR("nsec3.", hashed.ds(t)))},
+		"nsec3. DNSKEY":   {Answer: hashed.dnskey(t)},
+
+		// The root proves there's no DS at the delegation.
+		"unsigned. DS": {Authority: root.signed(t, root.nsec(
+			t, "unsigned.", "zzz.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC,
+		))},
+
+		// Opt-out NSEC3 records may only prove an insecure delegation when the
+		// closest encloser is proven too.
+		"optout.nsec3. DS": {Authority: append(
+			hashed.signed(t, hashed.nsec3(t, "nsec3.", true, 0)),
+			hashed.signed(t, hashed.nsec3(t, "optout.nsec3.", false, dns.NSEC3FlagOptOut))...,
+		)},
+		"noproof.nsec3. DS": {Authority: hashed.signed(
+			t, hashed.nsec3(t, "noproof.nsec3.", false, dns.NSEC3FlagOptOut),
+		)},
+	}}
+
+	// The names in example. are (in canonical order): example., mail, *.wild and
+	// www.
+	apexNSEC := example.signed(t, example.nsec(t, "example.", "mail.example."))
+	mailNSEC := example.signed(t, example.nsec(t, "mail.example.", "*.wild.example."))
+	wildNSEC := example.signed(t, example.nsec(t, "*.wild.example.", "www.example."))
+
+	// The NSEC3 records of nsec3. prove the closest encloser of the names below
+	// the apex.
+	apexNSEC3 := hashed.signed(t, hashed.nsec3(t, "nsec3.", true, 0))
+	wildNSEC3 := hashed.signed(t, hashed.nsec3(t, "wild.nsec3.", true, 0, dns.TypeRRSIG))
+	nsec3s := func(rrs ...[]dns.RR) []dns.RR {
+		all := []dns.RR{}
+		for _, rr := range rrs {
+			all = append(all, rr...)
+		}
+		return all
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		qtype dns.QType
+		msg   *dns.Msg
+		want  Status
+	}{
+		{
+			name:  "secure answer",
+			query: "www.example.",
+			msg:   &dns.Msg{Answer: example.signed(t, a("www.example."))},
+			want:  StatusSecure,
+		},
+		{
+			name:  "expired signature",
+			query: "www.example.",
+			msg: &dns.Msg{Answer: []dns.RR{
+				a("www.example."),
+				example.rrsig(t, []dns.RR{a("www.example.")}, 2, time.Now().Add(-time.Hour)),
+			}},
+			want: StatusBogus,
+		},
+		{
+			name:  "DS doesn't match the DNSKEY",
+			query: "www.bad.",
+			msg:   &dns.Msg{Answer: bad.signed(t, a("www.bad."))},
+			want:  StatusBogus,
+		},
+		{
+			name:  "insecure delegation",
+			query: "www.unsigned.",
+			msg:   &dns.Msg{Answer: []dns.RR{a("www.unsigned.")}},
+			want:  StatusInsecure,
+		},
+		{
+			name:  "wildcard expansion",
+			query: "a.wild.example.",
+			msg: &dns.Msg{
+				Answer: []dns.RR{
+					a("a.wild.example."),
+					example.rrsig(t, []dns.RR{a("a.wild.example.")}, 2, time.Now().Add(time.Hour)),
+				},
+				Authority: wildNSEC,
+			},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC3 wildcard expansion",
+			query: "a.wild.nsec3.",
+			msg: &dns.Msg{
+				Answer: []dns.RR{
+					a("a.wild.nsec3."),
+					hashed.rrsig(t, []dns.RR{a("a.wild.nsec3.")}, 2, time.Now().Add(time.Hour)),
+				},
+				Authority: hashed.signed(t, hashed.nsec3(t, "a.wild.nsec3.", false, 0)),
+			},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC3 wildcard expansion without next closer proof",
+			query: "a.wild.nsec3.",
+			msg: &dns.Msg{
+				Answer: []dns.RR{
+					a("a.wild.nsec3."),
+					hashed.rrsig(t, []dns.RR{a("a.wild.nsec3.")}, 2, time.Now().Add(time.Hour)),
+				},
+				Authority: hashed.signed(t, hashed.nsec3(t, "b.wild.nsec3.", false, 0)),
+			},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC NODATA",
+			query: "mail.example.",
+			msg: &dns.Msg{Authority: example.signed(t, example.nsec(
+				t, "mail.example.", "*.wild.example.", dns.TypeMX, dns.TypeRRSIG, dns.TypeNSEC,
+			))},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC NODATA with the type",
+			query: "mail.example.",
+			msg: &dns.Msg{Authority: example.signed(t, example.nsec(
+				t, "mail.example.", "*.wild.example.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC,
+			))},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC wildcard NODATA",
+			query: "a.wild.example.",
+			msg: &dns.Msg{Authority: example.signed(t, example.nsec(
+				t, "*.wild.example.", "www.example.", dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC,
+			))},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC wildcard NODATA with the type",
+			query: "a.wild.example.",
+			msg: &dns.Msg{Authority: example.signed(t, example.nsec(
+				t, "*.wild.example.", "www.example.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC,
+			))},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC3 NODATA",
+			query: "nsec3.",
+			msg:   &dns.Msg{Authority: apexNSEC3},
+			want:  StatusSecure,
+		},
+		{
+			name:  "NSEC3 NODATA with closest encloser proof",
+			query: "nx.nsec3.",
+			msg: &dns.Msg{Authority: nsec3s(
+				apexNSEC3,
+				hashed.signed(t, hashed.nsec3(t, "nx.nsec3.", false, 0)),
+			)},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC3 wildcard NODATA",
+			query: "a.wild.nsec3.",
+			msg: &dns.Msg{Authority: nsec3s(
+				wildNSEC3,
+				hashed.signed(t, hashed.nsec3(t, "a.wild.nsec3.", false, 0)),
+				hashed.signed(t, hashed.nsec3(t, "*.wild.nsec3.", true, 0, dns.TypeTXT, dns.TypeRRSIG)),
+			)},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC3 wildcard NODATA with the type",
+			query: "a.wild.nsec3.",
+			msg: &dns.Msg{Authority: nsec3s(
+				wildNSEC3,
+				hashed.signed(t, hashed.nsec3(t, "a.wild.nsec3.", false, 0)),
+				hashed.signed(t, hashed.nsec3(t, "*.wild.nsec3.", true, 0, dns.TypeA, dns.TypeRRSIG)),
+			)},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC3 opt-out DS NODATA",
+			query: "sub.nsec3.",
+			qtype: dns.TypeDS,
+			msg: &dns.Msg{Authority: nsec3s(
+				apexNSEC3,
+				hashed.signed(t, hashed.nsec3(t, "sub.nsec3.", false, dns.NSEC3FlagOptOut)),
+			)},
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC3 DS NODATA without opt-out",
+			query: "sub.nsec3.",
+			qtype: dns.TypeDS,
+			msg: &dns.Msg{Authority: nsec3s(
+				apexNSEC3,
+				hashed.signed(t, hashed.nsec3(t, "sub.nsec3.", false, 0)),
+			)},
+			want: StatusBogus,
+		},
+		{
+			name:  "NSEC NXDOMAIN",
+			query: "nx.example.",
+			msg:   nxdomain(append(append([]dns.RR{}, mailNSEC...), apexNSEC...)),
+			want:  StatusSecure,
+		},
+		{
+			name:  "NSEC NXDOMAIN without wildcard proof",
+			query: "nx.example.",
+			msg:   nxdomain(mailNSEC),
+			want:  StatusBogus,
+		},
+		{
+			name:  "NSEC3 NXDOMAIN",
+			query: "nx.nsec3.",
+			msg: nxdomain(append(append(
+				hashed.signed(t, hashed.nsec3(t, "nsec3.", true, 0)),
+				hashed.signed(t, hashed.nsec3(t, "nx.nsec3.", false, 0))...),
+				hashed.signed(t, hashed.nsec3(t, "*.nsec3.", false, 0))...,
+			)),
+			want: StatusSecure,
+		},
+		{
+			name:  "NSEC3 NXDOMAIN without wildcard proof",
+			query: "nx.nsec3.",
+			msg: nxdomain(append(
+				hashed.signed(t, hashed.nsec3(t, "nsec3.", true, 0)),
+				hashed.signed(t, hashed.nsec3(t, "nx.nsec3.", false, 0))...,
+			)),
+			want: StatusBogus,
+		},
+		{
+			name:  "opt-out delegation",
+			query: "www.optout.nsec3.",
+			msg:   &dns.Msg{Answer: []dns.RR{a("www.optout.nsec3.")}},
+			want:  StatusInsecure,
+		},
+		{
+			name:  "opt-out delegation without closest encloser",
+			query: "www.noproof.nsec3.",
+			msg:   &dns.Msg{Answer: []dns.RR{a("www.noproof.nsec3.")}},
+			want:  StatusBogus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(
+				WithRootServers(net.ParseIP("192.0.2.1")),
+				WithTransport(tr),
+			)
+			v := newValidator(context.Background(), c, []dns.DS{*root.ds(t)})
+
+			qt := tt.qtype
+			if qt == 0 {
+				qt = dns.TypeA
+			}
+			if got := v.validate(tt.msg, tt.query, qt); got != tt.want {
+				t.Errorf("got %s - want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// Package resolver implements an iterative DNS resolver; it resolves domain
+// names by following referrals, starting at a root name server, and can
+// validate the responses with DNSSEC.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-5
+package resolver
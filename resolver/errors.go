@@ -0,0 +1,124 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+var (
+	// ErrNXDomain means the domain name does not exist.
+	ErrNXDomain = errors.New("domain name does not exist")
+
+	// ErrNoData means the domain name exists, but has no resource records of the
+	// requested type.
+	ErrNoData = errors.New("no resource records of the requested type")
+
+	// ErrServFail means the name server was unable to process the query.
+	ErrServFail = errors.New("name server failure")
+
+	// ErrRefused means the name server refused to process the query.
+	ErrRefused = errors.New("name server refused query")
+
+	// ErrDelegationLoop means the name servers of a zone refer to each other (or
+	// to themselves) in a loop.
+	ErrDelegationLoop = errors.New("delegation loop")
+
+	// ErrTimeout means no response was received in time.
+	ErrTimeout = errors.New("timed out waiting for a response")
+
+	// ErrTruncated means the response was truncated, and could not be received
+	// in full.
+	ErrTruncated = errors.New("response truncated")
+
+	// ErrCaseMismatch means the response echoed the question with a name that
+	// only differs in case, which name servers that don't preserve the
+	// (randomized) case of the query name do.
+	ErrCaseMismatch = errors.New("response question name case does not match query")
+
+	// ErrPrerequisite means a prerequisite of a dynamic update wasn't met, so
+	// the zone wasn't updated.
+	ErrPrerequisite = errors.New("update prerequisite not met")
+)
+
+// ExtendedError is the error of a response with Extended DNS Errors, which
+// explain why the name server failed (e.g. "DNSSEC Bogus"), or why it answered
+// the way it did (e.g. "Blocked").
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8914
+type ExtendedError struct {
+	// Err is the error of the response (e.g. wrapping ErrServFail).
+	Err error
+
+	// EDEs are the Extended DNS Errors of the response, in order.
+	EDEs []dns.EDE
+}
+
+// Error returns the error, followed by the Extended DNS Errors.
+func (e *ExtendedError) Error() string {
+	edes := make([]string, len(e.EDEs))
+	for i := range e.EDEs {
+		edes[i] = "EDE " + e.EDEs[i].String()
+	}
+
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(edes, ", "))
+}
+
+// Unwrap returns the error of the response.
+func (e *ExtendedError) Unwrap() error {
+	return e.Err
+}
+
+// withEDEs wraps the error of the response in an ExtendedError when the
+// response has Extended DNS Errors. Malformed EDE options are ignored.
+func withEDEs(err error, resp *dns.Msg) error {
+	edes, _ := resp.EDEs()
+	if len(edes) == 0 {
+		return err
+	}
+
+	return &ExtendedError{Err: err, EDEs: edes}
+}
+
+// rcodeError returns the error for a final response to the query for the name
+// and type without answer resource records.
+func rcodeError(name string, qt dns.QType, resp *dns.Msg) error {
+	var err error
+	switch resp.RCode {
+	case dns.RCodeNameError:
+		err = fmt.Errorf("%s: %w", name, ErrNXDomain)
+	case dns.RCodeNoError:
+		err = fmt.Errorf("%s %s: %w", name, qt, ErrNoData)
+	case dns.RCodeServerFailure:
+		err = fmt.Errorf("%s %s: %w", name, qt, ErrServFail)
+	case dns.RCodeRefused:
+		err = fmt.Errorf("%s %s: %w", name, qt, ErrRefused)
+	default:
+		err = fmt.Errorf("%s %s: no answer found (%s)", name, qt, resp.RCode)
+	}
+
+	return withEDEs(err, resp)
+}
+
+// isTimeout checks if the error is caused by a timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// timeoutError wraps the error with ErrTimeout when it's caused by a timeout.
+func timeoutError(err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || !isTimeout(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", ErrTimeout, err)
+}
@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"context"
+	"net"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Exchange sends the pre-built message to the name server, and returns the
+// full response; no referrals or CNAME chains are followed, and nothing is
+// cached. The server is an IP address or "host:port" (the port defaults to
+// 53).
+func (c *Client) Exchange(query *dns.Msg, server string) (*dns.Msg, error) {
+	return c.ExchangeContext(context.Background(), query, server)
+}
+
+// ExchangeContext is like Exchange, but the context can be used to cancel the
+// exchange, or to enforce a deadline. The exchange is bounded by the client
+// timeout, and the message is sent with the client transport.
+func (c *Client) ExchangeContext(
+	ctx context.Context,
+	query *dns.Msg,
+	server string,
+) (*dns.Msg, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	query, err := c.padQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	query, err = c.signSIG0(query)
+	if err != nil {
+		return nil, err
+	}
+	query, mac, err := c.signTSIG(query)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.transport.Exchange(ctx, query, server)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	if _, err := c.verifyTSIG(resp, mac, false); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
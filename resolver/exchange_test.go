@@ -0,0 +1,48 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// addrTransport records the address a query was sent to.
+type addrTransport struct {
+	addr string
+}
+
+func (t *addrTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.addr = addr
+
+	resp := *query
+	resp.QR = 1
+	return &resp, nil
+}
+
+func TestExchangeDefaultPort(t *testing.T) {
+	tr := &addrTransport{}
+	c := NewClient(WithTransport(tr))
+
+	tests := map[string]string{
+		"192.0.2.53":      "192.0.2.53:53",
+		"192.0.2.53:5353": "192.0.2.53:5353",
+		"2001:db8::53":    "[2001:db8::53]:53",
+	}
+	for server, want := range tests {
+		query := new(dns.Msg)
+		if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Exchange(query, server); err != nil {
+			t.Fatalf("failed to exchange: %v", err)
+		}
+		if tr.addr != want {
+			t.Errorf("%s: got address %s, want %s", server, tr.addr, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// ResolveHost resolves a host name to its IPv4 and IPv6 addresses. The A and
+// AAAA resource records are resolved concurrently, and the addresses are
+// ordered by preference for connecting to them (see sortAddresses).
+func (c *Client) ResolveHost(name string) ([]net.IP, error) {
+	return c.ResolveHostContext(context.Background(), name)
+}
+
+// ResolveHostContext is like ResolveHost, but the context can be used to
+// cancel the resolution, or to enforce a deadline.
+func (c *Client) ResolveHostContext(
+	ctx context.Context,
+	name string,
+) ([]net.IP, error) {
+	type result struct {
+		ips []net.IP
+		err error
+	}
+
+	qts := []dns.QType{dns.TypeA, dns.TypeAAAA}
+	results := make([]chan result, len(qts))
+	for i, qt := range qts {
+		results[i] = make(chan result, 1)
+		go func(qt dns.QType, ch chan result) {
+			r, err := c.ResolveContext(ctx, name, qt)
+			if err != nil {
+				ch <- result{err: err}
+				return
+			}
+			ch <- result{ips: getAddresses(r.Answer)}
+		}(qt, results[i])
+	}
+
+	// An error is only returned when neither address family could be resolved.
+	ips := []net.IP{}
+	var firstErr error
+	for _, ch := range results {
+		r := <-ch
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		ips = append(ips, r.ips...)
+	}
+	if len(ips) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return sortAddresses(ips), nil
+}
+
+// policy is an entry of the policy table used to select destination
+// addresses.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6724#section-2.1
+type policy struct {
+	prefix     *net.IPNet
+	precedence int
+}
+
+// policyTable is the default policy table.
+var policyTable = []policy{
+	{mustParseCIDR("::1/128"), 50},
+	{mustParseCIDR("::/0"), 40},
+	{mustParseCIDR("::ffff:0:0/96"), 35},
+	{mustParseCIDR("2002::/16"), 30},
+	{mustParseCIDR("2001::/32"), 5},
+	{mustParseCIDR("fc00::/7"), 3},
+	{mustParseCIDR("::/96"), 1},
+	{mustParseCIDR("fec0::/10"), 1},
+	{mustParseCIDR("3ffe::/16"), 1},
+}
+
+// mustParseCIDR parses a CIDR prefix, and panics when it's invalid.
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// precedence returns the precedence of the address from the policy table
+// entry with the longest matching prefix.
+func precedence(ip net.IP) int {
+	ip16 := ip.To16()
+	best, bestLen := 0, -1
+	for _, p := range policyTable {
+		ones, _ := p.prefix.Mask.Size()
+		if p.prefix.Contains(ip16) && ones > bestLen {
+			best, bestLen = p.precedence, ones
+		}
+	}
+
+	return best
+}
+
+// Address scopes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6724#section-3.1
+const (
+	scopeLinkLocal = 0x2
+	scopeSiteLocal = 0x5
+	scopeGlobal    = 0xe
+)
+
+// scope returns the scope of the address.
+func scope(ip net.IP) int {
+	switch {
+	case ip.IsLoopback(), ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return scopeLinkLocal
+	case ip.To4() == nil && len(ip) == net.IPv6len && ip[0] == 0xfe && ip[1]&0xc0 == 0xc0:
+		return scopeSiteLocal
+	default:
+		return scopeGlobal
+	}
+}
+
+// source returns the source address that's used to connect to the
+// destination address, or nil when the destination is unreachable. No packets
+// are sent.
+func source(dst net.IP) net.IP {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: dst, Port: 9})
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// commonPrefixLen returns the number of leading bits the addresses share.
+func commonPrefixLen(a net.IP, b net.IP) int {
+	a, b = a.To16(), b.To16()
+	n := 0
+	for i := range a {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+
+	return n
+}
+
+// sortAddresses sorts destination addresses by preference, using a subset of
+// the rules of RFC 6724: unreachable destinations go last (rule 1),
+// destinations with a source of matching scope go first (rule 2), then
+// destinations with a higher precedence (rule 6), a smaller scope (rule 8), and
+// a longer matching prefix with their source (rule 9, IPv6 only).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6724#section-6
+func sortAddresses(ips []net.IP) []net.IP {
+	type dest struct {
+		ip  net.IP
+		src net.IP
+	}
+
+	dests := make([]dest, len(ips))
+	for i, ip := range ips {
+		dests[i] = dest{ip: ip, src: source(ip)}
+	}
+
+	sort.SliceStable(dests, func(i, j int) bool {
+		a, b := dests[i], dests[j]
+
+		// Rule 1: avoid unusable destinations.
+		if (a.src == nil) != (b.src == nil) {
+			return a.src != nil
+		}
+
+		// Rule 2: prefer matching scope.
+		if a.src != nil && b.src != nil {
+			am := scope(a.ip) == scope(a.src)
+			bm := scope(b.ip) == scope(b.src)
+			if am != bm {
+				return am
+			}
+		}
+
+		// Rule 6: prefer higher precedence.
+		if pa, pb := precedence(a.ip), precedence(b.ip); pa != pb {
+			return pa > pb
+		}
+
+		// Rule 8: prefer smaller scope.
+		if sa, sb := scope(a.ip), scope(b.ip); sa != sb {
+			return sa < sb
+		}
+
+		// Rule 9: use longest matching prefix.
+		if a.src != nil && b.src != nil && a.ip.To4() == nil && b.ip.To4() == nil {
+			la, lb := commonPrefixLen(a.ip, a.src), commonPrefixLen(b.ip, b.src)
+			if la != lb {
+				return la > lb
+			}
+		}
+
+		return false
+	})
+
+	sorted := make([]net.IP, len(dests))
+	for i, d := range dests {
+		sorted[i] = d.ip
+	}
+
+	return sorted
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// hostTransport answers A and AAAA queries authoritatively.
+type hostTransport struct{}
+
+func (hostTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+
+	rr := testRR(query.Question.QName, 300)
+	if query.Question.QType == dns.TypeAAAA {
+		rr.Type = dns.TypeAAAA
+		rr.RDataUnpacked = "2001:db8::1"
+	}
+	resp.Answer = []dns.RR{rr}
+
+	return &resp, nil
+}
+
+func TestResolveHost(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(hostTransport{}),
+	)
+
+	ips, err := c.ResolveHost("example.com")
+	if err != nil {
+		t.Fatalf("failed to resolve host: %v", err)
+	}
+
+	got := []string{}
+	for _, ip := range ips {
+		got = append(got, ip.String())
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "192.0.2.1" || got[1] != "2001:db8::1" {
+		t.Errorf("got addresses %v, want 192.0.2.1 and 2001:db8::1", got)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := map[string]int{
+		"::1":            50,
+		"2001:0:4136::1": 5,
+		"2001:db8::1":    40,
+		"2a00::1":        40,
+		"192.0.2.1":      35,
+		"2002:c000::1":   30,
+		"fd00::1":        3,
+	}
+
+	for ip, want := range tests {
+		if got := precedence(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: got precedence %d, want %d", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package resolver
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	_ "crypto/sha256" // HKDF-SHA256
+	_ "crypto/sha512" // HKDF-SHA384 and HKDF-SHA512
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HPKE (Hybrid Public Key Encryption) encrypts a message to the holder of a
+// public key. Only the base mode (without pre-shared keys or sender
+// authentication) is implemented, as used by Oblivious DoH.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9180
+
+// hpkeKEM is an HPKE key encapsulation mechanism.
+type hpkeKEM uint16
+
+const (
+	// kemP256 is DHKEM(P-256, HKDF-SHA256).
+	kemP256 hpkeKEM = 0x0010
+
+	// kemX25519 is DHKEM(X25519, HKDF-SHA256).
+	kemX25519 hpkeKEM = 0x0020
+)
+
+// hpkeKDF is an HPKE key derivation function.
+type hpkeKDF uint16
+
+const (
+	kdfHKDFSHA256 hpkeKDF = 0x0001
+	kdfHKDFSHA384 hpkeKDF = 0x0002
+	kdfHKDFSHA512 hpkeKDF = 0x0003
+)
+
+// hpkeAEAD is an HPKE authenticated encryption with associated data
+// algorithm.
+type hpkeAEAD uint16
+
+const (
+	aeadAES128GCM hpkeAEAD = 0x0001
+	aeadAES256GCM hpkeAEAD = 0x0002
+)
+
+// hpkeSuite is the combination of a KEM, KDF and AEAD.
+type hpkeSuite struct {
+	kem  hpkeKEM
+	kdf  hpkeKDF
+	aead hpkeAEAD
+}
+
+// validate checks that the algorithms of the suite are supported.
+func (s hpkeSuite) validate() error {
+	switch s.kem {
+	case kemP256, kemX25519:
+	default:
+		return fmt.Errorf("unsupported hpke kem 0x%04x", uint16(s.kem))
+	}
+	switch s.kdf {
+	case kdfHKDFSHA256, kdfHKDFSHA384, kdfHKDFSHA512:
+	default:
+		return fmt.Errorf("unsupported hpke kdf 0x%04x", uint16(s.kdf))
+	}
+	switch s.aead {
+	case aeadAES128GCM, aeadAES256GCM:
+	default:
+		return fmt.Errorf("unsupported hpke aead 0x%04x", uint16(s.aead))
+	}
+
+	return nil
+}
+
+// hash returns the hash function of the KDF.
+func (s hpkeSuite) hash() crypto.Hash {
+	switch s.kdf {
+	case kdfHKDFSHA384:
+		return crypto.SHA384
+	case kdfHKDFSHA512:
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+// keySize returns the key size (Nk) of the AEAD.
+func (s hpkeSuite) keySize() int {
+	if s.aead == aeadAES256GCM {
+		return 32
+	}
+
+	return 16
+}
+
+// nonceSize is the nonce size (Nn) of the AEADs.
+const nonceSize = 12
+
+// id returns the suite_id of the HPKE key schedule.
+func (s hpkeSuite) id() []byte {
+	b := []byte("HPKE")
+	b = append(b, byte(s.kem>>8), byte(s.kem))
+	b = append(b, byte(s.kdf>>8), byte(s.kdf))
+	return append(b, byte(s.aead>>8), byte(s.aead))
+}
+
+// extract is HKDF-Extract.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5869#section-2.2
+func extract(h crypto.Hash, salt, ikm []byte) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, h.Size())
+	}
+	mac := hmac.New(h.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// expand is HKDF-Expand.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5869#section-2.3
+func expand(h crypto.Hash, prk, info []byte, length int) []byte {
+	okm := []byte{}
+	t := []byte{}
+	for i := byte(1); len(okm) < length; i++ {
+		mac := hmac.New(h.New, prk)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		okm = append(okm, t...)
+	}
+
+	return okm[:length]
+}
+
+// labeledExtract is LabeledExtract of the suite.
+func labeledExtract(h crypto.Hash, suiteID, salt []byte, label string, ikm []byte) []byte {
+	b := append([]byte("HPKE-v1"), suiteID...)
+	b = append(append(b, label...), ikm...)
+	return extract(h, salt, b)
+}
+
+// labeledExpand is LabeledExpand of the suite.
+func labeledExpand(h crypto.Hash, suiteID, prk []byte, label string, info []byte, length int) []byte {
+	b := []byte{byte(length >> 8), byte(length)}
+	b = append(append(b, "HPKE-v1"...), suiteID...)
+	b = append(append(b, label...), info...)
+	return expand(h, prk, b, length)
+}
+
+// hpkeContext is the sender context of an HPKE encryption.
+type hpkeContext struct {
+	suite          hpkeSuite
+	aead           cipher.AEAD
+	baseNonce      []byte
+	exporterSecret []byte
+	seq            uint64
+}
+
+// setupBaseS sets up an encryption to the public key (SetupBaseS), and returns
+// the encapsulated key with the sender context.
+func setupBaseS(suite hpkeSuite, pkR []byte, info []byte) ([]byte, *hpkeContext, error) {
+	if err := suite.validate(); err != nil {
+		return nil, nil, err
+	}
+	skE, err := generateKEMKey(suite.kem, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return setupBaseSWithKey(suite, pkR, info, skE)
+}
+
+// setupBaseSWithKey is setupBaseS with the ephemeral private key.
+func setupBaseSWithKey(suite hpkeSuite, pkR, info, skE []byte) ([]byte, *hpkeContext, error) {
+	enc, sharedSecret, err := encap(suite.kem, pkR, skE)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, err := keySchedule(suite, sharedSecret, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return enc, ctx, nil
+}
+
+// keySchedule derives the context of the base mode from the shared secret.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9180#section-5.1
+func keySchedule(suite hpkeSuite, sharedSecret, info []byte) (*hpkeContext, error) {
+	h, id := suite.hash(), suite.id()
+
+	keyScheduleContext := []byte{0} // mode_base
+	keyScheduleContext = append(keyScheduleContext, labeledExtract(h, id, nil, "psk_id_hash", nil)...)
+	keyScheduleContext = append(keyScheduleContext, labeledExtract(h, id, nil, "info_hash", info)...)
+	secret := labeledExtract(h, id, sharedSecret, "secret", nil)
+
+	key := labeledExpand(h, id, secret, "key", keyScheduleContext, suite.keySize())
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hpkeContext{
+		suite:          suite,
+		aead:           aead,
+		baseNonce:      labeledExpand(h, id, secret, "base_nonce", keyScheduleContext, nonceSize),
+		exporterSecret: labeledExpand(h, id, secret, "exp", keyScheduleContext, h.Size()),
+	}, nil
+}
+
+// seal encrypts the plaintext with the next nonce of the context.
+func (c *hpkeContext) seal(aad, plaintext []byte) []byte {
+	nonce := append([]byte{}, c.baseNonce...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+	for i := range seq {
+		nonce[nonceSize-8+i] ^= seq[i]
+	}
+	c.seq++
+
+	return c.aead.Seal(nil, nonce, plaintext, aad)
+}
+
+// export derives a secret of the length from the context.
+func (c *hpkeContext) export(exporterContext []byte, length int) []byte {
+	return labeledExpand(c.suite.hash(), c.suite.id(), c.exporterSecret, "sec", exporterContext, length)
+}
+
+// kemID returns the suite_id of the KEM.
+func kemID(kem hpkeKEM) []byte {
+	return []byte{'K', 'E', 'M', byte(kem >> 8), byte(kem)}
+}
+
+// kemCurve returns the curve of the KEM.
+func kemCurve(kem hpkeKEM) (ecdh.Curve, error) {
+	switch kem {
+	case kemP256:
+		return ecdh.P256(), nil
+	case kemX25519:
+		return ecdh.X25519(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported hpke kem 0x%04x", uint16(kem))
+}
+
+// generateKEMKey generates a private key of the KEM.
+func generateKEMKey(kem hpkeKEM, r io.Reader) ([]byte, error) {
+	curve, err := kemCurve(kem)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := curve.GenerateKey(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return sk.Bytes(), nil
+}
+
+// encap derives a shared secret for the public key with the ephemeral private
+// key, and returns the encapsulated (public) key with the shared secret.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9180#section-4.1
+func encap(kem hpkeKEM, pkR, skE []byte) ([]byte, []byte, error) {
+	curve, err := kemCurve(kem)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := curve.NewPublicKey(pkR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	sk, err := curve.NewPrivateKey(skE)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key: %v", err)
+	}
+
+	// The X25519 shared secret is rejected when it's all zeros (i.e. the public
+	// key is a point of small order).
+	dh, err := sk.ECDH(pk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	enc := sk.PublicKey().Bytes()
+
+	// Both KEMs use HKDF-SHA256.
+	kemContext := append(append([]byte{}, enc...), pkR...)
+	prk := labeledExtract(crypto.SHA256, kemID(kem), nil, "eae_prk", dh)
+	sharedSecret := labeledExpand(crypto.SHA256, kemID(kem), prk, "shared_secret", kemContext, 32)
+
+	return enc, sharedSecret, nil
+}
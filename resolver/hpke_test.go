@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// deriveX25519Key derives the private key of DHKEM(X25519, HKDF-SHA256) from
+// the input keying material.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9180#section-7.1.3
+func deriveX25519Key(ikm []byte) []byte {
+	prk := labeledExtract(crypto.SHA256, kemID(kemX25519), nil, "dkp_prk", ikm)
+	return labeledExpand(crypto.SHA256, kemID(kemX25519), prk, "sk", nil, 32)
+}
+
+// See: https://datatracker.ietf.org/doc/html/rfc9180#appendix-A.1.1
+func TestHPKESetupBaseS(t *testing.T) {
+	suite := hpkeSuite{kem: kemX25519, kdf: kdfHKDFSHA256, aead: aeadAES128GCM}
+	skE := deriveX25519Key(mustHex(t, "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234"))
+	skR := deriveX25519Key(mustHex(t, "6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037"))
+	if want := mustHex(t, "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8"); !bytes.Equal(skR, want) {
+		t.Fatalf("private key error: got %x - want %x", skR, want)
+	}
+	sk, err := ecdh.X25519().NewPrivateKey(skR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkR := sk.PublicKey().Bytes()
+	if want := mustHex(t, "3948cfe0ad1ddb695d780e59077195da6c56506b027329794ab02bca80815c4d"); !bytes.Equal(pkR, want) {
+		t.Fatalf("public key error: got %x - want %x", pkR, want)
+	}
+
+	enc, _, err := setupBaseSWithKey(suite, pkR, []byte("Ode on a Grecian Urn"), skE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431"); !bytes.Equal(enc, want) {
+		t.Errorf("enc error: got %x - want %x", enc, want)
+	}
+
+	// P-256 encapsulated keys are uncompressed points.
+	skP256, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256 := hpkeSuite{kem: kemP256, kdf: kdfHKDFSHA256, aead: aeadAES128GCM}
+	if enc, _, err := setupBaseS(p256, skP256.PublicKey().Bytes(), nil); err != nil || len(enc) != 65 {
+		t.Errorf("p-256 error: got %d byte enc (%v) - want 65", len(enc), err)
+	}
+
+	// Unsupported algorithms are rejected.
+	if _, _, err := setupBaseS(hpkeSuite{kem: kemX25519, kdf: kdfHKDFSHA256, aead: 0x0003}, pkR, nil); err == nil {
+		t.Errorf("expected chacha20-poly1305 to be unsupported")
+	}
+}
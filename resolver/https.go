@@ -0,0 +1,84 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// HTTPS sends queries over HTTPS (DNS over HTTPS) with the default HTTP
+// client. The address of a name server is the URL of its DNS API endpoint
+// (e.g. "https://dns.example/dns-query").
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484
+var HTTPS Transport = NewHTTPSTransport(http.DefaultClient)
+
+// dnsMessageType is the media type of a DNS message in wire format.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484#section-6
+const dnsMessageType = "application/dns-message"
+
+// NewHTTPSTransport creates a transport that sends queries over HTTPS (DNS
+// over HTTPS) with the HTTP client. Queries are sent as POST requests to the
+// address, which is the URL of the DNS API endpoint of the name server.
+func NewHTTPSTransport(client *http.Client) Transport {
+	return &httpsTransport{client: client}
+}
+
+// httpsTransport sends queries over HTTPS.
+type httpsTransport struct {
+	client *http.Client
+}
+
+// Exchange posts the query to the URL, and reads the response from the body.
+func (t *httpsTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	url string,
+) (*dns.Msg, error) {
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(queryb))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", url, err)
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send dns query: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected http status %q from %s", res.Status, url)
+	}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != dnsMessageType {
+		return nil, fmt.Errorf("unexpected content type %q from %s", mt, url)
+	}
+
+	// A DNS message is at most 65535 bytes long.
+	b, err := io.ReadAll(io.LimitReader(res.Body, 65535))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dns response: %w", err)
+	}
+
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(b); err != nil {
+		return nil, fmt.Errorf("failed to unpack dns response: %w", err)
+	}
+	if err := matchResponse(query, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestHTTPSTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-query" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if _, err := q.Unpack(b); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		resp := *q
+		resp.QR = 1
+		resp.Additional = nil
+		resp.Answer = []dns.RR{testRR(q.Question.QName, 300)}
+		respb, err := resp.Pack()
+		if err != nil {
+			return
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(respb)
+	}))
+	defer ts.Close()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	tr := NewHTTPSTransport(ts.Client())
+	resp, err := tr.Exchange(ctx, query, ts.URL+"/dns-query")
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Errorf("answer error: got %d answers - want 1", len(resp.Answer))
+	}
+
+	// A response with another status than 200 OK is an error.
+	if _, err := tr.Exchange(ctx, query, ts.URL+"/not-found"); err == nil {
+		t.Errorf("expected error status to fail")
+	}
+	if _, err := NewHTTPSTransport(http.DefaultClient).Exchange(ctx, query, ts.URL); err == nil {
+		t.Errorf("expected untrusted certificate to fail")
+	}
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// defaultLLMNRGroups are the multicast groups of Link-Local Multicast Name
+// Resolution; queries are sent to both, and responders answer the queries for
+// their own names directly to the querier.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4795#section-2
+var defaultLLMNRGroups = []*net.UDPAddr{
+	{IP: net.IPv4(224, 0, 0, 252), Port: 5355},
+	{IP: net.ParseIP("ff02::1:3"), Port: 5355},
+}
+
+// isSingleLabel checks if the fully qualified domain name has a single label
+// (e.g. "printer."), which can be resolved with LLMNR.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4795#section-2
+func isSingleLabel(name string) bool {
+	return dns.CountLabels(name) == 1
+}
+
+// resolveLLMNR resolves the single-label name on the local link with LLMNR, and
+// returns the first response that answers it. In the header of an LLMNR
+// response, the RD bit is the tentative (T) bit, which is set by responders
+// that haven't verified the name is unique; those responses are ignored.
+// Truncated responses aren't retried over TCP.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4795#section-2.1.1
+func (c *Client) resolveLLMNR(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+) (*response, error) {
+	query := new(dns.Msg)
+	if err := query.SetQuery(name, qt); err != nil {
+		return nil, fmt.Errorf("failed to set dns query: %v", err)
+	}
+	query.RD = 0
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var resp *response
+	start := time.Now()
+	err := c.multicast(ctx, query, c.llmnrGroups, false, func(m *dns.Msg, from net.IP) bool {
+		if matchResponse(query, m) != nil || m.RD == 1 || m.RCode != dns.RCodeNoError {
+			return false
+		}
+		for _, rr := range m.Answer {
+			if strings.EqualFold(rr.Name, name) && rr.Type == qt {
+				resp = &response{Msg: m, server: from, rtt: time.Since(start)}
+				return true
+			}
+		}
+		return false
+	})
+	if resp != nil {
+		if c.cache != nil {
+			c.cache.Set(name, qt, dns.ClassIN, resp.Answer)
+		}
+		return resp, nil
+	}
+	if err == nil || ctx.Err() != nil {
+		err = fmt.Errorf("no llmnr response for %s: %w", name, context.DeadlineExceeded)
+	}
+
+	return nil, err
+}
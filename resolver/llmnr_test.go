@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// llmnrResponder answers LLMNR queries for its resource records directly to
+// the querier; when tentative is set, the responses have the T bit set.
+func llmnrResponder(t *testing.T, rrs []dns.RR, tentative bool) *net.UDPAddr {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := new(dns.Msg)
+			if _, err := q.Unpack(buf[:n]); err != nil || q.RD != 0 {
+				continue
+			}
+
+			resp := *q
+			resp.QR = 1
+			if tentative {
+				resp.RD = 1
+			}
+			for _, rr := range rrs {
+				if strings.EqualFold(rr.Name, q.Question.QName) && rr.Type == q.Question.QType {
+					resp.Answer = append(resp.Answer, rr)
+				}
+			}
+			if len(resp.Answer) == 0 {
+				continue
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			pc.WriteTo(b, addr)
+		}
+	}()
+
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+// newLLMNRClient creates a client that gets NXDOMAIN for every name from DNS,
+// and sends LLMNR queries to the responder when llmnr is set.
+func newLLMNRClient(responder *net.UDPAddr, llmnr bool) *Client {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(&nxTransport{}),
+		WithTimeout(200*time.Millisecond),
+		WithCache(nil),
+		WithLLMNR(llmnr),
+	)
+	c.llmnrGroups = []*net.UDPAddr{responder}
+
+	return c
+}
+
+func TestResolveLLMNR(t *testing.T) {
+	rrs := []dns.RR{testRR("printer.", 30), testRR("printer.example.com.", 30)}
+	responder := llmnrResponder(t, rrs, false)
+	c := newLLMNRClient(responder, true)
+
+	r, err := c.ResolveContext(context.Background(), "printer", dns.TypeA)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if len(r.Answer) != 1 || !r.Server.Equal(responder.IP) {
+		t.Errorf("got answer %v from %v, want 1 record from %v", r.Answer, r.Server, responder.IP)
+	}
+
+	// Only single-label names are resolved with LLMNR.
+	if _, err := c.ResolveContext(context.Background(), "printer.example.com", dns.TypeA); err == nil {
+		t.Error("got no error for a name with multiple labels")
+	}
+
+	// The DNS result is kept when LLMNR is disabled, or fails.
+	c = newLLMNRClient(responder, false)
+	if _, err := c.ResolveContext(context.Background(), "printer", dns.TypeA); err == nil {
+		t.Error("got no error with LLMNR disabled")
+	}
+	c = newLLMNRClient(llmnrResponder(t, rrs, true), true)
+	msg, err := c.Query(context.Background(), "printer", dns.TypeA, false)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if msg.RCode != dns.RCodeNameError {
+		t.Errorf("got %s for a tentative response, want NXDOMAIN", msg.RCode)
+	}
+}
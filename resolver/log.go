@@ -0,0 +1,28 @@
+package resolver
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger logs the steps of every resolution with the logger: the queries
+// sent to name servers, their responses and the referrals that are followed
+// (at the debug level), queries that failed (at the info level), and stale
+// answers that are served (at the warning level). The records carry the name,
+// type and name server of the query, and are logged with the context of the
+// resolution. It's disabled by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// log logs the message and attributes at the level with the logger of the
+// client, if any.
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if c.logger == nil {
+		return
+	}
+
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
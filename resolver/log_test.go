@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(delegationTransport{}),
+		WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+
+	if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	for _, want := range []string{
+		`level=DEBUG msg="sending query" name=example.com. qtype=A server=192.0.2.53 attempt=1`,
+		`level=DEBUG msg="received response" name=example.com. qtype=A server=192.0.2.53 rcode=NOERROR`,
+		`level=DEBUG msg="following referral" name=example.com. from=. to=com.`,
+		`level=DEBUG msg="sending query" name=example.com. qtype=A server=192.0.2.54 attempt=1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(failingTransport{}),
+		WithRetries(0),
+		WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+	)
+
+	if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err == nil {
+		t.Fatal("resolve error: got nil - want error")
+	}
+
+	// Queries are logged at the debug level, and failures at the info level.
+	if strings.Contains(buf.String(), "level=DEBUG") {
+		t.Errorf("log has debug records:\n%s", buf.String())
+	}
+	want := `level=INFO msg="query failed" name=example.com. qtype=A server=192.0.2.53 err="network is unreachable"`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("log lacks %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,291 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// The Lookup methods mirror the methods of net.Resolver, so a Client can be
+// used as a drop-in replacement for code that's written against it. Names are
+// resolved with the client configuration (e.g. iteratively, or in stub mode),
+// and errors are those returned by ResolveContext.
+
+// LookupHost looks up the host name, and returns its IPv4 and IPv6 addresses.
+// An IP address is returned as-is.
+func (c *Client) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := c.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []string{}
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+
+	return addrs, nil
+}
+
+// LookupIPAddr looks up the host name, and returns its IPv4 and IPv6
+// addresses.
+func (c *Client) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, err := c.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []net.IPAddr{}
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+
+	return addrs, nil
+}
+
+// LookupIP looks up the host name for the network, which must be "ip" (IPv4
+// and IPv6), "ip4" (IPv4) or "ip6" (IPv6), and returns its addresses. An IP
+// address is returned as-is.
+func (c *Client) LookupIP(
+	ctx context.Context,
+	network string,
+	host string,
+) ([]net.IP, error) {
+	var qt dns.QType
+	switch network {
+	case "ip":
+	case "ip4":
+		qt = dns.TypeA
+	case "ip6":
+		qt = dns.TypeAAAA
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		isV4 := ip.To4() != nil
+		if (qt == dns.TypeA && !isV4) || (qt == dns.TypeAAAA && isV4) {
+			return nil, fmt.Errorf("%s is not an address of network %s", host, network)
+		}
+		return []net.IP{ip}, nil
+	}
+
+	if qt == 0 {
+		return c.ResolveHostContext(ctx, host)
+	}
+
+	r, err := c.ResolveContext(ctx, host, qt)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAddresses(r.Answer), nil
+}
+
+// LookupCNAME looks up the canonical name of the host, i.e. the final target
+// of its CNAME chain. When the host has no CNAME chain, its fully qualified
+// name is returned.
+func (c *Client) LookupCNAME(ctx context.Context, host string) (string, error) {
+	r, err := c.ResolveContext(ctx, host, dns.TypeA)
+	if err != nil {
+		return "", err
+	}
+
+	return canonicalName(r), nil
+}
+
+// LookupMX looks up the mail exchanges of the name, and returns them sorted by
+// preference.
+func (c *Client) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	r, err := c.ResolveContext(ctx, name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	mxs := []*net.MX{}
+	for _, rr := range r.Answer {
+		if rr.Type != dns.TypeMX {
+			continue
+		}
+
+		mx := &net.MX{}
+		if _, err := fmt.Sscanf(rr.RDataUnpacked, "%d %s", &mx.Pref, &mx.Host); err != nil {
+			return nil, fmt.Errorf("invalid mx resource record %q: %v", rr.RDataUnpacked, err)
+		}
+		mxs = append(mxs, mx)
+	}
+
+	sort.SliceStable(mxs, func(i, j int) bool {
+		return mxs[i].Pref < mxs[j].Pref
+	})
+
+	return mxs, nil
+}
+
+// LookupTXT looks up the TXT resource records of the name. The character
+// strings of a single resource record are concatenated.
+func (c *Client) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r, err := c.ResolveContext(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	txts := []string{}
+	for _, rr := range r.Answer {
+		if rr.Type != dns.TypeTXT {
+			continue
+		}
+
+		txt, err := txtStrings(rr.RData)
+		if err != nil {
+			return nil, err
+		}
+		txts = append(txts, txt)
+	}
+
+	return txts, nil
+}
+
+// LookupNS looks up the name servers of the name.
+func (c *Client) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	r, err := c.ResolveContext(ctx, name, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	nss := []*net.NS{}
+	for _, rr := range r.Answer {
+		if rr.Type == dns.TypeNS {
+			nss = append(nss, &net.NS{Host: rr.RDataUnpacked})
+		}
+	}
+
+	return nss, nil
+}
+
+// LookupSRV looks up the SRV resource records of the service, which are
+// resolved for "_service._proto.name"; when both service and proto are empty,
+// the name is resolved as-is. The canonical name of the resolved name is
+// returned alongside the records, which are sorted by priority and randomized
+// by weight within a priority.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2782
+func (c *Client) LookupSRV(
+	ctx context.Context,
+	service string,
+	proto string,
+	name string,
+) (string, []*net.SRV, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+
+	r, err := c.ResolveContext(ctx, target, dns.TypeSRV)
+	if err != nil {
+		return "", nil, err
+	}
+
+	srvs := []*net.SRV{}
+	for _, rr := range r.Answer {
+		if rr.Type != dns.TypeSRV {
+			continue
+		}
+
+		srv := &net.SRV{}
+		if _, err := fmt.Sscanf(
+			rr.RDataUnpacked, "%d %d %d %s",
+			&srv.Priority, &srv.Weight, &srv.Port, &srv.Target,
+		); err != nil {
+			return "", nil, fmt.Errorf("invalid srv resource record %q: %v", rr.RDataUnpacked, err)
+		}
+		srvs = append(srvs, srv)
+	}
+
+	return canonicalName(r), sortSRV(srvs), nil
+}
+
+// canonicalName returns the final target of the CNAME chain of the result, or
+// the resolved name when there's no chain.
+func canonicalName(r *Result) string {
+	if len(r.CNAMEs) == 0 {
+		return r.Name
+	}
+
+	return r.CNAMEs[len(r.CNAMEs)-1].RDataUnpacked
+}
+
+// txtStrings concatenates the character strings of TXT RDATA, where each
+// string is prefixed with a length byte.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3.14
+func txtStrings(rdata []byte) (string, error) {
+	txt := []byte{}
+	for i := 0; i < len(rdata); {
+		size := int(rdata[i])
+		if i+1+size > len(rdata) {
+			return "", fmt.Errorf("txt string exceeds rdata length")
+		}
+		txt = append(txt, rdata[i+1:i+1+size]...)
+		i += 1 + size
+	}
+
+	return string(txt), nil
+}
+
+// sortSRV sorts the SRV records by priority, and orders the records of the
+// same priority by a weighted random selection.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2782
+func sortSRV(srvs []*net.SRV) []*net.SRV {
+	sort.SliceStable(srvs, func(i, j int) bool {
+		return srvs[i].Priority < srvs[j].Priority
+	})
+
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+		shuffleByWeight(srvs[start:end])
+		start = end
+	}
+
+	return srvs
+}
+
+// shuffleByWeight orders the SRV records (of the same priority) by repeatedly
+// selecting a record at random, where the chance a record is selected is
+// proportional to its weight.
+func shuffleByWeight(srvs []*net.SRV) {
+	total := 0
+	for _, srv := range srvs {
+		total += int(srv.Weight)
+	}
+
+	for i := range srvs {
+		if total == 0 {
+			return
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(total)))
+		if err != nil {
+			return
+		}
+		pick := int(n.Int64())
+
+		for j := i; j < len(srvs); j++ {
+			pick -= int(srvs[j].Weight)
+			if pick < 0 {
+				total -= int(srvs[j].Weight)
+				srvs[i], srvs[j] = srvs[j], srvs[i]
+				break
+			}
+		}
+	}
+}
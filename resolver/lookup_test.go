@@ -0,0 +1,129 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// lookupTransport answers MX, TXT, NS and SRV queries authoritatively.
+type lookupTransport struct{}
+
+func (lookupTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+
+	name := query.Question.QName
+	rr := func(t dns.Type, rd string) dns.RR {
+		return dns.RR{Name: name, Type: t, Class: dns.ClassIN, TTL: 300, RDataUnpacked: rd}
+	}
+
+	switch query.Question.QType {
+	case dns.TypeMX:
+		resp.Answer = []dns.RR{
+			rr(dns.TypeMX, "20 mx2.example.com."),
+			rr(dns.TypeMX, "10 mx1.example.com."),
+		}
+	case dns.TypeTXT:
+		txt := rr(dns.TypeTXT, `"v=spf1 " "-all"`)
+		txt.RData = []byte("\x07v=spf1 \x04-all")
+		resp.Answer = []dns.RR{txt}
+	case dns.TypeNS:
+		resp.Answer = []dns.RR{rr(dns.TypeNS, "ns1.example.com.")}
+	case dns.TypeSRV:
+		resp.Answer = []dns.RR{
+			rr(dns.TypeSRV, "20 0 5060 sip2.example.com."),
+			rr(dns.TypeSRV, "10 0 5060 sip1.example.com."),
+		}
+	}
+
+	return &resp, nil
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(lookupTransport{}),
+	)
+
+	mxs, err := c.LookupMX(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("failed to lookup mx: %v", err)
+	}
+	if len(mxs) != 2 || mxs[0].Host != "mx1.example.com." || mxs[0].Pref != 10 {
+		t.Errorf("got mx %+v, want mx1.example.com. first", mxs)
+	}
+
+	txts, err := c.LookupTXT(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("failed to lookup txt: %v", err)
+	}
+	if len(txts) != 1 || txts[0] != "v=spf1 -all" {
+		t.Errorf("got txt %q, want %q", txts, "v=spf1 -all")
+	}
+
+	nss, err := c.LookupNS(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("failed to lookup ns: %v", err)
+	}
+	if len(nss) != 1 || nss[0].Host != "ns1.example.com." {
+		t.Errorf("got ns %+v, want ns1.example.com.", nss)
+	}
+
+	cname, srvs, err := c.LookupSRV(ctx, "sip", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("failed to lookup srv: %v", err)
+	}
+	if cname != "_sip._tcp.example.com." {
+		t.Errorf("got canonical name %q, want _sip._tcp.example.com.", cname)
+	}
+	if len(srvs) != 2 || srvs[0].Target != "sip1.example.com." || srvs[0].Port != 5060 {
+		t.Errorf("got srv %+v, want sip1.example.com. first", srvs)
+	}
+}
+
+func TestLookupIP(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(hostTransport{}),
+	)
+
+	ips, err := c.LookupIP(ctx, "ip6", "example.com")
+	if err != nil {
+		t.Fatalf("failed to lookup ip: %v", err)
+	}
+	if len(ips) != 1 || ips[0].String() != "2001:db8::1" {
+		t.Errorf("got addresses %v, want 2001:db8::1", ips)
+	}
+
+	addrs, err := c.LookupHost(ctx, "192.0.2.10")
+	if err != nil {
+		t.Fatalf("failed to lookup host: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "192.0.2.10" {
+		t.Errorf("got addresses %v, want 192.0.2.10", addrs)
+	}
+
+	if _, err := c.LookupIP(ctx, "tcp", "example.com"); err == nil {
+		t.Errorf("lookup unknown network error: got nil - want error")
+	}
+}
+
+func TestShuffleByWeight(t *testing.T) {
+	srvs := []*net.SRV{{Target: "a.", Weight: 0}, {Target: "b.", Weight: 10}}
+	for i := 0; i < 10; i++ {
+		shuffleByWeight(srvs)
+		if srvs[0].Target != "b." {
+			t.Fatalf("got %s first, want the only weighted record b.", srvs[0].Target)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// defaultMDNSGroups are the multicast groups of multicast DNS; queries are
+// sent to both, and responders answer the queries they receive on the local
+// link.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6762#section-3
+var defaultMDNSGroups = []*net.UDPAddr{
+	{IP: net.IPv4(224, 0, 0, 251), Port: 5353},
+	{IP: net.ParseIP("ff02::fb"), Port: 5353},
+}
+
+// cacheFlush is the top bit of the class of a resource record in a multicast
+// DNS response; it tells the receiver to replace the cached resource record
+// set, and isn't part of the class.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6762#section-10.2
+const cacheFlush = 1 << 15
+
+// isLocalName checks if the fully qualified domain name is a link-local name
+// (under "local."), which is resolved with multicast DNS.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6762#section-3
+func isLocalName(name string) bool {
+	return dns.IsSubDomain("local.", name)
+}
+
+// resolveMDNS resolves the link-local name with a one-shot multicast DNS query,
+// and returns the first response that answers it.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6762#section-5.1
+func (c *Client) resolveMDNS(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+) (*response, error) {
+	query := new(dns.Msg)
+	if err := query.SetQuery(name, qt); err != nil {
+		return nil, fmt.Errorf("failed to set dns query: %v", err)
+	}
+	query.RD = 0
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var resp *response
+	start := time.Now()
+	err := c.multicast(ctx, query, c.mdnsGroups, true, func(m *dns.Msg, from net.IP) bool {
+		for _, rr := range m.Answer {
+			if strings.EqualFold(rr.Name, name) && (rr.Type == qt || rr.Type == dns.TypeCNAME) {
+				// Responses sent to the multicast group have no question.
+				m.Question = query.Question
+				resp = &response{Msg: m, server: from, rtt: time.Since(start)}
+				return true
+			}
+		}
+		return false
+	})
+	if resp != nil {
+		if c.cache != nil {
+			c.cache.Set(name, qt, dns.ClassIN, resp.Answer)
+		}
+		return resp, nil
+	}
+	if err == nil || ctx.Err() != nil {
+		err = fmt.Errorf("no multicast dns response for %s: %w", name, context.DeadlineExceeded)
+	}
+
+	return nil, err
+}
+
+// multicast sends the query to the multicast groups, and passes the responses
+// to it to the receive function, until it returns true or the context is done.
+// Responders answer the query directly to the querier. When mdns is set,
+// responses that are sent to the multicast DNS groups are received as well
+// (when the groups can be joined); they have ID zero, and the cache-flush bit
+// of their resource records is cleared.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6762#section-6.7
+// See: https://datatracker.ietf.org/doc/html/rfc4795#section-2.4
+func (c *Client) multicast(
+	ctx context.Context,
+	query *dns.Msg,
+	groups []*net.UDPAddr,
+	mdns bool,
+	receive func(resp *dns.Msg, from net.IP) bool,
+) error {
+	queryb, err := query.Pack()
+	if err != nil {
+		return fmt.Errorf("failed to pack dns query: %w", err)
+	}
+
+	// The receivers stop when the responses are no longer needed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conns := []net.PacketConn{}
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	sent := 0
+	for _, group := range groups {
+		network := "udp4"
+		if group.IP.To4() == nil {
+			network = "udp6"
+		}
+		if (network == "udp4" && c.ipPreference == IPv6Only) ||
+			(network == "udp6" && c.ipPreference == IPv4Only) {
+			continue
+		}
+
+		if mdns {
+			if conn, err := net.ListenMulticastUDP(network, nil, group); err == nil {
+				conns = append(conns, conn)
+			}
+		}
+		conn, err := net.ListenPacket(network, ":0")
+		if err != nil {
+			continue
+		}
+		conns = append(conns, conn)
+		if _, err := conn.WriteTo(queryb, group); err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return fmt.Errorf("failed to send multicast query to %v", groups)
+	}
+
+	type received struct {
+		msg  *dns.Msg
+		from net.IP
+	}
+	resps := make(chan received)
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			buf := make([]byte, 65535)
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				m := new(dns.Msg)
+				if _, err := m.Unpack(buf[:n]); err != nil || m.QR == 0 {
+					continue
+				}
+
+				// Responses to the query echo its ID; responses sent to the
+				// multicast DNS groups have ID zero.
+				if m.ID != query.ID && !(mdns && m.ID == 0) {
+					continue
+				}
+				if mdns {
+					for _, rrs := range [][]dns.RR{m.Answer, m.Authority, m.Additional} {
+						for i := range rrs {
+							if rrs[i].Type != dns.TypeOPT {
+								rrs[i].Class &^= cacheFlush
+							}
+						}
+					}
+				}
+
+				var from net.IP
+				if udpAddr, ok := addr.(*net.UDPAddr); ok {
+					from = udpAddr.IP
+				}
+				select {
+				case resps <- received{msg: m, from: from}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(conn)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-resps:
+			if receive(r.msg, r.from) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// mdnsResponder answers multicast DNS queries with the resource records of its
+// names (which have the cache-flush bit set), like responders on the local link
+// answer one-shot queries.
+func mdnsResponder(t *testing.T, rrs []dns.RR, additional []dns.RR) *net.UDPAddr {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := new(dns.Msg)
+			if _, err := q.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			resp := *q
+			resp.QR, resp.AA = 1, 1
+			for _, rr := range rrs {
+				if strings.EqualFold(rr.Name, q.Question.QName) && rr.Type == q.Question.QType {
+					rr.Class |= cacheFlush
+					resp.Answer = append(resp.Answer, rr)
+				}
+			}
+			if len(resp.Answer) == 0 {
+				continue
+			}
+			if q.Question.QType == dns.TypePTR {
+				resp.Additional = additional
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			pc.WriteTo(b, addr)
+		}
+	}()
+
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+// newMDNSClient creates a client that sends multicast DNS queries to the
+// responder.
+func newMDNSClient(responder *net.UDPAddr) *Client {
+	c := NewClient(WithTimeout(200*time.Millisecond), WithCache(nil))
+	c.mdnsGroups = []*net.UDPAddr{responder}
+
+	return c
+}
+
+func TestResolveMDNS(t *testing.T) {
+	responder := mdnsResponder(t, []dns.RR{testRR("printer.local.", 120)}, nil)
+	c := newMDNSClient(responder)
+
+	r, err := c.ResolveContext(context.Background(), "Printer.local", dns.TypeA)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if len(r.Answer) != 1 || r.Answer[0].Class != dns.ClassIN {
+		t.Errorf("answer error: got %v", r.Answer)
+	}
+	if !r.Server.Equal(responder.IP) {
+		t.Errorf("server error: got %v - want %v", r.Server, responder.IP)
+	}
+
+	if _, err := c.ResolveContext(context.Background(), "scanner.local.", dns.TypeA); err == nil {
+		t.Error("got no error for a name without responders")
+	}
+}
@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Notify notifies the name server that the zone changed, so it refreshes the
+// zone right away instead of waiting for the refresh interval (i.e. a primary
+// notifies a secondary). The SOA resource record of the new version of the zone
+// may be included as a hint. The server is an IP address or "host:port" (the
+// port defaults to 53). The NOTIFY message is retransmitted with backoff until
+// the name server responds, at most the number of client retries.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1996#section-3
+func (c *Client) Notify(ctx context.Context, zone string, server string, soa *dns.RR) error {
+	query := new(dns.Msg)
+	if err := query.SetQuery(dns.Fqdn(zone), dns.TypeSOA); err != nil {
+		return fmt.Errorf("failed to set dns query: %v", err)
+	}
+	query.OpCode = dns.OpCodeNotify
+	query.AA = 1
+	query.RD = 0
+	if soa != nil {
+		query.Answer = []dns.RR{*soa}
+	}
+
+	// Retransmissions use the same message ID, so the name server can detect
+	// duplicates.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1996#section-3.6
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.ExchangeContext(ctx, query, server)
+		if err == nil {
+			switch {
+			case resp.OpCode != dns.OpCodeNotify:
+				return fmt.Errorf("name server %s: response opcode %s to NOTIFY", server, resp.OpCode)
+			case resp.RCode == dns.RCodeRefused:
+				return fmt.Errorf("name server %s: %w", server, ErrRefused)
+			case resp.RCode != dns.RCodeNoError:
+				return fmt.Errorf("name server %s: NOTIFY failed: %s", server, resp.RCode)
+			}
+			return nil
+		}
+		if attempt >= c.retries || ctx.Err() != nil {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+		if backoff > c.timeout {
+			backoff = c.timeout
+		}
+	}
+}
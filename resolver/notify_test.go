@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// notifyTransport records the NOTIFY messages it receives; it drops the first
+// drop messages, and responds to the others with the rcode.
+type notifyTransport struct {
+	mu       sync.Mutex
+	queries  []*dns.Msg
+	drop     int
+	rcode    dns.RCode
+	noNotify bool
+}
+
+func (t *notifyTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queries = append(t.queries, query)
+	if len(t.queries) <= t.drop {
+		return nil, &net.OpError{Op: "read", Err: context.DeadlineExceeded}
+	}
+	resp := *query
+	resp.QR = 1
+	resp.RCode = t.rcode
+	resp.Answer = nil
+	if t.noNotify {
+		resp.OpCode = dns.OpCodeQuery
+	}
+
+	return &resp, nil
+}
+
+func TestNotify(t *testing.T) {
+	soa := testSOA(t, 2)
+	tr := &notifyTransport{drop: 1}
+	c := NewClient(WithTransport(tr), WithBackoff(time.Millisecond))
+	if err := c.Notify(context.Background(), "example.org", "192.0.2.1", &soa); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if len(tr.queries) != 2 {
+		t.Fatalf("got %d NOTIFY messages, want 2", len(tr.queries))
+	}
+	q := tr.queries[1]
+	if q.OpCode != dns.OpCodeNotify || q.AA != 1 || q.RD != 0 {
+		t.Errorf("got opcode %s (aa %d, rd %d), want NOTIFY (aa 1, rd 0)", q.OpCode, q.AA, q.RD)
+	}
+	if q.Question.QName != "example.org." || q.Question.QType != dns.TypeSOA {
+		t.Errorf("got question %s, want example.org. SOA", q.Question.String())
+	}
+	if len(q.Answer) != 1 || q.Answer[0].Type != dns.TypeSOA {
+		t.Errorf("got answer %v, want the SOA record", q.Answer)
+	}
+	if tr.queries[0].ID != q.ID {
+		t.Errorf("retransmission has ID %d, want %d", q.ID, tr.queries[0].ID)
+	}
+}
+
+func TestNotifyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tr   *notifyTransport
+	}{
+		{"refused", &notifyTransport{rcode: dns.RCodeRefused}},
+		{"not implemented", &notifyTransport{rcode: dns.RCodeNotImplemented}},
+		{"no NOTIFY response", &notifyTransport{noNotify: true}},
+		{"no response", &notifyTransport{drop: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(WithTransport(tt.tr), WithBackoff(time.Millisecond))
+			err := c.Notify(context.Background(), "example.org.", "192.0.2.1", nil)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if tt.tr.rcode == dns.RCodeRefused && !errors.Is(err, ErrRefused) {
+				t.Errorf("got error %v, want ErrRefused", err)
+			}
+		})
+	}
+}
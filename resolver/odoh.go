@@ -0,0 +1,333 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Oblivious DNS over HTTPS (ODoH) encrypts queries to a target resolver with
+// its public (HPKE) key, and sends them through an oblivious proxy: the proxy
+// sees the address of the client but not the queries, and the target sees the
+// queries but not the address of the client.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9230
+
+// odohMessageType is the media type of an ODoH message.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9230#section-4.1
+const odohMessageType = "application/oblivious-dns-message"
+
+// odohConfigsPath is the well-known path of the ODoH configurations of a
+// target.
+const odohConfigsPath = "/.well-known/odohconfigs"
+
+// odohConfigVersion is the version of the ODoH configurations that are
+// supported.
+const odohConfigVersion = 0x0001
+
+// ODoH message types.
+const (
+	odohQuery    = 0x01
+	odohResponse = 0x02
+)
+
+// NewODoHTransport creates a transport that sends queries over Oblivious DNS
+// over HTTPS with the HTTP client. The address is the URL of the DNS API
+// endpoint of the target (e.g. "https://odoh.example/dns-query"); queries are
+// posted to the proxy, which is the URL of the oblivious proxy (e.g.
+// "https://proxy.example/proxy"), with the target in the "targethost" and
+// "targetpath" query parameters. The public key of a target is fetched from its
+// well-known ODoH configurations, and is refreshed when the target rejects a
+// query.
+func NewODoHTransport(client *http.Client, proxy string) Transport {
+	return &odohTransport{client: client, proxy: proxy, configs: map[string]*odohConfig{}}
+}
+
+// odohTransport sends queries over Oblivious DNS over HTTPS.
+type odohTransport struct {
+	client *http.Client
+	proxy  string
+
+	mu      sync.Mutex
+	configs map[string]*odohConfig // by target host
+}
+
+// encrypted is always true; queries are encrypted to the target.
+func (t *odohTransport) encrypted() bool {
+	return true
+}
+
+// odohConfig is an ODoH configuration of a target: its HPKE suite and public
+// key.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9230#section-6.1
+type odohConfig struct {
+	suite     hpkeSuite
+	publicKey []byte
+	keyID     []byte
+}
+
+// parseODoHConfigs parses the ODoH configurations, and returns the first one
+// with a supported version and HPKE suite.
+func parseODoHConfigs(b []byte) (*odohConfig, error) {
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return nil, fmt.Errorf("invalid odoh configs length")
+	}
+	b = b[2:]
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("invalid odoh config")
+		}
+		version := binary.BigEndian.Uint16(b)
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return nil, fmt.Errorf("invalid odoh config length")
+		}
+		contents := b[4 : 4+n]
+		b = b[4+n:]
+		if version != odohConfigVersion || len(contents) < 8 {
+			continue
+		}
+
+		suite := hpkeSuite{
+			kem:  hpkeKEM(binary.BigEndian.Uint16(contents)),
+			kdf:  hpkeKDF(binary.BigEndian.Uint16(contents[2:])),
+			aead: hpkeAEAD(binary.BigEndian.Uint16(contents[4:])),
+		}
+		keyLen := int(binary.BigEndian.Uint16(contents[6:]))
+		if suite.validate() != nil || keyLen == 0 || len(contents) != 8+keyLen {
+			continue
+		}
+
+		// The key ID is derived from the contents of the configuration.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc9230#section-6.2
+		h := suite.hash()
+		keyID := expand(h, extract(h, nil, contents), []byte("odoh key id"), h.Size())
+		return &odohConfig{suite: suite, publicKey: contents[8:], keyID: keyID}, nil
+	}
+
+	return nil, fmt.Errorf("no odoh config with a supported version and hpke suite")
+}
+
+// appendOpaque appends the data with its 2 byte length.
+func appendOpaque(b, data []byte) []byte {
+	b = append(b, byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
+
+// Exchange encrypts the query to the target at the URL, posts it to the
+// proxy, and decrypts the response.
+func (t *odohTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	target string,
+) (*dns.Msg, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid odoh target %q", target)
+	}
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns query: %w", err)
+	}
+	config, err := t.config(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	// The plaintext holds the query without padding; it's padded with the
+	// EDNS Padding option instead.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc9230#section-6.3
+	plain := appendOpaque(appendOpaque(nil, queryb), nil)
+	enc, hctx, err := setupBaseS(config.suite, config.publicKey, []byte("odoh query"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt dns query: %v", err)
+	}
+	aad := appendOpaque([]byte{odohQuery}, config.keyID)
+	msg := appendOpaque(aad, append(enc, hctx.seal(aad, plain)...))
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	proxy, err := url.Parse(t.proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid odoh proxy %q", t.proxy)
+	}
+	params := proxy.Query()
+	params.Set("targethost", u.Host)
+	params.Set("targetpath", path)
+	proxy.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, proxy.String(), bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", t.proxy, err)
+	}
+	req.Header.Set("Content-Type", odohMessageType)
+	req.Header.Set("Accept", odohMessageType)
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send dns query: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// The target may have rotated its key, so the configuration is
+		// fetched again for the next query.
+		t.mu.Lock()
+		delete(t.configs, u.Host)
+		t.mu.Unlock()
+		return nil, fmt.Errorf("unexpected http status %q from %s", res.Status, t.proxy)
+	}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != odohMessageType {
+		return nil, fmt.Errorf("unexpected content type %q from %s", mt, t.proxy)
+	}
+
+	// An ODoH message holds an encrypted DNS message, which is at most 65535
+	// bytes long.
+	b, err := io.ReadAll(io.LimitReader(res.Body, 2*65535))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dns response: %w", err)
+	}
+	respb, err := openODoHResponse(config.suite, hctx, plain, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt dns response: %v", err)
+	}
+
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(respb); err != nil {
+		return nil, fmt.Errorf("failed to unpack dns response: %w", err)
+	}
+	if err := matchResponse(query, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// config returns the ODoH configuration of the target, and fetches it when
+// it isn't known yet.
+func (t *odohTransport) config(ctx context.Context, target *url.URL) (*odohConfig, error) {
+	t.mu.Lock()
+	config, ok := t.configs[target.Host]
+	t.mu.Unlock()
+	if ok {
+		return config, nil
+	}
+
+	configsURL := (&url.URL{Scheme: target.Scheme, Host: target.Host, Path: odohConfigsPath}).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", configsURL, err)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch odoh configs: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected http status %q from %s", res.Status, configsURL)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, 65537))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read odoh configs: %w", err)
+	}
+	if config, err = parseODoHConfigs(b); err != nil {
+		return nil, fmt.Errorf("%v from %s", err, configsURL)
+	}
+
+	t.mu.Lock()
+	t.configs[target.Host] = config
+	t.mu.Unlock()
+
+	return config, nil
+}
+
+// odohResponseKey derives the key and nonce that encrypt the response to the
+// query (the plaintext that was encrypted with the context) from the response
+// nonce.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9230#section-6.4
+func odohResponseKey(suite hpkeSuite, hctx *hpkeContext, plain, nonce []byte) (cipher.AEAD, []byte, error) {
+	h, nk := suite.hash(), suite.keySize()
+	secret := hctx.export([]byte("odoh response"), nk)
+	salt := appendOpaque(append([]byte{}, plain...), nonce)
+	prk := extract(h, salt, secret)
+
+	block, err := aes.NewCipher(expand(h, prk, []byte("odoh key"), nk))
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, expand(h, prk, []byte("odoh nonce"), nonceSize), nil
+}
+
+// openODoHResponse decrypts the ODoH response message to the query, and
+// returns the DNS message it holds.
+func openODoHResponse(suite hpkeSuite, hctx *hpkeContext, plain, msg []byte) ([]byte, error) {
+	if len(msg) < 3 || msg[0] != odohResponse {
+		return nil, fmt.Errorf("invalid odoh response message")
+	}
+	n := int(binary.BigEndian.Uint16(msg[1:]))
+	if len(msg) < 3+n+2 {
+		return nil, fmt.Errorf("invalid odoh response nonce")
+	}
+	nonce := msg[3 : 3+n]
+	ct := msg[3+n+2:]
+	if int(binary.BigEndian.Uint16(msg[3+n:])) != len(ct) {
+		return nil, fmt.Errorf("invalid odoh encrypted message length")
+	}
+
+	aead, aeadNonce, err := odohResponseKey(suite, hctx, plain, nonce)
+	if err != nil {
+		return nil, err
+	}
+	respPlain, err := aead.Open(nil, aeadNonce, ct, msg[:3+n])
+	if err != nil {
+		return nil, err
+	}
+
+	// The plaintext holds the response followed by zero padding.
+	if len(respPlain) < 2 {
+		return nil, fmt.Errorf("invalid odoh plaintext")
+	}
+	m := int(binary.BigEndian.Uint16(respPlain))
+	if len(respPlain) < 2+m+2 {
+		return nil, fmt.Errorf("invalid odoh plaintext length")
+	}
+	padding := respPlain[2+m+2:]
+	if int(binary.BigEndian.Uint16(respPlain[2+m:])) != len(padding) || !isZero(padding) {
+		return nil, fmt.Errorf("invalid odoh plaintext padding")
+	}
+
+	return respPlain[2 : 2+m], nil
+}
+
+// isZero checks if all bytes are zero.
+func isZero(b []byte) bool {
+	var acc byte
+	for _, c := range b {
+		acc |= c
+	}
+
+	return acc == 0
+}
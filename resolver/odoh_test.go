@@ -0,0 +1,198 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// odohTarget is an ODoH target that answers the queries it decrypts with a
+// test resource record.
+type odohTarget struct {
+	suite   hpkeSuite
+	sk      *ecdh.PrivateKey
+	pk      []byte
+	queries int
+}
+
+func newODoHTarget() *odohTarget {
+	sk, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &odohTarget{
+		suite: hpkeSuite{kem: kemX25519, kdf: kdfHKDFSHA256, aead: aeadAES128GCM},
+		sk:    sk,
+		pk:    sk.PublicKey().Bytes(),
+	}
+}
+
+// configs returns the ODoH configurations of the target.
+func (o *odohTarget) configs() []byte {
+	contents := []byte{
+		byte(o.suite.kem >> 8), byte(o.suite.kem),
+		byte(o.suite.kdf >> 8), byte(o.suite.kdf),
+		byte(o.suite.aead >> 8), byte(o.suite.aead),
+	}
+	contents = appendOpaque(contents, o.pk)
+	config := appendOpaque([]byte{0x00, 0x01}, contents)
+	return appendOpaque(nil, config)
+}
+
+func (o *odohTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == odohConfigsPath {
+		w.Write(o.configs())
+		return
+	}
+	if r.URL.Path != "/dns-query" || r.Header.Get("Content-Type") != odohMessageType {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	config, err := parseODoHConfigs(o.configs())
+	if err != nil || len(b) < 3 || b[0] != odohQuery {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	n := int(binary.BigEndian.Uint16(b[1:]))
+	if !bytes.Equal(b[3:3+n], config.keyID) {
+		http.Error(w, "unknown key", http.StatusUnauthorized)
+		return
+	}
+	aad, enc, ct := b[:3+n], b[3+n+2:3+n+2+32], b[3+n+2+32:]
+
+	// Decapsulate the shared secret with the private key.
+	pkE, err := ecdh.X25519().NewPublicKey(enc)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	dh, err := o.sk.ECDH(pkE)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	prk := labeledExtract(crypto.SHA256, kemID(kemX25519), nil, "eae_prk", dh)
+	ss := labeledExpand(crypto.SHA256, kemID(kemX25519), prk, "shared_secret", append(append([]byte{}, enc...), o.pk...), 32)
+	hctx, err := keySchedule(o.suite, ss, []byte("odoh query"))
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	plain, err := hctx.aead.Open(nil, hctx.baseNonce, ct, aad)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	q := new(dns.Msg)
+	if _, err := q.Unpack(plain[2 : 2+binary.BigEndian.Uint16(plain)]); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	o.queries++
+
+	resp := *q
+	resp.QR = 1
+	resp.Additional = nil
+	resp.Answer = []dns.RR{testRR(q.Question.QName, 300)}
+	respb, _ := resp.Pack()
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	aead, aeadNonce, err := odohResponseKey(o.suite, hctx, plain, nonce)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	respPlain := appendOpaque(appendOpaque(nil, respb), make([]byte, 7))
+	respAAD := appendOpaque([]byte{odohResponse}, nonce)
+	w.Header().Set("Content-Type", odohMessageType)
+	w.Write(appendOpaque(respAAD, aead.Seal(nil, aeadNonce, respPlain, respAAD)))
+}
+
+func TestODoHTransport(t *testing.T) {
+	target := newODoHTarget()
+	ts := httptest.NewTLSServer(target)
+	defer ts.Close()
+
+	// The proxy relays the body of the request to the target.
+	relayed := 0
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := "https://" + r.URL.Query().Get("targethost") + r.URL.Query().Get("targetpath")
+		req, _ := http.NewRequest(http.MethodPost, u, r.Body)
+		req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		defer res.Body.Close()
+		relayed++
+		w.Header().Set("Content-Type", res.Header.Get("Content-Type"))
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	tr := NewODoHTransport(ts.Client(), proxy.URL+"/proxy")
+	for i := 0; i < 2; i++ {
+		resp, err := tr.Exchange(ctx, query, ts.URL+"/dns-query")
+		if err != nil {
+			t.Fatalf("failed to exchange: %v", err)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].Name != "example.com." {
+			t.Errorf("answer error: got %v - want 1 answer for example.com.", resp.Answer)
+		}
+	}
+	if target.queries != 2 || relayed != 2 {
+		t.Errorf("relay error: got %d queries (%d relayed) - want 2", target.queries, relayed)
+	}
+
+	// A rotated key is rejected by the target, and fetched again for the next
+	// query.
+	rotated := newODoHTarget()
+	target.sk, target.pk = rotated.sk, rotated.pk
+	if _, err := tr.Exchange(ctx, query, ts.URL+"/dns-query"); err == nil {
+		t.Errorf("expected stale key to fail")
+	}
+	if _, err := tr.Exchange(ctx, query, ts.URL+"/dns-query"); err != nil {
+		t.Errorf("failed to exchange with refreshed key: %v", err)
+	}
+}
+
+func TestParseODoHConfigs(t *testing.T) {
+	target := newODoHTarget()
+	config, err := parseODoHConfigs(target.configs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(config.publicKey, target.pk) || len(config.keyID) != 32 {
+		t.Errorf("config error: got key %x and key id %x", config.publicKey, config.keyID)
+	}
+
+	// ChaCha20-Poly1305 isn't supported.
+	target.suite.aead = 0x0003
+	if _, err := parseODoHConfigs(target.configs()); err == nil {
+		t.Errorf("expected unsupported suite to fail")
+	}
+	if _, err := parseODoHConfigs([]byte{0x00, 0x05, 0x00}); err == nil {
+		t.Errorf("expected invalid length to fail")
+	}
+}
@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// PaddingPolicy determines which queries are padded with the EDNS(0) Padding
+// option, which hides their size (and so the names they're about) from
+// observers of an encrypted transport.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8467
+type PaddingPolicy uint8
+
+// String returns the string representation of a padding policy.
+func (p PaddingPolicy) String() string {
+	return PaddingPolicyToString[p]
+}
+
+const (
+	// PadEncrypted pads the queries that are sent over an encrypted transport
+	// (TLS or HTTPS).
+	PadEncrypted PaddingPolicy = iota
+
+	// PadNever never pads queries.
+	PadNever
+
+	// PadAlways pads all queries that use EDNS(0), including the ones sent over
+	// unencrypted transports (which gains no privacy).
+	PadAlways
+)
+
+// PaddingPolicyToString maps a padding policy to a string.
+var PaddingPolicyToString = map[PaddingPolicy]string{
+	PadEncrypted: "encrypted",
+	PadNever:     "never",
+	PadAlways:    "always",
+}
+
+// encryptedTransport is implemented by the transports that encrypt queries.
+type encryptedTransport interface {
+	encrypted() bool
+}
+
+// encrypted checks if the connections of the TCP transport are TLS
+// connections.
+func (t *tcpTransport) encrypted() bool {
+	_, ok := t.dialer.(*tlsDialer)
+	return ok
+}
+
+// encrypted is always true; HTTPS URLs are the only ones that are supported.
+func (t *httpsTransport) encrypted() bool {
+	return true
+}
+
+// padQuery returns a copy of the query that's padded to the recommended block
+// size, when the padding policy requires it. Queries without EDNS(0) aren't
+// padded.
+func (c *Client) padQuery(query *dns.Msg) (*dns.Msg, error) {
+	if query.OPT() == nil {
+		return query, nil
+	}
+	switch c.padding {
+	case PadNever:
+		return query, nil
+	case PadEncrypted:
+		if t, ok := c.transport.(encryptedTransport); !ok || !t.encrypted() {
+			return query, nil
+		}
+	}
+
+	padded := *query
+	padded.Additional = append([]dns.RR{}, query.Additional...)
+	if err := padded.Pad(dns.PaddingQueryBlockSize); err != nil {
+		return nil, fmt.Errorf("failed to pad dns query: %w", err)
+	}
+
+	return &padded, nil
+}
@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// paddingTransport answers every query with an A resource record, and records
+// the packed size of the queries.
+type paddingTransport struct {
+	secure bool
+	sizes  []int
+}
+
+func (t *paddingTransport) encrypted() bool {
+	return t.secure
+}
+
+func (t *paddingTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	b, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	t.sizes = append(t.sizes, len(b))
+
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+
+	return &resp, nil
+}
+
+func TestPadding(t *testing.T) {
+	tests := []struct {
+		policy  PaddingPolicy
+		secure  bool
+		padded  bool
+		comment string
+	}{
+		{PadEncrypted, true, true, "encrypted transport"},
+		{PadEncrypted, false, false, "unencrypted transport"},
+		{PadNever, true, false, "never"},
+		{PadAlways, false, true, "always"},
+	}
+
+	for _, tt := range tests {
+		tr := &paddingTransport{secure: tt.secure}
+		c := NewClient(
+			WithRootServers(net.ParseIP("192.0.2.53")),
+			WithTransport(tr),
+			WithCache(nil),
+			WithPadding(tt.policy),
+		)
+		if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+			t.Fatalf("%s: failed to resolve: %v", tt.comment, err)
+		}
+
+		query := new(dns.Msg)
+		if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+		query.SetEDNS0(dns.DefaultEDNSUDPSize, false)
+		if _, err := c.Exchange(query, "192.0.2.53"); err != nil {
+			t.Fatalf("%s: failed to exchange: %v", tt.comment, err)
+		}
+		if query.Additional[0].RDLength != 0 {
+			t.Errorf("%s: the query passed to Exchange was changed", tt.comment)
+		}
+
+		for _, size := range tr.sizes {
+			if padded := size%dns.PaddingQueryBlockSize == 0; padded != tt.padded {
+				t.Errorf("%s: got a query of %d bytes, padded %t", tt.comment, size, tt.padded)
+			}
+		}
+	}
+
+	for name, tr := range map[string]Transport{"TLS": TLS, "HTTPS": HTTPS} {
+		if et, ok := tr.(encryptedTransport); !ok || !et.encrypted() {
+			t.Errorf("%s isn't an encrypted transport", name)
+		}
+	}
+	for name, tr := range map[string]Transport{"UDP": UDP, "TCP": TCP} {
+		if et, ok := tr.(encryptedTransport); ok && et.encrypted() {
+			t.Errorf("%s is an encrypted transport", name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// maxIdleUDPConns is the max number of idle sockets that are kept per name
+// server.
+const maxIdleUDPConns = 4
+
+// idleUDPConn is a socket that's kept for reuse.
+type idleUDPConn struct {
+	conn *net.UDPConn
+
+	// since is the time the socket became idle.
+	since time.Time
+}
+
+// udpPool holds idle UDP sockets per name server address, so sockets can be
+// reused across queries instead of opening a new one for every query. Idle
+// sockets are closed after the idle timeout.
+type udpPool struct {
+	// mu guards idle.
+	mu sync.Mutex
+
+	// idle maps a name server address to its idle sockets.
+	idle map[string][]idleUDPConn
+
+	// idleTimeout is the time an idle socket is kept.
+	idleTimeout time.Duration
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// newUDPPool creates an empty udpPool.
+func newUDPPool(idleTimeout time.Duration) *udpPool {
+	return &udpPool{
+		idle:        map[string][]idleUDPConn{},
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+	}
+}
+
+// get takes an idle socket for the name server address from the pool, or opens
+// a new one.
+func (p *udpPool) get(raddr *net.UDPAddr) (*net.UDPConn, error) {
+	p.mu.Lock()
+	p.closeExpired()
+	conns := p.idle[raddr.String()]
+	if len(conns) > 0 {
+		c := conns[len(conns)-1]
+		p.idle[raddr.String()] = conns[:len(conns)-1]
+		p.mu.Unlock()
+		return c.conn, nil
+	}
+	p.mu.Unlock()
+
+	return listenUDP(raddr)
+}
+
+// listenUDP opens a new socket, on a random port chosen by the OS, for
+// queries to the name server address.
+func listenUDP(raddr *net.UDPAddr) (*net.UDPConn, error) {
+	network := "udp6"
+	if raddr.IP.To4() != nil {
+		network = "udp4"
+	}
+
+	return net.ListenUDP(network, nil)
+}
+
+// put returns the socket for the name server address to the pool; it's closed
+// when the pool is full.
+func (p *udpPool) put(raddr *net.UDPAddr, conn *net.UDPConn) {
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeExpired()
+	conns := p.idle[raddr.String()]
+	if len(conns) >= maxIdleUDPConns {
+		conn.Close()
+		return
+	}
+	p.idle[raddr.String()] = append(conns, idleUDPConn{conn: conn, since: p.now()})
+}
+
+// closeExpired closes the sockets that were idle for longer than the idle
+// timeout. The caller must hold mu.
+func (p *udpPool) closeExpired() {
+	now := p.now()
+	for addr, conns := range p.idle {
+		kept := conns[:0]
+		for _, c := range conns {
+			if now.Sub(c.since) >= p.idleTimeout {
+				c.conn.Close()
+				continue
+			}
+			kept = append(kept, c)
+		}
+		if len(kept) == 0 {
+			delete(p.idle, addr)
+			continue
+		}
+		p.idle[addr] = kept
+	}
+}
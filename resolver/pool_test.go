@@ -0,0 +1,40 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPPool(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := newUDPPool(time.Second)
+	p.now = func() time.Time { return now }
+
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+	conn, err := p.get(raddr)
+	if err != nil {
+		t.Fatalf("failed to get socket: %v", err)
+	}
+	p.put(raddr, conn)
+
+	reused, err := p.get(raddr)
+	if err != nil {
+		t.Fatalf("failed to get socket: %v", err)
+	}
+	if reused != conn {
+		t.Errorf("expected idle socket to be reused")
+	}
+	p.put(raddr, reused)
+
+	// Idle sockets are closed after the idle timeout.
+	now = now.Add(time.Second)
+	fresh, err := p.get(raddr)
+	if err != nil {
+		t.Fatalf("failed to get socket: %v", err)
+	}
+	defer fresh.Close()
+	if fresh == conn {
+		t.Errorf("expected expired socket not to be reused")
+	}
+}
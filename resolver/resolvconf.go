@@ -0,0 +1,193 @@
+package resolver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// DefaultResolvConfPath is the path of the system resolver configuration.
+const DefaultResolvConfPath = "/etc/resolv.conf"
+
+// ResolvConf is the system resolver configuration.
+//
+// See: https://man7.org/linux/man-pages/man5/resolv.conf.5.html
+type ResolvConf struct {
+	// Nameservers are the IP addresses of the recursive resolvers.
+	Nameservers []net.IP
+
+	// Search are the domains used to expand relative names (see NameList).
+	Search []string
+
+	// NDots is the min number of dots a relative name must have to be tried
+	// as-is before it's expanded with the search domains.
+	NDots int
+
+	// Timeout is the time to wait for a response from a recursive resolver.
+	Timeout time.Duration
+
+	// Attempts is the number of times a query is sent before giving up.
+	Attempts int
+}
+
+const (
+	// maxNDots is the max value of the ndots option.
+	maxNDots = 15
+
+	// maxTimeout is the max value of the timeout option in seconds.
+	maxTimeout = 30
+
+	// maxAttempts is the max value of the attempts option.
+	maxAttempts = 5
+)
+
+// ParseResolvConf parses a resolver configuration file. Like the libc
+// resolver, invalid entries are skipped, the local host is used as the
+// recursive resolver when none are configured, and the last "domain" or
+// "search" entry determines the search domains. When neither is configured,
+// the domain of the host name is used as the search domain.
+func ParseResolvConf(r io.Reader) (*ResolvConf, error) {
+	conf := &ResolvConf{
+		NDots:    1,
+		Timeout:  time.Second * 5,
+		Attempts: 2,
+	}
+	hasSearch := false
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if ip := net.ParseIP(fields[1]); ip != nil {
+				conf.Nameservers = append(conf.Nameservers, ip)
+			}
+		case "domain":
+			conf.Search = []string{dns.Fqdn(fields[1])}
+			hasSearch = true
+		case "search":
+			conf.Search = []string{}
+			for _, domain := range fields[1:] {
+				conf.Search = append(conf.Search, dns.Fqdn(domain))
+			}
+			hasSearch = true
+		case "options":
+			for _, opt := range fields[1:] {
+				conf.parseOption(opt)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read resolver configuration: %v", err)
+	}
+
+	if len(conf.Nameservers) == 0 {
+		conf.Nameservers = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+	if !hasSearch {
+		if host, err := os.Hostname(); err == nil {
+			if parent := dns.ParentDomainName(host); parent != "." {
+				conf.Search = []string{parent}
+			}
+		}
+	}
+
+	return conf, nil
+}
+
+// parseOption parses an option (formatted as `<name>:<value>`); unknown and
+// invalid options are skipped.
+func (conf *ResolvConf) parseOption(opt string) {
+	name, value := opt, ""
+	if i := strings.IndexByte(opt, ':'); i >= 0 {
+		name, value = opt[:i], opt[i+1:]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return
+	}
+
+	switch name {
+	case "ndots":
+		if n > maxNDots {
+			n = maxNDots
+		}
+		conf.NDots = n
+	case "timeout":
+		if n < 1 {
+			n = 1
+		}
+		if n > maxTimeout {
+			n = maxTimeout
+		}
+		conf.Timeout = time.Duration(n) * time.Second
+	case "attempts":
+		if n < 1 {
+			n = 1
+		}
+		if n > maxAttempts {
+			n = maxAttempts
+		}
+		conf.Attempts = n
+	}
+}
+
+// NameList returns the names that are tried, in order, to resolve the name.
+// An absolute name (i.e. with a trailing dot) is only tried as-is. A relative
+// name with at least NDots dots is tried as-is first, and then expanded with
+// every search domain; otherwise it's tried as-is last.
+func (conf *ResolvConf) NameList(name string) []string {
+	return searchNames(name, conf.Search, conf.NDots)
+}
+
+// searchNames returns the names that are tried, in order, to resolve the name
+// using the search domains.
+func searchNames(name string, search []string, ndots int) []string {
+	if dns.IsFqdn(name) {
+		return []string{name}
+	}
+
+	names := []string{}
+	asIs := strings.Count(name, ".") >= ndots
+	if asIs {
+		names = append(names, name+".")
+	}
+	for _, domain := range search {
+		// The root domain is covered by trying the name as-is.
+		if domain == "." {
+			continue
+		}
+		names = append(names, name+"."+dns.Fqdn(domain))
+	}
+	if !asIs {
+		names = append(names, name+".")
+	}
+
+	return names
+}
+
+// LoadResolvConf reads and parses a resolver configuration file.
+func LoadResolvConf(path string) (*ResolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseResolvConf(f)
+}
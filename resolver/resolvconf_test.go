@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader(`# Generated by NetworkManager
+nameserver 192.0.2.1 ; primary
+nameserver fe80::1%eth0
+nameserver 2001:db8::1
+`))
+	if err != nil {
+		t.Fatalf("failed to parse resolver configuration: %v", err)
+	}
+
+	want := []string{"192.0.2.1", "2001:db8::1"}
+	if len(conf.Nameservers) != len(want) {
+		t.Fatalf("got %v, want %v", conf.Nameservers, want)
+	}
+	for i, ip := range conf.Nameservers {
+		if ip.String() != want[i] {
+			t.Errorf("name server %d: got %s, want %s", i, ip, want[i])
+		}
+	}
+}
+
+func TestParseResolvConfDefault(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("failed to parse resolver configuration: %v", err)
+	}
+
+	if len(conf.Nameservers) != 2 || !conf.Nameservers[0].IsLoopback() {
+		t.Errorf("expected local host name servers, got %v", conf.Nameservers)
+	}
+}
+
+func TestParseResolvConfOptions(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader(`domain corp.example.
+search example.com example.org
+options ndots:2 timeout:60 attempts:3 rotate
+`))
+	if err != nil {
+		t.Fatalf("failed to parse resolver configuration: %v", err)
+	}
+
+	if want := []string{"example.com.", "example.org."}; !reflect.DeepEqual(conf.Search, want) {
+		t.Errorf("got search %v, want %v", conf.Search, want)
+	}
+	if conf.NDots != 2 {
+		t.Errorf("got ndots %d, want 2", conf.NDots)
+	}
+	if conf.Timeout != 30*time.Second {
+		t.Errorf("got timeout %s, want 30s", conf.Timeout)
+	}
+	if conf.Attempts != 3 {
+		t.Errorf("got attempts %d, want 3", conf.Attempts)
+	}
+}
+
+func TestResolvConfNameList(t *testing.T) {
+	conf := &ResolvConf{Search: []string{"example.com.", "example.org."}, NDots: 1}
+
+	tests := map[string][]string{
+		"www.example.net.": {"www.example.net."},
+		"www.example.net":  {"www.example.net.", "www.example.net.example.com.", "www.example.net.example.org."},
+		"www":              {"www.example.com.", "www.example.org.", "www."},
+	}
+
+	for name, want := range tests {
+		if got := conf.NameList(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,978 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// response is a response from a name server.
+type response struct {
+	*dns.Msg
+
+	// server is the IP address of the name server that sent the response; it's
+	// nil when the response was created from the cache.
+	server net.IP
+
+	// rtt is the round-trip time of the query.
+	rtt time.Duration
+}
+
+// maxCNAMEChain is the max number of CNAME resource records that are followed
+// to resolve a name.
+const maxCNAMEChain = 8
+
+// Resolve resolves a domain name to the resource records of the type.
+func (c *Client) Resolve(name string, qt dns.QType) (*Result, error) {
+	return c.ResolveContext(context.Background(), name, qt)
+}
+
+// ResolveContext resolves a domain name to the resource records of the type.
+// The context can be used to cancel the resolution, or to enforce a deadline.
+func (c *Client) ResolveContext(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+) (*Result, error) {
+	ctx, cancel := c.withBudget(ctx)
+	defer cancel()
+	c.counters.resolutions.Add(1)
+	ctx, span := c.startSpan(
+		ctx, "resolve",
+		Attribute{AttrName, name}, Attribute{AttrQType, qt.String()},
+	)
+
+	name, msg, err := c.resolveSearch(ctx, name, qt, false)
+	if err != nil {
+		err = timeoutError(err)
+		endSpan(span, nil, err)
+		return nil, err
+	}
+	endSpan(span, msg.Msg, nil)
+
+	// When an answer can be retrieved, resolving is done.
+	if len(msg.Answer) > 0 {
+		return newResult(name, qt, msg), nil
+	}
+
+	return nil, rcodeError(name, qt, msg.Msg)
+}
+
+// Query resolves a domain name to the resource records of the type, and
+// returns the final response (with the CNAME chain prepended to its answer)
+// like a recursive resolver answers its clients: negative answers (NXDOMAIN
+// and NODATA, with the SOA resource record of the zone in the authority
+// section) are responses, not errors. The name is never expanded with search
+// domains. When dnssec is set, DNSSEC resource records are requested as well,
+// but they're not validated. An internationalized name is resolved as A-labels
+// (see dns.ToASCII).
+func (c *Client) Query(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (*dns.Msg, error) {
+	ctx, cancel := c.withBudget(ctx)
+	defer cancel()
+	c.counters.resolutions.Add(1)
+	ctx, span := c.startSpan(
+		ctx, "resolve",
+		Attribute{AttrName, name}, Attribute{AttrQType, qt.String()},
+	)
+
+	name, err := dns.ToASCII(name)
+	if err != nil {
+		endSpan(span, nil, err)
+		return nil, err
+	}
+	resp, err := c.resolve(ctx, dns.Fqdn(name), qt, dnssec, 0)
+	if err != nil {
+		err = timeoutError(err)
+		endSpan(span, nil, err)
+		return nil, err
+	}
+	endSpan(span, resp.Msg, nil)
+
+	// The response may be shared (see flightGroup) or cached, so it's copied.
+	msg := *resp.Msg
+	msg.Answer = append([]dns.RR{}, msg.Answer...)
+	msg.Authority = append([]dns.RR{}, msg.Authority...)
+	msg.Additional = append([]dns.RR{}, msg.Additional...)
+
+	return &msg, nil
+}
+
+// resolveSearch resolves the name, which is expanded with the search domains
+// when it's relative (and search domains are configured). The expanded names
+// are tried in order until one has an answer; the last response is returned
+// when none has. The name that was resolved is returned alongside the
+// response. An internationalized name is resolved as A-labels (see
+// dns.ToASCII).
+func (c *Client) resolveSearch(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (string, *response, error) {
+	name, err := dns.ToASCII(name)
+	if err != nil {
+		return "", nil, err
+	}
+	names := []string{dns.Fqdn(name)}
+	if len(c.search) > 0 {
+		names = searchNames(name, c.search, c.ndots)
+	}
+
+	var msg *response
+	for _, name := range names {
+		msg, err = c.resolve(ctx, name, qt, dnssec, 0)
+		if err == nil && len(msg.Answer) > 0 {
+			return name, msg, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return names[len(names)-1], msg, err
+}
+
+// withBudget bounds the context by the time budget of a single resolution
+// (when configured).
+func (c *Client) withBudget(
+	ctx context.Context,
+) (context.Context, context.CancelFunc) {
+	if c.budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.budget)
+}
+
+// resolve iteratively resolves a domain name, starting at a root name server,
+// and returns the final response. When dnssec is set, DNSSEC resource records
+// are requested as well. The depth is the number of referrals and recursive
+// lookups that were already followed.
+func (c *Client) resolve(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+	depth int,
+) (*response, error) {
+	// Make sure `name` is a Fully Qualified Domain Name (FQDN).
+	name = dns.Fqdn(name)
+
+	msg, err := c.resolveName(ctx, name, qt, dnssec, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.followCNAMEs(ctx, msg, name, qt, dnssec, depth)
+}
+
+// followCNAMEs follows the CNAME chain of the answer to the query for the name
+// and type, until the final target's resource records are found. The response
+// for the final target is returned, with the complete chain prepended to its
+// answer.
+func (c *Client) followCNAMEs(
+	ctx context.Context,
+	msg *response,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+	depth int,
+) (*response, error) {
+	// A CNAME resource record is an answer to an ANY query as well.
+	if qt == dns.TypeCNAME || qt == dns.TypeANY {
+		return msg, nil
+	}
+
+	question := msg.Question
+	seen := map[string]bool{}
+	for i := 0; ; i++ {
+		target, dangling, err := chainTarget(msg.Answer, name, qt)
+		if err != nil {
+			return nil, err
+		}
+		if !dangling {
+			return msg, nil
+		}
+		if i >= maxCNAMEChain {
+			return nil, fmt.Errorf("cname chain of %s exceeds %d", name, maxCNAMEChain)
+		}
+		if seen[strings.ToLower(target)] {
+			return nil, fmt.Errorf("cname loop at %s", target)
+		}
+		seen[strings.ToLower(target)] = true
+
+		next, err := c.resolveName(ctx, target, qt, dnssec, depth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve cname target %s: %w", target, err)
+		}
+
+		// The response is shared (see flightGroup), so it's copied.
+		chained := *next.Msg
+		chained.Question = question
+		chained.Answer = append(append([]dns.RR{}, msg.Answer...), next.Answer...)
+		msg = &response{Msg: &chained, server: next.server, rtt: next.rtt}
+	}
+}
+
+// chainTarget follows the CNAME resource records in the answer, starting at the
+// name, and returns the final target. It's dangling when the answer doesn't
+// contain resource records of the type for the target.
+func chainTarget(answer []dns.RR, name string, qt dns.QType) (string, bool, error) {
+	target := name
+	seen := map[string]bool{strings.ToLower(name): true}
+	for {
+		next := ""
+		for _, rr := range answer {
+			if rr.Type == dns.TypeCNAME && strings.EqualFold(rr.Name, target) {
+				next = rr.RDataUnpacked
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		if seen[strings.ToLower(next)] {
+			return "", false, fmt.Errorf("cname loop at %s", next)
+		}
+		seen[strings.ToLower(next)] = true
+		target = next
+	}
+
+	if target == name {
+		return target, false, nil
+	}
+	for _, rr := range answer {
+		if rr.Type == qt && strings.EqualFold(rr.Name, target) {
+			return target, false, nil
+		}
+	}
+
+	return target, true, nil
+}
+
+// resolveName resolves a fully qualified domain name without following CNAME
+// chains, and returns the final response.
+func (c *Client) resolveName(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+	depth int,
+) (*response, error) {
+	// Answer from the cache when possible, which prevents walking the name space
+	// from the root.
+	if msg, ok := c.cached(name, qt, dnssec); ok {
+		return msg, nil
+	}
+
+	// Link-local names aren't part of the global name space; they're resolved
+	// on the local link with multicast DNS.
+	if isLocalName(name) {
+		return c.resolveMDNS(ctx, name, qt)
+	}
+
+	// Concurrent resolutions of the same name and type share one resolution.
+	// Lookups that are part of a resolution (e.g. of name servers without glue)
+	// are not shared, because a resolution could end up waiting for itself.
+	if depth > 0 {
+		return c.iterate(ctx, name, qt, dnssec, depth)
+	}
+	key := flightKey{newCacheKey(name, qt, dns.ClassIN), dnssec}
+	msg, err := c.flights.do(ctx, key, func() (*response, error) {
+		return c.iterate(ctx, name, qt, dnssec, depth)
+	})
+
+	// Single-label names that don't exist in DNS (or can't be resolved with
+	// it) are resolved on the local link with LLMNR, when it's enabled. The DNS
+	// result is kept when that fails too.
+	if c.llmnr && isSingleLabel(name) && (err != nil || msg.RCode == dns.RCodeNameError) {
+		if resp, lerr := c.resolveLLMNR(ctx, name, qt); lerr == nil {
+			return resp, nil
+		}
+	}
+
+	return msg, err
+}
+
+// iterate iteratively resolves a fully qualified domain name without
+// consulting the answer cache, and returns the final response.
+func (c *Client) iterate(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+	depth int,
+) (*response, error) {
+	if len(c.stubServers) > 0 {
+		return c.forward(ctx, name, qt, dnssec)
+	}
+
+	// Start at a random root name server, so the load is spread, and any root
+	// name server that doesn't respond is failed over to the next. When the name
+	// servers of a zone that encloses the name are cached, start there instead.
+	zone := "."
+	servers := shuffle(c.getRootServers())
+	if z, ips, ok := c.delegation(name, qt); ok {
+		zone, servers = z, shuffle(ips)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if depth > c.maxDepth {
+			return nil, fmt.Errorf("max depth of %d exceeded", c.maxDepth)
+		}
+
+		msg, err := c.lookup(ctx, zone, servers, name, qt, dnssec)
+		if err != nil {
+			// Prefer a stale answer over no answer at all.
+			if msg, ok := c.stale(name, qt, dnssec); ok {
+				c.counters.staleAnswers.Add(1)
+				c.log(
+					ctx, slog.LevelWarn, "serving stale answer",
+					slog.String("name", name), slog.String("qtype", qt.String()), slog.Any("err", err),
+				)
+				return msg, nil
+			}
+			return nil, fmt.Errorf("failed to lookup name: %w", err)
+		}
+
+		// When an answer can be retrieved, resolving is done.
+		if len(msg.Answer) > 0 {
+			if msg.RCode == dns.RCodeNoError && c.cache != nil {
+				c.cache.Set(name, qt, dns.ClassIN, msg.Answer)
+			}
+			return msg, nil
+		}
+
+		// When the name doesn't exist, resolving is done as well. Name servers that
+		// fail (SERVFAIL), refuse (REFUSED) or don't understand the query (FORMERR)
+		// are already skipped during the lookup, so any other error is final too.
+		if msg.RCode != dns.RCodeNoError {
+			return msg, nil
+		}
+
+		// When the authoritative name server has no records of the requested type,
+		// resolving is done as well.
+		if msg.AA == 1 {
+			return msg, nil
+		}
+
+		depth++
+
+		// A referral must delegate to a zone below the current zone that encloses
+		// the name; otherwise the name servers could refer to each other forever.
+		refZone := getReferralZone(msg.Msg)
+		if refZone == "" {
+			return nil, fmt.Errorf("no answer found")
+		}
+		if !dns.IsSubDomain(zone, refZone) || strings.EqualFold(refZone, zone) ||
+			!dns.IsSubDomain(refZone, name) {
+			return nil, fmt.Errorf(
+				"referral from %s to %s: %w", zone, refZone, ErrDelegationLoop,
+			)
+		}
+
+		// Only glue within the zone of the name server that sent the referral (its
+		// bailiwick) is accepted; otherwise any name server could inject addresses
+		// for names it's not responsible for.
+		_, rrs := getDelegation(msg.Msg, zone)
+		if trace := traceFrom(ctx); trace.Referral != nil {
+			trace.Referral(zone, refZone, getNameServers(msg.Msg), getGlue(rrs))
+		}
+		c.log(
+			ctx, slog.LevelDebug, "following referral",
+			slog.String("name", name), slog.String("from", zone), slog.String("to", refZone),
+		)
+		zone = refZone
+
+		// When there's no answer, use the glue (i.e. additional records with the
+		// name servers' IP addresses) as the name servers to lookup the domain
+		// name.
+		if ips := getAddresses(rrs); len(ips) > 0 {
+			if c.cache != nil {
+				c.cache.SetDelegation(zone, rrs)
+			}
+			servers = ips
+			continue
+		}
+
+		// When there's no (acceptable) glue, use the domain name of an
+		// authoritative name server to _recursively_ get an answer.
+		if name := getAuthority(msg.Msg); name != "" {
+			ip, err := c.resolveAddress(ctx, name, depth)
+			if err != nil {
+				return nil, err
+			}
+
+			// Use the authoritative name server's IP address as the name server to
+			// lookup the domain name.
+			servers = []net.IP{ip}
+			continue
+		}
+
+		return nil, fmt.Errorf("no answer found")
+	}
+}
+
+// forward sends a recursive query to one of the recursive resolvers (in stub
+// mode), and returns the response.
+func (c *Client) forward(
+	ctx context.Context,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (*response, error) {
+	msg, err := c.lookup(ctx, "", c.stubServers, name, qt, dnssec)
+	if err != nil {
+		// Prefer a stale answer over no answer at all.
+		if msg, ok := c.stale(name, qt, dnssec); ok {
+			return msg, nil
+		}
+		return nil, fmt.Errorf("failed to lookup name: %w", err)
+	}
+
+	if len(msg.Answer) > 0 && msg.RCode == dns.RCodeNoError && c.cache != nil {
+		c.cache.Set(name, qt, dns.ClassIN, msg.Answer)
+	}
+
+	return msg, nil
+}
+
+// cached creates a response from the cached answer for the name and type (when
+// caching is enabled). When dnssec is set, the cached answer must contain
+// signatures.
+func (c *Client) cached(
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (*response, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+
+	rrs, remaining, ttl, ok := c.cache.get(newCacheKey(name, qt, dns.ClassIN))
+	if !ok {
+		return nil, false
+	}
+	if dnssec && !hasSignatures(rrs) {
+		return nil, false
+	}
+	c.counters.cacheHits.Add(1)
+
+	// Refresh the answer in the background when it's about to expire, so the
+	// next lookup doesn't have to wait for it.
+	if c.prefetch > 0 && remaining <= ttl*time.Duration(c.prefetch)/100 {
+		c.refresh(name, qt, dnssec)
+	}
+
+	return cachedMsg(name, qt, rrs), true
+}
+
+// refresh resolves the name and type in the background, which updates the
+// cached answer. Only one refresh per name and type runs at a time.
+func (c *Client) refresh(name string, qt dns.QType, dnssec bool) {
+	key := newCacheKey(name, qt, dns.ClassIN)
+
+	c.refreshingMu.Lock()
+	if c.refreshing[key] {
+		c.refreshingMu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.refreshingMu.Unlock()
+
+	go func() {
+		defer func() {
+			c.refreshingMu.Lock()
+			delete(c.refreshing, key)
+			c.refreshingMu.Unlock()
+		}()
+
+		ctx, cancel := c.withBudget(context.Background())
+		defer cancel()
+
+		// Errors are ignored; the cached answer is used until it expires.
+		_, _ = c.iterate(ctx, name, qt, dnssec, 0)
+	}()
+}
+
+// stale creates a response from the cached answer for the name and type, which
+// may have expired at most maxStale ago (when serving stale answers is
+// enabled). When dnssec is set, the cached answer must contain signatures.
+func (c *Client) stale(
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (*response, bool) {
+	if c.cache == nil || c.maxStale <= 0 {
+		return nil, false
+	}
+
+	rrs, ok := c.cache.GetStale(name, qt, dns.ClassIN, c.maxStale)
+	if !ok {
+		return nil, false
+	}
+	if dnssec && !hasSignatures(rrs) {
+		return nil, false
+	}
+
+	return cachedMsg(name, qt, rrs), true
+}
+
+// cachedMsg creates a response with the cached answer.
+func cachedMsg(name string, qt dns.QType, rrs []dns.RR) *response {
+	msg := new(dns.Msg)
+	msg.QR = 1
+	msg.OpCode = dns.OpCodeQuery
+	msg.RCode = dns.RCodeNoError
+	msg.QDCount = 1
+	msg.Question = dns.Question{QName: name, QType: qt, QClass: dns.ClassIN}
+	msg.Answer = rrs
+
+	return &response{Msg: msg}
+}
+
+// delegation gets the closest zone that encloses the name, and its cached name
+// server addresses (when caching is enabled). DS resource records are served
+// by the parent zone, so for those the search starts at the parent.
+func (c *Client) delegation(
+	name string,
+	qt dns.QType,
+) (string, []net.IP, bool) {
+	if c.cache == nil {
+		return "", nil, false
+	}
+
+	if qt == dns.TypeDS {
+		if name = dns.ParentDomainName(name); name == "." {
+			return "", nil, false
+		}
+	}
+
+	return c.cache.Delegation(name)
+}
+
+// hasSignatures checks if any of the resource records is a signature.
+func hasSignatures(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if rr.Type == dns.TypeRRSIG {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveAddress recursively resolves the IP address of a name server, trying
+// the address types in order of the IP preference.
+func (c *Client) resolveAddress(
+	ctx context.Context,
+	name string,
+	depth int,
+) (net.IP, error) {
+	// When the address of the name server is already being resolved, resolving
+	// it again would never end.
+	if resolvingAddress(ctx, name) {
+		return nil, fmt.Errorf("authority %s: %w", name, ErrDelegationLoop)
+	}
+	ctx = withResolvingAddress(ctx, name)
+
+	for _, qt := range c.addressTypes() {
+		msg, err := c.resolve(ctx, name, qt, false, depth)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to recursively resolve authority %s during lookup: %w",
+				name, err,
+			)
+		}
+		if ip := net.ParseIP(getAnswer(msg.Msg)); ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no address found for authority %s", name)
+}
+
+// addressesKey is the context key of the names of the name servers whose
+// addresses are being resolved.
+type addressesKey struct{}
+
+// resolvingAddress checks if the address of the name server is being resolved.
+func resolvingAddress(ctx context.Context, name string) bool {
+	names, _ := ctx.Value(addressesKey{}).([]string)
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withResolvingAddress returns a context that records that the address of the
+// name server is being resolved.
+func withResolvingAddress(ctx context.Context, name string) context.Context {
+	names, _ := ctx.Value(addressesKey{}).([]string)
+	names = append(append([]string{}, names...), name)
+
+	return context.WithValue(ctx, addressesKey{}, names)
+}
+
+// lookup looks up the resource record(s) for the domain name using one of the
+// name servers of the zone (which is empty for recursive resolvers),
+// preferring the fastest healthy name server. When dnssec is set, the DNSSEC
+// OK bit is set to request DNSSEC resource records.
+//
+// A failed query is retried with exponential backoff; when configured, every
+// retry uses the next name server, and every name server is tried at least
+// once. A name server that fails (SERVFAIL) or refuses (REFUSED) the query is
+// always skipped. A name server that doesn't understand the query (FORMERR or
+// NOTIMP) is queried again without EDNS(0), and a name server that doesn't
+// preserve the randomized case of the name is queried again with the name in
+// lower case.
+func (c *Client) lookup(
+	ctx context.Context,
+	zone string,
+	servers []net.IP,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (msg *response, err error) {
+	attrs := []Attribute{{AttrName, name}, {AttrQType, qt.String()}}
+	if zone != "" {
+		attrs = append(attrs, Attribute{AttrZone, zone})
+	}
+	ctx, span := c.startSpan(ctx, "lookup", attrs...)
+	sent := 0
+	defer func() {
+		span.SetAttributes(Attribute{AttrAttempts, sent})
+		if err != nil {
+			endSpan(span, nil, err)
+			return
+		}
+		span.SetAttributes(serverAttrs(msg.server, msg.rtt)...)
+		endSpan(span, msg.Msg, nil)
+	}()
+
+	// Prefer the fastest healthy name servers (of the preferred IP version).
+	servers = c.orderServers(c.stats.sort(servers))
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no name servers")
+	}
+
+	// Randomize the case of the name, which the name server must echo back
+	// exactly; this makes it harder for an off-path attacker to spoof a response.
+	//
+	// See: https://datatracker.ietf.org/doc/html/draft-vixie-dnsext-dns0x20-00
+	qname, err := randomizeCase(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to randomize name case: %v", err)
+	}
+	randomCase := true
+
+	attempts := c.retries + 1
+	if c.switchServers && len(servers) > attempts {
+		attempts = len(servers)
+	}
+
+	// Name servers that don't support EDNS(0) respond with FORMERR; they're
+	// queried without it.
+	edns := true
+
+	trace := traceFrom(ctx)
+	next := 0
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		server := servers[next%len(servers)]
+		if trace.Query != nil {
+			trace.Query(server, name, qt)
+		}
+		attrs := []slog.Attr{
+			slog.String("name", name),
+			slog.String("qtype", qt.String()),
+			slog.String("server", server.String()),
+		}
+		c.log(ctx, slog.LevelDebug, "sending query", append(attrs, slog.Int("attempt", attempt+1))...)
+		addr := net.JoinHostPort(server.String(), "53")
+
+		// Every attempt uses a new message ID.
+		query := new(dns.Msg)
+		if err := query.SetQuery(qname, qt); err != nil {
+			return nil, fmt.Errorf("failed to set dns query: %v", err)
+		}
+
+		// Advertise a larger UDP payload size with EDNS(0), because responses with
+		// DNSSEC resource records rarely fit in 512 bytes.
+		if edns {
+			query.SetEDNS0(dns.DefaultEDNSUDPSize, dnssec)
+			if c.clientSubnet != nil {
+				if err := query.SetClientSubnet(c.clientSubnet); err != nil {
+					return nil, fmt.Errorf("failed to set client subnet: %v", err)
+				}
+			}
+			if query, err = c.padQuery(query); err != nil {
+				return nil, err
+			}
+		}
+
+		// Every attempt has its own timeout, bounded by the deadline of the
+		// resolution (if any).
+		actx, cancel := context.WithTimeout(ctx, c.timeout)
+		actx, espan := c.startSpan(actx, "exchange", Attribute{AttrServer, server.String()})
+		sent++
+		c.counters.queries.Add(1)
+		start := time.Now()
+		resp, err := c.transport.Exchange(actx, query, addr)
+		rtt := time.Since(start)
+		cancel()
+		espan.SetAttributes(serverAttrs(server, rtt)...)
+		endSpan(espan, resp, err)
+		if trace.Response != nil {
+			trace.Response(server, resp, rtt, err)
+		}
+		if errors.Is(err, ErrCaseMismatch) && randomCase {
+			// The name server doesn't preserve the case of the name, so it's queried
+			// again with the name in lower case.
+			c.log(ctx, slog.LevelDebug, "name server changed the name case", attrs...)
+			randomCase = false
+			qname = dns.CanonicalName(name)
+			continue
+		}
+		if err == nil && resp.TC == 1 {
+			err = ErrTruncated
+		}
+
+		// Some response codes mean another name server (or another query) must be
+		// tried.
+		switchServer := c.switchServers
+		if err == nil {
+			switch resp.RCode {
+			case dns.RCodeFormatError, dns.RCodeNotImplemented:
+				if edns {
+					edns = false
+					continue
+				}
+				err = withEDEs(fmt.Errorf(
+					"name server %s: %s", server, strings.ToLower(resp.RCode.String()),
+				), resp)
+			case dns.RCodeServerFailure:
+				err = withEDEs(fmt.Errorf("name server %s: %w", server, ErrServFail), resp)
+				switchServer = true
+			case dns.RCodeRefused:
+				err = withEDEs(fmt.Errorf("name server %s: %w", server, ErrRefused), resp)
+				switchServer = true
+			}
+		}
+		if err == nil {
+			c.log(
+				ctx, slog.LevelDebug, "received response",
+				append(attrs, slog.String("rcode", rcodeName(resp.RCode)), slog.Duration("rtt", rtt))...,
+			)
+			c.stats.success(server, rtt)
+			return &response{Msg: resp, server: server, rtt: rtt}, nil
+		}
+		c.log(ctx, slog.LevelInfo, "query failed", append(attrs, slog.Any("err", err))...)
+		c.stats.failure(server)
+		c.counters.failures.Add(1)
+		err = timeoutError(err)
+		if attempt+1 >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+		if switchServer {
+			next++
+		}
+
+		// Back off before retrying, doubling the wait time after every attempt.
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		backoff *= 2
+		if backoff > c.timeout {
+			backoff = c.timeout
+		}
+	}
+}
+
+// shuffle returns a randomly ordered copy of the IP addresses.
+func shuffle(ips []net.IP) []net.IP {
+	s := append([]net.IP{}, ips...)
+
+	// Fisher-Yates shuffle.
+	for i := len(s) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return s
+		}
+		j := int(n.Int64())
+		s[i], s[j] = s[j], s[i]
+	}
+
+	return s
+}
+
+// randomizeCase randomly changes the case of every letter in the name.
+func randomizeCase(name string) (string, error) {
+	b := []byte(name)
+	rb := make([]byte, len(b))
+	if _, err := rand.Read(rb); err != nil {
+		return "", err
+	}
+
+	for i, c := range b {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter {
+			continue
+		}
+
+		// Flip the 0x20 bit, which is the only bit that differs between an upper-
+		// and lower case letter.
+		if rb[i]&1 == 1 {
+			b[i] ^= 0x20
+		}
+	}
+
+	return string(b), nil
+}
+
+// getAnswer retrieves the first unpacked answer resource record of the type
+// in the question (i.e. the records of the final target of a CNAME chain), or
+// the first unpacked answer resource record when there's none.
+func getAnswer(m *dns.Msg) string {
+	for _, an := range m.Answer {
+		if an.Type == m.Question.QType {
+			return an.RDataUnpacked
+		}
+	}
+
+	for _, an := range m.Answer {
+		if an.Type == dns.TypeRRSIG {
+			continue
+		}
+		return an.RDataUnpacked
+	}
+
+	return ""
+}
+
+// getAuthority retrieves the first unpacked authority name server resource
+// record.
+func getAuthority(m *dns.Msg) string {
+	for _, ns := range m.Authority {
+		if ns.Type != dns.TypeNS {
+			continue
+		}
+		return ns.RDataUnpacked
+	}
+
+	return ""
+}
+
+// getNameServers retrieves the names of all authority name servers.
+func getNameServers(m *dns.Msg) []string {
+	names := []string{}
+	for _, ns := range m.Authority {
+		if ns.Type == dns.TypeNS {
+			names = append(names, ns.RDataUnpacked)
+		}
+	}
+
+	return names
+}
+
+// getGlue retrieves the address resource records of the delegation.
+func getGlue(rrs []dns.RR) []dns.RR {
+	glue := []dns.RR{}
+	for _, rr := range rrs {
+		if rr.Type == dns.TypeA || rr.Type == dns.TypeAAAA {
+			glue = append(glue, rr)
+		}
+	}
+
+	return glue
+}
+
+// getReferralZone retrieves the zone that's delegated by a referral (i.e. the
+// owner name of the first authority name server resource record).
+func getReferralZone(m *dns.Msg) string {
+	for _, ns := range m.Authority {
+		if ns.Type == dns.TypeNS {
+			return ns.Name
+		}
+	}
+
+	return ""
+}
+
+// getDelegation retrieves the zone that's delegated by a referral, and the
+// resource records of the delegation: the NS resource records of the zone, and
+// the additional address resource records of those name servers that are
+// within the bailiwick (i.e. the zone of the name server that sent the
+// referral). No resource records are returned when there's no such glue.
+func getDelegation(m *dns.Msg, bailiwick string) (string, []dns.RR) {
+	zone := ""
+	hosts := map[string]bool{}
+	rrs := []dns.RR{}
+	for _, ns := range m.Authority {
+		if ns.Type != dns.TypeNS {
+			continue
+		}
+		if zone == "" {
+			zone = strings.ToLower(ns.Name)
+		}
+		if !strings.EqualFold(ns.Name, zone) {
+			continue
+		}
+		hosts[strings.ToLower(ns.RDataUnpacked)] = true
+		rrs = append(rrs, ns)
+	}
+
+	hasGlue := false
+	for _, ar := range m.Additional {
+		if ar.Type != dns.TypeA && ar.Type != dns.TypeAAAA {
+			continue
+		}
+		if !hosts[strings.ToLower(ar.Name)] || !dns.IsSubDomain(bailiwick, ar.Name) {
+			continue
+		}
+		hasGlue = true
+		rrs = append(rrs, ar)
+	}
+	if !hasGlue {
+		return zone, nil
+	}
+
+	return zone, rrs
+}
+
+// getAddresses retrieves the IP addresses of the address resource records.
+func getAddresses(rrs []dns.RR) []net.IP {
+	ips := []net.IP{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypeA && rr.Type != dns.TypeAAAA {
+			continue
+		}
+		if ip := net.ParseIP(rr.RDataUnpacked); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
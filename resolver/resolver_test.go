@@ -0,0 +1,986 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// testTransport answers every query authoritatively with an A resource record.
+type testTransport struct {
+	mu      sync.Mutex
+	queries int
+	done    chan struct{}
+}
+
+func (t *testTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.mu.Lock()
+	t.queries++
+	t.mu.Unlock()
+	if t.done != nil {
+		defer func() { t.done <- struct{}{} }()
+	}
+
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Answer = []dns.RR{testRR(query.Question.QName, 100)}
+
+	return &resp, nil
+}
+
+func (t *testTransport) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.queries
+}
+
+func TestResolvePrefetch(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := NewCache(0)
+	cache.now = func() time.Time { return now }
+
+	tr := &testTransport{}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(tr),
+		WithCache(cache),
+		WithPrefetch(10),
+	)
+
+	if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	// Cached answers with more than 10% of their TTL remaining are not
+	// refreshed.
+	now = now.Add(50 * time.Second)
+	if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if got := tr.count(); got != 1 {
+		t.Fatalf("got %d queries, want 1", got)
+	}
+
+	tr.done = make(chan struct{}, 1)
+	now = now.Add(45 * time.Second)
+	if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	select {
+	case <-tr.done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected cached answer to be refreshed")
+	}
+	if got := tr.count(); got != 2 {
+		t.Errorf("got %d queries, want 2", got)
+	}
+}
+
+func TestResolveDeduplication(t *testing.T) {
+	tr := &blockingTransport{release: make(chan struct{})}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(tr),
+		WithCache(nil),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+				t.Errorf("failed to resolve: %v", err)
+			}
+		}()
+	}
+
+	// Give all goroutines time to join the outstanding resolution.
+	time.Sleep(50 * time.Millisecond)
+	close(tr.release)
+	wg.Wait()
+
+	if got := tr.count(); got != 1 {
+		t.Errorf("got %d queries, want 1", got)
+	}
+}
+
+// blockingTransport answers like testTransport, but only after it's released.
+type blockingTransport struct {
+	testTransport
+	release chan struct{}
+}
+
+func (t *blockingTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	<-t.release
+	return t.testTransport.Exchange(ctx, query, addr)
+}
+
+// cnameTransport answers queries for names in the chain with a CNAME resource
+// record of the next name, and queries for the last name with an A resource
+// record.
+type cnameTransport struct {
+	chain []string
+}
+
+func (t *cnameTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+
+	name := strings.ToLower(query.Question.QName)
+	for i, n := range t.chain {
+		if n != name {
+			continue
+		}
+		if i == len(t.chain)-1 {
+			resp.Answer = []dns.RR{testRR(name, 300)}
+			break
+		}
+		cname := testRR(name, 300)
+		cname.Type = dns.TypeCNAME
+		cname.RDataUnpacked = t.chain[i+1]
+		resp.Answer = []dns.RR{cname}
+		break
+	}
+
+	return &resp, nil
+}
+
+func TestResolveCNAMEChain(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(&cnameTransport{
+			chain: []string{"www.example.com.", "cdn.example.net.", "edge.example.org."},
+		}),
+	)
+
+	r, err := c.Resolve("www.example.com", dns.TypeA)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if len(r.Answer) != 1 || r.Answer[0].RDataUnpacked != "192.0.2.1" {
+		t.Errorf("got answer %v, want 192.0.2.1", r.Answer)
+	}
+
+	chain := []string{}
+	for _, rr := range r.CNAMEs {
+		chain = append(chain, rr.Name+" "+rr.RDataUnpacked)
+	}
+	want := []string{
+		"www.example.com. cdn.example.net.",
+		"cdn.example.net. edge.example.org.",
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("got cname chain %v, want %v", chain, want)
+	}
+	if r.Server.String() != "192.0.2.53" {
+		t.Errorf("got server %s, want 192.0.2.53", r.Server)
+	}
+}
+
+func TestResolveANYCNAME(t *testing.T) {
+	tr := &cnameTransport{chain: []string{"www.example.com.", "cdn.example.net."}}
+	c := NewClient(WithRootServers(net.ParseIP("192.0.2.53")), WithTransport(tr))
+
+	// A CNAME resource record answers an ANY query, so it isn't followed.
+	r, err := c.Resolve("www.example.com", dns.TypeANY)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if len(r.Answer) != 1 || r.Answer[0].Type != dns.TypeCNAME || len(r.CNAMEs) != 0 {
+		t.Errorf("got answer %v and cname chain %v, want the cname as answer", r.Answer, r.CNAMEs)
+	}
+}
+
+// nxTransport answers every query authoritatively with NXDOMAIN, and the SOA
+// resource record of the zone.
+type nxTransport struct{}
+
+func (t *nxTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.RCode = dns.RCodeNameError
+	resp.Additional = nil
+
+	soa := testRR("example.com.", 300)
+	soa.Type = dns.TypeSOA
+	resp.Authority = []dns.RR{soa}
+
+	return &resp, nil
+}
+
+func TestQuery(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(&cnameTransport{
+			chain: []string{"www.example.com.", "cdn.example.net."},
+		}),
+	)
+
+	msg, err := c.Query(context.Background(), "www.example.com", dns.TypeA, false)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	answer := []string{}
+	for _, rr := range msg.Answer {
+		answer = append(answer, rr.Name+" "+rr.Type.String())
+	}
+	want := []string{"www.example.com. CNAME", "cdn.example.net. A"}
+	if !reflect.DeepEqual(answer, want) {
+		t.Errorf("got answer %v, want %v", answer, want)
+	}
+
+	// A negative answer isn't an error.
+	c = NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(&nxTransport{}),
+	)
+	msg, err = c.Query(context.Background(), "nope.example.com.", dns.TypeA, false)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if msg.RCode != dns.RCodeNameError || len(msg.Authority) != 1 || msg.Authority[0].Type != dns.TypeSOA {
+		t.Errorf("got %s with authority %v, want NXDOMAIN with SOA", msg.RCode, msg.Authority)
+	}
+}
+
+func TestResolveCNAMELoop(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(&cnameTransport{
+			chain: []string{"a.example.com.", "b.example.com.", "a.example.com.", "c."},
+		}),
+	)
+
+	if _, err := c.Resolve("a.example.com", dns.TypeA); err == nil {
+		t.Errorf("expected cname loop error")
+	}
+}
+
+// rcodeTransport answers every query authoritatively with the response code,
+// or fails with the error. The response has the Extended DNS Error (if any).
+type rcodeTransport struct {
+	rcode dns.RCode
+	tc    byte
+	ede   *dns.EDE
+	err   error
+}
+
+func (t *rcodeTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.TC = t.tc
+	resp.RCode = t.rcode
+	if t.ede != nil {
+		resp.Additional = nil
+		if err := resp.AddEDE(t.ede); err != nil {
+			return nil, err
+		}
+	}
+
+	return &resp, nil
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := map[string]struct {
+		tr   *rcodeTransport
+		want error
+	}{
+		"nxdomain":  {&rcodeTransport{rcode: dns.RCodeNameError}, ErrNXDomain},
+		"nodata":    {&rcodeTransport{rcode: dns.RCodeNoError}, ErrNoData},
+		"servfail":  {&rcodeTransport{rcode: dns.RCodeServerFailure}, ErrServFail},
+		"timeout":   {&rcodeTransport{err: context.DeadlineExceeded}, ErrTimeout},
+		"truncated": {&rcodeTransport{tc: 1}, ErrTruncated},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient(
+				WithRootServers(net.ParseIP("192.0.2.53")),
+				WithTransport(tt.tr),
+				WithRetries(0),
+			)
+
+			_, err := c.Resolve("example.com", dns.TypeA)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveExtendedErrors(t *testing.T) {
+	tests := map[string]struct {
+		tr   *rcodeTransport
+		want error
+		msg  string
+	}{
+		"servfail": {
+			&rcodeTransport{
+				rcode: dns.RCodeServerFailure,
+				ede:   &dns.EDE{InfoCode: dns.EDEDNSSECBogus},
+			},
+			ErrServFail,
+			"name server 192.0.2.53: name server failure (EDE 6 (DNSSEC Bogus))",
+		},
+		"nxdomain": {
+			&rcodeTransport{
+				rcode: dns.RCodeNameError,
+				ede:   &dns.EDE{InfoCode: dns.EDEBlocked, ExtraText: "ads"},
+			},
+			ErrNXDomain,
+			"example.com.: domain name does not exist (EDE 15 (Blocked): (ads))",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient(
+				WithRootServers(net.ParseIP("192.0.2.53")),
+				WithTransport(tt.tr),
+				WithRetries(0),
+			)
+
+			_, err := c.Resolve("example.com", dns.TypeA)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			var eerr *ExtendedError
+			if !errors.As(err, &eerr) || len(eerr.EDEs) != 1 || eerr.EDEs[0] != *tt.tr.ede {
+				t.Fatalf("got error %v, want an extended error", err)
+			}
+			if !strings.HasSuffix(err.Error(), tt.msg) {
+				t.Errorf("got error %q, want suffix %q", err, tt.msg)
+			}
+		})
+	}
+}
+
+// serverTransport answers queries with the response code of the name server,
+// and queries with EDNS(0) with FORMERR when the name server doesn't support
+// it.
+type serverTransport struct {
+	rcodes map[string]dns.RCode
+	noEDNS bool
+}
+
+func (t *serverTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Additional = nil
+	resp.RCode = t.rcodes[addr]
+
+	if t.noEDNS && query.OPT() != nil {
+		resp.RCode = dns.RCodeFormatError
+	}
+	if resp.RCode == dns.RCodeNoError {
+		resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+	}
+
+	return &resp, nil
+}
+
+func TestResolveRCodes(t *testing.T) {
+	tests := map[string]*serverTransport{
+		"servfail": {rcodes: map[string]dns.RCode{
+			"192.0.2.1:53": dns.RCodeServerFailure,
+		}},
+		"refused": {rcodes: map[string]dns.RCode{
+			"192.0.2.1:53": dns.RCodeRefused,
+		}},
+		"formerr": {noEDNS: true},
+	}
+
+	for name, tr := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Even without switching name servers on failures, a name server that
+			// fails or refuses the query is skipped.
+			c := NewClient(
+				WithRootServers(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")),
+				WithTransport(tr),
+				WithServerSwitching(false),
+				WithBackoff(0),
+			)
+
+			if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+				t.Errorf("failed to resolve: %v", err)
+			}
+		})
+	}
+}
+
+// referralTransport answers every query with a referral to the zone, with or
+// without glue.
+type referralTransport struct {
+	zone string
+	glue bool
+}
+
+func (t *referralTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.Additional = nil
+
+	ns := testRR(t.zone, 300)
+	ns.Type = dns.TypeNS
+	ns.RDataUnpacked = "ns." + t.zone
+	resp.Authority = []dns.RR{ns}
+	if t.glue {
+		resp.Additional = []dns.RR{testRR("ns."+t.zone, 300)}
+	}
+
+	return &resp, nil
+}
+
+func TestResolveDelegationLoop(t *testing.T) {
+	tests := map[string]*referralTransport{
+		"referral loop":     {zone: "com.", glue: true},
+		"glueless loop":     {zone: "example.com."},
+		"sideways referral": {zone: "example.org.", glue: true},
+	}
+
+	for name, tr := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient(
+				WithRootServers(net.ParseIP("192.0.2.53")),
+				WithTransport(tr),
+				WithCache(nil),
+			)
+
+			_, err := c.Resolve("www.example.com", dns.TypeA)
+			if !errors.Is(err, ErrDelegationLoop) {
+				t.Errorf("got error %v, want %v", err, ErrDelegationLoop)
+			}
+		})
+	}
+}
+
+// bailiwickTransport refers queries sent to the root name server to the com
+// zone, and queries sent to the com name server to the example.com zone with
+// out of bailiwick glue.
+type bailiwickTransport struct {
+	mu    sync.Mutex
+	addrs map[string]bool
+}
+
+func (t *bailiwickTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.mu.Lock()
+	t.addrs[addr] = true
+	t.mu.Unlock()
+
+	resp := *query
+	resp.QR = 1
+	resp.Additional = nil
+
+	zone, host, glue := "com.", "ns.com.", net.IP{192, 0, 2, 54}
+	if addr == "192.0.2.54:53" {
+		zone, host, glue = "example.com.", "ns.example.org.", net.IP{192, 0, 2, 66}
+	}
+
+	ns := testRR(zone, 300)
+	ns.Type = dns.TypeNS
+	ns.RDataUnpacked = host
+	resp.Authority = []dns.RR{ns}
+
+	a := testRR(host, 300)
+	a.RDataUnpacked = glue.String()
+	resp.Additional = []dns.RR{a}
+
+	return &resp, nil
+}
+
+func TestResolveBailiwick(t *testing.T) {
+	tr := &bailiwickTransport{addrs: map[string]bool{}}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(tr),
+		WithCache(nil),
+	)
+
+	// Resolving the name server of example.com independently fails, because the
+	// root name server refers it to the com zone.
+	if _, err := c.Resolve("www.example.com", dns.TypeA); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if tr.addrs["192.0.2.66:53"] {
+		t.Errorf("expected out of bailiwick glue to be ignored")
+	}
+	if !tr.addrs["192.0.2.54:53"] {
+		t.Errorf("expected in bailiwick glue to be used")
+	}
+}
+
+// ecsTransport answers queries with an ECS option with the scope, for the
+// subnet of the query.
+type ecsTransport struct {
+	scope uint8
+}
+
+func (t *ecsTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	cs, err := query.ClientSubnet()
+	if err != nil || cs == nil {
+		return nil, errors.New("query has no ECS option")
+	}
+
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+	resp.Additional = nil
+	resp.SetEDNS0(dns.DefaultEDNSUDPSize, false)
+	cs.ScopePrefix = t.scope
+	if err := resp.SetClientSubnet(cs); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func TestResolveClientSubnet(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("198.51.100.0/24")
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1")),
+		WithTransport(&ecsTransport{scope: 16}),
+		WithClientSubnet(subnet),
+	)
+
+	r, err := c.Resolve("example.com", dns.TypeA)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	cs, err := r.Response.ClientSubnet()
+	if err != nil || cs == nil {
+		t.Fatalf("failed to get client subnet: %v", err)
+	}
+	if got, want := cs.String(), "198.51.100.0/24/16"; got != want {
+		t.Errorf("got client subnet %s, want %s", got, want)
+	}
+}
+
+func TestRandomizeCase(t *testing.T) {
+	name := "www.example-1.com."
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		got, err := randomizeCase(name)
+		if err != nil {
+			t.Fatalf("failed to randomize case: %v", err)
+		}
+		if !strings.EqualFold(got, name) {
+			t.Fatalf("got %s, want a case variant of %s", got, name)
+		}
+		seen[got] = true
+	}
+
+	// The name has 13 letters, so 10 identical names are practically impossible.
+	if len(seen) == 1 {
+		t.Errorf("got the same case for every name")
+	}
+}
+
+// udpPortTransport sends every query over UDP to the address, instead of port
+// 53 of the name server.
+type udpPortTransport struct {
+	addr string
+}
+
+func (t *udpPortTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	return UDP.Exchange(ctx, query, t.addr)
+}
+
+func TestResolveCaseFallback(t *testing.T) {
+	// The name server answers with the name in lower case.
+	var mu sync.Mutex
+	qnames := []string{}
+	addr := udpResponder(t, func(query *dns.Msg) []*dns.Msg {
+		mu.Lock()
+		qnames = append(qnames, query.Question.QName)
+		mu.Unlock()
+
+		resp := answer(query)
+		resp.AA = 1
+		resp.Question.QName = strings.ToLower(resp.Question.QName)
+		return []*dns.Msg{resp}
+	})
+
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1")),
+		WithTransport(&udpPortTransport{addr: addr}),
+		WithRetries(0),
+		WithTimeout(time.Second),
+	)
+	if _, err := c.Resolve("www.example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	// The query is sent again without randomizing the case, unless the random
+	// case happened to be all lower case.
+	mu.Lock()
+	defer mu.Unlock()
+	if last := qnames[len(qnames)-1]; last != "www.example.com." {
+		t.Errorf("got last query name %s, want www.example.com.", last)
+	}
+	if len(qnames) > 2 {
+		t.Errorf("got %d queries, want at most 2", len(qnames))
+	}
+}
+
+func TestResolveFormatErrorWithoutQuestion(t *testing.T) {
+	// The name server doesn't support EDNS(0), and responds to queries with it
+	// without echoing the question.
+	var mu sync.Mutex
+	edns := []bool{}
+	addr := udpResponder(t, func(query *dns.Msg) []*dns.Msg {
+		mu.Lock()
+		edns = append(edns, query.OPT() != nil)
+		mu.Unlock()
+
+		if query.OPT() != nil {
+			resp := &dns.Msg{}
+			resp.ID = query.ID
+			resp.QR = 1
+			resp.RCode = dns.RCodeFormatError
+			return []*dns.Msg{resp}
+		}
+		resp := answer(query)
+		resp.AA = 1
+		return []*dns.Msg{resp}
+	})
+
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1")),
+		WithTransport(&udpPortTransport{addr: addr}),
+		WithRetries(0),
+		WithTimeout(time.Second),
+	)
+	if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []bool{true, false}; !reflect.DeepEqual(edns, want) {
+		t.Errorf("got queries with EDNS(0) %v, want %v", edns, want)
+	}
+}
+
+// attemptTransport records the name server address and time of every query,
+// and answers it with the response code of the name server. A query to a name
+// server that's down fails, or blocks until the context is done when block is
+// set.
+type attemptTransport struct {
+	rcodes map[string]dns.RCode
+	down   map[string]bool
+	block  bool
+
+	mu    sync.Mutex
+	addrs []string
+	times []time.Time
+}
+
+func (t *attemptTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.mu.Lock()
+	t.addrs = append(t.addrs, addr)
+	t.times = append(t.times, time.Now())
+	t.mu.Unlock()
+
+	if t.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if t.down == nil || t.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Additional = nil
+	resp.RCode = t.rcodes[addr]
+	if resp.RCode == dns.RCodeNoError {
+		resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+	}
+
+	return &resp, nil
+}
+
+func (t *attemptTransport) attempts() ([]string, []time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string{}, t.addrs...), append([]time.Time{}, t.times...)
+}
+
+func TestLookupBackoff(t *testing.T) {
+	tr := &attemptTransport{}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1")),
+		WithTransport(tr),
+		WithRetries(3),
+		WithBackoff(20*time.Millisecond),
+	)
+	if _, err := c.Resolve("example.com", dns.TypeA); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The wait time is doubled after every retry.
+	addrs, times := tr.attempts()
+	if len(addrs) != 4 {
+		t.Fatalf("got %d attempts, want 4", len(addrs))
+	}
+	for i, want := range []time.Duration{20, 40, 80} {
+		if got := times[i+1].Sub(times[i]); got < want*time.Millisecond {
+			t.Errorf("got wait time %s before retry %d, want at least %dms", got, i+1, want)
+		}
+	}
+}
+
+func TestLookupBudget(t *testing.T) {
+	tr := &attemptTransport{block: true}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")),
+		WithTransport(tr),
+		WithTimeout(5*time.Second),
+		WithRetries(5),
+		WithBudget(50*time.Millisecond),
+	)
+
+	// The budget of the resolution bounds the time of every attempt, and no
+	// more attempts are made once it's spent.
+	start := time.Now()
+	_, err := c.Resolve("example.com", dns.TypeA)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("got resolution time %s, want it bounded by the budget", elapsed)
+	}
+	if addrs, _ := tr.attempts(); len(addrs) != 1 {
+		t.Errorf("got %d attempts, want 1", len(addrs))
+	}
+}
+
+func TestLookupServerSwitching(t *testing.T) {
+	servers := []net.IP{
+		net.ParseIP("192.0.2.1"),
+		net.ParseIP("192.0.2.2"),
+		net.ParseIP("192.0.2.3"),
+	}
+
+	tests := []struct {
+		name      string
+		tr        *attemptTransport
+		switching bool
+		retries   int
+
+		// want is the number of attempts, and the number of name servers they're
+		// sent to.
+		want    int
+		servers int
+	}{
+		{
+			name:      "retry the same name server",
+			tr:        &attemptTransport{},
+			switching: false,
+			retries:   2,
+			want:      3,
+			servers:   1,
+		},
+		{
+			name:      "retry the next name servers",
+			tr:        &attemptTransport{},
+			switching: true,
+			retries:   1,
+			want:      3,
+			servers:   3,
+		},
+		{
+			name: "skip name servers that fail or refuse",
+			tr: &attemptTransport{
+				down: map[string]bool{},
+				rcodes: map[string]dns.RCode{
+					"192.0.2.1:53": dns.RCodeServerFailure,
+					"192.0.2.2:53": dns.RCodeRefused,
+					"192.0.2.3:53": dns.RCodeServerFailure,
+				},
+			},
+			switching: false,
+			retries:   2,
+			want:      3,
+			servers:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(
+				WithRootServers(servers...),
+				WithTransport(tt.tr),
+				WithRetries(tt.retries),
+				WithServerSwitching(tt.switching),
+				WithBackoff(0),
+			)
+			if _, err := c.Resolve("example.com", dns.TypeA); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			addrs, _ := tt.tr.attempts()
+			seen := map[string]bool{}
+			for _, addr := range addrs {
+				seen[addr] = true
+			}
+			if len(addrs) != tt.want || len(seen) != tt.servers {
+				t.Errorf(
+					"got %d attempts to %d name servers, want %d to %d: %v",
+					len(addrs), len(seen), tt.want, tt.servers, addrs,
+				)
+			}
+		})
+	}
+}
+
+func TestLookupServerSwitchingSuccess(t *testing.T) {
+	// Only the last name server answers; the others fail or refuse the query,
+	// and are skipped even without switching name servers on timeouts.
+	tr := &attemptTransport{
+		down: map[string]bool{},
+		rcodes: map[string]dns.RCode{
+			"192.0.2.1:53": dns.RCodeServerFailure,
+			"192.0.2.2:53": dns.RCodeRefused,
+		},
+	}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3")),
+		WithTransport(tr),
+		WithServerSwitching(false),
+		WithBackoff(0),
+	)
+	if _, err := c.Resolve("example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	addrs, _ := tr.attempts()
+	if last := addrs[len(addrs)-1]; last != "192.0.2.3:53" {
+		t.Errorf("got answer from %s, want 192.0.2.3:53", last)
+	}
+	seen := map[string]bool{}
+	for _, addr := range addrs {
+		if seen[addr] {
+			t.Errorf("got repeated query to %s: %v", addr, addrs)
+		}
+		seen[addr] = true
+	}
+}
+
+func TestRootServerFailover(t *testing.T) {
+	roots := map[string]bool{}
+	for _, ip := range defaultRootServers() {
+		roots[net.JoinHostPort(ip.String(), "53")] = true
+	}
+
+	tests := []struct {
+		name string
+
+		// up is the address of the only root name server that answers (if any).
+		up string
+	}{
+		{name: "one root name server answers", up: "202.12.27.33:53"},
+		{name: "no root name server answers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			down := map[string]bool{}
+			for addr := range roots {
+				down[addr] = addr != tt.up
+			}
+			tr := &attemptTransport{down: down}
+			c := NewClient(WithTransport(tr), WithBackoff(0))
+
+			_, err := c.Resolve("example.com", dns.TypeA)
+			if tt.up != "" && err != nil {
+				t.Fatalf("failed to resolve: %v", err)
+			}
+			if tt.up == "" && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			// Every failed root name server is failed over to the next one, until
+			// one answers or all of them were tried.
+			addrs, _ := tr.attempts()
+			seen := map[string]bool{}
+			for _, addr := range addrs {
+				if !roots[addr] || seen[addr] {
+					t.Fatalf("got query to %s, want a root name server that wasn't tried: %v", addr, addrs)
+				}
+				seen[addr] = true
+			}
+			if tt.up == "" && len(addrs) != len(roots) {
+				t.Errorf("got %d attempts, want %d", len(addrs), len(roots))
+			}
+			if last := addrs[len(addrs)-1]; tt.up != "" && last != tt.up {
+				t.Errorf("got last query to %s, want %s", last, tt.up)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Result is the result of resolving a domain name.
+type Result struct {
+	// Name is the fully qualified domain name that was resolved; it differs from
+	// the requested name when that was expanded with a search domain.
+	Name string
+
+	// Type is the requested resource record type.
+	Type dns.Type
+
+	// Answer holds the answer resource records that are not part of the CNAME
+	// chain, i.e. those of the final target (including signatures when DNSSEC
+	// resource records were requested).
+	Answer []dns.RR
+
+	// CNAMEs is the CNAME chain that was followed from the name to the final
+	// target, in order.
+	CNAMEs []dns.RR
+
+	// Server is the IP address of the name server that sent the final response;
+	// it's nil when the final response was served from the cache.
+	Server net.IP
+
+	// RCode is the response code of the final response.
+	RCode dns.RCode
+
+	// RTT is the round-trip time of the final query.
+	RTT time.Duration
+
+	// Response is the final response, with the complete CNAME chain prepended to
+	// its answer. It's synthesized when the answer was served from the cache.
+	Response *dns.Msg
+}
+
+// newResult creates the result of resolving the name from the final response.
+func newResult(name string, qt dns.QType, resp *response) *Result {
+	r := &Result{
+		Name:     name,
+		Type:     qt,
+		Server:   resp.server,
+		RCode:    resp.RCode,
+		RTT:      resp.rtt,
+		Response: resp.Msg,
+	}
+
+	// Split the CNAME chain (in order) from the other answer resource records.
+	inChain := map[int]bool{}
+	target := name
+	for {
+		next := -1
+		for i, rr := range resp.Answer {
+			if !inChain[i] && rr.Type == dns.TypeCNAME && qt != dns.TypeCNAME && qt != dns.TypeANY &&
+				strings.EqualFold(rr.Name, target) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		inChain[next] = true
+		r.CNAMEs = append(r.CNAMEs, resp.Answer[next])
+		target = resp.Answer[next].RDataUnpacked
+	}
+
+	for i, rr := range resp.Answer {
+		if !inChain[i] {
+			r.Answer = append(r.Answer, rr)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// ParseRootHints parses a root hints file (i.e. `named.root`), and returns the
+// IPv4 and IPv6 addresses of the root name servers.
+//
+// See: https://www.iana.org/domains/root/files
+func ParseRootHints(r io.Reader) ([]net.IP, error) {
+	names := []string{}
+	addrs := map[string][]net.IP{}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// A resource record is formatted as `<owner> [<ttl>] [<class>] <type>
+		// <rdata>`.
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: invalid resource record", n)
+		}
+		owner := strings.ToLower(fields[0])
+		rdata := fields[len(fields)-1]
+		rtype := strings.ToUpper(fields[len(fields)-2])
+
+		switch rtype {
+		case "NS":
+			if owner != "." {
+				return nil, fmt.Errorf("line %d: ns record for %s is not a root hint", n, owner)
+			}
+			names = append(names, strings.ToLower(rdata))
+		case "A":
+			ip := net.ParseIP(rdata)
+			if ip == nil || ip.To4() == nil {
+				return nil, fmt.Errorf("line %d: invalid ipv4 address %q", n, rdata)
+			}
+			addrs[owner] = append(addrs[owner], ip)
+		case "AAAA":
+			ip := net.ParseIP(rdata)
+			if ip == nil || ip.To4() != nil {
+				return nil, fmt.Errorf("line %d: invalid ipv6 address %q", n, rdata)
+			}
+			addrs[owner] = append(addrs[owner], ip)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %s record", n, rtype)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read root hints: %v", err)
+	}
+
+	ips := []net.IP{}
+	for _, name := range names {
+		ips = append(ips, addrs[name]...)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no root name server addresses found")
+	}
+
+	return ips, nil
+}
+
+// Prime sends a priming query for the name servers of the root zone to one of
+// the configured root name servers, and uses the addresses from the response as
+// the root name servers from then on. The configured root name servers are kept
+// when the response has no addresses.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8109
+func (c *Client) Prime(ctx context.Context) error {
+	ctx, cancel := c.withBudget(ctx)
+	defer cancel()
+
+	msg, err := c.lookup(ctx, ".", shuffle(c.getRootServers()), ".", dns.TypeNS, false)
+	if err != nil {
+		return fmt.Errorf("failed to send priming query: %w", err)
+	}
+	if msg.RCode != dns.RCodeNoError {
+		return fmt.Errorf("priming query failed with rcode %s", msg.RCode)
+	}
+
+	names := map[string]bool{}
+	for _, an := range msg.Answer {
+		if an.Type == dns.TypeNS && an.Name == "." {
+			names[strings.ToLower(an.RDataUnpacked)] = true
+		}
+	}
+
+	ips := []net.IP{}
+	for _, ar := range msg.Additional {
+		isAddr := ar.Type == dns.TypeA || ar.Type == dns.TypeAAAA
+		if !isAddr || !names[strings.ToLower(ar.Name)] {
+			continue
+		}
+		if ip := net.ParseIP(ar.RDataUnpacked); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) > 0 {
+		c.setRootServers(ips)
+	}
+
+	return nil
+}
+
+// getRootServers gets the IP addresses of the root name servers.
+func (c *Client) getRootServers() []net.IP {
+	c.rootServersMu.RLock()
+	defer c.rootServersMu.RUnlock()
+
+	return c.rootServers
+}
+
+// setRootServers sets the IP addresses of the root name servers.
+func (c *Client) setRootServers(ips []net.IP) {
+	c.rootServersMu.Lock()
+	defer c.rootServersMu.Unlock()
+
+	c.rootServers = append([]net.IP{}, ips...)
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRootHints = `;       This file holds the information on root name servers needed to
+;       initialize cache of Internet domain name servers
+;
+; FORMERLY NS.INTERNIC.NET
+;
+.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+A.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:ba3e::2:30
+;
+; FORMERLY NS1.ISI.EDU
+;
+.                        3600000      NS    B.ROOT-SERVERS.NET.
+B.ROOT-SERVERS.NET.      3600000      A     170.247.170.2
+B.ROOT-SERVERS.NET.      3600000      AAAA  2801:1b8:10::b
+; End of file`
+
+func TestParseRootHints(t *testing.T) {
+	ips, err := ParseRootHints(strings.NewReader(testRootHints))
+	if err != nil {
+		t.Fatalf("failed to parse root hints: %v", err)
+	}
+
+	want := []string{
+		"198.41.0.4",
+		"2001:503:ba3e::2:30",
+		"170.247.170.2",
+		"2801:1b8:10::b",
+	}
+	if len(ips) != len(want) {
+		t.Fatalf("got %d addresses, want %d", len(ips), len(want))
+	}
+	for i, ip := range ips {
+		if ip.String() != want[i] {
+			t.Errorf("address %d: got %s, want %s", i, ip, want[i])
+		}
+	}
+}
+
+func TestParseRootHintsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "; no records",
+		"invalid record": ". NS",
+		"invalid ipv4":   "A.ROOT-SERVERS.NET. 3600000 A 2001:503:ba3e::2:30",
+		"unexpected":     "A.ROOT-SERVERS.NET. 3600000 MX 10 mail.",
+	}
+
+	for name, hints := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseRootHints(strings.NewReader(hints)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
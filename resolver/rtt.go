@@ -0,0 +1,132 @@
+package resolver
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// unknownRTT is the assumed round-trip time of a name server that wasn't
+	// queried before; it's low enough for new name servers to be tried.
+	unknownRTT = time.Millisecond * 376
+
+	// maxRTT is the max smoothed round-trip time of a name server.
+	maxRTT = time.Second * 120
+
+	// maxFailures is the number of consecutive failures after which a name
+	// server is considered unhealthy.
+	maxFailures = 3
+
+	// unhealthyTimeout is the time an unhealthy name server is avoided, before
+	// it's probed again.
+	unhealthyTimeout = time.Minute
+)
+
+// serverStat holds the statistics of a name server.
+type serverStat struct {
+	// srtt is the smoothed round-trip time.
+	srtt time.Duration
+
+	// failures is the number of consecutive failures.
+	failures int
+
+	// failed is the time of the last failure.
+	failed time.Time
+}
+
+// serverStats tracks the round-trip times and failures of name servers, so the
+// fastest healthy name server can be preferred (like Unbound does).
+type serverStats struct {
+	// mu guards stats.
+	mu sync.Mutex
+
+	// stats maps the IP address of a name server to its statistics.
+	stats map[string]*serverStat
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// newServerStats creates an empty serverStats.
+func newServerStats() *serverStats {
+	return &serverStats{
+		stats: map[string]*serverStat{},
+		now:   time.Now,
+	}
+}
+
+// success records a response from the name server, which was received after
+// the round-trip time.
+func (s *serverStats) success(ip net.IP, rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.stats[ip.String()]
+	if !ok {
+		s.stats[ip.String()] = &serverStat{srtt: rtt}
+		return
+	}
+
+	// Smooth the round-trip time like TCP does.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc6298#section-2
+	st.srtt = (st.srtt*7 + rtt) / 8
+	st.failures = 0
+}
+
+// failure records a failed query to the name server; its round-trip time is
+// backed off.
+func (s *serverStats) failure(ip net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.stats[ip.String()]
+	if !ok {
+		st = &serverStat{srtt: unknownRTT}
+		s.stats[ip.String()] = st
+	}
+
+	st.srtt *= 2
+	if st.srtt > maxRTT {
+		st.srtt = maxRTT
+	}
+	st.failures++
+	st.failed = s.now()
+}
+
+// sort returns a copy of the IP addresses of the name servers, ordered by
+// health and smoothed round-trip time (fastest first). Name servers with the
+// same statistics keep their relative order.
+func (s *serverStats) sort(ips []net.IP) []net.IP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	type score struct {
+		unhealthy bool
+		srtt      time.Duration
+	}
+	scores := make(map[string]score, len(ips))
+	for _, ip := range ips {
+		sc := score{srtt: unknownRTT}
+		if st, ok := s.stats[ip.String()]; ok {
+			sc.srtt = st.srtt
+			sc.unhealthy = st.failures >= maxFailures &&
+				now.Sub(st.failed) < unhealthyTimeout
+		}
+		scores[ip.String()] = sc
+	}
+
+	sorted := append([]net.IP{}, ips...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := scores[sorted[i].String()], scores[sorted[j].String()]
+		if a.unhealthy != b.unhealthy {
+			return !a.unhealthy
+		}
+		return a.srtt < b.srtt
+	})
+
+	return sorted
+}
@@ -0,0 +1,46 @@
+package resolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerStatsSort(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newServerStats()
+	s.now = func() time.Time { return now }
+
+	fast := net.ParseIP("192.0.2.1")
+	slow := net.ParseIP("192.0.2.2")
+	unknown := net.ParseIP("192.0.2.3")
+	failing := net.ParseIP("192.0.2.4")
+
+	s.success(fast, 10*time.Millisecond)
+	s.success(slow, 500*time.Millisecond)
+	s.success(failing, time.Millisecond)
+	for i := 0; i < maxFailures; i++ {
+		s.failure(failing)
+	}
+
+	sorted := func() []string {
+		got := []string{}
+		for _, ip := range s.sort([]net.IP{failing, slow, unknown, fast}) {
+			got = append(got, ip.String())
+		}
+		return got
+	}
+
+	want := []string{"192.0.2.1", "192.0.2.3", "192.0.2.2", "192.0.2.4"}
+	if got := sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// An unhealthy name server is probed again after a while.
+	now = now.Add(unhealthyTimeout)
+	want = []string{"192.0.2.4", "192.0.2.1", "192.0.2.3", "192.0.2.2"}
+	if got := sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
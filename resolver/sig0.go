@@ -0,0 +1,32 @@
+package resolver
+
+import (
+	"crypto"
+	"fmt"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// sig0Key is a key pair that signs messages with SIG(0).
+type sig0Key struct {
+	priv   crypto.Signer
+	key    *dns.DNSKEY
+	signer string
+}
+
+// signSIG0 returns a copy of the query that's signed with the SIG(0) key of
+// the client; without a key (or with a TSIG key), it returns the query.
+func (c *Client) signSIG0(query *dns.Msg) (*dns.Msg, error) {
+	if c.sig0 == nil || c.tsig != nil {
+		return query, nil
+	}
+
+	signed := *query
+	signed.Additional = append([]dns.RR{}, query.Additional...)
+	if err := signed.SignSIG0(c.sig0.priv, c.sig0.key, c.sig0.signer, nil, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign dns query: %w", err)
+	}
+
+	return &signed, nil
+}
@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// sig0Transport verifies that queries are signed with the key; an unsigned
+// query gets a REFUSED response.
+type sig0Transport struct {
+	key *dns.DNSKEY
+}
+
+func (t *sig0Transport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	q, err := unpacked(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := *q
+	resp.QR = 1
+	resp.Additional = nil
+	if err := q.VerifySIG0(t.key, "key.example.org.", nil, time.Now()); err != nil {
+		resp.RCode = dns.RCodeRefused
+	}
+
+	return &resp, nil
+}
+
+func TestExchangeSIG0(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &dns.DNSKEY{Flags: 512, Protocol: 3, Algorithm: dns.AlgorithmED25519, PublicKey: pub}
+
+	query := new(dns.Msg)
+	if err := query.SetUpdate("example.org."); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(WithTransport(&sig0Transport{key: key}), WithSIG0(priv, key, "key.example.org."))
+	resp, err := c.ExchangeContext(context.Background(), query, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if resp.RCode != dns.RCodeNoError {
+		t.Errorf("got rcode %s, want the query to be signed", resp.RCode)
+	}
+	if len(query.Additional) != 0 {
+		t.Error("the query was changed")
+	}
+
+	// A TSIG key takes precedence.
+	c = NewClient(
+		WithTransport(&sig0Transport{key: key}),
+		WithSIG0(priv, key, "key.example.org."),
+		WithTSIG(testTSIGKey),
+	)
+	if _, err := c.ExchangeContext(context.Background(), query, "192.0.2.1"); err == nil {
+		t.Error("got no error for an unsigned response with a TSIG key")
+	}
+}
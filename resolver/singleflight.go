@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+)
+
+// flightKey identifies an outstanding resolution.
+type flightKey struct {
+	cacheKey
+	dnssec bool
+}
+
+// flight is an outstanding resolution.
+type flight struct {
+	// done is closed when the resolution is done.
+	done chan struct{}
+
+	msg *response
+	err error
+}
+
+// flightGroup coalesces concurrent resolutions of the same name and type into
+// one, so a burst of queries for the same name doesn't result in a burst of
+// queries to name servers.
+type flightGroup struct {
+	// mu guards flights.
+	mu sync.Mutex
+
+	// flights are the outstanding resolutions.
+	flights map[flightKey]*flight
+}
+
+// do calls fn when there's no outstanding resolution for the key, and shares
+// its result with all callers that call do for the same key while fn runs. A
+// caller stops waiting when its context is done. The shared response must not
+// be modified.
+func (g *flightGroup) do(
+	ctx context.Context,
+	key flightKey,
+	fn func() (*response, error),
+) (*response, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = map[flightKey]*flight{}
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+
+		select {
+		case <-f.done:
+			return f.msg, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.msg, f.err = fn()
+	close(f.done)
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	return f.msg, f.err
+}
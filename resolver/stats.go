@@ -0,0 +1,52 @@
+package resolver
+
+import "sync/atomic"
+
+// ClientStats are the statistics of a Client.
+type ClientStats struct {
+	// Resolutions is the number of names that were resolved (with Resolve,
+	// Query, or the methods that use them).
+	Resolutions uint64
+
+	// CacheHits is the number of (intermediate) answers that were taken from
+	// the cache instead of resolved.
+	CacheHits uint64
+
+	// Queries is the number of queries that were sent to name servers, and
+	// Failures is the number of them that failed, including SERVFAIL and
+	// REFUSED responses.
+	Queries  uint64
+	Failures uint64
+
+	// StaleAnswers is the number of expired answers that were served, because
+	// no name server responded.
+	StaleAnswers uint64
+
+	// CacheEntries is the number of cached resource record sets.
+	CacheEntries int
+}
+
+// clientCounters count the events of a Client.
+type clientCounters struct {
+	resolutions  atomic.Uint64
+	cacheHits    atomic.Uint64
+	queries      atomic.Uint64
+	failures     atomic.Uint64
+	staleAnswers atomic.Uint64
+}
+
+// Stats returns the statistics of the client.
+func (c *Client) Stats() ClientStats {
+	st := ClientStats{
+		Resolutions:  c.counters.resolutions.Load(),
+		CacheHits:    c.counters.cacheHits.Load(),
+		Queries:      c.counters.queries.Load(),
+		Failures:     c.counters.failures.Load(),
+		StaleAnswers: c.counters.staleAnswers.Load(),
+	}
+	if c.cache != nil {
+		st.CacheEntries = c.cache.Len()
+	}
+
+	return st
+}
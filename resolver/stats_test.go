@@ -0,0 +1,43 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestClientStats(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(delegationTransport{}),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err != nil {
+			t.Fatalf("failed to resolve: %v", err)
+		}
+	}
+
+	// The second resolution is answered from the cache.
+	st := c.Stats()
+	if st.Resolutions != 2 || st.CacheHits != 1 || st.Queries != 2 || st.Failures != 0 {
+		t.Errorf("got stats %+v", st)
+	}
+	if st.CacheEntries == 0 {
+		t.Errorf("got no cache entries")
+	}
+
+	c = NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(failingTransport{}),
+		WithRetries(1),
+		WithBackoff(0),
+	)
+	if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err == nil {
+		t.Fatal("resolve error: got nil - want error")
+	}
+	if st := c.Stats(); st.Queries != 2 || st.Failures != 2 {
+		t.Errorf("got stats %+v", st)
+	}
+}
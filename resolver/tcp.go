@@ -0,0 +1,365 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// tcpTransport sends queries over TCP. A connection per name server is kept
+// open while it's used (and for the idle timeout after that), and queries are
+// pipelined over it; responses are matched to queries by message ID, so they
+// may arrive out of order.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7766#section-6.2.1
+type tcpTransport struct {
+	// mu guards conns and dials.
+	mu sync.Mutex
+
+	// conns maps a name server address to its open connection.
+	conns map[string]*tcpConn
+
+	// dials maps a name server address to its outstanding dial.
+	dials map[string]*tcpDial
+
+	// idleTimeout is the time an idle connection is kept open.
+	idleTimeout time.Duration
+
+	// dialer dials the connections.
+	dialer Dialer
+}
+
+// newTCPTransport creates a tcpTransport without open connections.
+func newTCPTransport(idleTimeout time.Duration, dialer Dialer) *tcpTransport {
+	return &tcpTransport{
+		conns:       map[string]*tcpConn{},
+		dials:       map[string]*tcpDial{},
+		idleTimeout: idleTimeout,
+		dialer:      dialer,
+	}
+}
+
+// Exchange sends the query over TCP, and reads the response. A query that uses
+// EDNS(0) asks the name server to keep the connection open with the
+// edns-tcp-keepalive option.
+func (t *tcpTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	query, err := withKeepalive(query)
+	if err != nil {
+		return nil, err
+	}
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns query: %w", err)
+	}
+
+	return t.exchange(ctx, addr, query, queryb)
+}
+
+// exchange sends the packed query to the address over an open connection (or
+// a new one), and waits for the response.
+func (t *tcpTransport) exchange(
+	ctx context.Context,
+	addr string,
+	query *dns.Msg,
+	queryb []byte,
+) (*dns.Msg, error) {
+	conn, err := t.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conn.exchange(ctx, query.ID, queryb)
+	if err != nil {
+		return nil, err
+	}
+	if err := matchResponse(query, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// withKeepalive returns a copy of the query with the edns-tcp-keepalive option,
+// when it uses EDNS(0). Signed queries are returned as-is, because the option
+// would invalidate the signature; padded queries are padded again.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7828#section-3.2.1
+func withKeepalive(query *dns.Msg) (*dns.Msg, error) {
+	if query.OPT() == nil {
+		return query, nil
+	}
+	if n := len(query.Additional); n > 0 {
+		if t := query.Additional[n-1].Type; t == dns.TypeTSIG || t == dns.TypeSIG {
+			return query, nil
+		}
+	}
+
+	q := *query
+	q.Additional = append([]dns.RR{}, query.Additional...)
+	if err := q.SetTCPKeepalive(0); err != nil {
+		return nil, fmt.Errorf("failed to set keepalive option: %w", err)
+	}
+	if o, err := q.EDNS0Option(dns.EDNSOptionPadding); err == nil && o != nil {
+		if err := q.Pad(dns.PaddingQueryBlockSize); err != nil {
+			return nil, fmt.Errorf("failed to pad dns query: %w", err)
+		}
+	}
+
+	return &q, nil
+}
+
+// tcpDial is an outstanding dial of a connection to a name server.
+type tcpDial struct {
+	// done is closed when the dial is done.
+	done chan struct{}
+
+	c   *tcpConn
+	err error
+}
+
+// conn returns the open connection to the address, or dials a new one. The
+// lock isn't held while dialing, so a slow name server doesn't hold up queries
+// to the others; concurrent queries to the same address share one dial. A
+// caller stops waiting for a shared dial when its context is done.
+func (t *tcpTransport) conn(ctx context.Context, addr string) (*tcpConn, error) {
+	t.mu.Lock()
+	if c, ok := t.conns[addr]; ok && !c.isClosed() {
+		t.mu.Unlock()
+		return c, nil
+	}
+	if d, ok := t.dials[addr]; ok {
+		t.mu.Unlock()
+
+		select {
+		case <-d.done:
+			return d.c, d.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to dial address %s: %w", addr, ctx.Err())
+		}
+	}
+
+	d := &tcpDial{done: make(chan struct{})}
+	t.dials[addr] = d
+	t.mu.Unlock()
+
+	d.c, d.err = t.dial(ctx, addr)
+
+	t.mu.Lock()
+	delete(t.dials, addr)
+	if d.err == nil {
+		t.conns[addr] = d.c
+	}
+	t.mu.Unlock()
+	close(d.done)
+
+	return d.c, d.err
+}
+
+// dial dials a new connection to the address, and starts reading responses
+// from it.
+func (t *tcpTransport) dial(ctx context.Context, addr string) (*tcpConn, error) {
+	conn, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial address %s: %v", addr, err)
+	}
+
+	c := &tcpConn{
+		conn:        conn,
+		pending:     map[uint16]chan *dns.Msg{},
+		closed:      make(chan struct{}),
+		idleTimeout: t.idleTimeout,
+	}
+	c.onClose = func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.conns[addr] == c {
+			delete(t.conns, addr)
+		}
+	}
+	c.idle = time.AfterFunc(t.idleTimeout, func() { c.close(nil) })
+	go c.read()
+
+	return c, nil
+}
+
+// tcpConn is an open TCP connection to a name server, over which queries are
+// pipelined.
+type tcpConn struct {
+	conn net.Conn
+
+	// writeMu serializes writes, so queries aren't interleaved.
+	writeMu sync.Mutex
+
+	// mu guards all fields below.
+	mu sync.Mutex
+
+	// pending maps the message ID of every outstanding query to the channel its
+	// response is sent on.
+	pending map[uint16]chan *dns.Msg
+
+	// idle closes the connection when there are no outstanding queries for the
+	// idle timeout.
+	idle *time.Timer
+
+	// idleTimeout is the time an idle connection is kept open.
+	idleTimeout time.Duration
+
+	// closed is closed when the connection is closed; err holds the reason.
+	closed chan struct{}
+	err    error
+
+	// onClose is called when the connection is closed.
+	onClose func()
+}
+
+// exchange writes the packed query, and waits for the response with the same
+// message ID.
+func (c *tcpConn) exchange(
+	ctx context.Context,
+	id uint16,
+	queryb []byte,
+) (*dns.Msg, error) {
+	ch := make(chan *dns.Msg, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	if _, ok := c.pending[id]; ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("query ID %d is already outstanding", id)
+	}
+	c.pending[id] = ch
+	c.idle.Stop()
+	c.mu.Unlock()
+	defer c.done(id)
+
+	// Messages sent over TCP are prefixed with a 2 byte length field.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2
+	b := append([]byte{byte(len(queryb) >> 8), byte(len(queryb))}, queryb...)
+
+	c.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	err := c.conn.SetWriteDeadline(deadline)
+	if err == nil {
+		_, err = c.conn.Write(b)
+	}
+	c.writeMu.Unlock()
+	if err != nil {
+		// A partially written query corrupts the stream.
+		c.close(err)
+		return nil, fmt.Errorf("failed to write dns query: %w", err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-c.closed:
+		return nil, fmt.Errorf("failed to read dns response: %w", c.closeErr())
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to read dns response: %w", ctx.Err())
+	}
+}
+
+// done removes the outstanding query, and starts the idle timer when it was
+// the last one.
+func (c *tcpConn) done(id uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+	if len(c.pending) == 0 && c.err == nil {
+		c.idle.Reset(c.idleTimeout)
+	}
+}
+
+// read reads responses, and sends every response to the outstanding query
+// with the same message ID, until the connection is closed. Responses that
+// don't match an outstanding query are discarded.
+func (c *tcpConn) read() {
+	lenb := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(c.conn, lenb); err != nil {
+			c.close(err)
+			return
+		}
+		buff := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(c.conn, buff); err != nil {
+			c.close(err)
+			return
+		}
+
+		resp := new(dns.Msg)
+		if _, err := resp.Unpack(buff); err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+
+		// The name server tells how long it keeps the idle connection open; the
+		// connection is closed before that.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc7828#section-3.2.2
+		if timeout, has, err := resp.TCPKeepalive(); has && err == nil && timeout < c.idleTimeout {
+			c.idleTimeout = timeout
+		}
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// close closes the connection (once); err is the reason, and nil when the
+// connection was idle.
+func (c *tcpConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	if err == nil {
+		// The idle timer may fire right after a new query was sent.
+		if len(c.pending) > 0 {
+			return
+		}
+		err = fmt.Errorf("connection closed")
+	}
+
+	c.err = err
+	c.idle.Stop()
+	c.conn.Close()
+	close(c.closed)
+	go c.onClose()
+}
+
+// isClosed checks if the connection is closed.
+func (c *tcpConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err != nil
+}
+
+// closeErr returns the reason the connection was closed.
+func (c *tcpConn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
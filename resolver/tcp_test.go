@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestTCPPipelining(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan struct{}, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		accepted <- struct{}{}
+
+		// Read two queries, and respond to them in reverse order.
+		queries := []*dns.Msg{}
+		for len(queries) < 2 {
+			lenb := make([]byte, 2)
+			if _, err := io.ReadFull(conn, lenb); err != nil {
+				return
+			}
+			b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return
+			}
+			q := new(dns.Msg)
+			if _, err := q.Unpack(b); err != nil {
+				return
+			}
+			queries = append(queries, q)
+		}
+		for i := len(queries) - 1; i >= 0; i-- {
+			resp := *queries[i]
+			resp.QR = 1
+			resp.Additional = nil
+			resp.Answer = []dns.RR{testRR(resp.Question.QName, 300)}
+			b, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			conn.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+		}
+
+		// Keep the connection open until the client closes it.
+		io.Copy(io.Discard, conn)
+	}()
+
+	tr := newTCPTransport(time.Minute, &net.Dialer{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a.example.com.", "b.example.com."} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			query := new(dns.Msg)
+			if err := query.SetQuery(name, dns.TypeA); err != nil {
+				t.Errorf("failed to set query: %v", err)
+				return
+			}
+			resp, err := tr.Exchange(ctx, query, l.Addr().String())
+			if err != nil {
+				t.Errorf("failed to exchange: %v", err)
+				return
+			}
+			if resp.Question.QName != name {
+				t.Errorf("got response for %s, want %s", resp.Question.QName, name)
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if len(accepted) != 1 {
+		t.Errorf("got %d connections, want 1", len(accepted))
+	}
+}
+
+func TestTCPKeepalive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// The name server asks the client to close the connection after a query
+	// with the edns-tcp-keepalive option, by responding with a timeout of 0.
+	keepalive := make(chan bool, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lenb := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lenb); err != nil {
+			return
+		}
+		b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if _, err := q.Unpack(b); err != nil {
+			return
+		}
+		_, ok, err := q.TCPKeepalive()
+		keepalive <- ok && err == nil
+
+		resp := *q
+		resp.QR = 1
+		resp.Answer = []dns.RR{testRR(resp.Question.QName, 300)}
+		if err := resp.SetTCPKeepalive(0); err != nil {
+			return
+		}
+		if b, err = resp.Pack(); err != nil {
+			return
+		}
+		conn.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+		io.Copy(io.Discard, conn)
+	}()
+
+	tr := newTCPTransport(time.Minute, &net.Dialer{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	query.SetEDNS0(dns.DefaultEDNSUDPSize, false)
+	if _, err := tr.Exchange(ctx, query, l.Addr().String()); err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if !<-keepalive {
+		t.Error("query has no keepalive option")
+	}
+	if _, ok, _ := query.TCPKeepalive(); ok {
+		t.Error("the query passed to Exchange was changed")
+	}
+
+	// The idle connection is closed right away.
+	deadline := time.Now().Add(time.Second)
+	for {
+		tr.mu.Lock()
+		open := len(tr.conns)
+		tr.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection wasn't closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingDialer blocks dials to the address until release is closed (or the
+// context is done), and then fails them; other addresses are dialed.
+type blockingDialer struct {
+	net.Dialer
+
+	addr    string
+	dialing chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if addr != d.addr {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+
+	d.dialing <- struct{}{}
+	select {
+	case <-d.release:
+		return nil, errors.New("unreachable")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestTCPDialUnlocked(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lenb := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lenb); err != nil {
+			return
+		}
+		b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if _, err := q.Unpack(b); err != nil {
+			return
+		}
+		resp := *q
+		resp.QR = 1
+		resp.Answer = []dns.RR{testRR(resp.Question.QName, 300)}
+		if b, err = resp.Pack(); err != nil {
+			return
+		}
+		conn.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+		io.Copy(io.Discard, conn)
+	}()
+
+	d := &blockingDialer{
+		addr:    "192.0.2.1:53",
+		dialing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	tr := newTCPTransport(time.Minute, d)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := tr.Exchange(ctx, query, d.addr)
+		errc <- err
+	}()
+	<-d.dialing
+
+	// A name server isn't held up by the dial to another one.
+	if _, err := tr.Exchange(ctx, query, l.Addr().String()); err != nil {
+		t.Errorf("failed to exchange while dialing another name server: %v", err)
+	}
+	close(d.release)
+	if err := <-errc; err == nil {
+		t.Error("got no error from an unreachable name server")
+	}
+}
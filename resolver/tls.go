@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// TLS sends queries over TLS (DNS over TLS). Like TCP, connections are kept
+// open, and queries to the same name server are pipelined over one connection.
+// The certificate of the name server is verified against the host of its
+// address.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7858
+var TLS Transport = NewTLSTransport(&net.Dialer{}, nil)
+
+// NewTLSTransport creates a transport that sends queries over TLS (DNS over
+// TLS), using TCP connections dialed by the dialer. The config (which may be
+// nil) configures the TLS clients; when it has no server name, the
+// certificate is verified against the host of the name server address.
+func NewTLSTransport(d Dialer, config *tls.Config) Transport {
+	return newTCPTransport(tcpIdleTimeout, &tlsDialer{dialer: d, config: config})
+}
+
+// tlsDialer dials TCP connections with a dialer, and performs a TLS handshake
+// over them.
+type tlsDialer struct {
+	dialer Dialer
+	config *tls.Config
+}
+
+// DialContext dials a TCP connection to the address, and performs the TLS
+// handshake.
+func (d *tlsDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{}
+	if d.config != nil {
+		config = d.config.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		config.ServerName = host
+	}
+
+	// The negotiated application protocol of DNS over TLS is "dot".
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7858#section-3.2
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"dot"}
+	}
+
+	tconn := tls.Client(conn, config)
+	if err := tconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+
+	return tconn, nil
+}
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestTLSTransport(t *testing.T) {
+	// The test server certificate is valid for 127.0.0.1.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	clientConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: ts.TLS.Certificates,
+		NextProtos:   []string{"dot"},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		for {
+			lenb := make([]byte, 2)
+			if _, err := io.ReadFull(conn, lenb); err != nil {
+				return
+			}
+			b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return
+			}
+			q := new(dns.Msg)
+			if _, err := q.Unpack(b); err != nil {
+				return
+			}
+
+			resp := *q
+			resp.QR = 1
+			resp.Additional = nil
+			resp.Answer = []dns.RR{testRR(q.Question.QName, 300)}
+			respb, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			conn.Write(append([]byte{byte(len(respb) >> 8), byte(len(respb))}, respb...))
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	tr := NewTLSTransport(&net.Dialer{}, &tls.Config{RootCAs: clientConfig.RootCAs})
+	resp, err := tr.Exchange(ctx, query, l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Errorf("answer error: got %d answers - want 1", len(resp.Answer))
+	}
+
+	// The certificate must be trusted.
+	if _, err := TLS.Exchange(ctx, query, l.Addr().String()); err == nil {
+		t.Errorf("expected untrusted certificate to fail")
+	}
+}
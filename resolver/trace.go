@@ -0,0 +1,45 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Trace is a set of hooks that are called during a resolution, e.g. to print
+// every step of an iterative resolution. Any hook may be nil. Hooks are called
+// synchronously, but resolutions of name server addresses and CNAME targets
+// are traced as well.
+type Trace struct {
+	// Query is called before a query for the name and type is sent to the name
+	// server.
+	Query func(server net.IP, name string, qt dns.QType)
+
+	// Response is called with the response of the name server (or the error
+	// when there's none), and the round-trip time of the query.
+	Response func(server net.IP, resp *dns.Msg, rtt time.Duration, err error)
+
+	// Referral is called when a referral from a zone to a zone below it is
+	// followed, with the name servers of that zone, and their accepted glue.
+	Referral func(from string, to string, nameServers []string, glue []dns.RR)
+}
+
+// traceKey is the context key of the trace.
+type traceKey struct{}
+
+// WithTrace returns a context that traces the resolutions it's used for.
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// traceFrom returns the trace of the context; it's empty when there's none, so
+// hooks only have to be checked for nil.
+func traceFrom(ctx context.Context) *Trace {
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok && t != nil {
+		return t
+	}
+
+	return &Trace{}
+}
@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// delegationTransport answers queries sent to the root name server with a
+// referral to the com zone, and queries sent to the com name server with an
+// answer.
+type delegationTransport struct{}
+
+func (delegationTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.Additional = nil
+
+	if addr == "192.0.2.54:53" {
+		resp.AA = 1
+		resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+		return &resp, nil
+	}
+
+	ns := testRR("com.", 300)
+	ns.Type = dns.TypeNS
+	ns.RDataUnpacked = "ns.com."
+	resp.Authority = []dns.RR{ns}
+
+	glue := testRR("ns.com.", 300)
+	glue.RDataUnpacked = "192.0.2.54"
+	resp.Additional = []dns.RR{glue}
+
+	return &resp, nil
+}
+
+func TestTrace(t *testing.T) {
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(delegationTransport{}),
+	)
+
+	queried, responses := []string{}, 0
+	referrals := []string{}
+	ctx := WithTrace(context.Background(), &Trace{
+		Query: func(server net.IP, name string, qt dns.QType) {
+			queried = append(queried, server.String())
+		},
+		Response: func(server net.IP, resp *dns.Msg, rtt time.Duration, err error) {
+			responses++
+		},
+		Referral: func(from string, to string, nameServers []string, glue []dns.RR) {
+			referrals = append(referrals, from+" "+to)
+			if len(nameServers) != 1 || len(glue) != 1 {
+				t.Errorf("got name servers %v and glue %v, want ns.com. with glue", nameServers, glue)
+			}
+		},
+	})
+
+	if _, err := c.ResolveContext(ctx, "example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	if len(queried) != 2 || queried[0] != "192.0.2.53" || queried[1] != "192.0.2.54" {
+		t.Errorf("got queried servers %v, want the root and com name servers", queried)
+	}
+	if responses != 2 {
+		t.Errorf("got %d responses, want 2", responses)
+	}
+	if len(referrals) != 1 || referrals[0] != ". com." {
+		t.Errorf("got referrals %v, want . to com.", referrals)
+	}
+}
@@ -0,0 +1,136 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Span attribute keys.
+const (
+	// AttrName is the name that's resolved or queried.
+	AttrName = "dns.name"
+
+	// AttrQType is the type of the question (e.g. "A").
+	AttrQType = "dns.qtype"
+
+	// AttrZone is the zone whose name servers are queried.
+	AttrZone = "dns.zone"
+
+	// AttrServer is the IP address of the name server that's queried.
+	AttrServer = "dns.server"
+
+	// AttrRCode is the response code of the response (e.g. "NOERROR").
+	AttrRCode = "dns.rcode"
+
+	// AttrRTT is the round-trip time of the query, in milliseconds.
+	AttrRTT = "dns.rtt_ms"
+
+	// AttrAttempts is the number of queries sent during a lookup.
+	AttrAttempts = "dns.attempts"
+)
+
+// Tracer starts the spans of resolutions (see WithTracer). It's a subset of the
+// OpenTelemetry tracing API, so an OpenTelemetry tracer can be adapted to it
+// with a few lines of code; the span of the context passed to Start is the
+// parent of the span it starts.
+//
+// A resolution has a "resolve" span, with a "lookup" span for every delegation
+// hop (every zone whose name servers are queried), which has an "exchange" span
+// for every query sent to a name server. Resolutions of name server addresses
+// and CNAME targets are part of the resolution that needs them.
+type Tracer interface {
+	// Start starts a span with the name and attributes, and returns a context
+	// that holds it.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single step of a resolution.
+type Span interface {
+	// SetAttributes sets the attributes of the span.
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError records the error that failed the step.
+	RecordError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// Attribute is a key-value pair that describes a span (see the Attr
+// constants). Its value is a string, an int or a float64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// WithTracer traces every resolution with spans started by the tracer (see
+// Tracer). It's disabled by default.
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// noopSpan is a span that's used when tracing is disabled.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span with the tracer of the client, or a span that does
+// nothing when there's none.
+func (c *Client) startSpan(
+	ctx context.Context,
+	name string,
+	attrs ...Attribute,
+) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	return c.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan ends the span with the outcome of the step: the error, or the
+// response code of the response.
+func endSpan(span Span, resp *dns.Msg, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+	case resp != nil:
+		span.SetAttributes(Attribute{AttrRCode, rcodeName(resp.RCode)})
+	}
+	span.End()
+}
+
+// serverAttrs returns the attributes of a query sent to the name server.
+func serverAttrs(server net.IP, rtt time.Duration) []Attribute {
+	return []Attribute{
+		{AttrServer, server.String()},
+		{AttrRTT, float64(rtt) / float64(time.Millisecond)},
+	}
+}
+
+// rcodeNames are the mnemonics of the response codes.
+var rcodeNames = map[dns.RCode]string{
+	dns.RCodeNoError:        "NOERROR",
+	dns.RCodeFormatError:    "FORMERR",
+	dns.RCodeServerFailure:  "SERVFAIL",
+	dns.RCodeNameError:      "NXDOMAIN",
+	dns.RCodeNotImplemented: "NOTIMP",
+	dns.RCodeRefused:        "REFUSED",
+}
+
+// rcodeName returns the mnemonic of the response code, or its description when
+// it has none.
+func rcodeName(rcode dns.RCode) string {
+	if s, ok := rcodeNames[rcode]; ok {
+		return s
+	}
+
+	return rcode.String()
+}
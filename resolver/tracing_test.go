@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// testSpan is a span recorded by testTracer.
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+// testSpanKey is the context key of the span started by testTracer.
+type testSpanKey struct{}
+
+// testTracer records the spans it starts, in order.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(
+	ctx context.Context,
+	name string,
+	attrs ...Attribute,
+) (context.Context, Span) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	s := &testSpan{name: name, parent: parent, attrs: map[string]interface{}{}}
+	s.SetAttributes(attrs...)
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+// failingTransport fails every query.
+type failingTransport struct{}
+
+func (failingTransport) Exchange(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error) {
+	return nil, errors.New("network is unreachable")
+}
+
+func TestTracer(t *testing.T) {
+	tr := &testTracer{}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(delegationTransport{}),
+		WithTracer(tr),
+	)
+
+	if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	// Every hop has a lookup span with an exchange span.
+	want := []struct {
+		name   string
+		parent int
+		key    string
+		value  interface{}
+	}{
+		{"resolve", -1, AttrRCode, "NOERROR"},
+		{"lookup", 0, AttrZone, "."},
+		{"exchange", 1, AttrServer, "192.0.2.53"},
+		{"lookup", 0, AttrZone, "com."},
+		{"exchange", 3, AttrServer, "192.0.2.54"},
+	}
+	if len(tr.spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(tr.spans), len(want))
+	}
+	for i, w := range want {
+		s := tr.spans[i]
+		if s.name != w.name || s.attrs[w.key] != w.value {
+			t.Errorf(
+				"span %d: got %s with %s=%v, want %s with %v",
+				i, s.name, w.key, s.attrs[w.key], w.name, w.value,
+			)
+		}
+		if w.parent < 0 && s.parent != nil || w.parent >= 0 && s.parent != tr.spans[w.parent] {
+			t.Errorf("span %d (%s): wrong parent", i, s.name)
+		}
+		if !s.ended {
+			t.Errorf("span %d (%s) didn't end", i, s.name)
+		}
+	}
+	if got := tr.spans[3].attrs[AttrAttempts]; got != 1 {
+		t.Errorf("got %v attempts, want 1", got)
+	}
+	if _, ok := tr.spans[4].attrs[AttrRTT].(float64); !ok {
+		t.Errorf("exchange span has no rtt")
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	tr := &testTracer{}
+	c := NewClient(
+		WithRootServers(net.ParseIP("192.0.2.53")),
+		WithTransport(failingTransport{}),
+		WithRetries(1),
+		WithBackoff(0),
+		WithTracer(tr),
+	)
+
+	if _, err := c.ResolveContext(context.Background(), "example.com", dns.TypeA); err == nil {
+		t.Fatal("resolve error: got nil - want error")
+	}
+	for _, s := range tr.spans {
+		if s.err == nil {
+			t.Errorf("span %s error: got nil - want error", s.name)
+		}
+	}
+	if got := tr.spans[1].attrs[AttrAttempts]; got != 2 {
+		t.Errorf("got %v attempts, want 2", got)
+	}
+}
@@ -0,0 +1,288 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Transfer is a zone that was transferred from a name server with AXFR or
+// IXFR.
+type Transfer struct {
+	// SOA is the SOA resource record of the transferred version of the zone.
+	SOA dns.RR
+
+	// Records holds all resource records of the zone (starting with the SOA
+	// resource record) when the entire zone was transferred; it's nil for an
+	// incremental transfer.
+	Records []dns.RR
+
+	// Deltas holds the changes of an incremental transfer, oldest first. It's
+	// empty when the zone didn't change.
+	Deltas []Delta
+}
+
+// Delta is a change of a zone from one version to the next. The first deleted
+// resource record is the SOA resource record of the old version, and the first
+// added one is the SOA resource record of the new version.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1995#section-4
+type Delta struct {
+	Deleted []dns.RR
+	Added   []dns.RR
+}
+
+// Incremental checks if the zone was transferred incrementally (or didn't
+// change).
+func (t *Transfer) Incremental() bool {
+	return t.Records == nil
+}
+
+// Transfer transfers the zone from the name server over TCP. Without a SOA
+// resource record, the entire zone is transferred (AXFR). With the SOA resource
+// record of the version the client has, only the changes since that version
+// are requested (IXFR); the name server may still send the entire zone. The
+// server is an IP address or "host:port" (the port defaults to 53). Every
+// message must be received within the client timeout.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5936
+// See: https://datatracker.ietf.org/doc/html/rfc1995
+func (c *Client) Transfer(
+	ctx context.Context,
+	zone string,
+	server string,
+	soa *dns.RR,
+) (*Transfer, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	query := new(dns.Msg)
+	qt := dns.TypeAXFR
+	if soa != nil {
+		qt = dns.TypeIXFR
+	}
+	if err := query.SetQuery(dns.Fqdn(zone), qt); err != nil {
+		return nil, fmt.Errorf("failed to set dns query: %v", err)
+	}
+	query.RD = 0
+	if soa != nil {
+		query.Authority = []dns.RR{*soa}
+	}
+	query, err := c.signSIG0(query)
+	if err != nil {
+		return nil, err
+	}
+	query, mac, err := c.signTSIG(query)
+	if err != nil {
+		return nil, err
+	}
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns query: %w", err)
+	}
+
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial address %s: %v", server, err)
+	}
+	defer conn.Close()
+
+	stop, err := watchContext(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	b := append([]byte{byte(len(queryb) >> 8), byte(len(queryb))}, queryb...)
+	if _, err := conn.Write(b); err != nil {
+		return nil, fmt.Errorf("failed to write dns query: %w", err)
+	}
+
+	tr := &transferReader{ixfr: soa != nil}
+	for first := true; ; first = false {
+		resp, err := c.readTransferMsg(ctx, conn, query)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		if resp.RCode != dns.RCodeNoError {
+			return nil, fmt.Errorf("zone transfer of %s from %s failed: %s", zone, server, resp.RCode)
+		}
+
+		// Every message is signed; the messages after the first one with the MAC
+		// of the previous message.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc8945#section-5.3.1
+		if mac, err = c.verifyTSIG(resp, mac, !first); err != nil {
+			return nil, fmt.Errorf("zone transfer of %s from %s failed: %w", zone, server, err)
+		}
+		done, err := tr.read(resp.Answer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone transfer of %s from %s: %v", zone, server, err)
+		}
+
+		// When the zone didn't change, the IXFR response only holds the current
+		// SOA resource record.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc1995#section-2
+		if first && tr.ixfr && len(resp.Answer) == 1 && tr.soa.Type == dns.TypeSOA {
+			return &Transfer{SOA: tr.soa}, nil
+		}
+		if done {
+			return tr.transfer(), nil
+		}
+	}
+}
+
+// readTransferMsg reads the next length-prefixed message of a zone transfer
+// from the connection, within the client timeout.
+func (c *Client) readTransferMsg(
+	ctx context.Context,
+	conn net.Conn,
+	query *dns.Msg,
+) (*dns.Msg, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read dns response: %w", err)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, fmt.Errorf("failed to read dns response: %w", err)
+	}
+
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(b); err != nil {
+		return nil, fmt.Errorf("failed to unpack dns response: %w", err)
+	}
+
+	// Only the first message must echo the question.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5936#section-2.2.1
+	if resp.QR != 1 || resp.ID != query.ID {
+		return nil, fmt.Errorf("response ID %d does not match query ID %d", resp.ID, query.ID)
+	}
+
+	return resp, nil
+}
+
+// transferReader reads the resource records of a zone transfer, which may be
+// spread over multiple messages.
+type transferReader struct {
+	// ixfr is set for an incremental transfer.
+	ixfr bool
+
+	// soa is the first SOA resource record, and serial its serial number.
+	soa    dns.RR
+	serial uint32
+
+	// n is the number of resource records read.
+	n int
+
+	// records holds the resource records of a transfer of the entire zone.
+	records []dns.RR
+
+	// deltas holds the changes of an incremental transfer; adding is set while
+	// the added resource records of the last delta are read.
+	deltas []Delta
+	adding bool
+}
+
+// read reads the resource records of the next message; it returns true when
+// the transfer is complete.
+func (r *transferReader) read(rrs []dns.RR) (bool, error) {
+	for i, rr := range rrs {
+		r.n++
+		serial, isSOA := soaSerial(rr)
+
+		switch {
+		// The transfer starts with the SOA resource record of the new version of
+		// the zone.
+		case r.n == 1:
+			if !isSOA {
+				return false, fmt.Errorf("first record is %s, not SOA", rr.Type)
+			}
+			r.soa, r.serial = rr, serial
+			r.records = []dns.RR{rr}
+
+		// In an IXFR response, a second SOA resource record (of the old version)
+		// starts the first delta; otherwise, the entire zone is transferred.
+		case r.n == 2 && r.ixfr && isSOA && serial != r.serial:
+			r.records = nil
+			r.deltas = []Delta{{Deleted: []dns.RR{rr}}}
+
+		case r.deltas != nil:
+			d := &r.deltas[len(r.deltas)-1]
+			switch {
+			case isSOA && !r.adding:
+				d.Added = []dns.RR{rr}
+				r.adding = true
+			case isSOA && serial == r.serial:
+				return true, r.trailing(rrs[i+1:])
+			case isSOA:
+				r.deltas = append(r.deltas, Delta{Deleted: []dns.RR{rr}})
+				r.adding = false
+			case r.adding:
+				d.Added = append(d.Added, rr)
+			default:
+				d.Deleted = append(d.Deleted, rr)
+			}
+
+		// The entire zone ends with the SOA resource record it started with.
+		case isSOA && serial == r.serial:
+			return true, r.trailing(rrs[i+1:])
+		case isSOA:
+			return false, fmt.Errorf("unexpected SOA record with serial %d", serial)
+		default:
+			r.records = append(r.records, rr)
+		}
+	}
+
+	return false, nil
+}
+
+// trailing checks that no resource records follow the final SOA resource
+// record.
+func (r *transferReader) trailing(rrs []dns.RR) error {
+	if len(rrs) > 0 {
+		return fmt.Errorf("%d records after the final SOA record", len(rrs))
+	}
+
+	return nil
+}
+
+// transfer returns the transferred zone.
+func (r *transferReader) transfer() *Transfer {
+	if r.deltas != nil {
+		return &Transfer{SOA: r.soa, Deltas: r.deltas}
+	}
+
+	return &Transfer{SOA: r.soa, Records: r.records}
+}
+
+// soaSerial returns the serial number of a SOA resource record; it returns
+// false when the resource record isn't a SOA resource record.
+func soaSerial(rr dns.RR) (uint32, bool) {
+	if rr.Type != dns.TypeSOA {
+		return 0, false
+	}
+	soa := new(dns.SOA)
+	if err := soa.Unpack(rr.RData); err != nil {
+		return 0, false
+	}
+
+	return soa.Serial, true
+}
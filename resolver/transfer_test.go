@@ -0,0 +1,182 @@
+package resolver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func testSOA(t *testing.T, serial uint32) dns.RR {
+	t.Helper()
+
+	soa := &dns.SOA{
+		MName:   "ns1.example.org.",
+		RName:   "hostmaster.example.org.",
+		Serial:  serial,
+		Refresh: 7200,
+		Retry:   3600,
+		Expire:  1209600,
+		Minimum: 300,
+	}
+	rdata, err := soa.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := dns.NewRR("example.org.", dns.TypeSOA, dns.ClassIN, 3600, rdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+// serveTransfer accepts a single connection, reads the query, and responds with
+// a message per slice of resource records.
+func serveTransfer(t *testing.T, msgs ...[]dns.RR) (string, <-chan *dns.Msg) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	queries := make(chan *dns.Msg, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lenb := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lenb); err != nil {
+			return
+		}
+		b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if _, err := q.Unpack(b); err != nil {
+			return
+		}
+		queries <- q
+
+		for _, rrs := range msgs {
+			resp := *q
+			resp.QR = 1
+			resp.AA = 1
+			resp.Authority = nil
+			resp.Answer = rrs
+			b, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			conn.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+		}
+	}()
+
+	return l.Addr().String(), queries
+}
+
+func TestTransferAXFR(t *testing.T) {
+	soa := testSOA(t, 2)
+	www := testRR("www.example.org.", 300)
+	addr, queries := serveTransfer(t, []dns.RR{soa, www}, []dns.RR{soa})
+
+	c := NewClient(WithTimeout(time.Second))
+	tr, err := c.Transfer(context.Background(), "example.org", addr, nil)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if q := <-queries; q.Question.QType != dns.TypeAXFR || q.RD != 0 {
+		t.Errorf("got query type %s (rd %d), want AXFR (rd 0)", q.Question.QType, q.RD)
+	}
+	if tr.Incremental() || len(tr.Records) != 2 || tr.Records[1].Name != www.Name {
+		t.Errorf("got records %v, want SOA and www", tr.Records)
+	}
+	if serial, _ := soaSerial(tr.SOA); serial != 2 {
+		t.Errorf("got serial %d, want 2", serial)
+	}
+}
+
+func TestTransferIXFR(t *testing.T) {
+	soa1, soa2, soa3 := testSOA(t, 1), testSOA(t, 2), testSOA(t, 3)
+	a := testRR("a.example.org.", 300)
+	b := testRR("b.example.org.", 300)
+	addr, queries := serveTransfer(
+		t,
+		[]dns.RR{soa3, soa1, a, soa2, b},
+		[]dns.RR{soa2, b, soa3, a, soa3},
+	)
+
+	c := NewClient(WithTimeout(time.Second))
+	tr, err := c.Transfer(context.Background(), "example.org.", addr, &soa1)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	q := <-queries
+	if q.Question.QType != dns.TypeIXFR || len(q.Authority) != 1 {
+		t.Errorf("got query type %s with %d authority records, want IXFR with the SOA", q.Question.QType, len(q.Authority))
+	}
+	if !tr.Incremental() || len(tr.Deltas) != 2 {
+		t.Fatalf("got %d deltas (incremental %t), want 2", len(tr.Deltas), tr.Incremental())
+	}
+	want := []Delta{
+		{Deleted: []dns.RR{soa1, a}, Added: []dns.RR{soa2, b}},
+		{Deleted: []dns.RR{soa2, b}, Added: []dns.RR{soa3, a}},
+	}
+	for i, d := range tr.Deltas {
+		if len(d.Deleted) != len(want[i].Deleted) || len(d.Added) != len(want[i].Added) {
+			t.Errorf("delta %d: got %d deleted and %d added records, want %d and %d",
+				i, len(d.Deleted), len(d.Added), len(want[i].Deleted), len(want[i].Added))
+			continue
+		}
+		if d.Deleted[1].Name != want[i].Deleted[1].Name || d.Added[1].Name != want[i].Added[1].Name {
+			t.Errorf("delta %d: got %v, want %v", i, d, want[i])
+		}
+	}
+}
+
+func TestTransferIXFRUpToDate(t *testing.T) {
+	soa := testSOA(t, 5)
+	addr, _ := serveTransfer(t, []dns.RR{soa})
+
+	c := NewClient(WithTimeout(time.Second))
+	tr, err := c.Transfer(context.Background(), "example.org.", addr, &soa)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if !tr.Incremental() || len(tr.Deltas) != 0 {
+		t.Errorf("got %d deltas, want none", len(tr.Deltas))
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	soa1, soa2 := testSOA(t, 1), testSOA(t, 2)
+	www := testRR("www.example.org.", 300)
+	tests := []struct {
+		name string
+		msgs [][]dns.RR
+	}{
+		{"no SOA first", [][]dns.RR{{www, soa1}}},
+		{"other SOA", [][]dns.RR{{soa1, www, soa2}}},
+		{"trailing records", [][]dns.RR{{soa1, www, soa1, www}}},
+		{"incomplete", [][]dns.RR{{soa1, www}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := serveTransfer(t, tt.msgs...)
+
+			c := NewClient(WithTimeout(time.Second))
+			if _, err := c.Transfer(context.Background(), "example.org.", addr, nil); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
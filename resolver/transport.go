@@ -0,0 +1,321 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Transport sends a query to a name server, and returns the response that
+// matches the query. The context deadline (if any) bounds the exchange.
+type Transport interface {
+	Exchange(ctx context.Context, query *dns.Msg, addr string) (*dns.Msg, error)
+}
+
+// Dialer dials connections to name servers. It's implemented by net.Dialer,
+// and can be used to send queries through a proxy (e.g. SOCKS), or over
+// in-memory pipes.
+type Dialer interface {
+	DialContext(ctx context.Context, network string, addr string) (net.Conn, error)
+}
+
+// NewTransport creates a transport that sends queries over UDP, and retries
+// over TCP when the response is truncated, using connections dialed by the
+// dialer. Like UDP, sockets aren't reused across queries.
+func NewTransport(d Dialer) Transport {
+	return &udpTransport{
+		dialer: d,
+		tcp:    newTCPTransport(tcpIdleTimeout, d),
+	}
+}
+
+// NewTCPTransport creates a transport that sends queries over TCP, using
+// connections dialed by the dialer. Like TCP, connections are kept open, and
+// queries are pipelined over them.
+func NewTCPTransport(d Dialer) Transport {
+	return newTCPTransport(tcpIdleTimeout, d)
+}
+
+var (
+	// UDP sends queries over UDP, and retries over TCP when the response is
+	// truncated. Every query is sent from a new socket, so its source port is
+	// random.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5452#section-9.2
+	UDP Transport = &udpTransport{tcp: defaultTCP}
+
+	// PooledUDP is like UDP, but sockets are reused across queries to the same
+	// name server (for up to 10 seconds), which saves opening a socket for
+	// every query. Because the source port of the reused sockets is known to
+	// anyone who observed an earlier query, forged responses only need to
+	// guess the message ID; it should only be used with a trusted name server
+	// (e.g. on the local network), or for benchmarks.
+	PooledUDP Transport = &udpTransport{
+		pool: newUDPPool(udpIdleTimeout),
+		tcp:  defaultTCP,
+	}
+
+	// TCP sends queries over TCP. Connections are kept open, and queries to the
+	// same name server are pipelined over one connection.
+	TCP Transport = defaultTCP
+)
+
+// defaultTCP is the TCP transport that's shared by UDP and TCP.
+var defaultTCP = newTCPTransport(tcpIdleTimeout, &net.Dialer{})
+
+const (
+	// udpIdleTimeout is the time an idle UDP socket is kept for reuse.
+	udpIdleTimeout = time.Second * 10
+
+	// tcpIdleTimeout is the time an idle TCP connection is kept open.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7766#section-6.2.3
+	tcpIdleTimeout = time.Second * 10
+)
+
+// udpTransport sends queries over UDP, and retries over TCP when the response
+// is truncated.
+type udpTransport struct {
+	// pool holds the idle sockets per name server; it's only used when there's
+	// no dialer. When it's nil, every query uses a new socket.
+	pool *udpPool
+
+	// dialer dials a connection for every query; nil uses unconnected sockets.
+	dialer Dialer
+
+	// tcp sends queries when a response is truncated.
+	tcp *tcpTransport
+}
+
+// Exchange sends the query over UDP, and reads the response.
+func (t *udpTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns query: %w", err)
+	}
+
+	var resp *dns.Msg
+	if t.dialer != nil {
+		resp, err = exchangeDialed(ctx, t.dialer, addr, query, queryb)
+	} else {
+		resp, err = exchangeUDP(ctx, t.pool, addr, query, queryb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// When the response is truncated, retry over TCP.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7766#section-5
+	if resp.TC == 1 {
+		return t.tcp.Exchange(ctx, query, addr)
+	}
+
+	return resp, nil
+}
+
+// exchangeUDP sends the packed query to the address over UDP, and reads the
+// response. The socket is taken from the pool (when there's an idle one), and
+// is returned to it after a successful exchange; without a pool, a new socket
+// is opened and closed.
+//
+// The socket is not connected, so datagrams from any source can be read; only
+// datagrams from the queried address and port are accepted.
+func exchangeUDP(
+	ctx context.Context,
+	pool *udpPool,
+	addr string,
+	query *dns.Msg,
+	queryb []byte,
+) (resp *dns.Msg, err error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address %s: %v", addr, err)
+	}
+
+	var conn *net.UDPConn
+	if pool != nil {
+		conn, err = pool.get(raddr)
+	} else {
+		conn, err = listenUDP(raddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for address %s: %v", addr, err)
+	}
+	defer func() {
+		// A socket is only reused after a successful exchange; otherwise a late
+		// response could still arrive.
+		if err != nil || pool == nil {
+			conn.Close()
+			return
+		}
+		pool.put(raddr, conn)
+	}()
+
+	stop, err := watchContext(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	if _, err := conn.WriteToUDP(queryb, raddr); err != nil {
+		return nil, fmt.Errorf("failed to write dns query: %w", err)
+	}
+
+	// Keep reading until a response matches the query (or the deadline passes);
+	// a mismatching datagram may be a spoofing attempt, or a late response to an
+	// earlier query. A response that only differs in the case of the name comes
+	// from a name server that doesn't preserve it, which is reported right away
+	// so the query can be sent again without randomizing the case.
+	for {
+		// The max UDP message size is 512 bytes, unless a larger size is
+		// advertised with EDNS(0).
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc1035#section-2.3.4
+		// See: https://datatracker.ietf.org/doc/html/rfc6891#section-6.2.3
+		buff := make([]byte, dns.DefaultEDNSUDPSize)
+		n, from, err := conn.ReadFromUDP(buff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dns response: %w", err)
+		}
+		if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+			continue
+		}
+
+		msg := new(dns.Msg)
+		if _, err := msg.Unpack(buff[:n]); err != nil {
+			continue
+		}
+		if err := matchResponse(query, msg); err != nil {
+			if errors.Is(err, ErrCaseMismatch) {
+				return nil, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// exchangeDialed sends the packed query to the address over a UDP connection
+// that's dialed by the dialer, and reads the response.
+func exchangeDialed(
+	ctx context.Context,
+	dialer Dialer,
+	addr string,
+	query *dns.Msg,
+	queryb []byte,
+) (*dns.Msg, error) {
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial address %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	stop, err := watchContext(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	if _, err := conn.Write(queryb); err != nil {
+		return nil, fmt.Errorf("failed to write dns query: %w", err)
+	}
+
+	// The connection only receives datagrams from the address, but those may
+	// still not match the query (e.g. a late response to an earlier query).
+	for {
+		buff := make([]byte, dns.DefaultEDNSUDPSize)
+		n, err := conn.Read(buff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dns response: %w", err)
+		}
+
+		msg := new(dns.Msg)
+		if _, err := msg.Unpack(buff[:n]); err != nil {
+			continue
+		}
+		if err := matchResponse(query, msg); err != nil {
+			if errors.Is(err, ErrCaseMismatch) {
+				return nil, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// watchContext applies the context deadline (if any) to the connection, and
+// unblocks any pending read or write when the context is canceled, until the
+// returned stop function is called.
+func watchContext(ctx context.Context, conn net.Conn) (func(), error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}, nil
+}
+
+// matchResponse checks that the response answers the query; the message ID
+// and the question section must match exactly (including the case of the
+// name). Only a FORMERR or NOTIMP response may have no question section, since
+// name servers that don't understand the query (e.g. because of EDNS(0)) often
+// don't echo it.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5452#section-9.1
+// See: https://datatracker.ietf.org/doc/html/rfc6891#section-7
+func matchResponse(query *dns.Msg, resp *dns.Msg) error {
+	if resp.QR != 1 {
+		return fmt.Errorf("message is not a response")
+	}
+	if resp.ID != query.ID {
+		return fmt.Errorf(
+			"response ID %d does not match query ID %d", resp.ID, query.ID,
+		)
+	}
+	if len(resp.Questions()) == 0 &&
+		(resp.RCode == dns.RCodeFormatError || resp.RCode == dns.RCodeNotImplemented) {
+		return nil
+	}
+
+	rq, qq := resp.Question, query.Question
+	if rq.QType == qq.QType && rq.QClass == qq.QClass &&
+		rq.QName != qq.QName && strings.EqualFold(rq.QName, qq.QName) {
+		return fmt.Errorf(
+			"response question %q does not match query question %q: %w",
+			rq.String(), qq.String(), ErrCaseMismatch,
+		)
+	}
+	if rq.QName != qq.QName || rq.QType != qq.QType || rq.QClass != qq.QClass {
+		return fmt.Errorf(
+			"response question %q does not match query question %q",
+			rq.String(), qq.String(),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// udpResponder listens on a local UDP socket, and sends the responses returned
+// by the handler for every query it receives; the responses are sent in order.
+// It returns the address of the socket.
+func udpResponder(t *testing.T, handle func(query *dns.Msg) []*dns.Msg) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buff := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFromUDP(buff)
+			if err != nil {
+				return
+			}
+			query := new(dns.Msg)
+			if _, err := query.Unpack(buff[:n]); err != nil {
+				continue
+			}
+			for _, resp := range handle(query) {
+				b, err := resp.Pack()
+				if err != nil {
+					continue
+				}
+				conn.WriteToUDP(b, from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// answer returns a response to the query with an A resource record.
+func answer(query *dns.Msg) *dns.Msg {
+	resp := *query
+	resp.QR = 1
+	resp.Additional = nil
+	resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+
+	return &resp
+}
+
+func TestExchangeUDPCaseMismatch(t *testing.T) {
+	// The name server doesn't preserve the case of the name.
+	addr := udpResponder(t, func(query *dns.Msg) []*dns.Msg {
+		resp := answer(query)
+		resp.Question.QName = strings.ToLower(resp.Question.QName)
+		return []*dns.Msg{resp}
+	})
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("ExAmPlE.CoM.", dns.TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := UDP.Exchange(ctx, query, addr); !errors.Is(err, ErrCaseMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrCaseMismatch)
+	}
+}
+
+func TestMatchResponse(t *testing.T) {
+	query := new(dns.Msg)
+	if err := query.SetQuery("ExAmPlE.com.", dns.TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+	reply := func(modify func(resp *dns.Msg)) *dns.Msg {
+		resp := *query
+		resp.QR = 1
+		modify(&resp)
+		return &resp
+	}
+
+	tests := []struct {
+		name string
+		resp *dns.Msg
+		ok   bool
+	}{
+		{"match", reply(func(resp *dns.Msg) {}), true},
+		{"not a response", reply(func(resp *dns.Msg) { resp.QR = 0 }), false},
+		{"mismatched ID", reply(func(resp *dns.Msg) { resp.ID++ }), false},
+		{"mismatched name", reply(func(resp *dns.Msg) { resp.Question.QName = "example.org." }), false},
+		{"mismatched type", reply(func(resp *dns.Msg) { resp.Question.QType = dns.TypeAAAA }), false},
+		{"mismatched class", reply(func(resp *dns.Msg) { resp.Question.QClass = dns.ClassCH }), false},
+		{"mismatched case", reply(func(resp *dns.Msg) { resp.Question.QName = "example.com." }), false},
+		{
+			"format error without question",
+			reply(func(resp *dns.Msg) {
+				resp.Question = dns.Question{}
+				resp.RCode = dns.RCodeFormatError
+			}),
+			true,
+		},
+		{
+			"not implemented without question",
+			reply(func(resp *dns.Msg) {
+				resp.Question = dns.Question{}
+				resp.RCode = dns.RCodeNotImplemented
+			}),
+			true,
+		},
+		{
+			"format error without question and mismatched ID",
+			reply(func(resp *dns.Msg) {
+				resp.ID++
+				resp.Question = dns.Question{}
+				resp.RCode = dns.RCodeFormatError
+			}),
+			false,
+		},
+		{
+			"answer without question",
+			reply(func(resp *dns.Msg) { resp.Question = dns.Question{} }),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := matchResponse(query, tt.resp); (err == nil) != tt.ok {
+				t.Errorf("got error %v, want match %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExchangeUDPMismatch(t *testing.T) {
+	// The name server sends datagrams that don't match the query, before the
+	// response that does.
+	addr := udpResponder(t, func(query *dns.Msg) []*dns.Msg {
+		notResponse := answer(query)
+		notResponse.QR = 0
+		otherID := answer(query)
+		otherID.ID++
+		otherQuestion := answer(query)
+		otherQuestion.Question.QName = "example.org."
+		otherQuestion.Answer = nil
+
+		return []*dns.Msg{notResponse, otherID, otherQuestion, answer(query)}
+	})
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := UDP.Exchange(ctx, query, addr)
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 || resp.ID != query.ID || resp.Question != query.Question {
+		t.Errorf("got response %v, want the answer to the query", resp)
+	}
+}
+
+func TestExchangeUDPSourceAddress(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	spoofer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer spoofer.Close()
+
+	go func() {
+		buff := make([]byte, 512)
+		n, from, err := server.ReadFromUDP(buff)
+		if err != nil {
+			return
+		}
+		query := new(dns.Msg)
+		if _, err := query.Unpack(buff[:n]); err != nil {
+			return
+		}
+
+		// A response from another port must be ignored, even though it matches
+		// the query.
+		reply := func(conn *net.UDPConn, ip string) {
+			resp := *query
+			resp.QR = 1
+			resp.Additional = nil
+			rr := testRR(query.Question.QName, 300)
+			rr.RData = net.ParseIP(ip).To4()
+			resp.Answer = []dns.RR{rr}
+			b, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(b, from)
+		}
+		reply(spoofer, "192.0.2.66")
+		time.Sleep(10 * time.Millisecond)
+		reply(server, "192.0.2.1")
+	}()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := UDP.Exchange(ctx, query, server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if got := resp.Answer[0].RDataUnpacked; got != "192.0.2.1" {
+		t.Errorf("got answer %s, want 192.0.2.1", got)
+	}
+}
+
+func TestExchangeUDPSourcePort(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	// The name server answers every query, and sends the source port of the
+	// query on ports.
+	ports := make(chan int, 4)
+	go func() {
+		buff := make([]byte, 512)
+		for {
+			n, from, err := server.ReadFromUDP(buff)
+			if err != nil {
+				return
+			}
+			query := new(dns.Msg)
+			if _, err := query.Unpack(buff[:n]); err != nil {
+				continue
+			}
+			resp := *query
+			resp.QR = 1
+			resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			ports <- from.Port
+			server.WriteToUDP(b, from)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	exchange := func(tr Transport) int {
+		query := new(dns.Msg)
+		if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+			t.Fatalf("failed to set query: %v", err)
+		}
+		if _, err := tr.Exchange(ctx, query, server.LocalAddr().String()); err != nil {
+			t.Fatalf("failed to exchange: %v", err)
+		}
+		return <-ports
+	}
+
+	// Every query is sent from a new socket, unless sockets are pooled.
+	if a, b := exchange(UDP), exchange(UDP); a == b {
+		t.Errorf("got source port %d for consecutive queries", a)
+	}
+	if a, b := exchange(PooledUDP), exchange(PooledUDP); a != b {
+		t.Errorf("got source ports %d and %d for pooled queries", a, b)
+	}
+}
+
+// pipeDialer dials in-memory connections to a fake name server, which answers
+// every query with an A resource record.
+type pipeDialer struct {
+	network chan string
+}
+
+func (d *pipeDialer) DialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+) (net.Conn, error) {
+	client, server := net.Pipe()
+	d.network <- network
+
+	go func() {
+		defer server.Close()
+
+		buff := make([]byte, 512)
+		n, err := server.Read(buff)
+		if err != nil {
+			return
+		}
+		query := new(dns.Msg)
+		if _, err := query.Unpack(buff[:n]); err != nil {
+			return
+		}
+
+		resp := *query
+		resp.QR = 1
+		resp.Additional = nil
+		resp.Answer = []dns.RR{testRR(query.Question.QName, 300)}
+		b, err := resp.Pack()
+		if err != nil {
+			return
+		}
+		server.Write(b)
+	}()
+
+	return client, nil
+}
+
+func TestNewTransportDialer(t *testing.T) {
+	d := &pipeDialer{network: make(chan string, 1)}
+	tr := NewTransport(d)
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.com.", dns.TypeA); err != nil {
+		t.Fatalf("failed to set query: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := tr.Exchange(ctx, query, "192.0.2.53:53")
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].RDataUnpacked != "192.0.2.1" {
+		t.Errorf("got answer %v, want 192.0.2.1", resp.Answer)
+	}
+	if network := <-d.network; network != "udp" {
+		t.Errorf("got dialed network %q, want udp", network)
+	}
+}
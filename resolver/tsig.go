@@ -0,0 +1,41 @@
+package resolver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// signTSIG returns a copy of the query that's signed with the TSIG key of the
+// client, and its MAC; without a key, it returns the query.
+func (c *Client) signTSIG(query *dns.Msg) (*dns.Msg, []byte, error) {
+	if c.tsig == nil {
+		return query, nil, nil
+	}
+
+	signed := *query
+	signed.Additional = append([]dns.RR{}, query.Additional...)
+	mac, err := signed.SignTSIG(c.tsig, nil, false, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign dns query: %w", err)
+	}
+
+	return &signed, mac, nil
+}
+
+// verifyTSIG verifies the TSIG signature of the response with the MAC of the
+// query (or of the previous message, with timersOnly), and returns the MAC of
+// the response. Without a TSIG key, it doesn't verify anything.
+func (c *Client) verifyTSIG(resp *dns.Msg, mac []byte, timersOnly bool) ([]byte, error) {
+	if c.tsig == nil {
+		return nil, nil
+	}
+
+	mac, err := resp.VerifyTSIG(c.tsig, mac, timersOnly, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid response (%s): %w", resp.RCode, err)
+	}
+
+	return mac, nil
+}
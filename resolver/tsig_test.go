@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+var testTSIGKey = &dns.TSIGKey{Name: "key.example.", Algorithm: dns.HmacSHA256, Secret: []byte("secret")}
+
+// tsigTransport verifies that queries are signed with the key, and signs the
+// responses with the key; an unsigned query gets an unsigned REFUSED response.
+type tsigTransport struct {
+	key *dns.TSIGKey
+}
+
+func (t *tsigTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	b, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	q := new(dns.Msg)
+	if _, err := q.Unpack(b); err != nil {
+		return nil, err
+	}
+
+	resp := *q
+	resp.QR = 1
+	resp.Additional = nil
+	mac, err := q.VerifyTSIG(t.key, nil, false, time.Now())
+	if err != nil {
+		resp.RCode = dns.RCodeRefused
+		return &resp, nil
+	}
+	resp.Answer = []dns.RR{testRR(q.Question.QName, 300)}
+	if _, err := resp.SignTSIG(t.key, mac, false, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return unpacked(&resp)
+}
+
+// unpacked returns the message as it's received.
+func unpacked(m *dns.Msg) (*dns.Msg, error) {
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	got := new(dns.Msg)
+	if _, err := got.Unpack(b); err != nil {
+		return nil, err
+	}
+
+	return got, nil
+}
+
+func TestExchangeTSIG(t *testing.T) {
+	query := new(dns.Msg)
+	if err := query.SetQuery("www.example.org.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(WithTransport(&tsigTransport{key: testTSIGKey}), WithTSIG(testTSIGKey))
+	resp, err := c.ExchangeContext(context.Background(), query, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Errorf("got answer %v", resp.Answer)
+	}
+	if len(query.Additional) != 0 {
+		t.Error("the query was changed")
+	}
+
+	// The response must be signed with the same key.
+	other := &dns.TSIGKey{Name: testTSIGKey.Name, Algorithm: dns.HmacSHA256, Secret: []byte("other")}
+	c = NewClient(WithTransport(&tsigTransport{key: other}), WithTSIG(testTSIGKey))
+	if _, err := c.ExchangeContext(context.Background(), query, "192.0.2.1"); err == nil {
+		t.Error("got no error for a response signed with another key")
+	}
+}
+
+func TestTransferTSIG(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	soa := testSOA(t, 1)
+	www := testRR("www.example.org.", 300)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lenb := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lenb); err != nil {
+			return
+		}
+		b := make([]byte, int(lenb[0])<<8|int(lenb[1]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if _, err := q.Unpack(b); err != nil {
+			return
+		}
+		mac, err := q.VerifyTSIG(testTSIGKey, nil, false, time.Now())
+		if err != nil {
+			return
+		}
+
+		// The first message is signed with the MAC of the query, and the second
+		// one with the MAC of the first one (and only its timers).
+		for i, rrs := range [][]dns.RR{{soa, www}, {soa}} {
+			resp := *q
+			resp.QR = 1
+			resp.Answer = rrs
+			resp.Additional = nil
+			if mac, err = resp.SignTSIG(testTSIGKey, mac, i > 0, time.Now()); err != nil {
+				return
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			conn.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+		}
+	}()
+
+	c := NewClient(WithTimeout(time.Second), WithTSIG(testTSIGKey))
+	tr, err := c.Transfer(context.Background(), "example.org.", l.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if len(tr.Records) != 2 {
+		t.Errorf("got records %v, want SOA and www", tr.Records)
+	}
+}
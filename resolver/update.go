@@ -0,0 +1,41 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Update sends the dynamic update (see dns.Msg.SetUpdate) to the name server,
+// which should be the primary name server of the zone. The server is an IP
+// address or "host:port" (the port defaults to 53). It returns an error
+// wrapping ErrPrerequisite when a prerequisite wasn't met, and ErrRefused when
+// the name server refused the update (e.g. because it doesn't accept updates
+// from the client).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2136#section-3
+func (c *Client) Update(ctx context.Context, update *dns.Msg, server string) error {
+	if update.OpCode != dns.OpCodeUpdate {
+		return fmt.Errorf("message is not an update (opcode %s)", update.OpCode)
+	}
+
+	resp, err := c.ExchangeContext(ctx, update, server)
+	if err != nil {
+		return err
+	}
+
+	zone := update.Question.QName
+	switch resp.RCode {
+	case dns.RCodeNoError:
+		return nil
+	case dns.RCodeYXDomain, dns.RCodeYXRRset, dns.RCodeNXRRset:
+		return fmt.Errorf("update of zone %s: %w (%s)", zone, ErrPrerequisite, resp.RCode)
+	case dns.RCodeServerFailure:
+		return fmt.Errorf("update of zone %s: %w", zone, ErrServFail)
+	case dns.RCodeRefused:
+		return fmt.Errorf("update of zone %s: %w", zone, ErrRefused)
+	default:
+		return fmt.Errorf("update of zone %s failed: %s", zone, resp.RCode)
+	}
+}
@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// updateTransport responds to updates with the rcode, and records the last
+// update.
+type updateTransport struct {
+	rcode  dns.RCode
+	update *dns.Msg
+}
+
+func (t *updateTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.update = query
+	resp := *query
+	resp.QR = 1
+	resp.RCode = t.rcode
+	resp.Answer, resp.Authority = nil, nil
+
+	return &resp, nil
+}
+
+func TestUpdate(t *testing.T) {
+	rr := testRR("www.example.org.", 300)
+	update := new(dns.Msg)
+	if err := update.SetUpdate("example.org."); err != nil {
+		t.Fatal(err)
+	}
+	update.RRsetNotUsed("www.example.org.", dns.TypeA)
+	update.Insert(rr)
+
+	tests := []struct {
+		rcode dns.RCode
+		want  error
+	}{
+		{dns.RCodeNoError, nil},
+		{dns.RCodeYXRRset, ErrPrerequisite},
+		{dns.RCodeNXRRset, ErrPrerequisite},
+		{dns.RCodeRefused, ErrRefused},
+		{dns.RCodeServerFailure, ErrServFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rcode.String(), func(t *testing.T) {
+			tr := &updateTransport{rcode: tt.rcode}
+			c := NewClient(WithTransport(tr))
+			err := c.Update(context.Background(), update, "192.0.2.1")
+			if tt.want == nil && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			if tr.update != update {
+				t.Error("update wasn't sent")
+			}
+		})
+	}
+
+	c := NewClient(WithTransport(&updateTransport{}))
+	query := new(dns.Msg)
+	if err := query.SetQuery("example.org.", dns.TypeSOA); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(context.Background(), query, "192.0.2.1"); err == nil {
+		t.Error("got no error for a query")
+	}
+
+	// A NOTAUTH response isn't a prerequisite failure.
+	c = NewClient(WithTransport(&updateTransport{rcode: dns.RCodeNotAuth}))
+	if err := c.Update(context.Background(), update, "192.0.2.1"); err == nil || errors.Is(err, ErrPrerequisite) {
+		t.Errorf("got error %v for NOTAUTH", err)
+	}
+}
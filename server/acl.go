@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// ACL is an access control list of rules that allow or deny queries of
+// clients by their IP address, and optionally by the listener the queries
+// were received on ("udp", "tcp", "tls" or "https"). The first rule that
+// matches a query applies. When no rule matches, the query is denied if the
+// ACL has rules that allow queries, and allowed otherwise; so an empty ACL
+// allows all queries. Rules must be added before the ACL is used.
+type ACL struct {
+	rules []aclRule
+}
+
+// aclRule allows or denies the queries of clients in the network that are
+// received on the listener (or on any listener when it's empty).
+type aclRule struct {
+	allow    bool
+	listener string
+	net      *net.IPNet
+}
+
+// NewACL creates an ACL without rules.
+func NewACL() *ACL {
+	return &ACL{}
+}
+
+// Allow adds rules that allow the queries of clients in the networks that are
+// received on the listener; an empty listener matches all listeners.
+func (a *ACL) Allow(listener string, nets ...*net.IPNet) {
+	for _, n := range nets {
+		a.rules = append(a.rules, aclRule{allow: true, listener: listener, net: n})
+	}
+}
+
+// Deny adds rules that deny the queries of clients in the networks that are
+// received on the listener; an empty listener matches all listeners.
+func (a *ACL) Deny(listener string, nets ...*net.IPNet) {
+	for _, n := range nets {
+		a.rules = append(a.rules, aclRule{allow: false, listener: listener, net: n})
+	}
+}
+
+// Allowed reports whether the ACL allows a query of the client address that
+// was received on the listener.
+func (a *ACL) Allowed(listener string, addr net.Addr) bool {
+	ip := net.ParseIP(addrIP(addr))
+	hasAllow := false
+	for _, r := range a.rules {
+		hasAllow = hasAllow || r.allow
+		if ip == nil || r.listener != "" && r.listener != listener || !r.net.Contains(ip) {
+			continue
+		}
+		return r.allow
+	}
+
+	return !hasAllow
+}
+
+// Middleware refuses the queries that the ACL denies, and passes the others to
+// the handler. When types are given, only queries of those types are checked
+// (e.g. dns.TypeAXFR and dns.TypeIXFR for zone transfers). Refused responses
+// have an EDE option with the Prohibited code when the query has an OPT
+// resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8914#section-4.19
+func (a *ACL) Middleware(types ...dns.QType) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			if !a.applies(query.Question.QType, types) || a.Allowed(w.Network(), w.RemoteAddr()) {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+
+			resp := Reply(query, dns.RCodeRefused)
+			if query.OPT() != nil {
+				resp.AddEDE(&dns.EDE{InfoCode: dns.EDEProhibited})
+			}
+			w.WriteMsg(resp)
+		})
+	}
+}
+
+// applies reports whether queries of the type are checked by a middleware of
+// the types.
+func (a *ACL) applies(qt dns.QType, types []dns.QType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == qt {
+			return true
+		}
+	}
+
+	return false
+}
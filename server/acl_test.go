@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestACL(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	acl := NewACL()
+	acl.Deny("", cidr("10.0.0.66/32"))
+	acl.Allow("", cidr("10.0.0.0/8"))
+	acl.Allow("tls", cidr("0.0.0.0/0"))
+
+	tests := []struct {
+		listener string
+		ip       string
+		want     bool
+	}{
+		{"udp", "10.0.0.1", true},
+		{"udp", "10.0.0.66", false},
+		{"udp", "192.0.2.1", false},
+		{"tls", "192.0.2.1", true},
+		{"tls", "10.0.0.66", false},
+	}
+	for _, tt := range tests {
+		addr := &net.UDPAddr{IP: net.ParseIP(tt.ip), Port: 5353}
+		if got := acl.Allowed(tt.listener, addr); got != tt.want {
+			t.Errorf("%s %s: got %t - want %t", tt.listener, tt.ip, got, tt.want)
+		}
+	}
+
+	// An ACL without rules that allow queries allows the other clients.
+	acl = NewACL()
+	acl.Deny("tcp", cidr("192.0.2.0/24"))
+	if !acl.Allowed("udp", &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}) {
+		t.Error("got a denied query without a matching rule")
+	}
+}
+
+func TestACLMiddleware(t *testing.T) {
+	// The test writer's client is 192.0.2.1, and its listener is udp.
+	acl := NewACL()
+	acl.Deny("udp", &net.IPNet{IP: net.IPv4(192, 0, 2, 0), Mask: net.CIDRMask(24, 32)})
+
+	h := Chain(nameHandler("h"), acl.Middleware())
+	query := newQuery(t, "example.org.", dns.TypeA)
+	query.SetEDNS0(1232, false)
+	resp := serve(t, h, query)
+	edes, err := resp.EDEs()
+	if resp.RCode != dns.RCodeRefused || err != nil || len(edes) != 1 || edes[0].InfoCode != dns.EDEProhibited {
+		t.Errorf("got %s with EDEs %v (%v) - want REFUSED with Prohibited", resp.RCode, edes, err)
+	}
+
+	// Queries of other types pass a middleware of types.
+	h = Chain(nameHandler("h"), acl.Middleware(dns.TypeAXFR, dns.TypeIXFR))
+	if resp := serve(t, h, newQuery(t, "example.org.", dns.TypeA)); resp.RCode != dns.RCodeNoError {
+		t.Errorf("got %s - want NOERROR", resp.RCode)
+	}
+	if resp := serve(t, h, newQuery(t, "example.org.", dns.TypeAXFR)); resp.RCode != dns.RCodeRefused {
+		t.Errorf("got %s - want REFUSED", resp.RCode)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/danillouz/tdr/dns"
+)
+
+// minimalANYTTL is the TTL of the HINFO resource record that's synthesized
+// in answer to ANY queries; it's long, so resolvers cache it.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8482#section-4.2
+const minimalANYTTL = 3600
+
+// minimalANY checks if the query is an ANY query that must be answered with a
+// minimal response: one that holds a single resource record set (or a
+// synthesized HINFO resource record), instead of all of them. ANY queries
+// received over UDP are answered this way, so their responses can't be used
+// to amplify attacks with spoofed source addresses; clients that need a full
+// response can query over TCP.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8482#section-4
+func minimalANY(w ResponseWriter, query *dns.Msg) bool {
+	return query.Question.QType == dns.TypeANY && w.Network() == "udp"
+}
+
+// hinfoReply returns a response to the ANY query that holds a synthesized
+// HINFO resource record, with the CPU field set to "RFC8482" and an empty OS
+// field.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8482#section-4.2
+func hinfoReply(query *dns.Msg) *dns.Msg {
+	rdata := append(append([]byte{7}, "RFC8482"...), 0)
+	rr, err := dns.NewRR(query.Question.QName, dns.TypeHINFO, dns.ClassIN, minimalANYTTL, rdata)
+	if err != nil {
+		return Reply(query, dns.RCodeServerFailure)
+	}
+
+	resp := Reply(query, dns.RCodeNoError)
+	resp.Answer = []dns.RR{rr}
+	return resp
+}
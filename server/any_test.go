@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// types returns the types of the resource records.
+func types(rrs []dns.RR) []dns.Type {
+	ts := []dns.Type{}
+	for _, rr := range rrs {
+		ts = append(ts, rr.Type)
+	}
+	return ts
+}
+
+func TestServeAuthorityANY(t *testing.T) {
+	udp, tcp := startServer(t, newTestAuthority(t))
+	query := newQuery(t, "example.org.", dns.TypeANY)
+
+	// Over UDP, only the first resource record set is returned, with its
+	// additional resource records.
+	resp := exchangeUDP(t, udp, mustPack(t, query))
+	if resp.RCode != dns.RCodeNoError || resp.AA != 1 || len(resp.Answer) != 1 || resp.Answer[0].Type != dns.TypeNS {
+		t.Errorf("udp answer error: got %s aa %d with %v - want NOERROR aa 1 with [NS]", resp.RCode, resp.AA, types(resp.Answer))
+	}
+	if len(resp.Additional) != 1 || resp.Additional[0].Type != dns.TypeA {
+		t.Errorf("udp additional error: got %v - want [A]", types(resp.Additional))
+	}
+
+	conn, err := net.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	resp, err = exchangeConn(conn, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answer) != 2 || resp.Answer[0].Type != dns.TypeNS || resp.Answer[1].Type != dns.TypeSOA {
+		t.Errorf("tcp answer error: got %v - want [NS SOA]", types(resp.Answer))
+	}
+
+	// Negative answers are the same over UDP.
+	resp = exchangeUDP(t, udp, mustPack(t, newQuery(t, "nope.example.org.", dns.TypeANY)))
+	if resp.RCode != dns.RCodeNameError || len(resp.Answer) != 0 {
+		t.Errorf("nxdomain error: got %s with %d answers", resp.RCode, len(resp.Answer))
+	}
+}
+
+func TestServeRecursiveANY(t *testing.T) {
+	client := resolver.NewClient(
+		resolver.WithRootServers(net.ParseIP("192.0.2.53")),
+		resolver.WithTransport(&answerTransport{}),
+	)
+	udp, _ := startServer(t, NewRecursive(client))
+
+	resp := exchangeUDP(t, udp, mustPack(t, newQuery(t, "www.example.org.", dns.TypeANY)))
+	if resp.RCode != dns.RCodeNoError || resp.RA != 1 || len(resp.Answer) != 1 {
+		t.Fatalf("answer error: got %s ra %d with %d answers - want NOERROR ra 1 with 1 answer", resp.RCode, resp.RA, len(resp.Answer))
+	}
+	rr := resp.Answer[0]
+	if rr.Name != "www.example.org." || rr.Type != dns.TypeHINFO || rr.RDataUnpacked != `"RFC8482" ""` || rr.TTL != minimalANYTTL {
+		t.Errorf("hinfo error: got %s %d %s %s", rr.Name, rr.TTL, rr.Type, rr.RDataUnpacked)
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+// maxTransferMsgSize is the max size of the resource records in a single
+// message of a zone transfer; it leaves room for the header, question and OPT
+// pseudo resource record.
+const maxTransferMsgSize = maxMsgSize - 1024
+
+// Authority is a handler that answers queries authoritatively from zones.
+// Queries for names outside the zones, or of a class other than IN, are
+// refused. The zones can be replaced while queries are served (see Reload).
+type Authority struct {
+	// mu guards all fields below.
+	mu sync.RWMutex
+
+	zones []*zone.Zone
+
+	// transfers holds the networks of the clients that may transfer the zones.
+	transfers []*net.IPNet
+}
+
+// NewAuthority creates an Authority of the zones.
+func NewAuthority(zones ...*zone.Zone) *Authority {
+	return &Authority{zones: zones}
+}
+
+// AllowTransfer allows clients in the networks to transfer the zones (with
+// AXFR or IXFR over TCP); by default, zone transfers are refused.
+func (a *Authority) AllowTransfer(nets ...*net.IPNet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.transfers = append(a.transfers, nets...)
+}
+
+// Reload replaces the zones (e.g. after the zone files were edited), and
+// returns the zones that changed: the new zones, and the zones with a
+// different SOA serial number. The secondaries of the changed zones should be
+// notified.
+func (a *Authority) Reload(zones ...*zone.Zone) []*zone.Zone {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	serials := map[string]uint32{}
+	for _, z := range a.zones {
+		serials[strings.ToLower(z.Origin)], _ = soaSerial(z.SOA())
+	}
+	changed := []*zone.Zone{}
+	for _, z := range zones {
+		prev, ok := serials[strings.ToLower(z.Origin)]
+		if serial, _ := soaSerial(z.SOA()); !ok || serial != prev {
+			changed = append(changed, z)
+		}
+	}
+	a.zones = zones
+
+	return changed
+}
+
+// ServeDNS looks up the answer to the query in the most specific zone that
+// contains the name. Answers and negative answers have the AA bit set, and a
+// negative answer holds the SOA resource record of the zone; a referral to a
+// delegated zone doesn't.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2308#section-2
+func (a *Authority) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	q := query.Question
+	if query.OpCode != dns.OpCodeQuery {
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+		return
+	}
+	if q.QClass != dns.ClassIN {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+	a.mu.RLock()
+	z, transfers := a.zone(q.QName), a.transfers
+	a.mu.RUnlock()
+	if z == nil {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	serveZone(w, query, z, transfers)
+}
+
+// zone returns the most specific zone that contains the domain name, or nil
+// when there's none; a.mu must be held.
+func (a *Authority) zone(name string) *zone.Zone {
+	var match *zone.Zone
+	for _, z := range a.zones {
+		if z.Contains(name) && (match == nil || len(z.Origin) > len(match.Origin)) {
+			match = z
+		}
+	}
+
+	return match
+}
+
+// serveZone answers the query from the zone; zone transfers are served to
+// clients in the networks. ANY queries received over UDP are answered with a
+// single resource record set.
+func serveZone(w ResponseWriter, query *dns.Msg, z *zone.Zone, transfers []*net.IPNet) {
+	q := query.Question
+	if q.QType == dns.TypeAXFR || q.QType == dns.TypeIXFR {
+		serveTransfer(w, query, z, transfers)
+		return
+	}
+
+	r := z.Lookup(q.QName, q.QType)
+
+	// A minimal response to an ANY query holds the first resource record set
+	// of the name (with its additional resource records).
+	if minimalANY(w, query) && r.RCode == dns.RCodeNoError && r.Authoritative && len(r.Answer) > 0 {
+		r = z.Lookup(q.QName, r.Answer[0].Type)
+	}
+	resp := Reply(query, r.RCode)
+	if r.Authoritative {
+		resp.AA = 1
+	}
+	resp.Answer = r.Answer
+	resp.Authority = r.Authority
+	resp.Additional = append(r.Additional, resp.Additional...)
+	w.WriteMsg(resp)
+}
+
+// serveTransfer transfers the zone to a client in the networks over TCP. The
+// history of the zone isn't kept, so an IXFR query is answered with the entire
+// zone (like AXFR), unless the client has the current version.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5936#section-2.2
+// See: https://datatracker.ietf.org/doc/html/rfc1995#section-4
+func serveTransfer(w ResponseWriter, query *dns.Msg, z *zone.Zone, transfers []*net.IPNet) {
+	q := query.Question
+	if !strings.EqualFold(dns.Fqdn(q.QName), z.Origin) || !allowed(transfers, w.RemoteAddr()) {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	soa := z.SOA()
+	if q.QType == dns.TypeIXFR {
+		serial, _ := soaSerial(soa)
+		current := false
+		if len(query.Authority) == 1 {
+			if client, ok := soaSerial(query.Authority[0]); ok {
+				current = dns.CompareSerial(client, serial) >= 0
+			}
+		}
+
+		// Over UDP (and HTTPS), only the current SOA resource record is sent,
+		// so a client that doesn't have the current version retries over TCP.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc1995#section-2
+		if current || !isStream(w.Network()) {
+			resp := Reply(query, dns.RCodeNoError)
+			resp.AA = 1
+			resp.Answer = []dns.RR{soa}
+			w.WriteMsg(resp)
+			return
+		}
+	}
+	if !isStream(w.Network()) {
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+		return
+	}
+
+	// The transfer starts and ends with the SOA resource record, and may be
+	// spread over multiple messages.
+	rrs := []dns.RR{soa}
+	for _, rr := range z.Records() {
+		if rr.Type != dns.TypeSOA {
+			rrs = append(rrs, rr)
+		}
+	}
+	rrs = append(rrs, soa)
+
+	for len(rrs) > 0 {
+		n, size := 0, 0
+		for ; n < len(rrs); n++ {
+			// The size of a resource record is at most the size of its
+			// uncompressed owner name, fixed fields and RDATA.
+			rrSize := len(rrs[n].Name) + 2 + 10 + len(rrs[n].RData)
+			if n > 0 && size+rrSize > maxTransferMsgSize {
+				break
+			}
+			size += rrSize
+		}
+
+		resp := Reply(query, dns.RCodeNoError)
+		resp.AA = 1
+		resp.Answer = rrs[:n]
+		if err := w.WriteMsg(resp); err != nil {
+			return
+		}
+		rrs = rrs[n:]
+	}
+}
+
+// allowed checks if the IP address of the client is in one of the networks.
+func allowed(nets []*net.IPNet, addr net.Addr) bool {
+	ip := net.ParseIP(addrIP(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// soaSerial returns the serial number of a SOA resource record.
+func soaSerial(rr dns.RR) (uint32, bool) {
+	rd, err := rr.Decode()
+	if err != nil {
+		return 0, false
+	}
+	soa, ok := rd.(*dns.SOA)
+	if !ok {
+		return 0, false
+	}
+
+	return soa.Serial, true
+}
+
+// isStream reports whether the network carries a stream of messages, which
+// zone transfers need: TCP, or TLS (zone transfers over TLS).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9103
+func isStream(network string) bool {
+	return network == "tcp" || network == "tls"
+}
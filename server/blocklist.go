@@ -0,0 +1,328 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+const (
+	// blockTTL is the TTL of the resource records of a blocked answer.
+	blockTTL = 60
+
+	// maxBlocklistSize is the max size of a blocklist, in bytes.
+	maxBlocklistSize = 64 << 20
+
+	// blocklistTimeout is the max time a blocklist is downloaded for.
+	blocklistTimeout = time.Minute
+)
+
+// BlockMode is how a Blocklist answers queries for blocked names.
+type BlockMode int
+
+const (
+	// BlockNXDomain answers with NXDOMAIN, as if the name doesn't exist.
+	BlockNXDomain BlockMode = iota
+
+	// BlockNullIP answers A queries with 0.0.0.0, AAAA queries with ::, and
+	// queries of other types with an empty answer, so clients don't retry
+	// with another resolver.
+	BlockNullIP
+)
+
+// String returns the name of the mode.
+func (m BlockMode) String() string {
+	switch m {
+	case BlockNXDomain:
+		return "nxdomain"
+	case BlockNullIP:
+		return "null"
+	default:
+		return fmt.Sprintf("BlockMode(%d)", int(m))
+	}
+}
+
+// BlocklistStats are the statistics of a Blocklist.
+type BlocklistStats struct {
+	// Names is the number of blocked names, and Blocked is the number of
+	// queries that were blocked.
+	Names   int
+	Blocked uint64
+}
+
+// Blocklist is a middleware that blocks queries for the names on its lists
+// (and their subdomains), e.g. of ad or malware domains, like Pi-hole does.
+// The lists are loaded from files or HTTP(S) URLs with Load, and reloaded
+// periodically with Run. A list is in hosts format ("0.0.0.0 ads.example"),
+// or has a name per line; comments start with "#", and lines that aren't in
+// either format (e.g. Adblock filters) are skipped. Blocked responses have an
+// EDE option with the Blocked code when the query has an OPT resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8914#section-4.16
+type Blocklist struct {
+	// Mode is how queries for blocked names are answered. It must be set
+	// before the blocklist is used.
+	Mode BlockMode
+
+	// Log logs reloads and failed reloads (with Run); nil disables logging.
+	Log *log.Logger
+
+	sources []string
+	client  *http.Client
+
+	// mu guards names.
+	mu sync.RWMutex
+
+	// names holds the blocked names, lowercased and without trailing dot.
+	names map[string]bool
+
+	// blocked counts the blocked queries.
+	blocked atomic.Uint64
+}
+
+// NewBlocklist creates a Blocklist of the lists at the sources: file paths, or
+// http:// or https:// URLs. It blocks nothing until it's loaded.
+func NewBlocklist(sources ...string) *Blocklist {
+	return &Blocklist{
+		sources: append([]string{}, sources...),
+		client:  &http.Client{Timeout: blocklistTimeout},
+		names:   map[string]bool{},
+	}
+}
+
+// Load loads the lists from the sources, and replaces the blocked names with
+// the names on them. When any list can't be loaded, the blocked names are
+// kept.
+func (b *Blocklist) Load(ctx context.Context) error {
+	names := []string{}
+	for _, src := range b.sources {
+		list, err := b.fetch(ctx, src)
+		if err != nil {
+			return fmt.Errorf("failed to load blocklist %s: %w", src, err)
+		}
+		names = append(names, list...)
+	}
+	b.Set(names...)
+
+	return nil
+}
+
+// Set replaces the blocked names.
+func (b *Blocklist) Set(names ...string) {
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[strings.ToLower(strings.TrimSuffix(name, "."))] = true
+	}
+
+	b.mu.Lock()
+	b.names = m
+	b.mu.Unlock()
+}
+
+// Run reloads the lists at the interval, until the context is done.
+func (b *Blocklist) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := b.Load(ctx); err != nil {
+			b.logf("%v", err)
+			continue
+		}
+		b.logf("reloaded %d blocklists (%d names)", len(b.sources), b.Stats().Names)
+	}
+}
+
+// logf logs the message when logging is enabled.
+func (b *Blocklist) logf(format string, args ...interface{}) {
+	if b.Log != nil {
+		b.Log.Printf(format, args...)
+	}
+}
+
+// fetch reads and parses the list at the source.
+func (b *Blocklist) fetch(ctx context.Context, src string) ([]string, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return ParseBlocklist(io.LimitReader(f, maxBlocklistSize))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return ParseBlocklist(io.LimitReader(resp.Body, maxBlocklistSize))
+}
+
+// hostsAliases are names of hosts files that refer to the host itself, which
+// aren't blocked.
+var hostsAliases = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// ParseBlocklist parses a list in hosts format, or with a name per line, and
+// returns its names, lowercased and without trailing dot.
+func ParseBlocklist(r io.Reader) ([]string, error) {
+	names := []string{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), 64*1024)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case len(fields) > 1:
+			// The names of a hosts file follow an IP address.
+			if net.ParseIP(fields[0]) == nil {
+				continue
+			}
+			fields = fields[1:]
+		}
+
+		for _, f := range fields {
+			name := strings.ToLower(strings.TrimSuffix(f, "."))
+			if hostsAliases[name] || !validBlockName(name) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// validBlockName reports whether the name is a domain name with at least two
+// labels of letters, digits, hyphens and underscores.
+func validBlockName(name string) bool {
+	if net.ParseIP(name) != nil || !strings.Contains(name, ".") || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Blocked reports whether the name, or a domain it's a subdomain of, is
+// blocked.
+func (b *Blocklist) Blocked(name string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, n := range dns.AncestorDomainNames(strings.ToLower(name)) {
+		if b.names[strings.TrimSuffix(n, ".")] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stats returns the statistics of the blocklist.
+func (b *Blocklist) Stats() BlocklistStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return BlocklistStats{Names: len(b.names), Blocked: b.blocked.Load()}
+}
+
+// Middleware answers queries for blocked names, and passes any other query to
+// the handler.
+func (b *Blocklist) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			q := query.Question
+			if query.OpCode != dns.OpCodeQuery || q.QClass != dns.ClassIN ||
+				!b.Blocked(q.QName) {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			b.blocked.Add(1)
+
+			w.WriteMsg(b.reply(query))
+		})
+	}
+}
+
+// reply returns the response to a query for a blocked name.
+func (b *Blocklist) reply(query *dns.Msg) *dns.Msg {
+	q := query.Question
+	resp := Reply(query, dns.RCodeNoError)
+	resp.RA = 1
+	switch {
+	case b.Mode != BlockNullIP:
+		resp.RCode = dns.RCodeNameError
+	case q.QType == dns.TypeA:
+		rr, err := dns.NewRR(q.QName, dns.TypeA, dns.ClassIN, blockTTL, net.IPv4zero.To4())
+		if err == nil {
+			resp.Answer = []dns.RR{rr}
+		}
+	case q.QType == dns.TypeAAAA:
+		rr, err := dns.NewRR(q.QName, dns.TypeAAAA, dns.ClassIN, blockTTL, net.IPv6zero)
+		if err == nil {
+			resp.Answer = []dns.RR{rr}
+		}
+	}
+	if query.OPT() != nil {
+		resp.AddEDE(&dns.EDE{InfoCode: dns.EDEBlocked})
+	}
+
+	return resp
+}
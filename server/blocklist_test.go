@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	list := `# hosts
+127.0.0.1 localhost
+0.0.0.0 ads.example.org tracker.example.org # trackers
+::1 ip6-localhost
+Malware.Example.NET.
+
+||adblock.example^
+not a list
+`
+	got, err := ParseBlocklist(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ads.example.org", "tracker.example.org", "malware.example.net"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v - want %v", got, want)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	b := NewBlocklist()
+	b.Set("ads.example.org", "Tracker.Example.NET.")
+	h := Chain(nameHandler("h"), b.Middleware())
+
+	tests := []struct {
+		name    string
+		qt      dns.QType
+		rcode   dns.RCode
+		answers int
+	}{
+		{"ads.example.org.", dns.TypeA, dns.RCodeNameError, 0},
+		{"x.ADS.example.org.", dns.TypeAAAA, dns.RCodeNameError, 0},
+		{"tracker.example.net.", dns.TypeTXT, dns.RCodeNameError, 0},
+
+		// Other names are passed to the handler.
+		{"example.org.", dns.TypeA, dns.RCodeNoError, 1},
+		{"notads.example.org.", dns.TypeA, dns.RCodeNoError, 1},
+	}
+	for _, tt := range tests {
+		resp := serve(t, h, newQuery(t, tt.name, tt.qt))
+		if resp.RCode != tt.rcode || len(resp.Answer) != tt.answers {
+			t.Errorf("%s %s: got %s with %d answers - want %s with %d", tt.name, tt.qt, resp.RCode, len(resp.Answer), tt.rcode, tt.answers)
+		}
+	}
+
+	if st := b.Stats(); st.Names != 2 || st.Blocked != 3 {
+		t.Errorf("got stats %+v - want 2 names and 3 blocked", st)
+	}
+}
+
+func TestBlocklistNullIP(t *testing.T) {
+	b := NewBlocklist()
+	b.Mode = BlockNullIP
+	b.Set("ads.example.org")
+	h := Chain(nameHandler("h"), b.Middleware())
+
+	tests := []struct {
+		qt   dns.QType
+		data []byte
+	}{
+		{dns.TypeA, net.IPv4zero.To4()},
+		{dns.TypeAAAA, net.IPv6zero},
+		{dns.TypeMX, nil},
+	}
+	for _, tt := range tests {
+		query := newQuery(t, "ads.example.org.", tt.qt)
+		query.SetEDNS0(1232, false)
+		resp := serve(t, h, query)
+		if resp.RCode != dns.RCodeNoError {
+			t.Errorf("%s: got %s - want NOERROR", tt.qt, resp.RCode)
+		}
+		switch {
+		case tt.data == nil && len(resp.Answer) != 0:
+			t.Errorf("%s: got %d answers - want 0", tt.qt, len(resp.Answer))
+		case tt.data != nil && (len(resp.Answer) != 1 || !reflect.DeepEqual(resp.Answer[0].RData, tt.data)):
+			t.Errorf("%s: got answers %v - want %v", tt.qt, resp.Answer, tt.data)
+		}
+		edes, err := resp.EDEs()
+		if err != nil || len(edes) != 1 || edes[0].InfoCode != dns.EDEBlocked {
+			t.Errorf("%s: got EDEs %v (%v) - want Blocked", tt.qt, edes, err)
+		}
+	}
+}
+
+func TestBlocklistLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(file, []byte("0.0.0.0 ads.example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("malware.example.net\n"))
+	}))
+	defer ts.Close()
+
+	b := NewBlocklist(file, ts.URL)
+	if err := b.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Blocked("ads.example.org.") || !b.Blocked("malware.example.net.") || b.Blocked("example.org.") {
+		t.Errorf("got stats %+v after load", b.Stats())
+	}
+
+	// The blocked names are kept when a list can't be loaded.
+	os.Remove(file)
+	if err := b.Load(context.Background()); err == nil {
+		t.Error("got no error loading a missing file")
+	}
+	if got := b.Stats().Names; got != 2 {
+		t.Errorf("got %d names - want 2", got)
+	}
+}
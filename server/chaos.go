@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Names of the CHAOS class TXT queries that identify a name server.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4892#section-2
+const (
+	// VersionBind is queried for the version of the name server software.
+	VersionBind = "version.bind."
+
+	// HostnameBind is queried for the host name of the name server.
+	HostnameBind = "hostname.bind."
+
+	// IDServer is queried for the identity of a name server instance (e.g. of
+	// an anycast name server).
+	IDServer = "id.server."
+)
+
+// Chaos answers CHAOS class TXT queries for the names (e.g. VersionBind) with
+// their text, and passes any other query to the handler. Queries of another
+// type for the names get an empty answer, and names without text are refused,
+// so the ones that aren't configured can't be told apart from a server that
+// doesn't answer them.
+func Chaos(txt map[string]string) Middleware {
+	texts := map[string]string{}
+	for name, text := range txt {
+		texts[muxKey(name)] = text
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			q := query.Question
+			text, ok := texts[strings.ToLower(q.QName)]
+			if q.QClass != dns.ClassCH || !ok {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			if text == "" {
+				w.WriteMsg(Reply(query, dns.RCodeRefused))
+				return
+			}
+
+			resp := Reply(query, dns.RCodeNoError)
+			resp.AA = 1
+			if q.QType == dns.TypeTXT || q.QType == dns.TypeANY {
+				rr, err := dns.NewRR(q.QName, dns.TypeTXT, dns.ClassCH, 0, txtRData(text))
+				if err != nil {
+					w.WriteMsg(Reply(query, dns.RCodeServerFailure))
+					return
+				}
+				resp.Answer = []dns.RR{rr}
+			}
+			w.WriteMsg(resp)
+		})
+	}
+}
+
+// txtRData returns the RDATA of a TXT resource record that holds the text,
+// split into character strings of at most 255 bytes.
+func txtRData(text string) []byte {
+	rdata := []byte{}
+	for len(text) > 255 {
+		rdata = append(append(rdata, 255), text[:255]...)
+		text = text[255:]
+	}
+
+	return append(append(rdata, byte(len(text))), text...)
+}
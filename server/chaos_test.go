@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestChaos(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	h := Chain(nameHandler("h"), Chaos(map[string]string{
+		VersionBind:  "tdr 1.0",
+		"ID.SERVER":  long,
+		HostnameBind: "",
+	}))
+
+	tests := []struct {
+		name    string
+		class   dns.Class
+		qt      dns.QType
+		rcode   dns.RCode
+		answers int
+		text    string
+	}{
+		{"version.bind.", dns.ClassCH, dns.TypeTXT, dns.RCodeNoError, 1, `"tdr 1.0"`},
+		{"VERSION.BIND.", dns.ClassCH, dns.TypeANY, dns.RCodeNoError, 1, `"tdr 1.0"`},
+		{"version.bind.", dns.ClassCH, dns.TypeA, dns.RCodeNoError, 0, ""},
+		{"id.server.", dns.ClassCH, dns.TypeTXT, dns.RCodeNoError, 1, `"` + long[:255] + `" "` + long[255:] + `"`},
+		{"hostname.bind.", dns.ClassCH, dns.TypeTXT, dns.RCodeRefused, 0, ""},
+
+		// Other queries are passed to the handler.
+		{"version.bind.", dns.ClassIN, dns.TypeTXT, dns.RCodeNoError, 1, ""},
+		{"authors.bind.", dns.ClassCH, dns.TypeTXT, dns.RCodeNoError, 1, ""},
+	}
+	for _, tt := range tests {
+		query := newQuery(t, tt.name, tt.qt)
+		query.Question.QClass = tt.class
+		resp := serve(t, h, query)
+		if resp.RCode != tt.rcode || len(resp.Answer) != tt.answers {
+			t.Errorf(
+				"%s %s %s: got %s with %d answers - want %s with %d",
+				tt.name, tt.class, tt.qt, resp.RCode, len(resp.Answer), tt.rcode, tt.answers,
+			)
+			continue
+		}
+		if tt.text == "" {
+			continue
+		}
+		rr := resp.Answer[0]
+		if rr.Class != dns.ClassCH || rr.Type != dns.TypeTXT || rr.RDataUnpacked != tt.text {
+			t.Errorf("%s: got %s %s %s - want CH TXT %s", tt.name, rr.Class, rr.Type, rr.RDataUnpacked, tt.text)
+		}
+		if resp.AA != 1 {
+			t.Errorf("%s: expected authoritative answer", tt.name)
+		}
+	}
+}
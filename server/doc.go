@@ -0,0 +1,15 @@
+// Package server implements a DNS server; it reads queries over UDP, TCP and
+// HTTPS, passes them to a handler, and writes the responses. The Authority
+// handler answers queries authoritatively from zones (and serves zone
+// transfers), the Secondary handler does the same for a zone it transfers
+// from its primaries, the Recursive handler resolves queries, and the
+// Forwarder handler relays them to upstream resolvers.
+//
+// Handlers can be combined with a ServeMux, which passes every query to the
+// handler of the closest enclosing zone and query type, or with Views, which
+// pass every query to the handler of the view of the client, and wrapped with
+// middleware (e.g. Logging, QueryLog, RateLimit, Cache, Blocklist, RPZ or
+// LocalRecords) to build custom DNS services.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2
+package server
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// Policy determines the order in which a Forwarder tries its upstreams.
+type Policy int
+
+const (
+	// PolicyRoundRobin starts at the next upstream for every query, so queries
+	// are spread evenly over the upstreams.
+	PolicyRoundRobin Policy = iota
+
+	// PolicyFastest prefers the upstream with the lowest smoothed round-trip
+	// time.
+	PolicyFastest
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	if p == PolicyFastest {
+		return "fastest"
+	}
+
+	return "round-robin"
+}
+
+const (
+	// DefaultForwardTimeout is the time a Forwarder waits for the response of a
+	// single upstream.
+	DefaultForwardTimeout = time.Second * 2
+
+	// maxUpstreamFailures is the number of consecutive failures after which an
+	// upstream is considered unhealthy.
+	maxUpstreamFailures = 3
+
+	// unknownUpstreamRTT is the assumed round-trip time of an upstream that
+	// wasn't queried before; it's low enough for new upstreams to be tried.
+	unknownUpstreamRTT = time.Millisecond * 50
+)
+
+// Upstream is a recursive resolver that a Forwarder relays queries to.
+type Upstream struct {
+	// Addr is the address of the upstream: "host:port" for UDP and TLS, and the
+	// URL of the DNS API endpoint for HTTPS.
+	Addr string
+
+	// Transport sends the queries (e.g. resolver.UDP, resolver.TLS or
+	// resolver.HTTPS).
+	Transport resolver.Transport
+}
+
+// upstreamState is an upstream with its health statistics.
+type upstreamState struct {
+	Upstream
+
+	// mu guards all fields below.
+	mu sync.Mutex
+
+	// srtt is the smoothed round-trip time; zero when it's unknown.
+	srtt time.Duration
+
+	// failures is the number of consecutive failures.
+	failures int
+}
+
+// healthy checks if the upstream had fewer consecutive failures than allowed.
+func (u *upstreamState) healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.failures < maxUpstreamFailures
+}
+
+// rtt returns the smoothed round-trip time, or the assumed one when it's
+// unknown.
+func (u *upstreamState) rtt() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.srtt == 0 {
+		return unknownUpstreamRTT
+	}
+
+	return u.srtt
+}
+
+// success records a response that was received after the round-trip time.
+func (u *upstreamState) success(rtt time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// Smooth the round-trip time like TCP does.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc6298#section-2
+	if u.srtt == 0 {
+		u.srtt = rtt
+	} else {
+		u.srtt = (u.srtt*7 + rtt) / 8
+	}
+	u.failures = 0
+}
+
+// failure records a failed query.
+func (u *upstreamState) failure() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.failures++
+}
+
+// Forwarder is a handler that relays queries to upstream recursive resolvers
+// (i.e. it's a forwarding proxy). The policy determines which upstream is
+// tried first; when it fails (or answers with SERVFAIL or REFUSED), the query
+// fails over to the next one. Upstreams that failed several times in a row are
+// only tried after the healthy ones, until a query or health check to them
+// succeeds again.
+type Forwarder struct {
+	upstreams []*upstreamState
+	policy    Policy
+
+	// timeout is the time to wait for the response of a single upstream.
+	timeout time.Duration
+
+	// next is the index of the upstream that's tried first by the next query
+	// (with PolicyRoundRobin).
+	next uint32
+}
+
+// NewForwarder creates a Forwarder that relays queries to the upstreams, and
+// waits for the timeout for a response of each one; a zero timeout uses
+// DefaultForwardTimeout.
+func NewForwarder(policy Policy, timeout time.Duration, upstreams ...Upstream) *Forwarder {
+	if timeout <= 0 {
+		timeout = DefaultForwardTimeout
+	}
+
+	f := &Forwarder{policy: policy, timeout: timeout}
+	for _, u := range upstreams {
+		f.upstreams = append(f.upstreams, &upstreamState{Upstream: u})
+	}
+
+	return f
+}
+
+// ServeDNS relays the query to the upstreams, and answers with the response of
+// the first one that succeeds. Queries of a class other than IN are refused,
+// and queries that no upstream answers are answered with SERVFAIL. ANY queries
+// received over UDP aren't relayed; they're answered with a synthesized HINFO
+// resource record.
+func (f *Forwarder) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	q := query.Question
+	if query.OpCode != dns.OpCodeQuery {
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+		return
+	}
+	if q.QClass != dns.ClassIN {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+	if minimalANY(w, query) {
+		resp := hinfoReply(query)
+		resp.RA = 1
+		w.WriteMsg(resp)
+		return
+	}
+
+	dnssec := false
+	if opt := query.OPT(); opt != nil {
+		dnssec = opt.DO()
+	}
+	for _, u := range f.order() {
+		msg, err := f.exchange(ctx, u, q.QName, q.QType, dnssec)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		resp := Reply(query, msg.RCode)
+		resp.RA = 1
+		resp.Answer = msg.Answer
+		resp.Authority = msg.Authority
+		for _, rr := range msg.Additional {
+			if rr.Type != dns.TypeOPT {
+				resp.Additional = append(resp.Additional, rr)
+			}
+		}
+		w.WriteMsg(resp)
+		return
+	}
+
+	resp := Reply(query, dns.RCodeServerFailure)
+	resp.RA = 1
+	w.WriteMsg(resp)
+}
+
+// HealthCheck queries every upstream for the NS resource records of the root
+// at the interval, until the context is canceled; an unhealthy upstream
+// becomes healthy again when it answers.
+func (f *Forwarder) HealthCheck(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, u := range f.upstreams {
+			wg.Add(1)
+			go func(u *upstreamState) {
+				defer wg.Done()
+				f.exchange(ctx, u, ".", dns.TypeNS, false)
+			}(u)
+		}
+		wg.Wait()
+	}
+}
+
+// order returns the upstreams in the order they're tried: healthy upstreams
+// first, ordered by the policy.
+func (f *Forwarder) order() []*upstreamState {
+	n := len(f.upstreams)
+	ordered := make([]*upstreamState, 0, n)
+	switch f.policy {
+	case PolicyFastest:
+		ordered = append(ordered, f.upstreams...)
+		rtts := make(map[*upstreamState]time.Duration, n)
+		for _, u := range ordered {
+			rtts[u] = u.rtt()
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return rtts[ordered[i]] < rtts[ordered[j]]
+		})
+	default:
+		start := int(atomic.AddUint32(&f.next, 1)-1) % n
+		for i := 0; i < n; i++ {
+			ordered = append(ordered, f.upstreams[(start+i)%n])
+		}
+	}
+
+	healthy := make(map[*upstreamState]bool, n)
+	for _, u := range ordered {
+		healthy[u] = u.healthy()
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return healthy[ordered[i]] && !healthy[ordered[j]]
+	})
+
+	return ordered
+}
+
+// exchange sends a query to the upstream, and records the outcome in its
+// statistics. A SERVFAIL or REFUSED response counts as a failure.
+func (f *Forwarder) exchange(
+	ctx context.Context,
+	u *upstreamState,
+	name string,
+	qt dns.QType,
+	dnssec bool,
+) (*dns.Msg, error) {
+	query := new(dns.Msg)
+	if err := query.SetQuery(name, qt); err != nil {
+		return nil, err
+	}
+	query.SetEDNS0(dns.DefaultEDNSUDPSize, dnssec)
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := u.Transport.Exchange(ctx, query, u.Addr)
+	if err == nil {
+		switch resp.RCode {
+		case dns.RCodeServerFailure, dns.RCodeRefused:
+			err = fmt.Errorf("upstream %s: %s", u.Addr, resp.RCode)
+		}
+	}
+	if err != nil {
+		u.failure()
+		return nil, err
+	}
+	u.success(time.Since(start))
+
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// DefaultHTTPPath is the path of the DNS API endpoint of a DNS over HTTPS
+// server.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484#section-3
+const DefaultHTTPPath = "/dns-query"
+
+// dnsMessageType is the media type of a DNS message in wire format.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484#section-6
+const dnsMessageType = "application/dns-message"
+
+// ServeHTTP serves a query that's sent over HTTP (DNS over HTTPS, when it's
+// served over TLS) with the GET method, base64url encoded in the "dns" query
+// parameter, or with the POST method, in the request body. The query is
+// passed to the handler like the queries read over UDP and TCP, and the
+// response is written in the response body; it can be cached by HTTP caches
+// for as long as its TTLs allow. The server doesn't route requests; it serves
+// every path (see DefaultHTTPPath).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484#section-4.1
+func (s *Server) ServeHTTP(hw http.ResponseWriter, r *http.Request) {
+	var queryb []byte
+	switch r.Method {
+	case http.MethodGet:
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || len(b) == 0 {
+			http.Error(hw, "invalid or missing dns query parameter", http.StatusBadRequest)
+			return
+		}
+		queryb = b
+	case http.MethodPost:
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != dnsMessageType {
+			http.Error(hw, fmt.Sprintf("unsupported content type %q", mt), http.StatusUnsupportedMediaType)
+			return
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxMsgSize+1))
+		if err != nil {
+			http.Error(hw, "failed to read dns query", http.StatusBadRequest)
+			return
+		}
+		if len(b) > maxMsgSize {
+			http.Error(hw, "dns query exceeds the max message size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		queryb = b
+	default:
+		hw.Header().Set("Allow", "GET, POST")
+		http.Error(hw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w := &responseWriter{hw: hw, raddr: httpRemoteAddr(r)}
+	if laddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		w.laddr = laddr
+	}
+	s.respond(r.Context(), queryb, w)
+
+	// Messages that must be ignored (e.g. responses), and queries the handler
+	// doesn't answer, still get an HTTP response.
+	if !w.written {
+		http.Error(hw, "dns query wasn't answered", http.StatusBadRequest)
+	}
+}
+
+// httpRemoteAddr returns the address of the client of the HTTP request.
+func httpRemoteAddr(r *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+
+	return addr
+}
+
+// writeHTTP writes the packed response as the body of the HTTP response.
+func (w *responseWriter) writeHTTP(b []byte) (int, error) {
+	if w.written {
+		return 0, fmt.Errorf("only a single response can be written over https")
+	}
+	w.written = true
+
+	h := w.hw.Header()
+	h.Set("Content-Type", dnsMessageType)
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	h.Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge(b)))
+	w.hw.WriteHeader(http.StatusOK)
+
+	return w.hw.Write(b)
+}
+
+// maxAge returns the number of seconds the packed response may be cached: the
+// smallest TTL of its answer section, or, for a negative answer, the TTL of its
+// SOA resource record (bounded by the SOA minimum field). Other responses
+// (e.g. errors) aren't cached.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8484#section-5.1
+// See: https://datatracker.ietf.org/doc/html/rfc2308#section-5
+func maxAge(b []byte) uint32 {
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(b); err != nil || resp.TC == 1 {
+		return 0
+	}
+	if resp.RCode != dns.RCodeNoError && resp.RCode != dns.RCodeNameError {
+		return 0
+	}
+
+	if len(resp.Answer) > 0 {
+		age := resp.Answer[0].TTL
+		for _, rr := range resp.Answer[1:] {
+			if rr.TTL < age {
+				age = rr.TTL
+			}
+		}
+		return age
+	}
+	for _, rr := range resp.Authority {
+		if rr.Type != dns.TypeSOA {
+			continue
+		}
+		rd, err := rr.Decode()
+		if err != nil {
+			return 0
+		}
+		if min := rd.(*dns.SOA).Minimum; min < rr.TTL {
+			return min
+		}
+		return rr.TTL
+	}
+
+	return 0
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// startHTTPSServer serves the handler over HTTPS at DefaultHTTPPath, and
+// returns the URL of the endpoint and the HTTP client that trusts the server.
+func startHTTPSServer(t *testing.T, h Handler) (string, *http.Client) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(DefaultHTTPPath, &Server{Handler: h})
+	ts := httptest.NewTLSServer(mux)
+	t.Cleanup(ts.Close)
+
+	return ts.URL + DefaultHTTPPath, ts.Client()
+}
+
+func TestServeHTTPPost(t *testing.T) {
+	a := newTestAuthority(t)
+	a.AllowTransfer(loopback)
+	url, client := startHTTPSServer(t, a)
+	tr := resolver.NewHTTPSTransport(client)
+
+	query := new(dns.Msg)
+	if err := query.SetQuery("www.example.org.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.Exchange(context.Background(), query, url)
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if resp.RCode != dns.RCodeNoError || len(resp.Answer) != 1 || resp.AA != 1 {
+		t.Errorf("got response %+v", resp)
+	}
+
+	// Zone transfers aren't served over HTTPS.
+	query = new(dns.Msg)
+	if err := query.SetQuery("example.org.", dns.TypeAXFR); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = tr.Exchange(context.Background(), query, url)
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if resp.RCode != dns.RCodeNotImplemented {
+		t.Errorf("got rcode %s for a zone transfer, want NOTIMP", resp.RCode)
+	}
+}
+
+func TestServeHTTPGet(t *testing.T) {
+	url, client := startHTTPSServer(t, newTestAuthority(t))
+
+	tests := []struct {
+		name         string
+		rcode        dns.RCode
+		cacheControl string
+	}{
+		{name: "www.example.org.", rcode: dns.RCodeNoError, cacheControl: "max-age=3600"},
+		// The SOA minimum bounds the TTL of a negative answer.
+		{name: "nope.example.org.", rcode: dns.RCodeNameError, cacheControl: "max-age=300"},
+		{name: "www.example.com.", rcode: dns.RCodeRefused, cacheControl: "max-age=0"},
+	}
+	for _, tt := range tests {
+		query := new(dns.Msg)
+		if err := query.SetQuery(tt.name, dns.TypeA); err != nil {
+			t.Fatal(err)
+		}
+		query.ID = 0
+		b, err := query.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := client.Get(url + "?dns=" + base64.RawURLEncoding.EncodeToString(b))
+		if err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %s", tt.name, res.Status)
+		}
+		if got := res.Header.Get("Content-Type"); got != dnsMessageType {
+			t.Errorf("%s content type error: got %v - want %v", tt.name, got, dnsMessageType)
+		}
+		if got := res.Header.Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("%s cache control error: got %v - want %v", tt.name, got, tt.cacheControl)
+		}
+		resp := new(dns.Msg)
+		if _, err := resp.Unpack(body); err != nil {
+			t.Fatalf("failed to unpack response: %v", err)
+		}
+		if resp.RCode != tt.rcode || resp.ID != 0 {
+			t.Errorf("%s: got rcode %s and ID %d, want %s and 0", tt.name, resp.RCode, resp.ID, tt.rcode)
+		}
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	url, client := startHTTPSServer(t, newTestAuthority(t))
+
+	tests := []struct {
+		desc   string
+		method string
+		url    string
+		ctype  string
+		body   []byte
+		status int
+	}{
+		{desc: "missing parameter", method: http.MethodGet, url: url, status: http.StatusBadRequest},
+		{desc: "invalid parameter", method: http.MethodGet, url: url + "?dns=!", status: http.StatusBadRequest},
+		{desc: "content type", method: http.MethodPost, url: url, ctype: "text/plain", body: []byte("x"), status: http.StatusUnsupportedMediaType},
+		{desc: "method", method: http.MethodPut, url: url, status: http.StatusMethodNotAllowed},
+		// A response isn't answered.
+		{desc: "response", method: http.MethodPost, url: url, ctype: dnsMessageType, body: make([]byte, 12), status: http.StatusBadRequest},
+	}
+	tests[4].body[2] = 0x80
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, bytes.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.ctype != "" {
+			req.Header.Set("Content-Type", tt.ctype)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("%s status error: got %v - want %v", tt.desc, res.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// maxLocalCNAMEChain is the max number of local CNAME resource records that
+// are followed to answer a query.
+const maxLocalCNAMEChain = 8
+
+// LocalRecordsStats are the statistics of LocalRecords.
+type LocalRecordsStats struct {
+	// Names is the number of owner names of the records, and Answered is the
+	// number of queries that were answered from them.
+	Names    int
+	Answered uint64
+}
+
+// LocalRecords is a middleware that answers queries from static resource
+// records that take precedence over the ones of the handler, like the address
+// and host-record options of dnsmasq do (e.g. "nas.home. A 192.168.1.10"). A
+// wildcard owner name ("*.home.") matches the names below it that have no
+// records of their own. A query for a name with records, but none of the
+// query type, is answered with an empty answer, unless the name has a CNAME
+// resource record; then its target is looked up in the records, and resolved
+// by the handler when it's not in them.
+type LocalRecords struct {
+	// mu guards rrsets.
+	mu sync.RWMutex
+
+	// rrsets holds the resource records per (lower case) owner name.
+	rrsets map[string][]dns.RR
+
+	// answered counts the queries that were answered from the records.
+	answered atomic.Uint64
+}
+
+// NewLocalRecords creates LocalRecords of the resource records.
+func NewLocalRecords(rrs ...dns.RR) *LocalRecords {
+	l := &LocalRecords{}
+	l.Set(rrs...)
+
+	return l
+}
+
+// Set replaces the resource records (e.g. after the file they were parsed
+// from was edited).
+func (l *LocalRecords) Set(rrs ...dns.RR) {
+	rrsets := map[string][]dns.RR{}
+	for _, rr := range rrs {
+		owner := strings.ToLower(dns.Fqdn(rr.Name))
+		rrsets[owner] = append(rrsets[owner], rr)
+	}
+
+	l.mu.Lock()
+	l.rrsets = rrsets
+	l.mu.Unlock()
+}
+
+// Stats returns the statistics of the records.
+func (l *LocalRecords) Stats() LocalRecordsStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return LocalRecordsStats{Names: len(l.rrsets), Answered: l.answered.Load()}
+}
+
+// lookup returns the resource records of the name, or of the wildcard at its
+// closest ancestor with one; it returns nil when neither exists.
+func (l *LocalRecords) lookup(name string) []dns.RR {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if rrs, ok := l.rrsets[name]; ok {
+		return rrs
+	}
+	for name != "." {
+		name = dns.ParentDomainName(name)
+		wildcard := "*." + name
+		if name == "." {
+			wildcard = "*."
+		}
+		if rrs, ok := l.rrsets[wildcard]; ok {
+			return rrs
+		}
+	}
+
+	return nil
+}
+
+// Middleware answers queries for names with local records, and passes any
+// other query to the handler.
+func (l *LocalRecords) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			q := query.Question
+			if query.OpCode != dns.OpCodeQuery || q.QClass != dns.ClassIN {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			rrs := l.lookup(q.QName)
+			if rrs == nil {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			l.answered.Add(1)
+
+			w.WriteMsg(localAnswer(ctx, next, w, query, rrs, l.lookup))
+		})
+	}
+}
+
+// localAnswer returns the response to a query from the resource records of
+// its name: the ones of the query type, or the CNAME resource record. The
+// target of a CNAME resource record is looked up with lookup (which returns
+// nil for names without records), and resolved by the handler when it isn't
+// found.
+func localAnswer(
+	ctx context.Context,
+	next Handler,
+	w ResponseWriter,
+	query *dns.Msg,
+	rrs []dns.RR,
+	lookup func(name string) []dns.RR,
+) *dns.Msg {
+	q := query.Question
+	resp := Reply(query, dns.RCodeNoError)
+	resp.RA = 1
+
+	name := q.QName
+	for i := 0; i <= maxLocalCNAMEChain; i++ {
+		var cname *dns.RR
+		answered := false
+		for _, rr := range rrs {
+			rr := rr
+			switch {
+			case q.QType == dns.TypeANY || q.QType == rr.Type:
+				rr.Name = name
+				resp.Answer = append(resp.Answer, rr)
+				answered = true
+			case rr.Type == dns.TypeCNAME:
+				cname = &rr
+			}
+		}
+		if answered || cname == nil {
+			return resp
+		}
+
+		cname.Name = name
+		resp.Answer = append(resp.Answer, *cname)
+		name = cname.RDataUnpacked
+		if rrs = lookup(name); rrs == nil {
+			break
+		}
+	}
+	if rrs != nil {
+		return resp
+	}
+
+	tq := *query
+	tq.Question.QName = name
+	rw := &recordingWriter{
+		ResponseWriter: detachedWriter{laddr: w.LocalAddr(), raddr: w.RemoteAddr(), network: w.Network()},
+	}
+	next.ServeDNS(ctx, rw, &tq)
+	if rw.resp != nil {
+		resp.RCode = rw.resp.RCode
+		resp.Answer = append(resp.Answer, rw.resp.Answer...)
+	}
+
+	return resp
+}
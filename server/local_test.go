@@ -0,0 +1,66 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+func TestLocalRecords(t *testing.T) {
+	rrs, err := zone.Parse(strings.NewReader(`$ORIGIN home.
+nas 60 A 192.168.1.10
+nas 60 AAAA fd00::10
+files 60 CNAME nas
+www 60 CNAME example.org.
+loop1 60 CNAME loop2
+loop2 60 CNAME loop1
+*.lan 60 A 192.168.1.1
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLocalRecords(rrs...)
+	h := Chain(nameHandler("h"), l.Middleware())
+
+	tests := []struct {
+		name    string
+		qt      dns.QType
+		answers []string
+	}{
+		{"NAS.home.", dns.TypeA, []string{"192.168.1.10"}},
+		{"nas.home.", dns.TypeAAAA, []string{"fd00::10"}},
+		{"nas.home.", dns.TypeMX, []string{}},
+		{"files.home.", dns.TypeA, []string{"nas.home.", "192.168.1.10"}},
+		{"www.home.", dns.TypeA, []string{"example.org.", `"h"`}},
+		{"printer.lan.home.", dns.TypeA, []string{"192.168.1.1"}},
+
+		// Other names are passed to the handler.
+		{"home.", dns.TypeA, []string{`"h"`}},
+		{"tv.home.", dns.TypeA, []string{`"h"`}},
+	}
+	for _, tt := range tests {
+		resp := serve(t, h, newQuery(t, tt.name, tt.qt))
+		answers := []string{}
+		for _, rr := range resp.Answer {
+			answers = append(answers, rr.RDataUnpacked)
+		}
+		if len(resp.Answer) > 0 && !strings.EqualFold(resp.Answer[0].Name, tt.name) {
+			t.Errorf("%s %s: got owner %s", tt.name, tt.qt, resp.Answer[0].Name)
+		}
+		if resp.RCode != dns.RCodeNoError || strings.Join(answers, " ") != strings.Join(tt.answers, " ") {
+			t.Errorf("%s %s: got %s with answers %v - want %v", tt.name, tt.qt, resp.RCode, answers, tt.answers)
+		}
+	}
+
+	// A CNAME loop is followed up to the max chain length.
+	resp := serve(t, h, newQuery(t, "loop1.home.", dns.TypeA))
+	if len(resp.Answer) != maxLocalCNAMEChain+1 {
+		t.Errorf("got %d answers to a CNAME loop - want %d", len(resp.Answer), maxLocalCNAMEChain+1)
+	}
+
+	if st := l.Stats(); st.Names != 6 || st.Answered != 7 {
+		t.Errorf("got stats %+v - want 6 names and 7 answered", st)
+	}
+}
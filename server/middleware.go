@@ -0,0 +1,594 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Middleware wraps a handler, to act on queries before they're passed to it,
+// or on the responses it returns.
+type Middleware func(next Handler) Handler
+
+// Chain wraps the handler with the middleware. The first middleware is the
+// outermost one, so it sees the query first and the response last.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// Logging logs the client address and question of every query, with the
+// response code, number of answers and duration of its response.
+func Logging(l *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			start := time.Now()
+			rw := &recordingWriter{ResponseWriter: w}
+			next.ServeDNS(ctx, rw, query)
+
+			q := query.Question
+			if rw.resp == nil {
+				l.Printf(
+					"%s %s %s %s %s: no response (%s)",
+					w.Network(), w.RemoteAddr(), q.QName, q.QClass, q.QType, time.Since(start),
+				)
+				return
+			}
+			l.Printf(
+				"%s %s %s %s %s: %s, %d answers (%s)",
+				w.Network(), w.RemoteAddr(), q.QName, q.QClass, q.QType,
+				rw.resp.RCode, len(rw.resp.Answer), time.Since(start),
+			)
+		})
+	}
+}
+
+// recordingWriter is a response writer that records the (last) response that
+// was written with WriteMsg.
+type recordingWriter struct {
+	ResponseWriter
+
+	resp *dns.Msg
+}
+
+// WriteMsg records a copy of the response, and writes it.
+func (w *recordingWriter) WriteMsg(resp *dns.Msg) error {
+	// The response is copied before it's written, because writing it sets its
+	// header fields, and drops its sections when it's truncated. The sections
+	// are copied too, so the recorded response doesn't share resource records
+	// with one that's changed after it was written.
+	rec := *resp
+	rec.Answer = copyRRs(resp.Answer)
+	rec.Authority = copyRRs(resp.Authority)
+	rec.Additional = copyRRs(resp.Additional)
+	w.resp = &rec
+
+	return w.ResponseWriter.WriteMsg(resp)
+}
+
+// copyRRs returns a deep copy of the resource records.
+func copyRRs(rrs []dns.RR) []dns.RR {
+	if rrs == nil {
+		return nil
+	}
+
+	cp := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		rr.RData = append([]byte(nil), rr.RData...)
+		cp[i] = rr
+	}
+
+	return cp
+}
+
+// maxRateLimitClients is the max number of clients whose rates are tracked;
+// when there are more, clients that didn't send queries recently are
+// forgotten.
+const maxRateLimitClients = 10000
+
+// RateLimit limits the rate of queries per client IP address that are passed
+// to the handler to qps queries per second, with bursts of up to burst
+// queries. Queries over the limit are refused.
+func RateLimit(qps float64, burst int) Middleware {
+	return func(next Handler) Handler {
+		rl := newRateLimiter(qps, burst)
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			if !rl.allow(addrIP(w.RemoteAddr())) {
+				w.WriteMsg(Reply(query, dns.RCodeRefused))
+				return
+			}
+
+			next.ServeDNS(ctx, w, query)
+		})
+	}
+}
+
+// addrIP returns the IP address of a UDP or TCP address, and the address
+// itself otherwise.
+func addrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	case nil:
+		return ""
+	}
+
+	return addr.String()
+}
+
+// rateLimiter tracks the query rate of every client with a token bucket.
+type rateLimiter struct {
+	// mu guards buckets.
+	mu sync.Mutex
+
+	// rate is the number of tokens added per second, and burst is the max
+	// number of tokens.
+	rate  float64
+	burst float64
+
+	// buckets maps the IP address of a client to its token bucket.
+	buckets map[string]*tokenBucket
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// tokenBucket holds the tokens of a client; every query takes a token.
+type tokenBucket struct {
+	// tokens is the number of tokens at the last time a token was taken.
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a rateLimiter that doesn't track any clients.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the bucket of the client; it returns false when
+// the bucket is empty.
+func (rl *rateLimiter) allow(client string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[client]
+	if !ok {
+		if len(rl.buckets) >= maxRateLimitClients {
+			rl.forget(now)
+		}
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	}
+
+	return b.take(now, rl.rate, rl.burst)
+}
+
+// take refills the bucket at the rate (up to burst tokens) since the last
+// time a token was taken, and takes a token; it returns false when the bucket
+// is empty.
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// forget removes the buckets that are full again (i.e. of clients that didn't
+// send queries recently); when none are, it removes all buckets.
+func (rl *rateLimiter) forget(now time.Time) {
+	for client, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, client)
+		}
+	}
+	if len(rl.buckets) >= maxRateLimitClients {
+		rl.buckets = map[string]*tokenBucket{}
+	}
+}
+
+const (
+	// maxNegativeTTL is the max time a negative response (NXDOMAIN or NODATA)
+	// is cached.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2308#section-5
+	maxNegativeTTL = 3 * 60 * 60
+
+	// prefetchTimeout is the max time a cached response is refreshed for.
+	prefetchTimeout = time.Second * 30
+)
+
+// Cache caches the responses of the handler in a ResponseCache of maxEntries
+// responses (zero means there's no limit) that isn't shared.
+func Cache(maxEntries int) Middleware {
+	return NewResponseCache(maxEntries).Middleware()
+}
+
+// CacheStats are the statistics of a ResponseCache.
+type CacheStats struct {
+	// Hits is the number of queries that were answered from the cache, and
+	// Misses is the number of queries that were passed to the handler.
+	Hits   uint64
+	Misses uint64
+
+	// Evictions is the number of responses that were evicted to make room for
+	// other responses; expired responses that are removed aren't counted.
+	Evictions uint64
+
+	// Prefetches is the number of cached responses that were refreshed before
+	// they expired.
+	Prefetches uint64
+
+	// Entries is the number of cached responses.
+	Entries int
+}
+
+// ResponseCache is an in-memory LRU cache of responses, which answers
+// repeated queries until the lowest TTL of their response expires; the TTLs
+// of cached answers are decremented by the time they were cached. It holds
+// NOERROR responses with answers, and negative responses (NXDOMAIN, and
+// NOERROR without answers) with the SOA resource record of their zone, which
+// are cached for the TTL or minimum field of the SOA resource record
+// (whichever is lower), but for at most 3 hours. A ResponseCache is safe for
+// concurrent use, and can be shared by multiple handlers.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2308#section-5
+type ResponseCache struct {
+	// Prefetch is the percentage of the TTL of a cached response that must
+	// remain when it's served; when less remains, it's refreshed in the
+	// background, so popular responses don't expire. Zero disables
+	// prefetching. It must be set before the cache is used.
+	Prefetch int
+
+	// mu guards all fields below.
+	mu sync.Mutex
+
+	// maxEntries is the max number of entries; zero means no limit.
+	maxEntries int
+
+	// ll orders the entries from most- to least recently used.
+	ll *list.List
+
+	// entries maps a key to its element in ll.
+	entries map[responseKey]*list.Element
+
+	// refreshing holds the keys of the responses that are being refreshed.
+	refreshing map[responseKey]bool
+
+	stats CacheStats
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewResponseCache creates an empty ResponseCache that holds at most
+// maxEntries responses; zero means there's no limit.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		entries:    map[responseKey]*list.Element{},
+		refreshing: map[responseKey]bool{},
+		now:        time.Now,
+	}
+}
+
+// Middleware caches the responses of the handler, and answers repeated
+// queries from the cache. Only responses to standard queries are cached.
+func (c *ResponseCache) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			// NOTIFY messages and zone transfers (which may span multiple
+			// messages) aren't cached.
+			qt := query.Question.QType
+			if query.OpCode != dns.OpCodeQuery || qt == dns.TypeAXFR || qt == dns.TypeIXFR {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+
+			key := newResponseKey(query)
+			if resp, refresh, ok := c.get(key); ok {
+				setCacheStatus(ctx, CacheHit)
+				if refresh {
+					dw := detachedWriter{laddr: w.LocalAddr(), raddr: w.RemoteAddr(), network: w.Network()}
+					go c.refresh(next, dw, query, key)
+				}
+				resp.RD = query.RD
+				w.WriteMsg(resp)
+				return
+			}
+
+			setCacheStatus(ctx, CacheMiss)
+			rw := &recordingWriter{ResponseWriter: w}
+			next.ServeDNS(ctx, rw, query)
+			if rw.resp != nil {
+				c.set(key, rw.resp)
+			}
+		})
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+
+	return stats
+}
+
+// refresh passes the query to the handler again, and caches its response.
+func (c *ResponseCache) refresh(next Handler, w ResponseWriter, query *dns.Msg, key responseKey) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshing, key)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	defer cancel()
+
+	rw := &recordingWriter{ResponseWriter: w}
+	next.ServeDNS(ctx, rw, query)
+	if rw.resp != nil && c.set(key, rw.resp) {
+		c.mu.Lock()
+		c.stats.Prefetches++
+		c.mu.Unlock()
+	}
+}
+
+// detachedWriter is a response writer that discards the responses; it's used
+// to refresh cached responses after the client was answered.
+type detachedWriter struct {
+	laddr   net.Addr
+	raddr   net.Addr
+	network string
+}
+
+// LocalAddr returns the address the query was received on.
+func (w detachedWriter) LocalAddr() net.Addr {
+	return w.laddr
+}
+
+// RemoteAddr returns the address of the client.
+func (w detachedWriter) RemoteAddr() net.Addr {
+	return w.raddr
+}
+
+// Network returns the network the query was received over.
+func (w detachedWriter) Network() string {
+	return w.network
+}
+
+// WriteMsg discards the response.
+func (w detachedWriter) WriteMsg(resp *dns.Msg) error {
+	return nil
+}
+
+// Write discards the packed response.
+func (w detachedWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// responseKey identifies the cached response to a query.
+type responseKey struct {
+	name  string
+	typ   dns.Type
+	class dns.Class
+
+	// edns is set when the query has an OPT pseudo resource record, and dnssec
+	// when it requested DNSSEC resource records (i.e. it has the DO bit set).
+	edns   bool
+	dnssec bool
+}
+
+// newResponseKey creates the case-insensitive key of the response to the
+// query.
+func newResponseKey(query *dns.Msg) responseKey {
+	q := query.Question
+	key := responseKey{name: strings.ToLower(q.QName), typ: q.QType, class: q.QClass}
+	if opt := query.OPT(); opt != nil {
+		key.edns = true
+		key.dnssec = opt.DO()
+	}
+
+	return key
+}
+
+// responseEntry is a cached response.
+type responseEntry struct {
+	key  responseKey
+	resp *dns.Msg
+
+	// stored is the time the entry was stored, and expires the time it expires.
+	stored  time.Time
+	expires time.Time
+}
+
+// get returns a copy of the cached response for the key, with TTLs
+// decremented by the time it was cached. It reports whether the response
+// must be refreshed (see Prefetch); only one refresh per key runs at a time.
+func (c *ResponseCache) get(key responseKey) (*dns.Msg, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false, false
+	}
+	e := el.Value.(*responseEntry)
+	now := c.now()
+	if !now.Before(e.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		c.stats.Misses++
+		return nil, false, false
+	}
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+
+	elapsed := uint32(now.Sub(e.stored) / time.Second)
+	resp := *e.resp
+	resp.Answer = decrementTTLs(e.resp.Answer, elapsed)
+	resp.Authority = decrementTTLs(e.resp.Authority, elapsed)
+	resp.Additional = decrementTTLs(e.resp.Additional, elapsed)
+
+	refresh := false
+	if c.Prefetch > 0 && !c.refreshing[key] {
+		remaining, ttl := e.expires.Sub(now), e.expires.Sub(e.stored)
+		if remaining*100 < ttl*time.Duration(c.Prefetch) {
+			c.refreshing[key] = true
+			refresh = true
+		}
+	}
+
+	return &resp, refresh, true
+}
+
+// set caches the response for the key until its lowest TTL expires, or until
+// its negative TTL expires when it's a negative response. It reports whether
+// the response was cached.
+func (c *ResponseCache) set(key responseKey, resp *dns.Msg) bool {
+	if resp.TC == 1 {
+		return false
+	}
+
+	var ttl uint32
+	var ok bool
+	switch {
+	case resp.RCode == dns.RCodeNoError && len(resp.Answer) > 0:
+		ttl, ok = minTTL(resp)
+	case resp.RCode == dns.RCodeNoError || resp.RCode == dns.RCodeNameError:
+		ttl, ok = negativeTTL(resp)
+	}
+	if !ok || ttl == 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored := *resp
+	stored.Answer = append([]dns.RR{}, resp.Answer...)
+	stored.Authority = append([]dns.RR{}, resp.Authority...)
+	stored.Additional = append([]dns.RR{}, resp.Additional...)
+
+	now := c.now()
+	e := &responseEntry{
+		key:     key,
+		resp:    &stored,
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return true
+	}
+	c.entries[key] = c.ll.PushFront(e)
+
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.entries, el.Value.(*responseEntry).key)
+		c.stats.Evictions++
+	}
+
+	return true
+}
+
+// negativeTTL returns the time a negative response is cached: the TTL or
+// minimum field of the SOA resource record in its authority section (whichever
+// is lower), capped at maxNegativeTTL. It returns false when the response has
+// no SOA resource record, since it must not be cached then.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2308#section-5
+func negativeTTL(resp *dns.Msg) (uint32, bool) {
+	for _, rr := range resp.Authority {
+		if rr.Type != dns.TypeSOA {
+			continue
+		}
+		rd, err := rr.Decode()
+		if err != nil {
+			return 0, false
+		}
+		ttl := rr.TTL
+		if min := rd.(*dns.SOA).Minimum; min < ttl {
+			ttl = min
+		}
+		if ttl > maxNegativeTTL {
+			ttl = maxNegativeTTL
+		}
+		return ttl, true
+	}
+
+	return 0, false
+}
+
+// minTTL returns the lowest TTL of the resource records of the response
+// (excluding the OPT pseudo resource record); it returns false when there are
+// none.
+func minTTL(resp *dns.Msg) (uint32, bool) {
+	ttl, ok := uint32(0), false
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Authority, resp.Additional} {
+		for _, rr := range rrs {
+			if rr.Type == dns.TypeOPT {
+				continue
+			}
+			if !ok || rr.TTL < ttl {
+				ttl, ok = rr.TTL, true
+			}
+		}
+	}
+
+	return ttl, ok
+}
+
+// decrementTTLs returns a copy of the resource records with their TTLs
+// decremented by the elapsed seconds; the TTL of the OPT pseudo resource
+// record holds flags, so it's kept.
+func decrementTTLs(rrs []dns.RR, elapsed uint32) []dns.RR {
+	if rrs == nil {
+		return nil
+	}
+
+	dec := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		if rr.Type != dns.TypeOPT {
+			if rr.TTL > elapsed {
+				rr.TTL -= elapsed
+			} else {
+				rr.TTL = 0
+			}
+		}
+		dec[i] = rr
+	}
+
+	return dec
+}
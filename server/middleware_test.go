@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestChain(t *testing.T) {
+	order := []string{}
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+				order = append(order, name)
+				next.ServeDNS(ctx, w, query)
+			})
+		}
+	}
+
+	h := Chain(nameHandler("h"), mw("a"), mw("b"))
+	serve(t, h, newQuery(t, "example.org.", dns.TypeA))
+	if got := strings.Join(order, ","); got != "a,b" {
+		t.Errorf("got order %s - want a,b", got)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	h := Chain(nameHandler("h"), Logging(log.New(&buf, "", 0)))
+	serve(t, h, newQuery(t, "example.org.", dns.TypeA))
+
+	if got := buf.String(); !strings.HasPrefix(got, "udp 192.0.2.1:5353 example.org. IN A: No Error, 1 answers") {
+		t.Errorf("got log %q", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := Chain(nameHandler("h"), RateLimit(1, 2))
+	query := newQuery(t, "example.org.", dns.TypeA)
+
+	rcodes := []dns.RCode{}
+	for i := 0; i < 3; i++ {
+		rcodes = append(rcodes, serve(t, h, query).RCode)
+	}
+	want := []dns.RCode{dns.RCodeNoError, dns.RCodeNoError, dns.RCodeRefused}
+	for i := range want {
+		if rcodes[i] != want[i] {
+			t.Errorf("query %d: got %s - want %s", i, rcodes[i], want[i])
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter(2, 1)
+	rl.now = func() time.Time { return now }
+
+	if !rl.allow("192.0.2.1") {
+		t.Fatalf("expected new client to be allowed")
+	}
+	if rl.allow("192.0.2.1") {
+		t.Fatalf("expected client over the limit not to be allowed")
+	}
+
+	// Clients are limited separately.
+	if !rl.allow("192.0.2.2") {
+		t.Errorf("expected other client to be allowed")
+	}
+
+	// Tokens are added at the rate.
+	now = now.Add(time.Millisecond * 500)
+	if !rl.allow("192.0.2.1") {
+		t.Errorf("expected client to be allowed again")
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := 0
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		calls++
+		resp := Reply(query, dns.RCodeNoError)
+		rr, err := dns.NewRR(query.Question.QName, dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+		if err != nil {
+			return
+		}
+		resp.Answer = []dns.RR{rr}
+		if query.Question.QType == dns.TypeAAAA {
+			resp.RCode = dns.RCodeServerFailure
+		}
+		w.WriteMsg(resp)
+	}), Cache(10))
+
+	query := newQuery(t, "example.org.", dns.TypeA)
+	serve(t, h, query)
+	query = newQuery(t, "EXAMPLE.org.", dns.TypeA)
+	resp := serve(t, h, query)
+	if calls != 1 {
+		t.Errorf("got %d calls - want 1", calls)
+	}
+	if resp.ID != query.ID || resp.Question.QName != "EXAMPLE.org." || len(resp.Answer) != 1 {
+		t.Errorf("cached response doesn't match the query")
+	}
+
+	// Failures aren't cached.
+	query = newQuery(t, "example.org.", dns.TypeAAAA)
+	serve(t, h, query)
+	serve(t, h, query)
+	if calls != 3 {
+		t.Errorf("got %d calls - want 3", calls)
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewResponseCache(0)
+	c.now = func() time.Time { return now }
+
+	query := newQuery(t, "example.org.", dns.TypeA)
+	resp := Reply(query, dns.RCodeNoError)
+	rr, err := dns.NewRR("example.org.", dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Answer = []dns.RR{rr}
+	key := newResponseKey(query)
+	c.set(key, resp)
+
+	now = now.Add(time.Second * 20)
+	cached, _, ok := c.get(key)
+	if !ok {
+		t.Fatalf("expected cached response")
+	}
+	if ttl := cached.Answer[0].TTL; ttl != 40 {
+		t.Errorf("got TTL %d - want 40", ttl)
+	}
+
+	now = now.Add(time.Second * 40)
+	if _, _, ok := c.get(key); ok {
+		t.Errorf("expected expired response not to be returned")
+	}
+}
+
+func TestResponseCacheNegative(t *testing.T) {
+	c := NewResponseCache(0)
+	soa, err := (&dns.SOA{
+		MName: "ns1.example.org.", RName: "hostmaster.example.org.", Serial: 1, Minimum: 300,
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := dns.NewRR("example.org.", dns.TypeSOA, dns.ClassIN, 3600, soa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The negative TTL is the minimum field of the SOA record, which is lower
+	// than its TTL.
+	query := newQuery(t, "nxdomain.example.org.", dns.TypeA)
+	resp := Reply(query, dns.RCodeNameError)
+	resp.Authority = []dns.RR{rr}
+	key := newResponseKey(query)
+	if !c.set(key, resp) {
+		t.Fatalf("expected nxdomain response to be cached")
+	}
+	e := c.entries[key].Value.(*responseEntry)
+	if ttl := e.expires.Sub(e.stored); ttl != time.Second*300 {
+		t.Errorf("got negative TTL %s - want 5m0s", ttl)
+	}
+
+	// Negative responses without SOA record aren't cached.
+	query = newQuery(t, "nodata.example.org.", dns.TypeA)
+	if c.set(newResponseKey(query), Reply(query, dns.RCodeNoError)) {
+		t.Errorf("expected nodata response without SOA record not to be cached")
+	}
+}
+
+func TestResponseCacheStats(t *testing.T) {
+	c := NewResponseCache(1)
+	for _, name := range []string{"a.example.org.", "b.example.org."} {
+		query := newQuery(t, name, dns.TypeA)
+		resp := Reply(query, dns.RCodeNoError)
+		rr, err := dns.NewRR(name, dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Answer = []dns.RR{rr}
+		c.set(newResponseKey(query), resp)
+	}
+	c.get(newResponseKey(newQuery(t, "a.example.org.", dns.TypeA)))
+	c.get(newResponseKey(newQuery(t, "b.example.org.", dns.TypeA)))
+
+	want := CacheStats{Hits: 1, Misses: 1, Evictions: 1, Entries: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("got stats %+v - want %+v", got, want)
+	}
+}
+
+func TestResponseCachePrefetch(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewResponseCache(0)
+	c.Prefetch = 10
+	c.now = func() time.Time { return now }
+
+	refreshed := make(chan struct{})
+	calls := 0
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		calls++
+		resp := Reply(query, dns.RCodeNoError)
+		rr, err := dns.NewRR(query.Question.QName, dns.TypeA, dns.ClassIN, 100, []byte{192, 0, 2, 1})
+		if err != nil {
+			return
+		}
+		resp.Answer = []dns.RR{rr}
+		w.WriteMsg(resp)
+		if calls == 2 {
+			close(refreshed)
+		}
+	}), c.Middleware())
+
+	query := newQuery(t, "example.org.", dns.TypeA)
+	serve(t, h, query)
+
+	// Within the last 10% of its TTL, the cached response is served, and
+	// refreshed in the background.
+	now = now.Add(time.Second * 95)
+	if resp := serve(t, h, query); resp.Answer[0].TTL != 5 {
+		t.Errorf("got TTL %d - want 5", resp.Answer[0].TTL)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected cached response to be refreshed")
+	}
+	for i := 0; i < 100 && c.Stats().Prefetches == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if got := c.Stats().Prefetches; got != 1 {
+		t.Errorf("got %d prefetches - want 1", got)
+	}
+	if resp := serve(t, h, query); resp.Answer[0].TTL != 100 {
+		t.Errorf("got TTL %d after refresh - want 100", resp.Answer[0].TTL)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// anyType matches queries of any type in a ServeMux.
+const anyType dns.Type = 0
+
+// ServeMux is a handler that passes every query to the handler registered for
+// the closest zone that encloses the query name (i.e. the longest matching
+// zone suffix) and the query type. A handler registered for a zone and a type
+// takes precedence over the handler for all types of the zone. Queries that
+// don't match any zone are refused.
+//
+// A ServeMux is safe for concurrent use; handlers can be registered while it
+// serves queries.
+type ServeMux struct {
+	// mu guards zones.
+	mu sync.RWMutex
+
+	// zones maps a (lower case) zone to its handlers per query type.
+	zones map[string]map[dns.Type]Handler
+}
+
+// NewServeMux creates a ServeMux without handlers.
+func NewServeMux() *ServeMux {
+	return &ServeMux{zones: map[string]map[dns.Type]Handler{}}
+}
+
+// Handle registers the handler for queries of any type for names in the zone
+// (e.g. "example.org." or "." for all names). It replaces the handler that was
+// registered for the zone before.
+func (m *ServeMux) Handle(zone string, h Handler) {
+	m.HandleType(zone, anyType, h)
+}
+
+// HandleType registers the handler for queries of the type for names in the
+// zone. It replaces the handler that was registered for the zone and type
+// before.
+func (m *ServeMux) HandleType(zone string, qt dns.QType, h Handler) {
+	if h == nil {
+		panic("server: nil handler")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zone = muxKey(zone)
+	if m.zones[zone] == nil {
+		m.zones[zone] = map[dns.Type]Handler{}
+	}
+	m.zones[zone][qt] = h
+}
+
+// HandleFunc registers the function as the handler for queries of any type for
+// names in the zone.
+func (m *ServeMux) HandleFunc(zone string, f func(ctx context.Context, w ResponseWriter, query *dns.Msg)) {
+	m.Handle(zone, HandlerFunc(f))
+}
+
+// Handler returns the handler for the query name and type, or nil when no
+// zone matches.
+func (m *ServeMux) Handler(name string, qt dns.QType) Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for n := muxKey(name); ; {
+		if hs, ok := m.zones[n]; ok {
+			if h, ok := hs[qt]; ok {
+				return h
+			}
+			if h, ok := hs[anyType]; ok {
+				return h
+			}
+		}
+		if n == "." {
+			return nil
+		}
+		n = dns.ParentDomainName(n)
+	}
+}
+
+// ServeDNS passes the query to the handler for its name and type, and refuses
+// it when there's none.
+func (m *ServeMux) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	h := m.Handler(query.Question.QName, query.Question.QType)
+	if h == nil {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	h.ServeDNS(ctx, w, query)
+}
+
+// muxKey returns the fully qualified, lower case domain name.
+func muxKey(name string) string {
+	name = strings.ToLower(name)
+	name = dns.Fqdn(name)
+
+	return name
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// nameHandler answers every query with a TXT resource record that holds its
+// name.
+func nameHandler(name string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		resp := Reply(query, dns.RCodeNoError)
+		rr, err := dns.NewRR(query.Question.QName, dns.TypeTXT, dns.ClassIN, 60, append([]byte{byte(len(name))}, name...))
+		if err != nil {
+			return
+		}
+		resp.Answer = []dns.RR{rr}
+		w.WriteMsg(resp)
+	})
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("example.org", nameHandler("example"))
+	mux.Handle("sub.example.org.", nameHandler("sub"))
+	mux.HandleType("example.org.", dns.TypeMX, nameHandler("mx"))
+	mux.HandleFunc("net.", func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		w.WriteMsg(Reply(query, dns.RCodeNameError))
+	})
+
+	tests := []struct {
+		name  string
+		qt    dns.QType
+		rcode dns.RCode
+		want  string
+	}{
+		{"example.org.", dns.TypeA, dns.RCodeNoError, "example"},
+		{"WWW.Example.ORG.", dns.TypeAAAA, dns.RCodeNoError, "example"},
+		{"www.sub.example.org.", dns.TypeA, dns.RCodeNoError, "sub"},
+		{`www.a\.sub.example.org.`, dns.TypeA, dns.RCodeNoError, "example"},
+		{"www.example.org.", dns.TypeMX, dns.RCodeNoError, "mx"},
+		{"www.sub.example.org.", dns.TypeMX, dns.RCodeNoError, "sub"},
+		{"example.net.", dns.TypeA, dns.RCodeNameError, ""},
+		{"example.com.", dns.TypeA, dns.RCodeRefused, ""},
+		{"notexample.org.", dns.TypeA, dns.RCodeRefused, ""},
+	}
+
+	for _, tc := range tests {
+		resp := serve(t, mux, newQuery(t, tc.name, tc.qt))
+		if resp.RCode != tc.rcode {
+			t.Errorf("%s %s: got %s - want %s", tc.name, tc.qt, resp.RCode, tc.rcode)
+			continue
+		}
+		got := ""
+		if len(resp.Answer) > 0 {
+			got = resp.Answer[0].RDataUnpacked
+		}
+		if want := `"` + tc.want + `"`; tc.want != "" && got != want {
+			t.Errorf("%s %s: got handler %s - want %s", tc.name, tc.qt, got, want)
+		}
+	}
+
+	// The root matches all names.
+	mux.Handle(".", nameHandler("root"))
+	resp := serve(t, mux, newQuery(t, "example.com.", dns.TypeA))
+	if len(resp.Answer) != 1 || resp.Answer[0].RDataUnpacked != `"root"` {
+		t.Errorf("root error: expected root handler to answer")
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// QueryLogFormat is the format of the entries of a QueryLog.
+type QueryLogFormat int
+
+const (
+	// QueryLogText writes every entry as a line of space separated fields:
+	// the time, client, network, name, class, type, response code, number of
+	// answers, latency and cache status of the query.
+	QueryLogText QueryLogFormat = iota
+
+	// QueryLogJSON writes every entry as a JSON object on a line of its own.
+	QueryLogJSON
+)
+
+// String returns the name of the format.
+func (f QueryLogFormat) String() string {
+	switch f {
+	case QueryLogText:
+		return "text"
+	case QueryLogJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("QueryLogFormat(%d)", int(f))
+	}
+}
+
+// Cache statuses of a query (see QueryLogEntry).
+const (
+	// CacheHit means the query was answered from a ResponseCache.
+	CacheHit = "hit"
+
+	// CacheMiss means the query was passed to the handler of a ResponseCache.
+	CacheMiss = "miss"
+
+	// CacheNone means no ResponseCache was consulted for the query (e.g. it
+	// isn't cacheable, or the server doesn't cache).
+	CacheNone = "-"
+)
+
+// QueryLogEntry is the entry of a query in a QueryLog.
+type QueryLogEntry struct {
+	Time    time.Time `json:"time"`
+	Client  string    `json:"client"`
+	Network string    `json:"network"`
+	QName   string    `json:"qname"`
+	QClass  string    `json:"qclass"`
+	QType   string    `json:"qtype"`
+
+	// RCode is the mnemonic of the response code (e.g. "NXDOMAIN"), or "none"
+	// when the query wasn't answered.
+	RCode   string `json:"rcode"`
+	Answers int    `json:"answers"`
+
+	// Latency is the time it took to answer the query.
+	Latency time.Duration `json:"-"`
+
+	// LatencyMS is the latency in milliseconds, which is what's written in JSON.
+	LatencyMS float64 `json:"latency_ms"`
+
+	// Cache is the cache status: CacheHit, CacheMiss or CacheNone.
+	Cache string `json:"cache"`
+}
+
+// QueryLog writes an entry for every query that's passed to its middleware
+// (or a sample of them). Entries are written in the order their queries were
+// answered. A QueryLog is safe for concurrent use.
+type QueryLog struct {
+	// SampleRate is the fraction of the queries that are logged, between 0
+	// and 1; the default is 1. It must be set before the log is used.
+	SampleRate float64
+
+	// mu guards w and rand.
+	mu sync.Mutex
+
+	w      io.Writer
+	format QueryLogFormat
+
+	// rand returns a random number in [0, 1) to sample queries with.
+	rand func() float64
+}
+
+// NewQueryLog creates a QueryLog that writes every entry to w in the format.
+// The writer could be a RotatingFile.
+func NewQueryLog(w io.Writer, format QueryLogFormat) *QueryLog {
+	return &QueryLog{
+		SampleRate: 1,
+		w:          w,
+		format:     format,
+		rand:       rand.Float64,
+	}
+}
+
+// queryLogKey is the context key of the entry of the query that's being
+// answered, so a ResponseCache can record its cache status.
+type queryLogKey struct{}
+
+// setCacheStatus records the cache status in the entry of the query of the
+// context, if any.
+func setCacheStatus(ctx context.Context, status string) {
+	if e, ok := ctx.Value(queryLogKey{}).(*QueryLogEntry); ok {
+		e.Cache = status
+	}
+}
+
+// Middleware logs the queries that are passed to the handler, once they're
+// answered. It must wrap any ResponseCache middleware to record the cache
+// status.
+func (l *QueryLog) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			if !l.sample() {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+
+			q := query.Question
+			e := &QueryLogEntry{
+				Time:    time.Now(),
+				Client:  addrIP(w.RemoteAddr()),
+				Network: w.Network(),
+				QName:   q.QName,
+				QClass:  q.QClass.String(),
+				QType:   q.QType.String(),
+				RCode:   "none",
+				Cache:   CacheNone,
+			}
+			rw := &recordingWriter{ResponseWriter: w}
+			next.ServeDNS(context.WithValue(ctx, queryLogKey{}, e), rw, query)
+
+			e.Latency = time.Since(e.Time)
+			e.LatencyMS = float64(e.Latency) / float64(time.Millisecond)
+			if rw.resp != nil {
+				e.RCode = rcodeMnemonic(rw.resp.RCode)
+				e.Answers = len(rw.resp.Answer)
+			}
+			l.write(e)
+		})
+	}
+}
+
+// sample reports whether a query is logged.
+func (l *QueryLog) sample() bool {
+	if l.SampleRate >= 1 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rand() < l.SampleRate
+}
+
+// write writes the entry in the format of the log. Write errors are ignored,
+// so a full disk doesn't stop the server.
+func (l *QueryLog) write(e *QueryLogEntry) {
+	var b []byte
+	switch l.format {
+	case QueryLogJSON:
+		var err error
+		if b, err = json.Marshal(e); err != nil {
+			return
+		}
+		b = append(b, '\n')
+	default:
+		b = []byte(fmt.Sprintf(
+			"%s %s %s %s %s %s %s %d %s %s\n",
+			e.Time.UTC().Format(time.RFC3339Nano), e.Client, e.Network, e.QName,
+			e.QClass, e.QType, e.RCode, e.Answers, e.Latency, e.Cache,
+		))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = l.w.Write(b)
+}
+
+// rcodeMnemonics maps a response code to its mnemonic.
+var rcodeMnemonics = map[dns.RCode]string{
+	dns.RCodeNoError:        "NOERROR",
+	dns.RCodeFormatError:    "FORMERR",
+	dns.RCodeServerFailure:  "SERVFAIL",
+	dns.RCodeNameError:      "NXDOMAIN",
+	dns.RCodeNotImplemented: "NOTIMP",
+	dns.RCodeRefused:        "REFUSED",
+	dns.RCodeYXDomain:       "YXDOMAIN",
+	dns.RCodeYXRRset:        "YXRRSET",
+	dns.RCodeNXRRset:        "NXRRSET",
+	dns.RCodeNotAuth:        "NOTAUTH",
+	dns.RCodeNotZone:        "NOTZONE",
+}
+
+// rcodeMnemonic returns the mnemonic of the response code, or its number when
+// it has none.
+func rcodeMnemonic(rcode dns.RCode) string {
+	if s, ok := rcodeMnemonics[rcode]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("RCODE%d", int(rcode))
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestQueryLog(t *testing.T) {
+	var buf bytes.Buffer
+	ql := NewQueryLog(&buf, QueryLogText)
+	h := Chain(nameHandler("h"), ql.Middleware(), Cache(10))
+	serve(t, h, newQuery(t, "example.org.", dns.TypeA))
+	serve(t, h, newQuery(t, "example.org.", dns.TypeA))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines - want 2:\n%s", len(lines), buf.String())
+	}
+	for i, cache := range []string{CacheMiss, CacheHit} {
+		fields := strings.Fields(lines[i])
+		if len(fields) != 10 {
+			t.Fatalf("got %d fields - want 10: %q", len(fields), lines[i])
+		}
+		got := strings.Join(append(fields[1:8], fields[9]), " ")
+		if want := "192.0.2.1 udp example.org. IN A NOERROR 1 " + cache; got != want {
+			t.Errorf("line %d: got %q - want %q", i, got, want)
+		}
+	}
+}
+
+func TestQueryLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	h := Chain(nameHandler("h"), NewQueryLog(&buf, QueryLogJSON).Middleware())
+	serve(t, h, newQuery(t, "example.org.", dns.TypeAAAA))
+
+	var e QueryLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid json %q: %v", buf.String(), err)
+	}
+	if e.Client != "192.0.2.1" || e.QName != "example.org." || e.QType != "AAAA" ||
+		e.RCode != "NOERROR" || e.Cache != CacheNone || e.Time.IsZero() {
+		t.Errorf("got entry %+v", e)
+	}
+}
+
+func TestQueryLogSample(t *testing.T) {
+	var buf bytes.Buffer
+	ql := NewQueryLog(&buf, QueryLogText)
+	ql.SampleRate = 0.5
+	rands := []float64{0.1, 0.7, 0.4, 0.9}
+	ql.rand = func() float64 {
+		r := rands[0]
+		rands = rands[1:]
+		return r
+	}
+	h := Chain(nameHandler("h"), ql.Middleware())
+	for i := 0; i < 4; i++ {
+		if resp := serve(t, h, newQuery(t, "example.org.", dns.TypeA)); resp == nil {
+			t.Fatalf("query %d isn't answered", i)
+		}
+	}
+
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Errorf("got %d entries - want 2", got)
+	}
+}
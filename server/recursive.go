@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+// Recursive is a handler that answers queries by resolving them with a
+// resolver client (i.e. it's a recursive resolver). The cache of the client is
+// shared by all queries.
+type Recursive struct {
+	client *resolver.Client
+}
+
+// NewRecursive creates a Recursive that resolves queries with the client.
+func NewRecursive(client *resolver.Client) *Recursive {
+	return &Recursive{client: client}
+}
+
+// ServeDNS resolves the query, and answers with the final response: its
+// answer (including the CNAME chain) and authority sections, and its response
+// code. Queries of a class other than IN are refused, and queries that can't
+// be resolved are answered with SERVFAIL. When the query has the DO bit set,
+// DNSSEC resource records are requested as well. ANY queries received over UDP
+// aren't resolved; they're answered with a synthesized HINFO resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-4.3.2
+func (r *Recursive) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	q := query.Question
+	if query.OpCode != dns.OpCodeQuery {
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+		return
+	}
+	if q.QClass != dns.ClassIN {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+	if minimalANY(w, query) {
+		resp := hinfoReply(query)
+		resp.RA = 1
+		w.WriteMsg(resp)
+		return
+	}
+
+	dnssec := false
+	if opt := query.OPT(); opt != nil {
+		dnssec = opt.DO()
+	}
+	msg, err := r.client.Query(ctx, q.QName, q.QType, dnssec)
+	if err != nil {
+		resp := Reply(query, dns.RCodeServerFailure)
+		resp.RA = 1
+		w.WriteMsg(resp)
+		return
+	}
+
+	// The additional section isn't passed on; its resource records aren't
+	// needed to answer the query, and would be trusted less than the answer.
+	resp := Reply(query, msg.RCode)
+	resp.RA = 1
+	resp.Answer = msg.Answer
+	resp.Authority = msg.Authority
+	w.WriteMsg(resp)
+}
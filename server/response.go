@@ -0,0 +1,225 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// ResponseWriter writes the responses to a query; it hides whether the query
+// was received over UDP, TCP, TLS or HTTPS.
+type ResponseWriter interface {
+	// LocalAddr returns the address the query was received on.
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the address of the client.
+	RemoteAddr() net.Addr
+
+	// Network returns the network the query was received over: "udp", "tcp",
+	// "tls" or "https".
+	Network() string
+
+	// WriteMsg packs and writes the response. It sets the ID, question and QR
+	// bit of the response, so the handler doesn't have to. A response that
+	// exceeds the max size the client can receive is truncated: its answer and
+	// authority sections are dropped and its TC bit is set, so the client
+	// retries over TCP.
+	WriteMsg(resp *dns.Msg) error
+
+	// Write writes the packed response as-is.
+	Write(b []byte) (int, error)
+}
+
+// responseWriter writes responses to a query that was read from a packet
+// connection (UDP), a TCP connection or an HTTP request.
+type responseWriter struct {
+	// pc is the packet connection of a UDP query; conn is the connection of a
+	// TCP query, and hw the response writer of an HTTP query.
+	pc   net.PacketConn
+	conn net.Conn
+	hw   http.ResponseWriter
+
+	// laddr is the address an HTTP query was received on, and raddr is the
+	// address of the client.
+	laddr net.Addr
+	raddr net.Addr
+
+	// written is set when the response to an HTTP query is written; it can
+	// only hold a single message.
+	written bool
+
+	// query is the query that's answered, and size is the max size of a
+	// response to it.
+	query *dns.Msg
+	size  int
+
+	// idleTimeout is the time the TCP (or TLS) connection is kept open when
+	// it's idle; it's sent to clients that ask for it with the
+	// edns-tcp-keepalive option.
+	idleTimeout time.Duration
+}
+
+// setQuery sets the query that's answered, and derives the max size of a
+// response from it. Over UDP, it's the max UDP payload size the client
+// advertises with EDNS(0), and 512 bytes without it.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc6891#section-6.2.3
+func (w *responseWriter) setQuery(query *dns.Msg) {
+	w.query = query
+	w.size = maxMsgSize
+	if w.pc != nil {
+		w.size = minUDPSize
+		if opt := query.OPT(); opt != nil && int(opt.UDPSize()) > w.size {
+			w.size = int(opt.UDPSize())
+		}
+	}
+}
+
+// LocalAddr returns the address the query was received on.
+func (w *responseWriter) LocalAddr() net.Addr {
+	switch {
+	case w.pc != nil:
+		return w.pc.LocalAddr()
+	case w.hw != nil:
+		return w.laddr
+	}
+
+	return w.conn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the client.
+func (w *responseWriter) RemoteAddr() net.Addr {
+	return w.raddr
+}
+
+// Network returns "udp", "tcp", "tls" or "https".
+func (w *responseWriter) Network() string {
+	switch {
+	case w.pc != nil:
+		return "udp"
+	case w.hw != nil:
+		return "https"
+	}
+	if _, ok := w.conn.(*tls.Conn); ok {
+		return "tls"
+	}
+
+	return "tcp"
+}
+
+// WriteMsg packs the response (truncating it when needed), and writes it.
+func (w *responseWriter) WriteMsg(resp *dns.Msg) error {
+	resp, err := w.setKeepalive(resp)
+	if err != nil {
+		return err
+	}
+	respb, err := pack(w.query, resp, w.size)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(respb)
+	return err
+}
+
+// setKeepalive sets the idle timeout of the connection in the
+// edns-tcp-keepalive option of the response, when the query was received over
+// TCP (or TLS) with the option. Signed responses aren't changed.
+//
+// The option is set on a copy of the response, because the handler's response
+// may be shared (e.g. cached and written to clients over UDP).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7828#section-3.3.2
+func (w *responseWriter) setKeepalive(resp *dns.Msg) (*dns.Msg, error) {
+	if w.conn == nil || resp.OPT() == nil {
+		return resp, nil
+	}
+	if _, ok, err := w.query.TCPKeepalive(); !ok || err != nil {
+		return resp, nil
+	}
+	if n := len(resp.Additional); n > 0 {
+		if t := resp.Additional[n-1].Type; t == dns.TypeTSIG || t == dns.TypeSIG {
+			return resp, nil
+		}
+	}
+
+	timeout := w.idleTimeout
+	if timeout > dns.MaxTCPKeepalive {
+		timeout = dns.MaxTCPKeepalive
+	}
+	cp := *resp
+	cp.QR = 1
+	cp.Additional = append([]dns.RR{}, resp.Additional...)
+	if err := cp.SetTCPKeepalive(timeout); err != nil {
+		return nil, err
+	}
+
+	return &cp, nil
+}
+
+// Write writes the packed response to the client; over TCP (and TLS), it's
+// prefixed with its length, and over HTTPS, it's the body of the HTTP response.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if len(b) > maxMsgSize {
+		return 0, fmt.Errorf("response of %d bytes exceeds the max message size", len(b))
+	}
+	switch {
+	case w.pc != nil:
+		return w.pc.WriteTo(b, w.raddr)
+	case w.hw != nil:
+		return w.writeHTTP(b)
+	}
+
+	lb := make([]byte, 2, 2+len(b))
+	binary.BigEndian.PutUint16(lb, uint16(len(b)))
+	if _, err := w.conn.Write(append(lb, b...)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// pack packs the response to the query. When it exceeds the size, the answer
+// and authority sections are dropped and the TC bit is set, so the client
+// retries over TCP. A response that can't be packed is replaced with SERVFAIL.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2181#section-9
+func pack(query, resp *dns.Msg, size int) ([]byte, error) {
+	resp.ID = query.ID
+	resp.QR = 1
+	resp.OpCode = query.OpCode
+	resp.Question = query.Question
+	resp.ExtraQuestions = nil
+
+	respb, err := resp.Pack()
+	if err != nil {
+		resp = Reply(query, dns.RCodeServerFailure)
+		if respb, err = resp.Pack(); err != nil {
+			return nil, fmt.Errorf("failed to pack dns response: %w", err)
+		}
+	}
+	if len(respb) <= size {
+		return respb, nil
+	}
+
+	resp.TC = 1
+	resp.Answer, resp.Authority = nil, nil
+	additional := []dns.RR{}
+	if opt := resp.OPT(); opt != nil {
+		additional = append(additional, *opt)
+	}
+	resp.Additional = additional
+	respb, err = resp.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack dns response: %w", err)
+	}
+
+	return respb, nil
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+// RPZAction is the policy action of a Response Policy Zone rule.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-vixie-dnsop-dns-rpz-00#section-4
+type RPZAction int
+
+const (
+	// RPZNXDomain answers with NXDOMAIN; it's encoded as "CNAME .".
+	RPZNXDomain RPZAction = iota
+
+	// RPZNoData answers with an empty answer; it's encoded as "CNAME *.".
+	RPZNoData
+
+	// RPZPassthru passes the query to the handler, and stops the evaluation
+	// of the rules of later zones; it's encoded as "CNAME rpz-passthru.".
+	RPZPassthru
+
+	// RPZDrop doesn't answer the query; it's encoded as "CNAME rpz-drop.".
+	RPZDrop
+
+	// RPZTCPOnly answers queries over UDP with a truncated response, so the
+	// client retries over TCP, and passes queries over TCP to the handler;
+	// it's encoded as "CNAME rpz-tcp-only.".
+	RPZTCPOnly
+
+	// RPZLocalData answers with the resource records of the rule; the target
+	// of a CNAME resource record is resolved by the handler.
+	RPZLocalData
+)
+
+// String returns the name of the action.
+func (a RPZAction) String() string {
+	switch a {
+	case RPZNXDomain:
+		return "NXDOMAIN"
+	case RPZNoData:
+		return "NODATA"
+	case RPZPassthru:
+		return "PASSTHRU"
+	case RPZDrop:
+		return "DROP"
+	case RPZTCPOnly:
+		return "TCP-ONLY"
+	case RPZLocalData:
+		return "Local-Data"
+	default:
+		return fmt.Sprintf("RPZAction(%d)", int(a))
+	}
+}
+
+// rpzActions maps the CNAME targets that encode policy actions to them.
+var rpzActions = map[string]RPZAction{
+	".":             RPZNXDomain,
+	"*.":            RPZNoData,
+	"rpz-passthru.": RPZPassthru,
+	"rpz-drop.":     RPZDrop,
+	"rpz-tcp-only.": RPZTCPOnly,
+}
+
+// rpzClientIP is the label below which the client IP address triggers of a
+// policy zone are.
+const rpzClientIP = "rpz-client-ip"
+
+// RPZStats are the statistics of an RPZ.
+type RPZStats struct {
+	// Rules is the number of rules of the policy zones, and Hits is the
+	// number of queries a rule was applied to.
+	Rules int
+	Hits  uint64
+}
+
+// RPZ is a middleware that applies the rules of Response Policy Zones to
+// queries. A rule has a trigger, which is the owner name of its resource
+// records relative to the origin of the zone: a query name ("ads.example", or
+// "*.ads.example" for its subdomains), or a client IP network below
+// rpz-client-ip ("24.0.2.0.192.rpz-client-ip" for 192.0.2.0/24). The
+// resource records encode the action of the rule (see RPZAction). Triggers on
+// the IP addresses of responses or name servers aren't supported; their rules
+// are ignored.
+//
+// The zones are evaluated in order, and the rule of the first zone with a
+// matching trigger is applied. Within a zone, client IP triggers precede
+// query name triggers, a longer prefix precedes a shorter one, and a name
+// precedes a wildcard. Responses to queries with an OPT resource record have
+// an EDE option with the Blocked or Forged Answer code.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-vixie-dnsop-dns-rpz-00
+type RPZ struct {
+	// mu guards policies.
+	mu sync.RWMutex
+
+	policies []*rpzPolicy
+
+	// hits counts the queries a rule was applied to.
+	hits atomic.Uint64
+}
+
+// rpzPolicy holds the rules of a policy zone.
+type rpzPolicy struct {
+	// names maps the (lower case) query name triggers to their rules.
+	names map[string]*rpzRule
+
+	// clients holds the client IP triggers, longest prefix first.
+	clients []rpzClientRule
+}
+
+// rpzClientRule is the rule of a client IP trigger.
+type rpzClientRule struct {
+	net  *net.IPNet
+	rule *rpzRule
+}
+
+// rpzRule is the action of a trigger, and the resource records of its local
+// data.
+type rpzRule struct {
+	action RPZAction
+	rrs    []dns.RR
+}
+
+// NewRPZ creates an RPZ of the policy zones.
+func NewRPZ(zones ...*zone.Zone) (*RPZ, error) {
+	r := &RPZ{}
+	if err := r.Reload(zones...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload replaces the policy zones (e.g. after the zone files were edited).
+// When a zone has an invalid trigger, the policy zones are kept.
+func (r *RPZ) Reload(zones ...*zone.Zone) error {
+	policies := make([]*rpzPolicy, 0, len(zones))
+	for _, z := range zones {
+		p, err := newRPZPolicy(z)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, p)
+	}
+
+	r.mu.Lock()
+	r.policies = policies
+	r.mu.Unlock()
+
+	return nil
+}
+
+// newRPZPolicy creates the policy of the zone.
+func newRPZPolicy(z *zone.Zone) (*rpzPolicy, error) {
+	owners := map[string][]dns.RR{}
+	for _, rr := range z.Records() {
+		owner := strings.ToLower(dns.Fqdn(rr.Name))
+		if owner == z.Origin {
+			continue
+		}
+		owners[owner] = append(owners[owner], rr)
+	}
+
+	p := &rpzPolicy{names: map[string]*rpzRule{}}
+	for owner, rrs := range owners {
+		trigger := strings.TrimSuffix(owner, z.Origin)
+		if z.Origin == "." {
+			trigger = owner
+		}
+		rule := newRPZRule(rrs)
+
+		labels := strings.Split(strings.TrimSuffix(trigger, "."), ".")
+		switch last := labels[len(labels)-1]; {
+		case last == rpzClientIP:
+			n, err := parseRPZNet(labels[:len(labels)-1])
+			if err != nil {
+				return nil, fmt.Errorf("zone %s has invalid trigger %s: %v", z.Origin, owner, err)
+			}
+			p.clients = append(p.clients, rpzClientRule{net: n, rule: rule})
+		case strings.HasPrefix(last, "rpz-"):
+			// Triggers on response or name server IP addresses and names.
+			continue
+		default:
+			p.names[trigger] = rule
+		}
+	}
+	sort.Slice(p.clients, func(i, j int) bool {
+		a, _ := p.clients[i].net.Mask.Size()
+		b, _ := p.clients[j].net.Mask.Size()
+		return a > b
+	})
+
+	return p, nil
+}
+
+// newRPZRule returns the rule encoded by the resource records of a trigger.
+func newRPZRule(rrs []dns.RR) *rpzRule {
+	if len(rrs) == 1 && rrs[0].Type == dns.TypeCNAME {
+		if action, ok := rpzActions[strings.ToLower(rrs[0].RDataUnpacked)]; ok {
+			return &rpzRule{action: action}
+		}
+	}
+
+	return &rpzRule{action: RPZLocalData, rrs: rrs}
+}
+
+// parseRPZNet parses the labels of a client IP trigger (without
+// rpz-client-ip): the prefix length, followed by the bytes of an IPv4
+// address or the 16-bit groups of an IPv6 address in reverse order, where
+// "zz" stands for the longest run of zero groups.
+func parseRPZNet(labels []string) (*net.IPNet, error) {
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("missing address")
+	}
+	prefix, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix length %q", labels[0])
+	}
+	labels = labels[1:]
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	var s string
+	bits := 128
+	zz := -1
+	for i, l := range labels {
+		if l == "zz" {
+			zz = i
+			labels[i] = ""
+		}
+	}
+	switch {
+	case len(labels) == 4 && zz < 0:
+		s = strings.Join(labels, ".")
+		bits = 32
+	case len(labels) == 1 && zz == 0:
+		s = "::"
+	case zz == 0:
+		s = ":" + strings.Join(labels, ":")
+	case zz == len(labels)-1:
+		s = strings.Join(labels, ":") + ":"
+	default:
+		s = strings.Join(labels, ":")
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || prefix < 0 || prefix > bits {
+		return nil, fmt.Errorf("invalid network %s/%d", s, prefix)
+	}
+	if bits == 32 {
+		ip = ip.To4()
+	}
+	mask := net.CIDRMask(prefix, bits)
+
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// Stats returns the statistics of the RPZ.
+func (r *RPZ) Stats() RPZStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := 0
+	for _, p := range r.policies {
+		rules += len(p.names) + len(p.clients)
+	}
+
+	return RPZStats{Rules: rules, Hits: r.hits.Load()}
+}
+
+// match returns the rule of the first policy zone with a trigger that matches
+// the query name or client IP address, and the trigger that matched.
+func (r *RPZ) match(qname string, client net.IP) (*rpzRule, string, bool) {
+	qname = strings.ToLower(dns.Fqdn(qname))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.policies {
+		if client != nil {
+			for _, c := range p.clients {
+				if c.net.Contains(client) {
+					return c.rule, "", true
+				}
+			}
+		}
+		if rule, ok := p.names[qname]; ok {
+			return rule, qname, true
+		}
+		for n := qname; n != "."; {
+			n = dns.ParentDomainName(n)
+			wildcard := "*." + n
+			if n == "." {
+				wildcard = "*."
+			}
+			if rule, ok := p.names[wildcard]; ok {
+				return rule, wildcard, true
+			}
+		}
+	}
+
+	return nil, "", false
+}
+
+// Middleware applies the policy rules to queries, and passes queries without
+// a matching rule (or with a PASSTHRU rule) to the handler.
+func (r *RPZ) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			q := query.Question
+			if query.OpCode != dns.OpCodeQuery || q.QClass != dns.ClassIN {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			client := net.ParseIP(addrIP(w.RemoteAddr()))
+			rule, trigger, ok := r.match(q.QName, client)
+			if !ok || rule.action == RPZPassthru || rule.action == RPZTCPOnly && w.Network() != "udp" {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+			r.hits.Add(1)
+
+			switch rule.action {
+			case RPZDrop:
+				return
+			case RPZTCPOnly:
+				resp := Reply(query, dns.RCodeNoError)
+				resp.RA = 1
+				resp.TC = 1
+				w.WriteMsg(resp)
+			case RPZLocalData:
+				w.WriteMsg(r.localData(ctx, next, w, query, rule, trigger))
+			default:
+				resp := Reply(query, dns.RCodeNoError)
+				resp.RA = 1
+				if rule.action == RPZNXDomain {
+					resp.RCode = dns.RCodeNameError
+				}
+				if query.OPT() != nil {
+					resp.AddEDE(&dns.EDE{InfoCode: dns.EDEBlocked})
+				}
+				w.WriteMsg(resp)
+			}
+		})
+	}
+}
+
+// localData returns the response to a query with the local data of the rule
+// (see localAnswer). The target of a CNAME resource record of a wildcard
+// trigger may be a wildcard itself, whose asterisk is replaced with the query
+// name (e.g. "*.garden.example." becomes "ads.example.garden.example.").
+func (r *RPZ) localData(
+	ctx context.Context,
+	next Handler,
+	w ResponseWriter,
+	query *dns.Msg,
+	rule *rpzRule,
+	trigger string,
+) *dns.Msg {
+	q := query.Question
+	rrs := rule.rrs
+	if strings.HasPrefix(trigger, "*.") {
+		rrs = make([]dns.RR, 0, len(rule.rrs))
+		for _, rr := range rule.rrs {
+			if rr.Type == dns.TypeCNAME && strings.HasPrefix(rr.RDataUnpacked, "*.") {
+				target := strings.TrimSuffix(q.QName, ".") + rr.RDataUnpacked[1:]
+				rdata, err := dns.PackName(target)
+				if err != nil {
+					return Reply(query, dns.RCodeServerFailure)
+				}
+				if rr, err = dns.NewRR(rr.Name, rr.Type, rr.Class, rr.TTL, rdata); err != nil {
+					return Reply(query, dns.RCodeServerFailure)
+				}
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+
+	resp := localAnswer(ctx, next, w, query, rrs, func(string) []dns.RR { return nil })
+	if query.OPT() != nil {
+		resp.AddEDE(&dns.EDE{InfoCode: dns.EDEForgedAnswer})
+	}
+
+	return resp
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/zone"
+)
+
+func newRPZ(t *testing.T, zones ...string) *RPZ {
+	t.Helper()
+
+	zs := []*zone.Zone{}
+	for _, src := range zones {
+		rrs, err := zone.Parse(strings.NewReader(src), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := zone.New("", rrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zs = append(zs, z)
+	}
+	r, err := NewRPZ(zs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestRPZ(t *testing.T) {
+	r := newRPZ(t, `$ORIGIN rpz.example.
+@ 60 SOA ns.rpz.example. admin.rpz.example. 1 3600 600 86400 60
+@ 60 NS ns.rpz.example.
+ads.example.org 60 CNAME .
+*.ads.example.org 60 CNAME .
+empty.example.org 60 CNAME *.
+ok.ads.example.org 60 CNAME rpz-passthru.
+drop.example.org 60 CNAME rpz-drop.
+tcp.example.org 60 CNAME rpz-tcp-only.
+nas.example.org 60 A 192.168.1.10
+nas.example.org 60 TXT "nas"
+www.example.org 60 CNAME example.org.
+*.garden.example.org 60 CNAME *.walled.example.
+`, `$ORIGIN rpz2.example.
+@ 60 SOA ns.rpz2.example. admin.rpz2.example. 1 3600 600 86400 60
+ok.ads.example.org 60 CNAME .
+other.example.org 60 CNAME .
+`)
+	h := Chain(nameHandler("h"), r.Middleware())
+
+	tests := []struct {
+		name    string
+		qt      dns.QType
+		rcode   dns.RCode
+		tc      byte
+		answers []string
+	}{
+		{"ads.example.org.", dns.TypeA, dns.RCodeNameError, 0, nil},
+		{"x.ADS.example.org.", dns.TypeA, dns.RCodeNameError, 0, nil},
+		{"empty.example.org.", dns.TypeA, dns.RCodeNoError, 0, nil},
+		{"tcp.example.org.", dns.TypeA, dns.RCodeNoError, 1, nil},
+		{"nas.example.org.", dns.TypeA, dns.RCodeNoError, 0, []string{"192.168.1.10"}},
+		{"nas.example.org.", dns.TypeMX, dns.RCodeNoError, 0, nil},
+		{"www.example.org.", dns.TypeA, dns.RCodeNoError, 0, []string{"example.org.", `"h"`}},
+		{"x.garden.example.org.", dns.TypeA, dns.RCodeNoError, 0, []string{"x.garden.example.org.walled.example.", `"h"`}},
+		{"other.example.org.", dns.TypeA, dns.RCodeNameError, 0, nil},
+
+		// PASSTHRU stops the evaluation of later zones.
+		{"ok.ads.example.org.", dns.TypeA, dns.RCodeNoError, 0, []string{`"h"`}},
+		{"example.org.", dns.TypeA, dns.RCodeNoError, 0, []string{`"h"`}},
+	}
+	for _, tt := range tests {
+		resp := serve(t, h, newQuery(t, tt.name, tt.qt))
+		answers := []string{}
+		for _, rr := range resp.Answer {
+			answers = append(answers, rr.RDataUnpacked)
+		}
+		if resp.RCode != tt.rcode || resp.TC != tt.tc || strings.Join(answers, " ") != strings.Join(tt.answers, " ") {
+			t.Errorf(
+				"%s %s: got %s (TC %d) with answers %v - want %s (TC %d) with %v",
+				tt.name, tt.qt, resp.RCode, resp.TC, answers, tt.rcode, tt.tc, tt.answers,
+			)
+		}
+	}
+
+	if resp := serve(t, h, newQuery(t, "drop.example.org.", dns.TypeA)); resp != nil {
+		t.Errorf("got response %v to a dropped query", resp)
+	}
+	if st := r.Stats(); st.Rules != 11 || st.Hits != 10 {
+		t.Errorf("got stats %+v - want 11 rules and 10 hits", st)
+	}
+}
+
+func TestRPZClientIP(t *testing.T) {
+	// The test writer's client is 192.0.2.1.
+	r := newRPZ(t, `$ORIGIN rpz.example.
+@ 60 SOA ns.rpz.example. admin.rpz.example. 1 3600 600 86400 60
+24.0.2.0.192.rpz-client-ip 60 CNAME .
+32.1.2.0.192.rpz-client-ip 60 CNAME rpz-passthru.
+`)
+	h := Chain(nameHandler("h"), r.Middleware())
+	if resp := serve(t, h, newQuery(t, "example.org.", dns.TypeA)); resp.RCode != dns.RCodeNoError {
+		t.Errorf("got %s - want the longest prefix to pass the query through", resp.RCode)
+	}
+}
+
+func TestParseRPZNet(t *testing.T) {
+	tests := []struct {
+		trigger string
+		want    string
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32"},
+		{"24.0.2.0.192", "192.0.2.0/24"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"48.zz.1.db8.2001", "2001:db8:1::/48"},
+		{"128.1.zz", "::1/128"},
+	}
+	for _, tt := range tests {
+		n, err := parseRPZNet(strings.Split(tt.trigger, "."))
+		if err != nil {
+			t.Errorf("%s: %v", tt.trigger, err)
+			continue
+		}
+		if _, want, _ := net.ParseCIDR(tt.want); n.String() != want.String() {
+			t.Errorf("%s: got %s - want %s", tt.trigger, n, want)
+		}
+	}
+
+	for _, trigger := range []string{"33.1.2.0.192", "x.1.2.0.192", "32", "64.1.2.3"} {
+		if _, err := parseRPZNet(strings.Split(trigger, ".")); err == nil {
+			t.Errorf("%s: got no error", trigger)
+		}
+	}
+}
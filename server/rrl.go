@@ -0,0 +1,265 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+const (
+	// DefaultRRLSlip is the default number of limited responses per
+	// truncated response that's sent instead.
+	DefaultRRLSlip = 2
+
+	// defaultRRLIPv4Prefix and defaultRRLIPv6Prefix are the default prefix
+	// lengths of the client networks whose responses are limited together.
+	defaultRRLIPv4Prefix = 24
+	defaultRRLIPv6Prefix = 56
+
+	// maxRRLEntries is the max number of response tuples whose rates are
+	// tracked per limiter; when there are more, the least recently used
+	// tuples are forgotten.
+	maxRRLEntries = 10000
+)
+
+// RRLStats are the statistics of an RRL.
+type RRLStats struct {
+	// Dropped is the number of limited responses that were dropped, and
+	// Slipped is the number of limited responses that were sent truncated.
+	Dropped uint64
+	Slipped uint64
+}
+
+// RRL is a middleware that limits the rate of identical responses to a client
+// network over UDP (Response Rate Limiting), to mitigate reflection and
+// amplification attacks with spoofed source addresses. Every network (a /24
+// for IPv4 and a /56 for IPv6, by default) has a token bucket per response
+// tuple: the query name and type of an answer, the zone of a negative answer
+// or the delegation of a referral, and the response code of an error.
+//
+// A response over the limit is dropped, except for every Slip-th one, which
+// is sent truncated (empty with the TC bit set), so legitimate clients retry
+// over TCP, whose responses aren't limited.
+//
+// See: https://kb.isc.org/docs/aa-00994
+type RRL struct {
+	// Slip is the number of limited responses per truncated response; 0
+	// drops all of them, and 1 truncates all of them. The default is
+	// DefaultRRLSlip. It must be set before the RRL is used.
+	Slip int
+
+	// IPv4Prefix and IPv6Prefix are the prefix lengths of the client networks
+	// whose responses are limited together; the defaults are 24 and 56. They
+	// must be set before the RRL is used.
+	IPv4Prefix int
+	IPv6Prefix int
+
+	// responses, nxdomains and errors limit the answers, referrals and NODATA
+	// answers, the NXDOMAIN answers, and the error responses; nil doesn't
+	// limit them.
+	responses *rrlTable
+	nxdomains *rrlTable
+	errors    *rrlTable
+
+	// limited counts the limited responses, to pick the ones that slip.
+	limited atomic.Uint64
+
+	dropped atomic.Uint64
+	slipped atomic.Uint64
+}
+
+// NewRRL creates an RRL that limits the responses of every tuple to the
+// rates per second: the answers (including referrals and NODATA answers),
+// NXDOMAIN answers, and error responses (e.g. SERVFAIL or REFUSED). A rate of
+// zero doesn't limit those responses.
+func NewRRL(responses, nxdomains, errors float64) *RRL {
+	return &RRL{
+		Slip:       DefaultRRLSlip,
+		IPv4Prefix: defaultRRLIPv4Prefix,
+		IPv6Prefix: defaultRRLIPv6Prefix,
+		responses:  newRRLLimiter(responses),
+		nxdomains:  newRRLLimiter(nxdomains),
+		errors:     newRRLLimiter(errors),
+	}
+}
+
+// newRRLLimiter creates an rrlTable of the rate, whose bursts are a second of
+// responses; it returns nil when the rate is zero.
+func newRRLLimiter(rate float64) *rrlTable {
+	if rate <= 0 {
+		return nil
+	}
+
+	return newRRLTable(rate, math.Ceil(rate), maxRRLEntries)
+}
+
+// rrlTable tracks the response rate of a bounded number of tuples with token
+// buckets. Unlike a rateLimiter, which is keyed by the clients that send
+// queries, the tuples are keyed by (spoofable) client networks and query
+// names; so the table evicts the least recently used tuple when it's full,
+// in constant time.
+type rrlTable struct {
+	// mu guards ll and entries.
+	mu sync.Mutex
+
+	// rate is the number of tokens added per second, and burst is the max
+	// number of tokens.
+	rate  float64
+	burst float64
+
+	// max is the max number of tuples.
+	max int
+
+	// ll holds the tuples, most recently used first, and entries maps the key
+	// of a tuple to its list element.
+	ll      *list.List
+	entries map[string]*list.Element
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// rrlEntry is the token bucket of a tuple.
+type rrlEntry struct {
+	key    string
+	bucket tokenBucket
+}
+
+// newRRLTable creates an rrlTable that tracks up to max tuples.
+func newRRLTable(rate, burst float64, max int) *rrlTable {
+	return &rrlTable{
+		rate:    rate,
+		burst:   burst,
+		max:     max,
+		ll:      list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the bucket of the tuple; it returns false when the
+// bucket is empty.
+func (t *rrlTable) allow(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	el, ok := t.entries[key]
+	if ok {
+		t.ll.MoveToFront(el)
+	} else {
+		if t.ll.Len() >= t.max {
+			oldest := t.ll.Back()
+			t.ll.Remove(oldest)
+			delete(t.entries, oldest.Value.(*rrlEntry).key)
+		}
+		e := &rrlEntry{key: key, bucket: tokenBucket{tokens: t.burst, last: now}}
+		el = t.ll.PushFront(e)
+		t.entries[key] = el
+	}
+
+	return el.Value.(*rrlEntry).bucket.take(now, t.rate, t.burst)
+}
+
+// Stats returns the statistics of the RRL.
+func (r *RRL) Stats() RRLStats {
+	return RRLStats{Dropped: r.dropped.Load(), Slipped: r.slipped.Load()}
+}
+
+// Middleware limits the rate of the responses of the handler over UDP.
+func (r *RRL) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+			if w.Network() != "udp" {
+				next.ServeDNS(ctx, w, query)
+				return
+			}
+
+			next.ServeDNS(ctx, &rrlWriter{ResponseWriter: w, rrl: r, query: query}, query)
+		})
+	}
+}
+
+// rrlWriter is a response writer that limits the rate of the responses.
+type rrlWriter struct {
+	ResponseWriter
+
+	rrl   *RRL
+	query *dns.Msg
+}
+
+// WriteMsg writes the response when it's within the limit of its tuple, and
+// drops it or writes it truncated otherwise.
+func (w *rrlWriter) WriteMsg(resp *dns.Msg) error {
+	r := w.rrl
+	rl, key := r.tuple(w.RemoteAddr(), w.query, resp)
+	if rl == nil || rl.allow(key) {
+		return w.ResponseWriter.WriteMsg(resp)
+	}
+
+	if r.Slip <= 0 || r.limited.Add(1)%uint64(r.Slip) != 0 {
+		r.dropped.Add(1)
+		return nil
+	}
+	r.slipped.Add(1)
+	tc := Reply(w.query, resp.RCode)
+	tc.TC = 1
+	tc.AA = resp.AA
+	tc.RA = resp.RA
+
+	return w.ResponseWriter.WriteMsg(tc)
+}
+
+// tuple returns the rate limiter table of the response, and the key of its token
+// bucket: the client network, and the query name and type of an answer, the
+// owner of the SOA resource record of a negative answer (or of the NS
+// resource records of a referral), or the response code of an error.
+func (r *RRL) tuple(addr net.Addr, query, resp *dns.Msg) (*rrlTable, string) {
+	client := r.clientNet(addr)
+	q := query.Question
+	switch resp.RCode {
+	case dns.RCodeNoError:
+		if len(resp.Answer) > 0 {
+			return r.responses, client + "/" + strings.ToLower(q.QName) + "/" + q.QType.String()
+		}
+		return r.responses, client + "/" + authorityOwner(resp, q.QName) + "/-"
+	case dns.RCodeNameError:
+		return r.nxdomains, client + "/" + authorityOwner(resp, q.QName) + "/NXDOMAIN"
+	default:
+		return r.errors, client + "/" + rcodeMnemonic(resp.RCode)
+	}
+}
+
+// clientNet returns the network of the client address, with the prefix length
+// of its IP version.
+func (r *RRL) clientNet(addr net.Addr) string {
+	ip := net.ParseIP(addrIP(addr))
+	if ip == nil {
+		return addrIP(addr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(r.IPv4Prefix, 32)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(r.IPv6Prefix, 128)).String()
+}
+
+// authorityOwner returns the (lower case) owner of the first SOA or NS
+// resource record of the authority section of the response, or the name when
+// it has neither.
+func authorityOwner(resp *dns.Msg, name string) string {
+	for _, rr := range resp.Authority {
+		if rr.Type == dns.TypeSOA || rr.Type == dns.TypeNS {
+			return strings.ToLower(rr.Name)
+		}
+	}
+
+	return strings.ToLower(name)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestRRL(t *testing.T) {
+	rrl := NewRRL(2, 1, 1)
+	rrl.Slip = 2
+	now := time.Unix(0, 0)
+	for _, rl := range []*rrlTable{rrl.responses, rrl.nxdomains, rrl.errors} {
+		rl.now = func() time.Time { return now }
+	}
+	h := Chain(HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		if query.Question.QName == "nx.example.org." {
+			w.WriteMsg(Reply(query, dns.RCodeNameError))
+			return
+		}
+		nameHandler("h").ServeDNS(ctx, w, query)
+	}), rrl.Middleware())
+
+	// The first 2 answers are within the limit, then every other response is
+	// truncated and the others are dropped.
+	query := newQuery(t, "example.org.", dns.TypeTXT)
+	got := []string{}
+	for i := 0; i < 5; i++ {
+		resp := serve(t, h, query)
+		switch {
+		case resp == nil:
+			got = append(got, "drop")
+		case resp.TC == 1 && len(resp.Answer) == 0:
+			got = append(got, "slip")
+		default:
+			got = append(got, "answer")
+		}
+	}
+	want := []string{"answer", "answer", "drop", "slip", "drop"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("response %d: got %s - want %s", i, got[i], want[i])
+		}
+	}
+
+	// Other tuples have buckets of their own.
+	if resp := serve(t, h, newQuery(t, "example.org.", dns.TypeA)); resp == nil || resp.TC == 1 {
+		t.Errorf("got %v - want an answer for another query type", resp)
+	}
+	if resp := serve(t, h, newQuery(t, "nx.example.org.", dns.TypeA)); resp == nil || resp.RCode != dns.RCodeNameError {
+		t.Errorf("got %v - want NXDOMAIN", resp)
+	}
+
+	if st := rrl.Stats(); st.Dropped != 2 || st.Slipped != 1 {
+		t.Errorf("got stats %+v - want 2 dropped and 1 slipped", st)
+	}
+}
+
+func TestRRLTable(t *testing.T) {
+	now := time.Unix(0, 0)
+	tbl := newRRLTable(1, 1, 2)
+	tbl.now = func() time.Time { return now }
+
+	// When the table is full, the least recently used tuple is evicted, and the
+	// others keep their buckets.
+	for _, key := range []string{"a", "b", "a", "c"} {
+		tbl.allow(key)
+	}
+	if got := tbl.ll.Len(); got != 2 {
+		t.Errorf("got %d tuples - want 2", got)
+	}
+	if tbl.allow("a") || tbl.allow("c") {
+		t.Error("got a limited tuple allowed after an eviction")
+	}
+	if !tbl.allow("b") {
+		t.Error("got an evicted tuple limited")
+	}
+}
+
+func TestRRLClientNet(t *testing.T) {
+	rrl := NewRRL(1, 1, 1)
+	tests := map[string]string{
+		"192.0.2.77":          "192.0.2.0",
+		"2001:db8:1:2ff::1":   "2001:db8:1:200::",
+		"2001:db8:1:2ff::1:1": "2001:db8:1:200::",
+	}
+	for ip, want := range tests {
+		if got := rrl.clientNet(&net.UDPAddr{IP: net.ParseIP(ip)}); got != want {
+			t.Errorf("%s: got %s - want %s", ip, got, want)
+		}
+	}
+}
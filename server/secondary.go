@@ -0,0 +1,359 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/zone"
+)
+
+// initialRetry is the time after which a failed transfer of a zone that was
+// never transferred is retried.
+const initialRetry = time.Minute
+
+// Secondary is a handler that answers queries authoritatively from a zone it
+// transfers from its primary name servers (i.e. it's a secondary name server
+// of the zone). Once Run is called, the zone is refreshed at the refresh
+// interval of its SOA resource record, and a failed refresh is retried at the
+// retry interval. When the zone couldn't be refreshed within the expire
+// interval, queries are answered with SERVFAIL. A NOTIFY message from a primary
+// triggers an immediate refresh.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-4.3.5
+// See: https://datatracker.ietf.org/doc/html/rfc1996
+type Secondary struct {
+	// Log logs transfers and failed refreshes; nil disables logging.
+	Log *log.Logger
+
+	origin    string
+	primaries []string
+	client    *resolver.Client
+
+	// mu guards all fields below.
+	mu sync.RWMutex
+
+	// zone is the transferred zone; nil until the first transfer.
+	zone *zone.Zone
+
+	// expires is the time the zone expires, unless it's refreshed.
+	expires time.Time
+
+	// transfers holds the networks of the clients that may transfer the zone.
+	transfers []*net.IPNet
+
+	// notify receives a value when a NOTIFY message triggers a refresh.
+	notify chan struct{}
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewSecondary creates a Secondary of the zone with the origin, which is
+// transferred from the primaries with the client. A primary is an IP address
+// or "ip:port" (the port defaults to 53).
+func NewSecondary(client *resolver.Client, origin string, primaries ...string) *Secondary {
+	s := &Secondary{
+		origin: strings.ToLower(dns.Fqdn(origin)),
+		client: client,
+		notify: make(chan struct{}, 1),
+		now:    time.Now,
+	}
+	for _, p := range primaries {
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			p = net.JoinHostPort(p, "53")
+		}
+		s.primaries = append(s.primaries, p)
+	}
+
+	return s
+}
+
+// Origin returns the origin of the zone.
+func (s *Secondary) Origin() string {
+	return s.origin
+}
+
+// AllowTransfer allows clients in the networks to transfer the zone (with AXFR
+// or IXFR over TCP); by default, zone transfers are refused.
+func (s *Secondary) AllowTransfer(nets ...*net.IPNet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transfers = append(s.transfers, nets...)
+}
+
+// Zone returns the transferred zone, or nil when it wasn't transferred yet or
+// when it expired.
+func (s *Secondary) Zone() *zone.Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.zone == nil || !s.now().Before(s.expires) {
+		return nil
+	}
+
+	return s.zone
+}
+
+// Run transfers the zone, and keeps it up to date until the context is
+// canceled.
+func (s *Secondary) Run(ctx context.Context) {
+	wait := time.Duration(0)
+	for {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		case <-s.notify:
+			t.Stop()
+		}
+
+		wait = s.refresh(ctx)
+	}
+}
+
+// ServeDNS answers the query from the zone, and refuses queries for names
+// outside it. A NOTIFY message for the zone from a primary is acknowledged, and
+// triggers a refresh.
+func (s *Secondary) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	q := query.Question
+	if query.OpCode == dns.OpCodeNotify {
+		s.serveNotify(w, query)
+		return
+	}
+	if query.OpCode != dns.OpCodeQuery {
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+		return
+	}
+	if q.QClass != dns.ClassIN || !dns.IsSubDomain(s.origin, q.QName) {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	z := s.Zone()
+	if z == nil {
+		w.WriteMsg(Reply(query, dns.RCodeServerFailure))
+		return
+	}
+	s.mu.RLock()
+	transfers := s.transfers
+	s.mu.RUnlock()
+
+	serveZone(w, query, z, transfers)
+}
+
+// serveNotify acknowledges a NOTIFY message for the SOA resource record of the
+// zone from a primary, and triggers a refresh. Other NOTIFY messages are
+// refused.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1996#section-3
+func (s *Secondary) serveNotify(w ResponseWriter, query *dns.Msg) {
+	q := query.Question
+	if !strings.EqualFold(dns.Fqdn(q.QName), s.origin) || q.QType != dns.TypeSOA || !s.isPrimary(w.RemoteAddr()) {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	resp := Reply(query, dns.RCodeNoError)
+	resp.AA = 1
+	w.WriteMsg(resp)
+}
+
+// isPrimary checks if the address is the address of a primary.
+func (s *Secondary) isPrimary(addr net.Addr) bool {
+	ip := net.ParseIP(addrIP(addr))
+	for _, p := range s.primaries {
+		host, _, _ := net.SplitHostPort(p)
+		if pip := net.ParseIP(host); pip != nil && pip.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refresh refreshes the zone from the first primary that succeeds, and
+// returns the time until the next refresh: the refresh interval when it
+// succeeded, and the retry interval when it failed.
+func (s *Secondary) refresh(ctx context.Context) time.Duration {
+	var err error
+	for _, p := range s.primaries {
+		if err = s.refreshFrom(ctx, p); err == nil {
+			break
+		}
+		s.logf("failed to refresh zone %s from %s: %v", s.origin, p, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.zone == nil {
+		return initialRetry
+	}
+	timers := soaTimers(s.zone.SOA())
+	if err != nil || len(s.primaries) == 0 {
+		return time.Duration(timers.Retry) * time.Second
+	}
+	s.expires = s.now().Add(time.Duration(timers.Expire) * time.Second)
+
+	return time.Duration(timers.Refresh) * time.Second
+}
+
+// refreshFrom checks the serial number of the zone at the primary, and
+// transfers the zone when it changed.
+func (s *Secondary) refreshFrom(ctx context.Context, primary string) error {
+	s.mu.RLock()
+	current := s.zone
+	s.mu.RUnlock()
+
+	if current == nil {
+		tr, err := s.client.Transfer(ctx, s.origin, primary, nil)
+		if err != nil {
+			return err
+		}
+		return s.load(tr.Records, primary)
+	}
+
+	query := new(dns.Msg)
+	if err := query.SetQuery(s.origin, dns.TypeSOA); err != nil {
+		return err
+	}
+	query.RD = 0
+	resp, err := s.client.ExchangeContext(ctx, query, primary)
+	if err != nil {
+		return err
+	}
+	if resp.RCode != dns.RCodeNoError || resp.AA != 1 {
+		return fmt.Errorf("SOA query failed: %s (aa %d)", resp.RCode, resp.AA)
+	}
+	serial, ok := uint32(0), false
+	for _, rr := range resp.Answer {
+		if rr.Type == dns.TypeSOA && strings.EqualFold(dns.Fqdn(rr.Name), s.origin) {
+			serial, ok = soaSerial(rr)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("SOA query failed: no SOA record")
+	}
+	currentSerial, _ := soaSerial(current.SOA())
+	if dns.CompareSerial(serial, currentSerial) <= 0 {
+		return nil
+	}
+
+	// Request the changes since the current version, and fall back to a
+	// transfer of the entire zone when they can't be applied.
+	soa := current.SOA()
+	tr, err := s.client.Transfer(ctx, s.origin, primary, &soa)
+	if err == nil {
+		rrs := tr.Records
+		if tr.Incremental() {
+			rrs, err = applyDeltas(current.Records(), tr.Deltas)
+		}
+		if err == nil {
+			return s.load(rrs, primary)
+		}
+	}
+	s.logf("incremental transfer of zone %s from %s failed: %v", s.origin, primary, err)
+
+	tr, err = s.client.Transfer(ctx, s.origin, primary, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.load(tr.Records, primary)
+}
+
+// load replaces the zone with a zone of the transferred resource records,
+// once it's verified with its ZONEMD resource records.
+func (s *Secondary) load(rrs []dns.RR, primary string) error {
+	z, err := zone.New(s.origin, rrs)
+	if err != nil {
+		return err
+	}
+	if err := z.VerifyDigest(); err != nil {
+		return err
+	}
+	serial, _ := soaSerial(z.SOA())
+
+	s.mu.Lock()
+	s.zone = z
+	s.mu.Unlock()
+	s.logf("transferred zone %s with serial %d from %s (%d records)", s.origin, serial, primary, len(rrs))
+
+	return nil
+}
+
+// logf logs the message when logging is enabled.
+func (s *Secondary) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+// applyDeltas applies the changes of an incremental zone transfer to the
+// resource records of the zone.
+func applyDeltas(rrs []dns.RR, deltas []resolver.Delta) ([]dns.RR, error) {
+	rrs = append([]dns.RR{}, rrs...)
+	for _, d := range deltas {
+		for _, del := range d.Deleted {
+			if del.Type == dns.TypeSOA {
+				continue
+			}
+			i := 0
+			for ; i < len(rrs) && !sameRR(rrs[i], del); i++ {
+			}
+			if i == len(rrs) {
+				return nil, fmt.Errorf("deleted record %s %s doesn't exist", del.Name, del.Type)
+			}
+			rrs = append(rrs[:i], rrs[i+1:]...)
+		}
+		for _, add := range d.Added {
+			if add.Type != dns.TypeSOA {
+				rrs = append(rrs, add)
+				continue
+			}
+			for i := range rrs {
+				if rrs[i].Type == dns.TypeSOA {
+					rrs[i] = add
+				}
+			}
+		}
+	}
+
+	return rrs, nil
+}
+
+// sameRR checks if the resource records have the same owner name, type, class
+// and RDATA.
+func sameRR(a, b dns.RR) bool {
+	return strings.EqualFold(a.Name, b.Name) &&
+		a.Type == b.Type &&
+		a.Class == b.Class &&
+		bytes.Equal(a.RData, b.RData)
+}
+
+// soaTimers returns the typed RDATA of a SOA resource record, which holds the
+// timers of the zone.
+func soaTimers(rr dns.RR) *dns.SOA {
+	rd, err := rr.Decode()
+	if soa, ok := rd.(*dns.SOA); err == nil && ok {
+		return soa
+	}
+
+	return &dns.SOA{}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+)
+
+var loopback = &net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+
+func TestAuthorityTransfer(t *testing.T) {
+	a := newTestAuthority(t)
+	_, tcp := startServer(t, a)
+	c := resolver.NewClient(resolver.WithTimeout(time.Second))
+
+	// Zone transfers are refused by default.
+	if _, err := c.Transfer(context.Background(), "example.org.", tcp, nil); err == nil {
+		t.Error("got no error for a transfer that isn't allowed")
+	}
+
+	a.AllowTransfer(loopback)
+	tr, err := c.Transfer(context.Background(), "example.org.", tcp, nil)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if len(tr.Records) != 4 || tr.Records[0].Type != dns.TypeSOA {
+		t.Errorf("got records %v, want the SOA and 3 other records", tr.Records)
+	}
+
+	// A client with the current version only gets the SOA record.
+	tr, err = c.Transfer(context.Background(), "example.org.", tcp, &tr.SOA)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if !tr.Incremental() || len(tr.Deltas) != 0 {
+		t.Errorf("got %d deltas, want none", len(tr.Deltas))
+	}
+
+	// Entire zones aren't transferred over UDP.
+	if resp := serve(t, a, newQuery(t, "example.org.", dns.TypeAXFR)); resp.RCode == dns.RCodeNoError {
+		t.Errorf("got rcode %s for AXFR over UDP", resp.RCode)
+	}
+}
+
+func TestSecondary(t *testing.T) {
+	var mu sync.Mutex
+	primary := newTestAuthority(t)
+	primary.AllowTransfer(loopback)
+	_, tcp := startServer(t, HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		mu.Lock()
+		a := primary
+		mu.Unlock()
+		a.ServeDNS(ctx, w, query)
+	}))
+
+	c := resolver.NewClient(resolver.WithTimeout(time.Second), resolver.WithTransport(resolver.TCP))
+	s := NewSecondary(c, "example.org", tcp)
+
+	// Queries aren't answered before the zone is transferred.
+	if resp := serve(t, s, newQuery(t, "www.example.org.", dns.TypeA)); resp.RCode != dns.RCodeServerFailure {
+		t.Errorf("got rcode %s before the transfer, want SERVFAIL", resp.RCode)
+	}
+
+	if wait := s.refresh(context.Background()); wait != 7200*time.Second {
+		t.Errorf("got refresh after %s, want the SOA refresh interval", wait)
+	}
+	resp := serve(t, s, newQuery(t, "www.example.org.", dns.TypeA))
+	if resp.RCode != dns.RCodeNoError || resp.AA != 1 || len(resp.Answer) != 1 {
+		t.Errorf("got rcode %s (aa %d) with answer %v, want the www address", resp.RCode, resp.AA, resp.Answer)
+	}
+	if resp := serve(t, s, newQuery(t, "www.example.com.", dns.TypeA)); resp.RCode != dns.RCodeRefused {
+		t.Errorf("got rcode %s for a name out of zone, want REFUSED", resp.RCode)
+	}
+
+	// A new version of the zone is transferred on the next refresh.
+	mu.Lock()
+	primary = newZoneAuthority(t, strings.Replace(testZone, "hostmaster 1 ", "hostmaster 2 ", 1)+"mail\tA\t192.0.2.25\n")
+	primary.AllowTransfer(loopback)
+	mu.Unlock()
+	s.refresh(context.Background())
+	if resp := serve(t, s, newQuery(t, "mail.example.org.", dns.TypeA)); len(resp.Answer) != 1 {
+		t.Errorf("got answer %v after the refresh, want the mail address", resp.Answer)
+	}
+
+	// Without a refresh, the zone expires after the SOA expire interval.
+	s.now = func() time.Time { return time.Now().Add(1209600 * time.Second) }
+	if resp := serve(t, s, newQuery(t, "www.example.org.", dns.TypeA)); resp.RCode != dns.RCodeServerFailure {
+		t.Errorf("got rcode %s after the zone expired, want SERVFAIL", resp.RCode)
+	}
+}
+
+func TestSecondaryApplyDeltas(t *testing.T) {
+	a := newTestAuthority(t)
+	z := a.zones[0]
+	rrs := z.Records()
+
+	soa2, err := dns.NewRR("example.org.", dns.TypeSOA, dns.ClassIN, 3600, mustSOA(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail, err := dns.NewRR("mail.example.org.", dns.TypeA, dns.ClassIN, 3600, []byte{192, 0, 2, 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	www, err := dns.NewRR("WWW.example.org.", dns.TypeA, dns.ClassIN, 3600, []byte{192, 0, 2, 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := applyDeltas(rrs, []resolver.Delta{
+		{Deleted: []dns.RR{z.SOA(), www}, Added: []dns.RR{soa2, mail}},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply deltas: %v", err)
+	}
+	if len(got) != len(rrs) {
+		t.Fatalf("got %d records, want %d", len(got), len(rrs))
+	}
+	for _, rr := range got {
+		if rr.Name == "www.example.org." {
+			t.Errorf("got deleted record %v", rr)
+		}
+		if serial, ok := soaSerial(rr); ok && serial != 2 {
+			t.Errorf("got SOA serial %d, want 2", serial)
+		}
+	}
+
+	if _, err := applyDeltas(got, []resolver.Delta{{Deleted: []dns.RR{soa2, www}}}); err == nil {
+		t.Error("got no error deleting a record that doesn't exist")
+	}
+}
+
+func TestSecondaryNotify(t *testing.T) {
+	c := resolver.NewClient()
+	notify := func(t *testing.T, s *Secondary, name string) *dns.Msg {
+		query := newQuery(t, name, dns.TypeSOA)
+		query.OpCode = dns.OpCodeNotify
+		query.RD = 0
+		return serve(t, s, query)
+	}
+
+	// testWriter's remote address is 192.0.2.1.
+	s := NewSecondary(c, "example.org.", "192.0.2.1")
+	resp := notify(t, s, "example.org.")
+	if resp.RCode != dns.RCodeNoError || resp.AA != 1 || resp.OpCode != dns.OpCodeNotify {
+		t.Errorf("got rcode %s (aa %d, opcode %s), want an authoritative NOTIFY response",
+			resp.RCode, resp.AA, resp.OpCode)
+	}
+	select {
+	case <-s.notify:
+	default:
+		t.Error("NOTIFY didn't trigger a refresh")
+	}
+
+	if resp := notify(t, s, "example.com."); resp.RCode != dns.RCodeRefused {
+		t.Errorf("got rcode %s for another zone, want REFUSED", resp.RCode)
+	}
+	s = NewSecondary(c, "example.org.", "192.0.2.2:5300")
+	if resp := notify(t, s, "example.org."); resp.RCode != dns.RCodeRefused {
+		t.Errorf("got rcode %s from a name server that isn't a primary, want REFUSED", resp.RCode)
+	}
+
+	// A primary notifies the secondary over the network.
+	s = NewSecondary(c, "example.org.", "127.0.0.1")
+	udp, _ := startServer(t, s)
+	if err := c.Notify(context.Background(), "example.org.", udp, nil); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	select {
+	case <-s.notify:
+	default:
+		t.Error("NOTIFY didn't trigger a refresh")
+	}
+}
+
+func mustSOA(t *testing.T, serial uint32) []byte {
+	t.Helper()
+
+	soa := &dns.SOA{
+		MName:   "ns1.example.org.",
+		RName:   "hostmaster.example.org.",
+		Serial:  serial,
+		Refresh: 7200,
+		Retry:   3600,
+		Expire:  1209600,
+		Minimum: 300,
+	}
+	b, err := soa.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// DefaultIdleTimeout is the time an idle TCP connection is kept open.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7766#section-6.2.3
+const DefaultIdleTimeout = 10 * time.Second
+
+// DefaultMaxUDPQueries is the max number of UDP queries that are handled
+// concurrently.
+const DefaultMaxUDPQueries = 1024
+
+// minUDPSize is the max size of a UDP response to a query without EDNS(0).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.1
+const minUDPSize = 512
+
+// maxMsgSize is the max size of a DNS message.
+const maxMsgSize = 65535
+
+// Handler responds to DNS queries.
+type Handler interface {
+	// ServeDNS writes the response to the query with the response writer. A
+	// query the handler doesn't write a response to isn't answered. Besides
+	// standard queries, the handler receives NOTIFY messages; handlers that
+	// don't support them answer with NOTIMP.
+	ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg)
+}
+
+// HandlerFunc is a function that's used as a Handler.
+type HandlerFunc func(ctx context.Context, w ResponseWriter, query *dns.Msg)
+
+// ServeDNS calls f(ctx, w, query).
+func (f HandlerFunc) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	f(ctx, w, query)
+}
+
+// Server serves DNS queries over UDP, TCP and TLS, and over HTTP when it's
+// used as an http.Handler (see ServeHTTP).
+type Server struct {
+	// Addr is the address the server listens on (e.g. ":53").
+	Addr string
+
+	// Handler responds to the queries.
+	Handler Handler
+
+	// IdleTimeout is the time an idle TCP (or TLS) connection is kept open;
+	// when it's zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// MaxConns is the max number of open TCP and TLS connections; new
+	// connections are closed while the limit is reached. When it's zero, the
+	// number of connections isn't limited.
+	MaxConns int
+
+	// MaxUDPQueries is the max number of UDP queries that are handled
+	// concurrently; new queries are dropped while the limit is reached. When
+	// it's zero, DefaultMaxUDPQueries is used.
+	MaxUDPQueries int
+
+	// Malformed is called with the network (see ResponseWriter) of every
+	// message that can't be unpacked, e.g. to count them; nil ignores them.
+	Malformed func(network string)
+
+	// mu guards conns.
+	mu sync.Mutex
+
+	// conns holds the open TCP and TLS connections, which are closed when the
+	// server stops.
+	conns map[net.Conn]bool
+}
+
+// ListenAndServe listens on the address over UDP and TCP, and serves queries
+// until the context is done (see Serve).
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	pc, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	return s.Serve(ctx, pc, l)
+}
+
+// ListenAndServeTLS listens on the address over TCP, and serves queries over
+// TLS with the configuration until the context is done (see Serve). The
+// configuration must hold a certificate.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7858
+func (s *Server) ListenAndServeTLS(ctx context.Context, config *tls.Config) error {
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		return fmt.Errorf("tls config has no certificate")
+	}
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, nil, tls.NewListener(l, config))
+}
+
+// Serve serves queries that are read from the packet connection (UDP) and
+// accepted on the listener (TCP, or TLS when it's a TLS listener); either may
+// be nil. It closes them, and the
+// open TCP connections, when the context is done or when an error occurs.
+// It returns nil when the context is done, and the error otherwise.
+func (s *Server) Serve(ctx context.Context, pc net.PacketConn, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	if pc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.serveUDP(ctx, pc)
+		}()
+	}
+	if l != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.serveTCP(ctx, l)
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	cancel()
+	if pc != nil {
+		pc.Close()
+	}
+	if l != nil {
+		l.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	wg.Wait()
+
+	return err
+}
+
+// serveUDP reads queries from the packet connection, and writes the responses
+// to their senders.
+//
+// Queries are dropped rather than answered while the max number of queries is
+// handled: the senders retry (over another name server), and a flood of
+// queries with spoofed source addresses isn't reflected.
+func (s *Server) serveUDP(ctx context.Context, pc net.PacketConn) error {
+	max := s.MaxUDPQueries
+	if max <= 0 {
+		max = DefaultMaxUDPQueries
+	}
+	sem := make(chan struct{}, max)
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			continue
+		}
+		queryb := append([]byte{}, buf[:n]...)
+		go func() {
+			defer func() { <-sem }()
+			s.respond(ctx, queryb, &responseWriter{pc: pc, raddr: addr})
+		}()
+	}
+}
+
+// serveTCP accepts connections on the listener, and serves each in its own
+// goroutine.
+func (s *Server) serveTCP(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.MaxConns > 0 && len(s.conns) >= s.MaxConns {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		if s.conns == nil {
+			s.conns = map[net.Conn]bool{}
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go func() {
+			s.serveConn(ctx, conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveConn reads length-prefixed queries from the TCP (or TLS) connection,
+// and writes the length-prefixed responses, until the connection is idle for
+// the idle timeout or the client closes it. The TLS handshake must complete
+// within the idle timeout as well.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	idleTimeout := s.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		queryb := make([]byte, size)
+		if _, err := io.ReadFull(conn, queryb); err != nil {
+			return
+		}
+
+		w := &responseWriter{conn: conn, raddr: conn.RemoteAddr(), idleTimeout: idleTimeout}
+		s.respond(ctx, queryb, w)
+	}
+}
+
+// respond unpacks the query, and passes it to the handler, which writes the
+// response with the response writer. Messages that must be ignored (e.g.
+// responses) aren't passed on.
+func (s *Server) respond(ctx context.Context, queryb []byte, w *responseWriter) {
+	query := new(dns.Msg)
+	if _, err := query.Unpack(queryb); err != nil {
+		if s.Malformed != nil {
+			s.Malformed(w.Network())
+		}
+
+		// A query with a valid header is answered with FORMERR.
+		h := dns.Header{}
+		if _, err := h.Unpack(queryb, 0); err != nil || h.QR == 1 {
+			return
+		}
+		w.setQuery(&dns.Msg{Header: h})
+		w.WriteMsg(Reply(w.query, dns.RCodeFormatError))
+		return
+	}
+	if query.QR == 1 {
+		return
+	}
+
+	w.setQuery(query)
+	switch {
+	case query.OpCode != dns.OpCodeQuery && query.OpCode != dns.OpCodeNotify:
+		w.WriteMsg(Reply(query, dns.RCodeNotImplemented))
+	case query.QDCount != 1:
+		w.WriteMsg(Reply(query, dns.RCodeFormatError))
+	case w.conn != nil && invalidKeepalive(query):
+		w.WriteMsg(Reply(query, dns.RCodeFormatError))
+	default:
+		s.Handler.ServeDNS(ctx, w, query)
+	}
+}
+
+// invalidKeepalive checks if the edns-tcp-keepalive option of a query that's
+// received over TCP (or TLS) is invalid; it must not have a timeout. Over UDP
+// and HTTPS, the option is ignored.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7828#section-3.3.1
+func invalidKeepalive(query *dns.Msg) bool {
+	_, _, err := query.TCPKeepalive()
+	return err != nil
+}
+
+// Reply returns an empty response to the query with the response code. It
+// echoes the ID, operation code, question and RD bit of the query, and its
+// use of EDNS(0).
+func Reply(query *dns.Msg, rcode dns.RCode) *dns.Msg {
+	resp := &dns.Msg{
+		Header: dns.Header{
+			ID:     query.ID,
+			QR:     1,
+			OpCode: query.OpCode,
+			RD:     query.RD,
+			RCode:  rcode,
+		},
+		Question: query.Question,
+	}
+	if opt := query.OPT(); opt != nil {
+		resp.SetEDNS0(dns.DefaultEDNSUDPSize, opt.DO())
+	}
+
+	return resp
+}
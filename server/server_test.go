@@ -0,0 +1,815 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+	"github.com/danillouz/tdr/resolver"
+	"github.com/danillouz/tdr/zone"
+)
+
+const testZone = `$ORIGIN example.org.
+$TTL 3600
+@	SOA	ns1 hostmaster 1 7200 3600 1209600 300
+	NS	ns1
+ns1	A	192.0.2.53
+www	A	192.0.2.80
+`
+
+// startServer serves the handler on loopback addresses, and returns the UDP
+// and TCP addresses.
+func startServer(t *testing.T, h Handler) (string, string) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Server{Handler: h}).Serve(ctx, pc, l)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve error: %v", err)
+		}
+	})
+
+	return pc.LocalAddr().String(), l.Addr().String()
+}
+
+func newTestAuthority(t *testing.T) *Authority {
+	t.Helper()
+
+	return newZoneAuthority(t, testZone)
+}
+
+// newZoneAuthority creates an Authority of the zone in the zone file format.
+func newZoneAuthority(t *testing.T, text string) *Authority {
+	t.Helper()
+
+	rrs, err := zone.Parse(strings.NewReader(text), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := zone.New("", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAuthority(z)
+}
+
+// exchangeUDP sends the packed query over UDP, and returns the response.
+func exchangeUDP(t *testing.T, addr string, queryb []byte) *dns.Msg {
+	t.Helper()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write(queryb); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxMsgSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func newQuery(t *testing.T, name string, qt dns.QType) *dns.Msg {
+	t.Helper()
+
+	query := new(dns.Msg)
+	if err := query.SetQuery(name, qt); err != nil {
+		t.Fatal(err)
+	}
+
+	return query
+}
+
+// testWriter is a response writer that records the packed responses to the
+// query.
+type testWriter struct {
+	query *dns.Msg
+	resps []*dns.Msg
+}
+
+func (w *testWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *testWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5353}
+}
+
+func (w *testWriter) Network() string {
+	return "udp"
+}
+
+func (w *testWriter) WriteMsg(resp *dns.Msg) error {
+	b, err := pack(w.query, resp, maxMsgSize)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (w *testWriter) Write(b []byte) (int, error) {
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.resps = append(w.resps, resp)
+	return len(b), nil
+}
+
+// serve passes the query to the handler, and returns the response it wrote,
+// or nil when it didn't write one.
+func serve(t *testing.T, h Handler, query *dns.Msg) *dns.Msg {
+	t.Helper()
+
+	w := &testWriter{query: query}
+	h.ServeDNS(context.Background(), w, query)
+	if len(w.resps) == 0 {
+		return nil
+	}
+	if len(w.resps) > 1 {
+		t.Errorf("got %d responses - want 1", len(w.resps))
+	}
+
+	return w.resps[0]
+}
+
+func mustPack(t *testing.T, m *dns.Msg) []byte {
+	t.Helper()
+
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestServeAuthority(t *testing.T) {
+	udp, _ := startServer(t, newTestAuthority(t))
+
+	tests := []struct {
+		name    string
+		qname   string
+		qt      dns.QType
+		rcode   dns.RCode
+		aa      byte
+		answers int
+		soa     bool
+	}{
+		{"answer", "www.example.org.", dns.TypeA, dns.RCodeNoError, 1, 1, false},
+		{"nodata", "www.example.org.", dns.TypeAAAA, dns.RCodeNoError, 1, 0, true},
+		{"nxdomain", "nope.example.org.", dns.TypeA, dns.RCodeNameError, 1, 0, true},
+		{"refused", "example.com.", dns.TypeA, dns.RCodeRefused, 0, 0, false},
+	}
+	for _, tc := range tests {
+		query := newQuery(t, tc.qname, tc.qt)
+		resp := exchangeUDP(t, udp, mustPack(t, query))
+		if resp.ID != query.ID || resp.QR != 1 || resp.Question != query.Question {
+			t.Errorf("%s header error: got id %d qr %d %v", tc.name, resp.ID, resp.QR, resp.Question)
+		}
+		if resp.RCode != tc.rcode {
+			t.Errorf("%s rcode error: got %s - want %s", tc.name, resp.RCode, tc.rcode)
+		}
+		if resp.AA != tc.aa {
+			t.Errorf("%s aa error: got %d - want %d", tc.name, resp.AA, tc.aa)
+		}
+		if len(resp.Answer) != tc.answers {
+			t.Errorf("%s answers error: got %d - want %d", tc.name, len(resp.Answer), tc.answers)
+		}
+		soa := len(resp.Authority) == 1 && resp.Authority[0].Type == dns.TypeSOA
+		if soa != tc.soa {
+			t.Errorf("%s soa error: got %v - want soa %t", tc.name, resp.Authority, tc.soa)
+		}
+	}
+}
+
+func TestAuthorityReload(t *testing.T) {
+	a := newTestAuthority(t)
+	z := a.zones[0]
+
+	if changed := a.Reload(z); len(changed) != 0 {
+		t.Errorf("got changed zones %v for the same zone, want none", changed)
+	}
+
+	v2 := newZoneAuthority(t, strings.Replace(testZone, "hostmaster 1 ", "hostmaster 2 ", 1)+"mail\tA\t192.0.2.25\n")
+	other := newZoneAuthority(t, strings.ReplaceAll(testZone, "example.org.", "example.com."))
+	changed := a.Reload(v2.zones[0], other.zones[0])
+	if len(changed) != 2 {
+		t.Errorf("got %d changed zones, want the new version and the new zone", len(changed))
+	}
+	for _, name := range []string{"mail.example.org.", "www.example.com."} {
+		if resp := serve(t, a, newQuery(t, name, dns.TypeA)); len(resp.Answer) != 1 {
+			t.Errorf("%s: got answer %v after the reload", name, resp.Answer)
+		}
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	_, tcp := startServer(t, newTestAuthority(t))
+
+	conn, err := net.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// Queries are answered in order over the same connection.
+	for _, name := range []string{"www.example.org.", "ns1.example.org."} {
+		queryb := mustPack(t, newQuery(t, name, dns.TypeA))
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, uint16(len(queryb)))
+		if _, err := conn.Write(append(b, queryb...)); err != nil {
+			t.Fatal(err)
+		}
+
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			t.Fatal(err)
+		}
+		respb := make([]byte, size)
+		if _, err := io.ReadFull(conn, respb); err != nil {
+			t.Fatal(err)
+		}
+		resp := new(dns.Msg)
+		if _, err := resp.Unpack(respb); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].Name != name {
+			t.Errorf("%s answer error: got %v", name, resp.Answer)
+		}
+	}
+}
+
+// exchangeConn sends the query over the (TCP or TLS) connection, and returns
+// the response.
+func exchangeConn(conn net.Conn, query *dns.Msg) (*dns.Msg, error) {
+	queryb, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(len(queryb)))
+	if _, err := conn.Write(append(b, queryb...)); err != nil {
+		return nil, err
+	}
+
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	respb := make([]byte, size)
+	if _, err := io.ReadFull(conn, respb); err != nil {
+		return nil, err
+	}
+	resp := new(dns.Msg)
+	if _, err := resp.Unpack(respb); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func TestServeTCPKeepalive(t *testing.T) {
+	udp, tcp := startServer(t, newTestAuthority(t))
+
+	conn, err := net.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	query := newQuery(t, "www.example.org.", dns.TypeA)
+	if err := query.SetTCPKeepalive(0); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := exchangeConn(conn, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, ok, err := resp.TCPKeepalive()
+	if !ok || err != nil || timeout != DefaultIdleTimeout {
+		t.Errorf("got keepalive %s (%t, %v), want %s", timeout, ok, err, DefaultIdleTimeout)
+	}
+
+	// Over UDP the option is ignored.
+	resp = exchangeUDP(t, udp, mustPack(t, query))
+	if _, ok, _ := resp.TCPKeepalive(); ok || resp.RCode != dns.RCodeNoError {
+		t.Errorf("got %s with keepalive %t over udp", resp.RCode, ok)
+	}
+
+	// A query with a timeout is malformed.
+	query.QR = 1
+	if err := query.SetTCPKeepalive(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	query.QR = 0
+	resp, err = exchangeConn(conn, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RCode != dns.RCodeFormatError {
+		t.Errorf("got %s for a query with a timeout, want FORMERR", resp.RCode)
+	}
+}
+
+func TestServeTCPKeepaliveCached(t *testing.T) {
+	// The keepalive option of a response over TCP must not end up in the cached
+	// response that's written to clients over UDP.
+	udp, tcp := startServer(t, Chain(newTestAuthority(t), NewResponseCache(10).Middleware()))
+
+	conn, err := net.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	query := newQuery(t, "www.example.org.", dns.TypeA)
+	if err := query.SetTCPKeepalive(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exchangeConn(conn, query); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := exchangeUDP(t, udp, mustPack(t, query))
+	if _, ok, _ := resp.TCPKeepalive(); ok {
+		t.Error("got keepalive in a cached response over udp")
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	// The test server certificate is valid for 127.0.0.1.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	clientConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+
+	if err := (&Server{Addr: "127.0.0.1:0"}).ListenAndServeTLS(context.Background(), &tls.Config{}); err == nil {
+		t.Error("got no error for a config without certificate")
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		resp := Reply(query, dns.RCodeNoError)
+		rr, _ := dns.NewRR(query.Question.QName, dns.TypeTXT, dns.ClassIN, 60, append([]byte{byte(len(w.Network()))}, w.Network()...))
+		resp.Answer = []dns.RR{rr}
+		w.WriteMsg(resp)
+	})}
+	go s.Serve(ctx, nil, l)
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	resp, err := exchangeConn(conn, newQuery(t, "example.org.", dns.TypeTXT))
+	if err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].RDataUnpacked != `"tls"` {
+		t.Errorf("network error: got %v - want tls", resp.Answer)
+	}
+}
+
+func TestServeMaxConns(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{Handler: newTestAuthority(t), MaxConns: 1}
+	go s.Serve(ctx, nil, l)
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		return conn
+	}
+	query := newQuery(t, "www.example.org.", dns.TypeA)
+
+	first := dial()
+	if _, err := exchangeConn(first, query); err != nil {
+		t.Fatalf("failed to exchange: %v", err)
+	}
+
+	// The second connection exceeds the limit, so it's closed.
+	second := dial()
+	defer second.Close()
+	if _, err := exchangeConn(second, query); err == nil {
+		t.Error("got no error for a connection that exceeds the limit")
+	}
+
+	// Once the first connection is closed, a new one is served.
+	first.Close()
+	for i := 0; ; i++ {
+		conn := dial()
+		_, err := exchangeConn(conn, query)
+		conn.Close()
+		if err == nil {
+			break
+		}
+		if i == 20 {
+			t.Fatalf("failed to exchange after closing a connection: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeMaxUDPQueries(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Queries for slow.example.org. are answered once they're released.
+	handling := make(chan struct{}, 1)
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		if query.Question.QName == "slow.example.org." {
+			handling <- struct{}{}
+			<-release
+		}
+		nameHandler("h").ServeDNS(ctx, w, query)
+	})
+	s := &Server{Handler: h, MaxUDPQueries: 1}
+	go s.Serve(ctx, pc, nil)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(name string, id uint16) {
+		query := newQuery(t, name, dns.TypeTXT)
+		query.ID = id
+		if _, err := conn.Write(mustPack(t, query)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(timeout time.Duration) (*dns.Msg, error) {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		buf := make([]byte, maxMsgSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp := new(dns.Msg)
+		_, err = resp.Unpack(buf[:n])
+		return resp, err
+	}
+
+	// While the slow query is handled, other queries are dropped.
+	send("slow.example.org.", 1)
+	<-handling
+	send("www.example.org.", 2)
+	if resp, err := read(200 * time.Millisecond); err == nil {
+		t.Errorf("got response %d while the limit is reached", resp.ID)
+	}
+
+	close(release)
+	if resp, err := read(2 * time.Second); err != nil || resp.ID != 1 {
+		t.Fatalf("got %v (%v) - want the response to the slow query", resp, err)
+	}
+
+	// Once the slow query is answered, new queries are handled; the slot may
+	// be freed right after the response was written.
+	for i := 0; ; i++ {
+		send("www.example.org.", 3)
+		resp, err := read(200 * time.Millisecond)
+		if err == nil && resp.ID == 3 {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("got %v (%v) - want the response to a new query", resp, err)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	udp, _ := startServer(t, HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		// The label of the name is too long, so the response can't be packed.
+		resp := Reply(query, dns.RCodeNoError)
+		resp.Answer = []dns.RR{{Name: strings.Repeat("a", 64) + ".", Type: dns.TypeA, Class: dns.ClassIN}}
+		w.WriteMsg(resp)
+	}))
+
+	query := newQuery(t, "example.org.", dns.TypeA)
+	if resp := exchangeUDP(t, udp, mustPack(t, query)); resp.RCode != dns.RCodeServerFailure {
+		t.Errorf("invalid response rcode error: got %s - want %s", resp.RCode, dns.RCodeServerFailure)
+	}
+
+	query.OpCode = dns.OpCodeStatus
+	if resp := exchangeUDP(t, udp, mustPack(t, query)); resp.RCode != dns.RCodeNotImplemented {
+		t.Errorf("opcode rcode error: got %s - want %s", resp.RCode, dns.RCodeNotImplemented)
+	}
+
+	// The question is cut off.
+	query.OpCode = dns.OpCodeQuery
+	b := mustPack(t, query)
+	resp := exchangeUDP(t, udp, b[:len(b)-3])
+	if resp.RCode != dns.RCodeFormatError || resp.ID != query.ID {
+		t.Errorf("malformed query error: got %s id %d - want %s id %d", resp.RCode, resp.ID, dns.RCodeFormatError, query.ID)
+	}
+}
+
+func TestServeResponseWriter(t *testing.T) {
+	udp, tcp := startServer(t, HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		// Answer with the network and the client address.
+		resp := Reply(query, dns.RCodeNoError)
+		for _, s := range []string{w.Network(), w.RemoteAddr().String()} {
+			rr, err := dns.NewRR(query.Question.QName, dns.TypeTXT, dns.ClassIN, 60, append([]byte{byte(len(s))}, s...))
+			if err != nil {
+				t.Error(err)
+			}
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	}))
+
+	query := newQuery(t, "example.org.", dns.TypeTXT)
+	resp := exchangeUDP(t, udp, mustPack(t, query))
+	if len(resp.Answer) != 2 || resp.Answer[0].RDataUnpacked != `"udp"` {
+		t.Fatalf("udp error: got %v", resp.Answer)
+	}
+	if !strings.HasPrefix(resp.Answer[1].RDataUnpacked, `"127.0.0.1:`) {
+		t.Errorf("udp remote address error: got %s", resp.Answer[1].RDataUnpacked)
+	}
+
+	conn, err := net.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	queryb := mustPack(t, query)
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(len(queryb)))
+	if _, err := conn.Write(append(b, queryb...)); err != nil {
+		t.Fatal(err)
+	}
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		t.Fatal(err)
+	}
+	respb := make([]byte, size)
+	if _, err := io.ReadFull(conn, respb); err != nil {
+		t.Fatal(err)
+	}
+	resp = new(dns.Msg)
+	if _, err := resp.Unpack(respb); err != nil {
+		t.Fatal(err)
+	}
+	want := `"` + conn.LocalAddr().String() + `"`
+	if len(resp.Answer) != 2 || resp.Answer[0].RDataUnpacked != `"tcp"` || resp.Answer[1].RDataUnpacked != want {
+		t.Errorf("tcp error: got %v - want tcp and %s", resp.Answer, want)
+	}
+}
+
+func TestServeTruncation(t *testing.T) {
+	txt := make([]byte, 201)
+	txt[0] = 200
+	udp, _ := startServer(t, HandlerFunc(func(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+		resp := Reply(query, dns.RCodeNoError)
+		for i := 0; i < 5; i++ {
+			rr, err := dns.NewRR(query.Question.QName, dns.TypeTXT, dns.ClassIN, 60, txt)
+			if err != nil {
+				t.Error(err)
+			}
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	}))
+
+	// Without EDNS(0) the response exceeds 512 bytes.
+	query := newQuery(t, "example.org.", dns.TypeTXT)
+	resp := exchangeUDP(t, udp, mustPack(t, query))
+	if resp.TC != 1 || len(resp.Answer) != 0 {
+		t.Errorf("truncation error: got tc %d with %d answers - want tc 1 without answers", resp.TC, len(resp.Answer))
+	}
+
+	query.SetEDNS0(dns.DefaultEDNSUDPSize, false)
+	resp = exchangeUDP(t, udp, mustPack(t, query))
+	if resp.TC != 0 || len(resp.Answer) != 5 || resp.OPT() == nil {
+		t.Errorf("edns error: got tc %d with %d answers - want tc 0 with 5 answers and opt", resp.TC, len(resp.Answer))
+	}
+}
+
+// answerTransport answers every query authoritatively with an A resource
+// record, except for names under "nx.", which don't exist.
+type answerTransport struct{}
+
+func (t *answerTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	resp := *query
+	resp.QR = 1
+	resp.AA = 1
+	resp.Additional = nil
+
+	name := query.Question.QName
+	if strings.HasSuffix(strings.ToLower(name), "nx.") {
+		resp.RCode = dns.RCodeNameError
+		return &resp, nil
+	}
+	rr, err := dns.NewRR(name, dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+	if err != nil {
+		return nil, err
+	}
+	resp.Answer = []dns.RR{rr}
+
+	return &resp, nil
+}
+
+func TestServeRecursive(t *testing.T) {
+	client := resolver.NewClient(
+		resolver.WithRootServers(net.ParseIP("192.0.2.53")),
+		resolver.WithTransport(&answerTransport{}),
+	)
+	udp, _ := startServer(t, NewRecursive(client))
+
+	resp := exchangeUDP(t, udp, mustPack(t, newQuery(t, "www.example.org.", dns.TypeA)))
+	if resp.RCode != dns.RCodeNoError || resp.RA != 1 || resp.AA != 0 || len(resp.Answer) != 1 {
+		t.Errorf(
+			"answer error: got %s ra %d aa %d with %d answers - want NOERROR ra 1 aa 0 with 1 answer",
+			resp.RCode, resp.RA, resp.AA, len(resp.Answer),
+		)
+	}
+
+	resp = exchangeUDP(t, udp, mustPack(t, newQuery(t, "www.nx.", dns.TypeA)))
+	if resp.RCode != dns.RCodeNameError {
+		t.Errorf("nxdomain error: got %s - want %s", resp.RCode, dns.RCodeNameError)
+	}
+}
+
+// upstreamTransport answers queries like answerTransport, except for queries
+// to failing upstreams, which fail; it records the upstreams that were queried.
+type upstreamTransport struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	queried []string
+}
+
+func (t *upstreamTransport) Exchange(
+	ctx context.Context,
+	query *dns.Msg,
+	addr string,
+) (*dns.Msg, error) {
+	t.mu.Lock()
+	t.queried = append(t.queried, addr)
+	failing := t.failing[addr]
+	t.mu.Unlock()
+
+	if failing {
+		return nil, fmt.Errorf("upstream %s is down", addr)
+	}
+
+	return (&answerTransport{}).Exchange(ctx, query, addr)
+}
+
+// reset sets the failing upstreams, and forgets the queried ones.
+func (t *upstreamTransport) reset(failing ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failing = map[string]bool{}
+	for _, addr := range failing {
+		t.failing[addr] = true
+	}
+	t.queried = nil
+}
+
+func TestServeForward(t *testing.T) {
+	tr := &upstreamTransport{}
+	f := NewForwarder(
+		PolicyRoundRobin, 0,
+		Upstream{Addr: "a", Transport: tr},
+		Upstream{Addr: "b", Transport: tr},
+	)
+	query := newQuery(t, "www.example.org.", dns.TypeA)
+
+	// Queries are spread over the upstreams.
+	tr.reset()
+	for i := 0; i < 4; i++ {
+		resp := serve(t, f, query)
+		if resp.RCode != dns.RCodeNoError || resp.RA != 1 || len(resp.Answer) != 1 {
+			t.Fatalf("answer error: got %s ra %d with %d answers", resp.RCode, resp.RA, len(resp.Answer))
+		}
+	}
+	if got := strings.Join(tr.queried, ","); got != "a,b,a,b" {
+		t.Errorf("round-robin error: got %s - want a,b,a,b", got)
+	}
+
+	// A failing upstream fails over to the next one, and is avoided once it's
+	// unhealthy.
+	tr.reset("a")
+	for i := 0; i < 2*maxUpstreamFailures; i++ {
+		resp := serve(t, f, query)
+		if resp.RCode != dns.RCodeNoError {
+			t.Fatalf("failover error: got %s - want %s", resp.RCode, dns.RCodeNoError)
+		}
+	}
+	tr.reset("a")
+	serve(t, f, query)
+	if got := strings.Join(tr.queried, ","); got != "b" {
+		t.Errorf("unhealthy error: got %s - want b", got)
+	}
+
+	// When all upstreams fail, the query fails.
+	tr.reset("a", "b")
+	resp := serve(t, f, query)
+	if resp.RCode != dns.RCodeServerFailure || resp.RA != 1 {
+		t.Errorf("servfail error: got %s ra %d - want %s ra 1", resp.RCode, resp.RA, dns.RCodeServerFailure)
+	}
+
+	// The health check finds upstreams that recovered.
+	tr.reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.HealthCheck(ctx, time.Millisecond)
+	}()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if f.upstreams[0].healthy() && f.upstreams[1].healthy() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if !f.upstreams[0].healthy() || !f.upstreams[1].healthy() {
+		t.Errorf("health check error: expected upstreams to be healthy")
+	}
+}
+
+func TestServeForwardFastest(t *testing.T) {
+	tr := &upstreamTransport{}
+	f := NewForwarder(
+		PolicyFastest, 0,
+		Upstream{Addr: "slow", Transport: tr},
+		Upstream{Addr: "fast", Transport: tr},
+	)
+	f.upstreams[0].success(time.Millisecond * 100)
+	f.upstreams[1].success(time.Millisecond * 10)
+
+	tr.reset()
+	serve(t, f, newQuery(t, "www.example.org.", dns.TypeA))
+	if got := strings.Join(tr.queried, ","); got != "fast" {
+		t.Errorf("fastest error: got %s - want fast", got)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Views is a handler that passes the queries of every client to the handler
+// of the first view whose networks contain its IP address, so clients can be
+// served different zone data or resolved differently (split-horizon DNS, e.g.
+// an internal and an external view). Queries of clients that match no view
+// are refused.
+//
+// Views are safe for concurrent use; views can be added while they serve
+// queries.
+type Views struct {
+	// mu guards views.
+	mu sync.RWMutex
+
+	views []view
+}
+
+// view is a named handler for the clients in its networks.
+type view struct {
+	name    string
+	nets    []*net.IPNet
+	handler Handler
+}
+
+// NewViews creates Views without views.
+func NewViews() *Views {
+	return &Views{}
+}
+
+// Handle adds a view of the handler for the clients in the networks (e.g.
+// 0.0.0.0/0 and ::/0 for all clients). Views are matched in the order they
+// were added.
+func (v *Views) Handle(name string, h Handler, nets ...*net.IPNet) {
+	if h == nil {
+		panic("server: nil handler")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.views = append(v.views, view{name: name, nets: append([]*net.IPNet{}, nets...), handler: h})
+}
+
+// Match returns the name and handler of the first view whose networks contain
+// the IP address; it reports false when no view does.
+func (v *Views) Match(ip net.IP) (string, Handler, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, vw := range v.views {
+		for _, n := range vw.nets {
+			if n.Contains(ip) {
+				return vw.name, vw.handler, true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+// ServeDNS passes the query to the handler of the view of the client.
+func (v *Views) ServeDNS(ctx context.Context, w ResponseWriter, query *dns.Msg) {
+	ip := net.ParseIP(addrIP(w.RemoteAddr()))
+	_, h, ok := v.Match(ip)
+	if ip == nil || !ok {
+		w.WriteMsg(Reply(query, dns.RCodeRefused))
+		return
+	}
+
+	h.ServeDNS(ctx, w, query)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestViews(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// The test writer's client is 192.0.2.1.
+	v := NewViews()
+	v.Handle("lan", nameHandler("lan"), cidr("192.168.0.0/16"))
+	v.Handle("internal", nameHandler("internal"), cidr("10.0.0.0/8"), cidr("192.0.2.0/24"))
+	v.Handle("external", nameHandler("external"), cidr("0.0.0.0/0"))
+
+	resp := serve(t, v, newQuery(t, "example.org.", dns.TypeTXT))
+	if len(resp.Answer) != 1 || resp.Answer[0].RDataUnpacked != `"internal"` {
+		t.Errorf("got answers %v - want the internal view", resp.Answer)
+	}
+	for ip, want := range map[string]string{"192.168.1.1": "lan", "198.51.100.1": "external", "::1": ""} {
+		name, _, ok := v.Match(net.ParseIP(ip))
+		if name != want || ok != (want != "") {
+			t.Errorf("%s: got view %q (%t) - want %q", ip, name, ok, want)
+		}
+	}
+
+	// Clients that match no view are refused.
+	v = NewViews()
+	v.Handle("lan", nameHandler("lan"), cidr("192.168.0.0/16"))
+	if resp := serve(t, v, newQuery(t, "example.org.", dns.TypeTXT)); resp.RCode != dns.RCodeRefused {
+		t.Errorf("got %s - want REFUSED", resp.RCode)
+	}
+}
@@ -0,0 +1,5 @@
+// Package trustanchor manages the DNSSEC trust anchors of the root zone, and
+// tracks Key Signing Key rollovers with RFC 5011.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5011
+package trustanchor
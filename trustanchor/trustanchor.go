@@ -0,0 +1,403 @@
+package trustanchor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// State represents the RFC 5011 state of a trust anchor key.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5011#section-4
+type State uint8
+
+// String returns the string representation of a trust anchor key state.
+func (s State) String() string {
+	return StateToString[s]
+}
+
+const (
+	// StateAddPend means the key was seen, but the add hold-down time hasn't
+	// passed yet; the key is not trusted.
+	StateAddPend State = iota
+
+	// StateValid means the key is trusted.
+	StateValid
+
+	// StateMissing means a trusted key is no longer in the DNSKEY resource record
+	// set, but was not revoked; the key is still trusted.
+	StateMissing
+
+	// StateRevoked means the key was revoked; the key is not trusted.
+	StateRevoked
+)
+
+// StateToString maps a trust anchor key state to a string.
+var StateToString = map[State]string{
+	StateAddPend: "AddPend",
+	StateValid:   "Valid",
+	StateMissing: "Missing",
+	StateRevoked: "Revoked",
+}
+
+const (
+	// AddHoldDown is the time a new key must be seen before it's trusted.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5011#section-2.4.1
+	AddHoldDown = 30 * 24 * time.Hour
+
+	// RemoveHoldDown is the time a revoked key is remembered before it's
+	// removed.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5011#section-2.4.2
+	RemoveHoldDown = 30 * 24 * time.Hour
+)
+
+// Key is a trust anchor key of the root zone. A key loaded from the IANA root
+// anchors only has a DS record, until the DNSKEY record it refers to is seen.
+type Key struct {
+	DS     *dns.DS     `json:"ds,omitempty"`
+	DNSKEY *dns.DNSKEY `json:"dnskey,omitempty"`
+	State  State       `json:"state"`
+
+	// Changed is the time of the last state change.
+	Changed time.Time `json:"changed"`
+}
+
+// matches reports whether the key refers to the DNSKEY record. A revoked
+// DNSKEY record still matches, even though its key tag changed.
+func (k *Key) matches(key *dns.DNSKEY) bool {
+	unrevoked := *key
+	unrevoked.Flags &^= dns.DNSKEYFlagRevoke
+
+	if k.DNSKEY != nil {
+		a, _ := k.DNSKEY.Pack()
+		b, _ := unrevoked.Pack()
+		return string(a) == string(b)
+	}
+
+	ds, err := unrevoked.ToDS(".", k.DS.DigestType)
+	if err != nil {
+		return false
+	}
+	return ds.Equal(k.DS)
+}
+
+// trusted reports whether the key is a trust anchor.
+func (k *Key) trusted() bool {
+	return k.State == StateValid || k.State == StateMissing
+}
+
+// Store manages the trust anchor keys of the root zone, and persists their
+// state to a file.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	keys []*Key
+}
+
+// New creates a store for the DS records, which are trusted immediately. The
+// state is persisted to the file at path.
+func New(path string, ds []dns.DS) *Store {
+	s := &Store{path: path}
+	for i := range ds {
+		d := ds[i]
+		s.keys = append(s.keys, &Key{
+			DS:      &d,
+			State:   StateValid,
+			Changed: time.Now(),
+		})
+	}
+
+	return s
+}
+
+// Load loads a store from the state file at path.
+func Load(path string) (*Store, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust anchor state: %w", err)
+	}
+
+	s := &Store{path: path}
+	if err := json.Unmarshal(b, &s.keys); err != nil {
+		return nil, fmt.Errorf("failed to decode trust anchor state: %v", err)
+	}
+
+	return s, nil
+}
+
+// Save persists the state of the store to its file.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trust anchor state: %v", err)
+	}
+
+	// Write to a temporary file first, so a crash never leaves a partially
+	// written state file behind.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write trust anchor state: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write trust anchor state: %v", err)
+	}
+
+	return nil
+}
+
+// Keys returns a copy of the trust anchor keys.
+func (s *Store) Keys() []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, *k)
+	}
+
+	return keys
+}
+
+// DS returns the DS records of the trusted keys.
+func (s *Store) DS() []dns.DS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds := []dns.DS{}
+	for _, k := range s.keys {
+		if !k.trusted() {
+			continue
+		}
+		if k.DNSKEY != nil {
+			d, err := k.DNSKEY.ToDS(".", dns.DigestTypeSHA256)
+			if err == nil {
+				ds = append(ds, *d)
+			}
+			continue
+		}
+		ds = append(ds, *k.DS)
+	}
+
+	return ds
+}
+
+// Update updates the state of the keys with the (answer section of the) DNSKEY
+// resource record set of the root zone, as observed at time now. The resource
+// record set must be signed by a trusted key; otherwise it's ignored.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5011#section-4
+func (s *Store) Update(rrs []dns.RR, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rrset := []dns.RR{}
+	keys := []dns.DNSKEY{}
+	sigs := []dns.RRSIG{}
+	for _, rr := range rrs {
+		if rr.Name != "." {
+			continue
+		}
+		switch rr.Type {
+		case dns.TypeDNSKEY:
+			k := dns.DNSKEY{}
+			if err := k.Unpack(rr.RData); err != nil {
+				return fmt.Errorf("failed to unpack dnskey: %v", err)
+			}
+			rrset = append(rrset, rr)
+			keys = append(keys, k)
+		case dns.TypeRRSIG:
+			sig := dns.RRSIG{}
+			if err := sig.Unpack(rr.RData); err != nil {
+				return fmt.Errorf("failed to unpack rrsig: %v", err)
+			}
+			if sig.TypeCovered == dns.TypeDNSKEY && sig.ValidAt(now) {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+
+	// signedBy reports whether the resource record set is signed by the key.
+	signedBy := func(key *dns.DNSKEY) bool {
+		for i := range sigs {
+			if sigs[i].Verify(key, rrset) == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	validated := false
+	for _, k := range s.keys {
+		if !k.trusted() {
+			continue
+		}
+		for i := range keys {
+			if keys[i].Flags&dns.DNSKEYFlagRevoke != 0 {
+				continue
+			}
+			if k.matches(&keys[i]) && signedBy(&keys[i]) {
+				validated = true
+			}
+		}
+	}
+	if !validated {
+		return fmt.Errorf("dnskey rrset is not signed by a trusted key")
+	}
+
+	seen := map[*Key]bool{}
+	for i := range keys {
+		key := keys[i]
+
+		// Only Secure Entry Point keys can be trust anchors.
+		if key.Flags&dns.DNSKEYFlagSEP == 0 {
+			continue
+		}
+
+		var known *Key
+		for _, k := range s.keys {
+			if k.matches(&key) {
+				known = k
+				break
+			}
+		}
+
+		// A revoked key must sign the resource record set itself to prove the
+		// revocation is authentic.
+		//
+		// See: https://datatracker.ietf.org/doc/html/rfc5011#section-2.1
+		if key.Flags&dns.DNSKEYFlagRevoke != 0 {
+			if known != nil && known.State != StateRevoked && signedBy(&key) {
+				known.State = StateRevoked
+				known.Changed = now
+			}
+			if known != nil {
+				seen[known] = true
+			}
+			continue
+		}
+
+		if known == nil {
+			known = &Key{State: StateAddPend, Changed: now}
+			s.keys = append(s.keys, known)
+		}
+		if known.DNSKEY == nil {
+			known.DNSKEY = &key
+		}
+		seen[known] = true
+
+		switch known.State {
+		case StateAddPend:
+			if now.Sub(known.Changed) >= AddHoldDown {
+				known.State = StateValid
+				known.Changed = now
+			}
+		case StateMissing:
+			known.State = StateValid
+			known.Changed = now
+		}
+	}
+
+	kept := []*Key{}
+	for _, k := range s.keys {
+		if !seen[k] {
+			switch k.State {
+			// A pending key that disappears is forgotten.
+			case StateAddPend:
+				continue
+			case StateValid:
+				k.State = StateMissing
+				k.Changed = now
+			}
+		}
+		if k.State == StateRevoked && now.Sub(k.Changed) >= RemoveHoldDown {
+			continue
+		}
+		kept = append(kept, k)
+	}
+	s.keys = kept
+
+	return nil
+}
+
+// rootAnchors represents the IANA root anchors XML document.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc9718#section-2
+type rootAnchors struct {
+	XMLName    xml.Name `xml:"TrustAnchor"`
+	Zone       string   `xml:"Zone"`
+	KeyDigests []struct {
+		ID         string `xml:"id,attr"`
+		ValidFrom  string `xml:"validFrom,attr"`
+		ValidUntil string `xml:"validUntil,attr"`
+		KeyTag     uint16 `xml:"KeyTag"`
+		Algorithm  uint8  `xml:"Algorithm"`
+		DigestType uint8  `xml:"DigestType"`
+		Digest     string `xml:"Digest"`
+	} `xml:"KeyDigest"`
+}
+
+// ParseRootAnchors parses the IANA root anchors XML document, and returns the
+// DS records of the keys that are valid at time now.
+//
+// See: https://data.iana.org/root-anchors/root-anchors.xml
+func ParseRootAnchors(r io.Reader, now time.Time) ([]dns.DS, error) {
+	ra := rootAnchors{}
+	if err := xml.NewDecoder(r).Decode(&ra); err != nil {
+		return nil, fmt.Errorf("failed to decode root anchors: %v", err)
+	}
+	if ra.Zone != "." {
+		return nil, fmt.Errorf("unexpected trust anchor zone %q", ra.Zone)
+	}
+
+	ds := []dns.DS{}
+	for _, kd := range ra.KeyDigests {
+		if kd.ValidFrom != "" {
+			from, err := time.Parse(time.RFC3339, kd.ValidFrom)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validFrom of %s: %v", kd.ID, err)
+			}
+			if now.Before(from) {
+				continue
+			}
+		}
+		if kd.ValidUntil != "" {
+			until, err := time.Parse(time.RFC3339, kd.ValidUntil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validUntil of %s: %v", kd.ID, err)
+			}
+			if !now.Before(until) {
+				continue
+			}
+		}
+
+		digest, err := hex.DecodeString(strings.TrimSpace(kd.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest of %s: %v", kd.ID, err)
+		}
+		ds = append(ds, dns.DS{
+			KeyTag:     kd.KeyTag,
+			Algorithm:  dns.Algorithm(kd.Algorithm),
+			DigestType: dns.DigestType(kd.DigestType),
+			Digest:     digest,
+		})
+	}
+
+	if len(ds) == 0 {
+		return nil, fmt.Errorf("no valid root anchors")
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,175 @@
+package trustanchor
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+const rootAnchorsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<TrustAnchor id="0B9DD3F1-4D06-4E3A-8D4A-6E4A9E5D1F2A" source="http://data.iana.org/root-anchors/root-anchors.xml">
+<Zone>.</Zone>
+<KeyDigest id="Kjqmt7v" validFrom="2010-07-15T00:00:00+00:00" validUntil="2019-01-11T00:00:00+00:00">
+<KeyTag>19036</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5</Digest>
+</KeyDigest>
+<KeyDigest id="Klajeyz" validFrom="2017-02-02T00:00:00+00:00">
+<KeyTag>20326</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D</Digest>
+</KeyDigest>
+</TrustAnchor>`
+
+func TestParseRootAnchors(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ds, err := ParseRootAnchors(strings.NewReader(rootAnchorsXML), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds) != 1 {
+		t.Fatalf("root anchors length error: got %v - want %v", len(ds), 1)
+	}
+	if ds[0].KeyTag != 20326 {
+		t.Errorf("root anchor key tag error: got %v - want %v", ds[0].KeyTag, 20326)
+	}
+}
+
+// testKey is a root zone key with its private key.
+type testKey struct {
+	dnskey dns.DNSKEY
+	priv   ed25519.PrivateKey
+}
+
+func newTestKey(t *testing.T) *testKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKey{
+		dnskey: dns.DNSKEY{
+			Flags:     dns.DNSKEYFlagZone | dns.DNSKEYFlagSEP,
+			Protocol:  3,
+			Algorithm: dns.AlgorithmED25519,
+			PublicKey: pub,
+		},
+		priv: priv,
+	}
+}
+
+// rootDNSKEY creates the DNSKEY resource record set of the root zone with its
+// signatures; the resource record set is signed by all signers.
+func rootDNSKEY(t *testing.T, now time.Time, keys []*testKey, signers []*testKey) []dns.RR {
+	rrset := []dns.RR{}
+	for _, k := range keys {
+		rdata, _ := k.dnskey.Pack()
+		rrset = append(rrset, dns.RR{
+			Name:  ".",
+			Type:  dns.TypeDNSKEY,
+			Class: dns.ClassIN,
+			TTL:   172800,
+			RData: rdata,
+		})
+	}
+
+	rrs := append([]dns.RR{}, rrset...)
+	for _, k := range signers {
+		sig := dns.RRSIG{
+			TypeCovered: dns.TypeDNSKEY,
+			Algorithm:   k.dnskey.Algorithm,
+			OrigTTL:     172800,
+			Expiration:  uint32(now.Add(time.Hour).Unix()),
+			Inception:   uint32(now.Add(-time.Hour).Unix()),
+			KeyTag:      k.dnskey.KeyTag(),
+			SignerName:  ".",
+		}
+		if err := sig.Sign(k.priv, rrset); err != nil {
+			t.Fatal(err)
+		}
+		rdata, _ := sig.Pack()
+		rrs = append(rrs, dns.RR{
+			Name:  ".",
+			Type:  dns.TypeRRSIG,
+			Class: dns.ClassIN,
+			TTL:   172800,
+			RData: rdata,
+		})
+	}
+
+	return rrs
+}
+
+func TestStoreRollover(t *testing.T) {
+	now := time.Now()
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+
+	ds, err := oldKey.dnskey.ToDS(".", dns.DigestTypeSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "root.json")
+	s := New(path, []dns.DS{*ds})
+
+	// A new key is published, but not trusted until the add hold-down time has
+	// passed.
+	rrs := rootDNSKEY(t, now, []*testKey{oldKey, newKey}, []*testKey{oldKey})
+	if err := s.Update(rrs, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.DS()); got != 1 {
+		t.Errorf("trusted keys error: got %v - want %v", got, 1)
+	}
+
+	now = now.Add(AddHoldDown)
+	rrs = rootDNSKEY(t, now, []*testKey{oldKey, newKey}, []*testKey{oldKey})
+	if err := s.Update(rrs, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.DS()); got != 2 {
+		t.Errorf("trusted keys error: got %v - want %v", got, 2)
+	}
+
+	// The state must survive a restart.
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old key is revoked, and signs the resource record set to prove it.
+	revoked := *oldKey
+	revoked.dnskey.Flags |= dns.DNSKEYFlagRevoke
+	rrs = rootDNSKEY(t, now, []*testKey{&revoked, newKey}, []*testKey{&revoked, newKey})
+	if err := s.Update(rrs, now); err != nil {
+		t.Fatal(err)
+	}
+	trusted := s.DS()
+	if len(trusted) != 1 {
+		t.Fatalf("trusted keys error: got %v - want %v", len(trusted), 1)
+	}
+	if trusted[0].KeyTag != newKey.dnskey.KeyTag() {
+		t.Errorf(
+			"trusted key tag error: got %v - want %v",
+			trusted[0].KeyTag, newKey.dnskey.KeyTag(),
+		)
+	}
+
+	// A resource record set that isn't signed by a trusted key is ignored.
+	rogue := newTestKey(t)
+	rrs = rootDNSKEY(t, now, []*testKey{rogue}, []*testKey{rogue})
+	if err := s.Update(rrs, now); err == nil {
+		t.Errorf("untrusted update error: got nil - want error")
+	}
+}
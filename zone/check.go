@@ -0,0 +1,290 @@
+package zone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// Severity is the severity of a problem in a zone.
+type Severity int
+
+const (
+	// SeverityWarning means the zone works, but likely not as intended.
+	SeverityWarning Severity = iota
+
+	// SeverityError means the zone is invalid, and name servers may refuse to
+	// load it.
+	SeverityError
+)
+
+// String returns the string representation of a severity.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "ERROR"
+	}
+
+	return "WARN"
+}
+
+// Problem is a semantic problem with a resource record set of a zone.
+type Problem struct {
+	Severity Severity
+
+	// Name and Type identify the resource record set; Type is zero for
+	// problems of a name or of the zone.
+	Name string
+	Type dns.Type
+
+	Msg string
+}
+
+// String returns the problem as "SEVERITY name type: msg".
+func (p Problem) String() string {
+	if p.Type == 0 {
+		return fmt.Sprintf("%s %s: %s", p.Severity, p.Name, p.Msg)
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", p.Severity, p.Name, p.Type, p.Msg)
+}
+
+// checker collects the problems of a zone.
+type checker struct {
+	origin string
+
+	// rrsets holds the resource record sets per (lower case) owner name and
+	// type, and names holds the owners in the order they appear.
+	rrsets map[string]map[dns.Type][]dns.RR
+	names  []string
+
+	// exists holds the names that exist: the owner names in the zone, and
+	// their ancestors in the zone (empty non-terminals).
+	exists map[string]bool
+
+	problems []Problem
+}
+
+// Check checks the resource records of a zone for semantic problems: a
+// missing or misplaced SOA record, missing NS records at the apex, CNAME
+// records that coexist with other data, out of zone records, resource record
+// sets with different TTLs, and CNAME, NS, MX and SRV records whose target in
+// the zone doesn't exist (or has no addresses), and ZONEMD records whose
+// digest doesn't match the zone. When the origin is empty, it's the owner name
+// of the first SOA resource record.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-3.6.2
+// See: https://datatracker.ietf.org/doc/html/rfc2181#section-5.2
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-4
+func Check(origin string, rrs []dns.RR) []Problem {
+	if origin == "" {
+		for _, rr := range rrs {
+			if rr.Type == dns.TypeSOA {
+				origin = rr.Name
+				break
+			}
+		}
+	}
+
+	c := &checker{
+		rrsets: map[string]map[dns.Type][]dns.RR{},
+		exists: map[string]bool{},
+	}
+	if origin == "" {
+		c.add(SeverityError, ".", 0, "missing SOA record; the origin of the zone is unknown")
+	} else {
+		c.origin = strings.ToLower(dns.Fqdn(origin))
+	}
+
+	for _, rr := range rrs {
+		name := strings.ToLower(dns.Fqdn(rr.Name))
+		if c.origin != "" && !dns.IsSubDomain(c.origin, name) {
+			c.add(SeverityError, rr.Name, rr.Type, "record is out of zone %s", c.origin)
+			continue
+		}
+		if c.rrsets[name] == nil {
+			c.rrsets[name] = map[dns.Type][]dns.RR{}
+			c.names = append(c.names, name)
+		}
+		c.rrsets[name][rr.Type] = append(c.rrsets[name][rr.Type], rr)
+		for n := name; !c.exists[n]; n = dns.ParentDomainName(n) {
+			c.exists[n] = true
+			if n == c.origin || n == "." {
+				break
+			}
+		}
+	}
+
+	if c.origin != "" {
+		c.checkApex()
+		if err := dns.VerifyZoneDigest(c.origin, rrs); err != nil {
+			c.add(SeverityError, c.origin, dns.TypeZONEMD, "%v", err)
+		}
+	}
+	for _, name := range c.names {
+		c.checkName(name)
+	}
+
+	return c.problems
+}
+
+// add adds a problem.
+func (c *checker) add(s Severity, name string, t dns.Type, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{
+		Severity: s,
+		Name:     name,
+		Type:     t,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// checkApex checks the SOA and NS resource records of the apex.
+func (c *checker) checkApex() {
+	switch soas := c.rrsets[c.origin][dns.TypeSOA]; {
+	case len(soas) == 0:
+		c.add(SeverityError, c.origin, dns.TypeSOA, "missing SOA record at the apex")
+	case len(soas) > 1:
+		c.add(SeverityError, c.origin, dns.TypeSOA, "%d SOA records; there must be only one", len(soas))
+	}
+	if len(c.rrsets[c.origin][dns.TypeNS]) == 0 {
+		c.add(SeverityError, c.origin, dns.TypeNS, "missing NS records at the apex")
+	}
+}
+
+// checkName checks the resource record sets of the owner name.
+func (c *checker) checkName(name string) {
+	rrsets := c.rrsets[name]
+	types := make([]dns.Type, 0, len(rrsets))
+	for t := range rrsets {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	owner := rrsets[types[0]][0].Name
+	if soas := rrsets[dns.TypeSOA]; len(soas) > 0 && name != c.origin && c.origin != "" {
+		c.add(SeverityError, owner, dns.TypeSOA, "SOA record isn't at the apex of %s", c.origin)
+	}
+
+	// A CNAME resource record can only coexist with the DNSSEC resource records
+	// of its owner.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc2181#section-10.1
+	if cnames := rrsets[dns.TypeCNAME]; len(cnames) > 0 {
+		if len(cnames) > 1 {
+			c.add(SeverityError, owner, dns.TypeCNAME, "%d CNAME records; there must be only one", len(cnames))
+		}
+		other := []string{}
+		for _, t := range types {
+			if t != dns.TypeCNAME && t != dns.TypeRRSIG && t != dns.TypeNSEC {
+				other = append(other, t.String())
+			}
+		}
+		if len(other) > 0 {
+			c.add(SeverityError, owner, dns.TypeCNAME, "CNAME record coexists with %s records", strings.Join(other, ", "))
+		}
+	}
+
+	for _, t := range types {
+		rrset := rrsets[t]
+
+		// RRSIG resource records of different covered types may have different
+		// TTLs.
+		if t != dns.TypeRRSIG {
+			ttls := []string{}
+			seen := map[uint32]bool{}
+			for _, rr := range rrset {
+				if !seen[rr.TTL] {
+					seen[rr.TTL] = true
+					ttls = append(ttls, fmt.Sprint(rr.TTL))
+				}
+			}
+			if len(ttls) > 1 {
+				c.add(SeverityWarning, owner, t, "TTLs of the record set differ: %s", strings.Join(ttls, ", "))
+			}
+		}
+
+		for _, rr := range rrset {
+			c.checkTarget(owner, rr)
+		}
+	}
+}
+
+// checkTarget checks the target domain name of a CNAME, NS, MX or SRV
+// resource record, when it's in the zone. An NS, MX or SRV target must have
+// addresses, and mustn't be an alias.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2181#section-10.3
+func (c *checker) checkTarget(owner string, rr dns.RR) {
+	switch rr.Type {
+	case dns.TypeCNAME, dns.TypeNS, dns.TypeMX, dns.TypeSRV:
+	default:
+		return
+	}
+	fields := strings.Fields(rr.RDataUnpacked)
+	if len(fields) == 0 {
+		return
+	}
+	target := strings.ToLower(fields[len(fields)-1])
+
+	// The root is the target of a "null" MX or SRV resource record, which
+	// means there's no service.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc7505
+	if target == "." || c.origin == "" || !dns.IsSubDomain(c.origin, target) {
+		return
+	}
+	// Only glue for the delegated name servers is expected below a zone cut.
+	if c.cut(target) != "" && rr.Type != dns.TypeNS {
+		return
+	}
+
+	if rr.Type == dns.TypeCNAME {
+		if !c.exists[target] && !c.wildcard(target) {
+			c.add(SeverityWarning, owner, rr.Type, "target %s doesn't exist", target)
+		}
+		return
+	}
+	rrsets := c.rrsets[target]
+	if len(rrsets[dns.TypeCNAME]) > 0 {
+		c.add(SeverityWarning, owner, rr.Type, "target %s is an alias (CNAME)", target)
+		return
+	}
+	if len(rrsets[dns.TypeA]) == 0 && len(rrsets[dns.TypeAAAA]) == 0 {
+		c.add(SeverityWarning, owner, rr.Type, "target %s has no A or AAAA records", target)
+	}
+}
+
+// cut returns the zone cut (i.e. the owner of NS resource records below the
+// apex) at or above the domain name, or an empty string when there's none.
+func (c *checker) cut(name string) string {
+	cut := ""
+	for n := name; n != c.origin && n != "."; n = dns.ParentDomainName(n) {
+		if len(c.rrsets[n][dns.TypeNS]) > 0 {
+			cut = n
+		}
+	}
+
+	return cut
+}
+
+// wildcard checks if a wildcard at the closest encloser of the domain name
+// matches it.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4592#section-3.3.1
+func (c *checker) wildcard(name string) bool {
+	for ce := dns.ParentDomainName(name); dns.IsSubDomain(c.origin, ce); ce = dns.ParentDomainName(ce) {
+		if c.exists[ce] {
+			wildcard := "*." + ce
+			if ce == "." {
+				wildcard = "*."
+			}
+			return len(c.rrsets[wildcard]) > 0
+		}
+		if ce == "." {
+			break
+		}
+	}
+
+	return false
+}
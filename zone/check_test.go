@@ -0,0 +1,100 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestCheck(t *testing.T) {
+	in := `$ORIGIN example.org.
+$TTL 3600
+@	SOA	ns1 hostmaster 1 7200 3600 1209600 300
+	MX	10 mail
+	MX	20 alias
+	MX	30 host.sub
+ns1	A	192.0.2.53
+www	CNAME	web
+www	A	192.0.2.1
+web	300	A	192.0.2.80
+web	600	A	192.0.2.81
+alias	CNAME	nowhere
+wild	CNAME	x.star
+*.star	A	192.0.2.2
+other.example.com.	A	192.0.2.9
+sub	NS	ns.sub
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"ERROR other.example.com. A: record is out of zone example.org.",
+		"ERROR example.org. NS: missing NS records at the apex",
+		"WARN example.org. MX: target mail.example.org. has no A or AAAA records",
+		"WARN example.org. MX: target alias.example.org. is an alias (CNAME)",
+		"ERROR www.example.org. CNAME: CNAME record coexists with A records",
+		"WARN web.example.org. A: TTLs of the record set differ: 300, 600",
+		"WARN alias.example.org. CNAME: target nowhere.example.org. doesn't exist",
+		"WARN sub.example.org. NS: target ns.sub.example.org. has no A or AAAA records",
+	}
+	problems := Check("", rrs)
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems error: got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckMissingSOA(t *testing.T) {
+	a, err := dns.NewRR("www.example.org.", dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := Check("", []dns.RR{a})
+	if len(problems) != 1 || problems[0].Severity != SeverityError {
+		t.Errorf("problems without origin error: got %v - want 1 error", problems)
+	}
+
+	problems = Check("example.org.", []dns.RR{a})
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.Msg)
+	}
+	want := "missing SOA record at the apex, missing NS records at the apex"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("problems error: got %q - want %q", strings.Join(got, ", "), want)
+	}
+}
+
+func TestCheckZONEMD(t *testing.T) {
+	in := `$ORIGIN example.
+@	86400	SOA	ns1 admin 2018031900 1800 900 604800 86400
+	86400	NS	ns1
+	86400	NS	ns2
+	86400	ZONEMD	2018031900 1 1 (
+		c68090d90a7aed716bc459f9340e3d7c1370d4d24b7e2fc3
+		a1ddc0b9a87153b9a9713b3c9ae5cc27777f98b8e730044c )
+ns1	3600	A	203.0.113.63
+ns2	3600	AAAA	2001:db8::63
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := Check("", rrs); len(problems) != 0 {
+		t.Errorf("problems error: got %v - want none", problems)
+	}
+
+	// The digest doesn't match once a record changes.
+	rrs[len(rrs)-1].TTL = 7200
+	problems := Check("", rrs)
+	if len(problems) != 1 || problems[0].Type != dns.TypeZONEMD {
+		t.Errorf("problems error: got %v - want a ZONEMD problem", problems)
+	}
+}
@@ -0,0 +1,6 @@
+// Package zone parses zone files (RFC 1035 master files), and looks up the
+// authoritative answers to queries in the zones they describe.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-4.3.2
+package zone
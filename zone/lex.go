@@ -0,0 +1,218 @@
+package zone
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// position is a position in a zone file; the line and column are 1-based, and
+// the column counts bytes.
+type position struct {
+	line, col int
+}
+
+// token is a field of an entry in a zone file.
+type token struct {
+	position
+
+	// text holds the field as it appears in the file (without the quotes of a
+	// quoted string), so escape sequences aren't decoded.
+	text string
+
+	// quoted is set when the field was a quoted string.
+	quoted bool
+}
+
+// entry is an entry in a zone file: a directive or a resource record. It ends
+// at the end of the line, unless parentheses continue it on the next lines.
+type entry struct {
+	tokens []token
+
+	// blank is set when the entry starts with a blank, so it has the owner of
+	// the previous entry.
+	blank bool
+
+	// end is where the entry ends.
+	end position
+}
+
+// lexer splits a zone file into entries.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5.1
+type lexer struct {
+	src []byte
+
+	// off is the offset of the next byte, and lineOff is the offset of the
+	// line it's on.
+	off     int
+	lineOff int
+	line    int
+}
+
+// newLexer creates a lexer of the zone file.
+func newLexer(src []byte) *lexer {
+	return &lexer{src: src, line: 1}
+}
+
+// pos returns the position of the next byte.
+func (l *lexer) pos() position {
+	return position{line: l.line, col: l.off - l.lineOff + 1}
+}
+
+// next returns the next entry, or io.EOF when there are no more entries.
+// Fields are separated by blanks; a comment starts with ";" and runs until
+// the end of the line, and parentheses group fields that span multiple lines.
+// A quoted string is a single field, in which "\" escapes the next character.
+func (l *lexer) next() (entry, error) {
+	e := entry{}
+	var paren position
+	parens := 0
+
+	for {
+		if l.off == len(l.src) {
+			if parens > 0 {
+				return entry{}, &Error{Line: paren.line, Column: paren.col, Err: fmt.Errorf("unbalanced parenthesis")}
+			}
+			if len(e.tokens) > 0 {
+				e.end = l.pos()
+				return e, nil
+			}
+			return entry{}, io.EOF
+		}
+
+		switch c := l.src[l.off]; c {
+		case '\n':
+			if parens == 0 && len(e.tokens) > 0 {
+				e.end = l.pos()
+				l.newline()
+				return e, nil
+			}
+			l.newline()
+		case ' ', '\t', '\r':
+			l.off++
+		case ';':
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				l.off++
+			}
+		case '(':
+			if parens == 0 {
+				paren = l.pos()
+			}
+			parens++
+			l.off++
+		case ')':
+			if parens == 0 {
+				pos := l.pos()
+				return entry{}, &Error{Line: pos.line, Column: pos.col, Err: fmt.Errorf("unbalanced parenthesis")}
+			}
+			parens--
+			l.off++
+		case '"':
+			tok, err := l.quoted()
+			if err != nil {
+				return entry{}, err
+			}
+			e.add(tok, l.src[l.lineOff])
+		default:
+			e.add(l.field(), l.src[l.lineOff])
+		}
+	}
+}
+
+// add adds the token to the entry; first is the first byte of the line the
+// token is on.
+func (e *entry) add(tok token, first byte) {
+	if len(e.tokens) == 0 {
+		e.blank = first == ' ' || first == '\t'
+	}
+	e.tokens = append(e.tokens, tok)
+}
+
+// newline moves past the newline.
+func (l *lexer) newline() {
+	l.off++
+	l.lineOff = l.off
+	l.line++
+}
+
+// field reads a field that isn't quoted; it ends at a blank, or at a special
+// character that isn't escaped.
+func (l *lexer) field() token {
+	tok := token{position: l.pos()}
+	start := l.off
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		if c == '\\' && l.off+1 < len(l.src) && l.src[l.off+1] != '\n' {
+			l.off += 2
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';' || c == '(' || c == ')' || c == '"' {
+			break
+		}
+		l.off++
+	}
+	tok.text = string(l.src[start:l.off])
+
+	return tok
+}
+
+// quoted reads a quoted string, which must end on the same line.
+func (l *lexer) quoted() (token, error) {
+	tok := token{position: l.pos(), quoted: true}
+	l.off++
+	start := l.off
+	for ; l.off < len(l.src) && l.src[l.off] != '"'; l.off++ {
+		if l.src[l.off] == '\n' {
+			break
+		}
+		if l.src[l.off] == '\\' && l.off+1 < len(l.src) && l.src[l.off+1] != '\n' {
+			l.off++
+		}
+	}
+	if l.off == len(l.src) || l.src[l.off] != '"' {
+		return token{}, &Error{Line: tok.line, Column: tok.col, Err: fmt.Errorf("unterminated quoted string")}
+	}
+	tok.text = string(l.src[start:l.off])
+	l.off++
+
+	return tok, nil
+}
+
+// unescape decodes the escape sequences of a field: "\DDD" is the byte with
+// the decimal value DDD, and "\X" is the character X.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5.1
+func unescape(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return nil, fmt.Errorf("trailing backslash")
+		}
+		if isDigit(s[i+1]) {
+			if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+				return nil, fmt.Errorf("invalid escape sequence %q", s[i:])
+			}
+			v, _ := strconv.Atoi(s[i+1 : i+4])
+			if v > 255 {
+				return nil, fmt.Errorf("invalid escape sequence %q", s[i:i+4])
+			}
+			b = append(b, byte(v))
+			i += 3
+			continue
+		}
+		b = append(b, s[i+1])
+		i++
+	}
+
+	return b, nil
+}
+
+// isDigit checks if the byte is a decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
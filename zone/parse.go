@@ -0,0 +1,884 @@
+package zone
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// maxIncludeDepth is the max number of nested $INCLUDE directives, which
+// prevents include loops.
+const maxIncludeDepth = 8
+
+// base32Hex is the "Base 32 Encoding with Extended Hex Alphabet" without
+// padding, used for NSEC3 hashed owner names.
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Error is an error in a zone file, at a line and column.
+type Error struct {
+	// File is the path of the zone file; it's empty when the zone file isn't
+	// read from a path.
+	File string
+
+	// Line and Column are 1-based, and the column counts bytes.
+	Line   int
+	Column int
+
+	Err error
+}
+
+// Error returns the error prefixed with its position (e.g.
+// "example.org.zone:3:7: invalid address").
+func (e *Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// parser holds the state of a zone file that's parsed; the directives and
+// the previous entry set the defaults of the next entries.
+type parser struct {
+	// file is the path of the zone file, which is empty when it isn't read from
+	// a path; depth is the number of $INCLUDE directives it's nested in.
+	file  string
+	depth int
+
+	// origin is appended to relative domain names ($ORIGIN).
+	origin string
+
+	// ttl is the default TTL ($TTL); hasTTL is set when there's one.
+	ttl    uint32
+	hasTTL bool
+
+	// owner and lastTTL are the owner and TTL of the previous resource record,
+	// which are used when an entry omits them; hasLast is set when there's one.
+	owner   string
+	lastTTL uint32
+	hasLast bool
+
+	rrs []dns.RR
+}
+
+// Parse parses the resource records of a zone file. Relative domain names are
+// relative to the origin, until a $ORIGIN directive changes it; without an
+// origin, domain names must be fully qualified.
+//
+// The $ORIGIN, $TTL and $INCLUDE directives are supported; the path of an
+// included file is relative to the working directory. Resource records of
+// types without a presentation format can be written in the generic format
+// (RFC 3597). Errors are of type *Error, which holds their position.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5
+func Parse(r io.Reader, origin string) ([]dns.RR, error) {
+	p := newParser("", origin)
+	if err := p.parse(r); err != nil {
+		return nil, err
+	}
+
+	return p.rrs, nil
+}
+
+// ParseFile parses the resource records of the zone file at the path (see
+// Parse); the path of an included file is relative to the directory of the
+// file that includes it.
+func ParseFile(path string, origin string) ([]dns.RR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := newParser(path, origin)
+	if err := p.parse(f); err != nil {
+		return nil, err
+	}
+
+	return p.rrs, nil
+}
+
+// newParser creates a parser of the zone file with the origin.
+func newParser(file string, origin string) *parser {
+	p := &parser{file: file}
+	if origin != "" {
+		p.origin = dns.Fqdn(origin)
+	}
+
+	return p
+}
+
+// parse parses the entries of the zone file.
+func (p *parser) parse(r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	l := newLexer(src)
+	for {
+		e, err := l.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var perr *Error
+			if errors.As(err, &perr) {
+				perr.File = p.file
+			}
+			return err
+		}
+		if err := p.parseEntry(e); err != nil {
+			return err
+		}
+	}
+}
+
+// errorAt returns the error at the position in the zone file, unless it's
+// already an *Error (of an included file).
+func (p *parser) errorAt(pos position, err error) error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return err
+	}
+
+	return &Error{File: p.file, Line: pos.line, Column: pos.col, Err: err}
+}
+
+// parseEntry parses a directive or a resource record.
+func (p *parser) parseEntry(e entry) error {
+	tokens := e.tokens
+	if first := tokens[0]; !first.quoted && strings.HasPrefix(first.text, "$") {
+		return p.parseDirective(e)
+	}
+
+	// An entry that starts with a blank has the owner of the previous entry.
+	if !e.blank {
+		owner, err := p.name(tokens[0].text)
+		if err != nil {
+			return p.errorAt(tokens[0].position, err)
+		}
+		p.owner = owner
+		tokens = tokens[1:]
+	}
+	if p.owner == "" {
+		return p.errorAt(e.tokens[0].position, fmt.Errorf("missing owner name"))
+	}
+
+	// The TTL and class are optional, and may appear in either order.
+	ttl, hasTTL := p.lastTTL, false
+	if p.hasTTL {
+		ttl = p.ttl
+	}
+	var t dns.Type
+	var typeTok token
+	for {
+		if len(tokens) == 0 {
+			return p.errorAt(e.end, fmt.Errorf("missing type"))
+		}
+		typeTok, tokens = tokens[0], tokens[1:]
+
+		if isClass(typeTok.text) {
+			if !strings.EqualFold(typeTok.text, dns.ClassIN.String()) && !strings.EqualFold(typeTok.text, "CLASS1") {
+				return p.errorAt(typeTok.position, fmt.Errorf("unsupported class %s", typeTok.text))
+			}
+			continue
+		}
+		if v, err := parseTTL(typeTok.text); err == nil && !hasTTL {
+			ttl, hasTTL = v, true
+			continue
+		}
+		var ok bool
+		if t, ok = parseType(typeTok.text); !ok {
+			return p.errorAt(typeTok.position, fmt.Errorf("unknown class or type %q", typeTok.text))
+		}
+		break
+	}
+	if !hasTTL && !p.hasTTL && !p.hasLast && t != dns.TypeSOA {
+		// Without $TTL, the first resource record must have a TTL (or be the SOA
+		// resource record, whose minimum is used).
+		return p.errorAt(typeTok.position, fmt.Errorf("missing TTL"))
+	}
+
+	f := &fields{p: p, tokens: tokens, end: e.end}
+	rdata, err := f.rdata(t)
+	if err != nil {
+		var perr *Error
+		if errors.As(err, &perr) {
+			perr.Err = fmt.Errorf("invalid %s rdata: %w", t, perr.Err)
+			return perr
+		}
+		return p.errorAt(typeTok.position, fmt.Errorf("invalid %s rdata: %w", t, err))
+	}
+	if t == dns.TypeSOA && !hasTTL && !p.hasTTL {
+		ttl = binary.BigEndian.Uint32(rdata[len(rdata)-4:])
+	}
+	p.lastTTL, p.hasLast = ttl, true
+
+	rr, err := dns.NewRR(p.owner, t, dns.ClassIN, ttl, rdata)
+	if err != nil {
+		return p.errorAt(typeTok.position, fmt.Errorf("invalid %s rdata: %w", t, err))
+	}
+	p.rrs = append(p.rrs, rr)
+
+	return nil
+}
+
+// parseDirective parses a $ORIGIN, $TTL or $INCLUDE directive.
+func (p *parser) parseDirective(e entry) error {
+	dir, args := e.tokens[0], e.tokens[1:]
+
+	switch strings.ToUpper(dir.text) {
+	case "$ORIGIN":
+		if len(args) != 1 {
+			return p.errorAt(dir.position, fmt.Errorf("$ORIGIN expects a domain name"))
+		}
+		name, err := p.name(args[0].text)
+		if err != nil {
+			return p.errorAt(args[0].position, err)
+		}
+		p.origin = name
+		return nil
+
+	case "$TTL":
+		if len(args) != 1 {
+			return p.errorAt(dir.position, fmt.Errorf("$TTL expects a TTL"))
+		}
+		ttl, err := parseTTL(args[0].text)
+		if err != nil {
+			return p.errorAt(args[0].position, err)
+		}
+		p.ttl, p.hasTTL = ttl, true
+		return nil
+
+	case "$INCLUDE":
+		if len(args) != 1 && len(args) != 2 {
+			return p.errorAt(dir.position, fmt.Errorf("$INCLUDE expects a file name and an optional origin"))
+		}
+		return p.include(args)
+	}
+
+	return p.errorAt(dir.position, fmt.Errorf("unsupported directive %s", dir.text))
+}
+
+// include parses the included file. Its origin is the origin of the
+// directive (or the current origin), and the origin of the including file
+// doesn't change.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-5.1
+func (p *parser) include(args []token) error {
+	if p.depth == maxIncludeDepth {
+		return p.errorAt(args[0].position, fmt.Errorf("$INCLUDE nested more than %d times", maxIncludeDepth))
+	}
+
+	path := args[0].text
+	if p.file != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(p.file), path)
+	}
+	origin := p.origin
+	if len(args) == 2 {
+		var err error
+		if origin, err = p.name(args[1].text); err != nil {
+			return p.errorAt(args[1].position, err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return p.errorAt(args[0].position, err)
+	}
+	defer f.Close()
+
+	inc := *p
+	inc.file, inc.depth, inc.origin = path, p.depth+1, origin
+	if err := inc.parse(f); err != nil {
+		return err
+	}
+	p.rrs = inc.rrs
+	p.owner, p.lastTTL, p.hasLast = inc.owner, inc.lastTTL, inc.hasLast
+	p.ttl, p.hasTTL = inc.ttl, inc.hasTTL
+
+	return nil
+}
+
+// name returns the domain name of a field; "@" is the origin, and a name
+// that isn't fully qualified is relative to the origin.
+func (p *parser) name(s string) (string, error) {
+	switch {
+	case s == "@":
+		if p.origin == "" {
+			return "", fmt.Errorf("@ used without an origin")
+		}
+		return p.origin, nil
+	case dns.IsFqdn(s):
+		return s, nil
+	case p.origin == "":
+		return "", fmt.Errorf("relative name %s without an origin", s)
+	case p.origin == ".":
+		return s + ".", nil
+	default:
+		return s + "." + p.origin, nil
+	}
+}
+
+// isClass checks if the field is a class (e.g. "IN", "CH" or "CLASS1").
+func isClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CS", "CH", "HS", "NONE", "ANY":
+		return true
+	}
+	if len(s) > 5 && strings.EqualFold(s[:5], "CLASS") {
+		_, err := strconv.ParseUint(s[5:], 10, 16)
+		return err == nil
+	}
+
+	return false
+}
+
+// parseTTL parses a TTL in seconds, or with units (e.g. "1h30m"): w(eeks),
+// d(ays), h(ours), m(inutes) and s(econds).
+func parseTTL(s string) (uint32, error) {
+	if v, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(v), nil
+	}
+
+	units := map[byte]uint64{'w': 604800, 'd': 86400, 'h': 3600, 'm': 60, 's': 1}
+	var ttl, n uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		switch {
+		case isDigit(s[i]):
+			n = n*10 + uint64(s[i]-'0')
+			digits = true
+		case units[c] != 0 && digits:
+			ttl += n * units[c]
+			n, digits = 0, false
+		default:
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		if n > math.MaxUint32 || ttl > math.MaxUint32 {
+			return 0, fmt.Errorf("TTL %q out of range", s)
+		}
+	}
+	if digits || s == "" {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+
+	return uint32(ttl), nil
+}
+
+// parseType parses a resource record type case-insensitively; a type without
+// a mnemonic is written as "TYPE" followed by its number.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3597#section-5
+func parseType(s string) (dns.Type, bool) {
+	for t, ts := range dns.TypeToString {
+		if strings.EqualFold(ts, s) {
+			return t, true
+		}
+	}
+	if len(s) > 4 && strings.EqualFold(s[:4], "TYPE") {
+		if v, err := strconv.ParseUint(s[4:], 10, 16); err == nil {
+			return dns.Type(v), true
+		}
+	}
+
+	return 0, false
+}
+
+// fields reads the RDATA fields of an entry.
+type fields struct {
+	p      *parser
+	tokens []token
+
+	// end is where the entry ends, which is the position of a missing field.
+	end position
+}
+
+// next returns the next field, which is described by what.
+func (f *fields) next(what string) (token, error) {
+	if len(f.tokens) == 0 {
+		return token{}, f.p.errorAt(f.end, fmt.Errorf("missing %s", what))
+	}
+	tok := f.tokens[0]
+	f.tokens = f.tokens[1:]
+
+	return tok, nil
+}
+
+// uint reads an unsigned integer of the bit size in network order.
+func (f *fields) uint(b []byte, what string, bitSize int) ([]byte, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseUint(tok.text, 10, bitSize)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid %s %q", what, tok.text))
+	}
+
+	return appendUint(b, v, bitSize), nil
+}
+
+// ttl reads a duration, which may have units (see parseTTL).
+func (f *fields) ttl(b []byte, what string) ([]byte, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseTTL(tok.text)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid %s %q", what, tok.text))
+	}
+
+	return appendUint(b, uint64(v), 32), nil
+}
+
+// name reads a domain name in wire format.
+func (f *fields) name(b []byte, what string) ([]byte, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return nil, err
+	}
+	name, err := f.p.name(tok.text)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, err)
+	}
+	nameb, err := dns.PackName(name)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, err)
+	}
+
+	return append(b, nameb...), nil
+}
+
+// charString reads a character string, prefixed with its length.
+func (f *fields) charString(b []byte, what string) ([]byte, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return nil, err
+	}
+	s, err := unescape(tok.text)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, err)
+	}
+	if len(s) > 255 {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("%s exceeds 255 bytes", what))
+	}
+
+	return append(append(b, byte(len(s))), s...), nil
+}
+
+// algorithm reads a DNSSEC security algorithm number or mnemonic.
+func (f *fields) algorithm(b []byte) ([]byte, error) {
+	if len(f.tokens) > 0 {
+		for alg, s := range dns.AlgorithmToString {
+			if strings.EqualFold(s, f.tokens[0].text) {
+				f.tokens = f.tokens[1:]
+				return append(b, byte(alg)), nil
+			}
+		}
+	}
+
+	return f.uint(b, "algorithm", 8)
+}
+
+// rest returns the remaining fields concatenated, which is how base64 and hex
+// encoded data may be split into multiple fields.
+func (f *fields) rest(what string) (token, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return token{}, err
+	}
+	for _, t := range f.tokens {
+		tok.text += t.text
+	}
+	f.tokens = nil
+
+	return tok, nil
+}
+
+// base64 reads the remaining fields as base64 encoded data.
+func (f *fields) base64(b []byte, what string) ([]byte, error) {
+	tok, err := f.rest(what)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(tok.text)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid base64 %s", what))
+	}
+
+	return append(b, data...), nil
+}
+
+// hex reads the remaining fields as hex encoded data.
+func (f *fields) hex(b []byte, what string) ([]byte, error) {
+	tok, err := f.rest(what)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(tok.text)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid hex %s", what))
+	}
+
+	return append(b, data...), nil
+}
+
+// salt reads an NSEC3 salt, prefixed with its length; "-" is an empty salt.
+func (f *fields) salt(b []byte) ([]byte, error) {
+	tok, err := f.next("salt")
+	if err != nil {
+		return nil, err
+	}
+	if tok.text == "-" {
+		return append(b, 0), nil
+	}
+	salt, err := hex.DecodeString(tok.text)
+	if err != nil || len(salt) > 255 {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid salt %q", tok.text))
+	}
+
+	return append(append(b, byte(len(salt))), salt...), nil
+}
+
+// types reads the remaining fields as a type bit map.
+func (f *fields) types() ([]dns.Type, error) {
+	types := []dns.Type{}
+	for _, tok := range f.tokens {
+		t, ok := parseType(tok.text)
+		if !ok {
+			return nil, f.p.errorAt(tok.position, fmt.Errorf("unknown type %q", tok.text))
+		}
+		types = append(types, t)
+	}
+	f.tokens = nil
+
+	return types, nil
+}
+
+// sigTime reads an RRSIG signature time, as YYYYMMDDHHmmSS or in seconds
+// since the epoch.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.2
+func (f *fields) sigTime(b []byte, what string) ([]byte, error) {
+	tok, err := f.next(what)
+	if err != nil {
+		return nil, err
+	}
+	if len(tok.text) == 14 {
+		t, err := time.Parse("20060102150405", tok.text)
+		if err != nil {
+			return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid %s %q", what, tok.text))
+		}
+		return appendUint(b, uint64(uint32(t.Unix())), 32), nil
+	}
+	v, err := strconv.ParseUint(tok.text, 10, 32)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid %s %q", what, tok.text))
+	}
+
+	return appendUint(b, v, 32), nil
+}
+
+// done checks that all fields are read.
+func (f *fields) done(b []byte) ([]byte, error) {
+	if len(f.tokens) > 0 {
+		return nil, f.p.errorAt(f.tokens[0].position, fmt.Errorf("unexpected field %q", f.tokens[0].text))
+	}
+
+	return b, nil
+}
+
+// rdata parses the fields of the RDATA of the type into wire format.
+func (f *fields) rdata(t dns.Type) ([]byte, error) {
+	if len(f.tokens) > 0 && !f.tokens[0].quoted && f.tokens[0].text == `\#` {
+		f.tokens = f.tokens[1:]
+		return f.generic()
+	}
+
+	var b []byte
+	var err error
+	switch t {
+	case dns.TypeA, dns.TypeAAAA:
+		tok, err := f.next("address")
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(tok.text)
+		if t == dns.TypeA {
+			ip = ip.To4()
+		} else if ip.To4() != nil {
+			ip = nil
+		}
+		if ip == nil {
+			return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid address %q", tok.text))
+		}
+		return f.done(ip)
+
+	case dns.TypeNS, dns.TypeCNAME, dns.TypePTR:
+		if b, err = f.name(b, "domain name"); err != nil {
+			return nil, err
+		}
+		return f.done(b)
+
+	case dns.TypeMX:
+		if b, err = f.uint(b, "preference", 16); err != nil {
+			return nil, err
+		}
+		if b, err = f.name(b, "exchange"); err != nil {
+			return nil, err
+		}
+		return f.done(b)
+
+	case dns.TypeSRV:
+		for _, what := range []string{"priority", "weight", "port"} {
+			if b, err = f.uint(b, what, 16); err != nil {
+				return nil, err
+			}
+		}
+		if b, err = f.name(b, "target"); err != nil {
+			return nil, err
+		}
+		return f.done(b)
+
+	case dns.TypeSOA:
+		for _, what := range []string{"mname", "rname"} {
+			if b, err = f.name(b, what); err != nil {
+				return nil, err
+			}
+		}
+		if b, err = f.uint(b, "serial", 32); err != nil {
+			return nil, err
+		}
+		// The refresh, retry, expire and minimum fields are durations, which
+		// may have units.
+		for _, what := range []string{"refresh", "retry", "expire", "minimum"} {
+			if b, err = f.ttl(b, what); err != nil {
+				return nil, err
+			}
+		}
+		return f.done(b)
+
+	case dns.TypeTXT:
+		if b, err = f.charString(b, "string"); err != nil {
+			return nil, err
+		}
+		for len(f.tokens) > 0 {
+			if b, err = f.charString(b, "string"); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	case dns.TypeHINFO:
+		for _, what := range []string{"cpu", "os"} {
+			if b, err = f.charString(b, what); err != nil {
+				return nil, err
+			}
+		}
+		return f.done(b)
+
+	case dns.TypeCAA:
+		if b, err = f.uint(b, "flags", 8); err != nil {
+			return nil, err
+		}
+		tag, err := f.next("tag")
+		if err != nil {
+			return nil, err
+		}
+		if len(tag.text) == 0 || len(tag.text) > 255 {
+			return nil, f.p.errorAt(tag.position, fmt.Errorf("invalid tag %q", tag.text))
+		}
+		b = append(append(b, byte(len(tag.text))), tag.text...)
+		value, err := f.next("value")
+		if err != nil {
+			return nil, err
+		}
+		v, err := unescape(value.text)
+		if err != nil {
+			return nil, f.p.errorAt(value.position, err)
+		}
+		return f.done(append(b, v...))
+
+	case dns.TypeDS:
+		if b, err = f.uint(b, "key tag", 16); err != nil {
+			return nil, err
+		}
+		if b, err = f.algorithm(b); err != nil {
+			return nil, err
+		}
+		if b, err = f.uint(b, "digest type", 8); err != nil {
+			return nil, err
+		}
+		return f.hex(b, "digest")
+
+	case dns.TypeZONEMD:
+		if b, err = f.uint(b, "serial", 32); err != nil {
+			return nil, err
+		}
+		if b, err = f.uint(b, "scheme", 8); err != nil {
+			return nil, err
+		}
+		if b, err = f.uint(b, "hash algorithm", 8); err != nil {
+			return nil, err
+		}
+		return f.hex(b, "digest")
+
+	case dns.TypeDNSKEY, dns.TypeKEY:
+		if b, err = f.uint(b, "flags", 16); err != nil {
+			return nil, err
+		}
+		if b, err = f.uint(b, "protocol", 8); err != nil {
+			return nil, err
+		}
+		if b, err = f.algorithm(b); err != nil {
+			return nil, err
+		}
+		return f.base64(b, "public key")
+
+	case dns.TypeRRSIG:
+		tok, err := f.next("type covered")
+		if err != nil {
+			return nil, err
+		}
+		covered, ok := parseType(tok.text)
+		if !ok {
+			return nil, f.p.errorAt(tok.position, fmt.Errorf("unknown type %q", tok.text))
+		}
+		b = appendUint(b, uint64(covered), 16)
+		if b, err = f.algorithm(b); err != nil {
+			return nil, err
+		}
+		if b, err = f.uint(b, "labels", 8); err != nil {
+			return nil, err
+		}
+		if b, err = f.ttl(b, "original TTL"); err != nil {
+			return nil, err
+		}
+		for _, what := range []string{"expiration", "inception"} {
+			if b, err = f.sigTime(b, what); err != nil {
+				return nil, err
+			}
+		}
+		if b, err = f.uint(b, "key tag", 16); err != nil {
+			return nil, err
+		}
+		if b, err = f.name(b, "signer's name"); err != nil {
+			return nil, err
+		}
+		return f.base64(b, "signature")
+
+	case dns.TypeNSEC:
+		if b, err = f.name(b, "next domain name"); err != nil {
+			return nil, err
+		}
+		types, err := f.types()
+		if err != nil {
+			return nil, err
+		}
+		nsec := dns.NSEC{NextDomain: ".", TypeBitMap: types}
+		bitmap, err := nsec.Pack()
+		if err != nil {
+			return nil, err
+		}
+		// The packed root name of the empty next domain name precedes the type
+		// bit map.
+		return append(b, bitmap[1:]...), nil
+
+	case dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+		for _, what := range []string{"hash algorithm", "flags"} {
+			if b, err = f.uint(b, what, 8); err != nil {
+				return nil, err
+			}
+		}
+		if b, err = f.uint(b, "iterations", 16); err != nil {
+			return nil, err
+		}
+		if b, err = f.salt(b); err != nil {
+			return nil, err
+		}
+		if t == dns.TypeNSEC3PARAM {
+			return f.done(b)
+		}
+
+		tok, err := f.next("next hashed owner name")
+		if err != nil {
+			return nil, err
+		}
+		next, err := base32Hex.DecodeString(strings.ToUpper(tok.text))
+		if err != nil || len(next) == 0 || len(next) > 255 {
+			return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid next hashed owner name %q", tok.text))
+		}
+		b = append(append(b, byte(len(next))), next...)
+		types, err := f.types()
+		if err != nil {
+			return nil, err
+		}
+		nsec := dns.NSEC{NextDomain: ".", TypeBitMap: types}
+		bitmap, err := nsec.Pack()
+		if err != nil {
+			return nil, err
+		}
+		return append(b, bitmap[1:]...), nil
+	}
+
+	return nil, fmt.Errorf("unsupported type; use the generic format (\\# length hex)")
+}
+
+// generic parses RDATA in the generic format: its length, followed by the hex
+// encoded bytes (which may be split into multiple fields).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3597#section-5
+func (f *fields) generic() ([]byte, error) {
+	tok, err := f.next("length")
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseUint(tok.text, 10, 16)
+	if err != nil {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("invalid length %q", tok.text))
+	}
+	if size == 0 {
+		return f.done([]byte{})
+	}
+
+	b, err := f.hex(nil, "data")
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != int(size) {
+		return nil, f.p.errorAt(tok.position, fmt.Errorf("length %d doesn't match %d data bytes", size, len(b)))
+	}
+
+	return b, nil
+}
+
+// appendUint appends the unsigned integer of the bit size in network order.
+func appendUint(b []byte, v uint64, bitSize int) []byte {
+	for shift := bitSize - 8; shift >= 0; shift -= 8 {
+		b = append(b, byte(v>>shift))
+	}
+
+	return b
+}
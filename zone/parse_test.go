@@ -0,0 +1,306 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func TestParse(t *testing.T) {
+	in := `$TTL 1h
+$ORIGIN example.org.
+@	IN	SOA	ns1 hostmaster 2024010101 2h 1h 2w 5m ; the apex
+	IN	NS	ns1
+	300	IN	MX	10 mail.example.org.
+ns1	A	192.0.2.53
+mail	IN 600	AAAA	2001:db8::25
+txt	TXT	"v=spf1 -all" "second string"
+_sip._tcp	SRV	10 60 5060 sip
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name  string
+		t     dns.Type
+		ttl   uint32
+		rdata string
+	}{
+		{"example.org.", dns.TypeSOA, 3600, "ns1.example.org. hostmaster.example.org. 2024010101 7200 3600 1209600 300"},
+		{"example.org.", dns.TypeNS, 3600, "ns1.example.org."},
+		{"example.org.", dns.TypeMX, 300, "10 mail.example.org."},
+		{"ns1.example.org.", dns.TypeA, 3600, "192.0.2.53"},
+		{"mail.example.org.", dns.TypeAAAA, 600, "2001:db8::25"},
+		{"txt.example.org.", dns.TypeTXT, 3600, `"v=spf1 -all" "second string"`},
+		{"_sip._tcp.example.org.", dns.TypeSRV, 3600, "10 60 5060 sip.example.org."},
+	}
+	if len(rrs) != len(want) {
+		t.Fatalf("records error: got %d - want %d", len(rrs), len(want))
+	}
+	for i, w := range want {
+		rr := rrs[i]
+		if rr.Name != w.name || rr.Type != w.t || rr.TTL != w.ttl || rr.RDataUnpacked != w.rdata {
+			t.Errorf(
+				"record %d error: got %s %d %s %q - want %s %d %s %q",
+				i, rr.Name, rr.TTL, rr.Type, rr.RDataUnpacked, w.name, w.ttl, w.t, w.rdata,
+			)
+		}
+	}
+}
+
+func TestParseEscaped(t *testing.T) {
+	in := `$ORIGIN example.org.
+a\ b	60	TXT	"say \"hi\"\009" semi\;colon
+a\.b	60	CNAME	c\\.
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name  string
+		rdata string
+	}{
+		{`a\032b.example.org.`, `"say \"hi\"\009" "semi;colon"`},
+		{`a\.b.example.org.`, `c\\.`},
+	}
+	if len(rrs) != len(want) {
+		t.Fatalf("records error: got %d - want %d", len(rrs), len(want))
+	}
+	for i, w := range want {
+		if rrs[i].Name != w.name || rrs[i].RDataUnpacked != w.rdata {
+			t.Errorf(
+				"record %d error: got %s %s - want %s %s",
+				i, rrs[i].Name, rrs[i].RDataUnpacked, w.name, w.rdata,
+			)
+		}
+	}
+
+	// The presentation format parses to the same records.
+	out := ""
+	for _, rr := range rrs {
+		out += fmt.Sprintf("%s %d %s %s\n", rr.Name, rr.TTL, rr.Type, rr.RDataUnpacked)
+	}
+	again, err := Parse(strings.NewReader(out), "")
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", out, err)
+	}
+	for i := range again {
+		if again[i].Name != rrs[i].Name || string(again[i].RData) != string(rrs[i].RData) {
+			t.Errorf("round trip record %d error: got %s - want %s", i, again[i].Name, rrs[i].Name)
+		}
+	}
+}
+
+func TestParseSOADefaultTTL(t *testing.T) {
+	in := "example.org. SOA ns1.example.org. hostmaster.example.org. 1 2 3 4 900\n" +
+		"www.example.org. A 192.0.2.1\n"
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range rrs {
+		if rr.TTL != 900 {
+			t.Errorf("%s ttl error: got %d - want 900", rr.Type, rr.TTL)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing ttl":       "www.example.org. A 192.0.2.1\n",
+		"relative name":     "$TTL 60\nwww A 192.0.2.1\n",
+		"unknown type":      "$TTL 60\nwww.example.org. BOGUS x\n",
+		"invalid address":   "$TTL 60\nwww.example.org. A 2001:db8::1\n",
+		"unterminated":      "$TTL 60\nwww.example.org. TXT \"open\n",
+		"unsupported":       "$GENERATE 1-10 host$ A 192.0.2.$\n",
+		"invalid ttl":       "$TTL 1x\n",
+		"long label":        "$TTL 60\n" + strings.Repeat("a", 64) + ".example.org. A 192.0.2.1\n",
+		"rdata field count": "$TTL 60\nexample.org. MX mail.example.org.\n",
+	}
+	for name, in := range tests {
+		if _, err := Parse(strings.NewReader(in), ""); err == nil {
+			t.Errorf("%s error: got nil - want error", name)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := map[string]uint32{
+		"0":     0,
+		"3600":  3600,
+		"1h30m": 5400,
+		"1W":    604800,
+		"1d2s":  86402,
+	}
+	for in, want := range tests {
+		got, err := parseTTL(in)
+		if err != nil {
+			t.Errorf("parse ttl %q error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("parse ttl %q error: got %d - want %d", in, got, want)
+		}
+	}
+	for _, in := range []string{"", "h", "1h2", "4294967296", "1x"} {
+		if _, err := parseTTL(in); err == nil {
+			t.Errorf("parse ttl %q error: got nil - want error", in)
+		}
+	}
+}
+
+func TestParseMultiline(t *testing.T) {
+	in := `$ORIGIN example.org.
+@	3600	IN	SOA	ns1 hostmaster (
+			2024010101 ; serial
+			2h         ; refresh
+			1h         ; retry
+			2w         ; expire
+			5m )       ; minimum
+www	( 300 IN
+	A 192.0.2.1 )
+	TXT	"a ; not a comment" "escaped \"quote\"" "\065\066"
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"example.org.\t3600\tIN\tSOA\tns1.example.org. hostmaster.example.org. 2024010101 7200 3600 1209600 300",
+		"www.example.org.\t300\tIN\tA\t192.0.2.1",
+		"www.example.org.\t300\tIN\tTXT\t\"a ; not a comment\" \"escaped \\\"quote\\\"\" \"AB\"",
+	}
+	if len(rrs) != len(want) {
+		t.Fatalf("records error: got %d - want %d", len(rrs), len(want))
+	}
+	for i, w := range want {
+		if got := rrs[i].String(); got != w {
+			t.Errorf("record %d error: got %q - want %q", i, got, w)
+		}
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	in := `$ORIGIN example.org.
+$TTL 300
+@	HINFO	"amd64" "linux"
+@	DNSKEY	257 3 13 (
+		mdsswUyr3DPW132mOi8V9xESWE8jTo0d
+		xCjjnopKl+GqJxpVXckHAeF+KkxLbxIL
+		fDLUT0rAK9iUzy1L53eKGQ== )
+@	DS	12345 ECDSAP256SHA256 2 ( 49FD46E6C4B45C55D4AC69CBD3CD3440
+		9B0D2D19F3E2E41FDA8C1E3A4DF8A0F5 )
+@	RRSIG	A 13 2 300 20250101000000 1700000000 12345 example.org. dGVzdA==
+@	NSEC	www.example.org. A NS SOA RRSIG NSEC DNSKEY TYPE65534
+@	NSEC3PARAM	1 0 0 -
+@	NSEC3	1 1 10 AABBCCDD 2vptu5timamqttgl4luu9kg21e0aor3s A RRSIG
+@	CAA	0 issue "letsencrypt.org"
+@	TYPE65280	\# 4 0A000001
+@	A	\# 4 C0000201
+@	TYPE65281	\# 0
+`
+	rrs, err := Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`"amd64" "linux"`,
+		"257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==",
+		"12345 13 2 49FD46E6C4B45C55D4AC69CBD3CD34409B0D2D19F3E2E41FDA8C1E3A4DF8A0F5",
+		"A 13 2 300 20250101000000 20231114221320 12345 example.org. dGVzdA==",
+		"www.example.org. A NS SOA RRSIG NSEC DNSKEY TYPE65534",
+		"1 0 0 -",
+		"1 1 10 AABBCCDD 2VPTU5TIMAMQTTGL4LUU9KG21E0AOR3S A RRSIG",
+		`0 issue "letsencrypt.org"`,
+		`\# 4 0A000001`,
+		"192.0.2.1",
+		`\# 0`,
+	}
+	if len(rrs) != len(want) {
+		t.Fatalf("records error: got %d - want %d", len(rrs), len(want))
+	}
+	for i, w := range want {
+		if got := rrs[i].RDataUnpacked; got != w {
+			t.Errorf("%s rdata error: got %q - want %q", rrs[i].Type, got, w)
+		}
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.zone": `$ORIGIN example.org.
+$TTL 300
+@	SOA	ns1 hostmaster 1 2 3 4 5
+$INCLUDE hosts.zone sub.example.org.
+www	A	192.0.2.1
+`,
+		"hosts.zone": "api\tA\t192.0.2.2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rrs, err := ParseFile(filepath.Join(dir, "main.zone"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, rr := range rrs {
+		got = append(got, rr.Name)
+	}
+	want := "example.org. api.sub.example.org. www.example.org."
+	if strings.Join(got, " ") != want {
+		t.Errorf("names error: got %q - want %q", strings.Join(got, " "), want)
+	}
+
+	// An include loop is stopped.
+	loop := filepath.Join(dir, "loop.zone")
+	if err := os.WriteFile(loop, []byte("$INCLUDE loop.zone\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(loop, "example.org."); err == nil {
+		t.Errorf("include loop error: got nil - want error")
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		line   int
+		column int
+	}{
+		{"invalid address", "$TTL 60\nwww.example.org.  A  192.0.2.300\n", 2, 22},
+		{"missing field", "$TTL 60\nexample.org. MX 10\n", 2, 19},
+		{"extra field", "$TTL 60\nexample.org. CNAME a.example. b.example.\n", 2, 31},
+		{"unbalanced", "$TTL 60\nexample.org. SOA ( a. b. 1 2 3 4 5\n", 2, 18},
+		{"unexpected close", "$TTL 60\nexample.org. A 192.0.2.1 )\n", 2, 26},
+		{"multiline field", "$TTL 60\nexample.org. SOA a. b. (\n 1 2 3 x 5 )\n", 3, 8},
+		{"generic length", "$TTL 60\nexample.org. TYPE999 \\# 3 0A00\n", 2, 25},
+	}
+	for _, tc := range tests {
+		_, err := Parse(strings.NewReader(tc.in), "")
+		var perr *Error
+		if !errors.As(err, &perr) {
+			t.Errorf("%s error: got %v - want *Error", tc.name, err)
+			continue
+		}
+		if perr.Line != tc.line || perr.Column != tc.column {
+			t.Errorf("%s position error: got %d:%d (%v) - want %d:%d", tc.name, perr.Line, perr.Column, err, tc.line, tc.column)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package zone
+
+import (
+	"crypto"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// SigningKey is a DNSSEC key pair that signs a zone. A key signing key (with
+// the SEP flag) signs the DNSKEY resource record set, and a zone signing key
+// signs all other resource record sets.
+type SigningKey struct {
+	Key  *dns.DNSKEY
+	Priv crypto.Signer
+}
+
+// SignOptions holds the options to sign a zone with.
+type SignOptions struct {
+	// Inception and Expiration are the start and end of the validity period
+	// of the signatures.
+	Inception  time.Time
+	Expiration time.Time
+
+	// NSEC3 holds the parameters of the NSEC3 chain that proves the
+	// non-existence of names; an NSEC chain is generated when it's nil. When
+	// its opt-out flag is set, the chain skips insecure delegations.
+	//
+	// See: https://datatracker.ietf.org/doc/html/rfc5155#section-7.1
+	NSEC3 *dns.NSEC3PARAM
+}
+
+// nsec3Hash decodes the hashed owner name labels of NSEC3 records.
+var nsec3Hash = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Sign signs the zone with the keys, and returns its resource records with the
+// DNSKEY resource records of the keys, an NSEC (or NSEC3) chain, and RRSIG
+// resource records, in canonical order. DNSSEC resource records that are in
+// the zone already (except DNSKEY resource records) are replaced. When none of
+// the keys is a key signing key, or none is a zone signing key, the keys sign
+// all resource record sets.
+//
+// Resource record sets are signed where the zone is authoritative for them:
+// at a delegation, only the DS and NSEC resource record sets are signed, and
+// glue isn't signed. The digests of the ZONEMD resource records at the apex
+// are recomputed for the signed zone.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-2
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-3
+func (z *Zone) Sign(keys []SigningKey, opts SignOptions) ([]dns.RR, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys to sign zone %s with", z.Origin)
+	}
+	if !opts.Expiration.After(opts.Inception) {
+		return nil, fmt.Errorf("signature expiration must be after its inception")
+	}
+	ksks, zsks := []SigningKey{}, []SigningKey{}
+	for _, k := range keys {
+		if k.Key.Flags&dns.DNSKEYFlagZone == 0 {
+			return nil, fmt.Errorf("key %d isn't a zone key", k.Key.KeyTag())
+		}
+		if k.Key.Flags&dns.DNSKEYFlagSEP != 0 {
+			ksks = append(ksks, k)
+		} else {
+			zsks = append(zsks, k)
+		}
+	}
+	if len(ksks) == 0 {
+		ksks = zsks
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+
+	s := &signer{z: z, rrsets: map[string]map[dns.Type][]dns.RR{}}
+	for _, rr := range z.rrs {
+		switch rr.Type {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			continue
+		}
+		s.add(rr)
+	}
+	if err := s.addKeys(keys); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if opts.NSEC3 == nil {
+		err = s.addNSEC()
+	} else {
+		err = s.addNSEC3(opts.NSEC3)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rrs := []dns.RR{}
+	for name, rrsets := range s.rrsets {
+		for t, rrset := range rrsets {
+			// The ZONEMD resource records at the apex digest the signed zone,
+			// so they're added last.
+			if name == s.z.Origin && t == dns.TypeZONEMD {
+				continue
+			}
+			rrs = append(rrs, rrset...)
+			if !s.signed(name, t) {
+				continue
+			}
+			signers := zsks
+			if t == dns.TypeDNSKEY {
+				signers = ksks
+			}
+			for _, k := range signers {
+				sig, err := s.sign(name, rrset, k, opts)
+				if err != nil {
+					return nil, fmt.Errorf("failed to sign %s %s: %v", name, t, err)
+				}
+				rrs = append(rrs, sig)
+			}
+		}
+	}
+	if zonemds := s.rrsets[s.z.Origin][dns.TypeZONEMD]; len(zonemds) > 0 {
+		rrset, err := s.digest(zonemds, rrs)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rrset...)
+		for _, k := range zsks {
+			sig, err := s.sign(s.z.Origin, rrset, k, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign %s %s: %v", s.z.Origin, dns.TypeZONEMD, err)
+			}
+			rrs = append(rrs, sig)
+		}
+	}
+	dns.SortCanonical(rrs)
+
+	return rrs, nil
+}
+
+// signer holds the resource record sets of a zone that's signed, per (lower
+// case) owner name and type.
+type signer struct {
+	z      *Zone
+	rrsets map[string]map[dns.Type][]dns.RR
+}
+
+// add adds the resource record to the resource record sets.
+func (s *signer) add(rr dns.RR) {
+	name := strings.ToLower(dns.Fqdn(rr.Name))
+	if s.rrsets[name] == nil {
+		s.rrsets[name] = map[dns.Type][]dns.RR{}
+	}
+	s.rrsets[name][rr.Type] = append(s.rrsets[name][rr.Type], rr)
+}
+
+// addKeys adds the DNSKEY resource records of the keys to the apex, unless
+// they're in the zone already. They get the TTL of the DNSKEY resource
+// records in the zone, or of the SOA resource record.
+func (s *signer) addKeys(keys []SigningKey) error {
+	ttl := s.z.soa.TTL
+	existing := map[string]bool{}
+	for _, rr := range s.rrsets[s.z.Origin][dns.TypeDNSKEY] {
+		ttl = rr.TTL
+		existing[string(rr.RData)] = true
+	}
+
+	for _, k := range keys {
+		rdata, err := k.Key.Pack()
+		if err != nil {
+			return err
+		}
+		if existing[string(rdata)] {
+			continue
+		}
+		existing[string(rdata)] = true
+		rr, err := dns.NewRR(s.z.Origin, dns.TypeDNSKEY, dns.ClassIN, ttl, rdata)
+		if err != nil {
+			return err
+		}
+		s.add(rr)
+	}
+
+	return nil
+}
+
+// occluded checks if the name is below a delegation, where the zone isn't
+// authoritative (e.g. glue).
+func (s *signer) occluded(name string) bool {
+	_, ok := s.z.findCut(name, dns.TypeDS)
+	return ok
+}
+
+// delegation checks if the name is a delegation (i.e. has NS resource records
+// below the apex).
+func (s *signer) delegation(name string) bool {
+	_, ok := s.rrsets[name][dns.TypeNS]
+	return ok && name != s.z.Origin
+}
+
+// signed checks if the resource record set of the name and type is signed.
+func (s *signer) signed(name string, t dns.Type) bool {
+	if s.occluded(name) {
+		return false
+	}
+	if s.delegation(name) {
+		return t == dns.TypeDS || t == dns.TypeNSEC
+	}
+
+	return true
+}
+
+// names returns the owner names the zone is authoritative for, in canonical
+// order.
+func (s *signer) names() []string {
+	names := []string{}
+	for name := range s.rrsets {
+		if !s.occluded(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return dns.CompareDomainName(names[i], names[j]) < 0
+	})
+
+	return names
+}
+
+// types returns the types of the resource record sets of the name.
+func (s *signer) types(name string) []dns.Type {
+	types := []dns.Type{}
+	for t := range s.rrsets[name] {
+		types = append(types, t)
+	}
+
+	return types
+}
+
+// addNSEC adds the NSEC chain: every name links to the next one in canonical
+// order (and the last one to the apex), and lists the types of its resource
+// record sets. NSEC resource records have the TTL of negative answers.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4035#section-2.3
+// See: https://datatracker.ietf.org/doc/html/rfc9077#section-3
+func (s *signer) addNSEC() error {
+	ttl := s.z.negativeSOA().TTL
+	names := s.names()
+	for i, name := range names {
+		nsec := &dns.NSEC{
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: append(s.types(name), dns.TypeNSEC, dns.TypeRRSIG),
+		}
+		rdata, err := nsec.Pack()
+		if err != nil {
+			return err
+		}
+		rr, err := dns.NewRR(name, dns.TypeNSEC, dns.ClassIN, ttl, rdata)
+		if err != nil {
+			return err
+		}
+		s.add(rr)
+	}
+
+	return nil
+}
+
+// addNSEC3 adds the NSEC3PARAM resource record to the apex, and the NSEC3
+// chain: the hash of every name (including empty non-terminals) links to the
+// next one in hash order, and lists the types of its resource record sets.
+// NSEC3 resource records have the TTL of negative answers.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5155#section-7.1
+func (s *signer) addNSEC3(params *dns.NSEC3PARAM) error {
+	if params.HashAlgorithm != dns.NSEC3HashSHA1 {
+		return fmt.Errorf("unsupported NSEC3 hash algorithm %d", params.HashAlgorithm)
+	}
+	optOut := params.Flags&dns.NSEC3FlagOptOut != 0
+
+	param := *params
+	param.Flags = 0
+	rdata, err := param.Pack()
+	if err != nil {
+		return err
+	}
+	rr, err := dns.NewRR(s.z.Origin, dns.TypeNSEC3PARAM, dns.ClassIN, 0, rdata)
+	if err != nil {
+		return err
+	}
+	s.add(rr)
+
+	// types holds the types of every name in the chain; empty non-terminals
+	// have none.
+	types := map[string][]dns.Type{}
+	for _, name := range s.names() {
+		_, hasDS := s.rrsets[name][dns.TypeDS]
+		if s.delegation(name) && !hasDS {
+			if optOut {
+				continue
+			}
+			types[name] = s.types(name)
+		} else {
+			types[name] = append(s.types(name), dns.TypeRRSIG)
+		}
+		for n := dns.ParentDomainName(name); n != s.z.Origin && dns.IsSubDomain(s.z.Origin, n); n = dns.ParentDomainName(n) {
+			if _, ok := types[n]; !ok {
+				types[n] = []dns.Type{}
+			}
+		}
+	}
+
+	hashes := []string{}
+	hashed := map[string]string{}
+	for name := range types {
+		h := dns.HashName(name, params.HashAlgorithm, params.Iterations, params.Salt)
+		if _, ok := hashed[h]; ok {
+			return fmt.Errorf("NSEC3 hash collision of %s and %s", name, hashed[h])
+		}
+		hashes = append(hashes, h)
+		hashed[h] = name
+	}
+	sort.Strings(hashes)
+
+	ttl := s.z.negativeSOA().TTL
+	for i, h := range hashes {
+		next, err := nsec3Hash.DecodeString(strings.ToUpper(hashes[(i+1)%len(hashes)]))
+		if err != nil {
+			return err
+		}
+		nsec3 := &dns.NSEC3{
+			HashAlgorithm: params.HashAlgorithm,
+			Flags:         params.Flags & dns.NSEC3FlagOptOut,
+			Iterations:    params.Iterations,
+			Salt:          params.Salt,
+			NextHashed:    next,
+			TypeBitMap:    types[hashed[h]],
+		}
+		rdata, err := nsec3.Pack()
+		if err != nil {
+			return err
+		}
+		rr, err := dns.NewRR(h+"."+s.z.Origin, dns.TypeNSEC3, dns.ClassIN, ttl, rdata)
+		if err != nil {
+			return err
+		}
+		s.add(rr)
+	}
+
+	return nil
+}
+
+// digest returns the ZONEMD resource records of the apex with the serial of
+// the zone and the digests of the resource records of the signed zone.
+// ZONEMD resource records of unsupported schemes or hash algorithms are
+// dropped, since their digests can't be recomputed.
+func (s *signer) digest(zonemds []dns.RR, rrs []dns.RR) ([]dns.RR, error) {
+	rd, err := s.z.soa.Decode()
+	if err != nil {
+		return nil, err
+	}
+	serial := rd.(*dns.SOA).Serial
+
+	rrset := []dns.RR{}
+	for _, rr := range zonemds {
+		rd, err := rr.Decode()
+		if err != nil {
+			return nil, err
+		}
+		zonemd := rd.(*dns.ZONEMD)
+		if zonemd.Scheme != dns.ZONEMDSchemeSimple {
+			continue
+		}
+		digest, err := dns.ZoneDigest(s.z.Origin, rrs, zonemd.HashAlgorithm)
+		if err != nil {
+			continue
+		}
+		zonemd.Serial = serial
+		zonemd.Digest = digest
+		rdata, err := zonemd.Pack()
+		if err != nil {
+			return nil, err
+		}
+		rr, err := dns.NewRR(s.z.Origin, dns.TypeZONEMD, dns.ClassIN, rr.TTL, rdata)
+		if err != nil {
+			return nil, err
+		}
+		rrset = append(rrset, rr)
+	}
+	if len(rrset) == 0 {
+		return nil, fmt.Errorf("no ZONEMD records with a supported scheme and hash algorithm")
+	}
+
+	return rrset, nil
+}
+
+// sign signs the resource record set of the name with the key, and returns
+// the RRSIG resource record. The labels field doesn't count the wildcard label
+// of a wildcard owner name.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4034#section-3.1.3
+func (s *signer) sign(name string, rrset []dns.RR, k SigningKey, opts SignOptions) (dns.RR, error) {
+	labels := dns.CountLabels(name)
+	if strings.HasPrefix(name, "*.") {
+		labels--
+	}
+	sig := &dns.RRSIG{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   k.Key.Algorithm,
+		Labels:      uint8(labels),
+		OrigTTL:     rrset[0].TTL,
+		Expiration:  uint32(opts.Expiration.Unix()),
+		Inception:   uint32(opts.Inception.Unix()),
+		KeyTag:      k.Key.KeyTag(),
+		SignerName:  s.z.Origin,
+	}
+	if err := sig.Sign(k.Priv, rrset); err != nil {
+		return dns.RR{}, err
+	}
+	rdata, err := sig.Pack()
+	if err != nil {
+		return dns.RR{}, err
+	}
+
+	return dns.NewRR(name, dns.TypeRRSIG, dns.ClassIN, sig.OrigTTL, rdata)
+}
@@ -0,0 +1,212 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+func signTestZone(t *testing.T, nsec3 *dns.NSEC3PARAM) ([]dns.RR, []SigningKey) {
+	t.Helper()
+
+	keys := []SigningKey{}
+	for _, flags := range []uint16{dns.DNSKEYFlagZone | dns.DNSKEYFlagSEP, dns.DNSKEYFlagZone} {
+		priv, key, err := dns.GenerateKey(dns.AlgorithmECDSAP256SHA256, flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, SigningKey{Key: key, Priv: priv})
+	}
+
+	now := time.Now()
+	rrs, err := newTestZone(t).Sign(keys, SignOptions{
+		Inception:  now.Add(-time.Hour),
+		Expiration: now.Add(time.Hour),
+		NSEC3:      nsec3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rrs, keys
+}
+
+// rrsetsOf groups the resource records by (lower case) owner name and type.
+func rrsetsOf(rrs []dns.RR) map[string]map[dns.Type][]dns.RR {
+	rrsets := map[string]map[dns.Type][]dns.RR{}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Name)
+		if rrsets[name] == nil {
+			rrsets[name] = map[dns.Type][]dns.RR{}
+		}
+		rrsets[name][rr.Type] = append(rrsets[name][rr.Type], rr)
+	}
+
+	return rrsets
+}
+
+func TestSign(t *testing.T) {
+	rrs, keys := signTestZone(t, nil)
+	rrsets := rrsetsOf(rrs)
+
+	// Every signature is made by the KSK (for DNSKEY) or ZSK, and verifies.
+	signed := map[string]bool{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypeRRSIG {
+			continue
+		}
+		rd, err := rr.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := rd.(*dns.RRSIG)
+		key := keys[1].Key
+		if sig.TypeCovered == dns.TypeDNSKEY {
+			key = keys[0].Key
+		}
+		name := strings.ToLower(rr.Name)
+		if err := sig.Verify(key, rrsets[name][sig.TypeCovered]); err != nil {
+			t.Errorf("verify %s %s error: %v", rr.Name, sig.TypeCovered, err)
+		}
+		signed[name+" "+sig.TypeCovered.String()] = true
+	}
+
+	for _, want := range []string{
+		"example.org. SOA", "example.org. DNSKEY", "example.org. NSEC",
+		"www.example.org. CNAME", "*.wild.example.org. A", "sub.example.org. NSEC",
+	} {
+		if !signed[want] {
+			t.Errorf("%s isn't signed", want)
+		}
+	}
+	for _, unsigned := range []string{"sub.example.org. NS", "ns.sub.example.org. A"} {
+		if signed[unsigned] {
+			t.Errorf("%s is signed", unsigned)
+		}
+	}
+
+	// The NSEC chain links the 9 authoritative names, and wraps to the apex.
+	next := "example.org."
+	for i := 0; i < 9; i++ {
+		nsecs := rrsets[next][dns.TypeNSEC]
+		if len(nsecs) != 1 {
+			t.Fatalf("nsec records of %s error: got %d - want 1", next, len(nsecs))
+		}
+		rd, err := nsecs[0].Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		next = rd.(*dns.NSEC).NextDomain
+	}
+	if next != "example.org." {
+		t.Errorf("nsec chain error: got %s after 9 names - want example.org.", next)
+	}
+	if _, ok := rrsets["ns.sub.example.org."][dns.TypeNSEC]; ok {
+		t.Errorf("glue has an nsec record")
+	}
+}
+
+func TestSignNSEC3(t *testing.T) {
+	params := &dns.NSEC3PARAM{HashAlgorithm: dns.NSEC3HashSHA1, Iterations: 0, Salt: []byte{0xab}}
+	rrs, _ := signTestZone(t, params)
+
+	nsec3s := map[string]*dns.NSEC3{}
+	for _, rr := range rrs {
+		switch rr.Type {
+		case dns.TypeNSEC:
+			t.Errorf("nsec3 signed zone has an nsec record at %s", rr.Name)
+		case dns.TypeNSEC3:
+			rd, err := rr.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nsec3s[rr.Name] = rd.(*dns.NSEC3)
+		}
+	}
+
+	// Every name, including the empty non-terminals b.c and c, has a matching
+	// NSEC3 record; a name that doesn't exist is covered by one.
+	for _, name := range []string{
+		"example.org.", "www.example.org.", "a.b.c.example.org.", "b.c.example.org.",
+		"c.example.org.", "*.wild.example.org.", "sub.example.org.",
+	} {
+		matched := false
+		for owner, n := range nsec3s {
+			if n.Match(owner, name) {
+				matched = true
+				if name == "example.org." && !n.HasType(dns.TypeNSEC3PARAM) {
+					t.Errorf("apex nsec3 record lacks the NSEC3PARAM type")
+				}
+			}
+		}
+		if !matched {
+			t.Errorf("no nsec3 record matches %s", name)
+		}
+	}
+	covered := false
+	for owner, n := range nsec3s {
+		if n.Covers(owner, "nonexistent.example.org.") {
+			covered = true
+		}
+	}
+	if !covered {
+		t.Errorf("no nsec3 record covers nonexistent.example.org.")
+	}
+}
+
+func TestSignZONEMD(t *testing.T) {
+	z := newTestZone(t)
+	placeholder, err := (&dns.ZONEMD{
+		Serial:        0,
+		Scheme:        dns.ZONEMDSchemeSimple,
+		HashAlgorithm: dns.ZONEMDHashSHA384,
+		Digest:        make([]byte, 48),
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := dns.NewRR(z.Origin, dns.TypeZONEMD, dns.ClassIN, 3600, placeholder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := z.add(rr); err != nil {
+		t.Fatal(err)
+	}
+
+	priv, key, err := dns.GenerateKey(dns.AlgorithmED25519, dns.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rrs, err := z.Sign(
+		[]SigningKey{{Key: key, Priv: priv}},
+		SignOptions{Inception: now.Add(-time.Hour), Expiration: now.Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The digest of the signed zone is recomputed, and signed.
+	if err := dns.VerifyZoneDigest(z.Origin, rrs); err != nil {
+		t.Errorf("verify error: %v", err)
+	}
+	zonemds := rrsetsOf(rrs)[z.Origin][dns.TypeZONEMD]
+	if len(zonemds) != 1 {
+		t.Fatalf("zonemd records error: got %d - want 1", len(zonemds))
+	}
+	signed := false
+	for _, rr := range rrsetsOf(rrs)[z.Origin][dns.TypeRRSIG] {
+		rd, err := rr.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig := rd.(*dns.RRSIG); sig.TypeCovered == dns.TypeZONEMD {
+			signed = sig.Verify(key, zonemds) == nil
+		}
+	}
+	if !signed {
+		t.Errorf("zonemd records aren't signed")
+	}
+}
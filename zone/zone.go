@@ -0,0 +1,341 @@
+package zone
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+// maxCNAMEChain is the max number of CNAME resource records that are followed
+// within a zone to answer a query.
+const maxCNAMEChain = 8
+
+// Zone holds the resource records of a zone, and answers queries for the
+// domain names in it authoritatively.
+type Zone struct {
+	// Origin is the (lower case) domain name of the apex of the zone.
+	Origin string
+
+	// rrs holds the resource records in the order they were added.
+	rrs []dns.RR
+
+	// rrsets holds the resource record sets per (lower case) owner name and
+	// type.
+	rrsets map[string]map[dns.Type][]dns.RR
+
+	// names holds the domain names that exist: the owner names, and their
+	// ancestors in the zone (empty non-terminals).
+	names map[string]bool
+
+	// soa is the SOA resource record of the apex.
+	soa dns.RR
+}
+
+// Result is the answer to a query, looked up in a zone.
+type Result struct {
+	// RCode is dns.RCodeNoError, or dns.RCodeNameError when the name doesn't
+	// exist.
+	RCode dns.RCode
+
+	// Authoritative is set when the zone is authoritative for the answer; it's
+	// unset for a referral to a delegated child zone.
+	Authoritative bool
+
+	Answer     []dns.RR
+	Authority  []dns.RR
+	Additional []dns.RR
+}
+
+// New creates a zone of the resource records. When the origin is empty, it's
+// the owner name of the SOA resource record. The zone must have a single SOA
+// resource record at the origin, and every resource record must be in the
+// zone.
+func New(origin string, rrs []dns.RR) (*Zone, error) {
+	if origin == "" {
+		for _, rr := range rrs {
+			if rr.Type == dns.TypeSOA {
+				origin = rr.Name
+				break
+			}
+		}
+		if origin == "" {
+			return nil, fmt.Errorf("missing SOA record")
+		}
+	}
+
+	z := &Zone{
+		Origin: strings.ToLower(dns.Fqdn(origin)),
+		rrsets: map[string]map[dns.Type][]dns.RR{},
+		names:  map[string]bool{},
+	}
+	for _, rr := range rrs {
+		if err := z.add(rr); err != nil {
+			return nil, err
+		}
+	}
+	if z.soa.Type != dns.TypeSOA {
+		return nil, fmt.Errorf("missing SOA record at %s", z.Origin)
+	}
+
+	return z, nil
+}
+
+// Load parses the zone file, creates a zone of its resource records (see
+// ParseFile and New), and verifies it with its ZONEMD resource records (see
+// VerifyDigest).
+func Load(path string, origin string) (*Zone, error) {
+	rrs, err := ParseFile(path, origin)
+	if err != nil {
+		return nil, err
+	}
+	z, err := New(origin, rrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := z.VerifyDigest(); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// VerifyDigest verifies the zone with the ZONEMD resource records at its apex
+// (see dns.VerifyZoneDigest); a zone without them passes.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8976#section-4
+func (z *Zone) VerifyDigest() error {
+	if err := dns.VerifyZoneDigest(z.Origin, z.rrs); err != nil {
+		return fmt.Errorf("zone %s failed verification: %v", z.Origin, err)
+	}
+
+	return nil
+}
+
+// add adds the resource record to the zone.
+func (z *Zone) add(rr dns.RR) error {
+	name := strings.ToLower(dns.Fqdn(rr.Name))
+	if !dns.IsSubDomain(z.Origin, name) {
+		return fmt.Errorf("%s %s is out of zone %s", rr.Name, rr.Type, z.Origin)
+	}
+	if rr.Type == dns.TypeSOA {
+		if name != z.Origin {
+			return fmt.Errorf("SOA record at %s isn't at the apex of %s", rr.Name, z.Origin)
+		}
+		if z.soa.Type == dns.TypeSOA {
+			return fmt.Errorf("multiple SOA records at %s", z.Origin)
+		}
+		z.soa = rr
+	}
+
+	z.rrs = append(z.rrs, rr)
+	if z.rrsets[name] == nil {
+		z.rrsets[name] = map[dns.Type][]dns.RR{}
+	}
+	z.rrsets[name][rr.Type] = append(z.rrsets[name][rr.Type], rr)
+	for n := name; !z.names[n]; n = dns.ParentDomainName(n) {
+		z.names[n] = true
+		if n == z.Origin {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Records returns the resource records of the zone, in the order they were
+// added.
+func (z *Zone) Records() []dns.RR {
+	return append([]dns.RR{}, z.rrs...)
+}
+
+// SOA returns the SOA resource record of the zone.
+func (z *Zone) SOA() dns.RR {
+	return z.soa
+}
+
+// Contains checks if the domain name is in the zone.
+func (z *Zone) Contains(name string) bool {
+	return dns.IsSubDomain(z.Origin, name)
+}
+
+// Lookup looks up the answer to a query for the domain name (which must be in
+// the zone) and type (or ANY). It follows CNAME resource records within the
+// zone, synthesizes answers from wildcards, and refers queries for names at or
+// below a zone cut to the delegated name servers.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1034#section-4.3.2
+func (z *Zone) Lookup(name string, qt dns.QType) Result {
+	r := Result{Authoritative: true}
+	name = strings.ToLower(dns.Fqdn(name))
+
+	for i := 0; i <= maxCNAMEChain; i++ {
+		if cut, ok := z.findCut(name, qt); ok {
+			// A referral in answer to a query for the target of a CNAME is still
+			// authoritative for the CNAME.
+			if i == 0 {
+				r.Authoritative = false
+			}
+			r.Authority = append(r.Authority, z.rrsets[cut][dns.TypeNS]...)
+			r.Additional = append(r.Additional, z.addresses(z.rrsets[cut][dns.TypeNS])...)
+			return r
+		}
+
+		owner, rrsets, ok := z.find(name)
+		if !ok {
+			r.RCode = dns.RCodeNameError
+			r.Authority = append(r.Authority, z.negativeSOA())
+			return r
+		}
+
+		// An ANY query is answered with all resource record sets of the name (in
+		// type order), including a CNAME resource record, which isn't followed.
+		if qt == dns.TypeANY && len(rrsets) > 0 {
+			types := make([]dns.Type, 0, len(rrsets))
+			for t := range rrsets {
+				types = append(types, t)
+			}
+			sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+			for _, t := range types {
+				r.Answer = append(r.Answer, synthesize(rrsets[t], owner)...)
+				r.Additional = append(r.Additional, z.addresses(rrsets[t])...)
+			}
+			return r
+		}
+
+		if rrset, ok := rrsets[qt]; ok {
+			r.Answer = append(r.Answer, synthesize(rrset, owner)...)
+			r.Additional = append(r.Additional, z.addresses(rrset)...)
+			return r
+		}
+
+		cnames, ok := rrsets[dns.TypeCNAME]
+		if !ok || qt == dns.TypeCNAME {
+			r.Authority = append(r.Authority, z.negativeSOA())
+			return r
+		}
+		r.Answer = append(r.Answer, synthesize(cnames, owner)...)
+		name = strings.ToLower(cnames[0].RDataUnpacked)
+		if !z.Contains(name) {
+			return r
+		}
+	}
+
+	return r
+}
+
+// findCut finds the zone cut (i.e. the owner of NS resource records below the
+// apex) at or above the domain name. The parent side of a zone cut is
+// authoritative for DS resource records, so the name itself isn't a zone cut
+// for a DS query.
+func (z *Zone) findCut(name string, qt dns.QType) (string, bool) {
+	labels := strings.Split(strings.TrimSuffix(strings.TrimSuffix(name, z.Origin), "."), ".")
+	if name == z.Origin {
+		return "", false
+	}
+
+	// Walk down from the apex to the name.
+	n := z.Origin
+	for i := len(labels) - 1; i >= 0; i-- {
+		if n == "." {
+			n = labels[i] + "."
+		} else {
+			n = labels[i] + "." + n
+		}
+		if n == name && qt == dns.TypeDS {
+			return "", false
+		}
+		if _, ok := z.rrsets[n][dns.TypeNS]; ok {
+			return n, true
+		}
+	}
+
+	return "", false
+}
+
+// find returns the resource record sets of the domain name. When the name
+// doesn't exist, it returns the ones of the wildcard at its closest encloser
+// (if any). It reports false when neither exists.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc4592#section-3.3.1
+func (z *Zone) find(name string) (string, map[dns.Type][]dns.RR, bool) {
+	if z.names[name] {
+		return name, z.rrsets[name], true
+	}
+
+	for ce := dns.ParentDomainName(name); dns.IsSubDomain(z.Origin, ce); ce = dns.ParentDomainName(ce) {
+		if !z.names[ce] {
+			continue
+		}
+		wildcard := "*." + ce
+		if ce == "." {
+			wildcard = "*."
+		}
+		if rrsets, ok := z.rrsets[wildcard]; ok {
+			return name, rrsets, true
+		}
+		break
+	}
+
+	return "", nil, false
+}
+
+// negativeSOA returns the SOA resource record of the authority section of a
+// negative answer, whose TTL is the minimum of its TTL and MINIMUM field.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc2308#section-3
+func (z *Zone) negativeSOA() dns.RR {
+	soa := z.soa
+	fields := strings.Fields(soa.RDataUnpacked)
+	if len(fields) == 7 {
+		if min, err := strconv.ParseUint(fields[6], 10, 32); err == nil && uint32(min) < soa.TTL {
+			soa.TTL = uint32(min)
+		}
+	}
+
+	return soa
+}
+
+// addresses returns the A and AAAA resource records in the zone of the target
+// domain names of the NS, MX and SRV resource records (additional section
+// processing).
+//
+// See: https://datatracker.ietf.org/doc/html/rfc1035#section-3.3
+func (z *Zone) addresses(rrs []dns.RR) []dns.RR {
+	addrs := []dns.RR{}
+	seen := map[string]bool{}
+	for _, rr := range rrs {
+		if rr.Type != dns.TypeNS && rr.Type != dns.TypeMX && rr.Type != dns.TypeSRV {
+			continue
+		}
+		fields := strings.Fields(rr.RDataUnpacked)
+		if len(fields) == 0 {
+			continue
+		}
+		target := strings.ToLower(fields[len(fields)-1])
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		addrs = append(addrs, z.rrsets[target][dns.TypeA]...)
+		addrs = append(addrs, z.rrsets[target][dns.TypeAAAA]...)
+	}
+
+	return addrs
+}
+
+// synthesize returns the resource records with the owner name, which differs
+// from theirs when they're synthesized from a wildcard.
+func synthesize(rrs []dns.RR, owner string) []dns.RR {
+	synth := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		if !strings.EqualFold(rr.Name, owner) {
+			rr.Name = owner
+		}
+		synth[i] = rr
+	}
+
+	return synth
+}
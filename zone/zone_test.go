@@ -0,0 +1,180 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danillouz/tdr/dns"
+)
+
+const testZone = `$ORIGIN example.org.
+$TTL 3600
+@	SOA	ns1 hostmaster 1 7200 3600 1209600 300
+	NS	ns1
+	MX	10 mail
+ns1	A	192.0.2.53
+mail	A	192.0.2.25
+www	CNAME	web
+web	A	192.0.2.80
+ext	CNAME	www.example.com.
+a.b.c	A	192.0.2.1
+*.wild	A	192.0.2.42
+sub	NS	ns.sub
+ns.sub	A	192.0.2.54
+`
+
+func newTestZone(t *testing.T) *Zone {
+	t.Helper()
+
+	rrs, err := Parse(strings.NewReader(testZone), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := New("", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return z
+}
+
+// names returns the owner names and types of the resource records.
+func names(rrs []dns.RR) string {
+	s := []string{}
+	for _, rr := range rrs {
+		s = append(s, rr.Name+" "+rr.Type.String())
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func TestZoneLookup(t *testing.T) {
+	z := newTestZone(t)
+
+	tests := []struct {
+		name          string
+		qname         string
+		qt            dns.QType
+		rcode         dns.RCode
+		authoritative bool
+		answer        string
+		authority     string
+		additional    string
+	}{
+		{
+			name: "answer", qname: "WWW.example.org", qt: dns.TypeA, authoritative: true,
+			answer: "www.example.org. CNAME, web.example.org. A",
+		},
+		{
+			name: "additional", qname: "example.org.", qt: dns.TypeMX, authoritative: true,
+			answer: "example.org. MX", additional: "mail.example.org. A",
+		},
+		{
+			name: "cname out of zone", qname: "ext.example.org.", qt: dns.TypeA, authoritative: true,
+			answer: "ext.example.org. CNAME",
+		},
+		{
+			name: "cname query", qname: "www.example.org.", qt: dns.TypeCNAME, authoritative: true,
+			answer: "www.example.org. CNAME",
+		},
+		{
+			name: "any", qname: "example.org.", qt: dns.TypeANY, authoritative: true,
+			answer:     "example.org. NS, example.org. SOA, example.org. MX",
+			additional: "ns1.example.org. A, mail.example.org. A",
+		},
+		{
+			name: "any cname", qname: "www.example.org.", qt: dns.TypeANY, authoritative: true,
+			answer: "www.example.org. CNAME",
+		},
+		{
+			name: "any empty non-terminal", qname: "c.example.org.", qt: dns.TypeANY, authoritative: true,
+			authority: "example.org. SOA",
+		},
+		{
+			name: "nodata", qname: "web.example.org.", qt: dns.TypeAAAA, authoritative: true,
+			authority: "example.org. SOA",
+		},
+		{
+			name: "empty non-terminal", qname: "b.c.example.org.", qt: dns.TypeA, authoritative: true,
+			authority: "example.org. SOA",
+		},
+		{
+			name: "nxdomain", qname: "nope.example.org.", qt: dns.TypeA, authoritative: true,
+			rcode: dns.RCodeNameError, authority: "example.org. SOA",
+		},
+		{
+			name: "wildcard", qname: "x.y.wild.example.org.", qt: dns.TypeA, authoritative: true,
+			answer: "x.y.wild.example.org. A",
+		},
+		{
+			name: "wildcard nodata", qname: "x.wild.example.org.", qt: dns.TypeTXT, authoritative: true,
+			authority: "example.org. SOA",
+		},
+		{
+			name: "referral", qname: "www.sub.example.org.", qt: dns.TypeA,
+			authority: "sub.example.org. NS", additional: "ns.sub.example.org. A",
+		},
+		{
+			name: "referral at cut", qname: "sub.example.org.", qt: dns.TypeNS,
+			authority: "sub.example.org. NS", additional: "ns.sub.example.org. A",
+		},
+		{
+			name: "ds at cut", qname: "sub.example.org.", qt: dns.TypeDS, authoritative: true,
+			authority: "example.org. SOA",
+		},
+	}
+	for _, tc := range tests {
+		r := z.Lookup(tc.qname, tc.qt)
+		if r.RCode != tc.rcode {
+			t.Errorf("%s rcode error: got %s - want %s", tc.name, r.RCode, tc.rcode)
+		}
+		if r.Authoritative != tc.authoritative {
+			t.Errorf("%s authoritative error: got %t - want %t", tc.name, r.Authoritative, tc.authoritative)
+		}
+		if got := names(r.Answer); got != tc.answer {
+			t.Errorf("%s answer error: got %q - want %q", tc.name, got, tc.answer)
+		}
+		if got := names(r.Authority); got != tc.authority {
+			t.Errorf("%s authority error: got %q - want %q", tc.name, got, tc.authority)
+		}
+		if got := names(r.Additional); got != tc.additional {
+			t.Errorf("%s additional error: got %q - want %q", tc.name, got, tc.additional)
+		}
+	}
+}
+
+func TestZoneNegativeTTL(t *testing.T) {
+	z := newTestZone(t)
+
+	r := z.Lookup("nope.example.org.", dns.TypeA)
+	if len(r.Authority) != 1 || r.Authority[0].TTL != 300 {
+		t.Fatalf("negative soa ttl error: got %v - want 300", r.Authority)
+	}
+	if z.SOA().TTL != 3600 {
+		t.Errorf("soa ttl error: got %d - want 3600", z.SOA().TTL)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	soa, err := dns.NewRR("example.org.", dns.TypeSOA, dns.ClassIN, 60, append(
+		[]byte{0, 0}, make([]byte, 20)...,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := dns.NewRR("example.com.", dns.TypeA, dns.ClassIN, 60, []byte{192, 0, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]dns.RR{
+		"missing soa":  {a},
+		"multiple soa": {soa, soa},
+		"out of zone":  {soa, a},
+	}
+	for name, rrs := range tests {
+		if _, err := New("", rrs); err == nil {
+			t.Errorf("%s error: got nil - want error", name)
+		}
+	}
+}